@@ -0,0 +1,220 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"hubsystem/internal/nxd/store"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// ─── Anotações na linha do tempo / diário do operador (store/annotations.go) ─
+
+// annotationAuthorName retorna o nome do usuário (ou o email) para gravar como autor.
+func annotationAuthorName(userID int64) string {
+	db := GetDB()
+	if db == nil {
+		return ""
+	}
+	var email, fullName string
+	db.QueryRow("SELECT email, COALESCE(full_name,'') FROM users WHERE id = $1", userID).Scan(&email, &fullName)
+	if strings.TrimSpace(fullName) != "" {
+		return fullName
+	}
+	return email
+}
+
+// annotationBody — payload de criação/edição. Sem asset_id e sector_id = fábrica inteira.
+type annotationBody struct {
+	AssetID  *uuid.UUID `json:"asset_id"`
+	SectorID *uuid.UUID `json:"sector_id"`
+	StartsAt *time.Time `json:"starts_at"`
+	EndsAt   *time.Time `json:"ends_at"`
+	Category string     `json:"category"`
+	Text     string     `json:"text"`
+}
+
+func (b annotationBody) row(id uuid.UUID) store.AnnotationRow {
+	n := store.AnnotationRow{ID: id, AssetID: b.AssetID, SectorID: b.SectorID, EndsAt: b.EndsAt, Category: b.Category, Text: b.Text}
+	if b.StartsAt != nil {
+		n.StartsAt = *b.StartsAt
+	}
+	return n
+}
+
+// ListAnnotationsHandler — GET /api/annotations?period=24h|7d|current_shift|last_shift | start=&end=
+// &sector_id=&asset_id=&category=&limit=500
+// Por ativo inclui as anotações do setor e da fábrica; por setor, as dos seus ativos e da fábrica.
+func ListAnnotationsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	q := store.AnnotationQuery{FactoryID: factoryID, Category: r.URL.Query().Get("category")}
+	if q.SectorID, err = parseOptionalUUID(r, "sector_id"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.AssetID, err = parseOptionalUUID(r, "asset_id"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Start, q.End, _, err = resolveProductionPeriod(r, nxdDB, factoryID, q.SectorID, "7d"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	q.Limit, _ = strconv.Atoi(r.URL.Query().Get("limit"))
+	list, err := store.ListAnnotations(nxdDB, q)
+	if err != nil {
+		log.Printf("[Annotations] List: %v", err)
+		http.Error(w, "Erro ao listar anotações", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"annotations": list, "categories": store.AnnotationCategories})
+}
+
+// CreateAnnotationHandler — POST /api/annotations
+// Body: { "asset_id": "uuid|null", "sector_id": "uuid|null", "starts_at": "RFC3339 (padrão agora)",
+// "ends_at": "RFC3339|null", "category": "setup|material|maintenance|quality|process|other", "text": "Troca de molde" }
+func CreateAnnotationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body annotationBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	if body.StartsAt == nil {
+		now := time.Now()
+		body.StartsAt = &now
+	}
+	id, err := store.CreateAnnotation(nxdDB, factoryID, body.row(uuid.Nil), userID, annotationAuthorName(userID))
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidAnnotation) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("[Annotations] Create: %v", err)
+		http.Error(w, "Erro ao salvar anotação", http.StatusInternalServerError)
+		return
+	}
+	newVal, _ := json.Marshal(body)
+	LogAudit(userID, "annotation_created", "annotation", id.String(), "", string(newVal), ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": id})
+}
+
+// UpdateAnnotationHandler — PUT /api/annotations/{id} (mesmo body do POST; starts_at obrigatório)
+func UpdateAnnotationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	var body annotationBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	found, err := store.UpdateAnnotation(nxdDB, factoryID, body.row(id))
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidAnnotation) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("[Annotations] Update: %v", err)
+		http.Error(w, "Erro ao salvar anotação", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Anotação não encontrada", http.StatusNotFound)
+		return
+	}
+	newVal, _ := json.Marshal(body)
+	LogAudit(userID, "annotation_updated", "annotation", id.String(), "", string(newVal), ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// DeleteAnnotationHandler — DELETE /api/annotations/{id}
+func DeleteAnnotationHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	found, err := store.DeleteAnnotation(nxdDB, factoryID, id)
+	if err != nil {
+		log.Printf("[Annotations] Delete: %v", err)
+		http.Error(w, "Erro ao remover anotação", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Anotação não encontrada", http.StatusNotFound)
+		return
+	}
+	LogAudit(userID, "annotation_deleted", "annotation", id.String(), "", "", ClientIP(r))
+	w.WriteHeader(http.StatusNoContent)
+}
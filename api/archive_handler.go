@@ -0,0 +1,223 @@
+package api
+
+// archive_handler.go — Consulta de histórico de telemetria (quente + arquivado)
+// e administração do arquivamento de dados frios.
+//
+// Routes (all require JWT auth via authRouter):
+//   GET  /api/telemetry/history        — leituras de um intervalo (lê arquivos transparentemente)
+//   GET  /api/admin/archives           — manifesto de arquivos da fábrica
+//   POST /api/admin/archives/run       — arquiva agora os dias fora da retenção (admin)
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"hubsystem/internal/nxd/store"
+
+	"github.com/google/uuid"
+)
+
+// TelemetryHistoryHandler — GET /api/telemetry/history?from=&to=&asset_id=&metric_key=&limit=
+// from/to em RFC3339 (padrão: últimas 24h). Dias já arquivados são lidos dos arquivos.
+// Com asset_id + metric_key de uma métrica virtual mode=query, os pontos são calculados.
+// transform=increase|rate (exige asset_id + metric_key) trata a tag como contador
+// (resets/rollover, counters.go); rate_unit=s|min|h (padrão h) define a taxa.
+// annotations traz as anotações do período (do ativo, do setor dele e da fábrica) para
+// marcar no gráfico.
+func TelemetryHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD não disponível", http.StatusServiceUnavailable)
+		return
+	}
+
+	q := r.URL.Query()
+	rq := store.TelemetryRangeQuery{FactoryID: factoryID, To: time.Now(), MetricKey: q.Get("metric_key")}
+	rq.From = rq.To.Add(-24 * time.Hour)
+	if v := q.Get("from"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "from inválido (use RFC3339)", http.StatusBadRequest)
+			return
+		}
+		rq.From = t
+	}
+	if v := q.Get("to"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			http.Error(w, "to inválido (use RFC3339)", http.StatusBadRequest)
+			return
+		}
+		rq.To = t
+	}
+	if !rq.From.Before(rq.To) {
+		http.Error(w, "from deve ser anterior a to", http.StatusBadRequest)
+		return
+	}
+	if v := q.Get("asset_id"); v != "" {
+		aid, err := uuid.Parse(v)
+		if err != nil {
+			http.Error(w, "asset_id inválido", http.StatusBadRequest)
+			return
+		}
+		rq.AssetID = &aid
+	}
+	if v := q.Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 50000 {
+			rq.Limit = n
+		}
+	}
+	transform := q.Get("transform")
+	ratePer := 3600.0
+	switch transform {
+	case "":
+	case "increase", "rate":
+		if rq.AssetID == nil || rq.MetricKey == "" {
+			http.Error(w, "transform exige asset_id e metric_key", http.StatusBadRequest)
+			return
+		}
+		switch q.Get("rate_unit") {
+		case "", "h":
+		case "min":
+			ratePer = 60
+		case "s":
+			ratePer = 1
+		default:
+			http.Error(w, "rate_unit inválido (use s, min ou h)", http.StatusBadRequest)
+			return
+		}
+	default:
+		http.Error(w, "transform inválido (use increase ou rate)", http.StatusBadRequest)
+		return
+	}
+
+	// Métrica virtual mode=query: calculada agora a partir das entradas do período.
+	var points []store.TelemetryPoint
+	var truncated, virtual bool
+	if rq.AssetID != nil && rq.MetricKey != "" {
+		points, truncated, virtual, err = store.QueryVirtualMetricRange(r.Context(), nxdDB, store.GetArchiveStorage(),
+			factoryID, *rq.AssetID, rq.MetricKey, rq.From, rq.To, rq.Limit)
+	}
+	if err == nil && !virtual {
+		points, truncated, err = store.QueryTelemetryRange(r.Context(), nxdDB, store.GetArchiveStorage(), rq)
+	}
+	if err != nil {
+		log.Printf("[TelemetryHistory] %v", err)
+		http.Error(w, "Erro ao buscar histórico", http.StatusInternalServerError)
+		return
+	}
+	if transform != "" {
+		cfg := store.GetCounterConfig(nxdDB, *rq.AssetID, rq.MetricKey)
+		points = store.CounterTransform(points, cfg, transform, ratePer)
+	}
+	if points == nil {
+		points = []store.TelemetryPoint{}
+	}
+	notes, err := store.ListAnnotations(nxdDB, store.AnnotationQuery{FactoryID: factoryID, AssetID: rq.AssetID, Start: rq.From, End: rq.To, Limit: 500})
+	if err != nil {
+		log.Printf("[TelemetryHistory] Anotações: %v", err)
+		notes = []store.AnnotationRow{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":        rq.From,
+		"to":          rq.To,
+		"points":      points,
+		"count":       len(points),
+		"truncated":   truncated,
+		"annotations": notes,
+	})
+}
+
+// ListTelemetryArchivesHandler — GET /api/admin/archives
+func ListTelemetryArchivesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	if !userHasRole(userID, "admin") {
+		http.Error(w, "Acesso negado", http.StatusForbidden)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD não disponível", http.StatusServiceUnavailable)
+		return
+	}
+	list, err := store.ListTelemetryArchives(nxdDB, factoryID, time.Time{}, time.Time{}, false)
+	if err != nil {
+		log.Printf("[Archives] list: %v", err)
+		http.Error(w, "Erro ao listar arquivos", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []store.TelemetryArchiveRow{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"archives":       list,
+		"retention_days": int(store.TelemetryRetention().Hours() / 24),
+	})
+}
+
+// RunTelemetryArchiveHandler — POST /api/admin/archives/run
+// Arquiva imediatamente os dias da fábrica fora da janela de retenção.
+func RunTelemetryArchiveHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	if !userHasRole(userID, "admin") {
+		http.Error(w, "Acesso negado", http.StatusForbidden)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD não disponível", http.StatusServiceUnavailable)
+		return
+	}
+	retention := store.TelemetryRetention()
+	if retention <= 0 {
+		http.Error(w, fmt.Sprintf("Arquivamento desativado (NXD_TELEMETRY_RETENTION_DAYS ausente ou menor que %d)",
+			store.TelemetryMinRetentionDays), http.StatusConflict)
+		return
+	}
+	n, err := store.ArchiveClosedRanges(r.Context(), nxdDB, store.GetArchiveStorage(), time.Now().Add(-retention), &factoryID)
+	if err != nil {
+		log.Printf("[Archives] run: %v", err)
+		http.Error(w, "Erro ao arquivar telemetria", http.StatusInternalServerError)
+		return
+	}
+	LogAudit(userID, "archive_telemetry", "telemetry_archive", factoryID.String(), "", strconv.Itoa(n), ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success":  true,
+		"archived": n,
+	})
+}
@@ -0,0 +1,396 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hubsystem/internal/nxd/store"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// ─── Saúde dos ativos (score preditivo) e manutenções ───────────────────────
+
+// healthError responde os erros de validação do store (400); false = erro interno.
+func healthError(w http.ResponseWriter, err error) bool {
+	if errors.Is(err, store.ErrInvalidHealth) || errors.Is(err, store.ErrInvalidMaintenance) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return true
+	}
+	return false
+}
+
+// GetAssetHealthHandler — GET /api/asset-health?sector_id=uuid&live=true
+// Último score gravado de cada ativo (pior primeiro), com a contribuição de cada fator.
+// live=true calcula agora, sem gravar.
+func GetAssetHealthHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	sectorID, err := parseOptionalUUID(r, "sector_id")
+	if err != nil {
+		http.Error(w, "sector_id inválido", http.StatusBadRequest)
+		return
+	}
+	var list []store.AssetHealthRow
+	if r.URL.Query().Get("live") == "true" {
+		list, err = store.ComputeAssetHealth(nxdDB, factoryID, sectorID, nil, time.Now())
+	} else {
+		list, err = store.ListLatestAssetHealth(nxdDB, factoryID, sectorID)
+	}
+	if err != nil {
+		log.Printf("[Health] List: %v", err)
+		http.Error(w, "Erro ao calcular saúde dos ativos", http.StatusInternalServerError)
+		return
+	}
+	model, err := store.GetHealthModel(nxdDB, factoryID)
+	if err != nil {
+		log.Printf("[Health] Model: %v", err)
+		http.Error(w, "Erro ao calcular saúde dos ativos", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"assets": list, "model": model})
+}
+
+// GetAssetHealthHistoryHandler — GET /api/asset-health/history?asset_id=uuid&period=7d|30d | start=&end= (RFC3339)
+func GetAssetHealthHistoryHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	assetID, err := parseOptionalUUID(r, "asset_id")
+	if err != nil || assetID == nil {
+		http.Error(w, "asset_id inválido", http.StatusBadRequest)
+		return
+	}
+	start, end, period, err := parseAnalyticsPeriod(r, "30d")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, err := store.ListAssetHealthHistory(nxdDB, factoryID, *assetID, start, end)
+	if err != nil {
+		log.Printf("[Health] History: %v", err)
+		http.Error(w, "Erro ao buscar histórico", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"history": list, "period": period})
+}
+
+// GetHealthModelHandler — GET /api/asset-health/model
+// Versão atual (version 0 = padrão) e todas as versões salvas.
+func GetHealthModelHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	model, err := store.GetHealthModel(nxdDB, factoryID)
+	if err != nil {
+		log.Printf("[Health] Model: %v", err)
+		http.Error(w, "Erro ao buscar modelo", http.StatusInternalServerError)
+		return
+	}
+	versions, err := store.ListHealthModels(nxdDB, factoryID)
+	if err != nil {
+		log.Printf("[Health] Models: %v", err)
+		http.Error(w, "Erro ao buscar modelo", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"model": model, "versions": versions})
+}
+
+// SaveHealthModelHandler — PUT /api/asset-health/model
+// Body: { "w_anomalies": 25, "w_trend": 30, "w_stops": 25, "w_run_hours": 20, "anomaly_full_per_day": 4,
+// "trend_full_z": 3, "stops_full_per_day": 6, "maintenance_interval_h": 500, "notes": "" }
+// Cria uma nova versão; os registros de saúde guardam a versão usada.
+func SaveHealthModelHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	body := store.DefaultHealthModel
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	version, err := store.SaveHealthModel(nxdDB, factoryID, body, userID)
+	if err != nil {
+		if healthError(w, err) {
+			return
+		}
+		log.Printf("[Health] Save model: %v", err)
+		http.Error(w, "Erro ao salvar modelo", http.StatusInternalServerError)
+		return
+	}
+	LogAudit(userID, "health_model_saved", "health_model", fmt.Sprintf("%s/v%d", factoryID, version), "",
+		fmt.Sprintf("pesos %g/%g/%g/%g", body.WAnomalies, body.WTrend, body.WStops, body.WRunHours), ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "version": version})
+}
+
+// ListHealthTagsHandler — GET /api/asset-health/tags
+func ListHealthTagsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	list, err := store.ListHealthTags(nxdDB, factoryID)
+	if err != nil {
+		log.Printf("[Health] List tags: %v", err)
+		http.Error(w, "Erro ao listar tags", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"tags": list})
+}
+
+// CreateHealthTagHandler — POST /api/asset-health/tags
+// Body: { "asset_id": "uuid" (opcional: vazio = todos os ativos), "metric_key": "Temperatura", "direction": "up" | "down" | "both" }
+func CreateHealthTagHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body store.HealthTagRow
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	id, err := store.CreateHealthTag(nxdDB, factoryID, body)
+	if err != nil {
+		if healthError(w, err) {
+			return
+		}
+		log.Printf("[Health] Create tag: %v", err)
+		http.Error(w, "Erro ao salvar tag", http.StatusInternalServerError)
+		return
+	}
+	LogAudit(userID, "health_tag_saved", "health_tag", id.String(), "", body.MetricKey+" "+body.Direction, ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": id})
+}
+
+// DeleteHealthTagHandler — DELETE /api/asset-health/tags/{id}
+func DeleteHealthTagHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	found, err := store.DeleteHealthTag(nxdDB, factoryID, id)
+	if err != nil {
+		log.Printf("[Health] Delete tag: %v", err)
+		http.Error(w, "Erro ao remover tag", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Tag não encontrada", http.StatusNotFound)
+		return
+	}
+	LogAudit(userID, "health_tag_deleted", "health_tag", id.String(), "", "", ClientIP(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListMaintenanceEventsHandler — GET /api/maintenance-events?asset_id=uuid&period=30d | start=&end= (RFC3339)
+func ListMaintenanceEventsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	assetID, err := parseOptionalUUID(r, "asset_id")
+	if err != nil {
+		http.Error(w, "asset_id inválido", http.StatusBadRequest)
+		return
+	}
+	start, end, period, err := parseAnalyticsPeriod(r, "30d")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, err := store.ListMaintenanceEvents(nxdDB, factoryID, assetID, start, end)
+	if err != nil {
+		log.Printf("[Maintenance] List: %v", err)
+		http.Error(w, "Erro ao listar manutenções", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"events": list, "period": period})
+}
+
+// CreateMaintenanceEventHandler — POST /api/maintenance-events
+// Body: { "asset_id": "uuid", "performed_at": "RFC3339", "kind": "preventive" | "corrective",
+// "description": "", "next_interval_h": 500 (opcional: horas rodando até a próxima) }
+// A manutenção zera as horas rodando do ativo no score de saúde.
+func CreateMaintenanceEventHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body store.MaintenanceEventRow
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	id, err := store.CreateMaintenanceEvent(nxdDB, factoryID, body, userID, time.Now())
+	if err != nil {
+		if healthError(w, err) {
+			return
+		}
+		log.Printf("[Maintenance] Create: %v", err)
+		http.Error(w, "Erro ao salvar manutenção", http.StatusInternalServerError)
+		return
+	}
+	LogAudit(userID, "maintenance_event_created", "maintenance_event", id.String(), "",
+		fmt.Sprintf("%s %s em %s", body.AssetID, body.Kind, body.PerformedAt.Format(time.RFC3339)), ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": id})
+}
+
+// DeleteMaintenanceEventHandler — DELETE /api/maintenance-events/{id}
+func DeleteMaintenanceEventHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	found, err := store.DeleteMaintenanceEvent(nxdDB, factoryID, id)
+	if err != nil {
+		log.Printf("[Maintenance] Delete: %v", err)
+		http.Error(w, "Erro ao remover manutenção", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Manutenção não encontrada", http.StatusNotFound)
+		return
+	}
+	LogAudit(userID, "maintenance_event_deleted", "maintenance_event", id.String(), "", "", ClientIP(r))
+	w.WriteHeader(http.StatusNoContent)
+}
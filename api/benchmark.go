@@ -0,0 +1,159 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hubsystem/internal/nxd/store"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// ─── Benchmarking ───────────────────────────────────────────────────────────
+
+// GetBenchmarkHandler — GET /api/benchmark?level=sector|asset|factory&period=30d | start=&end=
+// &sector_id= (nível asset)&sort=oee_pct&industry=true
+// Ranking em KPIs normalizados (OEE, refugo %, parada/h, kWh/peça, perda/h) com percentis,
+// quartis e variação contra o período anterior. factory = fábricas da mesma organização;
+// industry=true inclui a mediana anônima das fábricas participantes.
+func GetBenchmarkHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	q := r.URL.Query()
+	var sectorID *uuid.UUID
+	if v := q.Get("sector_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			http.Error(w, "sector_id inválido", http.StatusBadRequest)
+			return
+		}
+		if s, err := store.GetSectorByID(nxdDB, id, factoryID); err != nil || s == nil {
+			http.Error(w, "Setor não encontrado", http.StatusNotFound)
+			return
+		}
+		sectorID = &id
+	}
+	start, end, period, err := parseAnalyticsPeriod(r, "30d")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rep, err := store.ComputeBenchmark(nxdDB, store.BenchmarkQuery{
+		FactoryID: factoryID,
+		Level:     q.Get("level"),
+		SectorID:  sectorID,
+		Start:     start,
+		End:       end,
+		SortBy:    q.Get("sort"),
+		Industry:  q.Get("industry") == "true",
+	})
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidBenchmark) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("[Benchmark] Compute: %v", err)
+		http.Error(w, "Erro ao calcular benchmark", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"benchmark": rep, "period": period})
+}
+
+// GetBenchmarkSettingsHandler — GET /api/benchmark/settings
+func GetBenchmarkSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	s, err := store.GetBenchmarkSettings(nxdDB, factoryID)
+	if err != nil {
+		log.Printf("[Benchmark] Settings: %v", err)
+		http.Error(w, "Erro ao carregar participação", http.StatusInternalServerError)
+		return
+	}
+	if s == nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+// SetBenchmarkSettingsHandler — PUT /api/benchmark/settings
+// Body: { "opt_in": true, "industry_segment": "autopeças" } (um de store.BenchmarkSegments) — participa da mediana anônima
+// do setor industrial (envia resumos diários sem setores/ativos). opt_in=false apaga os resumos.
+// Consentimento do tenant: só admin.
+func SetBenchmarkSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	if !userHasRole(userID, "admin") {
+		http.Error(w, "Acesso negado", http.StatusForbidden)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body struct {
+		OptIn   bool   `json:"opt_in"`
+		Segment string `json:"industry_segment"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	old, _ := store.GetBenchmarkSettings(nxdDB, factoryID)
+	if err := store.SetBenchmarkSettings(nxdDB, factoryID, body.OptIn, body.Segment); err != nil {
+		if errors.Is(err, store.ErrInvalidBenchmark) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("[Benchmark] Set settings: %v", err)
+		http.Error(w, "Erro ao salvar participação", http.StatusInternalServerError)
+		return
+	}
+	oldValue := ""
+	if old != nil {
+		oldValue = fmt.Sprintf("opt_in=%t %s", old.OptIn, old.Segment)
+	}
+	LogAudit(userID, "benchmark_settings_updated", "factory", factoryID.String(), oldValue,
+		fmt.Sprintf("opt_in=%t %s", body.OptIn, body.Segment), ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
@@ -0,0 +1,491 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hubsystem/internal/nxd/store"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// ─── Calendário de produção (turnos, feriados, horas extras) ──────────────
+
+// resolveProductionPeriod aceita, além de parseAnalyticsPeriod, period=current_shift
+// (turno em andamento) e period=last_shift (último turno encerrado).
+func resolveProductionPeriod(r *http.Request, db *sql.DB, factoryID uuid.UUID, sectorID *uuid.UUID, defaultPeriod string) (time.Time, time.Time, string, error) {
+	p := r.URL.Query().Get("period")
+	if p != "current_shift" && p != "last_shift" {
+		return parseAnalyticsPeriod(r, defaultPeriod)
+	}
+	now := time.Now()
+	in, err := store.ResolveShiftPeriod(db, factoryID, sectorID, p, now)
+	if err != nil {
+		return time.Time{}, time.Time{}, "", err
+	}
+	if in == nil {
+		return time.Time{}, time.Time{}, "", fmt.Errorf("nenhum turno encontrado para %s", p)
+	}
+	end := in.End
+	if end.After(now) {
+		end = now
+	}
+	return in.Start, end, p + ":" + in.Name, nil
+}
+
+// GetCalendarHandler — GET /api/calendar?period=30d | start=&end=
+// Retorna fuso, turnos e as exceções do período (padrão: próximos 365 dias e últimos 30).
+func GetCalendarHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	from, to := time.Now().AddDate(0, 0, -30), time.Now().AddDate(1, 0, 0)
+	if r.URL.Query().Get("start") != "" || r.URL.Query().Get("period") != "" {
+		if from, to, _, err = parseAnalyticsPeriod(r, "30d"); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	loc, err := store.GetFactoryTimezone(nxdDB, factoryID)
+	if err != nil {
+		log.Printf("[Calendar] Timezone: %v", err)
+		http.Error(w, "Erro ao carregar calendário", http.StatusInternalServerError)
+		return
+	}
+	shifts, err := store.ListShifts(nxdDB, factoryID)
+	if err != nil {
+		log.Printf("[Calendar] Shifts: %v", err)
+		http.Error(w, "Erro ao carregar calendário", http.StatusInternalServerError)
+		return
+	}
+	exceptions, err := store.ListCalendarExceptions(nxdDB, factoryID, from, to)
+	if err != nil {
+		log.Printf("[Calendar] Exceptions: %v", err)
+		http.Error(w, "Erro ao carregar calendário", http.StatusInternalServerError)
+		return
+	}
+	if shifts == nil {
+		shifts = []store.ShiftRow{}
+	}
+	if exceptions == nil {
+		exceptions = []store.CalendarExceptionRow{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"timezone":   loc.String(),
+		"shifts":     shifts,
+		"exceptions": exceptions,
+		"always_on":  len(shifts) == 0,
+	})
+}
+
+// SetCalendarTimezoneHandler — PUT /api/calendar/timezone
+// Body: { "timezone": "America/Sao_Paulo" }
+func SetCalendarTimezoneHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body struct {
+		Timezone string `json:"timezone"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	old, _ := store.GetFactoryTimezone(nxdDB, factoryID)
+	if err := store.SetFactoryTimezone(nxdDB, factoryID, body.Timezone); errors.Is(err, store.ErrInvalidCalendar) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	} else if err != nil {
+		log.Printf("[Calendar] Timezone: %v", err)
+		http.Error(w, "Erro ao salvar fuso horário", http.StatusInternalServerError)
+		return
+	}
+	oldName := ""
+	if old != nil {
+		oldName = old.String()
+	}
+	LogAudit(userID, "calendar_timezone_updated", "factory", factoryID.String(), oldName, body.Timezone, ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// shiftBody é o payload de criação/edição de turno.
+type shiftBody struct {
+	Name      string     `json:"name"`
+	SectorID  *uuid.UUID `json:"sector_id"`
+	StartTime string     `json:"start_time"`
+	EndTime   string     `json:"end_time"`
+	Weekdays  []int      `json:"weekdays"`
+	Active    *bool      `json:"active"`
+}
+
+// CreateShiftHandler — POST /api/shifts
+// Body: { "name": "Turno A", "start_time": "06:00", "end_time": "14:00", "weekdays": [1,2,3,4,5], "sector_id": "uuid|null" }
+func CreateShiftHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body shiftBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	if body.SectorID != nil {
+		if s, err := store.GetSectorByID(nxdDB, *body.SectorID, factoryID); err != nil || s == nil {
+			http.Error(w, "Setor não encontrado", http.StatusNotFound)
+			return
+		}
+	}
+	row := store.ShiftRow{
+		FactoryID: factoryID,
+		SectorID:  body.SectorID,
+		Name:      body.Name,
+		StartTime: body.StartTime,
+		EndTime:   body.EndTime,
+		Weekdays:  body.Weekdays,
+		Active:    body.Active == nil || *body.Active,
+	}
+	id, err := store.CreateShift(nxdDB, row)
+	if errors.Is(err, store.ErrInvalidCalendar) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("[Calendar] Create shift: %v", err)
+		http.Error(w, "Erro ao salvar turno", http.StatusInternalServerError)
+		return
+	}
+	LogAudit(userID, "shift_created", "shift", id.String(), "", body.Name+" "+body.StartTime+"-"+body.EndTime, ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": id})
+}
+
+// UpdateShiftHandler — PUT /api/shifts/{id} (mesmo body do POST; substitui o turno)
+func UpdateShiftHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	var body shiftBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	row := store.ShiftRow{
+		ID:        id,
+		FactoryID: factoryID,
+		Name:      body.Name,
+		StartTime: body.StartTime,
+		EndTime:   body.EndTime,
+		Weekdays:  body.Weekdays,
+		Active:    body.Active == nil || *body.Active,
+	}
+	found, err := store.UpdateShift(nxdDB, row)
+	if errors.Is(err, store.ErrInvalidCalendar) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("[Calendar] Update shift: %v", err)
+		http.Error(w, "Erro ao salvar turno", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Turno não encontrado", http.StatusNotFound)
+		return
+	}
+	LogAudit(userID, "shift_updated", "shift", id.String(), "", body.Name+" "+body.StartTime+"-"+body.EndTime, ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// DeleteShiftHandler — DELETE /api/shifts/{id}
+func DeleteShiftHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	found, err := store.DeleteShift(nxdDB, factoryID, id)
+	if err != nil {
+		log.Printf("[Calendar] Delete shift: %v", err)
+		http.Error(w, "Erro ao remover turno", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Turno não encontrado", http.StatusNotFound)
+		return
+	}
+	LogAudit(userID, "shift_deleted", "shift", id.String(), "", "", ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// CreateCalendarExceptionHandler — POST /api/calendar/exceptions
+// Feriado de dia inteiro: { "kind": "holiday", "date": "2024-12-25", "name": "Natal" }
+// Janela livre:           { "kind": "extra", "starts_at": "RFC3339", "ends_at": "RFC3339", "sector_id": "uuid|null" }
+func CreateCalendarExceptionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body struct {
+		Kind     string     `json:"kind"`
+		Date     string     `json:"date"`
+		StartsAt time.Time  `json:"starts_at"`
+		EndsAt   time.Time  `json:"ends_at"`
+		SectorID *uuid.UUID `json:"sector_id"`
+		Name     string     `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	if body.Date != "" {
+		// Dia inteiro no fuso da fábrica.
+		loc, err := store.GetFactoryTimezone(nxdDB, factoryID)
+		if err != nil {
+			log.Printf("[Calendar] Timezone: %v", err)
+			http.Error(w, "Erro ao carregar calendário", http.StatusInternalServerError)
+			return
+		}
+		d, err := time.ParseInLocation("2006-01-02", body.Date, loc)
+		if err != nil {
+			http.Error(w, "date inválido (use AAAA-MM-DD)", http.StatusBadRequest)
+			return
+		}
+		body.StartsAt, body.EndsAt = d, d.AddDate(0, 0, 1)
+	}
+	if body.SectorID != nil {
+		if s, err := store.GetSectorByID(nxdDB, *body.SectorID, factoryID); err != nil || s == nil {
+			http.Error(w, "Setor não encontrado", http.StatusNotFound)
+			return
+		}
+	}
+	id, err := store.CreateCalendarException(nxdDB, store.CalendarExceptionRow{
+		FactoryID: factoryID,
+		SectorID:  body.SectorID,
+		Kind:      body.Kind,
+		StartsAt:  body.StartsAt,
+		EndsAt:    body.EndsAt,
+		Name:      body.Name,
+	})
+	if errors.Is(err, store.ErrInvalidCalendar) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("[Calendar] Create exception: %v", err)
+		http.Error(w, "Erro ao salvar exceção do calendário", http.StatusInternalServerError)
+		return
+	}
+	LogAudit(userID, "calendar_exception_created", "calendar_exception", id.String(), "",
+		body.Kind+" "+body.StartsAt.Format(time.RFC3339)+" → "+body.EndsAt.Format(time.RFC3339), ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": id})
+}
+
+// DeleteCalendarExceptionHandler — DELETE /api/calendar/exceptions/{id}
+func DeleteCalendarExceptionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	found, err := store.DeleteCalendarException(nxdDB, factoryID, id)
+	if err != nil {
+		log.Printf("[Calendar] Delete exception: %v", err)
+		http.Error(w, "Erro ao remover exceção do calendário", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Exceção não encontrada", http.StatusNotFound)
+		return
+	}
+	LogAudit(userID, "calendar_exception_deleted", "calendar_exception", id.String(), "", "", ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// ─── Relatórios por turno ──────────────────────────────────────────────────
+
+// ListShiftInstancesHandler — GET /api/shifts/instances?period=7d&sector_id=
+// Ocorrências concretas dos turnos (para escolher um período "por turno" na UI).
+func ListShiftInstancesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	sectorID, err := parseOptionalUUID(r, "sector_id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	start, end, _, err := parseAnalyticsPeriod(r, "7d")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	cal, err := store.LoadProductionCalendar(nxdDB, factoryID, start, end)
+	if err != nil {
+		log.Printf("[Calendar] Instances: %v", err)
+		http.Error(w, "Erro ao carregar calendário", http.StatusInternalServerError)
+		return
+	}
+	list := cal.ShiftInstances(sectorID, start, end)
+	if list == nil {
+		list = []store.ShiftInstance{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"instances": list, "timezone": cal.Location.String()})
+}
+
+// GetShiftReportHandler — GET /api/shifts/report?period=7d&sector_id=
+// OEE, financeiro e paradas de cada turno do período.
+func GetShiftReportHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	sectorID, err := parseOptionalUUID(r, "sector_id")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	start, end, period, err := parseAnalyticsPeriod(r, "7d")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	rows, err := store.ComputeShiftReport(nxdDB, factoryID, sectorID, start, end)
+	if err != nil {
+		log.Printf("[Calendar] Shift report: %v", err)
+		http.Error(w, "Erro ao gerar relatório por turno: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"shifts": rows, "period": period})
+}
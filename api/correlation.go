@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"hubsystem/internal/nxd/store"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ─── Correlação entre tags (causa raiz) ─────────────────────────────────────
+
+// GetCorrelationsHandler — GET /api/correlations?asset_id=uuid&metric=Refugo&scope=asset|sector
+// &period=24h|7d|30d | start=&end= (RFC3339)&step=5m&max_lag=12&limit=20&diff=true
+// Correlação defasada da métrica alvo contra as outras tags do ativo (ou do setor), em
+// ranking por |r|, com as séries alinhadas do alvo e dos melhores candidatos para o gráfico.
+func GetCorrelationsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	qs := r.URL.Query()
+	q := store.CorrelationQuery{FactoryID: factoryID, MetricKey: qs.Get("metric"), Scope: qs.Get("scope"),
+		MaxLag: -1, Limit: 20, Diff: qs.Get("diff") == "true"}
+	assetID, err := parseOptionalUUID(r, "asset_id")
+	if err != nil || assetID == nil {
+		http.Error(w, "asset_id inválido", http.StatusBadRequest)
+		return
+	}
+	q.AssetID = *assetID
+	var period string
+	if q.Start, q.End, period, err = parseAnalyticsPeriod(r, "24h"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if v := qs.Get("step"); v != "" {
+		if q.Step, err = time.ParseDuration(v); err != nil {
+			http.Error(w, "step inválido (ex.: 1m, 5m, 1h)", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := qs.Get("max_lag"); v != "" {
+		if q.MaxLag, err = strconv.Atoi(v); err != nil || q.MaxLag < 0 {
+			http.Error(w, "max_lag inválido", http.StatusBadRequest)
+			return
+		}
+	}
+	if v := qs.Get("limit"); v != "" {
+		if q.Limit, err = strconv.Atoi(v); err != nil || q.Limit < 0 {
+			http.Error(w, "limit inválido", http.StatusBadRequest)
+			return
+		}
+	}
+
+	report, err := store.ComputeCorrelations(nxdDB, q)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidCorrelation) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("[Correlation] Compute: %v", err)
+		http.Error(w, "Erro ao calcular correlações", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"correlations": report,
+		"period":       period,
+	})
+}
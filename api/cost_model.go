@@ -0,0 +1,348 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hubsystem/internal/nxd/store"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// ─── Modelo de custos (parâmetros com vigência, moedas) ─────────────────────
+
+// costModelError responde os erros de validação do store (400/409); false = erro interno.
+func costModelError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, store.ErrInvalidCostParameter):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, store.ErrCostParameterConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		return false
+	}
+	return true
+}
+
+// ListCostParametersHandler — GET /api/cost-parameters
+// Histórico de parâmetros por escopo, cotações e moeda da fábrica.
+func ListCostParametersHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	currency, err := store.GetFactoryCurrency(nxdDB, factoryID)
+	if err != nil {
+		log.Printf("[CostModel] Currency: %v", err)
+		http.Error(w, "Erro ao listar parâmetros de custo", http.StatusInternalServerError)
+		return
+	}
+	list, err := store.ListCostParameters(nxdDB, factoryID)
+	if err != nil {
+		log.Printf("[CostModel] List: %v", err)
+		http.Error(w, "Erro ao listar parâmetros de custo", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []store.CostParameterRow{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"parameters": list, "currency": currency})
+}
+
+// CreateCostParameterHandler — POST /api/cost-parameters
+// Body: { "asset_id": "uuid" | "sector_id": "uuid" | "product": "Tampa 38mm" (no máximo um; nenhum = fábrica),
+// "valid_from": "2025-07-01", "currency": "USD" (opcional), "custo_material_un": 0.42, "custo_mao_obra_turno": 1200,
+// "valor_venda_ok": null (herda), "notes": "reajuste resina" }
+func CreateCostParameterHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body store.CostParameterRow
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	if body.AssetID != nil {
+		if a, err := store.GetAssetByID(nxdDB, *body.AssetID, factoryID); err != nil || a == nil {
+			http.Error(w, "Ativo não encontrado", http.StatusNotFound)
+			return
+		}
+	}
+	if body.SectorID != nil {
+		if s, err := store.GetSectorByID(nxdDB, *body.SectorID, factoryID); err != nil || s == nil {
+			http.Error(w, "Setor não encontrado", http.StatusNotFound)
+			return
+		}
+	}
+	body.FactoryID = factoryID
+	id, err := store.CreateCostParameter(nxdDB, body)
+	if err != nil {
+		if costModelError(w, err) {
+			return
+		}
+		log.Printf("[CostModel] Create: %v", err)
+		http.Error(w, "Erro ao salvar parâmetro de custo", http.StatusInternalServerError)
+		return
+	}
+	LogAudit(userID, "cost_parameter_created", "cost_parameter", id.String(), "",
+		fmt.Sprintf("vigência %s", body.ValidFrom), ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": id})
+}
+
+// UpdateCostParameterHandler — PUT /api/cost-parameters/{id}
+// Mesmo body do POST; o escopo (asset_id/sector_id/product) não muda.
+func UpdateCostParameterHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	var body store.CostParameterRow
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	body.ID, body.FactoryID = id, factoryID
+	found, err := store.UpdateCostParameter(nxdDB, body)
+	if err != nil {
+		if costModelError(w, err) {
+			return
+		}
+		log.Printf("[CostModel] Update: %v", err)
+		http.Error(w, "Erro ao salvar parâmetro de custo", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Parâmetro de custo não encontrado", http.StatusNotFound)
+		return
+	}
+	LogAudit(userID, "cost_parameter_updated", "cost_parameter", id.String(), "",
+		fmt.Sprintf("vigência %s", body.ValidFrom), ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// DeleteCostParameterHandler — DELETE /api/cost-parameters/{id}
+func DeleteCostParameterHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	found, err := store.DeleteCostParameter(nxdDB, factoryID, id)
+	if err != nil {
+		log.Printf("[CostModel] Delete: %v", err)
+		http.Error(w, "Erro ao remover parâmetro de custo", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Parâmetro de custo não encontrado", http.StatusNotFound)
+		return
+	}
+	LogAudit(userID, "cost_parameter_deleted", "cost_parameter", id.String(), "", "", ClientIP(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// SetFactoryCurrencyHandler — PUT /api/business-config/currency
+// Body: { "currency": "BRL" } — moeda dos resultados financeiros (valores cadastrados não são convertidos).
+func SetFactoryCurrencyHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body struct {
+		Currency string `json:"currency"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	old, _ := store.GetFactoryCurrency(nxdDB, factoryID)
+	if err := store.SetFactoryCurrency(nxdDB, factoryID, body.Currency); err != nil {
+		if costModelError(w, err) {
+			return
+		}
+		log.Printf("[CostModel] Currency: %v", err)
+		http.Error(w, "Erro ao salvar moeda", http.StatusInternalServerError)
+		return
+	}
+	LogAudit(userID, "factory_currency_updated", "factory", factoryID.String(), old, body.Currency, ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// ListExchangeRatesHandler — GET /api/exchange-rates
+func ListExchangeRatesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	list, err := store.ListExchangeRates(nxdDB, factoryID)
+	if err != nil {
+		log.Printf("[CostModel] ListRates: %v", err)
+		http.Error(w, "Erro ao listar cotações", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []store.ExchangeRateRow{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"rates": list})
+}
+
+// CreateExchangeRateHandler — POST /api/exchange-rates
+// Body: { "currency": "USD", "valid_from": "2025-07-01", "rate": 5.42 } — unidades da moeda da fábrica por 1 USD.
+func CreateExchangeRateHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body store.ExchangeRateRow
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	body.FactoryID = factoryID
+	id, err := store.CreateExchangeRate(nxdDB, body)
+	if err != nil {
+		if costModelError(w, err) {
+			return
+		}
+		log.Printf("[CostModel] CreateRate: %v", err)
+		http.Error(w, "Erro ao salvar cotação", http.StatusInternalServerError)
+		return
+	}
+	LogAudit(userID, "exchange_rate_created", "exchange_rate", id.String(), "",
+		fmt.Sprintf("%s a partir de %s: %g", body.Currency, body.ValidFrom, body.Rate), ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": id})
+}
+
+// DeleteExchangeRateHandler — DELETE /api/exchange-rates/{id}
+func DeleteExchangeRateHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	found, err := store.DeleteExchangeRate(nxdDB, factoryID, id)
+	if err != nil {
+		log.Printf("[CostModel] DeleteRate: %v", err)
+		http.Error(w, "Erro ao remover cotação", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Cotação não encontrada", http.StatusNotFound)
+		return
+	}
+	LogAudit(userID, "exchange_rate_deleted", "exchange_rate", id.String(), "", "", ClientIP(r))
+	w.WriteHeader(http.StatusNoContent)
+}
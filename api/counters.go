@@ -0,0 +1,133 @@
+package api
+
+// counters.go — Semântica de contador por tag (reset, rollover do registrador).
+//
+// Routes (all require JWT auth via authRouter):
+//   GET    /api/counters                          — configurações da fábrica
+//   PUT    /api/counters                          — cria/atualiza a configuração de uma tag
+//   DELETE /api/counters?asset_id=&metric_key=    — volta a tag para o padrão
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"hubsystem/internal/nxd/store"
+
+	"github.com/google/uuid"
+)
+
+// ListCounterConfigsHandler — GET /api/counters
+func ListCounterConfigsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	list, err := store.ListCounterConfigs(nxdDB, factoryID)
+	if err != nil {
+		log.Printf("[Counters] List: %v", err)
+		http.Error(w, "Erro ao listar contadores", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []store.CounterConfigRow{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"counters": list})
+}
+
+// UpsertCounterConfigHandler — PUT /api/counters
+// Body: { "asset_id": "uuid", "metric_key": "Total_Pecas", "rollover_at": 65536, "reset_tolerance": 2 }
+// rollover_at nulo = o contador não dá a volta (toda queda acima da tolerância é reset).
+func UpsertCounterConfigHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body store.CounterConfigRow
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	if a, err := store.GetAssetByID(nxdDB, body.AssetID, factoryID); err != nil || a == nil {
+		http.Error(w, "Ativo não encontrado", http.StatusNotFound)
+		return
+	}
+	if err := store.UpsertCounterConfig(nxdDB, factoryID, body); err != nil {
+		if errors.Is(err, store.ErrInvalidCounterConfig) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("[Counters] Upsert: %v", err)
+		http.Error(w, "Erro ao salvar contador", http.StatusInternalServerError)
+		return
+	}
+	rollover := "sem rollover"
+	if body.RolloverAt != nil {
+		rollover = "rollover " + strconv.FormatFloat(*body.RolloverAt, 'f', -1, 64)
+	}
+	LogAudit(userID, "counter_config_updated", "counter_config", body.AssetID.String()+"/"+body.MetricKey, "", rollover, ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// DeleteCounterConfigHandler — DELETE /api/counters?asset_id=&metric_key=
+func DeleteCounterConfigHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	assetID, err := uuid.Parse(r.URL.Query().Get("asset_id"))
+	if err != nil {
+		http.Error(w, "asset_id inválido", http.StatusBadRequest)
+		return
+	}
+	metricKey := r.URL.Query().Get("metric_key")
+	found, err := store.DeleteCounterConfig(nxdDB, factoryID, assetID, metricKey)
+	if err != nil {
+		log.Printf("[Counters] Delete: %v", err)
+		http.Error(w, "Erro ao remover contador", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Configuração não encontrada", http.StatusNotFound)
+		return
+	}
+	LogAudit(userID, "counter_config_deleted", "counter_config", assetID.String()+"/"+metricKey, "", "", ClientIP(r))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,94 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"hubsystem/internal/nxd/store"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ─── Tempo de ciclo ─────────────────────────────────────────────────────────
+
+// GetCycleTimesHandler — GET /api/cycle-times?period=24h|7d|30d | start=&end= (RFC3339)
+// &asset_id=uuid&order_id=uuid&bucket=1h|1d (múltiplo de 1h)
+// Distribuição dos ciclos (média, desvio, p50/p90/p95/p99, histograma), comparação com o
+// ciclo ideal, micro-paradas e paradas, com quebra por ativo e por ordem de produção.
+// Com order_id e sem período, usa o intervalo da ordem (até agora, se em execução).
+func GetCycleTimesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	q := store.CycleTimeQuery{FactoryID: factoryID}
+	if q.AssetID, err = parseOptionalUUID(r, "asset_id"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.AssetID != nil {
+		if a, err := store.GetAssetByID(nxdDB, *q.AssetID, factoryID); err != nil || a == nil {
+			http.Error(w, "Ativo não encontrado", http.StatusNotFound)
+			return
+		}
+	}
+	if q.OrderID, err = parseOptionalUUID(r, "order_id"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var order *store.ProductionOrderRow
+	if q.OrderID != nil {
+		if order, err = store.GetProductionOrder(nxdDB, factoryID, *q.OrderID); err != nil || order == nil {
+			http.Error(w, "Ordem não encontrada", http.StatusNotFound)
+			return
+		}
+	}
+	var period string
+	qs := r.URL.Query()
+	if order != nil && qs.Get("period") == "" && qs.Get("start") == "" && qs.Get("end") == "" {
+		if order.StartedAt == nil {
+			http.Error(w, "Ordem ainda não iniciada", http.StatusBadRequest)
+			return
+		}
+		q.Start, q.End, period = *order.StartedAt, time.Now(), "order"
+		if order.EndedAt != nil {
+			q.End = *order.EndedAt
+		}
+	} else if q.Start, q.End, period, err = parseAnalyticsPeriod(r, "24h"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Bucket, err = parseTrendBucket(r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := store.ComputeCycleTimes(nxdDB, q)
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidCycleTimeQuery) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("[CycleTime] Compute: %v", err)
+		http.Error(w, "Erro ao calcular tempo de ciclo", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"cycle_times": report,
+		"period":      period,
+	})
+}
@@ -0,0 +1,320 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"hubsystem/internal/nxd/store"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// ─── Eventos de parada (detectados pelo store.RunDowntimeWorker) ───────────
+
+// ListDowntimeEventsHandler — GET /api/downtime/events?period=24h|current_shift|last_shift | start=&end=
+// &sector_id=&asset_id=&unclassified=1&limit=500
+func ListDowntimeEventsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	q, ok := downtimeQueryFromRequest(w, r, factoryID)
+	if !ok {
+		return
+	}
+	q.Unclassified = r.URL.Query().Get("unclassified") == "1"
+	q.Limit, _ = strconv.Atoi(r.URL.Query().Get("limit"))
+	list, err := store.ListDowntimeEvents(nxdDB, q)
+	if err != nil {
+		log.Printf("[Downtime] List: %v", err)
+		http.Error(w, "Erro ao listar paradas", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []store.DowntimeEventRow{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"events": list})
+}
+
+// ClassifyDowntimeEventHandler — POST /api/downtime/events/{id}/classify
+// Body: { "reason_id": "uuid|null", "comment": "Rolamento travado" }
+func ClassifyDowntimeEventHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	eventID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	var body struct {
+		ReasonID *uuid.UUID `json:"reason_id"`
+		Comment  string     `json:"comment"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	err = store.ClassifyDowntimeEvent(nxdDB, factoryID, eventID, body.ReasonID, strings.TrimSpace(body.Comment), userID)
+	if errors.Is(err, store.ErrDowntimeNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, store.ErrDowntimeReasonInactive) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("[Downtime] Classify: %v", err)
+		http.Error(w, "Erro ao classificar parada", http.StatusInternalServerError)
+		return
+	}
+	reason := ""
+	if body.ReasonID != nil {
+		reason = body.ReasonID.String()
+	}
+	LogAudit(userID, "downtime_classified", "downtime_event", eventID.String(), "", reason, ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// GetDowntimeParetoHandler — GET /api/downtime/pareto?period=7d&level=reason|category&sector_id=&asset_id=
+func GetDowntimeParetoHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	q, ok := downtimeQueryFromRequest(w, r, factoryID)
+	if !ok {
+		return
+	}
+	p, err := store.ComputeDowntimePareto(nxdDB, q, r.URL.Query().Get("level"))
+	if err != nil {
+		log.Printf("[Downtime] Pareto: %v", err)
+		http.Error(w, "Erro ao calcular Pareto de paradas", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"pareto": p})
+}
+
+// downtimeQueryFromRequest lê período, sector_id e asset_id (escreve 400 em caso de erro).
+func downtimeQueryFromRequest(w http.ResponseWriter, r *http.Request, factoryID uuid.UUID) (store.DowntimeEventQuery, bool) {
+	q := store.DowntimeEventQuery{FactoryID: factoryID}
+	var err error
+	if q.SectorID, err = parseOptionalUUID(r, "sector_id"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return q, false
+	}
+	if q.Start, q.End, _, err = resolveProductionPeriod(r, store.NXDDB(), factoryID, q.SectorID, "7d"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return q, false
+	}
+	if q.AssetID, err = parseOptionalUUID(r, "asset_id"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return q, false
+	}
+	return q, true
+}
+
+// ─── Árvore de motivos de parada ───────────────────────────────────────────
+
+// ListDowntimeReasonsHandler — GET /api/downtime/reasons?all=1 (all inclui inativos)
+func ListDowntimeReasonsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	list, err := store.ListDowntimeReasons(nxdDB, factoryID, r.URL.Query().Get("all") == "1")
+	if err != nil {
+		log.Printf("[Downtime] Reasons: %v", err)
+		http.Error(w, "Erro ao listar motivos", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []store.DowntimeReasonRow{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"reasons": list})
+}
+
+// CreateDowntimeReasonHandler — POST /api/downtime/reasons
+// Body: { "code": "MEC-04", "name": "Vazamento", "parent_id": "uuid|null", "is_failure": true }
+func CreateDowntimeReasonHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body struct {
+		Code      string     `json:"code"`
+		Name      string     `json:"name"`
+		ParentID  *uuid.UUID `json:"parent_id"`
+		IsFailure bool       `json:"is_failure"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	body.Code = strings.ToUpper(strings.TrimSpace(body.Code))
+	body.Name = strings.TrimSpace(body.Name)
+	if body.Code == "" || body.Name == "" {
+		http.Error(w, "code e name obrigatórios", http.StatusBadRequest)
+		return
+	}
+	id, err := store.CreateDowntimeReason(nxdDB, factoryID, body.ParentID, body.Code, body.Name, body.IsFailure)
+	if err != nil {
+		if errors.Is(err, store.ErrDowntimeReasonExists) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if errors.Is(err, store.ErrDowntimeNotFound) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Printf("[Downtime] Create reason: %v", err)
+		http.Error(w, "Erro ao salvar motivo", http.StatusInternalServerError)
+		return
+	}
+	LogAudit(userID, "downtime_reason_created", "downtime_reason", id.String(), "", body.Code+" "+body.Name, ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": id})
+}
+
+// UpdateDowntimeReasonHandler — PUT /api/downtime/reasons/{id}
+// Body: { "name": "Novo nome", "active": false, "is_failure": true }
+func UpdateDowntimeReasonHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	var body struct {
+		Name      string `json:"name"`
+		Active    *bool  `json:"active"`
+		IsFailure *bool  `json:"is_failure"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	found, err := store.UpdateDowntimeReason(nxdDB, factoryID, id, strings.TrimSpace(body.Name), body.Active, body.IsFailure)
+	if err != nil {
+		log.Printf("[Downtime] Update reason: %v", err)
+		http.Error(w, "Erro ao salvar motivo", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Motivo não encontrado", http.StatusNotFound)
+		return
+	}
+	newVal, _ := json.Marshal(body)
+	LogAudit(userID, "downtime_reason_updated", "downtime_reason", id.String(), "", string(newVal), ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// InstallDefaultDowntimeReasonsHandler — POST /api/downtime/reasons/defaults
+// Cria a árvore padrão (mecânica, elétrica, setup, falta de material...).
+func InstallDefaultDowntimeReasonsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	n, err := store.InstallDefaultDowntimeReasons(nxdDB, factoryID)
+	if err != nil {
+		log.Printf("[Downtime] Default reasons: %v", err)
+		http.Error(w, "Erro ao criar motivos padrão", http.StatusInternalServerError)
+		return
+	}
+	LogAudit(userID, "downtime_reasons_defaults", "factory", factoryID.String(), "", strconv.Itoa(n), ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"created": n})
+}
@@ -0,0 +1,397 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"hubsystem/internal/nxd/store"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// ─── Energia (medidores, tarifa horária, demanda) ───────────────────────────
+
+// energyError responde os erros de validação do store (400/409); false = erro interno.
+func energyError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, store.ErrInvalidEnergyConfig):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, store.ErrEnergyConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		return false
+	}
+	return true
+}
+
+// GetEnergySummaryHandler — GET /api/energy/summary?period=7d|current_shift|last_shift | start=&end= (RFC3339)&sector_id=uuid
+// Consumo, custo por posto tarifário, demanda de pico e kWh por peça boa.
+func GetEnergySummaryHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	q := store.EnergyQuery{FactoryID: factoryID}
+	if q.SectorID, err = parseOptionalUUID(r, "sector_id"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var period string
+	if q.Start, q.End, period, err = resolveProductionPeriod(r, nxdDB, factoryID, q.SectorID, "7d"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	report, err := store.ComputeEnergyReport(nxdDB, q)
+	if err != nil {
+		log.Printf("[Energy] Summary: %v", err)
+		http.Error(w, "Erro ao calcular energia: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"energy": report,
+		"period": period,
+	})
+}
+
+// ListEnergyMetersHandler — GET /api/energy/meters
+func ListEnergyMetersHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	list, err := store.ListEnergyMeters(nxdDB, factoryID)
+	if err != nil {
+		log.Printf("[Energy] ListMeters: %v", err)
+		http.Error(w, "Erro ao listar medidores", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []store.EnergyMeterRow{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"meters": list})
+}
+
+// CreateEnergyMeterHandler — POST /api/energy/meters
+// Body: { "name": "Quadro geral", "asset_id": "uuid", "metric_key": "kWh_QGBT", "sector_id": "uuid" (nulo = fábrica) }
+func CreateEnergyMeterHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body store.EnergyMeterRow
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	body.FactoryID = factoryID
+	body.Active = true
+	id, err := store.CreateEnergyMeter(nxdDB, body)
+	if err != nil {
+		if energyError(w, err) {
+			return
+		}
+		log.Printf("[Energy] CreateMeter: %v", err)
+		http.Error(w, "Erro ao salvar medidor", http.StatusInternalServerError)
+		return
+	}
+	LogAudit(userID, "energy_meter_created", "energy_meter", id.String(), "", body.Name+" ("+body.MetricKey+")", ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": id})
+}
+
+// UpdateEnergyMeterHandler — PUT /api/energy/meters/{id}
+// Body: { "name": "...", "sector_id": "uuid" | null, "active": true } — a tag do medidor não muda.
+func UpdateEnergyMeterHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	var body struct {
+		Name     string     `json:"name"`
+		SectorID *uuid.UUID `json:"sector_id"`
+		Active   *bool      `json:"active"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	meters, err := store.ListEnergyMeters(nxdDB, factoryID)
+	if err != nil {
+		log.Printf("[Energy] UpdateMeter: %v", err)
+		http.Error(w, "Erro ao carregar medidor", http.StatusInternalServerError)
+		return
+	}
+	var cur *store.EnergyMeterRow
+	for i := range meters {
+		if meters[i].ID == id {
+			cur = &meters[i]
+		}
+	}
+	if cur == nil {
+		http.Error(w, "Medidor não encontrado", http.StatusNotFound)
+		return
+	}
+	cur.Name, cur.SectorID = body.Name, body.SectorID
+	if body.Active != nil {
+		cur.Active = *body.Active
+	}
+	found, err := store.UpdateEnergyMeter(nxdDB, *cur)
+	if err != nil {
+		if energyError(w, err) {
+			return
+		}
+		log.Printf("[Energy] UpdateMeter: %v", err)
+		http.Error(w, "Erro ao salvar medidor", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Medidor não encontrado", http.StatusNotFound)
+		return
+	}
+	LogAudit(userID, "energy_meter_updated", "energy_meter", id.String(), "", cur.Name, ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// DeleteEnergyMeterHandler — DELETE /api/energy/meters/{id}
+func DeleteEnergyMeterHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	found, err := store.DeleteEnergyMeter(nxdDB, factoryID, id)
+	if err != nil {
+		log.Printf("[Energy] DeleteMeter: %v", err)
+		http.Error(w, "Erro ao remover medidor", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Medidor não encontrado", http.StatusNotFound)
+		return
+	}
+	LogAudit(userID, "energy_meter_deleted", "energy_meter", id.String(), "", "", ClientIP(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListEnergyTariffsHandler — GET /api/energy/tariffs
+func ListEnergyTariffsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	list, err := store.ListEnergyTariffs(nxdDB, factoryID)
+	if err != nil {
+		log.Printf("[Energy] ListTariffs: %v", err)
+		http.Error(w, "Erro ao listar tarifas", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []store.EnergyTariffRow{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"tariffs": list})
+}
+
+// CreateEnergyTariffHandler — POST /api/energy/tariffs
+// Body: { "name": "Verde A4 2025", "valid_from": "2025-01-01", "rate_kwh": 0.45, "demand_rate_kw": 28.5,
+// "contracted_demand_kw": 300, "periods": [{ "name": "ponta", "start_time": "18:00", "end_time": "21:00", "weekdays": [1,2,3,4,5], "rate_kwh": 2.10 }] }
+// Fora dos postos (e em feriados da fábrica) vale rate_kwh.
+func CreateEnergyTariffHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body store.EnergyTariffRow
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	body.FactoryID = factoryID
+	id, err := store.CreateEnergyTariff(nxdDB, body)
+	if err != nil {
+		if energyError(w, err) {
+			return
+		}
+		log.Printf("[Energy] CreateTariff: %v", err)
+		http.Error(w, "Erro ao salvar tarifa", http.StatusInternalServerError)
+		return
+	}
+	LogAudit(userID, "energy_tariff_created", "energy_tariff", id.String(), "", body.Name+" a partir de "+body.ValidFrom, ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": id})
+}
+
+// UpdateEnergyTariffHandler — PUT /api/energy/tariffs/{id} (mesmo body do POST; os postos são substituídos)
+func UpdateEnergyTariffHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	var body store.EnergyTariffRow
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	body.ID, body.FactoryID = id, factoryID
+	found, err := store.UpdateEnergyTariff(nxdDB, body)
+	if err != nil {
+		if energyError(w, err) {
+			return
+		}
+		log.Printf("[Energy] UpdateTariff: %v", err)
+		http.Error(w, "Erro ao salvar tarifa", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Tarifa não encontrada", http.StatusNotFound)
+		return
+	}
+	LogAudit(userID, "energy_tariff_updated", "energy_tariff", id.String(), "", body.Name+" a partir de "+body.ValidFrom, ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// DeleteEnergyTariffHandler — DELETE /api/energy/tariffs/{id}
+func DeleteEnergyTariffHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	found, err := store.DeleteEnergyTariff(nxdDB, factoryID, id)
+	if err != nil {
+		log.Printf("[Energy] DeleteTariff: %v", err)
+		http.Error(w, "Erro ao remover tarifa", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Tarifa não encontrada", http.StatusNotFound)
+		return
+	}
+	LogAudit(userID, "energy_tariff_deleted", "energy_tariff", id.String(), "", "", ClientIP(r))
+	w.WriteHeader(http.StatusNoContent)
+}
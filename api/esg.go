@@ -0,0 +1,296 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hubsystem/internal/nxd/store"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// ─── ESG (emissões Escopo 2) ────────────────────────────────────────────────
+
+// esgMaxPeriod limita o resumo a um ano (inventário anual de emissões).
+const esgMaxPeriod = 366 * 24 * time.Hour
+
+// esgError responde os erros de validação do store (400/409); false = erro interno.
+func esgError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, store.ErrInvalidEmissionFactor):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, store.ErrEmissionFactorConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		return false
+	}
+	return true
+}
+
+// GetESGSummaryHandler — GET /api/esg/summary?period=30d | start=&end= (RFC3339)&bucket=day|month&format=json|csv
+// kWh e CO2e (Escopo 2, location-based) por setor, ativo, medidor, produto e bucket,
+// com fatores usados, completude dos dados e notas de metodologia.
+func GetESGSummaryHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	q := store.ESGQuery{FactoryID: factoryID, Bucket: r.URL.Query().Get("bucket")}
+	switch q.Bucket {
+	case "":
+		q.Bucket = "day"
+	case "day", "month":
+	default:
+		http.Error(w, "bucket deve ser day ou month", http.StatusBadRequest)
+		return
+	}
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		http.Error(w, "format deve ser json ou csv", http.StatusBadRequest)
+		return
+	}
+	var period string
+	if q.Start, q.End, period, err = resolveProductionPeriod(r, nxdDB, factoryID, nil, "30d"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.End.Sub(q.Start) > esgMaxPeriod {
+		http.Error(w, "período máximo de 366 dias", http.StatusBadRequest)
+		return
+	}
+	report, err := store.ComputeESGReport(nxdDB, q, time.Now())
+	if err != nil {
+		log.Printf("[ESG] Summary: %v", err)
+		http.Error(w, "Erro ao calcular emissões: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if format == "csv" {
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="nxd-esg-%s-%s.csv"`,
+			q.Start.Format("20060102"), q.End.Format("20060102")))
+		if err := store.WriteESGCSV(w, report); err != nil {
+			log.Printf("[ESG] CSV: %v", err)
+		}
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"esg":    report,
+		"period": period,
+	})
+}
+
+// SetESGRegionHandler — PUT /api/esg/region
+// Body: { "region": "BR-SIN" } — região cujos fatores de emissão valem para a fábrica.
+func SetESGRegionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body struct {
+		Region string `json:"region"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	old, _ := store.GetFactoryEmissionRegion(nxdDB, factoryID)
+	if err := store.SetFactoryEmissionRegion(nxdDB, factoryID, body.Region); err != nil {
+		if esgError(w, err) {
+			return
+		}
+		log.Printf("[ESG] Region: %v", err)
+		http.Error(w, "Erro ao salvar região", http.StatusInternalServerError)
+		return
+	}
+	LogAudit(userID, "esg_region_updated", "factory", factoryID.String(), old, body.Region, ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// ListEmissionFactorsHandler — GET /api/esg/factors?region=
+// Sem region: fatores de todas as regiões; a resposta inclui a região da fábrica.
+func ListEmissionFactorsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	region, err := store.GetFactoryEmissionRegion(nxdDB, factoryID)
+	if err != nil {
+		log.Printf("[ESG] Region: %v", err)
+		http.Error(w, "Erro ao listar fatores de emissão", http.StatusInternalServerError)
+		return
+	}
+	list, err := store.ListEmissionFactors(nxdDB, factoryID, r.URL.Query().Get("region"))
+	if err != nil {
+		log.Printf("[ESG] ListFactors: %v", err)
+		http.Error(w, "Erro ao listar fatores de emissão", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []store.EmissionFactorRow{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"factors": list, "region": region})
+}
+
+// CreateEmissionFactorHandler — POST /api/esg/factors
+// Body: { "region": "BR-SIN", "valid_from": "2025-01-01", "valid_to": "2026-01-01" (opcional, exclusivo),
+// "kg_co2e_per_kwh": 0.0385, "source": "MCTI — fator médio anual do SIN" }
+func CreateEmissionFactorHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body store.EmissionFactorRow
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	body.FactoryID = factoryID
+	id, err := store.CreateEmissionFactor(nxdDB, body)
+	if err != nil {
+		if esgError(w, err) {
+			return
+		}
+		log.Printf("[ESG] CreateFactor: %v", err)
+		http.Error(w, "Erro ao salvar fator de emissão", http.StatusInternalServerError)
+		return
+	}
+	LogAudit(userID, "emission_factor_created", "emission_factor", id.String(), "",
+		fmt.Sprintf("%s a partir de %s: %g kg/kWh", body.Region, body.ValidFrom, body.KgCO2ePerKWh), ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": id})
+}
+
+// UpdateEmissionFactorHandler — PUT /api/esg/factors/{id} (mesmo body do POST)
+func UpdateEmissionFactorHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	var body store.EmissionFactorRow
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	body.ID, body.FactoryID = id, factoryID
+	found, err := store.UpdateEmissionFactor(nxdDB, body)
+	if err != nil {
+		if esgError(w, err) {
+			return
+		}
+		log.Printf("[ESG] UpdateFactor: %v", err)
+		http.Error(w, "Erro ao salvar fator de emissão", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Fator de emissão não encontrado", http.StatusNotFound)
+		return
+	}
+	LogAudit(userID, "emission_factor_updated", "emission_factor", id.String(), "",
+		fmt.Sprintf("%s a partir de %s: %g kg/kWh", body.Region, body.ValidFrom, body.KgCO2ePerKWh), ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// DeleteEmissionFactorHandler — DELETE /api/esg/factors/{id}
+func DeleteEmissionFactorHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	found, err := store.DeleteEmissionFactor(nxdDB, factoryID, id)
+	if err != nil {
+		log.Printf("[ESG] DeleteFactor: %v", err)
+		http.Error(w, "Erro ao remover fator de emissão", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Fator de emissão não encontrado", http.StatusNotFound)
+		return
+	}
+	LogAudit(userID, "emission_factor_deleted", "emission_factor", id.String(), "", "", ClientIP(r))
+	w.WriteHeader(http.StatusNoContent)
+}
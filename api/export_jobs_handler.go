@@ -0,0 +1,283 @@
+package api
+
+// export_jobs_handler.go — Admin endpoints for factory data export bundles
+//
+// Same conventions as import_jobs_handler.go: JWT + admin role, factory inferred
+// from the authenticated user, progress via rows_total/rows_done/progress_pct.
+//
+// Routes (all under /api, JWT-protected):
+//   GET    /api/admin/export-jobs                 — list recent export jobs
+//   POST   /api/admin/export-jobs                 — create a new export job
+//   GET    /api/admin/export-jobs/{id}            — get job status + progress
+//   POST   /api/admin/export-jobs/{id}/cancel     — cancel a pending/running job
+//   GET    /api/admin/export-jobs/{id}/download   — download the .zip bundle
+
+import (
+	"encoding/json"
+	"fmt"
+	"hubsystem/internal/nxd/store"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// ListExportJobsHandler — GET /api/admin/export-jobs
+func ListExportJobsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !userHasRole(userID, "admin") {
+		http.Error(w, "Acesso negado", http.StatusForbidden)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "factory not found", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "NXD store not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	limit := 20
+	if l := r.URL.Query().Get("limit"); l != "" {
+		if n, err := strconv.Atoi(l); err == nil && n > 0 && n <= 200 {
+			limit = n
+		}
+	}
+
+	jobs, err := store.ListExportJobs(nxdDB, factoryID, limit)
+	if err != nil {
+		log.Printf("❌ [ExportJobs] ListExportJobs error: %v", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if jobs == nil {
+		jobs = []store.ExportJobStatus{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"jobs":  jobs,
+		"count": len(jobs),
+	})
+}
+
+// CreateExportJobHandler — POST /api/admin/export-jobs
+//
+// Body (JSON):
+//
+//	{
+//	  "period_start": "2024-01-01T00:00:00Z",     // required
+//	  "period_end":   "2025-01-01T00:00:00Z",     // required
+//	  "include_telemetry": true                   // optional, default true
+//	}
+func CreateExportJobHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !userHasRole(userID, "admin") {
+		http.Error(w, "Acesso negado", http.StatusForbidden)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "factory not found", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "NXD store not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	var body struct {
+		PeriodStart      string `json:"period_start"`
+		PeriodEnd        string `json:"period_end"`
+		IncludeTelemetry *bool  `json:"include_telemetry"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "invalid JSON", http.StatusBadRequest)
+		return
+	}
+	start, err := time.Parse(time.RFC3339, body.PeriodStart)
+	if err != nil {
+		http.Error(w, "invalid period_start (use RFC3339)", http.StatusBadRequest)
+		return
+	}
+	end, err := time.Parse(time.RFC3339, body.PeriodEnd)
+	if err != nil {
+		http.Error(w, "invalid period_end (use RFC3339)", http.StatusBadRequest)
+		return
+	}
+	if !start.Before(end) {
+		http.Error(w, "period_start must be before period_end", http.StatusBadRequest)
+		return
+	}
+
+	params := store.CreateExportJobParams{
+		FactoryID:        factoryID,
+		RequestedBy:      userID,
+		PeriodStart:      start,
+		PeriodEnd:        end,
+		IncludeTelemetry: body.IncludeTelemetry == nil || *body.IncludeTelemetry,
+	}
+	jobID, err := store.CreateExportJob(nxdDB, params)
+	if err != nil {
+		log.Printf("❌ [ExportJobs] CreateExportJob error: %v", err)
+		http.Error(w, "failed to create job", http.StatusInternalServerError)
+		return
+	}
+	LogAudit(userID, "export_requested", "export_job", jobID.String(), "", body.PeriodStart+" → "+body.PeriodEnd, ClientIP(r))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"job_id":  jobID.String(),
+		"status":  "pending",
+		"message": "Job created. Worker will pick it up within 5 seconds.",
+	})
+}
+
+// GetExportJobHandler — GET /api/admin/export-jobs/{id}
+func GetExportJobHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !userHasRole(userID, "admin") {
+		http.Error(w, "Acesso negado", http.StatusForbidden)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "factory not found", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "NXD store not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	jobID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid job id", http.StatusBadRequest)
+		return
+	}
+	job, err := store.GetExportJob(nxdDB, jobID, factoryID)
+	if err != nil {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	if job == nil {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(job)
+}
+
+// CancelExportJobHandler — POST /api/admin/export-jobs/{id}/cancel
+func CancelExportJobHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !userHasRole(userID, "admin") {
+		http.Error(w, "Acesso negado", http.StatusForbidden)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "factory not found", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "NXD store not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	jobID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid job id", http.StatusBadRequest)
+		return
+	}
+	if err := store.CancelExportJob(nxdDB, jobID, factoryID); err != nil {
+		log.Printf("⚠️  [ExportJobs] CancelExportJob %s: %v", jobID, err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"job_id":  jobID.String(),
+		"status":  "cancelled",
+		"message": "Cancellation requested. Worker will stop within one progress cycle.",
+	})
+}
+
+// DownloadExportJobHandler — GET /api/admin/export-jobs/{id}/download
+func DownloadExportJobHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if !userHasRole(userID, "admin") {
+		http.Error(w, "Acesso negado", http.StatusForbidden)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "factory not found", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "NXD store not available", http.StatusServiceUnavailable)
+		return
+	}
+
+	jobID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "invalid job id", http.StatusBadRequest)
+		return
+	}
+	f, job, err := store.OpenExportBundle(r.Context(), nxdDB, store.GetArchiveStorage(), jobID, factoryID)
+	if job == nil && err == nil {
+		http.Error(w, "job not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("⚠️  [ExportJobs] download %s: %v", jobID, err)
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	defer f.Close()
+	LogAudit(userID, "export_downloaded", "export_job", jobID.String(), "", "", ClientIP(r))
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="nxd-export-%s.zip"`, job.PeriodStart.Format("20060102")))
+	if job.SizeBytes != nil {
+		w.Header().Set("Content-Length", strconv.FormatInt(*job.SizeBytes, 10))
+	}
+	if job.SHA256 != nil {
+		w.Header().Set("X-Content-SHA256", *job.SHA256)
+	}
+	io.Copy(w, f)
+}
@@ -0,0 +1,228 @@
+package api
+
+// factory_backup_handler.go — Backup, restore e clone da fábrica (ver store/factory_backup.go)
+//
+// Routes (all require JWT auth via authRouter, admin only):
+//   GET  /api/admin/factory/backup?telemetry=1   — baixa o backup (.nxdbackup.gz) da fábrica
+//   POST /api/admin/factory/restore               — restaura um backup enviado no corpo
+//   POST /api/admin/factory/clone                 — clona a fábrica sob um novo UUID
+//
+// Para mover fábricas entre ambientes sem limite de upload use a CLI:
+//   server factory backup|restore (factory_cmd.go).
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"hubsystem/internal/nxd/store"
+
+	"github.com/google/uuid"
+)
+
+// maxRestoreUpload limita o corpo do restore via HTTP (backups com telemetria
+// grandes devem usar a CLI).
+const maxRestoreUpload = 1 << 30
+
+// legacyLoginAccounts dá ao backup/restore acesso às contas de login
+// (users + factories do schema legado); registrado por InitDB.
+type legacyLoginAccounts struct{}
+
+func (legacyLoginAccounts) GetLogin(ctx context.Context, email string) (*store.BackupLogin, error) {
+	d := GetDB()
+	if d == nil {
+		return nil, ErrDBNotReady
+	}
+	var l store.BackupLogin
+	var factoryName, cnpj, address sql.NullString
+	err := d.QueryRowContext(ctx, `
+		SELECT COALESCE(u.full_name, ''), f.name, f.cnpj, f.address
+		FROM users u LEFT JOIN factories f ON f.user_id = u.id
+		WHERE u.email = $1`, email,
+	).Scan(&l.FullName, &factoryName, &cnpj, &address)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	l.FactoryName, l.CNPJ, l.Address = factoryName.String, cnpj.String, address.String
+	return &l, nil
+}
+
+// EnsureLogin cria o usuário como operador, com a senha bloqueada e sem 2FA (nem
+// hash nem segredo TOTP vão no backup), e a fábrica legada, se o email ainda não
+// existir. Senha e perfil ficam com um admin depois do restore.
+func (legacyLoginAccounts) EnsureLogin(ctx context.Context, email string, l store.BackupLogin) error {
+	d := GetDB()
+	if d == nil {
+		return ErrDBNotReady
+	}
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var userID int64
+	err = tx.QueryRowContext(ctx, `SELECT id FROM users WHERE email = $1`, email).Scan(&userID)
+	if err == nil {
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+	if err := tx.QueryRowContext(ctx, `
+		INSERT INTO users (email, password_hash, full_name, role)
+		VALUES ($1, $2, NULLIF($3, ''), 'operador')
+		RETURNING id`, email, store.LockedPasswordHash, l.FullName,
+	).Scan(&userID); err != nil {
+		return err
+	}
+	if l.FactoryName != "" {
+		if _, err := tx.ExecContext(ctx,
+			`INSERT INTO factories (user_id, name, cnpj, address) VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''))`,
+			userID, l.FactoryName, l.CNPJ, l.Address); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// backupAdminContext valida JWT + admin + Postgres e devolve a fábrica do usuário.
+func backupAdminContext(w http.ResponseWriter, r *http.Request) (int64, uuid.UUID, bool) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return 0, uuid.Nil, false
+	}
+	if !userHasRole(userID, "admin") {
+		http.Error(w, "Acesso negado", http.StatusForbidden)
+		return 0, uuid.Nil, false
+	}
+	if store.NXDDB() == nil {
+		http.Error(w, "Banco NXD não disponível", http.StatusServiceUnavailable)
+		return 0, uuid.Nil, false
+	}
+	if store.Driver() != "postgres" {
+		http.Error(w, "Backup de fábrica disponível apenas com Postgres", http.StatusNotImplemented)
+		return 0, uuid.Nil, false
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return 0, uuid.Nil, false
+	}
+	return userID, factoryID, true
+}
+
+// FactoryBackupHandler — GET /api/admin/factory/backup?telemetry=1
+func FactoryBackupHandler(w http.ResponseWriter, r *http.Request) {
+	userID, factoryID, ok := backupAdminContext(w, r)
+	if !ok {
+		return
+	}
+	withTelemetry := r.URL.Query().Get("telemetry") == "1" || r.URL.Query().Get("telemetry") == "true"
+
+	w.Header().Set("Content-Type", "application/gzip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="nxd-factory-%s-%s.nxdbackup.gz"`,
+		factoryID.String()[:8], time.Now().UTC().Format("20060102")))
+	sum, err := store.WriteFactoryBackup(r.Context(), store.NXDDB(), store.GetArchiveStorage(), factoryID, withTelemetry, w)
+	if err != nil {
+		// Cabeçalhos já enviados: o arquivo fica sem o registro final e o restore o recusa.
+		log.Printf("❌ [FactoryBackup] %s: %v", factoryID, err)
+		return
+	}
+	counts, _ := json.Marshal(sum.Counts)
+	LogAudit(userID, "factory_backup", "factory", factoryID.String(), "", string(counts), ClientIP(r))
+}
+
+// FactoryRestoreHandler — POST /api/admin/factory/restore?mode=clone|restore&name=&owner_email=&skip_telemetry=1
+// Corpo: o arquivo gerado por /factory/backup. mode padrão = clone (IDs novos);
+// mode=restore mantém os IDs originais e falha se a fábrica já existir.
+func FactoryRestoreHandler(w http.ResponseWriter, r *http.Request) {
+	userID, _, ok := backupAdminContext(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	mode := q.Get("mode")
+	if mode == "" {
+		mode = "clone"
+	}
+	if mode != "clone" && mode != "restore" {
+		http.Error(w, "mode inválido (clone|restore)", http.StatusBadRequest)
+		return
+	}
+	opts := store.RestoreOptions{
+		Clone:         mode == "clone",
+		FactoryName:   q.Get("name"),
+		OwnerEmail:    q.Get("owner_email"),
+		SkipTelemetry: q.Get("skip_telemetry") == "1" || q.Get("skip_telemetry") == "true",
+	}
+	res, err := store.RestoreFactoryBackup(r.Context(), store.NXDDB(), http.MaxBytesReader(w, r.Body, maxRestoreUpload), opts)
+	if err != nil {
+		log.Printf("❌ [FactoryBackup] restore: %v", err)
+		status := http.StatusBadRequest
+		if errors.Is(err, store.ErrBackupFactoryExists) || errors.Is(err, store.ErrBackupOwnerHasFactory) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	LogAudit(userID, "factory_restore", "factory", res.FactoryID.String(), res.SourceFactoryID.String(), mode, ClientIP(r))
+	writeRestoreResult(w, res)
+}
+
+// FactoryCloneHandler — POST /api/admin/factory/clone
+//
+// Body (JSON):
+//
+//	{ "name": "Demo (staging)", "owner_email": "demo@cliente.com", "include_telemetry": false }
+//
+// owner_email é necessário na prática: o dono da fábrica de origem já tem fábrica
+// (409). O usuário indicado precisa ter login e nenhuma fábrica.
+func FactoryCloneHandler(w http.ResponseWriter, r *http.Request) {
+	userID, factoryID, ok := backupAdminContext(w, r)
+	if !ok {
+		return
+	}
+	var body struct {
+		Name             string `json:"name"`
+		OwnerEmail       string `json:"owner_email"`
+		IncludeTelemetry bool   `json:"include_telemetry"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "JSON inválido", http.StatusBadRequest)
+			return
+		}
+	}
+	opts := store.RestoreOptions{FactoryName: body.Name, OwnerEmail: body.OwnerEmail}
+	res, err := store.CloneFactory(r.Context(), store.NXDDB(), store.GetArchiveStorage(), factoryID, body.IncludeTelemetry, opts)
+	if err != nil {
+		log.Printf("❌ [FactoryBackup] clone %s: %v", factoryID, err)
+		status := http.StatusBadRequest
+		if errors.Is(err, store.ErrBackupOwnerHasFactory) {
+			status = http.StatusConflict
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+	LogAudit(userID, "factory_clone", "factory", res.FactoryID.String(), factoryID.String(), res.FactoryName, ClientIP(r))
+	writeRestoreResult(w, res)
+}
+
+func writeRestoreResult(w http.ResponseWriter, res *store.RestoreResult) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"success": true,
+		"result":  res,
+		"message": "Fábrica criada. Guarde a API key: ela não será exibida novamente.",
+	})
+}
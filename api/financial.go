@@ -43,7 +43,8 @@ func ListBusinessConfigHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // UpsertBusinessConfigHandler — POST /api/business-config
-// Body: { "sector_id": "uuid|null", "valor_venda_ok": 10.5, "custo_refugo_un": 2, "custo_parada_h": 150 }
+// Body: { "sector_id": "uuid|null", "valor_venda_ok": 10.5, "custo_refugo_un": 2, "custo_parada_h": 150, "custo_kwh": 0.85,
+// "custo_material_un": 3.2, "custo_mao_obra_turno": 900 } — os valores salvos viram a versão de hoje no histórico de custos.
 func UpsertBusinessConfigHandler(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(int64)
 	if !ok {
@@ -61,10 +62,13 @@ func UpsertBusinessConfigHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var body struct {
-		SectorID      *string  `json:"sector_id"`
-		ValorVendaOk  float64  `json:"valor_venda_ok"`
-		CustoRefugoUn float64  `json:"custo_refugo_un"`
-		CustoParadaH  float64  `json:"custo_parada_h"`
+		SectorID          *string  `json:"sector_id"`
+		ValorVendaOk      float64  `json:"valor_venda_ok"`
+		CustoRefugoUn     float64  `json:"custo_refugo_un"`
+		CustoParadaH      float64  `json:"custo_parada_h"`
+		CustoKwh          *float64 `json:"custo_kwh"`
+		CustoMaterialUn   *float64 `json:"custo_material_un"`
+		CustoMaoObraTurno *float64 `json:"custo_mao_obra_turno"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		http.Error(w, "Payload inválido", http.StatusBadRequest)
@@ -79,7 +83,8 @@ func UpsertBusinessConfigHandler(w http.ResponseWriter, r *http.Request) {
 		}
 		sectorID = &u
 	}
-	_, err = store.UpsertBusinessConfig(nxdDB, factoryID, sectorID, body.ValorVendaOk, body.CustoRefugoUn, body.CustoParadaH)
+	_, err = store.UpsertBusinessConfig(nxdDB, factoryID, sectorID, body.ValorVendaOk, body.CustoRefugoUn, body.CustoParadaH, body.CustoKwh,
+		body.CustoMaterialUn, body.CustoMaoObraTurno)
 	if err != nil {
 		log.Printf("[BusinessConfig] Upsert: %v", err)
 		http.Error(w, "Erro ao salvar configuração", http.StatusInternalServerError)
@@ -127,7 +132,8 @@ func ListTagMappingsHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // UpsertTagMappingHandler — POST /api/tag-mappings
-// Body: { "asset_id": "uuid", "tag_ok": "Total_Pecas", "tag_nok": "Refugo", "tag_status": "Running", "reading_rule": "delta" }
+// Body: { "asset_id": "uuid", "tag_ok": "Total_Pecas", "tag_nok": "Refugo", "tag_status": "Running", "reading_rule": "delta", "ideal_cycle_s": 12.5, "tag_energy": "Consumo_Energia_kWh", "tag_order": "Ordem", "tag_alarm": "Falha",
+// "tag_cycle": "Ciclo_Concluido", "cycle_pieces": 4 }
 func UpsertTagMappingHandler(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(int64)
 	if !ok {
@@ -145,11 +151,17 @@ func UpsertTagMappingHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	var body struct {
-		AssetID     string `json:"asset_id"`
-		TagOK       string `json:"tag_ok"`
-		TagNOK      string `json:"tag_nok"`
-		TagStatus   string `json:"tag_status"`
-		ReadingRule string `json:"reading_rule"`
+		AssetID     string   `json:"asset_id"`
+		TagOK       string   `json:"tag_ok"`
+		TagNOK      string   `json:"tag_nok"`
+		TagStatus   string   `json:"tag_status"`
+		ReadingRule string   `json:"reading_rule"`
+		IdealCycleS *float64 `json:"ideal_cycle_s"`
+		TagEnergy   *string  `json:"tag_energy"`
+		TagOrder    *string  `json:"tag_order"`
+		TagAlarm    *string  `json:"tag_alarm"`
+		TagCycle    *string  `json:"tag_cycle"`
+		CyclePieces *int     `json:"cycle_pieces"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
 		http.Error(w, "Payload inválido", http.StatusBadRequest)
@@ -164,7 +176,15 @@ func UpsertTagMappingHandler(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "asset_id inválido", http.StatusBadRequest)
 		return
 	}
-	_, err = store.UpsertTagMapping(nxdDB, assetID, body.TagOK, body.TagNOK, body.TagStatus, body.ReadingRule)
+	if body.IdealCycleS != nil && *body.IdealCycleS <= 0 {
+		http.Error(w, "ideal_cycle_s deve ser positivo", http.StatusBadRequest)
+		return
+	}
+	if body.CyclePieces != nil && *body.CyclePieces < 1 {
+		http.Error(w, "cycle_pieces deve ser >= 1", http.StatusBadRequest)
+		return
+	}
+	_, err = store.UpsertTagMapping(nxdDB, assetID, body.TagOK, body.TagNOK, body.TagStatus, body.ReadingRule, body.IdealCycleS, body.TagEnergy, body.TagOrder, body.TagAlarm, body.TagCycle, body.CyclePieces)
 	if err != nil {
 		log.Printf("[TagMapping] Upsert: %v", err)
 		http.Error(w, "Erro ao salvar mapeamento", http.StatusInternalServerError)
@@ -177,7 +197,7 @@ func UpsertTagMappingHandler(w http.ResponseWriter, r *http.Request) {
 
 // ─── Resumo financeiro (agregado por período) ──────────────────────────────
 
-// GetFinancialSummaryHandler — GET /api/financial-summary?period=24h|7d|1h&sector_id=uuid
+// GetFinancialSummaryHandler — GET /api/financial-summary?period=24h|7d|1h|current_shift|last_shift&sector_id=uuid
 func GetFinancialSummaryHandler(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(int64)
 	if !ok {
@@ -216,6 +236,13 @@ func GetFinancialSummaryHandler(w http.ResponseWriter, r *http.Request) {
 		start = now.Add(-1 * time.Hour)
 	case "7d":
 		start = now.Add(-7 * 24 * time.Hour)
+	case "current_shift", "last_shift":
+		// Janela do turno (current_shift termina agora).
+		start, now, period, err = resolveProductionPeriod(r, nxdDB, factoryID, sectorID, "24h")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
 	default:
 		start = now.Add(-24 * time.Hour)
 	}
@@ -238,7 +265,7 @@ func GetFinancialSummaryHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // GetFinancialSummaryRangesHandler — GET /api/financial-summary/ranges
-// Retorna hoje, 24h e 7d em uma única chamada (para cards na UI).
+// Retorna hoje, 24h, 7d, 30d e (se houver turnos) current_shift/last_shift em uma única chamada (para cards na UI).
 func GetFinancialSummaryRangesHandler(w http.ResponseWriter, r *http.Request) {
 	userID, ok := r.Context().Value("userID").(int64)
 	if !ok {
@@ -261,24 +288,49 @@ func GetFinancialSummaryRangesHandler(w http.ResponseWriter, r *http.Request) {
 		u, _ := uuid.Parse(sectorIDStr)
 		sectorID = &u
 	}
+	// "today" começa à meia-noite no fuso da fábrica.
 	now := time.Now()
+	loc, err := store.GetFactoryTimezone(nxdDB, factoryID)
+	if err != nil {
+		loc = now.Location()
+	}
+	local := now.In(loc)
 	periods := []struct {
 		Key   string
 		Start time.Time
+		End   time.Time
 	}{
-		{"today", time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())},
-		{"24h", now.Add(-24 * time.Hour)},
-		{"7d", now.Add(-7 * 24 * time.Hour)},
-		{"30d", now.Add(-30 * 24 * time.Hour)},
+		{"today", time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc), now},
+		{"24h", now.Add(-24 * time.Hour), now},
+		{"7d", now.Add(-7 * 24 * time.Hour), now},
+		{"30d", now.Add(-30 * 24 * time.Hour), now},
+	}
+	for _, key := range []string{"current_shift", "last_shift"} {
+		if in, err := store.ResolveShiftPeriod(nxdDB, factoryID, sectorID, key, now); err == nil && in != nil {
+			end := in.End
+			if end.After(now) {
+				end = now
+			}
+			periods = append(periods, struct {
+				Key   string
+				Start time.Time
+				End   time.Time
+			}{key, in.Start, end})
+		}
+	}
+	// Todas as faixas num único lote de leituras (store.ComputeFinancialAggregates).
+	fps := make([]store.FinancialPeriod, len(periods))
+	for i, p := range periods {
+		fps[i] = store.FinancialPeriod{Start: p.Start, End: p.End}
 	}
+	results, _, err := store.ComputeFinancialAggregates(nxdDB, factoryID, sectorID, fps)
 	out := make(map[string]interface{})
-	for _, p := range periods {
-		res, _, err := store.ComputeFinancialAggregate(nxdDB, factoryID, sectorID, p.Start, now)
+	for i, p := range periods {
 		if err != nil {
 			out[p.Key] = map[string]string{"error": err.Error()}
 			continue
 		}
-		out[p.Key] = res
+		out[p.Key] = results[i]
 	}
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(out)
@@ -325,16 +377,23 @@ func GetFinancialExecutiveExportHandler(w http.ResponseWriter, r *http.Request)
 		startCurrent = now.Add(-7 * 24 * time.Hour)
 		startPrevious = now.Add(-14 * 24 * time.Hour)
 	}
-	resCurrent, _, err := store.ComputeFinancialAggregate(nxdDB, factoryID, sectorID, startCurrent, now)
-	if err != nil {
-		log.Printf("[FinancialExport] current: %v", err)
-		http.Error(w, "Erro ao calcular resumo", http.StatusInternalServerError)
-		return
-	}
-	resPrevious, _, err := store.ComputeFinancialAggregate(nxdDB, factoryID, sectorID, startPrevious, startCurrent)
+	current := store.FinancialPeriod{Start: startCurrent, End: now}
+	results, _, err := store.ComputeFinancialAggregates(nxdDB, factoryID, sectorID, []store.FinancialPeriod{
+		current,
+		{Start: startPrevious, End: startCurrent},
+	})
 	if err != nil {
-		resPrevious = nil
+		// Como antes do lote: falha no período anterior não derruba o export — só o atual é obrigatório.
+		log.Printf("[FinancialExport] previous: %v", err)
+		results, _, err = store.ComputeFinancialAggregates(nxdDB, factoryID, sectorID, []store.FinancialPeriod{current})
+		if err != nil {
+			log.Printf("[FinancialExport] current: %v", err)
+			http.Error(w, "Erro ao calcular resumo", http.StatusInternalServerError)
+			return
+		}
+		results = append(results, nil)
 	}
+	resCurrent, resPrevious := results[0], results[1]
 	perdasEvitadas := 0.0
 	custoParadaEvitado := 0.0
 	if resPrevious != nil {
@@ -352,6 +411,9 @@ func GetFinancialExecutiveExportHandler(w http.ResponseWriter, r *http.Request)
 		"faturamento_bruto":      resCurrent.FaturamentoBruto,
 		"perda_refugo":          resCurrent.PerdaRefugo,
 		"custo_parada":          resCurrent.CustoParada,
+		"margem_contribuicao":   resCurrent.MargemContribuicao,
+		"resultado_operacional": resCurrent.ResultadoOperacional,
+		"moeda":                 resCurrent.Moeda,
 		"perdas_evitadas":       perdasEvitadas,
 		"custo_parada_evitado":  custoParadaEvitado,
 		"sector_id":             sectorIDStr,
@@ -0,0 +1,311 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hubsystem/internal/nxd/store"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// ─── Simulador what-if financeiro ───────────────────────────────────────────
+
+// scenarioCompareMax limita a comparação de cenários salvos.
+const scenarioCompareMax = 10
+
+// scenarioError responde os erros de validação do store (400/409); false = erro interno.
+func scenarioError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, store.ErrInvalidScenario):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, store.ErrScenarioConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		return false
+	}
+	return true
+}
+
+// scenarioBody — alavancas + escopo; name/description só ao salvar.
+type scenarioBody struct {
+	store.ScenarioParams
+	SectorID    *uuid.UUID `json:"sector_id"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+}
+
+// SimulateFinancialScenarioHandler — POST /api/financial-scenarios/simulate?period=30d | start=&end= (RFC3339)
+// Body: { "sector_id": "uuid" (opcional), "downtime_reduction_pct": 20, "scrap_reduction_pct": 0,
+// "cycle_time_reduction_pct": 0, "price_change_pct": 0, "asset_ids": ["uuid"] (opcional) }
+// Calcula o cenário sobre a base do período sem salvar: impacto mensal/anual, por alavanca e por ativo.
+func SimulateFinancialScenarioHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body scenarioBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	result, period, ok := computeScenario(w, r, factoryID, body)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"scenario": result, "period": period})
+}
+
+// computeScenario valida o setor, resolve o período da query e simula; false = resposta já enviada.
+func computeScenario(w http.ResponseWriter, r *http.Request, factoryID uuid.UUID, body scenarioBody) (*store.ScenarioResult, string, bool) {
+	nxdDB := store.NXDDB()
+	if body.SectorID != nil {
+		if s, err := store.GetSectorByID(nxdDB, *body.SectorID, factoryID); err != nil || s == nil {
+			http.Error(w, "Setor não encontrado", http.StatusNotFound)
+			return nil, "", false
+		}
+	}
+	start, end, period, err := resolveProductionPeriod(r, nxdDB, factoryID, body.SectorID, "30d")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, "", false
+	}
+	result, err := store.ComputeFinancialScenario(nxdDB, factoryID, body.SectorID, start, end, body.ScenarioParams)
+	if err != nil {
+		if scenarioError(w, err) {
+			return nil, "", false
+		}
+		log.Printf("[FinancialScenario] Simulate: %v", err)
+		http.Error(w, "Erro ao simular cenário: "+err.Error(), http.StatusInternalServerError)
+		return nil, "", false
+	}
+	return result, period, true
+}
+
+// ListFinancialScenariosHandler — GET /api/financial-scenarios
+// Cenários salvos (sem o detalhamento por ativo; use GET /api/financial-scenarios/{id}).
+func ListFinancialScenariosHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	list, err := store.ListFinancialScenarios(nxdDB, factoryID)
+	if err != nil {
+		log.Printf("[FinancialScenario] List: %v", err)
+		http.Error(w, "Erro ao listar cenários", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []store.FinancialScenarioRow{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"scenarios": list})
+}
+
+// CreateFinancialScenarioHandler — POST /api/financial-scenarios?period=30d | start=&end=
+// Body: o mesmo de /simulate mais { "name": "Linha 3 −20% paradas", "description": "..." }.
+// Simula e salva parâmetros e resultado.
+func CreateFinancialScenarioHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body scenarioBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(body.Name) == "" {
+		http.Error(w, "name obrigatório", http.StatusBadRequest)
+		return
+	}
+	result, _, ok := computeScenario(w, r, factoryID, body)
+	if !ok {
+		return
+	}
+	uid := userID
+	id, err := store.CreateFinancialScenario(nxdDB, store.FinancialScenarioRow{
+		FactoryID:     factoryID,
+		SectorID:      body.SectorID,
+		Name:          body.Name,
+		Description:   body.Description,
+		BaselineStart: result.BaselineStart,
+		BaselineEnd:   result.BaselineEnd,
+		Params:        body.ScenarioParams,
+		Result:        result,
+		CreatedBy:     &uid,
+	})
+	if err != nil {
+		if scenarioError(w, err) {
+			return
+		}
+		log.Printf("[FinancialScenario] Create: %v", err)
+		http.Error(w, "Erro ao salvar cenário", http.StatusInternalServerError)
+		return
+	}
+	LogAudit(userID, "financial_scenario_created", "financial_scenario", id.String(), "",
+		fmt.Sprintf("%s: %+.2f %s/mês", strings.TrimSpace(body.Name), result.DeltaMensal, result.Moeda), ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": id, "scenario": result})
+}
+
+// GetFinancialScenarioHandler — GET /api/financial-scenarios/{id}
+func GetFinancialScenarioHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	s, err := store.GetFinancialScenario(nxdDB, factoryID, id)
+	if err != nil {
+		log.Printf("[FinancialScenario] Get: %v", err)
+		http.Error(w, "Erro ao carregar cenário", http.StatusInternalServerError)
+		return
+	}
+	if s == nil {
+		http.Error(w, "Cenário não encontrado", http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+// CompareFinancialScenariosHandler — GET /api/financial-scenarios/compare?ids=uuid,uuid
+// Cenários salvos lado a lado, do maior para o menor impacto anual.
+func CompareFinancialScenariosHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	raw := strings.Split(r.URL.Query().Get("ids"), ",")
+	if len(raw) < 2 || len(raw) > scenarioCompareMax {
+		http.Error(w, fmt.Sprintf("informe de 2 a %d ids separados por vírgula", scenarioCompareMax), http.StatusBadRequest)
+		return
+	}
+	var list []store.FinancialScenarioRow
+	for _, v := range raw {
+		id, err := uuid.Parse(strings.TrimSpace(v))
+		if err != nil {
+			http.Error(w, "id inválido: "+v, http.StatusBadRequest)
+			return
+		}
+		s, err := store.GetFinancialScenario(nxdDB, factoryID, id)
+		if err != nil {
+			log.Printf("[FinancialScenario] Compare: %v", err)
+			http.Error(w, "Erro ao carregar cenário", http.StatusInternalServerError)
+			return
+		}
+		if s == nil {
+			http.Error(w, "Cenário não encontrado: "+id.String(), http.StatusNotFound)
+			return
+		}
+		list = append(list, *s)
+	}
+	rows, warnings := store.CompareFinancialScenarios(list)
+	if warnings == nil {
+		warnings = []string{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"comparison": rows, "warnings": warnings})
+}
+
+// DeleteFinancialScenarioHandler — DELETE /api/financial-scenarios/{id}
+func DeleteFinancialScenarioHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	found, err := store.DeleteFinancialScenario(nxdDB, factoryID, id)
+	if err != nil {
+		log.Printf("[FinancialScenario] Delete: %v", err)
+		http.Error(w, "Erro ao remover cenário", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Cenário não encontrado", http.StatusNotFound)
+		return
+	}
+	LogAudit(userID, "financial_scenario_deleted", "financial_scenario", id.String(), "", "", ClientIP(r))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,267 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hubsystem/internal/nxd/store"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// ─── Previsão de séries (Holt-Winters) ──────────────────────────────────────
+
+// forecastError responde os erros de validação/dados do store (400/422); false = erro interno.
+func forecastError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, store.ErrInvalidForecast):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, store.ErrForecastInsufficientData):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default:
+		return false
+	}
+	return true
+}
+
+// CreateForecastHandler — POST /api/forecasts
+// Body: { "asset_id": "uuid", "metric": "Producao", "granularity": "hour" | "day", "horizon": 48 (opcional) }
+// Treina o modelo com o histórico até o bucket atual e grava a previsão (201). Contadores
+// com granularidade day trazem a projeção do fim do mês em "period".
+func CreateForecastHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body struct {
+		AssetID     uuid.UUID `json:"asset_id"`
+		Metric      string    `json:"metric"`
+		Granularity string    `json:"granularity"`
+		Horizon     int       `json:"horizon"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	if body.Granularity == "" {
+		body.Granularity = "day"
+	}
+	f, err := store.RunForecast(nxdDB, store.ForecastRequest{FactoryID: factoryID, AssetID: body.AssetID,
+		MetricKey: body.Metric, Granularity: body.Granularity, Horizon: body.Horizon}, time.Now())
+	if err != nil {
+		if forecastError(w, err) {
+			return
+		}
+		log.Printf("[Forecast] Run: %v", err)
+		http.Error(w, "Erro ao calcular previsão", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"forecast": f})
+}
+
+// GetForecastHandler — GET /api/forecasts?asset_id=uuid&metric=Producao&granularity=hour|day
+// Última previsão gravada da série, com os valores reais já apurados em cada ponto.
+func GetForecastHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	assetID, err := parseOptionalUUID(r, "asset_id")
+	if err != nil || assetID == nil {
+		http.Error(w, "asset_id inválido", http.StatusBadRequest)
+		return
+	}
+	granularity := r.URL.Query().Get("granularity")
+	if granularity == "" {
+		granularity = "day"
+	}
+	f, err := store.GetLatestForecast(nxdDB, factoryID, *assetID, r.URL.Query().Get("metric"), granularity)
+	if err != nil {
+		log.Printf("[Forecast] Get: %v", err)
+		http.Error(w, "Erro ao buscar previsão", http.StatusInternalServerError)
+		return
+	}
+	if f == nil {
+		http.Error(w, store.ErrForecastNotFound.Error(), http.StatusNotFound)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"forecast": f})
+}
+
+// GetForecastAccuracyHandler — GET /api/forecasts/accuracy?granularity=hour|day&asset_id=&metric=
+// &period=7d|30d | start=&end= (RFC3339)
+// MAE, RMSE, MAPE, viés e cobertura dos intervalos dos pontos apurados no período,
+// no total, por faixa de antecedência e por série.
+func GetForecastAccuracyHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	q := store.ForecastAccuracyQuery{FactoryID: factoryID, MetricKey: r.URL.Query().Get("metric"),
+		Granularity: r.URL.Query().Get("granularity")}
+	if q.Granularity == "" {
+		q.Granularity = "day"
+	}
+	if q.AssetID, err = parseOptionalUUID(r, "asset_id"); err != nil {
+		http.Error(w, "asset_id inválido", http.StatusBadRequest)
+		return
+	}
+	var period string
+	if q.Start, q.End, period, err = parseAnalyticsPeriod(r, "30d"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	acc, err := store.ComputeForecastAccuracy(nxdDB, q)
+	if err != nil {
+		if forecastError(w, err) {
+			return
+		}
+		log.Printf("[Forecast] Accuracy: %v", err)
+		http.Error(w, "Erro ao calcular acurácia", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"accuracy": acc, "period": period})
+}
+
+// ListForecastSeriesHandler — GET /api/forecasts/series
+func ListForecastSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	list, err := store.ListForecastSeries(nxdDB, factoryID)
+	if err != nil {
+		log.Printf("[Forecast] List series: %v", err)
+		http.Error(w, "Erro ao listar séries", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"series": list})
+}
+
+// UpsertForecastSeriesHandler — PUT /api/forecasts/series
+// Body: { "asset_id": "uuid", "metric_key": "kWh", "granularity": "hour" | "day", "horizon": 0 (padrão), "active": true }
+// O worker refaz a previsão das séries ativas a cada bucket e apura os reais.
+func UpsertForecastSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	body := store.ForecastSeriesRow{Active: true}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	id, err := store.UpsertForecastSeries(nxdDB, factoryID, body)
+	if err != nil {
+		if forecastError(w, err) {
+			return
+		}
+		log.Printf("[Forecast] Upsert series: %v", err)
+		http.Error(w, "Erro ao salvar série", http.StatusInternalServerError)
+		return
+	}
+	LogAudit(userID, "forecast_series_saved", "forecast_series", id.String(), "",
+		fmt.Sprintf("%s/%s %s h=%d ativa=%v", body.AssetID, body.MetricKey, body.Granularity, body.Horizon, body.Active), ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"status": "ok", "id": id})
+}
+
+// DeleteForecastSeriesHandler — DELETE /api/forecasts/series/{id}
+func DeleteForecastSeriesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	found, err := store.DeleteForecastSeries(nxdDB, factoryID, id)
+	if err != nil {
+		log.Printf("[Forecast] Delete series: %v", err)
+		http.Error(w, "Erro ao remover série", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Série não encontrada", http.StatusNotFound)
+		return
+	}
+	LogAudit(userID, "forecast_series_deleted", "forecast_series", id.String(), "", "", ClientIP(r))
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -227,6 +227,8 @@ func IngestHandler(w http.ResponseWriter, r *http.Request) {
 		correlationID := uuid.New().String()
 		if err := store.InsertTelemetryBatch(db, factoryID, assetID, correlationID, telemetryRows); err != nil {
 			log.Printf("❌ [INGEST] Erro ao inserir telemetria para %s: %v", deviceID, err)
+		} else if _, err := store.ApplyVirtualMetrics(db, factoryID, assetID, correlationID, telemetryRows); err != nil {
+			log.Printf("⚠️ [INGEST] Erro ao calcular métricas virtuais para %s: %v", deviceID, err)
 		}
 	}
 
@@ -300,7 +302,7 @@ func getNXDFactoryIDForUser(userID int64) (uuid.UUID, error) {
 	}
 	// Busca a factory pelo nxd user_id
 	var factoryID uuid.UUID
-	err = nxdDB.QueryRow("SELECT id FROM nxd.factories WHERE user_id = $1 LIMIT 1", nxdUserID).Scan(&factoryID)
+	err = nxdDB.QueryRow("SELECT id FROM nxd.factories WHERE user_id = $1 ORDER BY created_at, id LIMIT 1", nxdUserID).Scan(&factoryID)
 	if err != nil {
 		// Sem factory NXD — retorna nil
 		return uuid.Nil, nil
@@ -511,7 +513,9 @@ func RegenerateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(map[string]string{"api_key": apiKey})
 }
 
-// getFactoryIDForUser retorna o factoryID NXD para um userID legado
+// getFactoryIDForUser retorna o factoryID NXD para um userID legado: a fábrica
+// mais antiga do usuário NXD de mesmo email (o restore não dá uma segunda fábrica
+// ao mesmo dono). Sem fábrica própria, erro — nunca a fábrica de outro usuário.
 func getFactoryIDForUser(userID int64) (uuid.UUID, error) {
 	nxdDB := store.NXDDB()
 	if nxdDB == nil {
@@ -526,14 +530,11 @@ func getFactoryIDForUser(userID int64) (uuid.UUID, error) {
 		SELECT f.id FROM nxd.factories f
 		JOIN nxd.users u ON u.id = f.user_id
 		WHERE u.email = $1
+		ORDER BY f.created_at, f.id
 		LIMIT 1
 	`, email).Scan(&factoryID)
 	if err != nil {
-		// fallback: última factory criada
-		err2 := nxdDB.QueryRow(`SELECT id FROM nxd.factories ORDER BY created_at DESC LIMIT 1`).Scan(&factoryID)
-		if err2 != nil {
-			return uuid.Nil, fmt.Errorf("factory não encontrada")
-		}
+		return uuid.Nil, fmt.Errorf("factory não encontrada")
 	}
 	return factoryID, nil
 }
@@ -943,26 +944,20 @@ func GetDashboardDataHandler(w http.ResponseWriter, r *http.Request) {
 		SELECT f.id, f.name FROM nxd.factories f
 		JOIN nxd.users u ON u.id = f.user_id
 		WHERE u.email = $1
+		ORDER BY f.created_at, f.id
 		LIMIT 1
 	`, email).Scan(&factoryID, &factoryName)
 	if err != nil {
-		// Tenta buscar factory sem user (onboarding direto via api_key_hash)
-		err2 := nxdDB.QueryRow(`
-			SELECT id, name FROM nxd.factories
-			ORDER BY created_at DESC LIMIT 1
-		`).Scan(&factoryID, &factoryName)
-		if err2 != nil {
-			// Sem factory ainda — retorna estrutura vazia
-			w.Header().Set("Content-Type", "application/json")
-			json.NewEncoder(w).Encode(map[string]interface{}{
-				"factory_name":   "",
-				"assets":         []interface{}{},
-				"total_assets":   0,
-				"last_update":    nil,
-				"online_assets":  0,
-			})
-			return
-		}
+		// Sem factory ainda — retorna estrutura vazia
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"factory_name":   "",
+			"assets":         []interface{}{},
+			"total_assets":   0,
+			"last_update":    nil,
+			"online_assets":  0,
+		})
+		return
 	}
 
 	// ── Cache check ────────────────────────────────────────────────────────
@@ -1149,7 +1144,7 @@ O relatório deve conter:
 Use formatação Markdown. Seja objetivo e técnico. Responda em português brasileiro.`
 
 	ctx := r.Context()
-	analysis, err := callGemini(ctx, reportPrompt, telemetryCtx)
+	analysis, err := callGemini(ctx, reportPrompt, telemetryCtx, nil)
 	if err != nil {
 		log.Printf("[ReportIA] Erro Gemini: %v", err)
 		http.Error(w, "Erro ao gerar relatório de IA: "+err.Error(), http.StatusInternalServerError)
@@ -53,8 +53,14 @@ func IAChatHandler(w http.ResponseWriter, r *http.Request) {
 		telemetryContext = "Sem dados de telemetria disponíveis no momento."
 	}
 
+	// Ferramentas (correlações etc.) no escopo da fábrica do usuário
+	var tools *iaToolset
+	if fid, err := getFactoryIDForUser(userID); err == nil && fid != uuid.Nil && store.NXDDB() != nil {
+		tools = &iaToolset{db: store.NXDDB(), factoryID: fid}
+	}
+
 	// Chama Gemini
-	reply, err := callGemini(ctx, req.Message, telemetryContext)
+	reply, err := callGemini(ctx, req.Message, telemetryContext, tools)
 	if err != nil {
 		log.Printf("[IA] Erro Gemini: %v", err)
 		http.Error(w, "Erro ao consultar IA: "+err.Error(), http.StatusInternalServerError)
@@ -62,6 +68,9 @@ func IAChatHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	sources := buildSourcesSummary(req.SectorID, "Telemetria e indicadores financeiros (24h, 7d)")
+	if tools != nil && len(tools.cited) > 0 {
+		sources += " " + strings.Join(tools.cited, "; ") + "."
+	}
 	var reportID int64
 	if db := GetDB(); db != nil {
 		title := req.Message
@@ -235,26 +244,228 @@ func buildTelemetryContext(userID int64, sectorID string) (string, error) {
 		}
 	}
 	now := time.Now()
+	finLabels := []string{"24h", "7d"}
+	finResults, _, _ := store.ComputeFinancialAggregates(nxdDB, factoryID, sectorUUID, []store.FinancialPeriod{
+		{Start: now.Add(-24 * time.Hour), End: now},
+		{Start: now.Add(-7 * 24 * time.Hour), End: now},
+	})
+	for i, res := range finResults {
+		if res == nil {
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("=== INDICADORES FINANCEIROS (%s) ===\n", finLabels[i]))
+		sb.WriteString(fmt.Sprintf("Peças OK: %.0f | Refugo: %.0f | Horas parada: %.2f\n",
+			res.OKCount, res.NOKCount, res.HoursParada))
+		sb.WriteString(fmt.Sprintf("Faturamento bruto: R$ %.2f | Perda refugo: R$ %.2f | Custo parada: R$ %.2f\n",
+			res.FaturamentoBruto, res.PerdaRefugo, res.CustoParada))
+		if res.EnergiaKWh > 0 {
+			sb.WriteString(fmt.Sprintf("Energia: %.1f kWh | Custo energia: R$ %.2f\n", res.EnergiaKWh, res.CustoEnergia))
+		}
+		if res.CustoMaterial > 0 || res.CustoMaoObra > 0 {
+			sb.WriteString(fmt.Sprintf("Material: %s %.2f | Mão de obra: %s %.2f\n", res.Moeda, res.CustoMaterial, res.Moeda, res.CustoMaoObra))
+		}
+		mcPct := "n/d"
+		if res.MargemContribuicaoPct != nil {
+			mcPct = fmt.Sprintf("%.1f%%", *res.MargemContribuicaoPct)
+		}
+		sb.WriteString(fmt.Sprintf("Margem de contribuição: %s %.2f (%s) | Resultado operacional: %s %.2f\n",
+			res.Moeda, res.MargemContribuicao, mcPct, res.Moeda, res.ResultadoOperacional))
+		sb.WriteString("\n")
+	}
+
+	// OEE calculado (oee.go) — a IA deve usar estes valores em vez de estimar
+	pct := func(v *float64) string {
+		if v == nil {
+			return "n/d"
+		}
+		return fmt.Sprintf("%.1f%%", *v*100)
+	}
 	for _, period := range []struct{ label string; start time.Time }{
 		{"24h", now.Add(-24 * time.Hour)},
 		{"7d", now.Add(-7 * 24 * time.Hour)},
 	} {
-		res, _, err := store.ComputeFinancialAggregate(nxdDB, factoryID, sectorUUID, period.start, now)
-		if err != nil || res == nil {
+		rep, err := store.ComputeOEE(nxdDB, store.OEEQuery{FactoryID: factoryID, SectorID: sectorUUID, Start: period.start, End: now})
+		if err != nil || rep == nil || len(rep.Assets) == 0 {
 			continue
 		}
-		sb.WriteString(fmt.Sprintf("=== INDICADORES FINANCEIROS (%s) ===\n", period.label))
-		sb.WriteString(fmt.Sprintf("Peças OK: %.0f | Refugo: %.0f | Horas parada: %.2f\n",
-			res.OKCount, res.NOKCount, res.HoursParada))
-		sb.WriteString(fmt.Sprintf("Faturamento bruto: R$ %.2f | Perda refugo: R$ %.2f | Custo parada: R$ %.2f\n\n",
-			res.FaturamentoBruto, res.PerdaRefugo, res.CustoParada))
+		sb.WriteString(fmt.Sprintf("=== OEE (%s) ===\n", period.label))
+		sb.WriteString(fmt.Sprintf("Total: OEE %s | Disponibilidade %s | Desempenho %s | Qualidade %s\n",
+			pct(rep.Total.OEE), pct(rep.Total.Availability), pct(rep.Total.Performance), pct(rep.Total.Quality)))
+		for _, s := range rep.Sectors {
+			sb.WriteString(fmt.Sprintf("Setor %s: OEE %s | D %s | P %s | Q %s\n",
+				s.Name, pct(s.OEE), pct(s.Availability), pct(s.Performance), pct(s.Quality)))
+		}
+		for _, a := range rep.Assets {
+			line := fmt.Sprintf("Ativo %s: OEE %s | D %s | P %s | Q %s", a.Name, pct(a.OEE), pct(a.Availability), pct(a.Performance), pct(a.Quality))
+			if len(a.Missing) > 0 {
+				line += " | faltando: " + strings.Join(a.Missing, ", ")
+			}
+			sb.WriteString(line + "\n")
+		}
+		sb.WriteString("\n")
+	}
+
+	// Paradas (24h): Pareto por motivo e últimos eventos — para "por que a linha parou?"
+	dq := store.DowntimeEventQuery{FactoryID: factoryID, SectorID: sectorUUID, Start: now.Add(-24 * time.Hour), End: now, Limit: 10}
+	if p, err := store.ComputeDowntimePareto(nxdDB, dq, "reason"); err == nil && p.TotalEvents > 0 {
+		sb.WriteString(fmt.Sprintf("=== PARADAS (24h): %d eventos, %.1f min ===\n", p.TotalEvents, p.TotalDurationS/60))
+		for i, it := range p.Items {
+			if i == 5 {
+				break
+			}
+			sb.WriteString(fmt.Sprintf("%s: %d paradas, %.1f min (%.0f%%)\n", it.Name, it.Events, it.DurationS/60, it.Percent))
+		}
+		if events, err := store.ListDowntimeEvents(nxdDB, dq); err == nil {
+			sb.WriteString("Últimas paradas:\n")
+			for _, e := range events {
+				reason := e.ReasonName
+				if reason == "" {
+					reason = "não classificada"
+				}
+				status := fmt.Sprintf("%.1f min", e.DurationS/60)
+				if e.EndedAt == nil {
+					status = "em andamento há " + status
+				}
+				sb.WriteString(fmt.Sprintf("- %s às %s: %s, motivo: %s", e.AssetName, e.StartedAt.Local().Format("02/01 15:04"), status, reason))
+				if e.Comment != "" {
+					sb.WriteString(" (" + e.Comment + ")")
+				}
+				sb.WriteString("\n")
+			}
+		}
+		sb.WriteString("\n")
+	}
+
+	// Confiabilidade (30d) — MTBF/MTTR calculados; a IA não deve estimar
+	hours := func(v *float64) string {
+		if v == nil {
+			return "n/d"
+		}
+		return fmt.Sprintf("%.1f h", *v/3600)
+	}
+	if rel, err := store.ComputeReliability(nxdDB, store.ReliabilityQuery{FactoryID: factoryID, SectorID: sectorUUID, Start: now.Add(-30 * 24 * time.Hour), End: now}); err == nil && rel.Total.Failures > 0 {
+		sb.WriteString("=== CONFIABILIDADE (30d, falhas classificadas + alarmes) ===\n")
+		sb.WriteString(fmt.Sprintf("Total: %d falhas | MTBF %s | MTTR %s | Disponibilidade %s\n",
+			rel.Total.Failures, hours(rel.Total.MTBFS), hours(rel.Total.MTTRS), pct(rel.Total.Availability)))
+		for _, a := range rel.Assets {
+			if a.Failures == 0 {
+				continue
+			}
+			sb.WriteString(fmt.Sprintf("Ativo %s: %d falhas | MTBF %s | MTTR %s\n", a.Name, a.Failures, hours(a.MTBFS), hours(a.MTTRS)))
+		}
+		if rel.Total.Unclassified > 0 {
+			sb.WriteString(fmt.Sprintf("Paradas sem motivo (podem ser falhas): %d\n", rel.Total.Unclassified))
+		}
+		sb.WriteString("\n")
+	}
+
+	// Energia (7d) — consumo por posto tarifário, demanda de pico e kWh por peça boa
+	if en, err := store.ComputeEnergyReport(nxdDB, store.EnergyQuery{FactoryID: factoryID, SectorID: sectorUUID, Start: now.Add(-7 * 24 * time.Hour), End: now}); err == nil && en.KWh > 0 {
+		tariff := en.Tariff
+		if tariff == "" {
+			tariff = "custo fixo por kWh"
+		}
+		sb.WriteString(fmt.Sprintf("=== ENERGIA (7d, %s) ===\n", tariff))
+		perPiece := "n/d"
+		if en.KWhPerPiece != nil {
+			perPiece = fmt.Sprintf("%.3f kWh", *en.KWhPerPiece)
+		}
+		sb.WriteString(fmt.Sprintf("Consumo %.0f kWh | Custo R$ %.2f (demanda R$ %.2f) | Por peça boa: %s\n", en.KWh, en.Cost, en.DemandCost, perPiece))
+		for _, b := range en.Bands {
+			sb.WriteString(fmt.Sprintf("Posto %s: %.0f kWh, R$ %.2f\n", b.Name, b.KWh, b.Cost))
+		}
+		if en.CO2eKg > 0 {
+			line := fmt.Sprintf("Emissões Escopo 2: %.1f kg CO2e", en.CO2eKg)
+			if en.CO2eKgPerPiece != nil {
+				line += fmt.Sprintf(" (%.4f kg por peça boa)", *en.CO2eKgPerPiece)
+			}
+			if en.KWhWithoutFactor > 0 {
+				line += fmt.Sprintf(" — %.0f kWh sem fator de emissão", en.KWhWithoutFactor)
+			}
+			sb.WriteString(line + "\n")
+		}
+		if en.DemandPeakAt != nil {
+			line := fmt.Sprintf("Demanda de pico: %.1f kW em %s", en.DemandPeakKW, en.DemandPeakAt.Local().Format("02/01 15:04"))
+			if en.DemandOverrun {
+				line += fmt.Sprintf(" (ACIMA da contratada de %.0f kW)", *en.ContractedDemandKW)
+			}
+			sb.WriteString(line + "\n")
+		}
+		sb.WriteString("\n")
+	}
+
+	// Ordens de produção em execução — "qual produto está rodando e como está a margem?"
+	if orders, err := store.ListProductionOrders(nxdDB, store.ProductionOrderQuery{FactoryID: factoryID, SectorID: sectorUUID, Status: "running", Limit: 5}); err == nil && len(orders) > 0 {
+		sb.WriteString("=== ORDENS DE PRODUÇÃO EM EXECUÇÃO ===\n")
+		for _, o := range orders {
+			res, err := store.ComputeProductionOrder(nxdDB, o, now)
+			if err != nil || res.Financial == nil {
+				continue
+			}
+			where := o.AssetName
+			if where == "" {
+				where = "setor/fábrica"
+			}
+			line := fmt.Sprintf("- Ordem %s (%s) em %s desde %s: OK %.0f | NOK %.0f | rendimento %.1f%% | margem R$ %.2f",
+				o.OrderCode, o.Product, where, o.StartedAt.Local().Format("02/01 15:04"),
+				res.Financial.OKCount, res.Financial.NOKCount, res.Yield*100, res.Margem)
+			if res.Progress != nil {
+				line += fmt.Sprintf(" | %.0f%% da meta", *res.Progress*100)
+			}
+			sb.WriteString(line + "\n")
+		}
+		sb.WriteString("\n")
+	}
+
+	// Anotações (48h) — intervenções conhecidas: a IA deve considerá-las antes de apontar causas
+	if notes, err := store.ListAnnotations(nxdDB, store.AnnotationQuery{FactoryID: factoryID, SectorID: sectorUUID, Start: now.Add(-48 * time.Hour), End: now.Add(time.Minute)}); err == nil && len(notes) > 0 {
+		sb.WriteString("=== ANOTAÇÕES DA OPERAÇÃO (48h) ===\n")
+		if len(notes) > 20 {
+			notes = notes[len(notes)-20:]
+		}
+		for _, n := range notes {
+			where := "fábrica"
+			switch n.Scope {
+			case "asset":
+				where = n.AssetName
+			case "sector":
+				where = "setor " + n.SectorName
+			}
+			when := n.StartsAt.Local().Format("02/01 15:04")
+			if n.EndsAt != nil {
+				when += " a " + n.EndsAt.Local().Format("02/01 15:04")
+			}
+			line := fmt.Sprintf("- %s [%s] %s: %s", when, n.Category, where, n.Text)
+			if n.AuthorName != "" {
+				line += " (" + n.AuthorName + ")"
+			}
+			sb.WriteString(line + "\n")
+		}
+		sb.WriteString("\n")
+	}
+
+	// Metas de produção em andamento — "vamos bater a meta do turno?"
+	if pace, err := store.ComputeTargetPace(nxdDB, factoryID, now); err == nil && len(pace) > 0 {
+		sb.WriteString("=== METAS DE PRODUÇÃO (EM ANDAMENTO) ===\n")
+		for _, p := range pace {
+			if sectorUUID != nil && (p.SectorID == nil || *p.SectorID != *sectorUUID) {
+				continue
+			}
+			where := p.ScopeName
+			if p.ShiftName != "" {
+				where += " — turno " + p.ShiftName
+			}
+			sb.WriteString(fmt.Sprintf("- %s (%s, %.0f%% do tempo): %s [%s]\n", where, p.Metric, p.ElapsedPct, p.Message, p.Status))
+		}
+		sb.WriteString("\n")
 	}
 
 	return sb.String(), nil
 }
 
-// callGemini envia o prompt para o Gemini via Vertex AI e retorna a resposta
-func callGemini(ctx context.Context, userMessage, telemetryContext string) (string, error) {
+// callGemini envia o prompt para o Gemini via Vertex AI e retorna a resposta.
+// Com tools, o modelo pode chamar as ferramentas (até iaMaxToolRounds rodadas).
+func callGemini(ctx context.Context, userMessage, telemetryContext string, tools *iaToolset) (string, error) {
 	projectID := os.Getenv("GOOGLE_CLOUD_PROJECT")
 	if projectID == "" {
 		projectID = "slideflow-prod"
@@ -281,22 +492,40 @@ Diretrizes:
 - Use os dados de telemetria fornecidos como fonte primária
 - Se não houver dados suficientes para responder, diga isso claramente
 - Formate números com 2 casas decimais quando relevante
-- Máximo de 3 parágrafos na resposta, seja conciso`
+- Máximo de 3 parágrafos na resposta, seja conciso
+- Para perguntas de causa raiz ("o que mudou junto com o refugo?"), use a ferramenta correlacionar_tags e cite r, defasagem e número de pares das correlações retornadas; correlação não prova causa — diga isso
+- Nunca invente correlações: se a ferramenta não retornar candidatos significativos, diga que não há evidência nos dados
+- Antes de explicar uma mudança nos dados, confira as ANOTAÇÕES DA OPERAÇÃO: se houve intervenção registrada no mesmo período (troca de molde, novo lote, manutenção), cite-a como explicação provável`
 
 	fullPrompt := fmt.Sprintf("%s\n\n%s\n\n=== PERGUNTA DO USUÁRIO ===\n%s",
 		systemPrompt, telemetryContext, userMessage)
 
-	result, err := client.Models.GenerateContent(ctx,
-		"gemini-2.0-flash-001",
-		genai.Text(fullPrompt),
-		nil,
-	)
-	if err != nil {
-		return "", fmt.Errorf("erro na geração: %w", err)
+	contents := genai.Text(fullPrompt)
+	var config *genai.GenerateContentConfig
+	if tools != nil {
+		config = &genai.GenerateContentConfig{Tools: tools.declarations()}
 	}
-
-	if result == nil || len(result.Candidates) == 0 {
-		return "", fmt.Errorf("resposta vazia do modelo")
+	var result *genai.GenerateContentResponse
+	for round := 0; ; round++ {
+		if round == iaMaxToolRounds {
+			config = nil // última rodada: só texto
+		}
+		result, err = client.Models.GenerateContent(ctx, "gemini-2.0-flash-001", contents, config)
+		if err != nil {
+			return "", fmt.Errorf("erro na geração: %w", err)
+		}
+		if result == nil || len(result.Candidates) == 0 || result.Candidates[0].Content == nil {
+			return "", fmt.Errorf("resposta vazia do modelo")
+		}
+		calls := result.FunctionCalls()
+		if len(calls) == 0 || config == nil {
+			break
+		}
+		contents = append(contents, result.Candidates[0].Content)
+		for _, fc := range calls {
+			log.Printf("[IA] Ferramenta %s %v", fc.Name, fc.Args)
+			contents = append(contents, genai.NewContentFromFunctionResponse(fc.Name, tools.call(fc), genai.RoleUser))
+		}
 	}
 
 	return strings.TrimSpace(result.Text()), nil
@@ -0,0 +1,130 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"hubsystem/internal/nxd/store"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"google.golang.org/genai"
+)
+
+// ─── Ferramentas do chat IA ─────────────────────────────────────────────────
+//
+// O modelo pode chamar funções que calculam sobre os dados reais da fábrica em vez
+// de estimar a partir do contexto. Cada chamada executada fica registrada em
+// iaToolset.cited e entra nas fontes do relatório salvo.
+
+// iaMaxToolRounds limita as rodadas chamada → resposta de ferramenta por pergunta.
+const iaMaxToolRounds = 3
+
+// iaToolset executa as ferramentas no escopo da fábrica do usuário.
+type iaToolset struct {
+	db        *sql.DB
+	factoryID uuid.UUID
+	cited     []string
+}
+
+// declarations retorna as funções expostas ao modelo.
+func (t *iaToolset) declarations() []*genai.Tool {
+	return []*genai.Tool{{FunctionDeclarations: []*genai.FunctionDeclaration{{
+		Name: "correlacionar_tags",
+		Description: "Calcula correlações defasadas (Pearson) entre uma tag alvo de um ativo e as demais tags do ativo " +
+			"ou do setor, a partir da telemetria real. Use para perguntas de causa raiz (ex.: o que se moveu junto com o refugo). " +
+			"Retorna candidatos ordenados por |r| com defasagem (lag_s > 0 = o candidato se move antes do alvo), pares e p-valor.",
+		Parameters: &genai.Schema{
+			Type: genai.TypeObject,
+			Properties: map[string]*genai.Schema{
+				"ativo":   {Type: genai.TypeString, Description: "Nome de exibição ou UUID do ativo"},
+				"tag":     {Type: genai.TypeString, Description: "Tag alvo (metric_key), ex.: Refugo"},
+				"periodo": {Type: genai.TypeString, Enum: []string{"24h", "7d", "30d"}, Description: "Janela (padrão 24h)"},
+				"escopo":  {Type: genai.TypeString, Enum: []string{"asset", "sector"}, Description: "asset = tags do ativo; sector = tags dos ativos do setor"},
+				"diferencas": {Type: genai.TypeBoolean,
+					Description: "Correlacionar as variações entre buckets (remove tendência)"},
+			},
+			Required: []string{"ativo", "tag"},
+		},
+	}}}}
+}
+
+// call executa uma chamada de função do modelo. Erros voltam ao modelo como {"erro": ...}.
+func (t *iaToolset) call(fc *genai.FunctionCall) map[string]any {
+	switch fc.Name {
+	case "correlacionar_tags":
+		out, err := t.correlate(fc.Args)
+		if err != nil {
+			return map[string]any{"erro": err.Error()}
+		}
+		return out
+	}
+	return map[string]any{"erro": "ferramenta desconhecida: " + fc.Name}
+}
+
+func (t *iaToolset) correlate(args map[string]any) (map[string]any, error) {
+	str := func(k string) string { s, _ := args[k].(string); return strings.TrimSpace(s) }
+	asset, err := t.resolveAsset(str("ativo"))
+	if err != nil {
+		return nil, err
+	}
+	window := map[string]time.Duration{"24h": 24 * time.Hour, "7d": 7 * 24 * time.Hour, "30d": 30 * 24 * time.Hour}
+	period := str("periodo")
+	if _, ok := window[period]; !ok {
+		period = "24h"
+	}
+	diff, _ := args["diferencas"].(bool)
+	end := time.Now()
+	rep, err := store.ComputeCorrelations(t.db, store.CorrelationQuery{
+		FactoryID: t.factoryID, AssetID: asset.ID, MetricKey: str("tag"), Scope: str("escopo"),
+		Start: end.Add(-window[period]), End: end, MaxLag: -1, Limit: 10, Diff: diff,
+	})
+	if err != nil {
+		if errors.Is(err, store.ErrInvalidCorrelation) {
+			return nil, err
+		}
+		return nil, fmt.Errorf("falha ao calcular correlações")
+	}
+	candidates := make([]map[string]any, 0, len(rep.Candidates))
+	for _, c := range rep.Candidates {
+		candidates = append(candidates, map[string]any{
+			"ativo": c.AssetName, "tag": c.MetricKey, "r": math.Round(c.R*100) / 100, "lag_s": c.LagS,
+			"pares": c.N, "p_valor": c.PValue, "significativo": c.Significant,
+		})
+	}
+	t.cited = append(t.cited, fmt.Sprintf("Correlações de %s/%s (%s, passo %ds, %d tags testadas)",
+		rep.AssetName, rep.MetricKey, period, rep.StepS, rep.Tested))
+	return map[string]any{
+		"ativo": rep.AssetName, "tag": rep.MetricKey, "periodo": period, "escopo": rep.Scope,
+		"passo_s": rep.StepS, "defasagem_max": rep.MaxLag, "diferencas": rep.Diff,
+		"tags_testadas": rep.Tested, "candidatos": candidates,
+	}, nil
+}
+
+// resolveAsset aceita UUID ou nome de exibição (sem diferenciar maiúsculas) de um ativo da fábrica.
+func (t *iaToolset) resolveAsset(ref string) (*store.AssetRow, error) {
+	if ref == "" {
+		return nil, fmt.Errorf("ativo é obrigatório")
+	}
+	if id, err := uuid.Parse(ref); err == nil {
+		if a, err := store.GetAssetByID(t.db, id, t.factoryID); err == nil && a != nil {
+			return a, nil
+		}
+		return nil, fmt.Errorf("ativo não encontrado")
+	}
+	list, err := store.ListAssets(t.db, t.factoryID, false, ref)
+	if err != nil {
+		return nil, fmt.Errorf("falha ao buscar ativo")
+	}
+	for i := range list {
+		if strings.EqualFold(list[i].DisplayName, ref) || strings.EqualFold(list[i].SourceTagID, ref) {
+			return &list[i], nil
+		}
+	}
+	if len(list) == 1 {
+		return &list[0], nil
+	}
+	return nil, fmt.Errorf("ativo %q não encontrado ou ambíguo", ref)
+}
@@ -0,0 +1,470 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"hubsystem/internal/nxd/store"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// ─── Inspeções de qualidade / não conformidades (store/inspections.go) ─────
+
+// inspectionError mapeia erros de validação para 400 e código duplicado para 409.
+func inspectionError(w http.ResponseWriter, err error) bool {
+	if errors.Is(err, store.ErrInvalidInspection) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return true
+	}
+	if errors.Is(err, store.ErrDefectTypeExists) {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return true
+	}
+	return false
+}
+
+// ListDefectTypesHandler — GET /api/defect-types?all=1 (all inclui inativos)
+func ListDefectTypesHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	list, err := store.ListDefectTypes(nxdDB, factoryID, r.URL.Query().Get("all") == "1")
+	if err != nil {
+		log.Printf("[Quality] Defect types: %v", err)
+		http.Error(w, "Erro ao listar tipos de defeito", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"defect_types": list})
+}
+
+// CreateDefectTypeHandler — POST /api/defect-types
+// Body: { "code": "REB", "name": "Rebarba" }
+func CreateDefectTypeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body struct {
+		Code string `json:"code"`
+		Name string `json:"name"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	body.Code = strings.ToUpper(strings.TrimSpace(body.Code))
+	id, err := store.CreateDefectType(nxdDB, factoryID, body.Code, body.Name)
+	if err != nil {
+		if inspectionError(w, err) {
+			return
+		}
+		log.Printf("[Quality] Create defect type: %v", err)
+		http.Error(w, "Erro ao salvar tipo de defeito", http.StatusInternalServerError)
+		return
+	}
+	LogAudit(userID, "defect_type_created", "defect_type", id.String(), "", body.Code+" "+strings.TrimSpace(body.Name), ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": id})
+}
+
+// UpdateDefectTypeHandler — PUT /api/defect-types/{id}
+// Body: { "name": "Rebarba na borda", "active": false }
+func UpdateDefectTypeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	var body struct {
+		Name   string `json:"name"`
+		Active *bool  `json:"active"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	found, err := store.UpdateDefectType(nxdDB, factoryID, id, body.Name, body.Active)
+	if err != nil {
+		log.Printf("[Quality] Update defect type: %v", err)
+		http.Error(w, "Erro ao salvar tipo de defeito", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Tipo de defeito não encontrado", http.StatusNotFound)
+		return
+	}
+	newVal, _ := json.Marshal(body)
+	LogAudit(userID, "defect_type_updated", "defect_type", id.String(), "", string(newVal), ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// inspectionQueryFromRequest lê período (data da inspeção), sector_id, asset_id, order_id
+// e defect_type_id (escreve 400 em caso de erro).
+func inspectionQueryFromRequest(w http.ResponseWriter, r *http.Request, factoryID uuid.UUID) (store.InspectionQuery, bool) {
+	q := store.InspectionQuery{FactoryID: factoryID}
+	var err error
+	if q.SectorID, err = parseOptionalUUID(r, "sector_id"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return q, false
+	}
+	if q.Start, q.End, _, err = resolveProductionPeriod(r, store.NXDDB(), factoryID, q.SectorID, "30d"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return q, false
+	}
+	for name, dst := range map[string]**uuid.UUID{"asset_id": &q.AssetID, "order_id": &q.OrderID, "defect_type_id": &q.DefectTypeID} {
+		if *dst, err = parseOptionalUUID(r, name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return q, false
+		}
+	}
+	return q, true
+}
+
+// ListInspectionsHandler — GET /api/inspections?period=30d | start=&end=&sector_id=&asset_id=
+// &order_id=&defect_type_id=&limit=500
+// NCs pela data da inspeção (mais recentes primeiro), com anexos.
+func ListInspectionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	q, ok := inspectionQueryFromRequest(w, r, factoryID)
+	if !ok {
+		return
+	}
+	q.Limit, _ = strconv.Atoi(r.URL.Query().Get("limit"))
+	list, err := store.ListInspections(nxdDB, q)
+	if err != nil {
+		log.Printf("[Quality] List: %v", err)
+		http.Error(w, "Erro ao listar inspeções", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"inspections": list})
+}
+
+// GetDefectParetoHandler — GET /api/inspections/pareto?period=30d&sector_id=&asset_id=&order_id=
+func GetDefectParetoHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	q, ok := inspectionQueryFromRequest(w, r, factoryID)
+	if !ok {
+		return
+	}
+	p, err := store.ComputeDefectPareto(nxdDB, q)
+	if err != nil {
+		log.Printf("[Quality] Pareto: %v", err)
+		http.Error(w, "Erro ao calcular Pareto de defeitos", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"pareto": p})
+}
+
+// inspectionBody — payload de criação/edição de uma NC.
+type inspectionBody struct {
+	AssetID       uuid.UUID  `json:"asset_id"`
+	OrderID       *uuid.UUID `json:"order_id"`
+	DefectTypeID  uuid.UUID  `json:"defect_type_id"`
+	Quantity      float64    `json:"quantity"`
+	InspectedAt   *time.Time `json:"inspected_at"`
+	ProducedStart *time.Time `json:"produced_start"`
+	ProducedEnd   *time.Time `json:"produced_end"`
+	Inspector     string     `json:"inspector"`
+	Notes         string     `json:"notes"`
+}
+
+func (b inspectionBody) row(id uuid.UUID) store.InspectionRow {
+	in := store.InspectionRow{ID: id, AssetID: b.AssetID, OrderID: b.OrderID, DefectTypeID: b.DefectTypeID,
+		Quantity: b.Quantity, ProducedStart: b.ProducedStart, ProducedEnd: b.ProducedEnd,
+		Inspector: b.Inspector, Notes: b.Notes}
+	if b.InspectedAt != nil {
+		in.InspectedAt = *b.InspectedAt
+	} else {
+		in.InspectedAt = time.Now()
+	}
+	return in
+}
+
+// CreateInspectionHandler — POST /api/inspections
+// Body: { "asset_id": "uuid", "order_id": "uuid|null", "defect_type_id": "uuid", "quantity": 12,
+// "inspected_at": "RFC3339 (padrão agora)", "produced_start": "...", "produced_end": "...",
+// "inspector": "Ana", "notes": "lote 42" }
+func CreateInspectionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body inspectionBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	id, err := store.CreateInspection(nxdDB, factoryID, body.row(uuid.Nil), userID, time.Now())
+	if err != nil {
+		if inspectionError(w, err) {
+			return
+		}
+		log.Printf("[Quality] Create: %v", err)
+		http.Error(w, "Erro ao salvar inspeção", http.StatusInternalServerError)
+		return
+	}
+	newVal, _ := json.Marshal(body)
+	LogAudit(userID, "inspection_created", "inspection", id.String(), "", string(newVal), ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": id})
+}
+
+// UpdateInspectionHandler — PUT /api/inspections/{id} (mesmo body do POST; substitui a NC)
+func UpdateInspectionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	var body inspectionBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	if body.InspectedAt == nil {
+		http.Error(w, "inspected_at obrigatório", http.StatusBadRequest)
+		return
+	}
+	found, err := store.UpdateInspection(nxdDB, factoryID, body.row(id), time.Now())
+	if err != nil {
+		if inspectionError(w, err) {
+			return
+		}
+		log.Printf("[Quality] Update: %v", err)
+		http.Error(w, "Erro ao salvar inspeção", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Inspeção não encontrada", http.StatusNotFound)
+		return
+	}
+	newVal, _ := json.Marshal(body)
+	LogAudit(userID, "inspection_updated", "inspection", id.String(), "", string(newVal), ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// DeleteInspectionHandler — DELETE /api/inspections/{id}
+func DeleteInspectionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	found, err := store.DeleteInspection(nxdDB, factoryID, id)
+	if err != nil {
+		log.Printf("[Quality] Delete: %v", err)
+		http.Error(w, "Erro ao remover inspeção", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Inspeção não encontrada", http.StatusNotFound)
+		return
+	}
+	LogAudit(userID, "inspection_deleted", "inspection", id.String(), "", "", ClientIP(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AddInspectionAttachmentHandler — POST /api/inspections/{id}/attachments
+// Body: { "file_name": "foto.jpg", "content_type": "image/jpeg", "size_bytes": 20480, "storage_url": "https://..." }
+// Só metadados: o arquivo é enviado antes para o storage.
+func AddInspectionAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	inspectionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	var body store.InspectionAttachmentRow
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	id, err := store.AddInspectionAttachment(nxdDB, factoryID, inspectionID, body, userID)
+	if err != nil {
+		if inspectionError(w, err) {
+			return
+		}
+		log.Printf("[Quality] Attachment: %v", err)
+		http.Error(w, "Erro ao salvar anexo", http.StatusInternalServerError)
+		return
+	}
+	LogAudit(userID, "inspection_attachment_added", "inspection", inspectionID.String(), "", body.FileName, ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": id})
+}
+
+// DeleteInspectionAttachmentHandler — DELETE /api/inspections/{id}/attachments/{attachment_id}
+func DeleteInspectionAttachmentHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	inspectionID, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["attachment_id"])
+	if err != nil {
+		http.Error(w, "attachment_id inválido", http.StatusBadRequest)
+		return
+	}
+	found, err := store.DeleteInspectionAttachment(nxdDB, factoryID, inspectionID, id)
+	if err != nil {
+		log.Printf("[Quality] Delete attachment: %v", err)
+		http.Error(w, "Erro ao remover anexo", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Anexo não encontrado", http.StatusNotFound)
+		return
+	}
+	LogAudit(userID, "inspection_attachment_deleted", "inspection", inspectionID.String(), "", id.String(), ClientIP(r))
+	w.WriteHeader(http.StatusNoContent)
+}
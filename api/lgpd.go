@@ -0,0 +1,778 @@
+package api
+
+// lgpd.go — Exclusão de tenant (LGPD): pedido, carência, cancelamento, execução
+// nos dois schemas e certificado de exclusão assinado.
+//
+// Fluxo:
+//   1. O titular (com senha) ou um admin pede a exclusão → tenant_deletion_requests
+//      status 'scheduled', scheduled_for = agora + LGPD_DELETION_GRACE_DAYS (padrão 30).
+//      O pedido devolve um receipt_token (exibido uma vez) para baixar o certificado.
+//   2. Durante a carência o pedido pode ser cancelado (titular ou admin).
+//   3. RunTenantDeletionWorker executa os pedidos vencidos:
+//        nxd.*    → store.EraseTenantData (fábricas, telemetria, arquivos, usuário NXD)
+//        public.* → ia_reports, support_tickets, telemetria/ativos/setores/fábrica, usuário
+//      O audit_log legado é mantido (prestação de contas), mas anonimizado: user_id → 0,
+//      ip → '-', e email/nome/CPF do titular substituídos em old_value/new_value.
+//      Falhas ficam 'failed' e são repetidas (até tenantDeletionMaxAttempts);
+//      todos os passos são idempotentes.
+//   4. O certificado (JSON) é assinado com Ed25519 (LGPD_SIGNING_KEY, obrigatória) e
+//      guardado no pedido. O titular identifica-se nele só pelo SHA-256 do email.
+//      Sem a chave, ou com o NXD fora do Postgres, novos pedidos são recusados (503).
+//
+// Routes:
+//   GET  /api/account/deletion                        — pedido atual do usuário (JWT)
+//   POST /api/account/deletion                        — pede a exclusão (JWT + senha)
+//   POST /api/account/deletion/cancel                 — cancela durante a carência (JWT)
+//   GET  /api/admin/tenant-deletions                  — lista pedidos (admin)
+//   POST /api/admin/tenant-deletions                  — pede a exclusão de um usuário (admin)
+//   POST /api/admin/tenant-deletions/{id}/cancel      — cancela (admin)
+//   GET  /api/lgpd/deletions/{id}/certificate?token=  — certificado assinado (público, com token)
+//   GET  /api/lgpd/public-key                         — chave pública Ed25519 (público)
+//   POST /api/lgpd/certificates/verify                — verifica certificado + assinatura (público)
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"hubsystem/internal/nxd/store"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	tenantDeletionPollInterval = 10 * time.Minute
+	tenantDeletionMaxAttempts  = 5
+)
+
+var errDeletionNotCancellable = errors.New("pedido não está mais em carência")
+
+// errDeletionUnavailable — o servidor não consegue executar nem certificar a exclusão
+// (sem LGPD_SIGNING_KEY ou com o NXD fora do Postgres).
+var errDeletionUnavailable = errors.New("exclusão de tenant indisponível neste servidor")
+
+// TenantDeletionRequest é uma linha de tenant_deletion_requests.
+type TenantDeletionRequest struct {
+	ID           int64      `json:"id"`
+	UserID       int64      `json:"user_id"`
+	SubjectHash  string     `json:"subject_sha256"`
+	RequestedBy  int64      `json:"requested_by"`
+	Reason       string     `json:"reason,omitempty"`
+	Status       string     `json:"status"`
+	RequestedAt  time.Time  `json:"requested_at"`
+	ScheduledFor time.Time  `json:"scheduled_for"`
+	CancelledAt  *time.Time `json:"cancelled_at,omitempty"`
+	CompletedAt  *time.Time `json:"completed_at,omitempty"`
+	Attempts     int        `json:"attempts"`
+	ErrorMessage string     `json:"error_message,omitempty"`
+}
+
+// DeletionCertificate é o documento assinado entregue ao titular.
+type DeletionCertificate struct {
+	CertificateID  string              `json:"certificate_id"`
+	RequestID      int64               `json:"request_id"`
+	SubjectSHA256  string              `json:"subject_sha256"`
+	RequestedAt    time.Time           `json:"requested_at"`
+	ScheduledFor   time.Time           `json:"scheduled_for"`
+	CompletedAt    time.Time           `json:"completed_at"`
+	NXDFactories   []string            `json:"nxd_factories"`
+	Items          []store.ErasureItem `json:"items"`
+	StorageObjects int                 `json:"storage_objects_deleted"`
+	Statement      string              `json:"statement"`
+	Issuer         string              `json:"issuer"`
+	Algorithm      string              `json:"algorithm"`
+	KeyID          string              `json:"key_id"`
+}
+
+const tenantDeletionColumns = `id, user_id, subject_hash, requested_by, COALESCE(reason, ''), status,
+	requested_at, scheduled_for, cancelled_at, completed_at, attempts, COALESCE(error_message, '')`
+
+func scanTenantDeletion(scan func(dest ...interface{}) error) (*TenantDeletionRequest, error) {
+	var d TenantDeletionRequest
+	var cancelled, completed sql.NullTime
+	if err := scan(&d.ID, &d.UserID, &d.SubjectHash, &d.RequestedBy, &d.Reason, &d.Status,
+		&d.RequestedAt, &d.ScheduledFor, &cancelled, &completed, &d.Attempts, &d.ErrorMessage); err != nil {
+		return nil, err
+	}
+	if cancelled.Valid {
+		d.CancelledAt = &cancelled.Time
+	}
+	if completed.Valid {
+		d.CompletedAt = &completed.Time
+	}
+	return &d, nil
+}
+
+// tenantDeletionGrace lê LGPD_DELETION_GRACE_DAYS (padrão 30; 0 = próximo ciclo do worker).
+func tenantDeletionGrace() time.Duration {
+	days := 30
+	if v := os.Getenv("LGPD_DELETION_GRACE_DAYS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n >= 0 {
+			days = n
+		}
+	}
+	return time.Duration(days) * 24 * time.Hour
+}
+
+func subjectHash(email string) string {
+	sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return hex.EncodeToString(sum[:])
+}
+
+// ─── Chave de assinatura ─────────────────────────────────────────────────────
+
+var (
+	lgpdKeyOnce sync.Once
+	lgpdKey     ed25519.PrivateKey
+	lgpdKeyErr  error
+)
+
+// lgpdSigningKey lê LGPD_SIGNING_KEY (seed Ed25519 de 32 bytes em base64), obrigatória:
+// sem ela nenhum certificado é emitido — uma chave derivada de outro segredo mudaria
+// junto com ele e invalidaria os certificados já entregues.
+func lgpdSigningKey() (ed25519.PrivateKey, error) {
+	lgpdKeyOnce.Do(func() {
+		v := os.Getenv("LGPD_SIGNING_KEY")
+		if v == "" {
+			lgpdKeyErr = fmt.Errorf("%w: LGPD_SIGNING_KEY não configurada", errDeletionUnavailable)
+			return
+		}
+		seed, err := base64.StdEncoding.DecodeString(v)
+		if err != nil || len(seed) != ed25519.SeedSize {
+			lgpdKeyErr = fmt.Errorf("%w: LGPD_SIGNING_KEY inválida (esperado base64 de %d bytes)", errDeletionUnavailable, ed25519.SeedSize)
+			return
+		}
+		lgpdKey = ed25519.NewKeyFromSeed(seed)
+	})
+	return lgpdKey, lgpdKeyErr
+}
+
+// checkTenantDeletionAvailable recusa o pedido de saída quando ele não poderia ser
+// concluído: sem chave de assinatura ou com o NXD fora do Postgres (EraseTenantData).
+func checkTenantDeletionAvailable() error {
+	if _, err := lgpdSigningKey(); err != nil {
+		return err
+	}
+	if store.NXDDB() != nil && store.Driver() != "postgres" {
+		return fmt.Errorf("%w: exclusão de tenant no NXD exige Postgres", errDeletionUnavailable)
+	}
+	return nil
+}
+
+func lgpdKeyID(pub ed25519.PublicKey) string {
+	sum := sha256.Sum256(pub)
+	return hex.EncodeToString(sum[:8])
+}
+
+// ─── Pedido e cancelamento ───────────────────────────────────────────────────
+
+// createTenantDeletion agenda a exclusão e devolve o pedido e o receipt token.
+func createTenantDeletion(targetUserID, requestedBy int64, reason string) (*TenantDeletionRequest, string, error) {
+	d := GetDB()
+	if d == nil {
+		return nil, "", ErrDBNotReady
+	}
+	if err := checkTenantDeletionAvailable(); err != nil {
+		return nil, "", err
+	}
+	var email string
+	if err := d.QueryRow("SELECT email FROM users WHERE id = $1", targetUserID).Scan(&email); err != nil {
+		return nil, "", fmt.Errorf("usuário não encontrado")
+	}
+	var active int
+	if err := d.QueryRow(
+		`SELECT COUNT(*) FROM tenant_deletion_requests WHERE user_id = $1 AND status IN ('scheduled', 'processing', 'failed')`,
+		targetUserID,
+	).Scan(&active); err != nil {
+		return nil, "", err
+	}
+	if active > 0 {
+		return nil, "", fmt.Errorf("já existe um pedido de exclusão ativo para este usuário")
+	}
+
+	tokenBytes := make([]byte, 32)
+	if _, err := rand.Read(tokenBytes); err != nil {
+		return nil, "", err
+	}
+	token := hex.EncodeToString(tokenBytes)
+	tokenHash := sha256.Sum256([]byte(token))
+
+	now := time.Now().UTC()
+	var id int64
+	err := d.QueryRow(`
+		INSERT INTO tenant_deletion_requests
+			(user_id, subject_hash, requested_by, reason, status, receipt_token_hash, requested_at, scheduled_for)
+		VALUES ($1, $2, $3, NULLIF($4, ''), 'scheduled', $5, $6, $7)
+		RETURNING id`,
+		targetUserID, subjectHash(email), requestedBy, truncateForAudit(reason, 500),
+		hex.EncodeToString(tokenHash[:]), now, now.Add(tenantDeletionGrace()),
+	).Scan(&id)
+	if err != nil {
+		return nil, "", err
+	}
+	req, err := getTenantDeletion(id)
+	return req, token, err
+}
+
+func getTenantDeletion(id int64) (*TenantDeletionRequest, error) {
+	req, err := scanTenantDeletion(GetDB().QueryRow(
+		`SELECT `+tenantDeletionColumns+` FROM tenant_deletion_requests WHERE id = $1`, id).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return req, err
+}
+
+// latestTenantDeletion retorna o pedido mais recente do usuário (nil se nenhum).
+func latestTenantDeletion(userID int64) (*TenantDeletionRequest, error) {
+	req, err := scanTenantDeletion(GetDB().QueryRow(
+		`SELECT `+tenantDeletionColumns+` FROM tenant_deletion_requests WHERE user_id = $1 ORDER BY id DESC LIMIT 1`, userID).Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return req, err
+}
+
+// cancelTenantDeletion cancela um pedido ainda em carência (ou com falha).
+func cancelTenantDeletion(id int64) error {
+	res, err := GetDB().Exec(`
+		UPDATE tenant_deletion_requests SET status = 'cancelled', cancelled_at = $1
+		WHERE id = $2 AND status IN ('scheduled', 'failed')`, time.Now().UTC(), id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return errDeletionNotCancellable
+	}
+	return nil
+}
+
+// ─── Worker ──────────────────────────────────────────────────────────────────
+
+// RunTenantDeletionWorker executa os pedidos vencidos. Bloqueia até ctx ser cancelado.
+func RunTenantDeletionWorker(ctx context.Context) {
+	log.Println("🗑️  [TenantDeletion] Worker iniciado")
+	if _, err := lgpdSigningKey(); err != nil {
+		log.Printf("⚠️  [TenantDeletion] %v — pedidos vencidos aguardam a chave", err)
+	}
+	if d := GetDB(); d != nil {
+		// Pedido interrompido por restart: volta como falha para ser repetido.
+		d.Exec(`UPDATE tenant_deletion_requests SET status = 'failed', error_message = 'interrompido por restart'
+			WHERE status = 'processing'`)
+	}
+	ticker := time.NewTicker(tenantDeletionPollInterval)
+	defer ticker.Stop()
+	for {
+		for {
+			processed, err := processNextTenantDeletion(ctx)
+			if err != nil {
+				log.Printf("❌ [TenantDeletion] %v", err)
+			}
+			if !processed {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			log.Println("🛑 [TenantDeletion] Worker encerrado")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// processNextTenantDeletion reivindica e executa um pedido vencido.
+// processed=false quando não há pedido a executar.
+func processNextTenantDeletion(ctx context.Context) (processed bool, err error) {
+	d := GetDB()
+	if d == nil {
+		return false, nil
+	}
+	// Sem chave não há certificado: os pedidos esperam em vez de apagar sem comprovante.
+	key, err := lgpdSigningKey()
+	if err != nil {
+		return false, nil
+	}
+	lock := ""
+	if legacyDriver == "postgres" {
+		lock = " FOR UPDATE SKIP LOCKED"
+	}
+	now := time.Now().UTC()
+	req, err := scanTenantDeletion(d.QueryRow(`
+		UPDATE tenant_deletion_requests SET status = 'processing', attempts = attempts + 1
+		WHERE id = (
+			SELECT id FROM tenant_deletion_requests
+			WHERE status IN ('scheduled', 'failed') AND scheduled_for <= $1 AND attempts < $2
+			ORDER BY scheduled_for LIMIT 1`+lock+`
+		)
+		RETURNING `+tenantDeletionColumns, now, tenantDeletionMaxAttempts).Scan)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	log.Printf("🗑️  [TenantDeletion] Executando pedido %d (tentativa %d)", req.ID, req.Attempts)
+	cert, err := executeTenantDeletion(ctx, req, key)
+	if err != nil {
+		d.Exec(`UPDATE tenant_deletion_requests SET status = 'failed', error_message = $1 WHERE id = $2`,
+			truncateForAudit(err.Error(), 1000), req.ID)
+		return true, fmt.Errorf("pedido %d: %w", req.ID, err)
+	}
+
+	certJSON, err := json.Marshal(cert)
+	if err != nil {
+		return true, err
+	}
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(key, certJSON))
+	if _, err := d.Exec(`
+		UPDATE tenant_deletion_requests
+		SET status = 'completed', completed_at = $1, error_message = NULL, certificate_json = $2, certificate_signature = $3
+		WHERE id = $4`, cert.CompletedAt, string(certJSON), sig, req.ID); err != nil {
+		return true, err
+	}
+	// Registro mantido no audit_log: só o id do pedido e o hash do titular.
+	LogAudit(0, "tenant_erased", "tenant_deletion", strconv.FormatInt(req.ID, 10), "", req.SubjectHash, "-")
+	log.Printf("✅ [TenantDeletion] Pedido %d concluído — certificado %s", req.ID, cert.CertificateID)
+	return true, nil
+}
+
+// executeTenantDeletion apaga o tenant no NXD e no schema legado e monta o certificado.
+func executeTenantDeletion(ctx context.Context, req *TenantDeletionRequest, key ed25519.PrivateKey) (*DeletionCertificate, error) {
+	d := GetDB()
+	var email, fullName, cpf sql.NullString
+	err := d.QueryRowContext(ctx, `SELECT email, full_name, cpf FROM users WHERE id = $1`, req.UserID).Scan(&email, &fullName, &cpf)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	// Usuário legado já removido numa tentativa anterior: o NXD foi apagado antes
+	// dele, então resta apenas concluir a anonimização.
+	userGone := err == sql.ErrNoRows
+	if !userGone && subjectHash(email.String) != req.SubjectHash {
+		return nil, fmt.Errorf("email do usuário mudou desde o pedido")
+	}
+
+	cert := &DeletionCertificate{
+		CertificateID: uuid.NewString(),
+		RequestID:     req.ID,
+		SubjectSHA256: req.SubjectHash,
+		RequestedAt:   req.RequestedAt.UTC(),
+		ScheduledFor:  req.ScheduledFor.UTC(),
+		NXDFactories:  []string{},
+		Issuer:        "NXD",
+		Algorithm:     "Ed25519",
+		KeyID:         lgpdKeyID(key.Public().(ed25519.PublicKey)),
+		Statement: "Os dados do titular e das fábricas sob sua responsabilidade foram excluídos " +
+			"dos bancos operacionais e do armazenamento de arquivos. Registros de auditoria mantidos " +
+			"por obrigação de prestação de contas foram anonimizados. Cópias de segurança de " +
+			"infraestrutura expiram conforme a política de retenção do provedor.",
+	}
+
+	if !userGone {
+		if nxdDB := store.NXDDB(); nxdDB != nil {
+			nres, err := store.EraseTenantData(ctx, nxdDB, store.GetArchiveStorage(), email.String)
+			if err != nil {
+				return nil, fmt.Errorf("nxd: %w", err)
+			}
+			for _, id := range nres.FactoryIDs {
+				cert.NXDFactories = append(cert.NXDFactories, id.String())
+			}
+			cert.Items = append(cert.Items, nres.Items...)
+			cert.StorageObjects = nres.StorageObjects
+		}
+	}
+
+	items, err := eraseLegacyTenant(ctx, d, req.UserID, cert.NXDFactories, []string{email.String, fullName.String, cpf.String})
+	if err != nil {
+		return nil, fmt.Errorf("legado: %w", err)
+	}
+	cert.Items = append(cert.Items, items...)
+	cert.CompletedAt = time.Now().UTC()
+	return cert, nil
+}
+
+// eraseLegacyTenant apaga o tenant em public.* e anonimiza o audit_log, numa transação.
+func eraseLegacyTenant(ctx context.Context, d *sql.DB, userID int64, nxdFactories []string, pii []string) ([]store.ErasureItem, error) {
+	tx, err := d.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var items []store.ErasureItem
+	exec := func(scope, action, query string, args ...interface{}) error {
+		res, err := tx.ExecContext(ctx, query, args...)
+		if err != nil {
+			return fmt.Errorf("%s: %w", scope, err)
+		}
+		n, _ := res.RowsAffected()
+		for i := range items {
+			if items[i].Scope == scope && items[i].Action == action {
+				items[i].Rows += n
+				return nil
+			}
+		}
+		items = append(items, store.ErasureItem{Scope: scope, Action: action, Rows: n})
+		return nil
+	}
+
+	const factoriesOf = `SELECT id FROM factories WHERE user_id = $1`
+	if err := exec("public.ia_reports", "deleted", `DELETE FROM ia_reports WHERE user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+	for _, f := range nxdFactories {
+		if err := exec("public.ia_reports", "deleted", `DELETE FROM ia_reports WHERE factory_id = $1`, f); err != nil {
+			return nil, err
+		}
+	}
+	steps := []struct{ scope, query string }{
+		{"public.support_tickets", `DELETE FROM support_tickets WHERE user_id = $1`},
+		{"public.asset_telemetry", `DELETE FROM asset_telemetry WHERE asset_id IN (SELECT id FROM assets WHERE factory_id IN (` + factoriesOf + `))`},
+		{"public.assets", `DELETE FROM assets WHERE factory_id IN (` + factoriesOf + `)`},
+		{"public.sectors", `DELETE FROM sectors WHERE factory_id IN (` + factoriesOf + `)`},
+		{"public.factories", `DELETE FROM factories WHERE user_id = $1`},
+		{"public.users", `DELETE FROM users WHERE id = $1`},
+	}
+	for _, s := range steps {
+		if err := exec(s.scope, "deleted", s.query, userID); err != nil {
+			return nil, err
+		}
+	}
+
+	uid := strconv.FormatInt(userID, 10)
+	if err := exec("public.audit_log", "anonymized",
+		`UPDATE audit_log SET user_id = 0, ip = '-' WHERE user_id = $1`, userID); err != nil {
+		return nil, err
+	}
+	if err := exec("public.audit_log", "anonymized",
+		`UPDATE audit_log SET entity_id = '-' WHERE entity_type = 'user' AND entity_id = $1`, uid); err != nil {
+		return nil, err
+	}
+	for _, s := range pii {
+		if len(strings.TrimSpace(s)) < 3 {
+			continue
+		}
+		if err := exec("public.audit_log", "anonymized", `
+			UPDATE audit_log
+			SET old_value = REPLACE(old_value, $1, '[removido]'), new_value = REPLACE(new_value, $1, '[removido]')
+			WHERE old_value LIKE '%' || $1 || '%' OR new_value LIKE '%' || $1 || '%'`, s); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// ─── Handlers: titular ───────────────────────────────────────────────────────
+
+// GetAccountDeletionHandler — GET /api/account/deletion
+func GetAccountDeletionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	if GetDB() == nil {
+		http.Error(w, "Banco indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	req, err := latestTenantDeletion(userID)
+	if err != nil {
+		log.Printf("[TenantDeletion] get: %v", err)
+		http.Error(w, "Erro ao buscar pedido", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"request":    req,
+		"grace_days": int(tenantDeletionGrace().Hours() / 24),
+	})
+}
+
+// RequestAccountDeletionHandler — POST /api/account/deletion
+// Body: {"password": "...", "reason": "..."} — exige a senha atual.
+func RequestAccountDeletionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	d := GetDB()
+	if d == nil {
+		http.Error(w, "Banco indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body struct {
+		Password string `json:"password"`
+		Reason   string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Password == "" {
+		http.Error(w, "Senha obrigatória para confirmar a exclusão", http.StatusBadRequest)
+		return
+	}
+	var hash string
+	if err := d.QueryRow("SELECT password_hash FROM users WHERE id = $1", userID).Scan(&hash); err != nil {
+		http.Error(w, "Usuário não encontrado", http.StatusNotFound)
+		return
+	}
+	if bcrypt.CompareHashAndPassword([]byte(hash), []byte(body.Password)) != nil {
+		http.Error(w, "Senha incorreta", http.StatusUnauthorized)
+		return
+	}
+
+	req, token, err := createTenantDeletion(userID, userID, body.Reason)
+	if errors.Is(err, errDeletionUnavailable) {
+		log.Printf("[TenantDeletion] Pedido recusado: %v", err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	LogAudit(userID, "tenant_deletion_requested", "tenant_deletion", strconv.FormatInt(req.ID, 10), "", req.ScheduledFor.Format(time.RFC3339), ClientIP(r))
+	writeDeletionCreated(w, req, token)
+}
+
+// CancelAccountDeletionHandler — POST /api/account/deletion/cancel
+func CancelAccountDeletionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	if GetDB() == nil {
+		http.Error(w, "Banco indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	req, err := latestTenantDeletion(userID)
+	if err != nil || req == nil {
+		http.Error(w, "Nenhum pedido de exclusão", http.StatusNotFound)
+		return
+	}
+	if err := cancelTenantDeletion(req.ID); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	LogAudit(userID, "tenant_deletion_cancelled", "tenant_deletion", strconv.FormatInt(req.ID, 10), req.Status, "cancelled", ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "id": req.ID, "status": "cancelled"})
+}
+
+func writeDeletionCreated(w http.ResponseWriter, req *TenantDeletionRequest, token string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"request":       req,
+		"receipt_token": token,
+		"message": fmt.Sprintf("Exclusão agendada para %s. Pode ser cancelada até lá. "+
+			"Guarde o receipt_token: ele é necessário para baixar o certificado de exclusão.",
+			req.ScheduledFor.Format("02/01/2006 15:04 MST")),
+	})
+}
+
+// ─── Handlers: admin ─────────────────────────────────────────────────────────
+
+// ListTenantDeletionsHandler — GET /api/admin/tenant-deletions?status=
+func ListTenantDeletionsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	if !userHasRole(userID, "admin") {
+		http.Error(w, "Acesso negado", http.StatusForbidden)
+		return
+	}
+	d := GetDB()
+	if d == nil {
+		http.Error(w, "Banco indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	query := `SELECT ` + tenantDeletionColumns + ` FROM tenant_deletion_requests`
+	var args []interface{}
+	if st := r.URL.Query().Get("status"); st != "" {
+		query += ` WHERE status = $1`
+		args = append(args, st)
+	}
+	rows, err := d.Query(query+` ORDER BY id DESC LIMIT 200`, args...)
+	if err != nil {
+		http.Error(w, "Erro ao listar pedidos", http.StatusInternalServerError)
+		return
+	}
+	defer rows.Close()
+	list := []TenantDeletionRequest{}
+	for rows.Next() {
+		req, err := scanTenantDeletion(rows.Scan)
+		if err != nil {
+			continue
+		}
+		list = append(list, *req)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"requests": list})
+}
+
+// CreateTenantDeletionHandler — POST /api/admin/tenant-deletions
+// Body: {"user_id": 123, "reason": "fim de contrato"}
+func CreateTenantDeletionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	if !userHasRole(userID, "admin") {
+		http.Error(w, "Acesso negado", http.StatusForbidden)
+		return
+	}
+	if GetDB() == nil {
+		http.Error(w, "Banco indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body struct {
+		UserID int64  `json:"user_id"`
+		Reason string `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.UserID <= 0 {
+		http.Error(w, "user_id obrigatório", http.StatusBadRequest)
+		return
+	}
+	req, token, err := createTenantDeletion(body.UserID, userID, body.Reason)
+	if errors.Is(err, errDeletionUnavailable) {
+		log.Printf("[TenantDeletion] Pedido recusado: %v", err)
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	LogAudit(userID, "tenant_deletion_requested", "tenant_deletion", strconv.FormatInt(req.ID, 10), "", req.ScheduledFor.Format(time.RFC3339), ClientIP(r))
+	writeDeletionCreated(w, req, token)
+}
+
+// CancelTenantDeletionHandler — POST /api/admin/tenant-deletions/{id}/cancel
+func CancelTenantDeletionHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	if !userHasRole(userID, "admin") {
+		http.Error(w, "Acesso negado", http.StatusForbidden)
+		return
+	}
+	if GetDB() == nil {
+		http.Error(w, "Banco indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	if err := cancelTenantDeletion(id); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+	LogAudit(userID, "tenant_deletion_cancelled", "tenant_deletion", strconv.FormatInt(id, 10), "", "cancelled", ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"success": true, "id": id, "status": "cancelled"})
+}
+
+// ─── Handlers: públicos (certificado) ────────────────────────────────────────
+
+// DeletionCertificateHandler — GET /api/lgpd/deletions/{id}/certificate?token=
+// O titular já não tem login depois da exclusão: o acesso é pelo receipt_token.
+func DeletionCertificateHandler(w http.ResponseWriter, r *http.Request) {
+	d := GetDB()
+	if d == nil {
+		http.Error(w, "Banco indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := strconv.ParseInt(mux.Vars(r)["id"], 10, 64)
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	token := r.URL.Query().Get("token")
+	sum := sha256.Sum256([]byte(token))
+	var status, tokenHash string
+	var certJSON, sig sql.NullString
+	err = d.QueryRow(`SELECT status, receipt_token_hash, certificate_json, certificate_signature
+		FROM tenant_deletion_requests WHERE id = $1`, id).Scan(&status, &tokenHash, &certJSON, &sig)
+	if err != nil || token == "" || hex.EncodeToString(sum[:]) != tokenHash {
+		http.Error(w, "Pedido não encontrado", http.StatusNotFound)
+		return
+	}
+	if status != "completed" || !certJSON.Valid {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
+		json.NewEncoder(w).Encode(map[string]interface{}{"status": status})
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":      status,
+		"certificate": certJSON.String,
+		"signature":   sig.String,
+		"algorithm":   "Ed25519",
+	})
+}
+
+// LGPDPublicKeyHandler — GET /api/lgpd/public-key
+func LGPDPublicKeyHandler(w http.ResponseWriter, r *http.Request) {
+	key, err := lgpdSigningKey()
+	if err != nil {
+		http.Error(w, "Chave de assinatura LGPD não configurada", http.StatusServiceUnavailable)
+		return
+	}
+	pub := key.Public().(ed25519.PublicKey)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"algorithm":  "Ed25519",
+		"key_id":     lgpdKeyID(pub),
+		"public_key": base64.StdEncoding.EncodeToString(pub),
+	})
+}
+
+// VerifyDeletionCertificateHandler — POST /api/lgpd/certificates/verify
+// Body: {"certificate": "<JSON exato recebido>", "signature": "<base64>"}
+func VerifyDeletionCertificateHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Certificate string `json:"certificate"`
+		Signature   string `json:"signature"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil || body.Certificate == "" {
+		http.Error(w, "certificate e signature obrigatórios", http.StatusBadRequest)
+		return
+	}
+	key, err := lgpdSigningKey()
+	if err != nil {
+		http.Error(w, "Chave de assinatura LGPD não configurada", http.StatusServiceUnavailable)
+		return
+	}
+	sig, err := base64.StdEncoding.DecodeString(body.Signature)
+	valid := err == nil && ed25519.Verify(key.Public().(ed25519.PublicKey), []byte(body.Certificate), sig)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"valid": valid})
+}
@@ -0,0 +1,412 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"hubsystem/internal/nxd/store"
+)
+
+// LegacyMigrationSet retorna as migrations versionadas do schema legado (public.*).
+// As versões 1–7 reproduzem a antiga cadeia runMigrations → createFactoryTable → ... →
+// ensureIAReportsTable e os ALTERs preguiçosos de totp.go; todas são idempotentes.
+func LegacyMigrationSet(driverName string) store.MigrationSet {
+	if driverName == "postgres" {
+		return store.MigrationSet{Name: "legacy", Table: "public.schema_migrations", Driver: driverName, Migrations: legacyPostgresMigrations}
+	}
+	return store.MigrationSet{Name: "legacy", Table: "schema_migrations", Driver: driverName, Migrations: legacySQLiteMigrations}
+}
+
+var legacyPostgresMigrations = []store.Migration{
+	{
+		Version: 1,
+		Name:    "users",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS public.users (
+				id SERIAL PRIMARY KEY,
+				email TEXT NOT NULL UNIQUE,
+				password_hash TEXT NOT NULL,
+				full_name TEXT,
+				cpf TEXT,
+				two_factor_enabled BOOLEAN DEFAULT FALSE,
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+			)`,
+			// Compatibilidade com public.users legada: adiciona colunas se não existirem
+			`ALTER TABLE public.users ADD COLUMN IF NOT EXISTS password_hash TEXT`,
+			`ALTER TABLE public.users ADD COLUMN IF NOT EXISTS full_name TEXT`,
+			`ALTER TABLE public.users ADD COLUMN IF NOT EXISTS cpf TEXT`,
+			`ALTER TABLE public.users ADD COLUMN IF NOT EXISTS two_factor_enabled BOOLEAN DEFAULT FALSE`,
+			`ALTER TABLE public.users ADD COLUMN IF NOT EXISTS created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP`,
+		},
+		Down: []string{`DROP TABLE IF EXISTS public.users CASCADE`},
+	},
+	{
+		Version: 2,
+		Name:    "factories",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS public.factories (
+				id SERIAL PRIMARY KEY,
+				user_id INTEGER NOT NULL UNIQUE,
+				name TEXT NOT NULL,
+				cnpj TEXT,
+				address TEXT,
+				api_key_hash TEXT,
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY(user_id) REFERENCES public.users(id)
+			)`,
+		},
+		Down: []string{`DROP TABLE IF EXISTS public.factories CASCADE`},
+	},
+	{
+		Version: 3,
+		Name:    "sectors_assets_telemetry",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS public.sectors (
+				id SERIAL PRIMARY KEY,
+				factory_id INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				description TEXT,
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY(factory_id) REFERENCES public.factories(id)
+			)`,
+			`CREATE TABLE IF NOT EXISTS public.assets (
+				id SERIAL PRIMARY KEY,
+				factory_id INTEGER NOT NULL,
+				sector_id INTEGER,
+				name TEXT NOT NULL,
+				description TEXT,
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY(factory_id) REFERENCES public.factories(id),
+				FOREIGN KEY(sector_id) REFERENCES public.sectors(id)
+			)`,
+			`CREATE TABLE IF NOT EXISTS public.asset_telemetry (
+				id BIGSERIAL PRIMARY KEY,
+				asset_id INTEGER NOT NULL,
+				timestamp TIMESTAMP WITH TIME ZONE NOT NULL,
+				payload JSONB NOT NULL,
+				FOREIGN KEY(asset_id) REFERENCES public.assets(id)
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS public.asset_telemetry CASCADE`,
+			`DROP TABLE IF EXISTS public.assets CASCADE`,
+			`DROP TABLE IF EXISTS public.sectors CASCADE`,
+		},
+	},
+	{
+		Version: 4,
+		Name:    "billing_and_support",
+		Up: []string{
+			`ALTER TABLE public.factories ADD COLUMN IF NOT EXISTS subscription_plan TEXT DEFAULT 'free'`,
+			`ALTER TABLE public.factories ADD COLUMN IF NOT EXISTS next_billing_date DATE`,
+			`ALTER TABLE public.factories ADD COLUMN IF NOT EXISTS subscription_status TEXT DEFAULT 'active'`,
+			`ALTER TABLE public.factories ADD COLUMN IF NOT EXISTS gateway_subscription_id TEXT`,
+			`ALTER TABLE public.factories ADD COLUMN IF NOT EXISTS trial_ends_at TIMESTAMP WITH TIME ZONE`,
+			`CREATE TABLE IF NOT EXISTS public.support_tickets (
+				id SERIAL PRIMARY KEY,
+				user_id INTEGER NOT NULL REFERENCES public.users(id),
+				email TEXT NOT NULL,
+				subject TEXT NOT NULL,
+				message TEXT NOT NULL,
+				status TEXT DEFAULT 'open',
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS public.support_tickets CASCADE`,
+			`ALTER TABLE public.factories DROP COLUMN IF EXISTS trial_ends_at`,
+			`ALTER TABLE public.factories DROP COLUMN IF EXISTS gateway_subscription_id`,
+			`ALTER TABLE public.factories DROP COLUMN IF EXISTS subscription_status`,
+			`ALTER TABLE public.factories DROP COLUMN IF EXISTS next_billing_date`,
+			`ALTER TABLE public.factories DROP COLUMN IF EXISTS subscription_plan`,
+		},
+	},
+	{
+		Version: 5,
+		Name:    "audit_log_and_role",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS public.audit_log (
+				id BIGSERIAL PRIMARY KEY,
+				user_id BIGINT NOT NULL,
+				action TEXT NOT NULL,
+				entity_type TEXT NOT NULL,
+				entity_id TEXT,
+				old_value TEXT,
+				new_value TEXT,
+				ip TEXT,
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`ALTER TABLE public.users ADD COLUMN IF NOT EXISTS role TEXT DEFAULT 'operador'`,
+		},
+		Down: []string{
+			`ALTER TABLE public.users DROP COLUMN IF EXISTS role`,
+			`DROP TABLE IF EXISTS public.audit_log CASCADE`,
+		},
+	},
+	{
+		Version: 6,
+		Name:    "ia_reports",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS public.ia_reports (
+				id BIGSERIAL PRIMARY KEY,
+				user_id BIGINT NOT NULL,
+				factory_id TEXT,
+				title TEXT NOT NULL,
+				text_content TEXT NOT NULL,
+				sources_json TEXT,
+				created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+			)`,
+		},
+		Down: []string{`DROP TABLE IF EXISTS public.ia_reports CASCADE`},
+	},
+	{
+		// Colunas de 2FA (antes criadas sob demanda em totp.go).
+		Version: 7,
+		Name:    "users_totp",
+		Up: []string{
+			`ALTER TABLE public.users ADD COLUMN IF NOT EXISTS totp_secret_pending TEXT`,
+			`ALTER TABLE public.users ADD COLUMN IF NOT EXISTS totp_secret TEXT`,
+			`ALTER TABLE public.users ADD COLUMN IF NOT EXISTS totp_enabled BOOLEAN DEFAULT FALSE`,
+		},
+		Down: []string{
+			`ALTER TABLE public.users DROP COLUMN IF EXISTS totp_enabled`,
+			`ALTER TABLE public.users DROP COLUMN IF EXISTS totp_secret`,
+			`ALTER TABLE public.users DROP COLUMN IF EXISTS totp_secret_pending`,
+		},
+	},
+	{
+		// Pedidos de exclusão de tenant (LGPD, ver lgpd.go). Sem FK para users:
+		// a linha sobrevive à exclusão e guarda apenas o hash do email do titular.
+		Version: 8,
+		Name:    "tenant_deletion_requests",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS public.tenant_deletion_requests (
+				id BIGSERIAL PRIMARY KEY,
+				user_id BIGINT NOT NULL,
+				subject_hash TEXT NOT NULL,
+				requested_by BIGINT NOT NULL,
+				reason TEXT,
+				status TEXT NOT NULL DEFAULT 'scheduled',
+				receipt_token_hash TEXT NOT NULL,
+				requested_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+				scheduled_for TIMESTAMP WITH TIME ZONE NOT NULL,
+				cancelled_at TIMESTAMP WITH TIME ZONE,
+				completed_at TIMESTAMP WITH TIME ZONE,
+				attempts INTEGER NOT NULL DEFAULT 0,
+				error_message TEXT,
+				certificate_json TEXT,
+				certificate_signature TEXT
+			)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_tenant_deletion_active
+				ON public.tenant_deletion_requests (user_id)
+				WHERE status IN ('scheduled', 'processing', 'failed')`,
+		},
+		Down: []string{`DROP TABLE IF EXISTS public.tenant_deletion_requests CASCADE`},
+	},
+}
+
+// SQLite: ADD COLUMN não tem IF NOT EXISTS. Os ALTERs ficam em migrations
+// opcionais de um único statement: num banco de dev antigo que já tem a coluna
+// a falha ("duplicate column") é registrada como skipped e não se repete.
+var legacySQLiteMigrations = []store.Migration{
+	{
+		Version: 1,
+		Name:    "users",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS users (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				email TEXT NOT NULL UNIQUE,
+				password_hash TEXT NOT NULL,
+				full_name TEXT,
+				cpf TEXT,
+				two_factor_enabled BOOLEAN DEFAULT FALSE,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)`,
+		},
+		Down: []string{`DROP TABLE IF EXISTS users`},
+	},
+	{
+		Version: 2,
+		Name:    "factories",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS factories (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				cnpj TEXT,
+				address TEXT,
+				api_key_hash TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY(user_id) REFERENCES users(id)
+			)`,
+		},
+		Down: []string{`DROP TABLE IF EXISTS factories`},
+	},
+	{
+		Version: 3,
+		Name:    "sectors_assets_telemetry",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS sectors (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				factory_id INTEGER NOT NULL,
+				name TEXT NOT NULL,
+				description TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY(factory_id) REFERENCES factories(id)
+			)`,
+			`CREATE TABLE IF NOT EXISTS assets (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				factory_id INTEGER NOT NULL,
+				sector_id INTEGER,
+				name TEXT NOT NULL,
+				description TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				FOREIGN KEY(factory_id) REFERENCES factories(id),
+				FOREIGN KEY(sector_id) REFERENCES sectors(id)
+			)`,
+			`CREATE TABLE IF NOT EXISTS asset_telemetry (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				asset_id INTEGER NOT NULL,
+				timestamp TIMESTAMP NOT NULL,
+				payload TEXT NOT NULL, -- SQLite não tem JSON nativo, usamos TEXT
+				FOREIGN KEY(asset_id) REFERENCES assets(id)
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS asset_telemetry`,
+			`DROP TABLE IF EXISTS assets`,
+			`DROP TABLE IF EXISTS sectors`,
+		},
+	},
+	{
+		Version:  4,
+		Name:     "factories_subscription_plan",
+		Optional: true,
+		Up:       []string{`ALTER TABLE factories ADD COLUMN subscription_plan TEXT DEFAULT 'free'`},
+		Down:     []string{`ALTER TABLE factories DROP COLUMN subscription_plan`},
+	},
+	{
+		Version:  5,
+		Name:     "factories_next_billing_date",
+		Optional: true,
+		Up:       []string{`ALTER TABLE factories ADD COLUMN next_billing_date TEXT`},
+		Down:     []string{`ALTER TABLE factories DROP COLUMN next_billing_date`},
+	},
+	{
+		Version: 6,
+		Name:    "support_tickets",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS support_tickets (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL REFERENCES users(id),
+				email TEXT NOT NULL,
+				subject TEXT NOT NULL,
+				message TEXT NOT NULL,
+				status TEXT DEFAULT 'open',
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)`,
+		},
+		Down: []string{`DROP TABLE IF EXISTS support_tickets`},
+	},
+	{
+		Version:  7,
+		Name:     "users_role",
+		Optional: true,
+		Up:       []string{`ALTER TABLE users ADD COLUMN role TEXT DEFAULT 'operador'`},
+		Down:     []string{`ALTER TABLE users DROP COLUMN role`},
+	},
+	{
+		Version: 8,
+		Name:    "audit_log",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS audit_log (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				action TEXT NOT NULL,
+				entity_type TEXT NOT NULL,
+				entity_id TEXT,
+				old_value TEXT,
+				new_value TEXT,
+				ip TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)`,
+		},
+		Down: []string{`DROP TABLE IF EXISTS audit_log`},
+	},
+	{
+		Version: 9,
+		Name:    "ia_reports",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS ia_reports (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				factory_id TEXT,
+				title TEXT NOT NULL,
+				text_content TEXT NOT NULL,
+				sources_json TEXT,
+				created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+			)`,
+		},
+		Down: []string{`DROP TABLE IF EXISTS ia_reports`},
+	},
+	{
+		Version: 10,
+		Name:    "tenant_deletion_requests",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS tenant_deletion_requests (
+				id INTEGER PRIMARY KEY AUTOINCREMENT,
+				user_id INTEGER NOT NULL,
+				subject_hash TEXT NOT NULL,
+				requested_by INTEGER NOT NULL,
+				reason TEXT,
+				status TEXT NOT NULL DEFAULT 'scheduled',
+				receipt_token_hash TEXT NOT NULL,
+				requested_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+				scheduled_for TIMESTAMP NOT NULL,
+				cancelled_at TIMESTAMP,
+				completed_at TIMESTAMP,
+				attempts INTEGER NOT NULL DEFAULT 0,
+				error_message TEXT,
+				certificate_json TEXT,
+				certificate_signature TEXT
+			)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_tenant_deletion_active
+				ON tenant_deletion_requests (user_id)
+				WHERE status IN ('scheduled', 'processing', 'failed')`,
+		},
+		Down: []string{`DROP TABLE IF EXISTS tenant_deletion_requests`},
+	},
+}
+
+// MigrationsStatusHandler GET /api/admin/migrations — estado das migrations dos dois schemas (admin).
+func MigrationsStatusHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	if !userHasRole(userID, "admin") {
+		http.Error(w, "Acesso negado", http.StatusForbidden)
+		return
+	}
+
+	resp := map[string]interface{}{}
+	if db != nil {
+		rows, err := store.MigrationStatus(db, LegacyMigrationSet(legacyDriver))
+		if err != nil {
+			http.Error(w, "Erro ao ler migrations legadas: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp["legacy"] = map[string]interface{}{"migrations": rows, "pending": store.PendingMigrations(rows)}
+	}
+	if nxdDB := store.NXDDB(); nxdDB != nil {
+		rows, err := store.MigrationStatus(nxdDB, store.NXDMigrationSet(store.Driver()))
+		if err != nil {
+			http.Error(w, "Erro ao ler migrations NXD: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		resp["nxd"] = map[string]interface{}{"migrations": rows, "pending": store.PendingMigrations(rows)}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,274 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"hubsystem/internal/nxd/store"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// ─── OEE (disponibilidade × desempenho × qualidade) ────────────────────────
+
+// parseAnalyticsPeriod lê ?start=&end= (RFC3339) ou ?period=1h|24h|7d|30d
+// (padrão defaultPeriod). Retorna o rótulo do período ("custom" com start/end).
+func parseAnalyticsPeriod(r *http.Request, defaultPeriod string) (time.Time, time.Time, string, error) {
+	q := r.URL.Query()
+	now := time.Now()
+	if q.Get("start") != "" || q.Get("end") != "" {
+		start, err := time.Parse(time.RFC3339, q.Get("start"))
+		if err != nil {
+			return time.Time{}, time.Time{}, "", fmt.Errorf("start inválido (use RFC3339)")
+		}
+		end := now
+		if v := q.Get("end"); v != "" {
+			if end, err = time.Parse(time.RFC3339, v); err != nil {
+				return time.Time{}, time.Time{}, "", fmt.Errorf("end inválido (use RFC3339)")
+			}
+		}
+		if !start.Before(end) {
+			return time.Time{}, time.Time{}, "", fmt.Errorf("start deve ser anterior a end")
+		}
+		return start, end, "custom", nil
+	}
+	period := q.Get("period")
+	if period == "" {
+		period = defaultPeriod
+	}
+	switch period {
+	case "1h":
+		return now.Add(-time.Hour), now, period, nil
+	case "24h":
+		return now.Add(-24 * time.Hour), now, period, nil
+	case "7d":
+		return now.Add(-7 * 24 * time.Hour), now, period, nil
+	case "30d":
+		return now.Add(-30 * 24 * time.Hour), now, period, nil
+	}
+	return time.Time{}, time.Time{}, "", fmt.Errorf("period inválido (1h, 24h, 7d, 30d ou start/end)")
+}
+
+// parseOptionalUUID lê um parâmetro de query opcional.
+func parseOptionalUUID(r *http.Request, name string) (*uuid.UUID, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return nil, nil
+	}
+	u, err := uuid.Parse(v)
+	if err != nil {
+		return nil, fmt.Errorf("%s inválido", name)
+	}
+	return &u, nil
+}
+
+// parseTrendBucket lê ?bucket= (Go duration ou 1d; mínimo 1m). Vazio = sem tendência.
+func parseTrendBucket(r *http.Request) (time.Duration, error) {
+	b := r.URL.Query().Get("bucket")
+	if b == "" {
+		return 0, nil
+	}
+	if b == "1d" {
+		return 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(b)
+	if err != nil || d < time.Minute {
+		return 0, fmt.Errorf("bucket inválido (ex.: 15m, 1h, 1d; mínimo 1m)")
+	}
+	return d, nil
+}
+
+// GetOEEHandler — GET /api/oee?period=24h|7d|30d|current_shift|last_shift | start=&end= (RFC3339)
+// &sector_id=uuid&asset_id=uuid&bucket=1h|1d (Go duration ou 1d)
+func GetOEEHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	q := store.OEEQuery{FactoryID: factoryID}
+	if q.SectorID, err = parseOptionalUUID(r, "sector_id"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var period string
+	if q.Start, q.End, period, err = resolveProductionPeriod(r, nxdDB, factoryID, q.SectorID, "24h"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.AssetID, err = parseOptionalUUID(r, "asset_id"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Bucket, err = parseTrendBucket(r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := store.ComputeOEE(nxdDB, q)
+	if err != nil {
+		log.Printf("[OEE] %v", err)
+		http.Error(w, "Erro ao calcular OEE: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"oee":    report,
+		"period": period,
+	})
+}
+
+// ─── Paradas planejadas ────────────────────────────────────────────────────
+
+// ListPlannedDowntimeHandler — GET /api/planned-downtime?period=7d | start=&end=
+func ListPlannedDowntimeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	start, end, _, err := parseAnalyticsPeriod(r, "7d")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	list, err := store.ListPlannedDowntime(nxdDB, factoryID, start, end)
+	if err != nil {
+		log.Printf("[PlannedDowntime] List: %v", err)
+		http.Error(w, "Erro ao listar paradas planejadas", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []store.PlannedDowntimeRow{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"planned_downtime": list})
+}
+
+// CreatePlannedDowntimeHandler — POST /api/planned-downtime
+// Body: { "starts_at": "RFC3339", "ends_at": "RFC3339", "sector_id": "uuid|null", "asset_id": "uuid|null", "reason": "Preventiva" }
+func CreatePlannedDowntimeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body struct {
+		StartsAt time.Time  `json:"starts_at"`
+		EndsAt   time.Time  `json:"ends_at"`
+		SectorID *uuid.UUID `json:"sector_id"`
+		AssetID  *uuid.UUID `json:"asset_id"`
+		Reason   string     `json:"reason"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	if body.StartsAt.IsZero() || !body.EndsAt.After(body.StartsAt) {
+		http.Error(w, "starts_at e ends_at obrigatórios (ends_at > starts_at)", http.StatusBadRequest)
+		return
+	}
+	if body.AssetID != nil {
+		if a, err := store.GetAssetByID(nxdDB, *body.AssetID, factoryID); err != nil || a == nil {
+			http.Error(w, "Ativo não encontrado", http.StatusNotFound)
+			return
+		}
+	}
+	if body.SectorID != nil {
+		if s, err := store.GetSectorByID(nxdDB, *body.SectorID, factoryID); err != nil || s == nil {
+			http.Error(w, "Setor não encontrado", http.StatusNotFound)
+			return
+		}
+	}
+	uid := userID
+	row := store.PlannedDowntimeRow{
+		FactoryID: factoryID,
+		SectorID:  body.SectorID,
+		AssetID:   body.AssetID,
+		StartsAt:  body.StartsAt,
+		EndsAt:    body.EndsAt,
+		Reason:    body.Reason,
+		CreatedBy: &uid,
+	}
+	id, err := store.CreatePlannedDowntime(nxdDB, row)
+	if err != nil {
+		log.Printf("[PlannedDowntime] Create: %v", err)
+		http.Error(w, "Erro ao salvar parada planejada", http.StatusInternalServerError)
+		return
+	}
+	LogAudit(userID, "planned_downtime_created", "planned_downtime", id.String(), "",
+		body.StartsAt.Format(time.RFC3339)+" → "+body.EndsAt.Format(time.RFC3339), ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": id})
+}
+
+// DeletePlannedDowntimeHandler — DELETE /api/planned-downtime/{id}
+func DeletePlannedDowntimeHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	found, err := store.DeletePlannedDowntime(nxdDB, factoryID, id)
+	if err != nil {
+		log.Printf("[PlannedDowntime] Delete: %v", err)
+		http.Error(w, "Erro ao remover parada planejada", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Parada planejada não encontrada", http.StatusNotFound)
+		return
+	}
+	LogAudit(userID, "planned_downtime_deleted", "planned_downtime", id.String(), "", "", ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
@@ -0,0 +1,352 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"hubsystem/internal/nxd/store"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// ─── Ordens de produção (lotes) ────────────────────────────────────────────
+
+// productionOrderBody é o payload de criação/edição. No PUT, campos ausentes
+// mantêm o valor atual; start/close marcam início/fim agora.
+type productionOrderBody struct {
+	OrderCode    *string    `json:"order_code"`
+	Product      *string    `json:"product"`
+	TargetQty    *float64   `json:"target_qty"`
+	ValorVendaOk *float64   `json:"valor_venda_ok"`
+	SectorID     *uuid.UUID `json:"sector_id"`
+	AssetID      *uuid.UUID `json:"asset_id"`
+	StartedAt    *time.Time `json:"started_at"`
+	EndedAt      *time.Time `json:"ended_at"`
+	Start        bool       `json:"start"`
+	Close        bool       `json:"close"`
+}
+
+// apply copia os campos presentes para o, resolvendo start/close com now.
+func (b productionOrderBody) apply(o *store.ProductionOrderRow, now time.Time) {
+	if b.OrderCode != nil {
+		o.OrderCode = *b.OrderCode
+	}
+	if b.Product != nil {
+		o.Product = *b.Product
+	}
+	if b.TargetQty != nil {
+		o.TargetQty = b.TargetQty
+	}
+	if b.ValorVendaOk != nil {
+		o.ValorVendaOk = b.ValorVendaOk
+	}
+	if b.SectorID != nil {
+		o.SectorID = b.SectorID
+	}
+	if b.AssetID != nil {
+		o.AssetID = b.AssetID
+	}
+	if b.StartedAt != nil {
+		o.StartedAt = b.StartedAt
+	}
+	if b.EndedAt != nil {
+		o.EndedAt = b.EndedAt
+	}
+	if b.Start && o.StartedAt == nil {
+		o.StartedAt = &now
+	}
+	if b.Close && o.EndedAt == nil {
+		o.EndedAt = &now
+	}
+}
+
+// ListProductionOrdersHandler — GET /api/production-orders?period=7d | start=&end=
+// &status=planned|running|done&sector_id=&asset_id=&product=&limit=
+func ListProductionOrdersHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	q, ok := productionOrderQueryFromRequest(w, r, factoryID, "7d")
+	if !ok {
+		return
+	}
+	q.Status = r.URL.Query().Get("status")
+	q.Limit = 200
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 && l <= 1000 {
+		q.Limit = l
+	}
+	list, err := store.ListProductionOrders(nxdDB, q)
+	if err != nil {
+		log.Printf("[Orders] List: %v", err)
+		http.Error(w, "Erro ao listar ordens de produção", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []store.ProductionOrderRow{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"orders": list})
+}
+
+// GetProductionOrderHandler — GET /api/production-orders/{id}
+// Retorna a ordem com OK/NOK, paradas, energia, custos e margem (até agora, se em execução).
+func GetProductionOrderHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	o, err := store.GetProductionOrder(nxdDB, factoryID, id)
+	if err != nil {
+		log.Printf("[Orders] Get: %v", err)
+		http.Error(w, "Erro ao carregar ordem de produção", http.StatusInternalServerError)
+		return
+	}
+	if o == nil {
+		http.Error(w, "Ordem não encontrada", http.StatusNotFound)
+		return
+	}
+	res, err := store.ComputeProductionOrder(nxdDB, *o, time.Now())
+	if err != nil {
+		log.Printf("[Orders] Compute %s: %v", id, err)
+		http.Error(w, "Erro ao calcular ordem de produção: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"order": res})
+}
+
+// CreateProductionOrderHandler — POST /api/production-orders
+// Body: { "order_code": "4512", "product": "Tampa 38mm", "target_qty": 5000, "asset_id": "uuid", "valor_venda_ok": 0.42, "start": true }
+// Sem started_at/start a ordem fica planejada até o tag_order do ativo apontar o código.
+func CreateProductionOrderHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body productionOrderBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	o := store.ProductionOrderRow{FactoryID: factoryID, Source: "api"}
+	body.apply(&o, time.Now())
+	id, err := store.CreateProductionOrder(nxdDB, o)
+	if errors.Is(err, store.ErrInvalidProductionOrder) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		log.Printf("[Orders] Create: %v", err)
+		http.Error(w, "Erro ao salvar ordem de produção", http.StatusInternalServerError)
+		return
+	}
+	LogAudit(userID, "production_order_created", "production_order", id.String(), "", o.OrderCode+" "+o.Product, ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": id})
+}
+
+// UpdateProductionOrderHandler — PUT /api/production-orders/{id}
+// Mesmo body do POST; campos ausentes mantêm o valor. { "close": true } encerra agora.
+func UpdateProductionOrderHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	var body productionOrderBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	o, err := store.GetProductionOrder(nxdDB, factoryID, id)
+	if err != nil {
+		log.Printf("[Orders] Get: %v", err)
+		http.Error(w, "Erro ao carregar ordem de produção", http.StatusInternalServerError)
+		return
+	}
+	if o == nil {
+		http.Error(w, "Ordem não encontrada", http.StatusNotFound)
+		return
+	}
+	old := o.Status
+	body.apply(o, time.Now())
+	err = store.UpdateProductionOrder(nxdDB, *o)
+	if errors.Is(err, store.ErrInvalidProductionOrder) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, store.ErrProductionOrderNotFound) {
+		http.Error(w, "Ordem não encontrada", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[Orders] Update: %v", err)
+		http.Error(w, "Erro ao salvar ordem de produção", http.StatusInternalServerError)
+		return
+	}
+	status := "planned"
+	if o.StartedAt != nil {
+		status = "running"
+	}
+	if o.EndedAt != nil {
+		status = "done"
+	}
+	LogAudit(userID, "production_order_updated", "production_order", id.String(), old, status, ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// DeleteProductionOrderHandler — DELETE /api/production-orders/{id}
+func DeleteProductionOrderHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	err = store.DeleteProductionOrder(nxdDB, factoryID, id)
+	if errors.Is(err, store.ErrProductionOrderNotFound) {
+		http.Error(w, "Ordem não encontrada", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		log.Printf("[Orders] Delete: %v", err)
+		http.Error(w, "Erro ao remover ordem de produção", http.StatusInternalServerError)
+		return
+	}
+	LogAudit(userID, "production_order_deleted", "production_order", id.String(), "", "", ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// GetProductProfitabilityHandler — GET /api/production-orders/profitability?period=30d&sector_id=&asset_id=&product=
+// Rentabilidade por produto: soma das ordens iniciadas no período (ordens inteiras).
+func GetProductProfitabilityHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	q, ok := productionOrderQueryFromRequest(w, r, factoryID, "30d")
+	if !ok {
+		return
+	}
+	products, orders, err := store.ComputeProductProfitability(nxdDB, q, time.Now())
+	if err != nil {
+		log.Printf("[Orders] Profitability: %v", err)
+		http.Error(w, "Erro ao calcular rentabilidade: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if orders == nil {
+		orders = []store.ProductionOrderResult{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"products":     products,
+		"orders":       orders,
+		"period_start": q.Start,
+		"period_end":   q.End,
+	})
+}
+
+// productionOrderQueryFromRequest lê período, sector_id, asset_id e product.
+func productionOrderQueryFromRequest(w http.ResponseWriter, r *http.Request, factoryID uuid.UUID, defaultPeriod string) (store.ProductionOrderQuery, bool) {
+	q := store.ProductionOrderQuery{FactoryID: factoryID, Product: r.URL.Query().Get("product")}
+	var err error
+	if q.SectorID, err = parseOptionalUUID(r, "sector_id"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return q, false
+	}
+	if q.AssetID, err = parseOptionalUUID(r, "asset_id"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return q, false
+	}
+	if q.Start, q.End, _, err = resolveProductionPeriod(r, store.NXDDB(), factoryID, q.SectorID, defaultPeriod); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return q, false
+	}
+	return q, true
+}
@@ -0,0 +1,324 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hubsystem/internal/nxd/store"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// ─── Metas de produção (planejado × realizado) ──────────────────────────────
+
+// targetError responde os erros de validação do store (400/409); false = erro interno.
+func targetError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, store.ErrInvalidTarget):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, store.ErrTargetConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		return false
+	}
+	return true
+}
+
+// productionTargetBody — escopo/período/métrica só na criação; o resto também no PUT.
+type productionTargetBody struct {
+	SectorID      *uuid.UUID `json:"sector_id"`
+	AssetID       *uuid.UUID `json:"asset_id"`
+	Period        string     `json:"period"`
+	ShiftID       *uuid.UUID `json:"shift_id"`
+	Metric        string     `json:"metric"`
+	Target        float64    `json:"target"`
+	ValidFrom     string     `json:"valid_from"`
+	ValidTo       string     `json:"valid_to"`
+	Notes         string     `json:"notes"`
+	AlertBelowPct *float64   `json:"alert_below_pct"`
+}
+
+// ListProductionTargetsHandler — GET /api/production-targets
+func ListProductionTargetsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	list, err := store.ListProductionTargets(nxdDB, factoryID)
+	if err != nil {
+		log.Printf("[Targets] List: %v", err)
+		http.Error(w, "Erro ao listar metas", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []store.ProductionTargetRow{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"targets": list})
+}
+
+// CreateProductionTargetHandler — POST /api/production-targets
+// Body: { "asset_id" | "sector_id": "uuid", "period": "day" | "shift", "shift_id": "uuid" (opcional),
+// "metric": "pieces" | "oee" | "scrap_rate", "target": 1000, "valid_from": "2024-03-01",
+// "valid_to": "" (opcional), "notes": "", "alert_below_pct": 90 (opcional: alerta se o ritmo < 90% da meta) }
+func CreateProductionTargetHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body productionTargetBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	id, err := store.CreateProductionTarget(nxdDB, store.ProductionTargetRow{
+		FactoryID:     factoryID,
+		SectorID:      body.SectorID,
+		AssetID:       body.AssetID,
+		Period:        body.Period,
+		ShiftID:       body.ShiftID,
+		Metric:        body.Metric,
+		Target:        body.Target,
+		ValidFrom:     body.ValidFrom,
+		ValidTo:       body.ValidTo,
+		Notes:         body.Notes,
+		AlertBelowPct: body.AlertBelowPct,
+	})
+	if err != nil {
+		if targetError(w, err) {
+			return
+		}
+		log.Printf("[Targets] Create: %v", err)
+		http.Error(w, "Erro ao salvar meta", http.StatusInternalServerError)
+		return
+	}
+	LogAudit(userID, "production_target_created", "production_target", id.String(), "",
+		fmt.Sprintf("%s/%s %g desde %s", body.Metric, body.Period, body.Target, body.ValidFrom), ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": id})
+}
+
+// UpdateProductionTargetHandler — PUT /api/production-targets/{id}
+// Body: { "target", "valid_from", "valid_to", "notes", "alert_below_pct" } (escopo, período e métrica não mudam).
+func UpdateProductionTargetHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	var body productionTargetBody
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	found, err := store.UpdateProductionTarget(nxdDB, store.ProductionTargetRow{
+		ID:            id,
+		FactoryID:     factoryID,
+		Target:        body.Target,
+		ValidFrom:     body.ValidFrom,
+		ValidTo:       body.ValidTo,
+		Notes:         body.Notes,
+		AlertBelowPct: body.AlertBelowPct,
+	})
+	if err != nil {
+		if targetError(w, err) {
+			return
+		}
+		log.Printf("[Targets] Update: %v", err)
+		http.Error(w, "Erro ao salvar meta", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Meta não encontrada", http.StatusNotFound)
+		return
+	}
+	LogAudit(userID, "production_target_updated", "production_target", id.String(), "",
+		fmt.Sprintf("%g desde %s", body.Target, body.ValidFrom), ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// DeleteProductionTargetHandler — DELETE /api/production-targets/{id}
+func DeleteProductionTargetHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	found, err := store.DeleteProductionTarget(nxdDB, factoryID, id)
+	if err != nil {
+		log.Printf("[Targets] Delete: %v", err)
+		http.Error(w, "Erro ao remover meta", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Meta não encontrada", http.StatusNotFound)
+		return
+	}
+	LogAudit(userID, "production_target_deleted", "production_target", id.String(), "", "", ClientIP(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetTargetProgressHandler — GET /api/production-targets/progress?from=2024-03-01&to=2024-03-07&sector_id=&asset_id=
+// Planejado × realizado por janela (dia ou turno) nos dias locais [from, to] (padrão: hoje).
+// sector_id inclui as metas dos ativos do setor.
+func GetTargetProgressHandler(w http.ResponseWriter, r *http.Request) {
+	targetProgress(w, r, false)
+}
+
+// GetTargetPaceHandler — GET /api/production-targets/pace?sector_id=&asset_id=
+// Janelas em andamento com a projeção no ritmo atual ("no ritmo atual: 870/1000 peças").
+func GetTargetPaceHandler(w http.ResponseWriter, r *http.Request) {
+	targetProgress(w, r, true)
+}
+
+func targetProgress(w http.ResponseWriter, r *http.Request, pace bool) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	q := r.URL.Query()
+	var sectorID, assetID *uuid.UUID
+	if v := q.Get("sector_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			http.Error(w, "sector_id inválido", http.StatusBadRequest)
+			return
+		}
+		sectorID = &id
+	}
+	if v := q.Get("asset_id"); v != "" {
+		id, err := uuid.Parse(v)
+		if err != nil {
+			http.Error(w, "asset_id inválido", http.StatusBadRequest)
+			return
+		}
+		assetID = &id
+	}
+	now := time.Now()
+	var rows []store.TargetProgressRow
+	if pace {
+		rows, err = store.ComputeTargetPace(nxdDB, factoryID, now)
+	} else {
+		rows, err = store.ComputeTargetProgress(nxdDB, factoryID, q.Get("from"), q.Get("to"), now)
+	}
+	if err != nil {
+		if targetError(w, err) {
+			return
+		}
+		log.Printf("[Targets] Progress: %v", err)
+		http.Error(w, "Erro ao calcular metas", http.StatusInternalServerError)
+		return
+	}
+	out := []store.TargetProgressRow{}
+	for _, row := range rows {
+		if sectorID != nil && (row.SectorID == nil || *row.SectorID != *sectorID) {
+			continue
+		}
+		if assetID != nil && (row.AssetID == nil || *row.AssetID != *assetID) {
+			continue
+		}
+		out = append(out, row)
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"progress": out, "generated_at": now})
+}
+
+// ListAlertsHandler — GET /api/alerts?unack_only=true
+// Alertas disparados da fábrica (inclui os de meta atrasada), mais recentes primeiro.
+func ListAlertsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	list, err := store.ListAlerts(nxdDB, factoryID, r.URL.Query().Get("unack_only") == "true")
+	if err != nil {
+		log.Printf("[Alerts] List: %v", err)
+		http.Error(w, "Erro ao listar alertas", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []store.AlertRow{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"alerts": list})
+}
@@ -0,0 +1,67 @@
+package api
+
+import (
+	"encoding/json"
+	"hubsystem/internal/nxd/store"
+	"log"
+	"net/http"
+
+	"github.com/google/uuid"
+)
+
+// ─── Confiabilidade (MTBF / MTTR) ───────────────────────────────────────────
+
+// GetReliabilityHandler — GET /api/reliability?period=30d|7d|current_shift|last_shift | start=&end= (RFC3339)
+// &sector_id=uuid&asset_id=uuid&bucket=1d&basis=failures|all
+// basis=failures (padrão) conta só paradas com motivo de falha e o tag_alarm; all conta toda parada.
+func GetReliabilityHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	q := store.ReliabilityQuery{FactoryID: factoryID, Basis: r.URL.Query().Get("basis")}
+	if q.Basis != "" && q.Basis != "failures" && q.Basis != "all" {
+		http.Error(w, "basis inválido (failures ou all)", http.StatusBadRequest)
+		return
+	}
+	if q.SectorID, err = parseOptionalUUID(r, "sector_id"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var period string
+	if q.Start, q.End, period, err = resolveProductionPeriod(r, nxdDB, factoryID, q.SectorID, "30d"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.AssetID, err = parseOptionalUUID(r, "asset_id"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if q.Bucket, err = parseTrendBucket(r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := store.ComputeReliability(nxdDB, q)
+	if err != nil {
+		log.Printf("[Reliability] %v", err)
+		http.Error(w, "Erro ao calcular confiabilidade: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"reliability": report,
+		"period":      period,
+	})
+}
@@ -0,0 +1,313 @@
+package api
+
+import (
+	"encoding/json"
+	"errors"
+	"hubsystem/internal/nxd/store"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/mux"
+)
+
+// ─── Métricas virtuais (fórmulas sobre metric_keys) ────────────────────────
+
+// virtualMetricError responde os erros de validação do store (400/409); false = erro interno.
+func virtualMetricError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, store.ErrInvalidExpression), errors.Is(err, store.ErrVirtualMetricCycle):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, store.ErrVirtualMetricConflict):
+		http.Error(w, err.Error(), http.StatusConflict)
+	default:
+		return false
+	}
+	return true
+}
+
+// ListVirtualMetricsHandler — GET /api/virtual-metrics
+func ListVirtualMetricsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	list, err := store.ListVirtualMetrics(nxdDB, factoryID)
+	if err != nil {
+		log.Printf("[VirtualMetrics] List: %v", err)
+		http.Error(w, "Erro ao listar métricas virtuais", http.StatusInternalServerError)
+		return
+	}
+	if list == nil {
+		list = []store.VirtualMetricRow{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{"virtual_metrics": list})
+}
+
+// CreateVirtualMetricHandler — POST /api/virtual-metrics
+// Body: { "metric_key": "delta_pressao", "expression": "abs(Pressao_1 - Pressao_2)", "unit": "bar", "mode": "ingest|query",
+// "asset_id": "uuid" ou "sector_id": "uuid" (nenhum = fábrica inteira) }
+func CreateVirtualMetricHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body struct {
+		MetricKey   string     `json:"metric_key"`
+		Expression  string     `json:"expression"`
+		AssetID     *uuid.UUID `json:"asset_id"`
+		SectorID    *uuid.UUID `json:"sector_id"`
+		Unit        string     `json:"unit"`
+		Description string     `json:"description"`
+		Mode        string     `json:"mode"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	if body.AssetID != nil && body.SectorID != nil {
+		http.Error(w, "informe asset_id ou sector_id, não os dois", http.StatusBadRequest)
+		return
+	}
+	if body.AssetID != nil {
+		if a, err := store.GetAssetByID(nxdDB, *body.AssetID, factoryID); err != nil || a == nil {
+			http.Error(w, "Ativo não encontrado", http.StatusNotFound)
+			return
+		}
+	}
+	if body.SectorID != nil {
+		if s, err := store.GetSectorByID(nxdDB, *body.SectorID, factoryID); err != nil || s == nil {
+			http.Error(w, "Setor não encontrado", http.StatusNotFound)
+			return
+		}
+	}
+	uid := userID
+	row := store.VirtualMetricRow{
+		FactoryID:   factoryID,
+		SectorID:    body.SectorID,
+		AssetID:     body.AssetID,
+		MetricKey:   body.MetricKey,
+		Expression:  body.Expression,
+		Unit:        strings.TrimSpace(body.Unit),
+		Description: strings.TrimSpace(body.Description),
+		Mode:        body.Mode,
+		CreatedBy:   &uid,
+	}
+	id, err := store.CreateVirtualMetric(nxdDB, row)
+	if err != nil {
+		if virtualMetricError(w, err) {
+			return
+		}
+		log.Printf("[VirtualMetrics] Create: %v", err)
+		http.Error(w, "Erro ao salvar métrica virtual", http.StatusInternalServerError)
+		return
+	}
+	LogAudit(userID, "virtual_metric_created", "virtual_metric", id.String(), "", body.MetricKey+" = "+body.Expression, ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]interface{}{"id": id})
+}
+
+// UpdateVirtualMetricHandler — PUT /api/virtual-metrics/{id}
+// Body: { "expression": "...", "unit": "...", "description": "...", "mode": "query", "active": false }
+// Campos ausentes mantêm o valor; escopo e metric_key não mudam.
+func UpdateVirtualMetricHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	var body struct {
+		Expression  *string `json:"expression"`
+		Unit        *string `json:"unit"`
+		Description *string `json:"description"`
+		Mode        *string `json:"mode"`
+		Active      *bool   `json:"active"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	cur, err := store.GetVirtualMetric(nxdDB, factoryID, id)
+	if err != nil {
+		log.Printf("[VirtualMetrics] Get: %v", err)
+		http.Error(w, "Erro ao carregar métrica virtual", http.StatusInternalServerError)
+		return
+	}
+	if cur == nil {
+		http.Error(w, "Métrica virtual não encontrada", http.StatusNotFound)
+		return
+	}
+	old := cur.Expression
+	if body.Expression != nil {
+		cur.Expression = *body.Expression
+	}
+	if body.Unit != nil {
+		cur.Unit = strings.TrimSpace(*body.Unit)
+	}
+	if body.Description != nil {
+		cur.Description = strings.TrimSpace(*body.Description)
+	}
+	if body.Mode != nil {
+		cur.Mode = *body.Mode
+	}
+	if body.Active != nil {
+		cur.Active = *body.Active
+	}
+	found, err := store.UpdateVirtualMetric(nxdDB, *cur)
+	if err != nil {
+		if virtualMetricError(w, err) {
+			return
+		}
+		log.Printf("[VirtualMetrics] Update: %v", err)
+		http.Error(w, "Erro ao salvar métrica virtual", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Métrica virtual não encontrada", http.StatusNotFound)
+		return
+	}
+	LogAudit(userID, "virtual_metric_updated", "virtual_metric", id.String(), old, cur.Expression, ClientIP(r))
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+// DeleteVirtualMetricHandler — DELETE /api/virtual-metrics/{id}
+// As leituras já gravadas (mode=ingest) continuam no histórico.
+func DeleteVirtualMetricHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	id, err := uuid.Parse(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "id inválido", http.StatusBadRequest)
+		return
+	}
+	found, err := store.DeleteVirtualMetric(nxdDB, factoryID, id)
+	if err != nil {
+		log.Printf("[VirtualMetrics] Delete: %v", err)
+		http.Error(w, "Erro ao remover métrica virtual", http.StatusInternalServerError)
+		return
+	}
+	if !found {
+		http.Error(w, "Métrica virtual não encontrada", http.StatusNotFound)
+		return
+	}
+	LogAudit(userID, "virtual_metric_deleted", "virtual_metric", id.String(), "", "", ClientIP(r))
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PreviewVirtualMetricHandler — POST /api/virtual-metrics/preview?period=24h | start=&end=&limit=
+// Body: { "asset_id": "uuid", "expression": "..." } — avalia sobre o histórico sem salvar.
+func PreviewVirtualMetricHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := r.Context().Value("userID").(int64)
+	if !ok {
+		http.Error(w, "Não autenticado", http.StatusUnauthorized)
+		return
+	}
+	factoryID, err := getFactoryIDForUser(userID)
+	if err != nil || factoryID == uuid.Nil {
+		http.Error(w, "Fábrica não encontrada", http.StatusNotFound)
+		return
+	}
+	nxdDB := store.NXDDB()
+	if nxdDB == nil {
+		http.Error(w, "Banco NXD indisponível", http.StatusServiceUnavailable)
+		return
+	}
+	var body struct {
+		AssetID    uuid.UUID `json:"asset_id"`
+		Expression string    `json:"expression"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		http.Error(w, "Payload inválido", http.StatusBadRequest)
+		return
+	}
+	if a, err := store.GetAssetByID(nxdDB, body.AssetID, factoryID); err != nil || a == nil {
+		http.Error(w, "Ativo não encontrado", http.StatusNotFound)
+		return
+	}
+	start, end, _, err := parseAnalyticsPeriod(r, "24h")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	limit := 5000
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 && n <= 50000 {
+			limit = n
+		}
+	}
+	points, truncated, err := store.PreviewVirtualExpression(r.Context(), nxdDB, store.GetArchiveStorage(), factoryID, body.AssetID, body.Expression, start, end, limit)
+	if err != nil {
+		if virtualMetricError(w, err) {
+			return
+		}
+		log.Printf("[VirtualMetrics] Preview: %v", err)
+		http.Error(w, "Erro ao avaliar expressão", http.StatusInternalServerError)
+		return
+	}
+	if points == nil {
+		points = []store.TelemetryPoint{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from":      start,
+		"to":        end,
+		"points":    points,
+		"count":     len(points),
+		"truncated": truncated,
+	})
+}
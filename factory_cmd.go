@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"hubsystem/api"
+	"hubsystem/internal/nxd/store"
+
+	"github.com/google/uuid"
+)
+
+const factoryUsage = `uso: server factory <backup|restore> ...
+
+  backup <factory-id> <arquivo> [--telemetry]
+        grava o backup da fábrica (gzip + JSON Lines)
+  restore <arquivo> [--clone] [--name=NOME] [--owner=EMAIL] [--skip-telemetry]
+        restaura o backup; --clone gera UUIDs novos (permite clonar no mesmo banco)
+`
+
+// runFactoryCommand executa o subcomando "factory" e retorna o exit code.
+func runFactoryCommand(args []string) int {
+	var pos []string
+	flags := map[string]string{}
+	for _, a := range args {
+		if strings.HasPrefix(a, "--") {
+			k, v, _ := strings.Cut(a[2:], "=")
+			flags[k] = v
+			continue
+		}
+		pos = append(pos, a)
+	}
+	if len(pos) == 0 {
+		fmt.Fprint(os.Stderr, factoryUsage)
+		return 2
+	}
+	_, withTelemetry := flags["telemetry"]
+	_, clone := flags["clone"]
+	_, skipTelemetry := flags["skip-telemetry"]
+
+	db, err := store.OpenNXDDB()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "❌ banco NXD: %v\n", err)
+		return 1
+	}
+	defer db.Close()
+	if store.Driver() != "postgres" {
+		fmt.Fprintln(os.Stderr, "❌ backup de fábrica exige Postgres (NXD_DATABASE_URL)")
+		return 1
+	}
+	// Banco legado: contas de login do dono entram no backup e são criadas no restore.
+	if err := api.InitDB(); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠️  banco legado indisponível (%v): contas de login não serão copiadas\n", err)
+	}
+	ctx := context.Background()
+
+	switch pos[0] {
+	case "backup":
+		if len(pos) != 3 {
+			fmt.Fprint(os.Stderr, factoryUsage)
+			return 2
+		}
+		factoryID, err := uuid.Parse(pos[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "factory-id inválido: %q\n", pos[1])
+			return 2
+		}
+		f, err := os.Create(pos[2])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 1
+		}
+		sum, err := store.WriteFactoryBackup(ctx, db, store.GetArchiveStorage(), factoryID, withTelemetry, f)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			os.Remove(pos[2])
+			fmt.Fprintf(os.Stderr, "❌ backup: %v\n", err)
+			return 1
+		}
+		fmt.Printf("✓ backup de %s gravado em %s\n", factoryID, pos[2])
+		for k, v := range sum.Counts {
+			fmt.Printf("  %-16s %d\n", k, v)
+		}
+	case "restore":
+		if len(pos) != 2 {
+			fmt.Fprint(os.Stderr, factoryUsage)
+			return 2
+		}
+		f, err := os.Open(pos[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %v\n", err)
+			return 1
+		}
+		defer f.Close()
+		res, err := store.RestoreFactoryBackup(ctx, db, f, store.RestoreOptions{
+			Clone:         clone,
+			FactoryName:   flags["name"],
+			OwnerEmail:    flags["owner"],
+			SkipTelemetry: skipTelemetry,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ restore: %v\n", err)
+			return 1
+		}
+		res.IDMap = nil
+		out, _ := json.MarshalIndent(res, "", "  ")
+		fmt.Println(string(out))
+	default:
+		fmt.Fprint(os.Stderr, factoryUsage)
+		return 2
+	}
+	return 0
+}
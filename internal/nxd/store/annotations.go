@@ -0,0 +1,232 @@
+package store
+
+// annotations.go — Anotações na linha do tempo (diário do operador)
+//
+// assets.annotations é um JSONB livre por ativo, sem tempo. Aqui cada anotação é
+// uma intervenção conhecida com data: instante (ends_at nil) ou intervalo, autor,
+// categoria e texto, no escopo de um ativo, de um setor ou da fábrica inteira.
+//
+// Consultas por ativo trazem também as anotações do setor do ativo e as da
+// fábrica (uma troca de lote no setor afeta o gráfico da máquina); por setor,
+// as do setor, dos seus ativos e as da fábrica. Uma anotação entra no período
+// quando começa antes do fim e termina (ou acontece) depois do início.
+//
+// Usadas nos gráficos (telemetria), na passagem de turno (shift_report.go) e no
+// contexto do chat IA, para que as explicações considerem o que foi feito na linha.
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/google/uuid"
+)
+
+// ErrInvalidAnnotation envolve erros de validação de anotações.
+var ErrInvalidAnnotation = errors.New("anotação inválida")
+
+const annotationMaxText = 2000
+
+// AnnotationCategories — categorias aceitas.
+var AnnotationCategories = []string{"setup", "material", "maintenance", "quality", "process", "other"}
+
+// AnnotationRow — anotação na linha do tempo.
+type AnnotationRow struct {
+	ID         uuid.UUID  `json:"id"`
+	Scope      string     `json:"scope"` // asset | sector | factory
+	SectorID   *uuid.UUID `json:"sector_id,omitempty"`
+	SectorName string     `json:"sector_name,omitempty"`
+	AssetID    *uuid.UUID `json:"asset_id,omitempty"`
+	AssetName  string     `json:"asset_name,omitempty"`
+	StartsAt   time.Time  `json:"starts_at"`
+	EndsAt     *time.Time `json:"ends_at,omitempty"`
+	Category   string     `json:"category"`
+	Text       string     `json:"text"`
+	AuthorID   *int64     `json:"author_id,omitempty"`
+	AuthorName string     `json:"author_name,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+}
+
+// AnnotationQuery filtra por sobreposição com [Start, End) e escopo (ver cabeçalho).
+type AnnotationQuery struct {
+	FactoryID  uuid.UUID
+	SectorID   *uuid.UUID
+	AssetID    *uuid.UUID
+	Category   string
+	Start, End time.Time
+	Limit      int
+}
+
+// validateAnnotationFields confere categoria, texto, datas e escopo (sem banco).
+func validateAnnotationFields(in *AnnotationRow) error {
+	in.Category = strings.ToLower(strings.TrimSpace(in.Category))
+	in.Text = strings.TrimSpace(in.Text)
+	valid := false
+	for _, c := range AnnotationCategories {
+		valid = valid || c == in.Category
+	}
+	if !valid {
+		return fmt.Errorf("%w: category deve ser uma de %s", ErrInvalidAnnotation, strings.Join(AnnotationCategories, ", "))
+	}
+	if in.Text == "" {
+		return fmt.Errorf("%w: text é obrigatório", ErrInvalidAnnotation)
+	}
+	if utf8.RuneCountInString(in.Text) > annotationMaxText {
+		return fmt.Errorf("%w: text com mais de %d caracteres", ErrInvalidAnnotation, annotationMaxText)
+	}
+	if in.StartsAt.IsZero() {
+		return fmt.Errorf("%w: starts_at é obrigatório", ErrInvalidAnnotation)
+	}
+	if in.EndsAt != nil && in.EndsAt.Before(in.StartsAt) {
+		return fmt.Errorf("%w: ends_at anterior a starts_at", ErrInvalidAnnotation)
+	}
+	if in.AssetID != nil && in.SectorID != nil {
+		return fmt.Errorf("%w: informe asset_id ou sector_id, não ambos", ErrInvalidAnnotation)
+	}
+	return nil
+}
+
+// validateAnnotation valida os campos e se ativo/setor são da fábrica.
+func validateAnnotation(db *sql.DB, factoryID uuid.UUID, in *AnnotationRow) error {
+	if err := validateAnnotationFields(in); err != nil {
+		return err
+	}
+	if in.AssetID != nil {
+		if a, err := GetAssetByID(db, *in.AssetID, factoryID); err != nil {
+			return err
+		} else if a == nil {
+			return fmt.Errorf("%w: ativo não encontrado", ErrInvalidAnnotation)
+		}
+	}
+	if in.SectorID != nil {
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM nxd.sectors WHERE id = $1 AND factory_id = $2`, *in.SectorID, factoryID).Scan(&n); err != nil {
+			return err
+		}
+		if n == 0 {
+			return fmt.Errorf("%w: setor não encontrado", ErrInvalidAnnotation)
+		}
+	}
+	return nil
+}
+
+// CreateAnnotation grava uma anotação; authorName é o nome do usuário no momento.
+func CreateAnnotation(db *sql.DB, factoryID uuid.UUID, in AnnotationRow, authorID int64, authorName string) (uuid.UUID, error) {
+	if err := validateAnnotation(db, factoryID, &in); err != nil {
+		return uuid.Nil, err
+	}
+	var id uuid.UUID
+	err := db.QueryRow(`
+		INSERT INTO nxd.annotations (factory_id, sector_id, asset_id, starts_at, ends_at, category, text, author_id, author_name)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''))
+		RETURNING id
+	`, factoryID, in.SectorID, in.AssetID, in.StartsAt, in.EndsAt, in.Category, in.Text, authorID, strings.TrimSpace(authorName)).Scan(&id)
+	return id, err
+}
+
+// UpdateAnnotation substitui escopo, datas, categoria e texto (o autor é mantido).
+// Retorna false se não existir.
+func UpdateAnnotation(db *sql.DB, factoryID uuid.UUID, in AnnotationRow) (bool, error) {
+	if err := validateAnnotation(db, factoryID, &in); err != nil {
+		return false, err
+	}
+	res, err := db.Exec(`
+		UPDATE nxd.annotations SET sector_id = $3, asset_id = $4, starts_at = $5, ends_at = $6, category = $7, text = $8,
+			updated_at = NOW()
+		WHERE id = $1 AND factory_id = $2
+	`, in.ID, factoryID, in.SectorID, in.AssetID, in.StartsAt, in.EndsAt, in.Category, in.Text)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// DeleteAnnotation remove a anotação. Retorna false se não existir.
+func DeleteAnnotation(db *sql.DB, factoryID, id uuid.UUID) (bool, error) {
+	res, err := db.Exec(`DELETE FROM nxd.annotations WHERE id = $1 AND factory_id = $2`, id, factoryID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ListAnnotations retorna as anotações que se sobrepõem ao período, em ordem cronológica.
+func ListAnnotations(db *sql.DB, q AnnotationQuery) ([]AnnotationRow, error) {
+	query := `
+		SELECT n.id, n.sector_id, COALESCE(s.name, ''), n.asset_id, COALESCE(a.display_name, a.source_tag_id, ''),
+			n.starts_at, n.ends_at, n.category, n.text, n.author_id, COALESCE(n.author_name, ''), n.created_at, n.updated_at
+		FROM nxd.annotations n
+		LEFT JOIN nxd.sectors s ON s.id = n.sector_id
+		LEFT JOIN nxd.assets a ON a.id = n.asset_id
+		WHERE n.factory_id = $1 AND n.starts_at < $3 AND COALESCE(n.ends_at, n.starts_at) >= $2`
+	args := []interface{}{q.FactoryID, q.Start, q.End}
+	if q.AssetID != nil {
+		args = append(args, *q.AssetID)
+		k := len(args)
+		query += fmt.Sprintf(` AND (n.asset_id = $%d OR (n.asset_id IS NULL AND (n.sector_id IS NULL
+			OR n.sector_id = (SELECT group_id FROM nxd.assets WHERE id = $%d))))`, k, k)
+	} else if q.SectorID != nil {
+		args = append(args, *q.SectorID)
+		k := len(args)
+		query += fmt.Sprintf(` AND (n.sector_id = $%d OR a.group_id = $%d OR (n.sector_id IS NULL AND n.asset_id IS NULL))`, k, k)
+	}
+	if q.Category != "" {
+		args = append(args, q.Category)
+		query += fmt.Sprintf(" AND n.category = $%d", len(args))
+	}
+	query += ` ORDER BY n.starts_at, n.id`
+	if q.Limit > 0 {
+		args = append(args, q.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []AnnotationRow{}
+	for rows.Next() {
+		var n AnnotationRow
+		var sectorID, assetID uuid.NullUUID
+		var endsAt sql.NullTime
+		var authorID sql.NullInt64
+		if err := rows.Scan(&n.ID, &sectorID, &n.SectorName, &assetID, &n.AssetName, &n.StartsAt, &endsAt, &n.Category,
+			&n.Text, &authorID, &n.AuthorName, &n.CreatedAt, &n.UpdatedAt); err != nil {
+			return nil, err
+		}
+		n.Scope = "factory"
+		if sectorID.Valid {
+			n.SectorID, n.Scope = &sectorID.UUID, "sector"
+		}
+		if assetID.Valid {
+			n.AssetID, n.Scope = &assetID.UUID, "asset"
+		}
+		n.EndsAt = nullTimePtr(endsAt)
+		if authorID.Valid {
+			n.AuthorID = &authorID.Int64
+		}
+		list = append(list, n)
+	}
+	return list, rows.Err()
+}
+
+// annotationsIn filtra as anotações que se sobrepõem a [start, end) (mesma regra de ListAnnotations).
+func annotationsIn(list []AnnotationRow, start, end time.Time) []AnnotationRow {
+	out := []AnnotationRow{}
+	for _, n := range list {
+		last := n.StartsAt
+		if n.EndsAt != nil {
+			last = *n.EndsAt
+		}
+		if n.StartsAt.Before(end) && !last.Before(start) {
+			out = append(out, n)
+		}
+	}
+	return out
+}
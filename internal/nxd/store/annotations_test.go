@@ -0,0 +1,57 @@
+package store
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestValidateAnnotationFields(t *testing.T) {
+	at := time.Date(2026, 3, 10, 10, 32, 0, 0, time.UTC)
+	in := AnnotationRow{Category: " Setup ", Text: "  troca de molde ", StartsAt: at}
+	if err := validateAnnotationFields(&in); err != nil {
+		t.Fatalf("valid annotation rejected: %v", err)
+	}
+	if in.Category != "setup" || in.Text != "troca de molde" {
+		t.Errorf("not normalized: %+v", in)
+	}
+
+	before := at.Add(-time.Minute)
+	id := uuid.New()
+	cases := map[string]AnnotationRow{
+		"category":   {Category: "mold", Text: "x", StartsAt: at},
+		"empty text": {Category: "other", Text: "  ", StartsAt: at},
+		"long text":  {Category: "other", Text: strings.Repeat("á", annotationMaxText+1), StartsAt: at},
+		"no start":   {Category: "other", Text: "x"},
+		"range":      {Category: "other", Text: "x", StartsAt: at, EndsAt: &before},
+		"two scopes": {Category: "other", Text: "x", StartsAt: at, AssetID: &id, SectorID: &id},
+	}
+	for name, c := range cases {
+		if err := validateAnnotationFields(&c); !errors.Is(err, ErrInvalidAnnotation) {
+			t.Errorf("%s: err = %v", name, err)
+		}
+	}
+}
+
+func TestAnnotationsInOverlap(t *testing.T) {
+	t0 := time.Date(2026, 3, 10, 6, 0, 0, 0, time.UTC)
+	end := t0.Add(8 * time.Hour)
+	rangeEnd := t0.Add(time.Hour)
+	list := []AnnotationRow{
+		{Text: "antes", StartsAt: t0.Add(-time.Hour)},
+		{Text: "lote", StartsAt: t0.Add(-2 * time.Hour), EndsAt: &rangeEnd},
+		{Text: "início", StartsAt: t0},
+		{Text: "molde", StartsAt: t0.Add(4*time.Hour + 32*time.Minute)},
+		{Text: "fim", StartsAt: end},
+	}
+	got := annotationsIn(list, t0, end)
+	if len(got) != 3 || got[0].Text != "lote" || got[1].Text != "início" || got[2].Text != "molde" {
+		t.Errorf("annotationsIn = %+v", got)
+	}
+	if got := annotationsIn(nil, t0, end); got == nil || len(got) != 0 {
+		t.Errorf("empty list must encode as [], got %#v", got)
+	}
+}
@@ -0,0 +1,620 @@
+package store
+
+// archive.go — Arquivamento de telemetria fria (nxd.telemetry_log → .csv.gz)
+//
+// Dias UTC fechados e mais antigos que a janela de retenção
+// (NXD_TELEMETRY_RETENTION_DAYS) são exportados por fábrica para arquivos CSV
+// comprimidos com gzip num ArchiveStorage (diretório local por padrão,
+// NXD_ARCHIVE_DIR; outro backend via SetArchiveStorage). O manifesto fica em
+// nxd.telemetry_archives e as linhas exportadas saem do Postgres.
+//
+// Consistência: export e DELETE rodam na mesma transação REPEATABLE READ, então
+// só as linhas vistas pelo export são apagadas; linhas que chegarem depois para
+// o mesmo dia (import histórico) viram a parte seguinte numa próxima execução.
+//
+// Leitura: QueryTelemetryRange junta telemetry_log com os arquivos do manifesto
+// que cobrem o intervalo pedido — quem consulta não precisa saber onde está o dado.
+// OEE, financeiro, paradas, confiabilidade, metas e benchmark leem telemetry_log
+// direto; por isso a retenção nunca é menor que TelemetryMinRetentionDays.
+
+import (
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ─── Armazenamento ──────────────────────────────────────────────────────────
+
+// ArchiveStorage é onde ficam os arquivos. As chaves usam "/" como separador.
+// Um backend de object storage (GCS, S3) só precisa destas três chamadas.
+type ArchiveStorage interface {
+	Put(ctx context.Context, key string, r io.Reader) (int64, error)
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// LocalArchiveStorage guarda os arquivos num diretório local (ou montado).
+type LocalArchiveStorage struct {
+	Dir string
+}
+
+func (s LocalArchiveStorage) path(key string) (string, error) {
+	clean := filepath.Clean(filepath.FromSlash(key))
+	if filepath.IsAbs(clean) || strings.HasPrefix(clean, "..") {
+		return "", fmt.Errorf("archive key inválida: %q", key)
+	}
+	return filepath.Join(s.Dir, clean), nil
+}
+
+func (s LocalArchiveStorage) Put(_ context.Context, key string, r io.Reader) (int64, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return 0, err
+	}
+	tmp := p + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(f, r)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return n, err
+	}
+	return n, os.Rename(tmp, p)
+}
+
+func (s LocalArchiveStorage) Open(_ context.Context, key string) (io.ReadCloser, error) {
+	p, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+func (s LocalArchiveStorage) Delete(_ context.Context, key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+var (
+	archiveStorageMu sync.RWMutex
+	archiveStorage   ArchiveStorage
+)
+
+// SetArchiveStorage troca o backend dos arquivos (ex.: um bucket de object storage).
+func SetArchiveStorage(s ArchiveStorage) {
+	archiveStorageMu.Lock()
+	archiveStorage = s
+	archiveStorageMu.Unlock()
+}
+
+// GetArchiveStorage retorna o backend configurado; o padrão é o diretório local
+// de NXD_ARCHIVE_DIR (./archive se vazio).
+func GetArchiveStorage() ArchiveStorage {
+	archiveStorageMu.RLock()
+	s := archiveStorage
+	archiveStorageMu.RUnlock()
+	if s != nil {
+		return s
+	}
+	dir := os.Getenv("NXD_ARCHIVE_DIR")
+	if dir == "" {
+		dir = "./archive"
+	}
+	return LocalArchiveStorage{Dir: dir}
+}
+
+// TelemetryMinRetentionDays é a menor retenção aceita: as análises que leem
+// telemetry_log direto aceitam períodos de até 366 dias e os comparam com o
+// período anterior de mesma duração.
+const TelemetryMinRetentionDays = 2 * 366
+
+// ErrRetentionTooShort — retenção menor que a janela mais longa das análises.
+var ErrRetentionTooShort = errors.New("retenção de telemetria menor que a janela das análises")
+
+// TelemetryRetention retorna a janela de dados quentes (NXD_TELEMETRY_RETENTION_DAYS).
+// 0 = arquivamento desligado (tudo fica em telemetry_log), inclusive quando o
+// valor configurado é menor que TelemetryMinRetentionDays.
+func TelemetryRetention() time.Duration {
+	d, _ := telemetryRetentionConfig()
+	return d
+}
+
+func telemetryRetentionConfig() (time.Duration, error) {
+	days, err := strconv.Atoi(os.Getenv("NXD_TELEMETRY_RETENTION_DAYS"))
+	if err != nil || days <= 0 {
+		return 0, nil
+	}
+	if days < TelemetryMinRetentionDays {
+		return 0, fmt.Errorf("%w: NXD_TELEMETRY_RETENTION_DAYS=%d (mínimo %d)", ErrRetentionTooShort, days, TelemetryMinRetentionDays)
+	}
+	return time.Duration(days) * 24 * time.Hour, nil
+}
+
+// ─── Manifesto ──────────────────────────────────────────────────────────────
+
+// TelemetryArchiveRow é um arquivo de nxd.telemetry_archives.
+type TelemetryArchiveRow struct {
+	ID          uuid.UUID  `json:"id"`
+	FactoryID   uuid.UUID  `json:"factory_id"`
+	PeriodStart time.Time  `json:"period_start"`
+	PeriodEnd   time.Time  `json:"period_end"`
+	Part        int        `json:"part"`
+	Format      string     `json:"format"`
+	ObjectKey   string     `json:"object_key"`
+	RowCount    int64      `json:"row_count"`
+	SizeBytes   int64      `json:"size_bytes"`
+	SHA256      string     `json:"sha256,omitempty"`
+	Status      string     `json:"status"`
+	Error       string     `json:"error_message,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+}
+
+// ListTelemetryArchives retorna as linhas do manifesto da fábrica que cruzam
+// [from, to). from/to zero = sem limite. onlyDone filtra status = 'done'.
+func ListTelemetryArchives(db *sql.DB, factoryID uuid.UUID, from, to time.Time, onlyDone bool) ([]TelemetryArchiveRow, error) {
+	if to.IsZero() {
+		to = time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC)
+	}
+	q := `
+		SELECT id, factory_id, period_start, period_end, part, format, object_key,
+		       row_count, size_bytes, sha256, status, error_message, created_at, finished_at
+		FROM nxd.telemetry_archives
+		WHERE factory_id = $1 AND period_end > $2 AND period_start < $3`
+	if onlyDone {
+		q += ` AND status = 'done'`
+	}
+	q += ` ORDER BY period_start, part`
+	rows, err := db.Query(q, factoryID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []TelemetryArchiveRow
+	for rows.Next() {
+		var a TelemetryArchiveRow
+		var sha, errMsg sql.NullString
+		var finished sql.NullTime
+		if err := rows.Scan(&a.ID, &a.FactoryID, &a.PeriodStart, &a.PeriodEnd, &a.Part, &a.Format, &a.ObjectKey,
+			&a.RowCount, &a.SizeBytes, &sha, &a.Status, &errMsg, &a.CreatedAt, &finished); err != nil {
+			return nil, err
+		}
+		a.SHA256 = sha.String
+		a.Error = errMsg.String
+		if finished.Valid {
+			a.FinishedAt = &finished.Time
+		}
+		list = append(list, a)
+	}
+	return list, rows.Err()
+}
+
+// ─── Arquivador ─────────────────────────────────────────────────────────────
+
+const (
+	archiveLockKey        = 7_424_001 // pg_try_advisory_lock: um arquivador por vez entre instâncias
+	archiveDaysPerRun     = 50
+	archiveWorkerInterval = time.Hour
+)
+
+var archiveCSVHeader = []string{"ts", "asset_id", "metric_key", "metric_value", "status", "correlation_id", "raw"}
+
+// ArchiveClosedRanges exporta cada dia UTC fechado anterior a cutoff (opcionalmente
+// de uma só fábrica) e apaga de telemetry_log as linhas exportadas. Retorna o
+// número de arquivos gravados; se outra instância já está arquivando, retorna 0
+// sem erro. Um cutoff mais recente que TelemetryMinRetentionDays é recusado com
+// ErrRetentionTooShort.
+func ArchiveClosedRanges(ctx context.Context, db *sql.DB, storage ArchiveStorage, cutoff time.Time, factoryID *uuid.UUID) (int, error) {
+	if cutoff.After(time.Now().AddDate(0, 0, -TelemetryMinRetentionDays)) {
+		return 0, ErrRetentionTooShort
+	}
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+	var locked bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, archiveLockKey).Scan(&locked); err != nil {
+		return 0, err
+	}
+	if !locked {
+		return 0, nil
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, archiveLockKey)
+
+	cleanupStaleArchives(ctx, db, storage)
+
+	// Só dias inteiros: o corte é truncado para 00:00 UTC.
+	cutoff = cutoff.UTC().Truncate(24 * time.Hour)
+	q := `
+		SELECT factory_id, date_trunc('day', ts AT TIME ZONE 'UTC') AS day
+		FROM nxd.telemetry_log
+		WHERE factory_id IS NOT NULL AND ts < $1`
+	args := []interface{}{cutoff}
+	if factoryID != nil {
+		q += ` AND factory_id = $2`
+		args = append(args, *factoryID)
+	}
+	q += fmt.Sprintf(` GROUP BY 1, 2 ORDER BY 2 LIMIT %d`, archiveDaysPerRun)
+
+	rows, err := db.QueryContext(ctx, q, args...)
+	if err != nil {
+		return 0, err
+	}
+	type dayKey struct {
+		factory uuid.UUID
+		day     time.Time
+	}
+	var days []dayKey
+	for rows.Next() {
+		var k dayKey
+		if err := rows.Scan(&k.factory, &k.day); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		k.day = time.Date(k.day.Year(), k.day.Month(), k.day.Day(), 0, 0, 0, 0, time.UTC)
+		days = append(days, k)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, k := range days {
+		if ctx.Err() != nil {
+			return n, ctx.Err()
+		}
+		a, err := archiveFactoryDay(ctx, db, storage, k.factory, k.day)
+		if err != nil {
+			log.Printf("⚠️  [Archiver] factory=%s day=%s: %v", k.factory, k.day.Format("2006-01-02"), err)
+			continue
+		}
+		log.Printf("✓ [Archiver] factory=%s day=%s part=%d: %d linhas → %s (%d bytes)",
+			k.factory, k.day.Format("2006-01-02"), a.Part, a.RowCount, a.ObjectKey, a.SizeBytes)
+		n++
+	}
+	return n, nil
+}
+
+// archiveFactoryDay grava uma parte de [day, day+24h) e apaga as linhas exportadas.
+func archiveFactoryDay(ctx context.Context, db *sql.DB, storage ArchiveStorage, factoryID uuid.UUID, day time.Time) (*TelemetryArchiveRow, error) {
+	end := day.Add(24 * time.Hour)
+	a := &TelemetryArchiveRow{FactoryID: factoryID, PeriodStart: day, PeriodEnd: end, Format: "csv.gz"}
+	if err := db.QueryRowContext(ctx,
+		`SELECT COALESCE(MAX(part), 0) + 1 FROM nxd.telemetry_archives WHERE factory_id = $1 AND period_start = $2`,
+		factoryID, day,
+	).Scan(&a.Part); err != nil {
+		return nil, err
+	}
+	a.ObjectKey = fmt.Sprintf("%s/%04d/%02d/telemetry_%s_p%d.csv.gz",
+		factoryID, day.Year(), int(day.Month()), day.Format("2006-01-02"), a.Part)
+	if err := db.QueryRowContext(ctx, `
+		INSERT INTO nxd.telemetry_archives (factory_id, period_start, period_end, part, format, object_key, status)
+		VALUES ($1, $2, $3, $4, $5, $6, 'running') RETURNING id`,
+		factoryID, day, end, a.Part, a.Format, a.ObjectKey,
+	).Scan(&a.ID); err != nil {
+		return nil, err
+	}
+
+	fail := func(err error) (*TelemetryArchiveRow, error) {
+		_ = storage.Delete(context.Background(), a.ObjectKey)
+		db.Exec(`UPDATE nxd.telemetry_archives SET status = 'failed', error_message = $2, finished_at = NOW() WHERE id = $1`, a.ID, err.Error())
+		return nil, err
+	}
+
+	tx, err := db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelRepeatableRead})
+	if err != nil {
+		return fail(err)
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT ts, asset_id, metric_key, metric_value, status, correlation_id, raw
+		FROM nxd.telemetry_log
+		WHERE factory_id = $1 AND ts >= $2 AND ts < $3
+		ORDER BY ts`, factoryID, day, end)
+	if err != nil {
+		return fail(err)
+	}
+
+	pr, pw := io.Pipe()
+	hash := sha256.New()
+	writeErr := make(chan error, 1)
+	go func() {
+		count, err := writeArchiveCSV(io.MultiWriter(pw, hash), rows)
+		rows.Close()
+		a.RowCount = count
+		pw.CloseWithError(err)
+		writeErr <- err
+	}()
+	size, err := storage.Put(ctx, a.ObjectKey, pr)
+	pr.CloseWithError(err) // libera a goroutine de escrita se Put parou antes
+	if werr := <-writeErr; err == nil {
+		err = werr
+	}
+	if err != nil {
+		return fail(err)
+	}
+	a.SizeBytes = size
+	a.SHA256 = hex.EncodeToString(hash.Sum(nil))
+
+	res, err := tx.ExecContext(ctx,
+		`DELETE FROM nxd.telemetry_log WHERE factory_id = $1 AND ts >= $2 AND ts < $3`, factoryID, day, end)
+	if err != nil {
+		return fail(err)
+	}
+	if deleted, _ := res.RowsAffected(); deleted != a.RowCount {
+		return fail(fmt.Errorf("export com %d linhas mas DELETE afetaria %d — abortado", a.RowCount, deleted))
+	}
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE nxd.telemetry_archives
+		SET status = 'done', row_count = $2, size_bytes = $3, sha256 = $4, finished_at = NOW()
+		WHERE id = $1`, a.ID, a.RowCount, a.SizeBytes, a.SHA256); err != nil {
+		return fail(err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fail(err)
+	}
+	a.Status = "done"
+	return a, nil
+}
+
+func writeArchiveCSV(w io.Writer, rows *sql.Rows) (int64, error) {
+	gz := gzip.NewWriter(w)
+	cw := csv.NewWriter(gz)
+	if err := cw.Write(archiveCSVHeader); err != nil {
+		return 0, err
+	}
+	var count int64
+	rec := make([]string, len(archiveCSVHeader))
+	for rows.Next() {
+		var ts time.Time
+		var assetID, metricKey, status, corrID, raw sql.NullString
+		var value sql.NullFloat64
+		if err := rows.Scan(&ts, &assetID, &metricKey, &value, &status, &corrID, &raw); err != nil {
+			return count, err
+		}
+		rec[0] = ts.UTC().Format(time.RFC3339Nano)
+		rec[1] = assetID.String
+		rec[2] = metricKey.String
+		rec[3] = ""
+		if value.Valid {
+			rec[3] = strconv.FormatFloat(value.Float64, 'g', -1, 64)
+		}
+		rec[4] = status.String
+		rec[5] = corrID.String
+		rec[6] = raw.String
+		if err := cw.Write(rec); err != nil {
+			return count, err
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, err
+	}
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		return count, err
+	}
+	return count, gz.Close()
+}
+
+// cleanupStaleArchives remove partes 'running' deixadas por uma execução que caiu
+// (as linhas de telemetria não foram apagadas: a transação não fez commit).
+func cleanupStaleArchives(ctx context.Context, db *sql.DB, storage ArchiveStorage) {
+	rows, err := db.QueryContext(ctx, `
+		DELETE FROM nxd.telemetry_archives
+		WHERE status IN ('running', 'failed') AND created_at < NOW() - INTERVAL '1 hour'
+		RETURNING object_key`)
+	if err != nil {
+		log.Printf("⚠️  [Archiver] cleanup: %v", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key string
+		if rows.Scan(&key) == nil {
+			_ = storage.Delete(ctx, key)
+		}
+	}
+}
+
+// RunArchiveWorker arquiva a telemetria fria de hora em hora enquanto houver retenção configurada.
+func RunArchiveWorker(ctx context.Context, db *sql.DB) {
+	retention, err := telemetryRetentionConfig()
+	if err != nil {
+		log.Printf("⚠️  [Archiver] %v — arquivamento desativado.", err)
+		return
+	}
+	if retention <= 0 {
+		log.Println("ℹ️  [Archiver] NXD_TELEMETRY_RETENTION_DAYS não definido — arquivamento desativado.")
+		return
+	}
+	log.Printf("✓ [Archiver] Worker de arquivamento iniciado (retenção: %s)", retention)
+	ticker := time.NewTicker(archiveWorkerInterval)
+	defer ticker.Stop()
+	for {
+		if _, err := ArchiveClosedRanges(ctx, db, GetArchiveStorage(), time.Now().Add(-retention), nil); err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("⚠️  [Archiver] %v", err)
+		}
+		select {
+		case <-ctx.Done():
+			log.Println("⏹  [Archiver] Shutdown signal received, worker stopping.")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ─── Leitura transparente ───────────────────────────────────────────────────
+
+// TelemetryPoint é uma leitura retornada por QueryTelemetryRange.
+type TelemetryPoint struct {
+	Ts          time.Time `json:"ts"`
+	AssetID     uuid.UUID `json:"asset_id"`
+	MetricKey   string    `json:"metric_key"`
+	MetricValue float64   `json:"metric_value"`
+	Status      string    `json:"status,omitempty"`
+	Source      string    `json:"source"` // "live" | "archive"
+}
+
+// TelemetryRangeQuery filtra QueryTelemetryRange. AssetID e MetricKey são opcionais.
+type TelemetryRangeQuery struct {
+	FactoryID uuid.UUID
+	AssetID   *uuid.UUID
+	MetricKey string
+	From, To  time.Time
+	Limit     int
+}
+
+// QueryTelemetryRange retorna as leituras de [From, To) de telemetry_log e, nos
+// dias já arquivados, dos arquivos. Ordenadas por ts; truncated = true quando
+// Limit cortou o resultado.
+func QueryTelemetryRange(ctx context.Context, db *sql.DB, storage ArchiveStorage, q TelemetryRangeQuery) (points []TelemetryPoint, truncated bool, err error) {
+	if q.Limit <= 0 {
+		q.Limit = 10000
+	}
+	archives, err := ListTelemetryArchives(db, q.FactoryID, q.From, q.To, true)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, a := range archives {
+		pts, err := readArchivePoints(ctx, storage, a, q)
+		if err != nil {
+			return nil, false, fmt.Errorf("arquivo %s: %w", a.ObjectKey, err)
+		}
+		points = append(points, pts...)
+		if len(points) > q.Limit {
+			break
+		}
+	}
+
+	sqlq := `
+		SELECT ts, asset_id, metric_key, metric_value, COALESCE(status, '')
+		FROM nxd.telemetry_log
+		WHERE factory_id = $1 AND ts >= $2 AND ts < $3
+		  AND asset_id IS NOT NULL AND metric_key IS NOT NULL AND metric_value IS NOT NULL`
+	args := []interface{}{q.FactoryID, q.From, q.To}
+	if q.AssetID != nil {
+		args = append(args, *q.AssetID)
+		sqlq += fmt.Sprintf(` AND asset_id = $%d`, len(args))
+	}
+	if q.MetricKey != "" {
+		args = append(args, q.MetricKey)
+		sqlq += fmt.Sprintf(` AND metric_key = $%d`, len(args))
+	}
+	sqlq += fmt.Sprintf(` ORDER BY ts LIMIT %d`, q.Limit+1)
+	rows, err := db.QueryContext(ctx, sqlq, args...)
+	if err != nil {
+		return nil, false, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		p := TelemetryPoint{Source: "live"}
+		if err := rows.Scan(&p.Ts, &p.AssetID, &p.MetricKey, &p.MetricValue, &p.Status); err != nil {
+			return nil, false, err
+		}
+		points = append(points, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+
+	sort.SliceStable(points, func(i, j int) bool { return points[i].Ts.Before(points[j].Ts) })
+	if len(points) > q.Limit {
+		points = points[:q.Limit]
+		truncated = true
+	}
+	return points, truncated, nil
+}
+
+func readArchivePoints(ctx context.Context, storage ArchiveStorage, a TelemetryArchiveRow, q TelemetryRangeQuery) ([]TelemetryPoint, error) {
+	var out []TelemetryPoint
+	err := forEachArchiveRecord(ctx, storage, a.ObjectKey, func(rec []string) bool {
+		if rec[1] == "" || rec[2] == "" || rec[3] == "" {
+			return true
+		}
+		if q.MetricKey != "" && rec[2] != q.MetricKey {
+			return true
+		}
+		assetID, err := uuid.Parse(rec[1])
+		if err != nil || (q.AssetID != nil && assetID != *q.AssetID) {
+			return true
+		}
+		ts, err := time.Parse(time.RFC3339Nano, rec[0])
+		if err != nil || ts.Before(q.From) || !ts.Before(q.To) {
+			return true
+		}
+		v, err := strconv.ParseFloat(rec[3], 64)
+		if err != nil {
+			return true
+		}
+		out = append(out, TelemetryPoint{Ts: ts, AssetID: assetID, MetricKey: rec[2], MetricValue: v, Status: rec[4], Source: "archive"})
+		return len(out) <= q.Limit
+	})
+	return out, err
+}
+
+// forEachArchiveRecord percorre os registros CSV de um arquivo sem carregá-lo
+// (cabeçalho pulado; colunas como em archiveCSVHeader). fn retorna false para parar.
+func forEachArchiveRecord(ctx context.Context, storage ArchiveStorage, key string, fn func(rec []string) bool) error {
+	f, err := storage.Open(ctx, key)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	cr := csv.NewReader(gz)
+	cr.FieldsPerRecord = len(archiveCSVHeader)
+	cr.ReuseRecord = true
+	if _, err := cr.Read(); err != nil { // cabeçalho
+		return err
+	}
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !fn(rec) {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestArchiveCSVRoundTrip writes rows with writeArchiveCSV and reads them back
+// through LocalArchiveStorage + readArchivePoints with filters applied.
+func TestArchiveCSVRoundTrip(t *testing.T) {
+	db := openSQLiteMemory(t)
+	if _, err := db.Exec(`CREATE TABLE tl (ts DATETIME, asset_id TEXT, metric_key TEXT, metric_value REAL, status TEXT, correlation_id TEXT, raw TEXT)`); err != nil {
+		t.Fatal(err)
+	}
+	day := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	a1, a2 := uuid.New(), uuid.New()
+	ins := `INSERT INTO tl VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	db.Exec(ins, day.Add(time.Hour), a1.String(), "temp", 21.5, "OK", "c1", `{"v":1}`)
+	db.Exec(ins, day.Add(2*time.Hour), a1.String(), "pecas_ok", 100.0, "", "", "")
+	db.Exec(ins, day.Add(3*time.Hour), a2.String(), "temp", 30.0, "", "", "")
+	db.Exec(ins, day.Add(4*time.Hour), a1.String(), "temp", nil, "", "", "")
+
+	rows, err := db.Query(`SELECT ts, asset_id, metric_key, metric_value, status, correlation_id, raw FROM tl ORDER BY ts`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	n, err := writeArchiveCSV(&buf, rows)
+	rows.Close()
+	if err != nil || n != 4 {
+		t.Fatalf("writeArchiveCSV = %d, %v", n, err)
+	}
+
+	st := LocalArchiveStorage{Dir: t.TempDir()}
+	ctx := context.Background()
+	if _, err := st.Put(ctx, "f/2024/03/x.csv.gz", &buf); err != nil {
+		t.Fatal(err)
+	}
+	arch := TelemetryArchiveRow{ObjectKey: "f/2024/03/x.csv.gz"}
+	q := TelemetryRangeQuery{AssetID: &a1, MetricKey: "temp", From: day, To: day.Add(24 * time.Hour), Limit: 100}
+	pts, err := readArchivePoints(ctx, st, arch, q)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pts) != 1 || pts[0].MetricValue != 21.5 || pts[0].Source != "archive" || !pts[0].Ts.Equal(day.Add(time.Hour)) {
+		t.Fatalf("points = %+v", pts)
+	}
+
+	if _, err := st.Put(ctx, "../escape", &buf); err == nil {
+		t.Error("keys outside the archive dir must be rejected")
+	}
+}
+
+// TestTelemetryRetentionMinimum: a retention shorter than the analytics window
+// would delete rows that OEE/financial still read from telemetry_log.
+func TestTelemetryRetentionMinimum(t *testing.T) {
+	t.Setenv("NXD_TELEMETRY_RETENTION_DAYS", "90")
+	if d, err := telemetryRetentionConfig(); d != 0 || !errors.Is(err, ErrRetentionTooShort) {
+		t.Errorf("90 days = %v, %v; want refused", d, err)
+	}
+	t.Setenv("NXD_TELEMETRY_RETENTION_DAYS", "800")
+	if d := TelemetryRetention(); d != 800*24*time.Hour {
+		t.Errorf("800 days = %v", d)
+	}
+	if _, err := ArchiveClosedRanges(context.Background(), nil, nil, time.Now().AddDate(0, 0, -30), nil); !errors.Is(err, ErrRetentionTooShort) {
+		t.Errorf("recent cutoff accepted: %v", err)
+	}
+}
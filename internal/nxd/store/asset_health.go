@@ -0,0 +1,891 @@
+package store
+
+// asset_health.go — Score de saúde por ativo (manutenção preditiva)
+//
+// O score parte de 100 e perde pontos por quatro fatores, cada um com
+// penalidade de 0 a 1 (1 = atinge o limite "cheio" do modelo):
+//
+//   anomalies  → buckets horários das tags monitoradas fora da faixa robusta da
+//                linha de base (|x − mediana| > healthAnomalyZ · 1.4826 · MAD) nos
+//                últimos 7 dias, mais os alertas do ativo, por dia;
+//                penalidade = por dia / anomaly_full_per_day
+//   trend      → deslocamento da média dos últimos 7 dias em relação aos 28 dias
+//                anteriores, em desvios da linha de base, no sentido da degradação
+//                da tag (up = subir é ruim); vale a pior tag; penalidade = z / trend_full_z
+//   stops      → paradas (downtime_events + tag_alarm, ver reliability.go) por 24 h
+//                disponíveis nos últimos 7 dias; penalidade = por dia / stops_full_per_day
+//   run_hours  → horas rodando (tag_status) desde a última manutenção; penalidade =
+//                horas / intervalo (next_interval_h da manutenção ou o padrão do modelo)
+//
+// Contribuição do fator = 100 · peso · penalidade / soma dos pesos dos fatores
+// disponíveis: um fator sem dados (sem tag monitorada, sem tag_status, sem
+// manutenção registrada) sai da conta e aparece em missing, em vez de contar
+// como saudável. Score = 100 − soma das contribuições; sem nenhum fator = sem score.
+//
+// Versões: healthAlgorithm identifica as fórmulas acima; health_models guarda
+// os pesos e limites de cada fábrica (toda alteração cria uma versão nova). O
+// worker grava o score de hora em hora em asset_health com a versão usada e os
+// fatores — o histórico explica cada valor mesmo depois de o modelo mudar. As
+// horas rodando são acumuladas a partir do registro anterior.
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	healthAlgorithm      = "hs1"
+	healthWorkerInterval = time.Hour
+	healthRecentWindow   = 7 * 24 * time.Hour
+	healthBaselineWindow = 28 * 24 * time.Hour
+	healthAnomalyZ       = 3.5
+	// healthMinBaseline / healthMinRecent: buckets horários mínimos para usar a tag.
+	healthMinBaseline = 48
+	healthMinRecent   = 12
+	healthRetention   = 400 * 24 * time.Hour
+)
+
+var (
+	// ErrInvalidHealth envolve erros de validação do modelo e das tags monitoradas.
+	ErrInvalidHealth = errors.New("configuração de saúde inválida")
+	// ErrInvalidMaintenance envolve erros de validação de manutenções.
+	ErrInvalidMaintenance = errors.New("manutenção inválida")
+)
+
+// HealthModel — pesos e limites do score. Version 0 = padrão (fábrica sem modelo salvo).
+type HealthModel struct {
+	Version              int        `json:"version"`
+	WAnomalies           float64    `json:"w_anomalies"`
+	WTrend               float64    `json:"w_trend"`
+	WStops               float64    `json:"w_stops"`
+	WRunHours            float64    `json:"w_run_hours"`
+	AnomalyFullPerDay    float64    `json:"anomaly_full_per_day"`
+	TrendFullZ           float64    `json:"trend_full_z"`
+	StopsFullPerDay      float64    `json:"stops_full_per_day"`
+	MaintenanceIntervalH float64    `json:"maintenance_interval_h"`
+	Notes                string     `json:"notes,omitempty"`
+	CreatedAt            *time.Time `json:"created_at,omitempty"`
+}
+
+// DefaultHealthModel — usado enquanto a fábrica não salva um modelo.
+var DefaultHealthModel = HealthModel{
+	WAnomalies: 25, WTrend: 30, WStops: 25, WRunHours: 20,
+	AnomalyFullPerDay: 4, TrendFullZ: 3, StopsFullPerDay: 6, MaintenanceIntervalH: 500,
+}
+
+// HealthTagRow — tag monitorada; AssetID nil = todos os ativos da fábrica.
+type HealthTagRow struct {
+	ID        uuid.UUID  `json:"id"`
+	AssetID   *uuid.UUID `json:"asset_id"`
+	MetricKey string     `json:"metric_key"`
+	Direction string     `json:"direction"` // up | down | both
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// MaintenanceEventRow — manutenção realizada.
+type MaintenanceEventRow struct {
+	ID            uuid.UUID `json:"id"`
+	AssetID       uuid.UUID `json:"asset_id"`
+	AssetName     string    `json:"asset_name,omitempty"`
+	PerformedAt   time.Time `json:"performed_at"`
+	Kind          string    `json:"kind"` // preventive | corrective
+	Description   string    `json:"description,omitempty"`
+	NextIntervalH *float64  `json:"next_interval_h,omitempty"`
+	CreatedBy     *int64    `json:"created_by,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+}
+
+// HealthFactor — um fator do score e quanto ele tirou.
+type HealthFactor struct {
+	Factor       string   `json:"factor"` // anomalies | trend | stops | run_hours
+	Weight       float64  `json:"weight"`
+	Value        *float64 `json:"value"` // medida bruta, na unidade de Unit
+	Unit         string   `json:"unit"`
+	Penalty      *float64 `json:"penalty"`      // 0..1
+	Contribution float64  `json:"contribution"` // pontos descontados do score
+	Detail       string   `json:"detail,omitempty"`
+	Missing      string   `json:"missing,omitempty"`
+}
+
+// AssetHealthRow — score de um ativo em um instante.
+type AssetHealthRow struct {
+	ID            *uuid.UUID     `json:"id,omitempty"`
+	AssetID       uuid.UUID      `json:"asset_id"`
+	AssetName     string         `json:"asset_name"`
+	SectorID      *uuid.UUID     `json:"sector_id,omitempty"`
+	ComputedAt    time.Time      `json:"computed_at"`
+	Score         *float64       `json:"score"`
+	Status        string         `json:"status"` // bom | atencao | critico | sem_dados
+	Algorithm     string         `json:"algorithm"`
+	ModelVersion  int            `json:"model_version"`
+	Factors       []HealthFactor `json:"factors"`
+	RunHours      *float64       `json:"run_hours,omitempty"` // desde a última manutenção
+	MaintenanceAt *time.Time     `json:"maintenance_at,omitempty"`
+
+	runS *float64 // acumulado gravado em asset_health.run_s
+}
+
+// ─── Cálculo (funções puras) ────────────────────────────────────────────────
+
+func clamp01(v float64) float64 {
+	return math.Max(0, math.Min(1, v))
+}
+
+// healthStatus classifica o score.
+func healthStatus(score *float64) string {
+	switch {
+	case score == nil:
+		return "sem_dados"
+	case *score >= 80:
+		return "bom"
+	case *score >= 60:
+		return "atencao"
+	}
+	return "critico"
+}
+
+// combineHealth preenche as contribuições e retorna o score (nil sem fatores disponíveis).
+func combineHealth(factors []HealthFactor) *float64 {
+	var wsum float64
+	for _, f := range factors {
+		if f.Penalty != nil {
+			wsum += f.Weight
+		}
+	}
+	if wsum <= 0 {
+		return nil
+	}
+	score := 100.0
+	for i := range factors {
+		if p := factors[i].Penalty; p != nil {
+			factors[i].Contribution = math.Round(100*factors[i].Weight**p/wsum*10) / 10
+			score -= 100 * factors[i].Weight * *p / wsum
+		}
+	}
+	score = math.Round(score*10) / 10
+	return &score
+}
+
+// healthScale — escala robusta mínima (série constante não gera z infinito).
+func healthScale(scale, center float64) float64 {
+	return math.Max(scale, math.Max(0.01*math.Abs(center), 1e-9))
+}
+
+// directed aplica o sentido da degradação a um desvio (positivo = pior).
+func directed(z float64, direction string) float64 {
+	switch direction {
+	case "down":
+		return -z
+	case "both":
+		return math.Abs(z)
+	}
+	return z
+}
+
+func presentValues(vs []*float64) []float64 {
+	out := make([]float64, 0, len(vs))
+	for _, v := range vs {
+		if v != nil {
+			out = append(out, *v)
+		}
+	}
+	return out
+}
+
+func medianOf(xs []float64) float64 {
+	s := append([]float64(nil), xs...)
+	sort.Float64s(s)
+	n := len(s)
+	if n%2 == 1 {
+		return s[n/2]
+	}
+	return (s[n/2-1] + s[n/2]) / 2
+}
+
+// tagHealth — desvio da média recente e anomalias de uma tag.
+type tagHealth struct {
+	z         float64 // deslocamento da média recente, no sentido da degradação
+	anomalies int
+	baseMean  float64
+	recMean   float64
+}
+
+// evalHealthTag compara os buckets recentes com a linha de base. false = dados insuficientes.
+func evalHealthTag(base, recent []*float64, direction string) (tagHealth, bool) {
+	b, r := presentValues(base), presentValues(recent)
+	if len(b) < healthMinBaseline || len(r) < healthMinRecent {
+		return tagHealth{}, false
+	}
+	var th tagHealth
+	for _, v := range b {
+		th.baseMean += v
+	}
+	th.baseMean /= float64(len(b))
+	var ss float64
+	for _, v := range b {
+		ss += (v - th.baseMean) * (v - th.baseMean)
+	}
+	sd := healthScale(math.Sqrt(ss/float64(len(b)-1)), th.baseMean)
+	for _, v := range r {
+		th.recMean += v
+	}
+	th.recMean /= float64(len(r))
+	th.z = directed((th.recMean-th.baseMean)/sd, direction)
+
+	med := medianOf(b)
+	dev := make([]float64, len(b))
+	for i, v := range b {
+		dev[i] = math.Abs(v - med)
+	}
+	mad := healthScale(1.4826*medianOf(dev), med)
+	for _, v := range r {
+		if directed((v-med)/mad, direction) > healthAnomalyZ {
+			th.anomalies++
+		}
+	}
+	return th, true
+}
+
+// ─── Modelo (versões) ───────────────────────────────────────────────────────
+
+const healthModelColumns = `version, w_anomalies, w_trend, w_stops, w_run_hours, anomaly_full_per_day, trend_full_z,
+	stops_full_per_day, maintenance_interval_h, COALESCE(notes, ''), created_at`
+
+func scanHealthModel(sc interface{ Scan(...interface{}) error }) (HealthModel, error) {
+	var m HealthModel
+	var created time.Time
+	err := sc.Scan(&m.Version, &m.WAnomalies, &m.WTrend, &m.WStops, &m.WRunHours, &m.AnomalyFullPerDay, &m.TrendFullZ,
+		&m.StopsFullPerDay, &m.MaintenanceIntervalH, &m.Notes, &created)
+	m.CreatedAt = &created
+	return m, err
+}
+
+// GetHealthModel retorna a versão atual do modelo da fábrica (DefaultHealthModel se não houver).
+func GetHealthModel(db *sql.DB, factoryID uuid.UUID) (HealthModel, error) {
+	m, err := scanHealthModel(db.QueryRow(`SELECT `+healthModelColumns+`
+		FROM nxd.health_models WHERE factory_id = $1 ORDER BY version DESC LIMIT 1`, factoryID))
+	if err == sql.ErrNoRows {
+		return DefaultHealthModel, nil
+	}
+	return m, err
+}
+
+// ListHealthModels retorna todas as versões, da mais recente para a mais antiga.
+func ListHealthModels(db *sql.DB, factoryID uuid.UUID) ([]HealthModel, error) {
+	rows, err := db.Query(`SELECT `+healthModelColumns+`
+		FROM nxd.health_models WHERE factory_id = $1 ORDER BY version DESC`, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []HealthModel{}
+	for rows.Next() {
+		m, err := scanHealthModel(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+func validateHealthModel(m HealthModel) error {
+	for _, w := range []float64{m.WAnomalies, m.WTrend, m.WStops, m.WRunHours} {
+		if w < 0 || math.IsNaN(w) {
+			return fmt.Errorf("%w: pesos não podem ser negativos", ErrInvalidHealth)
+		}
+	}
+	if m.WAnomalies+m.WTrend+m.WStops+m.WRunHours <= 0 {
+		return fmt.Errorf("%w: ao menos um peso deve ser positivo", ErrInvalidHealth)
+	}
+	if !(m.AnomalyFullPerDay > 0 && m.TrendFullZ > 0 && m.StopsFullPerDay > 0 && m.MaintenanceIntervalH > 0) {
+		return fmt.Errorf("%w: limites devem ser positivos", ErrInvalidHealth)
+	}
+	return nil
+}
+
+// SaveHealthModel grava uma nova versão do modelo e retorna o número dela.
+func SaveHealthModel(db *sql.DB, factoryID uuid.UUID, m HealthModel, userID int64) (int, error) {
+	if err := validateHealthModel(m); err != nil {
+		return 0, err
+	}
+	var version int
+	err := db.QueryRow(`
+		INSERT INTO nxd.health_models (factory_id, version, w_anomalies, w_trend, w_stops, w_run_hours,
+			anomaly_full_per_day, trend_full_z, stops_full_per_day, maintenance_interval_h, notes, created_by)
+		SELECT $1, COALESCE(MAX(version), 0) + 1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), $11
+		FROM nxd.health_models WHERE factory_id = $1
+		RETURNING version
+	`, factoryID, m.WAnomalies, m.WTrend, m.WStops, m.WRunHours, m.AnomalyFullPerDay, m.TrendFullZ,
+		m.StopsFullPerDay, m.MaintenanceIntervalH, strings.TrimSpace(m.Notes), userID).Scan(&version)
+	return version, err
+}
+
+// ─── Tags monitoradas ───────────────────────────────────────────────────────
+
+// ListHealthTags retorna as tags monitoradas da fábrica.
+func ListHealthTags(db *sql.DB, factoryID uuid.UUID) ([]HealthTagRow, error) {
+	rows, err := db.Query(`
+		SELECT id, asset_id, metric_key, direction, created_at FROM nxd.health_tags
+		WHERE factory_id = $1 ORDER BY asset_id NULLS FIRST, metric_key`, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []HealthTagRow{}
+	for rows.Next() {
+		var t HealthTagRow
+		var assetID uuid.NullUUID
+		if err := rows.Scan(&t.ID, &assetID, &t.MetricKey, &t.Direction, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		if assetID.Valid {
+			t.AssetID = &assetID.UUID
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+// CreateHealthTag passa a monitorar a tag (no ativo ou em todos, com AssetID nil).
+func CreateHealthTag(db *sql.DB, factoryID uuid.UUID, t HealthTagRow) (uuid.UUID, error) {
+	t.MetricKey = strings.TrimSpace(t.MetricKey)
+	if t.MetricKey == "" {
+		return uuid.Nil, fmt.Errorf("%w: metric_key é obrigatório", ErrInvalidHealth)
+	}
+	if t.Direction == "" {
+		t.Direction = "up"
+	}
+	if t.Direction != "up" && t.Direction != "down" && t.Direction != "both" {
+		return uuid.Nil, fmt.Errorf("%w: direction deve ser up, down ou both", ErrInvalidHealth)
+	}
+	if t.AssetID != nil {
+		if a, err := GetAssetByID(db, *t.AssetID, factoryID); err != nil {
+			return uuid.Nil, err
+		} else if a == nil {
+			return uuid.Nil, fmt.Errorf("%w: ativo não encontrado", ErrInvalidHealth)
+		}
+	}
+	var id uuid.UUID
+	err := db.QueryRow(`
+		INSERT INTO nxd.health_tags (factory_id, asset_id, metric_key, direction)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (factory_id, COALESCE(asset_id, '00000000-0000-0000-0000-000000000000'::uuid), metric_key)
+		DO UPDATE SET direction = EXCLUDED.direction
+		RETURNING id
+	`, factoryID, t.AssetID, t.MetricKey, t.Direction).Scan(&id)
+	return id, err
+}
+
+// DeleteHealthTag para de monitorar a tag. false = não encontrada.
+func DeleteHealthTag(db *sql.DB, factoryID, id uuid.UUID) (bool, error) {
+	res, err := db.Exec(`DELETE FROM nxd.health_tags WHERE id = $1 AND factory_id = $2`, id, factoryID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ─── Manutenções ────────────────────────────────────────────────────────────
+
+// ListMaintenanceEvents retorna as manutenções em [start, end), mais recentes primeiro.
+func ListMaintenanceEvents(db *sql.DB, factoryID uuid.UUID, assetID *uuid.UUID, start, end time.Time) ([]MaintenanceEventRow, error) {
+	rows, err := db.Query(`
+		SELECT m.id, m.asset_id, COALESCE(a.display_name, a.source_tag_id), m.performed_at, m.kind,
+			COALESCE(m.description, ''), m.next_interval_h, m.created_by, m.created_at
+		FROM nxd.maintenance_events m
+		JOIN nxd.assets a ON a.id = m.asset_id
+		WHERE m.factory_id = $1 AND m.performed_at >= $2 AND m.performed_at < $3 AND ($4::uuid IS NULL OR m.asset_id = $4)
+		ORDER BY m.performed_at DESC
+	`, factoryID, start, end, assetID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []MaintenanceEventRow{}
+	for rows.Next() {
+		var m MaintenanceEventRow
+		var interval sql.NullFloat64
+		var createdBy sql.NullInt64
+		if err := rows.Scan(&m.ID, &m.AssetID, &m.AssetName, &m.PerformedAt, &m.Kind, &m.Description, &interval,
+			&createdBy, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		if interval.Valid {
+			m.NextIntervalH = &interval.Float64
+		}
+		if createdBy.Valid {
+			m.CreatedBy = &createdBy.Int64
+		}
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+// CreateMaintenanceEvent registra uma manutenção (zera as horas rodando do ativo a partir de PerformedAt).
+func CreateMaintenanceEvent(db *sql.DB, factoryID uuid.UUID, m MaintenanceEventRow, userID int64, now time.Time) (uuid.UUID, error) {
+	if m.Kind == "" {
+		m.Kind = "preventive"
+	}
+	if m.Kind != "preventive" && m.Kind != "corrective" {
+		return uuid.Nil, fmt.Errorf("%w: kind deve ser preventive ou corrective", ErrInvalidMaintenance)
+	}
+	if m.PerformedAt.IsZero() || m.PerformedAt.After(now) {
+		return uuid.Nil, fmt.Errorf("%w: performed_at é obrigatório e não pode estar no futuro", ErrInvalidMaintenance)
+	}
+	if m.NextIntervalH != nil && !(*m.NextIntervalH > 0) {
+		return uuid.Nil, fmt.Errorf("%w: next_interval_h deve ser positivo", ErrInvalidMaintenance)
+	}
+	if a, err := GetAssetByID(db, m.AssetID, factoryID); err != nil {
+		return uuid.Nil, err
+	} else if a == nil {
+		return uuid.Nil, fmt.Errorf("%w: ativo não encontrado", ErrInvalidMaintenance)
+	}
+	var id uuid.UUID
+	err := db.QueryRow(`
+		INSERT INTO nxd.maintenance_events (factory_id, asset_id, performed_at, kind, description, next_interval_h, created_by)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7)
+		RETURNING id
+	`, factoryID, m.AssetID, m.PerformedAt, m.Kind, strings.TrimSpace(m.Description), m.NextIntervalH, userID).Scan(&id)
+	return id, err
+}
+
+// DeleteMaintenanceEvent remove um registro de manutenção. false = não encontrado.
+func DeleteMaintenanceEvent(db *sql.DB, factoryID, id uuid.UUID) (bool, error) {
+	res, err := db.Exec(`DELETE FROM nxd.maintenance_events WHERE id = $1 AND factory_id = $2`, id, factoryID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ─── Score ──────────────────────────────────────────────────────────────────
+
+// lastMaintenance — última manutenção do ativo e o acumulado do último registro de saúde.
+type lastMaintenance struct {
+	at         time.Time
+	intervalH  sql.NullFloat64
+	prevRunS   sql.NullFloat64 // segundos rodando no último registro de saúde...
+	prevAt     sql.NullTime    // ...e quando foi calculado
+	prevMaintT sql.NullTime    // manutenção de referência daquele registro
+}
+
+func loadMaintenanceState(db *sql.DB, factoryID uuid.UUID, now time.Time) (map[uuid.UUID]*lastMaintenance, error) {
+	rows, err := db.Query(`
+		SELECT DISTINCT ON (m.asset_id) m.asset_id, m.performed_at, m.next_interval_h, h.run_s, h.computed_at, h.maintenance_at
+		FROM nxd.maintenance_events m
+		LEFT JOIN LATERAL (
+			SELECT run_s, computed_at, maintenance_at FROM nxd.asset_health
+			WHERE asset_id = m.asset_id AND computed_at <= $2 ORDER BY computed_at DESC LIMIT 1
+		) h ON TRUE
+		WHERE m.factory_id = $1 AND m.performed_at <= $2
+		ORDER BY m.asset_id, m.performed_at DESC
+	`, factoryID, now)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[uuid.UUID]*lastMaintenance{}
+	for rows.Next() {
+		var id uuid.UUID
+		m := &lastMaintenance{}
+		if err := rows.Scan(&id, &m.at, &m.intervalH, &m.prevRunS, &m.prevAt, &m.prevMaintT); err != nil {
+			return nil, err
+		}
+		out[id] = m
+	}
+	return out, rows.Err()
+}
+
+// runSeconds acumula as horas rodando desde a manutenção, continuando do último
+// registro quando ele se refere à mesma manutenção.
+func (m *lastMaintenance) runSeconds(db *sql.DB, a *oeeAsset, now time.Time) (float64, error) {
+	from, run := m.at, 0.0
+	if m.prevRunS.Valid && m.prevAt.Valid && m.prevMaintT.Valid && m.prevMaintT.Time.Equal(m.at) && m.prevAt.Time.After(m.at) {
+		from, run = m.prevAt.Time, m.prevRunS.Float64
+	}
+	if !now.After(from) {
+		return run, nil
+	}
+	series, err := loadStatusSeries(db, a.id, a.mapping.TagStatus, from, now, a.hold)
+	if err != nil {
+		return 0, err
+	}
+	r, _ := integrateStatus(series, from, now, nil, a.hold)
+	return run + r, nil
+}
+
+// ComputeAssetHealth calcula o score dos ativos da fábrica (ou do setor/ativo) em now, sem gravar.
+func ComputeAssetHealth(db *sql.DB, factoryID uuid.UUID, sectorID, assetID *uuid.UUID, now time.Time) ([]AssetHealthRow, error) {
+	model, err := GetHealthModel(db, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	end := now.Truncate(time.Hour)
+	recentStart := end.Add(-healthRecentWindow)
+	baseStart := recentStart.Add(-healthBaselineWindow)
+	assets, err := loadOEEAssets(db, OEEQuery{FactoryID: factoryID, SectorID: sectorID, AssetID: assetID, Start: recentStart, End: end})
+	if err != nil {
+		return nil, err
+	}
+	if len(assets) == 0 {
+		return []AssetHealthRow{}, nil
+	}
+
+	// Paradas (base all: toda parada conta) nos últimos 7 dias.
+	rel, err := ComputeReliability(db, ReliabilityQuery{FactoryID: factoryID, SectorID: sectorID, AssetID: assetID,
+		Start: recentStart, End: end, Basis: "all"})
+	if err != nil {
+		return nil, fmt.Errorf("paradas: %w", err)
+	}
+	stops := map[uuid.UUID]ReliabilityResult{}
+	for _, r := range rel.Assets {
+		stops[*r.ID] = r
+	}
+
+	// Tags monitoradas: específicas do ativo valem sobre as da fábrica.
+	tags, err := ListHealthTags(db, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	type monitored struct {
+		series    *correlationCandidateSeries
+		direction string
+	}
+	perAsset := map[uuid.UUID][]monitored{}
+	var all []*correlationCandidateSeries
+	for _, a := range assets {
+		dirs := map[string]string{}
+		for _, t := range tags {
+			if t.AssetID == nil {
+				if _, ok := dirs[t.MetricKey]; !ok {
+					dirs[t.MetricKey] = t.Direction
+				}
+			} else if *t.AssetID == a.id {
+				dirs[t.MetricKey] = t.Direction
+			}
+		}
+		keys := make([]string, 0, len(dirs))
+		for k := range dirs {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			s := &correlationCandidateSeries{key: seriesKey{a.id, k}, buckets: map[int]correlationBucket{}}
+			perAsset[a.id] = append(perAsset[a.id], monitored{s, dirs[k]})
+			all = append(all, s)
+		}
+	}
+	if err := fillCorrelationBuckets(db, factoryID, all, baseStart, end, time.Hour); err != nil {
+		return nil, fmt.Errorf("tags monitoradas: %w", err)
+	}
+	nBase := int(healthBaselineWindow / time.Hour)
+	nAll := nBase + int(healthRecentWindow/time.Hour)
+
+	alerts := map[uuid.UUID]int{}
+	rows, err := db.Query(`
+		SELECT asset_id, COUNT(*) FROM nxd.alerts
+		WHERE asset_id IN (SELECT id FROM nxd.assets WHERE factory_id = $1) AND ts >= $2 AND ts < $3
+		GROUP BY asset_id
+	`, factoryID, recentStart, end)
+	if err != nil {
+		return nil, err
+	}
+	for rows.Next() {
+		var id uuid.UUID
+		var n int
+		if err := rows.Scan(&id, &n); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		alerts[id] = n
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	maint, err := loadMaintenanceState(db, factoryID, now)
+	if err != nil {
+		return nil, err
+	}
+
+	days := healthRecentWindow.Hours() / 24
+	list := make([]AssetHealthRow, 0, len(assets))
+	for _, a := range assets {
+		row := AssetHealthRow{AssetID: a.id, AssetName: a.name, SectorID: a.sectorID, ComputedAt: now,
+			Algorithm: healthAlgorithm, ModelVersion: model.Version}
+
+		// Anomalias e tendência das tags monitoradas.
+		anom := HealthFactor{Factor: "anomalies", Weight: model.WAnomalies, Unit: "por_dia"}
+		trend := HealthFactor{Factor: "trend", Weight: model.WTrend, Unit: "desvios"}
+		var used []string
+		var count int
+		worst, worstTag := math.Inf(-1), ""
+		var worstEval tagHealth
+		for _, m := range perAsset[a.id] {
+			vs := alignSeries(m.series.buckets, nAll, nil)
+			th, ok := evalHealthTag(vs[:nBase], vs[nBase:], m.direction)
+			if !ok {
+				continue
+			}
+			used = append(used, m.series.key.metric)
+			count += th.anomalies
+			if th.z > worst {
+				worst, worstTag, worstEval = th.z, m.series.key.metric, th
+			}
+		}
+		if len(used) == 0 {
+			anom.Missing = "nenhuma tag monitorada com 2 dias de linha de base e 12 h recentes"
+			trend.Missing = anom.Missing
+		} else {
+			perDay := float64(count+alerts[a.id]) / days
+			pen := clamp01(perDay / model.AnomalyFullPerDay)
+			anom.Value, anom.Penalty = &perDay, &pen
+			anom.Detail = fmt.Sprintf("%d bucket(s) horário(s) fora da faixa e %d alerta(s) em 7 dias (%s)",
+				count, alerts[a.id], strings.Join(used, ", "))
+			z := math.Round(worst*100) / 100
+			tpen := clamp01(worst / model.TrendFullZ)
+			trend.Value, trend.Penalty = &z, &tpen
+			trend.Detail = fmt.Sprintf("%s: média de 7 dias %.4g contra %.4g na linha de base de 28 dias",
+				worstTag, worstEval.recMean, worstEval.baseMean)
+		}
+
+		st := HealthFactor{Factor: "stops", Weight: model.WStops, Unit: "por_dia"}
+		if r, ok := stops[a.id]; !ok || len(r.Missing) > 0 {
+			st.Missing = "sem tag_status/tag_alarm"
+		} else if r.AvailableTimeS < 3600 {
+			st.Missing = "sem tempo disponível no calendário nos últimos 7 dias"
+		} else {
+			perDay := float64(r.Failures) / (r.AvailableTimeS / 86400)
+			pen := clamp01(perDay / model.StopsFullPerDay)
+			st.Value, st.Penalty = &perDay, &pen
+			st.Detail = fmt.Sprintf("%d parada(s) em %.0f h disponíveis", r.Failures, r.AvailableTimeS/3600)
+		}
+
+		rh := HealthFactor{Factor: "run_hours", Weight: model.WRunHours, Unit: "horas"}
+		switch m := maint[a.id]; {
+		case m == nil:
+			rh.Missing = "nenhuma manutenção registrada"
+		case a.mapping == nil || a.mapping.TagStatus == "":
+			rh.Missing = "sem tag_status"
+			row.MaintenanceAt = &m.at
+		default:
+			runS, err := m.runSeconds(db, a, now)
+			if err != nil {
+				return nil, fmt.Errorf("horas rodando %s: %w", a.id, err)
+			}
+			interval := model.MaintenanceIntervalH
+			if m.intervalH.Valid {
+				interval = m.intervalH.Float64
+			}
+			hours := math.Round(runS/3600*10) / 10
+			pen := clamp01(runS / 3600 / interval)
+			rh.Value, rh.Penalty = &hours, &pen
+			rh.Detail = fmt.Sprintf("%.1f h rodando desde %s (intervalo %.0f h)", hours, m.at.Format("2006-01-02"), interval)
+			row.RunHours, row.runS, row.MaintenanceAt = &hours, &runS, &m.at
+		}
+
+		row.Factors = []HealthFactor{anom, trend, st, rh}
+		row.Score = combineHealth(row.Factors)
+		row.Status = healthStatus(row.Score)
+		list = append(list, row)
+	}
+	return list, nil
+}
+
+// RecordAssetHealth calcula e grava o score de todos os ativos da fábrica.
+func RecordAssetHealth(db *sql.DB, factoryID uuid.UUID, now time.Time) ([]AssetHealthRow, error) {
+	list, err := ComputeAssetHealth(db, factoryID, nil, nil, now)
+	if err != nil {
+		return nil, err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+	for i := range list {
+		h := &list[i]
+		factors, err := json.Marshal(h.Factors)
+		if err != nil {
+			return nil, err
+		}
+		var id uuid.UUID
+		if err := tx.QueryRow(`
+			INSERT INTO nxd.asset_health (factory_id, asset_id, computed_at, score, status, algorithm, model_version,
+				factors, run_s, maintenance_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+			RETURNING id
+		`, factoryID, h.AssetID, h.ComputedAt, h.Score, h.Status, h.Algorithm, h.ModelVersion, factors,
+			h.runS, h.MaintenanceAt).Scan(&id); err != nil {
+			return nil, err
+		}
+		h.ID = &id
+	}
+	return list, tx.Commit()
+}
+
+// ─── Histórico ──────────────────────────────────────────────────────────────
+
+func scanAssetHealth(sc interface{ Scan(...interface{}) error }) (AssetHealthRow, error) {
+	var h AssetHealthRow
+	var id uuid.UUID
+	var sectorID uuid.NullUUID
+	var score, runS sql.NullFloat64
+	var maintAt sql.NullTime
+	var factors []byte
+	if err := sc.Scan(&id, &h.AssetID, &h.AssetName, &sectorID, &h.ComputedAt, &score, &h.Status, &h.Algorithm,
+		&h.ModelVersion, &factors, &runS, &maintAt); err != nil {
+		return h, err
+	}
+	h.ID = &id
+	if sectorID.Valid {
+		h.SectorID = &sectorID.UUID
+	}
+	if score.Valid {
+		h.Score = &score.Float64
+	}
+	if runS.Valid {
+		hours := math.Round(runS.Float64/3600*10) / 10
+		h.RunHours = &hours
+	}
+	if maintAt.Valid {
+		h.MaintenanceAt = &maintAt.Time
+	}
+	if err := json.Unmarshal(factors, &h.Factors); err != nil {
+		return h, err
+	}
+	return h, nil
+}
+
+const assetHealthColumns = `h.id, h.asset_id, COALESCE(a.display_name, a.source_tag_id), a.group_id, h.computed_at, h.score,
+	h.status, h.algorithm, h.model_version, h.factors, h.run_s, h.maintenance_at`
+
+// ListLatestAssetHealth retorna o registro mais recente de cada ativo (opcionalmente do setor), pior score primeiro.
+func ListLatestAssetHealth(db *sql.DB, factoryID uuid.UUID, sectorID *uuid.UUID) ([]AssetHealthRow, error) {
+	rows, err := db.Query(`
+		SELECT `+assetHealthColumns+`
+		FROM nxd.assets a
+		JOIN LATERAL (
+			SELECT * FROM nxd.asset_health WHERE asset_id = a.id ORDER BY computed_at DESC LIMIT 1
+		) h ON TRUE
+		WHERE a.factory_id = $1 AND ($2::uuid IS NULL OR a.group_id = $2)
+		ORDER BY h.score ASC NULLS LAST, a.display_name
+	`, factoryID, sectorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []AssetHealthRow{}
+	for rows.Next() {
+		h, err := scanAssetHealth(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, h)
+	}
+	return list, rows.Err()
+}
+
+// ListAssetHealthHistory retorna os registros de um ativo em [start, end), em ordem cronológica.
+func ListAssetHealthHistory(db *sql.DB, factoryID, assetID uuid.UUID, start, end time.Time) ([]AssetHealthRow, error) {
+	rows, err := db.Query(`
+		SELECT `+assetHealthColumns+`
+		FROM nxd.asset_health h
+		JOIN nxd.assets a ON a.id = h.asset_id
+		WHERE h.factory_id = $1 AND h.asset_id = $2 AND h.computed_at >= $3 AND h.computed_at < $4
+		ORDER BY h.computed_at
+	`, factoryID, assetID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []AssetHealthRow{}
+	for rows.Next() {
+		h, err := scanAssetHealth(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, h)
+	}
+	return list, rows.Err()
+}
+
+// ─── Worker ─────────────────────────────────────────────────────────────────
+
+// RefreshAssetHealth grava o score das fábricas ativas cujo último registro tem
+// mais de healthWorkerInterval e apaga registros além de healthRetention.
+func RefreshAssetHealth(ctx context.Context, db *sql.DB, now time.Time) (int, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT f.id FROM nxd.factories f
+		WHERE COALESCE(f.is_active, TRUE)
+			AND EXISTS (SELECT 1 FROM nxd.assets a WHERE a.factory_id = f.id)
+			AND NOT EXISTS (SELECT 1 FROM nxd.asset_health h WHERE h.factory_id = f.id AND h.computed_at > $1)
+		ORDER BY f.id
+	`, now.Add(-healthWorkerInterval+time.Minute))
+	if err != nil {
+		return 0, err
+	}
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		list, err := RecordAssetHealth(db, id, now)
+		if err != nil {
+			log.Printf("⚠️  [Health] fábrica %s: %v", id, err)
+			continue
+		}
+		total += len(list)
+	}
+	if _, err := db.ExecContext(ctx, `DELETE FROM nxd.asset_health WHERE computed_at < $1`, now.Add(-healthRetention)); err != nil {
+		return total, err
+	}
+	return total, nil
+}
+
+// RunAssetHealthWorker grava o score de saúde dos ativos a cada hora.
+func RunAssetHealthWorker(ctx context.Context, db *sql.DB) {
+	log.Println("✓ [Health] Score de saúde dos ativos iniciado (intervalo: 60m)")
+	ticker := time.NewTicker(healthWorkerInterval)
+	defer ticker.Stop()
+	for {
+		n, err := RefreshAssetHealth(ctx, db, time.Now())
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("⚠️  [Health] %v", err)
+		} else if n > 0 {
+			log.Printf("🩺 [Health] %d score(s) de saúde gravado(s)", n)
+		}
+		select {
+		case <-ctx.Done():
+			log.Println("⏹  [Health] Shutdown signal received, worker stopping.")
+			return
+		case <-ticker.C:
+		}
+	}
+}
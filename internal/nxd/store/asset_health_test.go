@@ -0,0 +1,63 @@
+package store
+
+import (
+	"math"
+	"testing"
+)
+
+func TestCombineHealth(t *testing.T) {
+	factors := []HealthFactor{
+		{Factor: "anomalies", Weight: 25, Penalty: f64(0.5)},
+		{Factor: "trend", Weight: 30, Penalty: f64(0)},
+		{Factor: "stops", Weight: 25, Penalty: f64(1)},
+		{Factor: "run_hours", Weight: 20, Missing: "nenhuma manutenção registrada"},
+	}
+	// Pesos disponíveis = 80: 100·25·0.5/80 + 100·25·1/80 = 15.625 + 31.25.
+	score := combineHealth(factors)
+	if score == nil || *score != 53.1 || healthStatus(score) != "critico" {
+		t.Fatalf("score = %v", score)
+	}
+	if factors[0].Contribution != 15.6 || factors[2].Contribution != 31.3 || factors[3].Contribution != 0 {
+		t.Errorf("contribuições = %+v", factors)
+	}
+	if s := combineHealth([]HealthFactor{{Weight: 10, Missing: "x"}}); s != nil || healthStatus(s) != "sem_dados" {
+		t.Errorf("sem fatores = %v", s)
+	}
+	if healthStatus(f64(80)) != "bom" || healthStatus(f64(60)) != "atencao" {
+		t.Errorf("faixas de status")
+	}
+}
+
+func TestEvalHealthTag(t *testing.T) {
+	base := make([]*float64, 28*24)
+	for i := range base {
+		base[i] = f64(60 + math.Sin(float64(i)*0.7))
+	}
+	recent := make([]*float64, 7*24)
+	for i := range recent {
+		recent[i] = f64(63 + math.Sin(float64(i)*0.7)) // aquecendo 3 °C
+	}
+	recent[10] = f64(90) // pico isolado
+	recent[11] = nil
+
+	up, ok := evalHealthTag(base, recent, "up")
+	if !ok || up.z < 3 || up.anomalies < 1 {
+		t.Fatalf("up = %+v", up)
+	}
+	down, _ := evalHealthTag(base, recent, "down")
+	if down.z > -3 || down.anomalies != 0 {
+		t.Errorf("down = %+v", down)
+	}
+	both, _ := evalHealthTag(base, recent, "both")
+	if math.Abs(both.z-up.z) > 1e-9 {
+		t.Errorf("both = %+v", both)
+	}
+	// Sem mudança: desvio pequeno e nenhuma anomalia.
+	if same, _ := evalHealthTag(base, base[:7*24], "both"); same.z > 0.5 || same.anomalies != 0 {
+		t.Errorf("estável = %+v", same)
+	}
+	// Linha de base curta.
+	if _, ok := evalHealthTag(base[:24], recent, "up"); ok {
+		t.Errorf("linha de base curta aceita")
+	}
+}
@@ -0,0 +1,900 @@
+package store
+
+// benchmark.go — Benchmarking de setores, ativos e fábricas
+//
+// Ranking determinístico em KPIs normalizados (independentes do tamanho):
+//
+//   oee_pct             OEE em % (oee.go)                               maior é melhor
+//   scrap_pct           NOK ÷ (OK + NOK) em %                           menor é melhor
+//   downtime_min_per_h  minutos parados por hora planejada (oee.go)     menor é melhor
+//   kwh_per_piece       kWh ÷ peça boa (energy.go)                      menor é melhor
+//   loss_per_hour       (perda de refugo + custo de parada) ÷ hora      menor é melhor
+//                       programada de ativo, na moeda da fábrica
+//
+// Níveis: "sector" e "asset" comparam dentro da fábrica; "factory" compara as
+// fábricas da mesma organização (mesmo dono, factories.user_id). Para cada KPI:
+// posição (1 = melhor; empates dividem a posição), percentil (% das outras
+// entidades que estão piores), faixa de quartil (q1 = 25% melhores … q4) e
+// variação contra o período anterior de mesma duração. Moedas diferentes não
+// entram no ranking de loss_per_hour.
+//
+// Mediana do setor industrial (opcional): fábricas com benchmark_opt_in guardam
+// um resumo diário anônimo (nxd.benchmark_snapshots, RunBenchmarkWorker); a
+// mediana e os quartis de cada KPI saem desses resumos, sem identificar ninguém,
+// e só com pelo menos benchmarkMinPeers fábricas de donos diferentes (quem controla
+// várias fábricas conta uma vez). Só quem participa vê a mediana; industry_segment,
+// se preenchido, restringe os pares a um dos BenchmarkSegments. Sair do
+// programa apaga os resumos da fábrica. O opt-in não vai no backup (é consentimento).
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	BenchmarkOEE      = "oee_pct"
+	BenchmarkScrap    = "scrap_pct"
+	BenchmarkDowntime = "downtime_min_per_h"
+	BenchmarkEnergy   = "kwh_per_piece"
+	BenchmarkLoss     = "loss_per_hour"
+
+	BenchmarkLevelSector  = "sector"
+	BenchmarkLevelAsset   = "asset"
+	BenchmarkLevelFactory = "factory"
+)
+
+// BenchmarkMetric descreve um KPI do benchmark.
+type BenchmarkMetric struct {
+	Key            string `json:"key"`
+	Label          string `json:"label"`
+	Unit           string `json:"unit"`
+	HigherIsBetter bool   `json:"higher_is_better"`
+}
+
+// BenchmarkMetrics — KPIs na ordem em que aparecem em BenchmarkEntity.KPIs.
+var BenchmarkMetrics = []BenchmarkMetric{
+	{BenchmarkOEE, "OEE", "%", true},
+	{BenchmarkScrap, "Refugo", "%", false},
+	{BenchmarkDowntime, "Parada por hora", "min/h", false},
+	{BenchmarkEnergy, "Energia por peça", "kWh/peça", false},
+	{BenchmarkLoss, "Perda por hora", "moeda/h", false},
+}
+
+const (
+	// benchmarkMinPeers — mínimo de donos distintos para publicar a mediana do setor industrial.
+	benchmarkMinPeers = 10
+	// benchmarkMinCoverage — fração mínima dos dias do período com resumo para a fábrica contar.
+	benchmarkMinCoverage = 0.5
+	// benchmarkBackfillDays — dias passados mantidos em dia pelo worker.
+	benchmarkBackfillDays = 90
+	// benchmarkDaysPerRun limita os dias calculados por fábrica a cada execução.
+	benchmarkDaysPerRun = 7
+	// benchmarkMaxFactories limita o nível "factory".
+	benchmarkMaxFactories = 50
+	// benchmarkWorkerInterval — intervalo do worker de resumos diários.
+	benchmarkWorkerInterval = time.Hour
+)
+
+// BenchmarkSegments — segmentos aceitos em industry_segment. Lista fechada: um
+// segmento novo não pode ser criado só digitando um nome (e ficar com poucos pares).
+var BenchmarkSegments = []string{
+	"alimentos e bebidas", "autopeças", "borracha e plásticos", "construção", "eletroeletrônicos",
+	"embalagens", "farmacêutico", "madeira e móveis", "metalurgia", "papel e celulose",
+	"químico", "têxtil e confecção",
+}
+
+// ErrInvalidBenchmark — nível, métrica de ordenação ou segmento inválidos.
+var ErrInvalidBenchmark = errors.New("benchmark inválido")
+
+// BenchmarkQuery — escopo do benchmark. SectorID filtra o nível "asset".
+// SortBy ordena as entidades pela posição no KPI (padrão oee_pct).
+type BenchmarkQuery struct {
+	FactoryID uuid.UUID
+	Level     string
+	SectorID  *uuid.UUID
+	Start     time.Time
+	End       time.Time
+	SortBy    string
+	Industry  bool
+}
+
+// BenchmarkKPI — valor de um KPI para uma entidade, com posição no grupo e variação.
+type BenchmarkKPI struct {
+	Metric     string   `json:"metric"`
+	Value      *float64 `json:"value"`
+	Previous   *float64 `json:"previous"`
+	Delta      *float64 `json:"delta"`
+	Improved   *bool    `json:"improved,omitempty"`
+	Rank       int      `json:"rank,omitempty"`
+	Percentile *float64 `json:"percentile,omitempty"`
+	Band       string   `json:"band,omitempty"` // q1 (25% melhores) … q4
+}
+
+// BenchmarkEntity — setor, ativo ou fábrica comparado.
+type BenchmarkEntity struct {
+	Level     string         `json:"level"`
+	ID        uuid.UUID      `json:"id"` // uuid.Nil = ativos sem setor
+	Name      string         `json:"name"`
+	SectorID  *uuid.UUID     `json:"sector_id,omitempty"`
+	FactoryID uuid.UUID      `json:"factory_id"`
+	Currency  string         `json:"currency,omitempty"`
+	KPIs      []BenchmarkKPI `json:"kpis"`
+}
+
+// BenchmarkStats — distribuição de um KPI no grupo (valores naturais, não ajustados à direção).
+type BenchmarkStats struct {
+	Metric string     `json:"metric"`
+	N      int        `json:"n"`
+	Min    *float64   `json:"min"`
+	P25    *float64   `json:"p25"`
+	Median *float64   `json:"median"`
+	P75    *float64   `json:"p75"`
+	Max    *float64   `json:"max"`
+	Best   *uuid.UUID `json:"best_id,omitempty"`
+}
+
+// BenchmarkIndustryMetric — mediana anônima de um KPI entre as fábricas participantes.
+type BenchmarkIndustryMetric struct {
+	Metric string   `json:"metric"`
+	N      int      `json:"n"`
+	P25    *float64 `json:"p25"`
+	Median *float64 `json:"median"`
+	P75    *float64 `json:"p75"`
+	Own    *float64 `json:"own"`            // valor da própria fábrica no período
+	Band   string   `json:"band,omitempty"` // posição da fábrica nos quartis do setor industrial
+}
+
+// BenchmarkIndustry — comparação com o setor industrial; Available=false explica o motivo em Reason.
+type BenchmarkIndustry struct {
+	Segment   string                    `json:"segment,omitempty"`
+	Available bool                      `json:"available"`
+	Reason    string                    `json:"reason,omitempty"`
+	Peers     int                       `json:"peers"`
+	Metrics   []BenchmarkIndustryMetric `json:"metrics,omitempty"`
+}
+
+// BenchmarkReport — resultado de ComputeBenchmark.
+type BenchmarkReport struct {
+	Level         string             `json:"level"`
+	PeriodStart   time.Time          `json:"period_start"`
+	PeriodEnd     time.Time          `json:"period_end"`
+	PreviousStart time.Time          `json:"previous_start"`
+	PreviousEnd   time.Time          `json:"previous_end"`
+	Currency      string             `json:"currency"`
+	SortBy        string             `json:"sort_by"`
+	Metrics       []BenchmarkMetric  `json:"metrics"`
+	Entities      []BenchmarkEntity  `json:"entities"`
+	Stats         []BenchmarkStats   `json:"stats"`
+	Industry      *BenchmarkIndustry `json:"industry,omitempty"`
+	Avisos        []string           `json:"avisos,omitempty"`
+}
+
+// ─── Somas e KPIs ───────────────────────────────────────────────────────────
+
+// benchmarkSums são as somas de onde saem os KPIs (somáveis entre ativos e dias).
+// oee vem pronto do oee.go (não é somável); money = há config financeira.
+type benchmarkSums struct {
+	plannedS, downS float64
+	oee             *float64
+	ok, nok, kwh    float64
+	loss, hours     float64
+	money           bool
+}
+
+func (s *benchmarkSums) add(b benchmarkSums) {
+	s.plannedS += b.plannedS
+	s.downS += b.downS
+	s.ok += b.ok
+	s.nok += b.nok
+	s.kwh += b.kwh
+	s.loss += b.loss
+	s.hours += b.hours
+	s.money = s.money || b.money
+}
+
+// kpis retorna os KPIs na ordem de BenchmarkMetrics (nil = sem dados).
+func (s benchmarkSums) kpis() []*float64 {
+	out := make([]*float64, len(BenchmarkMetrics))
+	set := func(i int, v float64) { out[i] = &v }
+	if s.oee != nil {
+		set(0, *s.oee*100)
+	}
+	if s.ok+s.nok > 0 {
+		set(1, s.nok/(s.ok+s.nok)*100)
+	}
+	if s.plannedS > 0 {
+		set(2, s.downS/s.plannedS*60)
+	}
+	if s.ok > 0 && s.kwh > 0 {
+		set(3, s.kwh/s.ok)
+	}
+	if s.money && s.hours > 0 {
+		set(4, s.loss/s.hours)
+	}
+	return out
+}
+
+// benchmarkScope — setor ou ativo com suas somas.
+type benchmarkScope struct {
+	id       uuid.UUID
+	name     string
+	sectorID *uuid.UUID
+	sums     benchmarkSums
+}
+
+// benchmarkData — somas de uma fábrica num período: total, setores e ativos.
+type benchmarkData struct {
+	currency string
+	total    benchmarkSums
+	sectors  []benchmarkScope
+	assets   []benchmarkScope
+}
+
+// buildBenchmarkData junta OEE (tempos e OEE) e financeiro (contagens, energia e perdas).
+// fin nil = sem config financeira: contagens do OEE, sem perda por hora.
+func buildBenchmarkData(rep *OEEReport, fin *FinancialAggregateResult, rows []AssetFinancialRow) *benchmarkData {
+	d := &benchmarkData{}
+	finByAsset := map[uuid.UUID]AssetFinancialRow{}
+	for _, r := range rows {
+		finByAsset[r.AssetID] = r
+	}
+	sectorIdx := map[uuid.UUID]int{}
+	for _, s := range rep.Sectors {
+		id := uuid.Nil
+		if s.ID != nil {
+			id = *s.ID
+		}
+		sectorIdx[id] = len(d.sectors)
+		d.sectors = append(d.sectors, benchmarkScope{id: id, name: s.Name, sums: benchmarkSums{oee: s.OEE}})
+	}
+	for _, a := range rep.Assets {
+		s := benchmarkSums{plannedS: a.PlannedTimeS, downS: a.DownTimeS, oee: a.OEE, ok: a.OKCount, nok: a.NOKCount}
+		if r, ok := finByAsset[*a.ID]; ok && fin != nil {
+			s.ok, s.nok, s.kwh = r.OKCount, r.NOKCount, r.EnergiaKWh
+			s.loss, s.hours, s.money = r.PerdaRefugo+r.CustoParada, r.HorasProgramadas, true
+		}
+		d.assets = append(d.assets, benchmarkScope{id: *a.ID, name: a.Name, sectorID: a.SectorID, sums: s})
+		key := uuid.Nil
+		if a.SectorID != nil {
+			key = *a.SectorID
+		}
+		if i, ok := sectorIdx[key]; ok {
+			oee := d.sectors[i].sums.oee
+			d.sectors[i].sums.add(s)
+			d.sectors[i].sums.oee = oee
+		}
+		d.total.add(s)
+	}
+	d.total.oee = rep.Total.OEE
+	if fin != nil {
+		d.currency = fin.Moeda
+		// Energia total inclui os medidores de energy.go.
+		d.total.ok, d.total.nok, d.total.kwh = fin.OKCount, fin.NOKCount, fin.EnergiaKWh
+		d.total.loss, d.total.money = fin.PerdaRefugo+fin.CustoParada, true
+	}
+	return d
+}
+
+// collectBenchmark calcula as somas da fábrica em cada período (um lote de telemetria).
+func collectBenchmark(db *sql.DB, factoryID uuid.UUID, periods []FinancialPeriod) ([]*benchmarkData, error) {
+	fins, rows, err := ComputeFinancialAggregates(db, factoryID, nil, periods)
+	if err != nil {
+		return nil, err
+	}
+	currency, err := GetFactoryCurrency(db, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]*benchmarkData, len(periods))
+	for i, p := range periods {
+		rep, err := ComputeOEE(db, OEEQuery{FactoryID: factoryID, Start: p.Start, End: p.End})
+		if err != nil {
+			return nil, err
+		}
+		out[i] = buildBenchmarkData(rep, fins[i], rows[i])
+		if out[i].currency == "" {
+			out[i].currency = currency
+		}
+	}
+	return out, nil
+}
+
+// ─── Ranking ────────────────────────────────────────────────────────────────
+
+// newBenchmarkEntity monta os KPIs com a variação contra o período anterior (prev pode ser nil).
+func newBenchmarkEntity(level string, id uuid.UUID, name string, cur benchmarkSums, prev *benchmarkSums) BenchmarkEntity {
+	e := BenchmarkEntity{Level: level, ID: id, Name: name, KPIs: make([]BenchmarkKPI, len(BenchmarkMetrics))}
+	values := cur.kpis()
+	var prevValues []*float64
+	if prev != nil {
+		prevValues = prev.kpis()
+	}
+	for i, m := range BenchmarkMetrics {
+		k := BenchmarkKPI{Metric: m.Key, Value: values[i]}
+		if prevValues != nil {
+			k.Previous = prevValues[i]
+		}
+		if k.Value != nil && k.Previous != nil {
+			d := *k.Value - *k.Previous
+			k.Delta = &d
+			if d != 0 {
+				better := (d > 0) == m.HigherIsBetter
+				k.Improved = &better
+			}
+		}
+		e.KPIs[i] = k
+	}
+	return e
+}
+
+// quantile interpola linearmente o quantil q (0..1) de valores em ordem crescente.
+func quantile(sorted []float64, q float64) float64 {
+	if len(sorted) == 1 {
+		return sorted[0]
+	}
+	pos := q * float64(len(sorted)-1)
+	lo := int(math.Floor(pos))
+	if lo >= len(sorted)-1 {
+		return sorted[len(sorted)-1]
+	}
+	return sorted[lo] + (sorted[lo+1]-sorted[lo])*(pos-float64(lo))
+}
+
+// quartileBand retorna a faixa pelo percentil (q1 = 25% melhores).
+func quartileBand(percentile float64) string {
+	switch {
+	case percentile >= 75:
+		return "q1"
+	case percentile >= 50:
+		return "q2"
+	case percentile >= 25:
+		return "q3"
+	}
+	return "q4"
+}
+
+// rankBenchmark preenche posição, percentil e faixa de cada KPI e retorna a distribuição.
+// Com uma entidade só no KPI, não há posição relativa (percentil e faixa vazios).
+func rankBenchmark(entities []BenchmarkEntity) []BenchmarkStats {
+	stats := make([]BenchmarkStats, len(BenchmarkMetrics))
+	for m, metric := range BenchmarkMetrics {
+		stats[m].Metric = metric.Key
+		var idx []int
+		for i := range entities {
+			if entities[i].KPIs[m].Value != nil {
+				idx = append(idx, i)
+			}
+		}
+		n := len(idx)
+		stats[m].N = n
+		if n == 0 {
+			continue
+		}
+		val := func(i int) float64 { return *entities[i].KPIs[m].Value }
+		better := func(a, b float64) bool {
+			if metric.HigherIsBetter {
+				return a > b
+			}
+			return a < b
+		}
+		sort.SliceStable(idx, func(a, b int) bool { return better(val(idx[a]), val(idx[b])) })
+		for pos, i := range idx {
+			k := &entities[i].KPIs[m]
+			k.Rank = pos + 1
+			if pos > 0 && val(idx[pos-1]) == val(i) {
+				k.Rank = entities[idx[pos-1]].KPIs[m].Rank
+			}
+			if n > 1 {
+				worse := 0
+				for _, j := range idx {
+					if better(val(i), val(j)) {
+						worse++
+					}
+				}
+				p := float64(worse) / float64(n-1) * 100
+				k.Percentile = &p
+				k.Band = quartileBand(p)
+			}
+		}
+		sorted := make([]float64, n)
+		for a, i := range idx {
+			sorted[a] = val(i)
+		}
+		sort.Float64s(sorted)
+		v := func(x float64) *float64 { return &x }
+		stats[m].Min, stats[m].Max = v(sorted[0]), v(sorted[n-1])
+		stats[m].P25, stats[m].Median, stats[m].P75 = v(quantile(sorted, 0.25)), v(quantile(sorted, 0.5)), v(quantile(sorted, 0.75))
+		best := entities[idx[0]].ID
+		stats[m].Best = &best
+	}
+	return stats
+}
+
+func benchmarkMetricIndex(key string) int {
+	for i, m := range BenchmarkMetrics {
+		if m.Key == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// sortBenchmarkEntities ordena pela posição no KPI m (sem valor por último, depois nome).
+func sortBenchmarkEntities(entities []BenchmarkEntity, m int) {
+	sort.SliceStable(entities, func(a, b int) bool {
+		ra, rb := entities[a].KPIs[m].Rank, entities[b].KPIs[m].Rank
+		if (ra == 0) != (rb == 0) {
+			return rb == 0
+		}
+		if ra != rb {
+			return ra < rb
+		}
+		return entities[a].Name < entities[b].Name
+	})
+}
+
+// ─── ComputeBenchmark ───────────────────────────────────────────────────────
+
+// ComputeBenchmark compara setores, ativos ou fábricas da organização no período,
+// com variação contra o período anterior de mesma duração.
+func ComputeBenchmark(db *sql.DB, q BenchmarkQuery) (*BenchmarkReport, error) {
+	if !q.Start.Before(q.End) {
+		return nil, fmt.Errorf("%w: período inválido", ErrInvalidBenchmark)
+	}
+	if q.Level == "" {
+		q.Level = BenchmarkLevelSector
+	}
+	if q.SortBy == "" {
+		q.SortBy = BenchmarkOEE
+	}
+	sortIdx := benchmarkMetricIndex(q.SortBy)
+	if sortIdx < 0 {
+		return nil, fmt.Errorf("%w: sort %q", ErrInvalidBenchmark, q.SortBy)
+	}
+	prevStart := q.Start.Add(-q.End.Sub(q.Start))
+	periods := []FinancialPeriod{{Start: q.Start, End: q.End}, {Start: prevStart, End: q.Start}}
+	rep := &BenchmarkReport{Level: q.Level, PeriodStart: q.Start, PeriodEnd: q.End, PreviousStart: prevStart,
+		PreviousEnd: q.Start, SortBy: q.SortBy, Metrics: BenchmarkMetrics, Entities: []BenchmarkEntity{}}
+
+	var own *benchmarkData
+	switch q.Level {
+	case BenchmarkLevelSector, BenchmarkLevelAsset:
+		data, err := collectBenchmark(db, q.FactoryID, periods)
+		if err != nil {
+			return nil, err
+		}
+		own = data[0]
+		rep.Currency = own.currency
+		cur, prev := data[0].sectors, data[1].sectors
+		if q.Level == BenchmarkLevelAsset {
+			cur, prev = data[0].assets, data[1].assets
+		}
+		prevByID := map[uuid.UUID]benchmarkSums{}
+		for _, s := range prev {
+			prevByID[s.id] = s.sums
+		}
+		for _, s := range cur {
+			if q.Level == BenchmarkLevelAsset && q.SectorID != nil && (s.sectorID == nil || *s.sectorID != *q.SectorID) {
+				continue
+			}
+			var p *benchmarkSums
+			if ps, ok := prevByID[s.id]; ok {
+				p = &ps
+			}
+			e := newBenchmarkEntity(q.Level, s.id, s.name, s.sums, p)
+			e.SectorID, e.FactoryID, e.Currency = s.sectorID, q.FactoryID, own.currency
+			if q.Level == BenchmarkLevelSector && s.id != uuid.Nil {
+				e.SectorID = &e.ID
+			}
+			rep.Entities = append(rep.Entities, e)
+		}
+	case BenchmarkLevelFactory:
+		factories, err := organizationFactories(db, q.FactoryID)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range factories {
+			data, err := collectBenchmark(db, f.id, periods)
+			if err != nil {
+				return nil, fmt.Errorf("fábrica %s: %w", f.name, err)
+			}
+			if f.id == q.FactoryID {
+				own = data[0]
+				rep.Currency = own.currency
+			}
+			e := newBenchmarkEntity(q.Level, f.id, f.name, data[0].total, &data[1].total)
+			e.FactoryID, e.Currency = f.id, data[0].currency
+			rep.Entities = append(rep.Entities, e)
+		}
+		// Perda por hora só compara na mesma moeda.
+		lossIdx := benchmarkMetricIndex(BenchmarkLoss)
+		for i := range rep.Entities {
+			if e := &rep.Entities[i]; e.Currency != rep.Currency && e.KPIs[lossIdx].Value != nil {
+				e.KPIs[lossIdx] = BenchmarkKPI{Metric: BenchmarkLoss}
+				rep.Avisos = append(rep.Avisos, fmt.Sprintf("%s: moeda %s diferente de %s; perda por hora fora do ranking", e.Name, e.Currency, rep.Currency))
+			}
+		}
+	default:
+		return nil, fmt.Errorf("%w: level %q (use sector, asset ou factory)", ErrInvalidBenchmark, q.Level)
+	}
+
+	rep.Stats = rankBenchmark(rep.Entities)
+	sortBenchmarkEntities(rep.Entities, sortIdx)
+	if len(rep.Entities) < 2 {
+		rep.Avisos = append(rep.Avisos, "menos de duas entidades para comparar")
+	}
+	if q.Industry {
+		ind, err := benchmarkIndustry(db, q.FactoryID, q.Start, q.End, own)
+		if err != nil {
+			return nil, err
+		}
+		rep.Industry = ind
+	}
+	return rep, nil
+}
+
+type orgFactory struct {
+	id   uuid.UUID
+	name string
+}
+
+// organizationFactories retorna as fábricas ativas do mesmo dono (a própria sempre entra).
+func organizationFactories(db *sql.DB, factoryID uuid.UUID) ([]orgFactory, error) {
+	rows, err := db.Query(`
+		SELECT f.id, f.name FROM nxd.factories f
+		WHERE f.id = $1
+		   OR (f.user_id = (SELECT user_id FROM nxd.factories WHERE id = $1) AND COALESCE(f.is_active, TRUE))
+		ORDER BY f.name, f.id
+		LIMIT $2
+	`, factoryID, benchmarkMaxFactories)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var out []orgFactory
+	for rows.Next() {
+		var f orgFactory
+		if err := rows.Scan(&f.id, &f.name); err != nil {
+			return nil, err
+		}
+		out = append(out, f)
+	}
+	return out, rows.Err()
+}
+
+// ─── Participação e resumos diários ─────────────────────────────────────────
+
+// BenchmarkSettings — participação da fábrica na mediana do setor industrial.
+type BenchmarkSettings struct {
+	OptIn        bool     `json:"opt_in"`
+	Segment      string   `json:"industry_segment"`
+	SnapshotDays int      `json:"snapshot_days"` // dias com resumo enviado
+	Segments     []string `json:"segments"`      // valores aceitos em industry_segment
+}
+
+// GetBenchmarkSettings retorna a participação da fábrica.
+func GetBenchmarkSettings(db *sql.DB, factoryID uuid.UUID) (*BenchmarkSettings, error) {
+	var s BenchmarkSettings
+	err := db.QueryRow(`
+		SELECT benchmark_opt_in, COALESCE(industry_segment, ''),
+			(SELECT COUNT(*) FROM nxd.benchmark_snapshots WHERE factory_id = f.id)
+		FROM nxd.factories f WHERE f.id = $1
+	`, factoryID).Scan(&s.OptIn, &s.Segment, &s.SnapshotDays)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	s.Segments = BenchmarkSegments
+	return &s, nil
+}
+
+// normalizeSegment padroniza o segmento (minúsculas, espaços simples) e exige um dos BenchmarkSegments.
+func normalizeSegment(s string) (string, error) {
+	s = strings.ToLower(strings.Join(strings.Fields(s), " "))
+	if s == "" || knownSegment(s) {
+		return s, nil
+	}
+	return "", fmt.Errorf("%w: industry_segment deve ser um de: %s", ErrInvalidBenchmark, strings.Join(BenchmarkSegments, ", "))
+}
+
+func knownSegment(s string) bool {
+	for _, seg := range BenchmarkSegments {
+		if s == seg {
+			return true
+		}
+	}
+	return false
+}
+
+// SetBenchmarkSettings grava a participação; ao sair, os resumos da fábrica são apagados.
+func SetBenchmarkSettings(db *sql.DB, factoryID uuid.UUID, optIn bool, segment string) error {
+	seg, err := normalizeSegment(segment)
+	if err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if _, err := tx.Exec(`UPDATE nxd.factories SET benchmark_opt_in = $1, industry_segment = NULLIF($2, ''), updated_at = NOW() WHERE id = $3`,
+		optIn, seg, factoryID); err != nil {
+		return err
+	}
+	if !optIn {
+		if _, err := tx.Exec(`DELETE FROM nxd.benchmark_snapshots WHERE factory_id = $1`, factoryID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// refreshBenchmarkFactory grava os resumos dos dias locais que faltam em
+// [hoje − benchmarkBackfillDays, ontem], no máximo benchmarkDaysPerRun (mais recentes primeiro).
+func refreshBenchmarkFactory(ctx context.Context, db *sql.DB, factoryID uuid.UUID, now time.Time) (int, error) {
+	loc, err := GetFactoryTimezone(db, factoryID)
+	if err != nil {
+		return 0, err
+	}
+	local := now.In(loc)
+	today := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+	rows, err := db.QueryContext(ctx, `SELECT day FROM nxd.benchmark_snapshots WHERE factory_id = $1 AND day >= $2`,
+		factoryID, today.AddDate(0, 0, -benchmarkBackfillDays).Format("2006-01-02"))
+	if err != nil {
+		return 0, err
+	}
+	have := map[string]bool{}
+	for rows.Next() {
+		var d time.Time
+		if err := rows.Scan(&d); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		have[d.Format("2006-01-02")] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	var periods []FinancialPeriod
+	for i := 1; i <= benchmarkBackfillDays && len(periods) < benchmarkDaysPerRun; i++ {
+		day := today.AddDate(0, 0, -i)
+		if !have[day.Format("2006-01-02")] {
+			periods = append(periods, FinancialPeriod{Start: day, End: day.AddDate(0, 0, 1)})
+		}
+	}
+	if len(periods) == 0 {
+		return 0, nil
+	}
+	data, err := collectBenchmark(db, factoryID, periods)
+	if err != nil {
+		return 0, err
+	}
+	for i, p := range periods {
+		s := data[i].total
+		var loss *float64 // nil = sem config financeira
+		if s.money {
+			loss = &s.loss
+		}
+		if _, err := db.ExecContext(ctx, `
+			INSERT INTO nxd.benchmark_snapshots (factory_id, day, planned_s, down_s, oee, ok_count, nok_count, energy_kwh,
+				loss, asset_hours, currency)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			ON CONFLICT (factory_id, day) DO NOTHING
+		`, factoryID, p.Start.Format("2006-01-02"), s.plannedS, s.downS, s.oee, s.ok, s.nok, s.kwh,
+			loss, s.hours, data[i].currency); err != nil {
+			return 0, err
+		}
+	}
+	return len(periods), nil
+}
+
+// RefreshBenchmarkSnapshots atualiza os resumos diários das fábricas participantes.
+func RefreshBenchmarkSnapshots(ctx context.Context, db *sql.DB, now time.Time) (int, error) {
+	rows, err := db.QueryContext(ctx, `SELECT id FROM nxd.factories WHERE benchmark_opt_in AND COALESCE(is_active, TRUE) ORDER BY id`)
+	if err != nil {
+		return 0, err
+	}
+	var ids []uuid.UUID
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, id := range ids {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		n, err := refreshBenchmarkFactory(ctx, db, id, now)
+		if err != nil {
+			log.Printf("⚠️  [Benchmark] fábrica %s: %v", id, err)
+			continue
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// RunBenchmarkWorker mantém os resumos diários do benchmark do setor industrial (a cada hora).
+func RunBenchmarkWorker(ctx context.Context, db *sql.DB) {
+	log.Println("✓ [Benchmark] Resumos diários do benchmark iniciados (intervalo: 60m)")
+	ticker := time.NewTicker(benchmarkWorkerInterval)
+	defer ticker.Stop()
+	for {
+		n, err := RefreshBenchmarkSnapshots(ctx, db, time.Now())
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("⚠️  [Benchmark] %v", err)
+		} else if n > 0 {
+			log.Printf("📊 [Benchmark] %d resumo(s) diário(s) gravado(s)", n)
+		}
+		select {
+		case <-ctx.Done():
+			log.Println("⏹  [Benchmark] Shutdown signal received, worker stopping.")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ─── Mediana do setor industrial ────────────────────────────────────────────
+
+// benchmarkPeer — somas de uma fábrica participante no período (anônima).
+type benchmarkPeer struct {
+	sums     benchmarkSums
+	currency string // "" = mais de uma moeda no período
+	owner    string // dono da fábrica (factories.user_id): conta uma vez no anonimato
+}
+
+// benchmarkIndustry compara a fábrica com a mediana anônima das participantes.
+func benchmarkIndustry(db *sql.DB, factoryID uuid.UUID, start, end time.Time, own *benchmarkData) (*BenchmarkIndustry, error) {
+	settings, err := GetBenchmarkSettings(db, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	ind := &BenchmarkIndustry{}
+	if settings == nil || !settings.OptIn {
+		ind.Reason = "a fábrica não participa do benchmark do setor industrial (PUT /api/benchmark/settings)"
+		return ind, nil
+	}
+	// Segmento livre gravado antes da lista fechada: compara com todos os participantes.
+	if knownSegment(settings.Segment) {
+		ind.Segment = settings.Segment
+	}
+	loc, err := GetFactoryTimezone(db, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	from := start.In(loc).Format("2006-01-02")
+	to := end.In(loc).Format("2006-01-02") // exclusivo: o dia corrente ainda não tem resumo
+	days := int(math.Round(end.Sub(start).Hours() / 24))
+	if days < 1 {
+		days = 1
+	}
+	rows, err := db.Query(`
+		SELECT SUM(s.planned_s), SUM(s.down_s),
+			SUM(s.oee * s.planned_s) FILTER (WHERE s.oee IS NOT NULL), SUM(s.planned_s) FILTER (WHERE s.oee IS NOT NULL),
+			SUM(s.ok_count), SUM(s.nok_count), SUM(s.energy_kwh), SUM(s.loss), SUM(s.asset_hours) FILTER (WHERE s.loss IS NOT NULL),
+			CASE WHEN COUNT(DISTINCT s.currency) = 1 THEN MAX(s.currency) ELSE '' END,
+			COALESCE(f.user_id::text, s.factory_id::text)
+		FROM nxd.benchmark_snapshots s
+		JOIN nxd.factories f ON f.id = s.factory_id
+		WHERE f.benchmark_opt_in AND s.day >= $1 AND s.day < $2 AND ($3 = '' OR f.industry_segment = $3)
+		GROUP BY s.factory_id, f.user_id
+		HAVING COUNT(*) >= $4
+	`, from, to, ind.Segment, int(math.Ceil(float64(days)*benchmarkMinCoverage)))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var peers []benchmarkPeer
+	for rows.Next() {
+		var p benchmarkPeer
+		var oeeW, oeeS, loss, lossHours sql.NullFloat64
+		if err := rows.Scan(&p.sums.plannedS, &p.sums.downS, &oeeW, &oeeS, &p.sums.ok, &p.sums.nok, &p.sums.kwh,
+			&loss, &lossHours, &p.currency, &p.owner); err != nil {
+			return nil, err
+		}
+		if oeeW.Valid && oeeS.Float64 > 0 {
+			v := oeeW.Float64 / oeeS.Float64
+			p.sums.oee = &v
+		}
+		if loss.Valid {
+			p.sums.loss, p.sums.hours, p.sums.money = loss.Float64, lossHours.Float64, true
+		}
+		peers = append(peers, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	currency := ""
+	var ownKPIs []*float64
+	if own != nil {
+		currency = own.currency
+		ownKPIs = own.total.kpis()
+	}
+	fillIndustry(ind, peers, ownKPIs, currency)
+	return ind, nil
+}
+
+// fillIndustry calcula quartis e mediana de cada KPI entre os pares (perda por hora só
+// na moeda da fábrica) e posiciona a fábrica; com menos de benchmarkMinPeers donos
+// distintos nada é publicado.
+func fillIndustry(ind *BenchmarkIndustry, peers []benchmarkPeer, own []*float64, currency string) {
+	ind.Peers = len(peers)
+	owners := map[string]bool{}
+	for _, p := range peers {
+		owners[p.owner] = true
+	}
+	if len(owners) < benchmarkMinPeers {
+		ind.Reason = fmt.Sprintf("menos de %d organizações participantes com dados no período", benchmarkMinPeers)
+		return
+	}
+	ind.Available = true
+	lossIdx := benchmarkMetricIndex(BenchmarkLoss)
+	values := make([][]float64, len(BenchmarkMetrics))
+	metricOwners := make([]map[string]bool, len(BenchmarkMetrics))
+	for _, p := range peers {
+		for i, v := range p.sums.kpis() {
+			if v == nil || (i == lossIdx && (p.currency == "" || p.currency != currency)) {
+				continue
+			}
+			values[i] = append(values[i], *v)
+			if metricOwners[i] == nil {
+				metricOwners[i] = map[string]bool{}
+			}
+			metricOwners[i][p.owner] = true
+		}
+	}
+	for i, m := range BenchmarkMetrics {
+		im := BenchmarkIndustryMetric{Metric: m.Key, N: len(values[i])}
+		if own != nil {
+			im.Own = own[i]
+		}
+		// Mesmo limite de anonimato por KPI.
+		if len(metricOwners[i]) >= benchmarkMinPeers {
+			sorted := values[i]
+			sort.Float64s(sorted)
+			p25, med, p75 := quantile(sorted, 0.25), quantile(sorted, 0.5), quantile(sorted, 0.75)
+			im.P25, im.Median, im.P75 = &p25, &med, &p75
+			if im.Own != nil {
+				im.Band = industryBand(*im.Own, p25, med, p75, m.HigherIsBetter)
+			}
+		}
+		ind.Metrics = append(ind.Metrics, im)
+	}
+}
+
+// industryBand posiciona o valor nos quartis (q1 = melhor que 75% dos pares).
+func industryBand(v, p25, med, p75 float64, higherIsBetter bool) string {
+	if !higherIsBetter {
+		v, p25, med, p75 = -v, -p75, -med, -p25
+	}
+	switch {
+	case v >= p75:
+		return "q1"
+	case v >= med:
+		return "q2"
+	case v >= p25:
+		return "q3"
+	}
+	return "q4"
+}
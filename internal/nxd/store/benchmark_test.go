@@ -0,0 +1,177 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestRankBenchmark(t *testing.T) {
+	v := func(x float64) *float64 { return &x }
+	entity := func(name string, oee, scrap *float64) BenchmarkEntity {
+		e := BenchmarkEntity{ID: uuid.New(), Name: name, KPIs: make([]BenchmarkKPI, len(BenchmarkMetrics))}
+		e.KPIs[0] = BenchmarkKPI{Metric: BenchmarkOEE, Value: oee}
+		e.KPIs[1] = BenchmarkKPI{Metric: BenchmarkScrap, Value: scrap}
+		return e
+	}
+	list := []BenchmarkEntity{
+		entity("A", v(60), v(2)),
+		entity("B", v(80), v(5)),
+		entity("C", v(60), v(1)),
+		entity("D", v(40), nil),
+		entity("E", nil, v(3)),
+	}
+	stats := rankBenchmark(list)
+
+	// OEE (maior é melhor): B 1º; A e C empatados em 2º; D 4º; E sem valor.
+	want := map[string]int{"A": 2, "B": 1, "C": 2, "D": 4, "E": 0}
+	for _, e := range list {
+		if e.KPIs[0].Rank != want[e.Name] {
+			t.Errorf("%s: rank OEE = %d, want %d", e.Name, e.KPIs[0].Rank, want[e.Name])
+		}
+	}
+	if p := list[0].KPIs[0].Percentile; p == nil || math.Abs(*p-100.0/3) > 1e-9 || list[0].KPIs[0].Band != "q3" {
+		t.Errorf("A percentil = %v %s", p, list[0].KPIs[0].Band)
+	}
+	if list[1].KPIs[0].Band != "q1" || list[3].KPIs[0].Band != "q4" || list[4].KPIs[0].Percentile != nil {
+		t.Errorf("faixas = %+v", list)
+	}
+	// Refugo (menor é melhor): C, A, E, B.
+	if list[2].KPIs[1].Rank != 1 || list[1].KPIs[1].Rank != 4 || *list[1].KPIs[1].Percentile != 0 {
+		t.Errorf("refugo = %+v / %+v", list[2].KPIs[1], list[1].KPIs[1])
+	}
+	s := stats[0]
+	if s.N != 4 || *s.Min != 40 || *s.Max != 80 || *s.Median != 60 || *s.P25 != 55 || *s.P75 != 65 || *s.Best != list[1].ID {
+		t.Errorf("stats OEE = %+v", s)
+	}
+	if stats[2].N != 0 || stats[2].Median != nil {
+		t.Errorf("stats sem dados = %+v", stats[2])
+	}
+
+	sortBenchmarkEntities(list, 0)
+	order := ""
+	for _, e := range list {
+		order += e.Name
+	}
+	if order != "BACDE" {
+		t.Errorf("ordem = %s", order)
+	}
+}
+
+func TestBenchmarkEntityDeltaAndData(t *testing.T) {
+	sector, other := uuid.New(), uuid.New()
+	a1, a2, a3 := uuid.New(), uuid.New(), uuid.New()
+	f := func(x float64) *float64 { return &x }
+	rep := &OEEReport{
+		Total: OEEResult{OEE: f(0.5)},
+		Sectors: []OEEResult{
+			{ID: &sector, Name: "Usinagem", OEE: f(0.6)},
+			{ID: &other, Name: "Montagem", OEE: f(0.4)},
+		},
+		Assets: []OEEResult{
+			{ID: &a1, Name: "T1", SectorID: &sector, PlannedTimeS: 3600, DownTimeS: 360, OKCount: 1, OEE: f(0.7)},
+			{ID: &a2, Name: "T2", SectorID: &sector, PlannedTimeS: 3600, DownTimeS: 0, OEE: f(0.5)},
+			{ID: &a3, Name: "M1", SectorID: &other, PlannedTimeS: 7200, DownTimeS: 1800, OKCount: 50, NOKCount: 50},
+		},
+	}
+	fin := &FinancialAggregateResult{Moeda: "BRL", OKCount: 300, NOKCount: 20, EnergiaKWh: 900, PerdaRefugo: 40, CustoParada: 200}
+	rows := []AssetFinancialRow{
+		{AssetID: a1, OKCount: 190, NOKCount: 10, EnergiaKWh: 400, PerdaRefugo: 20, CustoParada: 100, HorasProgramadas: 1},
+		{AssetID: a2, OKCount: 110, NOKCount: 10, EnergiaKWh: 200, PerdaRefugo: 20, CustoParada: 100, HorasProgramadas: 1},
+	}
+	d := buildBenchmarkData(rep, fin, rows)
+	us := d.sectors[0].sums.kpis()
+	// Usinagem: OEE do oee.go, 20/320 de refugo, 6 min parados em 2 h, 600 kWh / 300 peças, 240 / 2 h.
+	if *us[0] != 60 || *us[1] != 6.25 || *us[2] != 3 || *us[3] != 2 || *us[4] != 120 {
+		t.Errorf("Usinagem = %v %v %v %v %v", *us[0], *us[1], *us[2], *us[3], *us[4])
+	}
+	// Montagem: sem linha financeira → contagens do OEE, sem energia nem perda.
+	mt := d.sectors[1].sums.kpis()
+	if *mt[1] != 50 || *mt[2] != 15 || mt[3] != nil || mt[4] != nil {
+		t.Errorf("Montagem = %v", mt)
+	}
+	// Total: contagens e energia do financeiro (inclui medidores).
+	tot := d.total.kpis()
+	if *tot[0] != 50 || *tot[3] != 3 || *tot[4] != 120 || d.currency != "BRL" {
+		t.Errorf("total = %v", tot)
+	}
+
+	prev := d.sectors[0].sums
+	prev.downS = 0
+	prev.nok = 0
+	e := newBenchmarkEntity(BenchmarkLevelSector, sector, "Usinagem", d.sectors[0].sums, &prev)
+	if e.KPIs[2].Delta == nil || *e.KPIs[2].Delta != 3 || *e.KPIs[2].Improved || e.KPIs[0].Improved != nil {
+		t.Errorf("delta = %+v / %+v", e.KPIs[2], e.KPIs[0])
+	}
+	if e = newBenchmarkEntity(BenchmarkLevelSector, sector, "Usinagem", d.sectors[0].sums, nil); e.KPIs[0].Previous != nil {
+		t.Errorf("sem período anterior = %+v", e.KPIs[0])
+	}
+}
+
+func TestFillIndustry(t *testing.T) {
+	n := 0
+	peer := func(oee, loss float64, currency string) benchmarkPeer {
+		o := oee
+		n++
+		return benchmarkPeer{sums: benchmarkSums{oee: &o, loss: loss, hours: 1, money: true}, currency: currency,
+			owner: fmt.Sprintf("dono-%d", n)}
+	}
+	own := benchmarkSums{oee: func() *float64 { x := 0.72; return &x }(), loss: 35, hours: 1, money: true}
+
+	ind := &BenchmarkIndustry{}
+	fillIndustry(ind, []benchmarkPeer{peer(0.5, 10, "BRL"), peer(0.6, 20, "BRL")}, own.kpis(), "BRL")
+	if ind.Available || ind.Peers != 2 || ind.Metrics != nil {
+		t.Errorf("poucos pares = %+v", ind)
+	}
+
+	// 12 pares: OEE 0.30 … 0.85; perda só em BRL para os 8 primeiros.
+	var peers []benchmarkPeer
+	for i := 0; i < 12; i++ {
+		currency := "BRL"
+		if i >= 8 {
+			currency = "USD"
+		}
+		peers = append(peers, peer(0.30+0.05*float64(i), float64(10*(i+1)), currency))
+	}
+	ind = &BenchmarkIndustry{}
+	fillIndustry(ind, peers, own.kpis(), "BRL")
+	if !ind.Available || ind.Peers != 12 {
+		t.Fatalf("industry = %+v", ind)
+	}
+	o := ind.Metrics[0]
+	if o.N != 12 || math.Abs(*o.Median-57.5) > 1e-9 || o.Band != "q1" || math.Abs(*o.Own-72) > 1e-9 {
+		t.Errorf("OEE = %+v (mediana %v)", o, *o.Median)
+	}
+	// Perda por hora: só os 8 pares em BRL — abaixo do mínimo, nada publicado.
+	if l := ind.Metrics[4]; l.N != 8 || l.Median != nil || l.Band != "" {
+		t.Errorf("perda = %+v", l)
+	}
+
+	// Quem controla várias fábricas conta uma vez: 12 fábricas de 4 donos não publicam nada.
+	for i := range peers {
+		peers[i].owner = fmt.Sprintf("dono-%d", i%4)
+	}
+	ind = &BenchmarkIndustry{}
+	fillIndustry(ind, peers, own.kpis(), "BRL")
+	if ind.Available || ind.Metrics != nil {
+		t.Errorf("mesmo dono contou mais de uma vez: %+v", ind)
+	}
+	if industryBand(1, 2, 3, 4, false) != "q1" || industryBand(5, 2, 3, 4, false) != "q4" || industryBand(2.5, 2, 3, 4, true) != "q3" {
+		t.Errorf("industryBand")
+	}
+}
+
+func TestNormalizeSegment(t *testing.T) {
+	if s, err := normalizeSegment("  Papel   e Celulose "); err != nil || s != "papel e celulose" {
+		t.Errorf("known segment = %q, %v", s, err)
+	}
+	if s, err := normalizeSegment(" "); err != nil || s != "" {
+		t.Errorf("empty segment = %q, %v", s, err)
+	}
+	if _, err := normalizeSegment("minha fábrica de parafusos"); !errors.Is(err, ErrInvalidBenchmark) {
+		t.Errorf("free-text segment accepted (err = %v)", err)
+	}
+}
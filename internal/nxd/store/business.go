@@ -15,6 +15,9 @@ type BusinessConfigRow struct {
 	ValorVendaOk  float64   `json:"valor_venda_ok"`
 	CustoRefugoUn float64   `json:"custo_refugo_un"`
 	CustoParadaH  float64   `json:"custo_parada_h"`
+	CustoKwh      float64   `json:"custo_kwh"`
+	CustoMaterialUn   float64 `json:"custo_material_un"`    // material por peça produzida
+	CustoMaoObraTurno float64 `json:"custo_mao_obra_turno"` // mão de obra por turno de cada ativo
 	CreatedAt     time.Time `json:"created_at"`
 	UpdatedAt     time.Time `json:"updated_at"`
 }
@@ -26,7 +29,13 @@ type TagMappingRow struct {
 	TagOK       string   `json:"tag_ok"`
 	TagNOK      string   `json:"tag_nok"`
 	TagStatus   string   `json:"tag_status"`
-	ReadingRule string   `json:"reading_rule"` // "delta" | "absolute"
+	ReadingRule string   `json:"reading_rule"` // "delta" (contador, ver counters.go) | "absolute"
+	IdealCycleS *float64 `json:"ideal_cycle_s"` // tempo de ciclo ideal (s/peça) para o desempenho do OEE
+	TagEnergy   string   `json:"tag_energy"`    // contador de energia (kWh)
+	TagOrder    string   `json:"tag_order"`     // número da ordem de produção em execução (0 = nenhuma)
+	TagAlarm    string   `json:"tag_alarm"`     // alarme de falha (>= 0.5 = em falha), usado no MTBF/MTTR
+	TagCycle    string   `json:"tag_cycle"`     // ciclo concluído (borda de subida = 1 ciclo); vazio = ciclos pelo tag_ok/tag_nok
+	CyclePieces int      `json:"cycle_pieces"`  // peças por ciclo (cavidades do molde)
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
@@ -49,14 +58,14 @@ func getBusinessConfigRow(db *sql.DB, factoryID uuid.UUID, sectorID *uuid.UUID)
 	var err error
 	if sectorID == nil || *sectorID == uuid.Nil {
 		err = db.QueryRow(`
-			SELECT id, factory_id, sector_id, valor_venda_ok, custo_refugo_un, custo_parada_h, created_at, updated_at
+			SELECT id, factory_id, sector_id, valor_venda_ok, custo_refugo_un, custo_parada_h, custo_kwh, custo_material_un, custo_mao_obra_turno, created_at, updated_at
 			FROM nxd.business_config WHERE factory_id = $1 AND sector_id IS NULL LIMIT 1
-		`, factoryID).Scan(&r.ID, &r.FactoryID, &sectorIDNull, &r.ValorVendaOk, &r.CustoRefugoUn, &r.CustoParadaH, &r.CreatedAt, &r.UpdatedAt)
+		`, factoryID).Scan(&r.ID, &r.FactoryID, &sectorIDNull, &r.ValorVendaOk, &r.CustoRefugoUn, &r.CustoParadaH, &r.CustoKwh, &r.CustoMaterialUn, &r.CustoMaoObraTurno, &r.CreatedAt, &r.UpdatedAt)
 	} else {
 		err = db.QueryRow(`
-			SELECT id, factory_id, sector_id, valor_venda_ok, custo_refugo_un, custo_parada_h, created_at, updated_at
+			SELECT id, factory_id, sector_id, valor_venda_ok, custo_refugo_un, custo_parada_h, custo_kwh, custo_material_un, custo_mao_obra_turno, created_at, updated_at
 			FROM nxd.business_config WHERE factory_id = $1 AND sector_id = $2 LIMIT 1
-		`, factoryID, *sectorID).Scan(&r.ID, &r.FactoryID, &sectorIDNull, &r.ValorVendaOk, &r.CustoRefugoUn, &r.CustoParadaH, &r.CreatedAt, &r.UpdatedAt)
+		`, factoryID, *sectorID).Scan(&r.ID, &r.FactoryID, &sectorIDNull, &r.ValorVendaOk, &r.CustoRefugoUn, &r.CustoParadaH, &r.CustoKwh, &r.CustoMaterialUn, &r.CustoMaoObraTurno, &r.CreatedAt, &r.UpdatedAt)
 	}
 	if err == sql.ErrNoRows {
 		return nil, nil
@@ -74,7 +83,7 @@ func getBusinessConfigRow(db *sql.DB, factoryID uuid.UUID, sectorID *uuid.UUID)
 // ListBusinessConfigs retorna todas as configs da fábrica (por setor + padrão).
 func ListBusinessConfigs(db *sql.DB, factoryID uuid.UUID) ([]BusinessConfigRow, error) {
 	rows, err := db.Query(`
-		SELECT id, factory_id, sector_id, valor_venda_ok, custo_refugo_un, custo_parada_h, created_at, updated_at
+		SELECT id, factory_id, sector_id, valor_venda_ok, custo_refugo_un, custo_parada_h, custo_kwh, custo_material_un, custo_mao_obra_turno, created_at, updated_at
 		FROM nxd.business_config WHERE factory_id = $1 ORDER BY sector_id NULLS LAST
 	`, factoryID)
 	if err != nil {
@@ -85,7 +94,7 @@ func ListBusinessConfigs(db *sql.DB, factoryID uuid.UUID) ([]BusinessConfigRow,
 	for rows.Next() {
 		var r BusinessConfigRow
 		var sectorIDNull sql.NullString
-		if err := rows.Scan(&r.ID, &r.FactoryID, &sectorIDNull, &r.ValorVendaOk, &r.CustoRefugoUn, &r.CustoParadaH, &r.CreatedAt, &r.UpdatedAt); err != nil {
+		if err := rows.Scan(&r.ID, &r.FactoryID, &sectorIDNull, &r.ValorVendaOk, &r.CustoRefugoUn, &r.CustoParadaH, &r.CustoKwh, &r.CustoMaterialUn, &r.CustoMaoObraTurno, &r.CreatedAt, &r.UpdatedAt); err != nil {
 			return nil, err
 		}
 		if sectorIDNull.Valid {
@@ -99,13 +108,25 @@ func ListBusinessConfigs(db *sql.DB, factoryID uuid.UUID) ([]BusinessConfigRow,
 
 // UpsertBusinessConfig insere ou atualiza config (por factory_id + sector_id).
 // Para sector_id NULL (config padrão fábrica), usa UPDATE então INSERT por causa de UNIQUE NULLS.
-func UpsertBusinessConfig(db *sql.DB, factoryID uuid.UUID, sectorID *uuid.UUID, valorVendaOk, custoRefugoUn, custoParadaH float64) (uuid.UUID, error) {
+// custoKwh, custoMaterialUn e custoMaoObraTurno nil mantêm o valor já configurado.
+// Os valores salvos viram a versão de hoje no histórico de custos (cost_model.go).
+func UpsertBusinessConfig(db *sql.DB, factoryID uuid.UUID, sectorID *uuid.UUID, valorVendaOk, custoRefugoUn, custoParadaH float64, custoKwh, custoMaterialUn, custoMaoObraTurno *float64) (uuid.UUID, error) {
+	id, err := upsertBusinessConfig(db, factoryID, sectorID, valorVendaOk, custoRefugoUn, custoParadaH, custoKwh, custoMaterialUn, custoMaoObraTurno)
+	if err != nil {
+		return id, err
+	}
+	return id, recordBusinessConfigVersion(db, factoryID, sectorID)
+}
+
+func upsertBusinessConfig(db *sql.DB, factoryID uuid.UUID, sectorID *uuid.UUID, valorVendaOk, custoRefugoUn, custoParadaH float64, custoKwh, custoMaterialUn, custoMaoObraTurno *float64) (uuid.UUID, error) {
 	var id uuid.UUID
 	if sectorID == nil || *sectorID == uuid.Nil {
 		res, err := db.Exec(`
-			UPDATE nxd.business_config SET valor_venda_ok = $1, custo_refugo_un = $2, custo_parada_h = $3, updated_at = NOW()
+			UPDATE nxd.business_config SET valor_venda_ok = $1, custo_refugo_un = $2, custo_parada_h = $3,
+				custo_kwh = COALESCE($5, custo_kwh), custo_material_un = COALESCE($6, custo_material_un),
+				custo_mao_obra_turno = COALESCE($7, custo_mao_obra_turno), updated_at = NOW()
 			WHERE factory_id = $4 AND sector_id IS NULL
-		`, valorVendaOk, custoRefugoUn, custoParadaH, factoryID)
+		`, valorVendaOk, custoRefugoUn, custoParadaH, factoryID, custoKwh, custoMaterialUn, custoMaoObraTurno)
 		if err != nil {
 			return uuid.Nil, err
 		}
@@ -114,22 +135,27 @@ func UpsertBusinessConfig(db *sql.DB, factoryID uuid.UUID, sectorID *uuid.UUID,
 			return id, err
 		}
 		err = db.QueryRow(`
-			INSERT INTO nxd.business_config (factory_id, sector_id, valor_venda_ok, custo_refugo_un, custo_parada_h, updated_at)
-			VALUES ($1, NULL, $2, $3, $4, NOW())
+			INSERT INTO nxd.business_config (factory_id, sector_id, valor_venda_ok, custo_refugo_un, custo_parada_h, custo_kwh,
+				custo_material_un, custo_mao_obra_turno, updated_at)
+			VALUES ($1, NULL, $2, $3, $4, COALESCE($5, 0), COALESCE($6, 0), COALESCE($7, 0), NOW())
 			RETURNING id
-		`, factoryID, valorVendaOk, custoRefugoUn, custoParadaH).Scan(&id)
+		`, factoryID, valorVendaOk, custoRefugoUn, custoParadaH, custoKwh, custoMaterialUn, custoMaoObraTurno).Scan(&id)
 		return id, err
 	}
 	err := db.QueryRow(`
-		INSERT INTO nxd.business_config (factory_id, sector_id, valor_venda_ok, custo_refugo_un, custo_parada_h, updated_at)
-		VALUES ($1, $2, $3, $4, $5, NOW())
+		INSERT INTO nxd.business_config (factory_id, sector_id, valor_venda_ok, custo_refugo_un, custo_parada_h, custo_kwh,
+			custo_material_un, custo_mao_obra_turno, updated_at)
+		VALUES ($1, $2, $3, $4, $5, COALESCE($6, 0), COALESCE($7, 0), COALESCE($8, 0), NOW())
 		ON CONFLICT (factory_id, sector_id) DO UPDATE SET
 			valor_venda_ok = EXCLUDED.valor_venda_ok,
 			custo_refugo_un = EXCLUDED.custo_refugo_un,
 			custo_parada_h = EXCLUDED.custo_parada_h,
+			custo_kwh = COALESCE($6, nxd.business_config.custo_kwh),
+			custo_material_un = COALESCE($7, nxd.business_config.custo_material_un),
+			custo_mao_obra_turno = COALESCE($8, nxd.business_config.custo_mao_obra_turno),
 			updated_at = NOW()
 		RETURNING id
-	`, factoryID, *sectorID, valorVendaOk, custoRefugoUn, custoParadaH).Scan(&id)
+	`, factoryID, *sectorID, valorVendaOk, custoRefugoUn, custoParadaH, custoKwh, custoMaterialUn, custoMaoObraTurno).Scan(&id)
 	return id, err
 }
 
@@ -137,9 +163,10 @@ func UpsertBusinessConfig(db *sql.DB, factoryID uuid.UUID, sectorID *uuid.UUID,
 func GetTagMappingByAsset(db *sql.DB, assetID uuid.UUID) (*TagMappingRow, error) {
 	var r TagMappingRow
 	err := db.QueryRow(`
-		SELECT id, asset_id, COALESCE(tag_ok,''), COALESCE(tag_nok,''), COALESCE(tag_status,''), COALESCE(reading_rule,'delta'), created_at, updated_at
+		SELECT id, asset_id, COALESCE(tag_ok,''), COALESCE(tag_nok,''), COALESCE(tag_status,''), COALESCE(reading_rule,'delta'), ideal_cycle_s,
+			COALESCE(tag_energy,''), COALESCE(tag_order,''), COALESCE(tag_alarm,''), COALESCE(tag_cycle,''), cycle_pieces, created_at, updated_at
 		FROM nxd.tag_mapping WHERE asset_id = $1
-	`, assetID).Scan(&r.ID, &r.AssetID, &r.TagOK, &r.TagNOK, &r.TagStatus, &r.ReadingRule, &r.CreatedAt, &r.UpdatedAt)
+	`, assetID).Scan(&r.ID, &r.AssetID, &r.TagOK, &r.TagNOK, &r.TagStatus, &r.ReadingRule, &r.IdealCycleS, &r.TagEnergy, &r.TagOrder, &r.TagAlarm, &r.TagCycle, &r.CyclePieces, &r.CreatedAt, &r.UpdatedAt)
 	if err == sql.ErrNoRows {
 		return nil, nil
 	}
@@ -152,7 +179,8 @@ func GetTagMappingByAsset(db *sql.DB, assetID uuid.UUID) (*TagMappingRow, error)
 // ListTagMappingsByFactory retorna mapeamentos de todos os ativos da fábrica.
 func ListTagMappingsByFactory(db *sql.DB, factoryID uuid.UUID) ([]TagMappingRow, error) {
 	rows, err := db.Query(`
-		SELECT t.id, t.asset_id, COALESCE(t.tag_ok,''), COALESCE(t.tag_nok,''), COALESCE(t.tag_status,''), COALESCE(t.reading_rule,'delta'), t.created_at, t.updated_at
+		SELECT t.id, t.asset_id, COALESCE(t.tag_ok,''), COALESCE(t.tag_nok,''), COALESCE(t.tag_status,''), COALESCE(t.reading_rule,'delta'), t.ideal_cycle_s,
+			COALESCE(t.tag_energy,''), COALESCE(t.tag_order,''), COALESCE(t.tag_alarm,''), COALESCE(t.tag_cycle,''), t.cycle_pieces, t.created_at, t.updated_at
 		FROM nxd.tag_mapping t
 		JOIN nxd.assets a ON a.id = t.asset_id
 		WHERE a.factory_id = $1 ORDER BY a.display_name
@@ -164,7 +192,7 @@ func ListTagMappingsByFactory(db *sql.DB, factoryID uuid.UUID) ([]TagMappingRow,
 	var list []TagMappingRow
 	for rows.Next() {
 		var r TagMappingRow
-		if err := rows.Scan(&r.ID, &r.AssetID, &r.TagOK, &r.TagNOK, &r.TagStatus, &r.ReadingRule, &r.CreatedAt, &r.UpdatedAt); err != nil {
+		if err := rows.Scan(&r.ID, &r.AssetID, &r.TagOK, &r.TagNOK, &r.TagStatus, &r.ReadingRule, &r.IdealCycleS, &r.TagEnergy, &r.TagOrder, &r.TagAlarm, &r.TagCycle, &r.CyclePieces, &r.CreatedAt, &r.UpdatedAt); err != nil {
 			return nil, err
 		}
 		list = append(list, r)
@@ -173,22 +201,29 @@ func ListTagMappingsByFactory(db *sql.DB, factoryID uuid.UUID) ([]TagMappingRow,
 }
 
 // UpsertTagMapping insere ou atualiza mapeamento por asset_id.
-func UpsertTagMapping(db *sql.DB, assetID uuid.UUID, tagOK, tagNOK, tagStatus, readingRule string) (uuid.UUID, error) {
+// idealCycleS, tagEnergy, tagOrder, tagAlarm, tagCycle e cyclePieces nil mantêm o valor já configurado ("" limpa a tag).
+func UpsertTagMapping(db *sql.DB, assetID uuid.UUID, tagOK, tagNOK, tagStatus, readingRule string, idealCycleS *float64, tagEnergy, tagOrder, tagAlarm, tagCycle *string, cyclePieces *int) (uuid.UUID, error) {
 	if readingRule == "" {
 		readingRule = "delta"
 	}
 	var id uuid.UUID
 	err := db.QueryRow(`
-		INSERT INTO nxd.tag_mapping (asset_id, tag_ok, tag_nok, tag_status, reading_rule, updated_at)
-		VALUES ($1, $2, $3, $4, $5, NOW())
+		INSERT INTO nxd.tag_mapping (asset_id, tag_ok, tag_nok, tag_status, reading_rule, ideal_cycle_s, tag_energy, tag_order, tag_alarm, tag_cycle, cycle_pieces, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, ''), NULLIF($10, ''), COALESCE($11, 1), NOW())
 		ON CONFLICT (asset_id) DO UPDATE SET
 			tag_ok = EXCLUDED.tag_ok,
 			tag_nok = EXCLUDED.tag_nok,
 			tag_status = EXCLUDED.tag_status,
 			reading_rule = EXCLUDED.reading_rule,
+			ideal_cycle_s = COALESCE(EXCLUDED.ideal_cycle_s, nxd.tag_mapping.ideal_cycle_s),
+			tag_energy = CASE WHEN $7::text IS NULL THEN nxd.tag_mapping.tag_energy ELSE EXCLUDED.tag_energy END,
+			tag_order = CASE WHEN $8::text IS NULL THEN nxd.tag_mapping.tag_order ELSE EXCLUDED.tag_order END,
+			tag_alarm = CASE WHEN $9::text IS NULL THEN nxd.tag_mapping.tag_alarm ELSE EXCLUDED.tag_alarm END,
+			tag_cycle = CASE WHEN $10::text IS NULL THEN nxd.tag_mapping.tag_cycle ELSE EXCLUDED.tag_cycle END,
+			cycle_pieces = COALESCE($11, nxd.tag_mapping.cycle_pieces),
 			updated_at = NOW()
 		RETURNING id
-	`, assetID, ptrOrNull(tagOK), ptrOrNull(tagNOK), ptrOrNull(tagStatus), readingRule).Scan(&id)
+	`, assetID, ptrOrNull(tagOK), ptrOrNull(tagNOK), ptrOrNull(tagStatus), readingRule, idealCycleS, tagEnergy, tagOrder, tagAlarm, tagCycle, cyclePieces).Scan(&id)
 	return id, err
 }
 
@@ -0,0 +1,431 @@
+package store
+
+// calendar.go — Calendário de produção: turnos, feriados e horas extras
+//
+// O tempo programado de um setor é:
+//   (turnos do setor, ou da fábrica se o setor não tiver turnos próprios)
+//   − feriados (da fábrica e do setor) + horas extras (da fábrica e do setor)
+// Sem nenhum turno cadastrado vale 24/7 (comportamento anterior), ainda
+// descontando feriados. Turnos são definidos em horário local do fuso da
+// fábrica (nxd.factories.timezone); um turno com fim <= início atravessa a
+// meia-noite e pertence ao dia em que começa.
+//
+// OEE, horas parada do financeiro e o Pareto de paradas só contam o tempo
+// programado; fora dele a máquina parada não é perda.
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultFactoryTimezone é o fuso usado quando a fábrica não tem um válido.
+const DefaultFactoryTimezone = "America/Sao_Paulo"
+
+// ErrInvalidCalendar envolve erros de validação de turnos, exceções e fuso.
+var ErrInvalidCalendar = errors.New("calendário inválido")
+
+// ShiftRow — turno recorrente. Weekdays: 0 = domingo … 6 = sábado (dia de início).
+type ShiftRow struct {
+	ID        uuid.UUID  `json:"id"`
+	FactoryID uuid.UUID  `json:"factory_id"`
+	SectorID  *uuid.UUID `json:"sector_id,omitempty"`
+	Name      string     `json:"name"`
+	StartTime string     `json:"start_time"` // HH:MM
+	EndTime   string     `json:"end_time"`   // HH:MM
+	Weekdays  []int      `json:"weekdays"`
+	Active    bool       `json:"active"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// CalendarExceptionRow — feriado (holiday: sem produção) ou hora extra (extra).
+type CalendarExceptionRow struct {
+	ID        uuid.UUID  `json:"id"`
+	FactoryID uuid.UUID  `json:"factory_id"`
+	SectorID  *uuid.UUID `json:"sector_id,omitempty"`
+	Kind      string     `json:"kind"`
+	StartsAt  time.Time  `json:"starts_at"`
+	EndsAt    time.Time  `json:"ends_at"`
+	Name      string     `json:"name,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// ShiftInstance — uma ocorrência concreta de um turno (período de relatório por turno).
+type ShiftInstance struct {
+	ShiftID  uuid.UUID  `json:"shift_id"`
+	Name     string     `json:"name"`
+	SectorID *uuid.UUID `json:"sector_id,omitempty"`
+	Start    time.Time  `json:"start"`
+	End      time.Time  `json:"end"`
+}
+
+// ─── Conversões ─────────────────────────────────────────────────────────────
+
+// ParseClock valida "HH:MM" e retorna os minutos desde a meia-noite.
+func ParseClock(s string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("%w: horário %q (use HH:MM)", ErrInvalidCalendar, s)
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+func weekdaysToMask(days []int) (int, error) {
+	mask := 0
+	for _, d := range days {
+		if d < 0 || d > 6 {
+			return 0, fmt.Errorf("%w: dia da semana %d (0 = domingo … 6 = sábado)", ErrInvalidCalendar, d)
+		}
+		mask |= 1 << d
+	}
+	return mask, nil
+}
+
+func maskToWeekdays(mask int) []int {
+	days := []int{}
+	for d := 0; d < 7; d++ {
+		if mask&(1<<d) != 0 {
+			days = append(days, d)
+		}
+	}
+	return days
+}
+
+// ─── CRUD ───────────────────────────────────────────────────────────────────
+
+// GetFactoryTimezone retorna o fuso da fábrica (padrão DefaultFactoryTimezone).
+func GetFactoryTimezone(db *sql.DB, factoryID uuid.UUID) (*time.Location, error) {
+	var name sql.NullString
+	err := db.QueryRow(`SELECT timezone FROM nxd.factories WHERE id = $1`, factoryID).Scan(&name)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if name.Valid && name.String != "" {
+		if loc, err := time.LoadLocation(name.String); err == nil {
+			return loc, nil
+		}
+	}
+	loc, err := time.LoadLocation(DefaultFactoryTimezone)
+	if err != nil {
+		return time.UTC, nil
+	}
+	return loc, nil
+}
+
+// SetFactoryTimezone grava o fuso (nome IANA, ex.: America/Manaus).
+func SetFactoryTimezone(db *sql.DB, factoryID uuid.UUID, name string) error {
+	if _, err := time.LoadLocation(name); err != nil || name == "" {
+		return fmt.Errorf("%w: fuso horário %q", ErrInvalidCalendar, name)
+	}
+	_, err := db.Exec(`UPDATE nxd.factories SET timezone = $1, updated_at = NOW() WHERE id = $2`, name, factoryID)
+	return err
+}
+
+// ListShifts retorna os turnos da fábrica (todos os setores).
+func ListShifts(db *sql.DB, factoryID uuid.UUID) ([]ShiftRow, error) {
+	rows, err := db.Query(`
+		SELECT id, factory_id, sector_id, name, start_time, end_time, days_mask, active, created_at
+		FROM nxd.shifts WHERE factory_id = $1
+		ORDER BY sector_id NULLS FIRST, start_time, name
+	`, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []ShiftRow
+	for rows.Next() {
+		var r ShiftRow
+		var sectorID uuid.NullUUID
+		var mask int
+		if err := rows.Scan(&r.ID, &r.FactoryID, &sectorID, &r.Name, &r.StartTime, &r.EndTime, &mask, &r.Active, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		if sectorID.Valid {
+			r.SectorID = &sectorID.UUID
+		}
+		r.Weekdays = maskToWeekdays(mask)
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// validateShift normaliza horários e dias. Sem dias = segunda a sexta.
+func validateShift(r *ShiftRow) (int, error) {
+	if strings.TrimSpace(r.Name) == "" {
+		return 0, fmt.Errorf("%w: nome do turno obrigatório", ErrInvalidCalendar)
+	}
+	for _, t := range []*string{&r.StartTime, &r.EndTime} {
+		m, err := ParseClock(*t)
+		if err != nil {
+			return 0, err
+		}
+		*t = fmt.Sprintf("%02d:%02d", m/60, m%60)
+	}
+	if len(r.Weekdays) == 0 {
+		r.Weekdays = []int{1, 2, 3, 4, 5}
+	}
+	return weekdaysToMask(r.Weekdays)
+}
+
+// CreateShift insere um turno.
+func CreateShift(db *sql.DB, r ShiftRow) (uuid.UUID, error) {
+	mask, err := validateShift(&r)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	var id uuid.UUID
+	err = db.QueryRow(`
+		INSERT INTO nxd.shifts (factory_id, sector_id, name, start_time, end_time, days_mask, active)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id
+	`, r.FactoryID, r.SectorID, strings.TrimSpace(r.Name), r.StartTime, r.EndTime, mask, r.Active).Scan(&id)
+	return id, err
+}
+
+// UpdateShift substitui os campos do turno. Retorna false se não existir.
+func UpdateShift(db *sql.DB, r ShiftRow) (bool, error) {
+	mask, err := validateShift(&r)
+	if err != nil {
+		return false, err
+	}
+	res, err := db.Exec(`
+		UPDATE nxd.shifts SET name = $1, start_time = $2, end_time = $3, days_mask = $4, active = $5
+		WHERE id = $6 AND factory_id = $7
+	`, strings.TrimSpace(r.Name), r.StartTime, r.EndTime, mask, r.Active, r.ID, r.FactoryID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// DeleteShift remove um turno. Retorna false se não existir.
+func DeleteShift(db *sql.DB, factoryID, id uuid.UUID) (bool, error) {
+	res, err := db.Exec(`DELETE FROM nxd.shifts WHERE id = $1 AND factory_id = $2`, id, factoryID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ListCalendarExceptions retorna feriados/horas extras que se sobrepõem a [from, to).
+func ListCalendarExceptions(db *sql.DB, factoryID uuid.UUID, from, to time.Time) ([]CalendarExceptionRow, error) {
+	rows, err := db.Query(`
+		SELECT id, factory_id, sector_id, kind, starts_at, ends_at, COALESCE(name, ''), created_at
+		FROM nxd.calendar_exceptions
+		WHERE factory_id = $1 AND starts_at < $3 AND ends_at > $2
+		ORDER BY starts_at
+	`, factoryID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []CalendarExceptionRow
+	for rows.Next() {
+		var r CalendarExceptionRow
+		var sectorID uuid.NullUUID
+		if err := rows.Scan(&r.ID, &r.FactoryID, &sectorID, &r.Kind, &r.StartsAt, &r.EndsAt, &r.Name, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		if sectorID.Valid {
+			r.SectorID = &sectorID.UUID
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// CreateCalendarException insere um feriado ou hora extra.
+func CreateCalendarException(db *sql.DB, r CalendarExceptionRow) (uuid.UUID, error) {
+	if r.Kind != "holiday" && r.Kind != "extra" {
+		return uuid.Nil, fmt.Errorf("%w: kind deve ser holiday ou extra", ErrInvalidCalendar)
+	}
+	if !r.EndsAt.After(r.StartsAt) {
+		return uuid.Nil, fmt.Errorf("%w: ends_at deve ser posterior a starts_at", ErrInvalidCalendar)
+	}
+	var id uuid.UUID
+	err := db.QueryRow(`
+		INSERT INTO nxd.calendar_exceptions (factory_id, sector_id, kind, starts_at, ends_at, name)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
+		RETURNING id
+	`, r.FactoryID, r.SectorID, r.Kind, r.StartsAt, r.EndsAt, r.Name).Scan(&id)
+	return id, err
+}
+
+// DeleteCalendarException remove uma exceção. Retorna false se não existir.
+func DeleteCalendarException(db *sql.DB, factoryID, id uuid.UUID) (bool, error) {
+	res, err := db.Exec(`DELETE FROM nxd.calendar_exceptions WHERE id = $1 AND factory_id = $2`, id, factoryID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ─── Cálculo do tempo programado ───────────────────────────────────────────
+
+// ProductionCalendar é o calendário carregado de uma fábrica para um período.
+type ProductionCalendar struct {
+	Location   *time.Location
+	shifts     []ShiftRow // só ativos
+	exceptions []CalendarExceptionRow
+}
+
+// LoadProductionCalendar carrega fuso, turnos ativos e exceções de [from, to).
+func LoadProductionCalendar(db *sql.DB, factoryID uuid.UUID, from, to time.Time) (*ProductionCalendar, error) {
+	loc, err := GetFactoryTimezone(db, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	shifts, err := ListShifts(db, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	exceptions, err := ListCalendarExceptions(db, factoryID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	c := &ProductionCalendar{Location: loc, exceptions: exceptions}
+	for _, s := range shifts {
+		if s.Active {
+			c.shifts = append(c.shifts, s)
+		}
+	}
+	return c, nil
+}
+
+// shiftsFor retorna os turnos do setor ou, se ele não tiver, os da fábrica.
+func (c *ProductionCalendar) shiftsFor(sectorID *uuid.UUID) []ShiftRow {
+	var own, factory []ShiftRow
+	for _, s := range c.shifts {
+		switch {
+		case s.SectorID == nil:
+			factory = append(factory, s)
+		case sectorID != nil && *s.SectorID == *sectorID:
+			own = append(own, s)
+		}
+	}
+	if len(own) > 0 {
+		return own
+	}
+	return factory
+}
+
+// ShiftInstances lista as ocorrências dos turnos do setor que começam em [start, end).
+func (c *ProductionCalendar) ShiftInstances(sectorID *uuid.UUID, start, end time.Time) []ShiftInstance {
+	var out []ShiftInstance
+	for _, s := range c.shiftsFor(sectorID) {
+		for _, r := range c.expandShift(s, start.Add(-24*time.Hour), end) {
+			if r.Start.Before(start) || !r.Start.Before(end) {
+				continue
+			}
+			out = append(out, ShiftInstance{ShiftID: s.ID, Name: s.Name, SectorID: s.SectorID, Start: r.Start, End: r.End})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Start.Before(out[j].Start) })
+	return out
+}
+
+// expandShift gera as janelas do turno para os dias locais que começam em [from, to).
+func (c *ProductionCalendar) expandShift(s ShiftRow, from, to time.Time) []timeRange {
+	startMin, err1 := ParseClock(s.StartTime)
+	endMin, err2 := ParseClock(s.EndTime)
+	if err1 != nil || err2 != nil {
+		return nil
+	}
+	mask, _ := weekdaysToMask(s.Weekdays)
+	var out []timeRange
+	lf := from.In(c.Location)
+	day := time.Date(lf.Year(), lf.Month(), lf.Day(), 0, 0, 0, 0, c.Location)
+	for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+		if mask&(1<<int(day.Weekday())) == 0 {
+			continue
+		}
+		a := time.Date(day.Year(), day.Month(), day.Day(), startMin/60, startMin%60, 0, 0, c.Location)
+		b := time.Date(day.Year(), day.Month(), day.Day(), endMin/60, endMin%60, 0, 0, c.Location)
+		if !b.After(a) {
+			b = b.AddDate(0, 0, 1)
+		}
+		out = append(out, timeRange{a, b})
+	}
+	return out
+}
+
+// Scheduled retorna as janelas de produção programada do setor (nil = fábrica) em [start, end).
+func (c *ProductionCalendar) Scheduled(sectorID *uuid.UUID, start, end time.Time) []timeRange {
+	var base []timeRange
+	shifts := c.shiftsFor(sectorID)
+	if len(shifts) == 0 {
+		base = []timeRange{{start, end}}
+	} else {
+		for _, s := range shifts {
+			base = append(base, c.expandShift(s, start.Add(-24*time.Hour), end)...)
+		}
+	}
+	var holidays, extras []timeRange
+	for _, e := range c.exceptions {
+		if e.SectorID != nil && (sectorID == nil || *e.SectorID != *sectorID) {
+			continue
+		}
+		if e.Kind == "holiday" {
+			holidays = append(holidays, timeRange{e.StartsAt, e.EndsAt})
+		} else {
+			extras = append(extras, timeRange{e.StartsAt, e.EndsAt})
+		}
+	}
+	sched := subtractRanges(mergeRanges(base), mergeRanges(holidays))
+	sched = mergeRanges(append(sched, extras...))
+	return clipRanges(sched, start, end)
+}
+
+// Unscheduled é o complemento de Scheduled em [start, end) — o que não conta como perda.
+func (c *ProductionCalendar) Unscheduled(sectorID *uuid.UUID, start, end time.Time) []timeRange {
+	return subtractRanges([]timeRange{{start, end}}, c.Scheduled(sectorID, start, end))
+}
+
+// clipRanges corta intervalos já unidos para [start, end).
+func clipRanges(merged []timeRange, start, end time.Time) []timeRange {
+	var out []timeRange
+	for _, r := range merged {
+		if r.Start.Before(start) {
+			r.Start = start
+		}
+		if r.End.After(end) {
+			r.End = end
+		}
+		if r.End.After(r.Start) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// subtractRanges retorna a − b (ambos já unidos por mergeRanges).
+func subtractRanges(a, b []timeRange) []timeRange {
+	var out []timeRange
+	for _, r := range a {
+		cur := r
+		for _, x := range b {
+			if !x.End.After(cur.Start) || !x.Start.Before(cur.End) {
+				continue
+			}
+			if x.Start.After(cur.Start) {
+				out = append(out, timeRange{cur.Start, x.Start})
+			}
+			cur.Start = x.End
+			if !cur.End.After(cur.Start) {
+				break
+			}
+		}
+		if cur.End.After(cur.Start) {
+			out = append(out, cur)
+		}
+	}
+	return out
+}
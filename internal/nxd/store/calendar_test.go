@@ -0,0 +1,62 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestProductionCalendarScheduled cobre turno que atravessa a meia-noite,
+// fim de semana sem produção, feriado, hora extra e turnos próprios do setor.
+func TestProductionCalendarScheduled(t *testing.T) {
+	loc := time.FixedZone("BRT", -3*3600)
+	sector := uuid.New()
+	day := func(d, h int) time.Time { return time.Date(2024, 3, d, h, 0, 0, 0, loc) } // 2024-03-01 = sexta
+
+	cal := &ProductionCalendar{
+		Location: loc,
+		shifts: []ShiftRow{
+			{Name: "A", StartTime: "06:00", EndTime: "14:00", Weekdays: []int{1, 2, 3, 4, 5}},
+			{Name: "C", StartTime: "22:00", EndTime: "06:00", Weekdays: []int{1, 2, 3, 4, 5}},
+			{Name: "Setor", SectorID: &sector, StartTime: "08:00", EndTime: "12:00", Weekdays: []int{0, 1, 2, 3, 4, 5, 6}},
+		},
+		exceptions: []CalendarExceptionRow{
+			{Kind: "extra", StartsAt: day(2, 8), EndsAt: day(2, 12)},  // sábado
+			{Kind: "holiday", StartsAt: day(4, 0), EndsAt: day(5, 0)}, // segunda
+		},
+	}
+
+	// Sexta 00:00 → terça 00:00 (fábrica): turno C de quinta termina sexta 06:00.
+	got := cal.Scheduled(nil, day(1, 0), day(5, 0))
+	want := []timeRange{
+		{day(1, 0), day(1, 6)},  // C de quinta
+		{day(1, 6), day(1, 14)}, // A de sexta
+		{day(1, 22), day(2, 6)}, // C de sexta
+		{day(2, 8), day(2, 12)}, // hora extra de sábado
+	}
+	merged := mergeRanges(want)
+	if len(got) != len(merged) {
+		t.Fatalf("Scheduled = %v, want %v", got, merged)
+	}
+	for i := range got {
+		if !got[i].Start.Equal(merged[i].Start) || !got[i].End.Equal(merged[i].End) {
+			t.Errorf("range %d = %v, want %v", i, got[i], merged[i])
+		}
+	}
+	total := day(5, 0).Sub(day(1, 0)).Seconds()
+	if u := overlapSeconds(cal.Unscheduled(nil, day(1, 0), day(5, 0)), day(1, 0), day(5, 0)); u != total-26*3600 {
+		t.Errorf("unscheduled = %v h", u/3600)
+	}
+
+	// O setor tem turno próprio: ignora os da fábrica; feriado vale, extra também.
+	got = cal.Scheduled(&sector, day(3, 0), day(5, 0))
+	if len(got) != 1 || !got[0].Start.Equal(day(3, 8)) || !got[0].End.Equal(day(3, 12)) {
+		t.Errorf("sector Scheduled = %v", got)
+	}
+
+	inst := cal.ShiftInstances(nil, day(1, 0), day(2, 0))
+	if len(inst) != 2 || inst[0].Name != "A" || inst[1].Name != "C" || !inst[1].End.Equal(day(2, 6)) {
+		t.Errorf("ShiftInstances = %+v", inst)
+	}
+}
@@ -0,0 +1,550 @@
+package store
+
+// correlation.go — Correlação defasada entre tags (exploração de causa raiz)
+//
+// Para uma métrica alvo (ativo + tag) e uma janela, alinha em buckets de step a
+// série alvo e todas as outras tags do mesmo ativo (scope asset) ou dos ativos do
+// mesmo setor (scope sector) e calcula Pearson com defasagem de −max_lag a +max_lag
+// buckets. Lag positivo = o candidato se move ANTES do alvo (candidato[t−lag] × alvo[t]).
+//
+// Fontes: média de telemetry_log por bucket; buckets sem leitura no log (janela já
+// arquivada) vêm de telemetry_rollup_1m. Contadores (tag_ok/tag_nok/tag_energy com
+// reading_rule delta e tags com counter_config) viram acréscimo por bucket pela
+// semântica de counters.go — correlacionar o valor acumulado não diz nada.
+//
+// Ranking por |r| na melhor defasagem. p_value vem da transformação de Fisher,
+// corrigido por Bonferroni pelas defasagens testadas; não desconta autocorrelação,
+// então séries com tendência parecem mais significativas do que são — diff=true
+// correlaciona as primeiras diferenças e remove a tendência.
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	correlationTargetPoints = 240
+	correlationMaxPoints    = 2000
+	correlationDefaultLag   = 12
+	correlationMaxSeries    = 300
+	correlationMinPairs     = 12
+	correlationPlotSeries   = 5
+)
+
+// correlationSteps — passos automáticos (o menor com até correlationTargetPoints buckets).
+var correlationSteps = []time.Duration{
+	time.Minute, 5 * time.Minute, 15 * time.Minute, 30 * time.Minute,
+	time.Hour, 3 * time.Hour, 6 * time.Hour, 12 * time.Hour, 24 * time.Hour,
+}
+
+// ErrInvalidCorrelation envolve erros de validação (escopo, passo, tag alvo sem dados).
+var ErrInvalidCorrelation = errors.New("análise de correlação inválida")
+
+// CorrelationQuery — alvo, escopo dos candidatos e janela. Step 0 = automático;
+// MaxLag < 0 = padrão; Limit 0 = todos os candidatos.
+type CorrelationQuery struct {
+	FactoryID  uuid.UUID
+	AssetID    uuid.UUID
+	MetricKey  string
+	Scope      string // asset | sector
+	Start, End time.Time
+	Step       time.Duration
+	MaxLag     int
+	Diff       bool
+	Limit      int
+}
+
+// CorrelationCandidate — uma tag candidata, na melhor defasagem.
+type CorrelationCandidate struct {
+	AssetID     uuid.UUID `json:"asset_id"`
+	AssetName   string    `json:"asset_name"`
+	MetricKey   string    `json:"metric_key"`
+	Counter     bool      `json:"counter,omitempty"`
+	R           float64   `json:"r"`
+	LagSteps    int       `json:"lag_steps"`
+	LagS        int64     `json:"lag_s"` // > 0: o candidato antecede o alvo
+	N           int       `json:"n"`     // pares usados
+	PValue      float64   `json:"p_value"`
+	Significant bool      `json:"significant"` // p_value < 0,05
+	RLag0       *float64  `json:"r_lag0"`
+}
+
+// CorrelationSeries — série alinhada a Timestamps (nil = bucket sem dado).
+type CorrelationSeries struct {
+	AssetID   uuid.UUID  `json:"asset_id"`
+	AssetName string     `json:"asset_name"`
+	MetricKey string     `json:"metric_key"`
+	Counter   bool       `json:"counter,omitempty"`
+	LagSteps  int        `json:"lag_steps"`
+	Values    []*float64 `json:"values"`
+}
+
+// CorrelationReport — ranking e séries para o gráfico (alvo primeiro, depois os melhores candidatos).
+type CorrelationReport struct {
+	AssetID    uuid.UUID              `json:"asset_id"`
+	AssetName  string                 `json:"asset_name"`
+	MetricKey  string                 `json:"metric_key"`
+	Scope      string                 `json:"scope"`
+	Start      time.Time              `json:"start"`
+	End        time.Time              `json:"end"`
+	StepS      int64                  `json:"step_s"`
+	MaxLag     int                    `json:"max_lag"`
+	Diff       bool                   `json:"diff"`
+	Tested     int                    `json:"tested"`
+	Truncated  bool                   `json:"truncated,omitempty"` // mais de correlationMaxSeries tags no escopo
+	Candidates []CorrelationCandidate `json:"candidates"`
+	Timestamps []time.Time            `json:"timestamps"`
+	Series     []CorrelationSeries    `json:"series"`
+}
+
+// correlationStep escolhe o passo automático da janela.
+func correlationStep(window time.Duration) time.Duration {
+	for _, s := range correlationSteps {
+		if window/s <= correlationTargetPoints {
+			return s
+		}
+	}
+	return correlationSteps[len(correlationSteps)-1]
+}
+
+// laggedPearson correlaciona x[i−lag] com y[i] nos pares com os dois valores.
+func laggedPearson(x, y []*float64, lag int) (float64, int) {
+	var n int
+	var sx, sy, sxx, syy, sxy float64
+	for i := range y {
+		j := i - lag
+		if j < 0 || j >= len(x) || x[j] == nil || y[i] == nil {
+			continue
+		}
+		a, b := *x[j], *y[i]
+		n++
+		sx += a
+		sy += b
+		sxx += a * a
+		syy += b * b
+		sxy += a * b
+	}
+	if n < correlationMinPairs {
+		return 0, n
+	}
+	fn := float64(n)
+	cov := sxy - sx*sy/fn
+	vx, vy := sxx-sx*sx/fn, syy-sy*sy/fn
+	if vx <= 1e-12*math.Max(1, sxx) || vy <= 1e-12*math.Max(1, syy) {
+		return 0, 0 // série constante
+	}
+	return math.Max(-1, math.Min(1, cov/math.Sqrt(vx*vy))), n
+}
+
+// correlationPValue — p bicaudal pela transformação de Fisher, corrigido por Bonferroni.
+func correlationPValue(r float64, n, tests int) float64 {
+	if n <= 3 {
+		return 1
+	}
+	r = math.Max(-0.999999, math.Min(0.999999, r))
+	z := math.Abs(math.Atanh(r)) * math.Sqrt(float64(n-3))
+	return math.Min(1, math.Erfc(z/math.Sqrt2)*float64(tests))
+}
+
+// bestLag procura a defasagem de maior |r|. ok=false quando nenhuma tem pares suficientes.
+func bestLag(x, y []*float64, maxLag int) (c CorrelationCandidate, ok bool) {
+	for lag := -maxLag; lag <= maxLag; lag++ {
+		r, n := laggedPearson(x, y, lag)
+		if n < correlationMinPairs {
+			continue
+		}
+		if lag == 0 {
+			v := r
+			c.RLag0 = &v
+		}
+		if !ok || math.Abs(r) > math.Abs(c.R) || (math.Abs(r) == math.Abs(c.R) && absInt(lag) < absInt(c.LagSteps)) {
+			c.R, c.LagSteps, c.N, ok = r, lag, n, true
+		}
+	}
+	if ok {
+		c.PValue = correlationPValue(c.R, c.N, 2*maxLag+1)
+		c.Significant = c.PValue < 0.05
+	}
+	return c, ok
+}
+
+func absInt(v int) int {
+	if v < 0 {
+		return -v
+	}
+	return v
+}
+
+// diffSeries retorna as primeiras diferenças (nil quando falta um dos lados).
+func diffSeries(v []*float64) []*float64 {
+	out := make([]*float64, len(v))
+	for i := 1; i < len(v); i++ {
+		if v[i] != nil && v[i-1] != nil {
+			d := *v[i] - *v[i-1]
+			out[i] = &d
+		}
+	}
+	return out
+}
+
+// correlationBucket — agregado de uma série em um bucket (média e último valor).
+type correlationBucket struct {
+	avg, last float64
+}
+
+// alignSeries monta a série de n buckets: média, ou acréscimo do contador entre o
+// último valor do bucket anterior e o do bucket (nil sem o bucket anterior — o
+// acréscimo de uma lacuna não é do bucket).
+func alignSeries(buckets map[int]correlationBucket, n int, counter *CounterConfigRow) []*float64 {
+	out := make([]*float64, n)
+	acc := counterAccum{}
+	if counter != nil {
+		acc.cfg = *counter
+	}
+	for i := 0; i < n; i++ {
+		b, ok := buckets[i]
+		if !ok {
+			continue
+		}
+		if counter == nil {
+			v := b.avg
+			out[i] = &v
+			continue
+		}
+		_, prev := buckets[i-1]
+		inc := acc.add(b.last)
+		if prev {
+			out[i] = &inc
+		}
+	}
+	return out
+}
+
+// correlationCandidateSeries — uma série do escopo.
+type correlationCandidateSeries struct {
+	key       seriesKey
+	assetName string
+	counter   *CounterConfigRow
+	buckets   map[int]correlationBucket
+}
+
+// ComputeCorrelations calcula o ranking de correlações defasadas para a métrica alvo.
+func ComputeCorrelations(db *sql.DB, q CorrelationQuery) (*CorrelationReport, error) {
+	q.MetricKey = strings.TrimSpace(q.MetricKey)
+	if q.MetricKey == "" {
+		return nil, fmt.Errorf("%w: metric é obrigatório", ErrInvalidCorrelation)
+	}
+	if q.Scope == "" {
+		q.Scope = "asset"
+	}
+	if q.Scope != "asset" && q.Scope != "sector" {
+		return nil, fmt.Errorf("%w: scope deve ser asset ou sector", ErrInvalidCorrelation)
+	}
+	if !q.Start.Before(q.End) {
+		return nil, fmt.Errorf("%w: início deve ser anterior ao fim", ErrInvalidCorrelation)
+	}
+	if q.Step == 0 {
+		q.Step = correlationStep(q.End.Sub(q.Start))
+	}
+	if q.Step < time.Minute || q.Step%time.Minute != 0 {
+		return nil, fmt.Errorf("%w: step deve ser múltiplo de 1m", ErrInvalidCorrelation)
+	}
+	stepS := int64(q.Step / time.Second)
+	start := time.Unix(q.Start.Unix()/stepS*stepS, 0).UTC()
+	n := int((q.End.Sub(start) + q.Step - 1) / q.Step)
+	if n > correlationMaxPoints {
+		return nil, fmt.Errorf("%w: %d buckets (máximo %d): aumente o step", ErrInvalidCorrelation, n, correlationMaxPoints)
+	}
+	if q.MaxLag < 0 {
+		q.MaxLag = correlationDefaultLag
+	}
+	if q.MaxLag > n/4 {
+		q.MaxLag = n / 4
+	}
+
+	asset, err := GetAssetByID(db, q.AssetID, q.FactoryID)
+	if err != nil {
+		return nil, err
+	}
+	if asset == nil {
+		return nil, fmt.Errorf("%w: ativo não encontrado", ErrInvalidCorrelation)
+	}
+	scopeAssets := []uuid.UUID{asset.ID}
+	if q.Scope == "sector" {
+		if asset.GroupID == nil {
+			return nil, fmt.Errorf("%w: ativo sem setor — use scope=asset", ErrInvalidCorrelation)
+		}
+		list, err := ListAssetsBySector(db, *asset.GroupID)
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range list {
+			if a.ID != asset.ID {
+				scopeAssets = append(scopeAssets, a.ID)
+			}
+		}
+	}
+
+	series, truncated, err := loadCorrelationSeries(db, q.FactoryID, scopeAssets, asset.ID, q.MetricKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := fillCorrelationBuckets(db, q.FactoryID, series, start, q.End, q.Step); err != nil {
+		return nil, err
+	}
+
+	report := &CorrelationReport{
+		AssetID: asset.ID, AssetName: asset.DisplayName, MetricKey: q.MetricKey, Scope: q.Scope,
+		Start: start, End: q.End, StepS: stepS, MaxLag: q.MaxLag, Diff: q.Diff, Truncated: truncated,
+		Candidates: []CorrelationCandidate{}, Timestamps: make([]time.Time, n), Series: []CorrelationSeries{},
+	}
+	for i := range report.Timestamps {
+		report.Timestamps[i] = start.Add(time.Duration(i) * q.Step)
+	}
+	target := seriesKey{asset.ID, q.MetricKey}
+	aligned := make(map[seriesKey][]*float64, len(series))
+	var targetSeries *correlationCandidateSeries
+	for _, s := range series {
+		aligned[s.key] = alignSeries(s.buckets, n, s.counter)
+		if s.key == target {
+			targetSeries = s
+		}
+	}
+	if targetSeries == nil || len(targetSeries.buckets) == 0 {
+		return nil, fmt.Errorf("%w: sem leituras de %s no período", ErrInvalidCorrelation, q.MetricKey)
+	}
+	y := aligned[target]
+	if q.Diff {
+		y = diffSeries(y)
+	}
+	for _, s := range series {
+		if s.key == target {
+			continue
+		}
+		report.Tested++
+		x := aligned[s.key]
+		if q.Diff {
+			x = diffSeries(x)
+		}
+		c, ok := bestLag(x, y, q.MaxLag)
+		if !ok {
+			continue
+		}
+		c.AssetID, c.AssetName, c.MetricKey, c.Counter = s.key.asset, s.assetName, s.key.metric, s.counter != nil
+		c.LagS = int64(c.LagSteps) * stepS
+		report.Candidates = append(report.Candidates, c)
+	}
+	sortCorrelationCandidates(report.Candidates)
+	if q.Limit > 0 && len(report.Candidates) > q.Limit {
+		report.Candidates = report.Candidates[:q.Limit]
+	}
+
+	report.Series = append(report.Series, CorrelationSeries{AssetID: asset.ID, AssetName: asset.DisplayName,
+		MetricKey: q.MetricKey, Counter: targetSeries.counter != nil, Values: aligned[target]})
+	for i, c := range report.Candidates {
+		if i == correlationPlotSeries {
+			break
+		}
+		report.Series = append(report.Series, CorrelationSeries{AssetID: c.AssetID, AssetName: c.AssetName,
+			MetricKey: c.MetricKey, Counter: c.Counter, LagSteps: c.LagSteps, Values: aligned[seriesKey{c.AssetID, c.MetricKey}]})
+	}
+	return report, nil
+}
+
+// sortCorrelationCandidates ordena por |r| decrescente (empate: menor defasagem, nome).
+func sortCorrelationCandidates(list []CorrelationCandidate) {
+	sort.SliceStable(list, func(i, j int) bool {
+		ai, aj := math.Abs(list[i].R), math.Abs(list[j].R)
+		if ai != aj {
+			return ai > aj
+		}
+		if absInt(list[i].LagSteps) != absInt(list[j].LagSteps) {
+			return absInt(list[i].LagSteps) < absInt(list[j].LagSteps)
+		}
+		return list[i].AssetName+list[i].MetricKey < list[j].AssetName+list[j].MetricKey
+	})
+}
+
+// loadCorrelationSeries lista as tags do escopo pelo catálogo (alvo sempre incluído)
+// e marca os contadores. truncated = o escopo passou de correlationMaxSeries.
+func loadCorrelationSeries(db *sql.DB, factoryID uuid.UUID, assets []uuid.UUID, targetAsset uuid.UUID, targetMetric string) ([]*correlationCandidateSeries, bool, error) {
+	ids := make([]string, len(assets))
+	for i, a := range assets {
+		ids[i] = a.String()
+	}
+	rows, err := db.Query(`
+		SELECT c.asset_id, a.display_name, c.metric_key
+		FROM nxd.asset_metric_catalog c
+		JOIN nxd.assets a ON a.id = c.asset_id
+		WHERE c.factory_id = $1 AND c.asset_id = ANY($2::uuid[])
+		ORDER BY (c.asset_id = $3) DESC, a.display_name, c.metric_key
+	`, factoryID, pq.Array(ids), targetAsset)
+	if err != nil {
+		return nil, false, err
+	}
+	var list []*correlationCandidateSeries
+	names := map[uuid.UUID]string{}
+	hasTarget, truncated := false, false
+	for rows.Next() {
+		s := &correlationCandidateSeries{buckets: map[int]correlationBucket{}}
+		if err := rows.Scan(&s.key.asset, &s.assetName, &s.key.metric); err != nil {
+			rows.Close()
+			return nil, false, err
+		}
+		names[s.key.asset] = s.assetName
+		if s.key.asset == targetAsset && s.key.metric == targetMetric {
+			hasTarget = true
+		}
+		if len(list) >= correlationMaxSeries {
+			truncated = true
+			continue
+		}
+		list = append(list, s)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, false, err
+	}
+	if !hasTarget {
+		// Tag fora do catálogo (ex.: nunca catalogada): tenta mesmo assim.
+		list = append([]*correlationCandidateSeries{{key: seriesKey{targetAsset, targetMetric}, assetName: names[targetAsset],
+			buckets: map[int]correlationBucket{}}}, list...)
+	}
+
+	counters, err := seriesCounters(db, ids)
+	if err != nil {
+		return nil, false, err
+	}
+	for _, s := range list {
+		if c, ok := counters[s.key]; ok {
+			s.counter = &c
+		}
+	}
+	return list, truncated, nil
+}
+
+// seriesCounters retorna as séries dos ativos que são contadores: tags de
+// peças/energia do mapeamento (reading_rule delta) e tags com counter_config.
+func seriesCounters(db *sql.DB, ids []string) (map[seriesKey]CounterConfigRow, error) {
+	counters := map[seriesKey]CounterConfigRow{}
+	mrows, err := db.Query(`
+		SELECT asset_id, COALESCE(tag_ok,''), COALESCE(tag_nok,''), COALESCE(tag_energy,'')
+		FROM nxd.tag_mapping WHERE asset_id = ANY($1::uuid[]) AND COALESCE(reading_rule,'delta') = 'delta'
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	for mrows.Next() {
+		var a uuid.UUID
+		var ok, nok, energy string
+		if err := mrows.Scan(&a, &ok, &nok, &energy); err != nil {
+			mrows.Close()
+			return nil, err
+		}
+		for _, m := range []string{ok, nok, energy} {
+			if m != "" {
+				counters[seriesKey{a, m}] = CounterConfigRow{AssetID: a, MetricKey: m}
+			}
+		}
+	}
+	mrows.Close()
+	if err := mrows.Err(); err != nil {
+		return nil, err
+	}
+	crows, err := db.Query(`
+		SELECT asset_id, metric_key, rollover_at, reset_tolerance FROM nxd.counter_config WHERE asset_id = ANY($1::uuid[])
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	for crows.Next() {
+		var c CounterConfigRow
+		var rollover sql.NullFloat64
+		if err := crows.Scan(&c.AssetID, &c.MetricKey, &rollover, &c.ResetTolerance); err != nil {
+			crows.Close()
+			return nil, err
+		}
+		if rollover.Valid {
+			c.RolloverAt = &rollover.Float64
+		}
+		counters[seriesKey{c.AssetID, c.MetricKey}] = c
+	}
+	crows.Close()
+	if err := crows.Err(); err != nil {
+		return nil, err
+	}
+	return counters, nil
+}
+
+// fillCorrelationBuckets agrega as séries em buckets de step: telemetry_log e, nos
+// buckets sem leitura no log, telemetry_rollup_1m (último ≈ máximo do minuto).
+func fillCorrelationBuckets(db *sql.DB, factoryID uuid.UUID, series []*correlationCandidateSeries, start, end time.Time, step time.Duration) error {
+	if len(series) == 0 {
+		return nil
+	}
+	assets := make([]string, len(series))
+	metrics := make([]string, len(series))
+	byKey := make(map[seriesKey]*correlationCandidateSeries, len(series))
+	for i, s := range series {
+		assets[i], metrics[i] = s.key.asset.String(), s.key.metric
+		byKey[s.key] = s
+	}
+	stepS := int64(step / time.Second)
+	scan := func(rows *sql.Rows, onlyMissing bool) error {
+		defer rows.Close()
+		for rows.Next() {
+			var k seriesKey
+			var idx int
+			var b correlationBucket
+			if err := rows.Scan(&k.asset, &k.metric, &idx, &b.avg, &b.last); err != nil {
+				return err
+			}
+			s := byKey[k]
+			if s == nil {
+				continue
+			}
+			if _, exists := s.buckets[idx]; onlyMissing && exists {
+				continue
+			}
+			s.buckets[idx] = b
+		}
+		return rows.Err()
+	}
+	rows, err := db.Query(`
+		SELECT t.asset_id, t.metric_key, FLOOR(EXTRACT(EPOCH FROM t.ts - $3) / $5)::int AS idx,
+			AVG(t.metric_value), (ARRAY_AGG(t.metric_value ORDER BY t.ts DESC))[1]
+		FROM nxd.telemetry_log t
+		JOIN unnest($1::uuid[], $2::text[]) AS k(asset_id, metric_key)
+			ON t.asset_id = k.asset_id AND t.metric_key = k.metric_key
+		WHERE t.ts >= $3 AND t.ts < $4 AND t.metric_value IS NOT NULL
+		GROUP BY 1, 2, 3
+	`, pq.Array(assets), pq.Array(metrics), start, end, stepS)
+	if err != nil {
+		return err
+	}
+	if err := scan(rows, false); err != nil {
+		return err
+	}
+	rows, err = db.Query(`
+		SELECT r.asset_id, r.metric_key, FLOOR(EXTRACT(EPOCH FROM r.bucket_ts - $3) / $5)::int AS idx,
+			SUM(r.avg_value * r.samples) / NULLIF(SUM(r.samples), 0), MAX(r.max_value)
+		FROM nxd.telemetry_rollup_1m r
+		JOIN unnest($1::uuid[], $2::text[]) AS k(asset_id, metric_key)
+			ON r.asset_id = k.asset_id AND r.metric_key = k.metric_key
+		WHERE r.factory_id = $6 AND r.bucket_ts >= $3 AND r.bucket_ts < $4 AND r.samples > 0
+			AND r.avg_value IS NOT NULL AND r.max_value IS NOT NULL
+		GROUP BY 1, 2, 3
+	`, pq.Array(assets), pq.Array(metrics), start, end, stepS, factoryID)
+	if err != nil {
+		return err
+	}
+	return scan(rows, true)
+}
@@ -0,0 +1,83 @@
+package store
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestBestLag(t *testing.T) {
+	const n = 120
+	x := make([]*float64, n)
+	y := make([]*float64, n)
+	noise := make([]*float64, n)
+	for i := 0; i < n; i++ {
+		xv := math.Sin(float64(i)/5) + 0.3*math.Cos(float64(i)*1.7)
+		x[i] = &xv
+		nv := math.Sin(float64(i) * 2.3)
+		noise[i] = &nv
+		if i >= 3 {
+			// alvo = candidato 3 buckets antes, invertido e com escala.
+			yv := -2 * *x[i-3]
+			y[i] = &yv
+		}
+	}
+	y[50] = nil // lacuna: par descartado
+
+	c, ok := bestLag(x, y, 6)
+	if !ok || c.LagSteps != 3 || math.Abs(c.R+1) > 1e-9 || c.N != n-4 || !c.Significant {
+		t.Fatalf("melhor defasagem = %+v", c)
+	}
+	if c.RLag0 == nil || math.Abs(*c.RLag0) > 0.9 {
+		t.Errorf("r na defasagem 0 = %v", c.RLag0)
+	}
+	if r, _ := laggedPearson(noise, y, 0); math.Abs(r) > 0.3 {
+		t.Errorf("ruído r = %v", r)
+	}
+	// Série constante e pares insuficientes não geram candidato.
+	flat := make([]*float64, n)
+	for i := range flat {
+		v := 7.0
+		flat[i] = &v
+	}
+	if _, ok := bestLag(flat, y, 6); ok {
+		t.Errorf("série constante virou candidato")
+	}
+	if _, ok := bestLag(x[:10], y[:10], 2); ok {
+		t.Errorf("poucos pares virou candidato")
+	}
+	if p := correlationPValue(0.1, 20, 1); p < 0.5 || correlationPValue(0.1, 20, 25) != 1 {
+		t.Errorf("p-valor = %v", p)
+	}
+}
+
+func TestAlignSeriesCounter(t *testing.T) {
+	buckets := map[int]correlationBucket{
+		0: {avg: 95, last: 100},
+		1: {avg: 105, last: 110},
+		2: {avg: 112, last: 115},
+		4: {avg: 130, last: 140}, // bucket 3 sem leitura: acréscimo da lacuna descartado
+		5: {avg: 3, last: 5},     // reset: 5 peças novas
+	}
+	got := alignSeries(buckets, 7, &CounterConfigRow{})
+	want := []*float64{nil, f64(10), f64(5), nil, nil, f64(5), nil}
+	for i := range want {
+		if (got[i] == nil) != (want[i] == nil) || (got[i] != nil && *got[i] != *want[i]) {
+			t.Errorf("bucket %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+	avg := alignSeries(buckets, 7, nil)
+	if *avg[0] != 95 || avg[3] != nil || *avg[5] != 3 {
+		t.Errorf("média = %v", avg)
+	}
+	d := diffSeries(avg)
+	if d[0] != nil || *d[1] != 10 || d[4] != nil || *d[5] != -127 {
+		t.Errorf("diferenças = %v", d)
+	}
+	if correlationStep(24*time.Hour) != 15*time.Minute || correlationStep(4*time.Hour) != time.Minute ||
+		correlationStep(365*24*time.Hour) != 24*time.Hour {
+		t.Errorf("step automático")
+	}
+}
+
+func f64(v float64) *float64 { return &v }
@@ -0,0 +1,601 @@
+package store
+
+// cost_model.go — Parâmetros de custo com vigência, overrides e moeda
+//
+// nxd.business_config guarda o valor atual por setor (ou padrão da fábrica). Os
+// relatórios usam o histórico em nxd.cost_parameters: cada linha vale a partir de
+// valid_from (dia local da fábrica) até a próxima linha do mesmo escopo, então
+// mudar o preço hoje não altera o relatório do mês passado. Salvar business_config
+// grava também a versão do dia no histórico (escopo setor ou fábrica).
+//
+// Escopos, do mais específico ao mais geral (campo a campo; nulo = herda):
+//   produto (ordens de produção) > ativo > setor do ativo > fábrica > business_config do resumo
+// A linha de um escopo é uma versão completa dele: campos nulos herdam do escopo
+// mais geral, não da versão anterior do mesmo escopo. valor_venda_ok da própria
+// ordem de produção vence todos.
+//
+// Parâmetros:
+//   valor_venda_ok       receita por peça boa
+//   custo_refugo_un      perda por peça refugada (retrabalho/descarte)
+//   custo_parada_h       custo por hora parada no tempo programado
+//   custo_material_un    material por peça produzida (boa ou refugo)
+//   custo_mao_obra_turno mão de obra de um turno do ativo; turnos equivalentes =
+//                        horas programadas ÷ duração média dos turnos do setor (8 h sem turnos)
+// custo_kwh continua só em business_config (a energia tem tarifas com vigência, energy.go).
+//
+// Moeda: os resultados saem na moeda da fábrica (factories.currency, ISO 4217).
+// Uma linha em outra moeda é convertida pela cotação vigente (nxd.exchange_rates:
+// unidades da moeda da fábrica por 1 unidade da moeda da linha); sem cotação o
+// valor entra sem conversão e o resultado traz um aviso.
+//
+// O período do relatório é dividido nas trocas de vigência (meia-noite local) e
+// cada trecho usa os parâmetros vigentes no seu início.
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultFactoryCurrency — moeda padrão das fábricas.
+const DefaultFactoryCurrency = "BRL"
+
+// costShiftHours — duração de turno assumida sem turnos cadastrados (24/7 = 3 turnos).
+const costShiftHours = 8.0
+
+var (
+	// ErrInvalidCostParameter — escopo, vigência, moeda ou valores inválidos.
+	ErrInvalidCostParameter = errors.New("parâmetro de custo inválido")
+	// ErrCostParameterConflict — já existe versão do mesmo escopo nesta data (ou cotação da moeda nesta data).
+	ErrCostParameterConflict = errors.New("já existe uma versão deste escopo com esta vigência")
+)
+
+// CostParameterRow — versão dos parâmetros de um escopo a partir de ValidFrom (YYYY-MM-DD).
+// No máximo um entre SectorID, AssetID e Product (nenhum = fábrica). Campos nil herdam.
+type CostParameterRow struct {
+	ID                uuid.UUID  `json:"id"`
+	FactoryID         uuid.UUID  `json:"factory_id"`
+	SectorID          *uuid.UUID `json:"sector_id,omitempty"`
+	AssetID           *uuid.UUID `json:"asset_id,omitempty"`
+	Product           string     `json:"product,omitempty"`
+	ValidFrom         string     `json:"valid_from"`
+	Currency          string     `json:"currency,omitempty"` // "" = moeda da fábrica
+	ValorVendaOk      *float64   `json:"valor_venda_ok"`
+	CustoRefugoUn     *float64   `json:"custo_refugo_un"`
+	CustoParadaH      *float64   `json:"custo_parada_h"`
+	CustoMaterialUn   *float64   `json:"custo_material_un"`
+	CustoMaoObraTurno *float64   `json:"custo_mao_obra_turno"`
+	Notes             string     `json:"notes,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+}
+
+// ExchangeRateRow — cotação de Currency a partir de ValidFrom: Rate unidades da moeda da fábrica por 1 Currency.
+type ExchangeRateRow struct {
+	ID        uuid.UUID `json:"id"`
+	FactoryID uuid.UUID `json:"factory_id"`
+	Currency  string    `json:"currency"`
+	ValidFrom string    `json:"valid_from"`
+	Rate      float64   `json:"rate"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// ─── Moeda da fábrica ───────────────────────────────────────────────────────
+
+func normalizeCurrency(c string) (string, error) {
+	c = strings.ToUpper(strings.TrimSpace(c))
+	if len(c) != 3 || strings.Trim(c, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") != "" {
+		return "", fmt.Errorf("%w: moeda %q (use o código ISO 4217, ex.: BRL)", ErrInvalidCostParameter, c)
+	}
+	return c, nil
+}
+
+// GetFactoryCurrency retorna a moeda da fábrica (padrão DefaultFactoryCurrency).
+func GetFactoryCurrency(db *sql.DB, factoryID uuid.UUID) (string, error) {
+	var c sql.NullString
+	err := db.QueryRow(`SELECT currency FROM nxd.factories WHERE id = $1`, factoryID).Scan(&c)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	if c.Valid && c.String != "" {
+		return c.String, nil
+	}
+	return DefaultFactoryCurrency, nil
+}
+
+// SetFactoryCurrency grava a moeda dos resultados financeiros. Valores já cadastrados
+// não são convertidos: business_config e linhas sem moeda passam a valer na nova moeda.
+func SetFactoryCurrency(db *sql.DB, factoryID uuid.UUID, currency string) error {
+	c, err := normalizeCurrency(currency)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`UPDATE nxd.factories SET currency = $1, updated_at = NOW() WHERE id = $2`, c, factoryID)
+	return err
+}
+
+// ─── Histórico de parâmetros ────────────────────────────────────────────────
+
+const costParameterColumns = `id, factory_id, sector_id, asset_id, COALESCE(product, ''), valid_from, COALESCE(currency, ''),
+	valor_venda_ok, custo_refugo_un, custo_parada_h, custo_material_un, custo_mao_obra_turno, COALESCE(notes, ''), created_at`
+
+func scanCostParameter(sc interface{ Scan(...interface{}) error }) (CostParameterRow, error) {
+	var p CostParameterRow
+	var sectorID, assetID uuid.NullUUID
+	var from time.Time
+	var vals [5]sql.NullFloat64
+	err := sc.Scan(&p.ID, &p.FactoryID, &sectorID, &assetID, &p.Product, &from, &p.Currency,
+		&vals[0], &vals[1], &vals[2], &vals[3], &vals[4], &p.Notes, &p.CreatedAt)
+	if err != nil {
+		return p, err
+	}
+	if sectorID.Valid {
+		p.SectorID = &sectorID.UUID
+	}
+	if assetID.Valid {
+		p.AssetID = &assetID.UUID
+	}
+	p.ValidFrom = from.Format("2006-01-02")
+	for i, dst := range []**float64{&p.ValorVendaOk, &p.CustoRefugoUn, &p.CustoParadaH, &p.CustoMaterialUn, &p.CustoMaoObraTurno} {
+		if vals[i].Valid {
+			v := vals[i].Float64
+			*dst = &v
+		}
+	}
+	return p, nil
+}
+
+// ListCostParameters retorna o histórico da fábrica (escopo, depois vigência).
+func ListCostParameters(db *sql.DB, factoryID uuid.UUID) ([]CostParameterRow, error) {
+	rows, err := db.Query(`SELECT `+costParameterColumns+` FROM nxd.cost_parameters WHERE factory_id = $1
+		ORDER BY sector_id NULLS FIRST, asset_id NULLS FIRST, product NULLS FIRST, valid_from`, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []CostParameterRow
+	for rows.Next() {
+		p, err := scanCostParameter(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, p)
+	}
+	return list, rows.Err()
+}
+
+func validateCostParameter(p *CostParameterRow) error {
+	p.Product = strings.TrimSpace(p.Product)
+	p.Notes = strings.TrimSpace(p.Notes)
+	scopes := 0
+	if p.SectorID != nil {
+		scopes++
+	}
+	if p.AssetID != nil {
+		scopes++
+	}
+	if p.Product != "" {
+		scopes++
+	}
+	if scopes > 1 {
+		return fmt.Errorf("%w: informe apenas um escopo (sector_id, asset_id ou product)", ErrInvalidCostParameter)
+	}
+	if _, err := time.Parse("2006-01-02", p.ValidFrom); err != nil {
+		return fmt.Errorf("%w: valid_from %q (use YYYY-MM-DD)", ErrInvalidCostParameter, p.ValidFrom)
+	}
+	if p.Currency != "" {
+		c, err := normalizeCurrency(p.Currency)
+		if err != nil {
+			return err
+		}
+		p.Currency = c
+	}
+	set := 0
+	for _, v := range []*float64{p.ValorVendaOk, p.CustoRefugoUn, p.CustoParadaH, p.CustoMaterialUn, p.CustoMaoObraTurno} {
+		if v == nil {
+			continue
+		}
+		if *v < 0 {
+			return fmt.Errorf("%w: valores não podem ser negativos", ErrInvalidCostParameter)
+		}
+		set++
+	}
+	if set == 0 {
+		return fmt.Errorf("%w: informe ao menos um parâmetro", ErrInvalidCostParameter)
+	}
+	return nil
+}
+
+// CreateCostParameter insere uma versão (mesmo escopo e data → ErrCostParameterConflict).
+// Sector/asset devem pertencer à fábrica — verificado pelo handler.
+func CreateCostParameter(db *sql.DB, p CostParameterRow) (uuid.UUID, error) {
+	if err := validateCostParameter(&p); err != nil {
+		return uuid.Nil, err
+	}
+	var id uuid.UUID
+	err := db.QueryRow(`
+		INSERT INTO nxd.cost_parameters (factory_id, sector_id, asset_id, product, valid_from, currency,
+			valor_venda_ok, custo_refugo_un, custo_parada_h, custo_material_un, custo_mao_obra_turno, notes)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, NULLIF($6, ''), $7, $8, $9, $10, $11, NULLIF($12, ''))
+		ON CONFLICT DO NOTHING
+		RETURNING id
+	`, p.FactoryID, p.SectorID, p.AssetID, p.Product, p.ValidFrom, p.Currency,
+		p.ValorVendaOk, p.CustoRefugoUn, p.CustoParadaH, p.CustoMaterialUn, p.CustoMaoObraTurno, p.Notes).Scan(&id)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, ErrCostParameterConflict
+	}
+	return id, err
+}
+
+// UpdateCostParameter substitui valores, moeda e vigência de uma versão (o escopo não muda).
+// false = não existe na fábrica.
+func UpdateCostParameter(db *sql.DB, p CostParameterRow) (bool, error) {
+	p.SectorID, p.AssetID, p.Product = nil, nil, ""
+	if err := validateCostParameter(&p); err != nil {
+		return false, err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	var taken bool
+	if err := tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM nxd.cost_parameters o JOIN nxd.cost_parameters c ON c.id = $1 AND c.factory_id = $2
+			WHERE o.factory_id = c.factory_id AND o.id <> c.id AND o.valid_from = $3
+			  AND o.sector_id IS NOT DISTINCT FROM c.sector_id AND o.asset_id IS NOT DISTINCT FROM c.asset_id
+			  AND o.product IS NOT DISTINCT FROM c.product)
+	`, p.ID, p.FactoryID, p.ValidFrom).Scan(&taken); err != nil {
+		return false, err
+	}
+	if taken {
+		return false, ErrCostParameterConflict
+	}
+	res, err := tx.Exec(`
+		UPDATE nxd.cost_parameters SET valid_from = $1, currency = NULLIF($2, ''), valor_venda_ok = $3, custo_refugo_un = $4,
+			custo_parada_h = $5, custo_material_un = $6, custo_mao_obra_turno = $7, notes = NULLIF($8, '')
+		WHERE id = $9 AND factory_id = $10
+	`, p.ValidFrom, p.Currency, p.ValorVendaOk, p.CustoRefugoUn, p.CustoParadaH, p.CustoMaterialUn, p.CustoMaoObraTurno,
+		p.Notes, p.ID, p.FactoryID)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	return true, tx.Commit()
+}
+
+// DeleteCostParameter remove uma versão. false = não existe.
+func DeleteCostParameter(db *sql.DB, factoryID, id uuid.UUID) (bool, error) {
+	res, err := db.Exec(`DELETE FROM nxd.cost_parameters WHERE id = $1 AND factory_id = $2`, id, factoryID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// recordBusinessConfigVersion grava os valores atuais de business_config como a
+// versão do dia (fuso da fábrica) do escopo setor/fábrica no histórico.
+func recordBusinessConfigVersion(db *sql.DB, factoryID uuid.UUID, sectorID *uuid.UUID) error {
+	cfg, err := getBusinessConfigRow(db, factoryID, sectorID)
+	if err != nil || cfg == nil {
+		return err
+	}
+	loc, err := GetFactoryTimezone(db, factoryID)
+	if err != nil {
+		return err
+	}
+	day := time.Now().In(loc).Format("2006-01-02")
+	res, err := db.Exec(`
+		UPDATE nxd.cost_parameters SET valor_venda_ok = $1, custo_refugo_un = $2, custo_parada_h = $3,
+			custo_material_un = $4, custo_mao_obra_turno = $5, currency = NULL
+		WHERE factory_id = $6 AND sector_id IS NOT DISTINCT FROM $7 AND asset_id IS NULL AND product IS NULL AND valid_from = $8
+	`, cfg.ValorVendaOk, cfg.CustoRefugoUn, cfg.CustoParadaH, cfg.CustoMaterialUn, cfg.CustoMaoObraTurno, factoryID, cfg.SectorID, day)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+	_, err = db.Exec(`
+		INSERT INTO nxd.cost_parameters (factory_id, sector_id, valid_from, valor_venda_ok, custo_refugo_un, custo_parada_h,
+			custo_material_un, custo_mao_obra_turno, notes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, 'business_config')
+		ON CONFLICT DO NOTHING
+	`, factoryID, cfg.SectorID, day, cfg.ValorVendaOk, cfg.CustoRefugoUn, cfg.CustoParadaH, cfg.CustoMaterialUn, cfg.CustoMaoObraTurno)
+	return err
+}
+
+// ─── Cotações ───────────────────────────────────────────────────────────────
+
+// ListExchangeRates retorna as cotações da fábrica (moeda, depois vigência).
+func ListExchangeRates(db *sql.DB, factoryID uuid.UUID) ([]ExchangeRateRow, error) {
+	rows, err := db.Query(`
+		SELECT id, factory_id, currency, valid_from, rate, created_at
+		FROM nxd.exchange_rates WHERE factory_id = $1 ORDER BY currency, valid_from
+	`, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []ExchangeRateRow
+	for rows.Next() {
+		var x ExchangeRateRow
+		var from time.Time
+		if err := rows.Scan(&x.ID, &x.FactoryID, &x.Currency, &from, &x.Rate, &x.CreatedAt); err != nil {
+			return nil, err
+		}
+		x.ValidFrom = from.Format("2006-01-02")
+		list = append(list, x)
+	}
+	return list, rows.Err()
+}
+
+// CreateExchangeRate insere uma cotação (mesma moeda e data → ErrCostParameterConflict).
+func CreateExchangeRate(db *sql.DB, x ExchangeRateRow) (uuid.UUID, error) {
+	c, err := normalizeCurrency(x.Currency)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if _, err := time.Parse("2006-01-02", x.ValidFrom); err != nil {
+		return uuid.Nil, fmt.Errorf("%w: valid_from %q (use YYYY-MM-DD)", ErrInvalidCostParameter, x.ValidFrom)
+	}
+	if x.Rate <= 0 {
+		return uuid.Nil, fmt.Errorf("%w: rate deve ser positivo", ErrInvalidCostParameter)
+	}
+	var id uuid.UUID
+	err = db.QueryRow(`
+		INSERT INTO nxd.exchange_rates (factory_id, currency, valid_from, rate)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (factory_id, currency, valid_from) DO NOTHING
+		RETURNING id
+	`, x.FactoryID, c, x.ValidFrom, x.Rate).Scan(&id)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, ErrCostParameterConflict
+	}
+	return id, err
+}
+
+// DeleteExchangeRate remove uma cotação. false = não existe.
+func DeleteExchangeRate(db *sql.DB, factoryID, id uuid.UUID) (bool, error) {
+	res, err := db.Exec(`DELETE FROM nxd.exchange_rates WHERE id = $1 AND factory_id = $2`, id, factoryID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ─── Resolução ──────────────────────────────────────────────────────────────
+
+// CostValues — parâmetros resolvidos de um ativo em um instante (moeda da fábrica).
+type CostValues struct {
+	ValorVendaOk      float64 `json:"valor_venda_ok"`
+	CustoRefugoUn     float64 `json:"custo_refugo_un"`
+	CustoParadaH      float64 `json:"custo_parada_h"`
+	CustoMaterialUn   float64 `json:"custo_material_un"`
+	CustoMaoObraTurno float64 `json:"custo_mao_obra_turno"`
+}
+
+type costScope struct {
+	sector, asset uuid.UUID
+	product       string
+}
+
+type compiledCost struct {
+	from time.Time // meia-noite local de valid_from
+	row  CostParameterRow
+}
+
+type compiledRate struct {
+	from time.Time
+	rate float64
+}
+
+// costModel resolve os parâmetros de custo por ativo e instante.
+type costModel struct {
+	currency      string
+	versions      map[costScope][]compiledCost // ordem de vigência
+	rates         map[string][]compiledRate
+	fallback      CostValues // business_config do resumo (antes de qualquer versão)
+	product       string     // ordens de produção: escopo produto
+	priceOverride *float64   // valor_venda_ok da ordem
+	warnings      map[string]bool
+}
+
+// loadCostModel carrega histórico, cotações e moeda da fábrica.
+func loadCostModel(db *sql.DB, factoryID uuid.UUID, loc *time.Location) (*costModel, error) {
+	currency, err := GetFactoryCurrency(db, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	params, err := ListCostParameters(db, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	rates, err := ListExchangeRates(db, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	return newCostModel(currency, params, rates, loc), nil
+}
+
+func newCostModel(currency string, params []CostParameterRow, rates []ExchangeRateRow, loc *time.Location) *costModel {
+	m := &costModel{currency: currency, versions: map[costScope][]compiledCost{}, rates: map[string][]compiledRate{}, warnings: map[string]bool{}}
+	for _, p := range params {
+		from, err := time.ParseInLocation("2006-01-02", p.ValidFrom, loc)
+		if err != nil {
+			continue
+		}
+		var sc costScope
+		if p.SectorID != nil {
+			sc.sector = *p.SectorID
+		}
+		if p.AssetID != nil {
+			sc.asset = *p.AssetID
+		}
+		sc.product = p.Product
+		m.versions[sc] = append(m.versions[sc], compiledCost{from: from, row: p})
+	}
+	for sc := range m.versions {
+		v := m.versions[sc]
+		sort.SliceStable(v, func(i, j int) bool { return v[i].from.Before(v[j].from) })
+	}
+	for _, x := range rates {
+		from, err := time.ParseInLocation("2006-01-02", x.ValidFrom, loc)
+		if err != nil {
+			continue
+		}
+		m.rates[x.Currency] = append(m.rates[x.Currency], compiledRate{from: from, rate: x.Rate})
+	}
+	for c := range m.rates {
+		r := m.rates[c]
+		sort.SliceStable(r, func(i, j int) bool { return r[i].from.Before(r[j].from) })
+	}
+	return m
+}
+
+// scopes retorna os escopos do ativo, do mais específico ao mais geral.
+func (m *costModel) scopes(assetID uuid.UUID, sectorID *uuid.UUID) []costScope {
+	var out []costScope
+	if m.product != "" {
+		out = append(out, costScope{product: m.product})
+	}
+	out = append(out, costScope{asset: assetID})
+	if sectorID != nil {
+		out = append(out, costScope{sector: *sectorID})
+	}
+	return append(out, costScope{})
+}
+
+// rate converte 1 unidade de currency para a moeda da fábrica em t.
+func (m *costModel) rate(currency string, t time.Time) float64 {
+	if currency == "" || currency == m.currency {
+		return 1
+	}
+	var r *compiledRate
+	for i, x := range m.rates[currency] {
+		if x.from.After(t) {
+			break
+		}
+		r = &m.rates[currency][i]
+	}
+	if r == nil {
+		m.warnings[fmt.Sprintf("sem cotação de %s para %s em %s: valores usados sem conversão", currency, m.currency, t.Format("2006-01-02"))] = true
+		return 1
+	}
+	return r.rate
+}
+
+// resolve retorna os parâmetros do ativo vigentes em t.
+func (m *costModel) resolve(assetID uuid.UUID, sectorID *uuid.UUID, t time.Time) CostValues {
+	out := m.fallback
+	var set [5]bool
+	for _, sc := range m.scopes(assetID, sectorID) {
+		var cur *CostParameterRow
+		for i, v := range m.versions[sc] {
+			if v.from.After(t) {
+				break
+			}
+			cur = &m.versions[sc][i].row
+		}
+		if cur == nil {
+			continue
+		}
+		rate := 0.0
+		for i, f := range []struct {
+			src *float64
+			dst *float64
+		}{
+			{cur.ValorVendaOk, &out.ValorVendaOk},
+			{cur.CustoRefugoUn, &out.CustoRefugoUn},
+			{cur.CustoParadaH, &out.CustoParadaH},
+			{cur.CustoMaterialUn, &out.CustoMaterialUn},
+			{cur.CustoMaoObraTurno, &out.CustoMaoObraTurno},
+		} {
+			if set[i] || f.src == nil {
+				continue
+			}
+			if rate == 0 {
+				rate = m.rate(cur.Currency, t)
+			}
+			*f.dst, set[i] = *f.src*rate, true
+		}
+	}
+	if m.priceOverride != nil {
+		out.ValorVendaOk = *m.priceOverride
+	}
+	return out
+}
+
+// boundaries retorna as trocas de vigência (versões do ativo e cotações) dentro de (start, end).
+func (m *costModel) boundaries(assetID uuid.UUID, sectorID *uuid.UUID, start, end time.Time) []time.Time {
+	seen := map[int64]bool{}
+	var out []time.Time
+	add := func(t time.Time) {
+		if t.After(start) && t.Before(end) && !seen[t.Unix()] {
+			seen[t.Unix()] = true
+			out = append(out, t)
+		}
+	}
+	for _, sc := range m.scopes(assetID, sectorID) {
+		for _, v := range m.versions[sc] {
+			add(v.from)
+		}
+	}
+	for _, list := range m.rates {
+		for _, r := range list {
+			add(r.from)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Before(out[j]) })
+	return out
+}
+
+// warningList retorna os avisos de conversão em ordem estável (nil sem avisos).
+func (m *costModel) warningList() []string {
+	var out []string
+	for w := range m.warnings {
+		out = append(out, w)
+	}
+	sort.Strings(out)
+	return out
+}
+
+// scheduledHours retorna as horas programadas do setor em [start, end).
+func (c *ProductionCalendar) scheduledHours(sectorID *uuid.UUID, start, end time.Time) float64 {
+	var h float64
+	for _, r := range c.Scheduled(sectorID, start, end) {
+		h += r.End.Sub(r.Start).Hours()
+	}
+	return h
+}
+
+// shiftEquivalents retorna quantos turnos do setor cabem em sched horas programadas.
+func (c *ProductionCalendar) shiftEquivalents(sectorID *uuid.UUID, sched float64) float64 {
+	shiftHours := costShiftHours
+	if shifts := c.shiftsFor(sectorID); len(shifts) > 0 {
+		var total float64
+		for _, s := range shifts {
+			a, err1 := ParseClock(s.StartTime)
+			b, err2 := ParseClock(s.EndTime)
+			if err1 != nil || err2 != nil {
+				continue
+			}
+			if b <= a {
+				b += 24 * 60
+			}
+			total += float64(b-a) / 60
+		}
+		if total > 0 {
+			shiftHours = total / float64(len(shifts))
+		}
+	}
+	return sched / shiftHours
+}
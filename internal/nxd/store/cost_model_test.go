@@ -0,0 +1,123 @@
+package store
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCostModelResolve(t *testing.T) {
+	loc := time.FixedZone("BRT", -3*3600)
+	asset, other, sector := uuid.New(), uuid.New(), uuid.New()
+	f := func(v float64) *float64 { return &v }
+	m := newCostModel("BRL", []CostParameterRow{
+		{ValidFrom: "2024-01-01", ValorVendaOk: f(10), CustoRefugoUn: f(2), CustoParadaH: f(100), CustoMaterialUn: f(1), CustoMaoObraTurno: f(800)},
+		{ValidFrom: "2024-03-01", ValorVendaOk: f(12), CustoRefugoUn: f(2), CustoParadaH: f(100), CustoMaterialUn: f(1.5), CustoMaoObraTurno: f(800)},
+		{SectorID: &sector, ValidFrom: "2024-01-01", CustoParadaH: f(300)},
+		{AssetID: &asset, ValidFrom: "2024-02-15", Currency: "USD", CustoMaterialUn: f(0.5)},
+		{Product: "Tampa", ValidFrom: "2024-01-01", ValorVendaOk: f(20)},
+	}, []ExchangeRateRow{
+		{Currency: "USD", ValidFrom: "2024-02-01", Rate: 5},
+		{Currency: "USD", ValidFrom: "2024-03-10", Rate: 6},
+	}, loc)
+	m.fallback = CostValues{ValorVendaOk: 1}
+	day := func(mo, d int) time.Time { return time.Date(2024, time.Month(mo), d, 12, 0, 0, 0, loc) }
+
+	// Antes de qualquer versão: business_config.
+	if v := m.resolve(asset, &sector, time.Date(2023, 12, 31, 0, 0, 0, 0, loc)); v.ValorVendaOk != 1 || v.CustoParadaH != 0 {
+		t.Errorf("fallback = %+v", v)
+	}
+	// Fevereiro: setor sobrepõe só a parada; o ativo ainda não vale.
+	if v := m.resolve(asset, &sector, day(2, 10)); v.ValorVendaOk != 10 || v.CustoParadaH != 300 || v.CustoMaterialUn != 1 {
+		t.Errorf("fev = %+v", v)
+	}
+	// Ativo em USD convertido pela cotação vigente (5, depois 6); nova versão da fábrica em março.
+	if v := m.resolve(asset, &sector, day(3, 5)); v.ValorVendaOk != 12 || v.CustoMaterialUn != 2.5 || v.CustoMaoObraTurno != 800 {
+		t.Errorf("mar = %+v", v)
+	}
+	if v := m.resolve(asset, &sector, day(3, 20)); v.CustoMaterialUn != 3 {
+		t.Errorf("mar/20 = %+v", v)
+	}
+	// Outro ativo sem setor: só a fábrica.
+	if v := m.resolve(other, nil, day(3, 20)); v.CustoMaterialUn != 1.5 || v.CustoParadaH != 100 {
+		t.Errorf("other = %+v", v)
+	}
+	if w := m.warningList(); len(w) != 0 {
+		t.Errorf("warnings = %v", w)
+	}
+
+	// Produto vence ativo; preço da ordem vence tudo.
+	m.product = "Tampa"
+	if v := m.resolve(asset, &sector, day(3, 20)); v.ValorVendaOk != 20 || v.CustoMaterialUn != 3 {
+		t.Errorf("product = %+v", v)
+	}
+	m.priceOverride = f(25)
+	if v := m.resolve(asset, &sector, day(3, 20)); v.ValorVendaOk != 25 {
+		t.Errorf("override = %+v", v)
+	}
+
+	// Trocas de vigência dentro do período: versões dos escopos do ativo e cotações.
+	got := m.boundaries(asset, &sector, day(2, 1), day(3, 31))
+	want := []time.Time{
+		time.Date(2024, 2, 15, 0, 0, 0, 0, loc),
+		time.Date(2024, 3, 1, 0, 0, 0, 0, loc),
+		time.Date(2024, 3, 10, 0, 0, 0, 0, loc),
+	}
+	if len(got) != len(want) {
+		t.Fatalf("boundaries = %v", got)
+	}
+	for i := range want {
+		if !got[i].Equal(want[i]) {
+			t.Errorf("boundary %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestCostModelMissingRate(t *testing.T) {
+	v := 2.0
+	m := newCostModel("BRL", []CostParameterRow{{ValidFrom: "2024-01-01", Currency: "EUR", CustoMaterialUn: &v}}, nil, time.UTC)
+	if got := m.resolve(uuid.New(), nil, time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)); got.CustoMaterialUn != 2 {
+		t.Errorf("resolve = %+v", got)
+	}
+	if w := m.warningList(); len(w) != 1 {
+		t.Errorf("warnings = %v", w)
+	}
+}
+
+func TestShiftEquivalentsAndMargins(t *testing.T) {
+	loc := time.UTC
+	start := time.Date(2024, 3, 4, 0, 0, 0, 0, loc) // segunda
+	// Sem turnos: 24 h programadas = 3 turnos de 8 h.
+	if n := (&ProductionCalendar{Location: loc}).shiftEquivalents(nil, 24); n != 3 {
+		t.Errorf("24/7 = %v", n)
+	}
+	// Dois turnos de 6 h e 10 h (média 8 h) num dia útil: 16 h = 2 turnos.
+	cal := &ProductionCalendar{Location: loc, shifts: []ShiftRow{
+		{StartTime: "06:00", EndTime: "12:00", Weekdays: []int{1, 2, 3, 4, 5}},
+		{StartTime: "14:00", EndTime: "00:00", Weekdays: []int{1, 2, 3, 4, 5}},
+	}}
+	if h := cal.scheduledHours(nil, start, start.Add(24*time.Hour)); h != 16 {
+		t.Errorf("scheduled = %v", h)
+	}
+	if n := cal.shiftEquivalents(nil, 16); n != 2 {
+		t.Errorf("shifts = %v", n)
+	}
+
+	r := &FinancialAggregateResult{OKCount: 100, FaturamentoBruto: 1000, CustoMaterial: 200, PerdaRefugo: 50,
+		CustoEnergia: 150, CustoMaoObra: 300, CustoParada: 100}
+	r.fillMargins()
+	if r.CustosVariaveis != 400 || r.MargemContribuicao != 600 || r.ResultadoOperacional != 200 {
+		t.Errorf("margins = %+v", r)
+	}
+	if r.MargemContribuicaoPct == nil || math.Abs(*r.MargemContribuicaoPct-60) > 1e-9 ||
+		r.MargemContribuicaoPorPeca == nil || *r.MargemContribuicaoPorPeca != 6 {
+		t.Errorf("pct/per piece = %v / %v", r.MargemContribuicaoPct, r.MargemContribuicaoPorPeca)
+	}
+	empty := &FinancialAggregateResult{}
+	empty.fillMargins()
+	if empty.MargemContribuicaoPct != nil || empty.MargemContribuicaoPorPeca != nil {
+		t.Errorf("empty = %+v", empty)
+	}
+}
@@ -0,0 +1,182 @@
+package store
+
+// counters.go — Semântica de contador por tag (peças, refugo, kWh)
+//
+// Contadores de CLP zeram no meio do turno (reset manual, queda de energia, troca
+// de receita) ou dão a volta no limite do registrador (65535 em 16 bits). A regra
+// antiga (último − primeiro, negativo → 0) perdia toda a produção anterior ao reset.
+// Aqui o acréscimo do período é a soma dos deltas de cada segmento:
+//
+//   cur >= prev                          → cur − prev
+//   prev − cur <= reset_tolerance        → 0 (ruído; a referência continua em prev)
+//   rollover_at e queda > rollover_at/2  → rollover_at − prev + cur (volta no registrador)
+//   senão                                → cur (reset: o contador recomeçou do zero)
+//
+// A referência inicial é a última leitura até o início do período (até
+// counterLookback antes), então buckets adjacentes somam exatamente o total.
+// A leitura em lote (telemetry_batch.go: financeiro, energia, OEE) e
+// CounterTransform (gráficos: acréscimo por ponto ou taxa) usam a mesma regra.
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// counterLookback limita a busca da leitura de referência antes do período.
+const counterLookback = time.Hour
+
+// ErrInvalidCounterConfig — rollover_at <= 0, tolerância negativa ou metric_key vazio.
+var ErrInvalidCounterConfig = errors.New("configuração de contador inválida")
+
+// CounterConfigRow — semântica de contador de uma tag. Tags sem linha usam o padrão
+// (sem rollover, tolerância 0: qualquer queda é reset).
+type CounterConfigRow struct {
+	AssetID        uuid.UUID `json:"asset_id"`
+	MetricKey      string    `json:"metric_key"`
+	RolloverAt     *float64  `json:"rollover_at"`
+	ResetTolerance float64   `json:"reset_tolerance"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// ListCounterConfigs retorna as configurações de contador da fábrica.
+func ListCounterConfigs(db *sql.DB, factoryID uuid.UUID) ([]CounterConfigRow, error) {
+	rows, err := db.Query(`
+		SELECT asset_id, metric_key, rollover_at, reset_tolerance, updated_at
+		FROM nxd.counter_config WHERE factory_id = $1 ORDER BY asset_id, metric_key
+	`, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []CounterConfigRow
+	for rows.Next() {
+		var c CounterConfigRow
+		var rollover sql.NullFloat64
+		if err := rows.Scan(&c.AssetID, &c.MetricKey, &rollover, &c.ResetTolerance, &c.UpdatedAt); err != nil {
+			return nil, err
+		}
+		if rollover.Valid {
+			c.RolloverAt = &rollover.Float64
+		}
+		list = append(list, c)
+	}
+	return list, rows.Err()
+}
+
+// GetCounterConfig retorna a configuração da tag ou o padrão (erro de leitura = padrão).
+func GetCounterConfig(db *sql.DB, assetID uuid.UUID, metricKey string) CounterConfigRow {
+	c := CounterConfigRow{AssetID: assetID, MetricKey: metricKey}
+	var rollover sql.NullFloat64
+	err := db.QueryRow(`
+		SELECT rollover_at, reset_tolerance FROM nxd.counter_config WHERE asset_id = $1 AND metric_key = $2
+	`, assetID, metricKey).Scan(&rollover, &c.ResetTolerance)
+	if err == nil && rollover.Valid {
+		c.RolloverAt = &rollover.Float64
+	}
+	return c
+}
+
+// UpsertCounterConfig cria ou atualiza a configuração de uma tag do ativo (o ativo
+// deve pertencer à fábrica — verificado pelo handler).
+func UpsertCounterConfig(db *sql.DB, factoryID uuid.UUID, c CounterConfigRow) error {
+	c.MetricKey = strings.TrimSpace(c.MetricKey)
+	if c.MetricKey == "" {
+		return fmt.Errorf("%w: metric_key é obrigatório", ErrInvalidCounterConfig)
+	}
+	if c.RolloverAt != nil && *c.RolloverAt <= 0 {
+		return fmt.Errorf("%w: rollover_at deve ser positivo", ErrInvalidCounterConfig)
+	}
+	if c.ResetTolerance < 0 {
+		return fmt.Errorf("%w: reset_tolerance não pode ser negativo", ErrInvalidCounterConfig)
+	}
+	_, err := db.Exec(`
+		INSERT INTO nxd.counter_config (asset_id, metric_key, factory_id, rollover_at, reset_tolerance, updated_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		ON CONFLICT (asset_id, metric_key) DO UPDATE SET
+			rollover_at = EXCLUDED.rollover_at,
+			reset_tolerance = EXCLUDED.reset_tolerance,
+			updated_at = NOW()
+	`, c.AssetID, c.MetricKey, factoryID, c.RolloverAt, c.ResetTolerance)
+	return err
+}
+
+// DeleteCounterConfig volta a tag para o padrão. false = não havia configuração.
+func DeleteCounterConfig(db *sql.DB, factoryID, assetID uuid.UUID, metricKey string) (bool, error) {
+	res, err := db.Exec(`DELETE FROM nxd.counter_config WHERE factory_id = $1 AND asset_id = $2 AND metric_key = $3`,
+		factoryID, assetID, metricKey)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// counterAccum acumula o acréscimo de um contador leitura a leitura (ordem de ts).
+type counterAccum struct {
+	cfg       CounterConfigRow
+	prev      float64
+	has       bool
+	Increase  float64
+	Resets    int
+	Rollovers int
+}
+
+// add registra uma leitura e retorna o acréscimo desde a anterior (0 na primeira).
+func (c *counterAccum) add(v float64) float64 {
+	if !c.has {
+		c.prev, c.has = v, true
+		return 0
+	}
+	var inc float64
+	switch drop := c.prev - v; {
+	case drop <= 0:
+		inc = -drop
+	case drop <= c.cfg.ResetTolerance:
+		return 0 // ruído: mantém a referência mais alta
+	case c.cfg.RolloverAt != nil && drop > *c.cfg.RolloverAt/2:
+		inc = *c.cfg.RolloverAt - c.prev + v
+		c.Rollovers++
+	default:
+		inc = v
+		c.Resets++
+	}
+	c.prev = v
+	c.Increase += inc
+	return inc
+}
+
+// CounterTransform converte a série de um contador (um ativo, uma tag, ordem de ts)
+// em acréscimo por leitura (mode "increase") ou taxa por perSeconds ("rate").
+// A primeira leitura é só referência e não gera ponto.
+func CounterTransform(points []TelemetryPoint, cfg CounterConfigRow, mode string, perSeconds float64) []TelemetryPoint {
+	c := counterAccum{cfg: cfg}
+	out := make([]TelemetryPoint, 0, len(points))
+	var prevTs time.Time
+	var pending float64 // acréscimo de leituras com o mesmo ts, somado à próxima taxa
+	for i, p := range points {
+		inc := c.add(p.MetricValue)
+		if i == 0 {
+			prevTs = p.Ts
+			continue
+		}
+		v := inc
+		if mode == "rate" {
+			dt := p.Ts.Sub(prevTs).Seconds()
+			if dt <= 0 {
+				pending += inc
+				continue
+			}
+			v = (inc + pending) / dt * perSeconds
+			pending = 0
+		}
+		prevTs = p.Ts
+		p.MetricValue = v
+		out = append(out, p)
+	}
+	return out
+}
@@ -0,0 +1,60 @@
+package store
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCounterAccumResetAndRollover(t *testing.T) {
+	rollover := 65536.0
+	cases := []struct {
+		name      string
+		cfg       CounterConfigRow
+		values    []float64
+		want      float64
+		resets    int
+		rollovers int
+	}{
+		// Reset no meio do turno: 1000→1400 e depois 0→250.
+		{"reset", CounterConfigRow{}, []float64{1000, 1200, 1400, 0, 100, 250}, 650, 1, 0},
+		// Reset sem leitura em zero: a primeira leitura após o reset já é produção.
+		{"reset sem zero", CounterConfigRow{}, []float64{500, 600, 30}, 130, 1, 0},
+		// 16 bits: 65500 → 65535 → 20 (volta) → 80.
+		{"rollover", CounterConfigRow{RolloverAt: &rollover}, []float64{65500, 65535, 20, 80}, 116, 0, 1},
+		// Com rollover configurado, queda pequena continua sendo reset.
+		{"reset com rollover", CounterConfigRow{RolloverAt: &rollover}, []float64{300, 400, 10}, 110, 1, 0},
+		// Ruído de ±1 não vira reset nem conta em dobro quando o valor volta.
+		{"ruído", CounterConfigRow{ResetTolerance: 1}, []float64{100, 101, 100, 101, 105}, 5, 0, 0},
+	}
+	for _, c := range cases {
+		acc := counterAccum{cfg: c.cfg}
+		for _, v := range c.values {
+			acc.add(v)
+		}
+		if acc.Increase != c.want || acc.Resets != c.resets || acc.Rollovers != c.rollovers {
+			t.Errorf("%s: increase=%v resets=%d rollovers=%d, want %v/%d/%d",
+				c.name, acc.Increase, acc.Resets, acc.Rollovers, c.want, c.resets, c.rollovers)
+		}
+	}
+}
+
+func TestCounterTransform(t *testing.T) {
+	t0 := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	pts := []TelemetryPoint{
+		{Ts: t0, MetricValue: 100},
+		{Ts: t0.Add(time.Minute), MetricValue: 110},
+		{Ts: t0.Add(2 * time.Minute), MetricValue: 5}, // reset
+		{Ts: t0.Add(3 * time.Minute), MetricValue: 35},
+	}
+	inc := CounterTransform(pts, CounterConfigRow{}, "increase", 0)
+	if len(inc) != 3 || inc[0].MetricValue != 10 || inc[1].MetricValue != 5 || inc[2].MetricValue != 30 {
+		t.Fatalf("increase = %+v", inc)
+	}
+	rate := CounterTransform(pts, CounterConfigRow{}, "rate", 3600)
+	if len(rate) != 3 || rate[2].MetricValue != 1800 {
+		t.Fatalf("rate = %+v", rate)
+	}
+	if pts[1].MetricValue != 110 {
+		t.Error("transform must not modify the input")
+	}
+}
@@ -0,0 +1,762 @@
+package store
+
+// cycle_times.go — Tempo de ciclo extraído dos contadores/sinais do CLP
+//
+// Fontes por ativo (nxd.tag_mapping):
+//   tag_cycle     → sinal de ciclo concluído: cada borda de subida (< 0.5 → >= 0.5) é um ciclo
+//   tag_ok/nok    → sem tag_cycle, os acréscimos dos contadores de peças (semântica de
+//                   counters.go; reading_rule "absolute" não serve) somados por ts;
+//                   cycle_pieces peças = 1 ciclo (moldes com várias cavidades)
+//
+// A duração do ciclo é o intervalo desde a conclusão anterior. Uma leitura que
+// traz k ciclos de uma vez (amostragem mais lenta que o ciclo) vira k ciclos com
+// a duração média — para ciclos individuais a tag deve ser lida mais rápido que o ciclo.
+//
+// Classificação contra o ciclo ideal por ciclo (ideal_cycle_s × cycle_pieces):
+//   duração > cycleStopAfter(ideal)         → parada: fora da distribuição, contada à parte
+//   duração > cycleMicroStopFactor × ideal  → micro-parada (entra na distribuição; perda = duração − ideal)
+// Sem ideal_cycle_s não há micro-paradas e o corte de parada é cycleStopMinS.
+//
+// O extrator (RunCycleTimeWorker) processa lotes após o cursor do ativo e soma em
+// nxd.cycle_time_stats por ativo, hora e ordem de produção em execução no fim do
+// ciclo (ordem do ativo > do setor > da fábrica). Cada linha guarda somas,
+// mínimo/máximo e um histograma logarítmico (cycleHistPerOctave faixas por oitava a
+// partir de cycleHistBaseS), de onde saem média, desvio e percentis de qualquer
+// agregação sem reler a telemetria. Resolução do relatório: 1 hora.
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	cycleTimeWorkerInterval  = time.Minute
+	cycleTimeInitialLookback = 7 * 24 * time.Hour
+	cycleTimeBatchSize       = 10000
+	cycleTimeMaxBuckets      = 500
+
+	cycleMicroStopFactor = 1.5
+	cycleStopFactor      = 5.0
+	cycleStopMinS        = 300.0
+
+	cycleHistBaseS     = 0.1
+	cycleHistPerOctave = 16
+	cycleHistBins      = 15 * cycleHistPerOctave // 0.1 s .. ~55 min
+	cycleSignalOn      = 0.5
+)
+
+// ErrInvalidCycleTimeQuery — bucket que não é múltiplo de 1 h ou tendência longa demais.
+var ErrInvalidCycleTimeQuery = errors.New("consulta de tempo de ciclo inválida")
+
+// CycleTimeQuery define escopo, período e tendência (Bucket 0 = sem tendência; múltiplo de 1 h).
+type CycleTimeQuery struct {
+	FactoryID  uuid.UUID
+	AssetID    *uuid.UUID
+	OrderID    *uuid.UUID
+	Start, End time.Time
+	Bucket     time.Duration
+}
+
+// CycleTimeStats — distribuição dos ciclos de um escopo (total, ativo, ordem ou bucket).
+type CycleTimeStats struct {
+	ID            *uuid.UUID `json:"id,omitempty"`
+	Name          string     `json:"name,omitempty"`
+	Cycles        int64      `json:"cycles"`
+	MeanS         *float64   `json:"mean_s"`
+	StdS          *float64   `json:"std_s"`
+	MinS          *float64   `json:"min_s"`
+	MaxS          *float64   `json:"max_s"`
+	P50S          *float64   `json:"p50_s"`
+	P90S          *float64   `json:"p90_s"`
+	P95S          *float64   `json:"p95_s"`
+	P99S          *float64   `json:"p99_s"`
+	IdealS        *float64   `json:"ideal_s"`         // ciclo ideal (média ponderada pelos ciclos)
+	IdealRatioPct *float64   `json:"ideal_ratio_pct"` // ideal / médio × 100 (100 = no ideal)
+	MicroStops    int64      `json:"micro_stops"`
+	MicroStopS    float64    `json:"micro_stop_s"` // tempo acima do ideal nas micro-paradas
+	MicroStopPct  *float64   `json:"micro_stop_pct"`
+	Stops         int64      `json:"stops"`
+	StopS         float64    `json:"stop_s"`
+}
+
+// CycleTimeBin — faixa do histograma [FromS, ToS).
+type CycleTimeBin struct {
+	FromS float64 `json:"from_s"`
+	ToS   float64 `json:"to_s"`
+	Count int64   `json:"count"`
+}
+
+// CycleTimePoint — ponto da tendência.
+type CycleTimePoint struct {
+	BucketStart time.Time `json:"bucket_start"`
+	BucketEnd   time.Time `json:"bucket_end"`
+	CycleTimeStats
+}
+
+// CycleTimeReport — resultado de ComputeCycleTimes. Start é truncado para a hora cheia.
+type CycleTimeReport struct {
+	Start     time.Time        `json:"start"`
+	End       time.Time        `json:"end"`
+	Total     CycleTimeStats   `json:"total"`
+	Histogram []CycleTimeBin   `json:"histogram"`
+	Assets    []CycleTimeStats `json:"assets"`
+	Orders    []CycleTimeStats `json:"orders"`
+	BucketS   int64            `json:"bucket_s,omitempty"`
+	Trend     []CycleTimePoint `json:"trend,omitempty"`
+}
+
+// cycleStopAfter é a duração a partir da qual o intervalo é parada, não ciclo.
+func cycleStopAfter(idealS float64) float64 {
+	return math.Max(cycleStopMinS, cycleStopFactor*idealS)
+}
+
+// cycleHistBin retorna a faixa do histograma da duração (fora da escala = primeira/última).
+func cycleHistBin(d float64) int {
+	if d <= cycleHistBaseS {
+		return 0
+	}
+	i := int(math.Floor(math.Log2(d/cycleHistBaseS) * cycleHistPerOctave))
+	if i >= cycleHistBins {
+		return cycleHistBins - 1
+	}
+	return i
+}
+
+// cycleHistEdges retorna os limites [lo, hi) da faixa i.
+func cycleHistEdges(i int) (float64, float64) {
+	return cycleHistBaseS * math.Exp2(float64(i)/cycleHistPerOctave),
+		cycleHistBaseS * math.Exp2(float64(i+1)/cycleHistPerOctave)
+}
+
+// cycleAgg acumula ciclos (extrator) ou linhas de cycle_time_stats (relatório).
+type cycleAgg struct {
+	cycles      int64
+	sum, sumSq  float64
+	min, max    float64
+	hist        []int64
+	idealSum    float64 // Σ ideal × ciclos das linhas com ideal
+	idealCycles int64
+	micro       int64
+	microS      float64
+	stops       int64
+	stopS       float64
+}
+
+// add classifica n ciclos de duração d contra o ideal por ciclo (0 = sem ideal).
+func (a *cycleAgg) add(d float64, n int, idealS float64) {
+	if d > cycleStopAfter(idealS) {
+		a.stops++
+		a.stopS += d * float64(n)
+		return
+	}
+	if a.hist == nil {
+		a.hist = make([]int64, cycleHistBins)
+	}
+	if a.cycles == 0 || d < a.min {
+		a.min = d
+	}
+	if a.cycles == 0 || d > a.max {
+		a.max = d
+	}
+	k := int64(n)
+	a.cycles += k
+	a.sum += d * float64(n)
+	a.sumSq += d * d * float64(n)
+	a.hist[cycleHistBin(d)] += k
+	if idealS > 0 {
+		a.idealSum += idealS * float64(n)
+		a.idealCycles += k
+		if d > cycleMicroStopFactor*idealS {
+			a.micro += k
+			a.microS += (d - idealS) * float64(n)
+		}
+	}
+}
+
+// merge soma outro acumulador.
+func (a *cycleAgg) merge(b *cycleAgg) {
+	if b.cycles > 0 {
+		if a.cycles == 0 || b.min < a.min {
+			a.min = b.min
+		}
+		if a.cycles == 0 || b.max > a.max {
+			a.max = b.max
+		}
+		if a.hist == nil {
+			a.hist = make([]int64, cycleHistBins)
+		}
+		for i := 0; i < len(b.hist) && i < cycleHistBins; i++ {
+			a.hist[i] += b.hist[i]
+		}
+	}
+	a.cycles += b.cycles
+	a.sum += b.sum
+	a.sumSq += b.sumSq
+	a.idealSum += b.idealSum
+	a.idealCycles += b.idealCycles
+	a.micro += b.micro
+	a.microS += b.microS
+	a.stops += b.stops
+	a.stopS += b.stopS
+}
+
+// percentile estima o percentil p (0..1) pelo histograma, interpolando na faixa
+// em escala log e limitando a [min, max].
+func (a *cycleAgg) percentile(p float64) float64 {
+	target := p * float64(a.cycles)
+	var cum float64
+	for i, c := range a.hist {
+		if c == 0 {
+			continue
+		}
+		if cum+float64(c) >= target {
+			lo, hi := cycleHistEdges(i)
+			v := lo * math.Pow(hi/lo, (target-cum)/float64(c))
+			return math.Min(math.Max(v, a.min), a.max)
+		}
+		cum += float64(c)
+	}
+	return a.max
+}
+
+func (a *cycleAgg) stats() CycleTimeStats {
+	s := CycleTimeStats{Cycles: a.cycles, MicroStops: a.micro, MicroStopS: a.microS, Stops: a.stops, StopS: a.stopS}
+	if a.cycles == 0 {
+		return s
+	}
+	f := func(x float64) *float64 { return &x }
+	n := float64(a.cycles)
+	mean := a.sum / n
+	s.MeanS = f(mean)
+	s.StdS = f(math.Sqrt(math.Max(0, a.sumSq/n-mean*mean)))
+	s.MinS, s.MaxS = f(a.min), f(a.max)
+	s.P50S, s.P90S = f(a.percentile(0.5)), f(a.percentile(0.9))
+	s.P95S, s.P99S = f(a.percentile(0.95)), f(a.percentile(0.99))
+	s.MicroStopPct = f(float64(a.micro) / n * 100)
+	if a.idealCycles > 0 {
+		ideal := a.idealSum / float64(a.idealCycles)
+		s.IdealS = &ideal
+		if mean > 0 {
+			s.IdealRatioPct = f(ideal / mean * 100)
+		}
+	}
+	return s
+}
+
+// bins retorna as faixas não vazias do histograma.
+func (a *cycleAgg) bins() []CycleTimeBin {
+	out := []CycleTimeBin{}
+	for i, c := range a.hist {
+		if c > 0 {
+			lo, hi := cycleHistEdges(i)
+			out = append(out, CycleTimeBin{FromS: lo, ToS: hi, Count: c})
+		}
+	}
+	return out
+}
+
+// ─── Extração ───────────────────────────────────────────────────────────────
+
+// cycleReading — leitura de uma das tags de ciclo (ordem de ts).
+type cycleReading struct {
+	ts  time.Time
+	key string
+	v   float64
+}
+
+// cycleSample — n ciclos concluídos em end, cada um com duração durS.
+type cycleSample struct {
+	end  time.Time
+	durS float64
+	n    int
+}
+
+// cycleSource — tags do ativo usadas na extração.
+type cycleSource struct {
+	tagOK, tagNOK, tagCycle string
+	pieces                  int
+}
+
+// cycleState — estado do extrator entre lotes (persistido em nxd.cycle_cursor).
+type cycleState struct {
+	lastCycle *time.Time
+	ok, nok   counterAccum
+	signal    *float64
+	pending   float64 // peças que ainda não completam um ciclo
+}
+
+// feed processa leituras em ordem de ts e retorna os ciclos com duração. A
+// primeira conclusão sem referência anterior só marca o início.
+func (s *cycleState) feed(src cycleSource, readings []cycleReading) []cycleSample {
+	var out []cycleSample
+	complete := func(ts time.Time, k int) {
+		if k <= 0 {
+			return
+		}
+		if s.lastCycle != nil && ts.After(*s.lastCycle) {
+			out = append(out, cycleSample{end: ts, durS: ts.Sub(*s.lastCycle).Seconds() / float64(k), n: k})
+		}
+		t := ts
+		s.lastCycle = &t
+	}
+	pieces := float64(src.pieces)
+	if pieces < 1 {
+		pieces = 1
+	}
+	for i, r := range readings {
+		if src.tagCycle != "" {
+			if r.key != src.tagCycle {
+				continue
+			}
+			if s.signal != nil && *s.signal < cycleSignalOn && r.v >= cycleSignalOn {
+				complete(r.ts, 1)
+			}
+			v := r.v
+			s.signal = &v
+			continue
+		}
+		switch r.key {
+		case src.tagOK:
+			s.pending += s.ok.add(r.v)
+		case src.tagNOK:
+			s.pending += s.nok.add(r.v)
+		}
+		// OK e NOK do mesmo ciclo podem chegar no mesmo ts: fecha ao fim do grupo.
+		if i+1 < len(readings) && readings[i+1].ts.Equal(r.ts) {
+			continue
+		}
+		k := int(math.Floor(s.pending/pieces + 1e-9))
+		s.pending -= float64(k) * pieces
+		complete(r.ts, k)
+	}
+	return out
+}
+
+// cycleOrder — ordem de produção candidata à atribuição dos ciclos.
+type cycleOrder struct {
+	id        uuid.UUID
+	assetID   *uuid.UUID
+	sectorID  *uuid.UUID
+	startedAt time.Time
+	endedAt   *time.Time
+}
+
+// pickCycleOrder retorna a ordem em execução em ts (ativo > setor > fábrica;
+// no mesmo nível, a mais recente). uuid.Nil = nenhuma.
+func pickCycleOrder(orders []cycleOrder, ts time.Time) uuid.UUID {
+	best, bestTier := -1, -1
+	for i, o := range orders {
+		if o.startedAt.After(ts) || (o.endedAt != nil && !ts.Before(*o.endedAt)) {
+			continue
+		}
+		tier := 0
+		if o.assetID != nil {
+			tier = 2
+		} else if o.sectorID != nil {
+			tier = 1
+		}
+		if tier > bestTier || (tier == bestTier && o.startedAt.After(orders[best].startedAt)) {
+			best, bestTier = i, tier
+		}
+	}
+	if best < 0 {
+		return uuid.Nil
+	}
+	return orders[best].id
+}
+
+type cycleBucketKey struct {
+	hour  time.Time
+	order uuid.UUID
+}
+
+// ExtractCycleTimes processa as leituras novas das tags de ciclo de cada ativo
+// (factoryID nil = todas as fábricas). Retorna os ciclos registrados.
+func ExtractCycleTimes(ctx context.Context, db *sql.DB, factoryID *uuid.UUID) (int64, error) {
+	query := `
+		SELECT a.id, a.factory_id, a.group_id, COALESCE(t.tag_ok,''), COALESCE(t.tag_nok,''), COALESCE(t.tag_cycle,''),
+			COALESCE(t.reading_rule,'delta'), t.ideal_cycle_s, t.cycle_pieces
+		FROM nxd.tag_mapping t
+		JOIN nxd.assets a ON a.id = t.asset_id
+		WHERE (COALESCE(t.tag_cycle,'') <> '' OR COALESCE(t.tag_ok,'') <> '' OR COALESCE(t.tag_nok,'') <> '')`
+	args := []interface{}{}
+	if factoryID != nil {
+		query += ` AND a.factory_id = $1`
+		args = append(args, *factoryID)
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	type target struct {
+		assetID, factoryID uuid.UUID
+		sectorID           uuid.NullUUID
+		src                cycleSource
+		idealS             float64
+	}
+	var targets []target
+	for rows.Next() {
+		var t target
+		var rule string
+		var ideal sql.NullFloat64
+		if err := rows.Scan(&t.assetID, &t.factoryID, &t.sectorID, &t.src.tagOK, &t.src.tagNOK, &t.src.tagCycle,
+			&rule, &ideal, &t.src.pieces); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if t.src.tagCycle == "" && rule == "absolute" {
+			continue
+		}
+		if ideal.Valid && ideal.Float64 > 0 {
+			t.idealS = ideal.Float64 * float64(t.src.pieces)
+		}
+		targets = append(targets, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	var total int64
+	for _, t := range targets {
+		if ctx.Err() != nil {
+			return total, ctx.Err()
+		}
+		var sectorID *uuid.UUID
+		if t.sectorID.Valid {
+			sectorID = &t.sectorID.UUID
+		}
+		n, err := extractAssetCycles(ctx, db, t.factoryID, t.assetID, sectorID, t.src, t.idealS)
+		if err != nil {
+			return total, fmt.Errorf("ativo %s: %w", t.assetID, err)
+		}
+		total += n
+	}
+	return total, nil
+}
+
+// extractAssetCycles processa um lote de leituras após o cursor do ativo, em uma transação.
+func extractAssetCycles(ctx context.Context, db *sql.DB, factoryID, assetID uuid.UUID, sectorID *uuid.UUID, src cycleSource, idealS float64) (int64, error) {
+	st := cycleState{
+		ok:  counterAccum{cfg: GetCounterConfig(db, assetID, src.tagOK)},
+		nok: counterAccum{cfg: GetCounterConfig(db, assetID, src.tagNOK)},
+	}
+	keys := []string{src.tagCycle}
+	if src.tagCycle == "" {
+		keys = []string{src.tagOK, src.tagNOK}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var since time.Time
+	var lastCycle sql.NullTime
+	var prevOK, prevNOK, prevSignal sql.NullFloat64
+	err = tx.QueryRowContext(ctx, `
+		SELECT last_ts, last_cycle_at, prev_ok, prev_nok, prev_signal, pending_pieces
+		FROM nxd.cycle_cursor WHERE asset_id = $1
+	`, assetID).Scan(&since, &lastCycle, &prevOK, &prevNOK, &prevSignal, &st.pending)
+	if err == sql.ErrNoRows {
+		since = time.Now().Add(-cycleTimeInitialLookback)
+	} else if err != nil {
+		return 0, err
+	}
+	if lastCycle.Valid {
+		st.lastCycle = &lastCycle.Time
+	}
+	st.ok.prev, st.ok.has = prevOK.Float64, prevOK.Valid
+	st.nok.prev, st.nok.has = prevNOK.Float64, prevNOK.Valid
+	if prevSignal.Valid {
+		st.signal = &prevSignal.Float64
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT ts, metric_key, metric_value FROM nxd.telemetry_log
+		WHERE asset_id = $1 AND metric_key = ANY($2) AND ts > $3 AND metric_value IS NOT NULL
+		ORDER BY ts ASC, metric_key LIMIT $4
+	`, assetID, pq.Array(keys), since, cycleTimeBatchSize)
+	if err != nil {
+		return 0, err
+	}
+	var readings []cycleReading
+	for rows.Next() {
+		var r cycleReading
+		if err := rows.Scan(&r.ts, &r.key, &r.v); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		readings = append(readings, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	if len(readings) == 0 {
+		return 0, nil
+	}
+	// Lote cheio: o último ts pode ter leituras no próximo lote — fica para ele.
+	if len(readings) == cycleTimeBatchSize {
+		last := readings[len(readings)-1].ts
+		i := len(readings)
+		for i > 0 && readings[i-1].ts.Equal(last) {
+			i--
+		}
+		if i > 0 {
+			readings = readings[:i]
+		}
+	}
+	samples := st.feed(src, readings)
+	first, last := readings[0].ts, readings[len(readings)-1].ts
+
+	var orders []cycleOrder
+	if len(samples) > 0 {
+		orows, err := tx.QueryContext(ctx, `
+			SELECT id, asset_id, sector_id, started_at, ended_at FROM nxd.production_orders
+			WHERE factory_id = $1 AND started_at IS NOT NULL AND started_at <= $4
+				AND (ended_at IS NULL OR ended_at > $3)
+				AND (asset_id = $2 OR (asset_id IS NULL AND (sector_id IS NULL OR sector_id = $5)))
+		`, factoryID, assetID, first, last, sectorID)
+		if err != nil {
+			return 0, err
+		}
+		for orows.Next() {
+			var o cycleOrder
+			var a, s uuid.NullUUID
+			var ended sql.NullTime
+			if err := orows.Scan(&o.id, &a, &s, &o.startedAt, &ended); err != nil {
+				orows.Close()
+				return 0, err
+			}
+			if a.Valid {
+				o.assetID = &a.UUID
+			}
+			if s.Valid {
+				o.sectorID = &s.UUID
+			}
+			if ended.Valid {
+				o.endedAt = &ended.Time
+			}
+			orders = append(orders, o)
+		}
+		orows.Close()
+		if err := orows.Err(); err != nil {
+			return 0, err
+		}
+	}
+
+	buckets := map[cycleBucketKey]*cycleAgg{}
+	var cycles int64
+	for _, s := range samples {
+		key := cycleBucketKey{hour: s.end.UTC().Truncate(time.Hour), order: pickCycleOrder(orders, s.end)}
+		agg := buckets[key]
+		if agg == nil {
+			agg = &cycleAgg{}
+			buckets[key] = agg
+		}
+		before := agg.cycles
+		agg.add(s.durS, s.n, idealS)
+		cycles += agg.cycles - before
+	}
+	var ideal *float64
+	if idealS > 0 {
+		ideal = &idealS
+	}
+	for key, agg := range buckets {
+		var orderID *uuid.UUID
+		if key.order != uuid.Nil {
+			o := key.order
+			orderID = &o
+		}
+		hist := agg.hist
+		if hist == nil {
+			hist = make([]int64, cycleHistBins)
+		}
+		var minS, maxS *float64
+		if agg.cycles > 0 {
+			minS, maxS = &agg.min, &agg.max
+		}
+		if _, err := tx.ExecContext(ctx, `
+			INSERT INTO nxd.cycle_time_stats (factory_id, asset_id, bucket_start, order_id, cycles, sum_s, sum_sq_s,
+				min_s, max_s, hist, ideal_s, micro_stops, micro_stop_s, stops, stop_s, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, NOW())
+			ON CONFLICT (asset_id, bucket_start, COALESCE(order_id, '00000000-0000-0000-0000-000000000000'::uuid)) DO UPDATE SET
+				cycles = nxd.cycle_time_stats.cycles + EXCLUDED.cycles,
+				sum_s = nxd.cycle_time_stats.sum_s + EXCLUDED.sum_s,
+				sum_sq_s = nxd.cycle_time_stats.sum_sq_s + EXCLUDED.sum_sq_s,
+				min_s = LEAST(nxd.cycle_time_stats.min_s, EXCLUDED.min_s),
+				max_s = GREATEST(nxd.cycle_time_stats.max_s, EXCLUDED.max_s),
+				hist = ARRAY(SELECT COALESCE(h.a, 0) + COALESCE(h.b, 0)
+					FROM unnest(nxd.cycle_time_stats.hist, EXCLUDED.hist) WITH ORDINALITY AS h(a, b, i) ORDER BY h.i),
+				ideal_s = COALESCE(EXCLUDED.ideal_s, nxd.cycle_time_stats.ideal_s),
+				micro_stops = nxd.cycle_time_stats.micro_stops + EXCLUDED.micro_stops,
+				micro_stop_s = nxd.cycle_time_stats.micro_stop_s + EXCLUDED.micro_stop_s,
+				stops = nxd.cycle_time_stats.stops + EXCLUDED.stops,
+				stop_s = nxd.cycle_time_stats.stop_s + EXCLUDED.stop_s,
+				updated_at = NOW()
+		`, factoryID, assetID, key.hour, orderID, agg.cycles, agg.sum, agg.sumSq, minS, maxS, pq.Array(hist), ideal,
+			agg.micro, agg.microS, agg.stops, agg.stopS); err != nil {
+			return 0, err
+		}
+	}
+
+	var prevOKArg, prevNOKArg *float64
+	if st.ok.has {
+		prevOKArg = &st.ok.prev
+	}
+	if st.nok.has {
+		prevNOKArg = &st.nok.prev
+	}
+	if _, err = tx.ExecContext(ctx, `
+		INSERT INTO nxd.cycle_cursor (asset_id, last_ts, last_cycle_at, prev_ok, prev_nok, prev_signal, pending_pieces, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+		ON CONFLICT (asset_id) DO UPDATE SET
+			last_ts = EXCLUDED.last_ts,
+			last_cycle_at = EXCLUDED.last_cycle_at,
+			prev_ok = EXCLUDED.prev_ok,
+			prev_nok = EXCLUDED.prev_nok,
+			prev_signal = EXCLUDED.prev_signal,
+			pending_pieces = EXCLUDED.pending_pieces,
+			updated_at = NOW()
+	`, assetID, last, st.lastCycle, prevOKArg, prevNOKArg, st.signal, st.pending); err != nil {
+		return 0, err
+	}
+	return cycles, tx.Commit()
+}
+
+// RunCycleTimeWorker extrai tempos de ciclo das leituras novas a cada minuto.
+func RunCycleTimeWorker(ctx context.Context, db *sql.DB) {
+	log.Println("✓ [CycleTime] Extrator de tempo de ciclo iniciado (intervalo: 1m)")
+	ticker := time.NewTicker(cycleTimeWorkerInterval)
+	defer ticker.Stop()
+	for {
+		n, err := ExtractCycleTimes(ctx, db, nil)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("⚠️  [CycleTime] %v", err)
+		} else if n > 0 {
+			log.Printf("⏱  [CycleTime] %d ciclo(s) registrado(s)", n)
+		}
+		select {
+		case <-ctx.Done():
+			log.Println("⏹  [CycleTime] Shutdown signal received, worker stopping.")
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ─── Relatório ──────────────────────────────────────────────────────────────
+
+// ComputeCycleTimes agrega cycle_time_stats do período: total com histograma,
+// quebra por ativo e por ordem e, com q.Bucket, tendência.
+func ComputeCycleTimes(db *sql.DB, q CycleTimeQuery) (*CycleTimeReport, error) {
+	start := q.Start.Truncate(time.Hour)
+	var nBuckets int
+	if q.Bucket > 0 {
+		if q.Bucket%time.Hour != 0 {
+			return nil, fmt.Errorf("%w: bucket deve ser múltiplo de 1h", ErrInvalidCycleTimeQuery)
+		}
+		nBuckets = int((q.End.Sub(start) + q.Bucket - 1) / q.Bucket)
+		if nBuckets > cycleTimeMaxBuckets {
+			return nil, fmt.Errorf("%w: tendência com %d buckets (máximo %d): aumente o bucket",
+				ErrInvalidCycleTimeQuery, nBuckets, cycleTimeMaxBuckets)
+		}
+	}
+	rows, err := db.Query(`
+		SELECT s.asset_id, a.display_name, s.order_id, COALESCE(o.order_code, ''), s.bucket_start, s.cycles, s.sum_s, s.sum_sq_s,
+			s.min_s, s.max_s, s.hist, s.ideal_s, s.micro_stops, s.micro_stop_s, s.stops, s.stop_s
+		FROM nxd.cycle_time_stats s
+		JOIN nxd.assets a ON a.id = s.asset_id
+		LEFT JOIN nxd.production_orders o ON o.id = s.order_id
+		WHERE s.factory_id = $1 AND s.bucket_start >= $2 AND s.bucket_start < $3
+			AND ($4::uuid IS NULL OR s.asset_id = $4) AND ($5::uuid IS NULL OR s.order_id = $5)
+	`, q.FactoryID, start, q.End, q.AssetID, q.OrderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	type group struct {
+		id   uuid.UUID
+		name string
+		agg  cycleAgg
+	}
+	var total cycleAgg
+	assets := map[uuid.UUID]*group{}
+	orders := map[uuid.UUID]*group{}
+	trend := make([]cycleAgg, nBuckets)
+	for rows.Next() {
+		var assetID uuid.UUID
+		var orderID uuid.NullUUID
+		var assetName, orderCode string
+		var bucket time.Time
+		var minS, maxS, ideal sql.NullFloat64
+		var hist pq.Int64Array
+		var a cycleAgg
+		if err := rows.Scan(&assetID, &assetName, &orderID, &orderCode, &bucket, &a.cycles, &a.sum, &a.sumSq,
+			&minS, &maxS, &hist, &ideal, &a.micro, &a.microS, &a.stops, &a.stopS); err != nil {
+			return nil, err
+		}
+		a.min, a.max, a.hist = minS.Float64, maxS.Float64, hist
+		if ideal.Valid {
+			a.idealSum, a.idealCycles = ideal.Float64*float64(a.cycles), a.cycles
+		}
+		total.merge(&a)
+		g := assets[assetID]
+		if g == nil {
+			g = &group{id: assetID, name: assetName}
+			assets[assetID] = g
+		}
+		g.agg.merge(&a)
+		if orderID.Valid {
+			g := orders[orderID.UUID]
+			if g == nil {
+				g = &group{id: orderID.UUID, name: orderCode}
+				orders[orderID.UUID] = g
+			}
+			g.agg.merge(&a)
+		}
+		if nBuckets > 0 {
+			if i := int(bucket.Sub(start) / q.Bucket); i >= 0 && i < nBuckets {
+				trend[i].merge(&a)
+			}
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	report := &CycleTimeReport{Start: start, End: q.End, Total: total.stats(), Histogram: total.bins(),
+		Assets: []CycleTimeStats{}, Orders: []CycleTimeStats{}}
+	flatten := func(m map[uuid.UUID]*group) []CycleTimeStats {
+		out := make([]CycleTimeStats, 0, len(m))
+		for _, g := range m {
+			s := g.agg.stats()
+			id := g.id
+			s.ID, s.Name = &id, g.name
+			out = append(out, s)
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+		return out
+	}
+	report.Assets, report.Orders = flatten(assets), flatten(orders)
+	if nBuckets > 0 {
+		report.BucketS = int64(q.Bucket / time.Second)
+		report.Trend = make([]CycleTimePoint, nBuckets)
+		for i := range trend {
+			bs := start.Add(time.Duration(i) * q.Bucket)
+			report.Trend[i] = CycleTimePoint{BucketStart: bs, BucketEnd: bs.Add(q.Bucket), CycleTimeStats: trend[i].stats()}
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,127 @@
+package store
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCycleStateFeed(t *testing.T) {
+	t0 := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+	at := func(s float64) time.Time { return t0.Add(time.Duration(s * float64(time.Second))) }
+
+	// Contadores com 2 cavidades: OK e NOK do mesmo ciclo no mesmo ts fecham um ciclo.
+	src := cycleSource{tagOK: "ok", tagNOK: "nok", pieces: 2}
+	var st cycleState
+	got := st.feed(src, []cycleReading{
+		{at(0), "nok", 5}, {at(0), "ok", 100},
+		{at(10), "ok", 102}, // 1º ciclo: só referência
+		{at(22), "nok", 6}, {at(22), "ok", 103},
+		{at(30), "ok", 104}, // 1 peça pendente
+		{at(40), "ok", 105}, // completa o ciclo
+		{at(100), "ok", 111},
+	})
+	want := []cycleSample{{at(22), 12, 1}, {at(40), 18, 1}, {at(100), 20, 3}}
+	if len(got) != len(want) {
+		t.Fatalf("ciclos = %+v", got)
+	}
+	for i := range want {
+		if !got[i].end.Equal(want[i].end) || math.Abs(got[i].durS-want[i].durS) > 1e-9 || got[i].n != want[i].n {
+			t.Errorf("ciclo %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if st.pending != 0 || !st.lastCycle.Equal(at(100)) {
+		t.Errorf("estado = %+v", st)
+	}
+	// Continuação no lote seguinte (estado do cursor): o reset do contador conta as peças novas.
+	got = st.feed(src, []cycleReading{{at(130), "ok", 2}})
+	if len(got) != 1 || got[0].durS != 30 || st.ok.Resets != 1 {
+		t.Errorf("após reset = %+v", got)
+	}
+
+	// Sinal de ciclo concluído: só bordas de subida.
+	sig := cycleSource{tagCycle: "fim", pieces: 4}
+	st = cycleState{}
+	got = st.feed(sig, []cycleReading{
+		{at(0), "fim", 1}, {at(1), "fim", 0}, {at(15), "fim", 1}, {at(16), "fim", 1},
+		{at(17), "fim", 0}, {at(29), "fim", 1}, {at(29), "ok", 50},
+	})
+	if len(got) != 1 || got[0].durS != 14 || got[0].n != 1 || !st.lastCycle.Equal(at(29)) {
+		t.Errorf("sinal = %+v", got)
+	}
+}
+
+func TestCycleAggClassificationAndPercentiles(t *testing.T) {
+	var a cycleAgg
+	for i := 0; i < 90; i++ {
+		a.add(10, 1, 10)
+	}
+	for i := 0; i < 9; i++ {
+		a.add(20, 1, 10) // micro-parada: > 1,5 × ideal
+	}
+	a.add(45, 1, 10)
+	a.add(600, 1, 10) // parada: > max(300, 5 × ideal)
+	s := a.stats()
+	if s.Cycles != 100 || s.MicroStops != 10 || s.MicroStopS != 9*10+35 || s.Stops != 1 || s.StopS != 600 {
+		t.Fatalf("stats = %+v", s)
+	}
+	if math.Abs(*s.MeanS-11.25) > 1e-9 || *s.MinS != 10 || *s.MaxS != 45 || math.Abs(*s.IdealRatioPct-10/11.25*100) > 1e-9 {
+		t.Errorf("média/ideal = %v %v %v %v", *s.MeanS, *s.MinS, *s.MaxS, *s.IdealRatioPct)
+	}
+	// Percentis pelo histograma: dentro da resolução da faixa (2^(1/16) ≈ 4,4%).
+	within := func(got, want float64) bool { return got >= want/math.Exp2(1.0/16) && got <= want*math.Exp2(1.0/16) }
+	if !within(*s.P50S, 10) || !within(*s.P95S, 20) || !within(*s.P99S, 20) {
+		t.Errorf("percentis = %v %v %v", *s.P50S, *s.P95S, *s.P99S)
+	}
+	if len(a.bins()) != 3 {
+		t.Errorf("bins = %+v", a.bins())
+	}
+
+	// Linhas somadas no relatório equivalem ao acumulado direto.
+	var b, c, m cycleAgg
+	b.add(10, 1, 0)
+	c.add(30, 2, 0)
+	m.merge(&b)
+	m.merge(&c)
+	if ms := m.stats(); ms.Cycles != 3 || *ms.MinS != 10 || *ms.MaxS != 30 || ms.IdealS != nil || ms.MicroStops != 0 ||
+		math.Abs(*ms.StdS-math.Sqrt(800.0/9)) > 1e-9 {
+		t.Errorf("merge = %+v", ms)
+	}
+	if cycleStopAfter(0) != 300 || cycleStopAfter(100) != 500 || cycleHistBin(0.01) != 0 || cycleHistBin(1e6) != cycleHistBins-1 {
+		t.Errorf("limites")
+	}
+}
+
+func TestPickCycleOrder(t *testing.T) {
+	t0 := time.Date(2026, 3, 2, 8, 0, 0, 0, time.UTC)
+	asset, sector := uuid.New(), uuid.New()
+	end := t0.Add(2 * time.Hour)
+	factoryWide := cycleOrder{id: uuid.New(), startedAt: t0}
+	sectorOrder := cycleOrder{id: uuid.New(), sectorID: &sector, startedAt: t0.Add(time.Hour)}
+	assetOld := cycleOrder{id: uuid.New(), assetID: &asset, startedAt: t0, endedAt: &end}
+	assetNew := cycleOrder{id: uuid.New(), assetID: &asset, startedAt: t0.Add(90 * time.Minute)}
+	orders := []cycleOrder{factoryWide, sectorOrder, assetOld, assetNew}
+
+	cases := []struct {
+		at   time.Time
+		want uuid.UUID
+	}{
+		{t0.Add(-time.Minute), uuid.Nil},
+		{t0.Add(30 * time.Minute), assetOld.id},
+		{t0.Add(100 * time.Minute), assetNew.id},
+		{end, assetNew.id},
+	}
+	for _, c := range cases {
+		if got := pickCycleOrder(orders, c.at); got != c.want {
+			t.Errorf("%s: %s, want %s", c.at.Format("15:04"), got, c.want)
+		}
+	}
+	if got := pickCycleOrder(orders[:2], t0.Add(30*time.Minute)); got != factoryWide.id {
+		t.Errorf("fábrica = %s", got)
+	}
+	if got := pickCycleOrder(orders[:2], t0.Add(61*time.Minute)); got != sectorOrder.id {
+		t.Errorf("setor = %s", got)
+	}
+}
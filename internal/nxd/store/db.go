@@ -28,35 +28,11 @@ func Driver() string {
 func InitNXDDB() error {
 	var err error
 	nxdOnce.Do(func() {
-		// Tenta NXD_DATABASE_URL primeiro, depois DATABASE_URL (mesmo Postgres da API legada)
-		connURL := os.Getenv("NXD_DATABASE_URL")
-		if connURL == "" {
-			connURL = os.Getenv("DATABASE_URL")
-		}
-		if connURL != "" {
-			// Modo Produção: PostgreSQL
-			dbDriver = "postgres"
-			log.Println("✓ NXD store: usando banco de dados PostgreSQL.")
-			nxdDB, err = sql.Open(dbDriver, connURL)
-		} else {
-			// Modo Desenvolvimento: SQLite
-			dbDriver = "sqlite3"
-			log.Println("✓ NXD store: usando banco de dados SQLite (desenvolvimento).")
-			nxdDB, err = sql.Open(dbDriver, "./nxd.db")
-		}
-
+		nxdDB, err = OpenNXDDB()
 		if err != nil {
 			return
 		}
 
-		if err = nxdDB.Ping(); err != nil {
-			log.Printf("❌ Erro ao conectar com o banco de dados: %v", err)
-			nxdDB.Close()
-			nxdDB = nil
-			return
-		}
-		log.Println("✓ Conexão com o banco de dados estabelecida com sucesso.")
-
 		if err = RunMigrations(nxdDB, dbDriver); err != nil {
 			log.Printf("❌ Erro ao executar migrações: %v", err)
 			nxdDB.Close()
@@ -67,6 +43,39 @@ func InitNXDDB() error {
 	return err
 }
 
+// OpenNXDDB abre e valida a conexão sem aplicar migrations (usado pelo comando "migrate").
+func OpenNXDDB() (*sql.DB, error) {
+	// Tenta NXD_DATABASE_URL primeiro, depois DATABASE_URL (mesmo Postgres da API legada)
+	connURL := os.Getenv("NXD_DATABASE_URL")
+	if connURL == "" {
+		connURL = os.Getenv("DATABASE_URL")
+	}
+	var db *sql.DB
+	var err error
+	if connURL != "" {
+		// Modo Produção: PostgreSQL
+		dbDriver = "postgres"
+		log.Println("✓ NXD store: usando banco de dados PostgreSQL.")
+		db, err = sql.Open(dbDriver, connURL)
+	} else {
+		// Modo Desenvolvimento: SQLite
+		dbDriver = "sqlite3"
+		log.Println("✓ NXD store: usando banco de dados SQLite (desenvolvimento).")
+		db, err = sql.Open(dbDriver, "./nxd.db")
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = db.Ping(); err != nil {
+		log.Printf("❌ Erro ao conectar com o banco de dados: %v", err)
+		db.Close()
+		return nil, err
+	}
+	log.Println("✓ Conexão com o banco de dados estabelecida com sucesso.")
+	return db, nil
+}
+
 func CloseNXDDB() {
 	if nxdDB != nil {
 		nxdDB.Close()
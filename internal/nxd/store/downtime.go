@@ -0,0 +1,660 @@
+package store
+
+// downtime.go — Eventos de parada, árvore de motivos e Pareto
+//
+// O detector lê o tag_status de cada ativo (mesma convenção de statusHoursParada:
+// < 0.5 = parado) e grava um evento por parada em nxd.downtime_events: a
+// transição rodando→parado abre o evento, parado→rodando fecha (ended_at e
+// duration_s). O cursor por ativo (nxd.downtime_cursor) guarda a última leitura
+// processada; leituras que chegam atrasadas (antes do cursor) são ignoradas.
+//
+// Motivos são uma árvore por fábrica (parent_id): categoria → motivo. O operador
+// classifica o evento com qualquer nó da árvore; o Pareto pode agrupar pelo
+// motivo ou pela categoria raiz. is_failure marca os motivos que são falha do
+// equipamento (vale para os filhos): é o que conta no MTBF/MTTR (reliability.go).
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	downtimeWorkerInterval  = time.Minute
+	downtimeInitialLookback = 7 * 24 * time.Hour
+	downtimeBatchSize       = 10000
+)
+
+// DowntimeReasonRow — nó da árvore de motivos de parada.
+type DowntimeReasonRow struct {
+	ID        uuid.UUID  `json:"id"`
+	FactoryID uuid.UUID  `json:"factory_id"`
+	ParentID  *uuid.UUID `json:"parent_id,omitempty"`
+	Code      string     `json:"code"`
+	Name      string     `json:"name"`
+	Active    bool       `json:"active"`
+	IsFailure bool       `json:"is_failure"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// DowntimeEventRow — uma parada detectada. EndedAt nil = em andamento
+// (DurationS é calculado até agora).
+type DowntimeEventRow struct {
+	ID           uuid.UUID  `json:"id"`
+	FactoryID    uuid.UUID  `json:"factory_id"`
+	AssetID      uuid.UUID  `json:"asset_id"`
+	AssetName    string     `json:"asset_name"`
+	SectorID     *uuid.UUID `json:"sector_id,omitempty"`
+	StartedAt    time.Time  `json:"started_at"`
+	EndedAt      *time.Time `json:"ended_at,omitempty"`
+	DurationS    float64    `json:"duration_s"`
+	ReasonID     *uuid.UUID `json:"reason_id,omitempty"`
+	ReasonCode   string     `json:"reason_code,omitempty"`
+	ReasonName   string     `json:"reason_name,omitempty"`
+	Comment      string     `json:"comment,omitempty"`
+	ClassifiedBy *int64     `json:"classified_by,omitempty"`
+	ClassifiedAt *time.Time `json:"classified_at,omitempty"`
+}
+
+// DowntimeEventQuery filtra ListDowntimeEvents (eventos que se sobrepõem a [Start, End)).
+type DowntimeEventQuery struct {
+	FactoryID    uuid.UUID
+	SectorID     *uuid.UUID
+	AssetID      *uuid.UUID
+	Start, End   time.Time
+	Unclassified bool
+	Limit        int
+}
+
+// ─── Motivos ────────────────────────────────────────────────────────────────
+
+// defaultDowntimeReasons é a árvore instalada por InstallDefaultDowntimeReasons.
+var defaultDowntimeReasons = []struct {
+	Code, Name string
+	IsFailure  bool
+	Children   [][2]string
+}{
+	{"MEC", "Mecânica", true, [][2]string{{"MEC-01", "Quebra de componente"}, {"MEC-02", "Desgaste / lubrificação"}, {"MEC-03", "Travamento / enrosco"}}},
+	{"ELE", "Elétrica", true, [][2]string{{"ELE-01", "Motor / acionamento"}, {"ELE-02", "Sensor / CLP"}, {"ELE-03", "Queda de energia"}}},
+	{"SET", "Setup", false, [][2]string{{"SET-01", "Troca de produto"}, {"SET-02", "Ajuste de processo"}}},
+	{"MAT", "Falta de material", false, [][2]string{{"MAT-01", "Matéria-prima"}, {"MAT-02", "Embalagem"}}},
+	{"OPR", "Operacional", false, [][2]string{{"OPR-01", "Falta de operador"}, {"OPR-02", "Aguardando qualidade"}, {"OPR-03", "Limpeza"}}},
+	{"PLN", "Parada planejada", false, [][2]string{{"PLN-01", "Manutenção preventiva"}, {"PLN-02", "Refeição / troca de turno"}}},
+}
+
+// ListDowntimeReasons retorna a árvore da fábrica (plana, pais antes dos filhos).
+func ListDowntimeReasons(db *sql.DB, factoryID uuid.UUID, includeInactive bool) ([]DowntimeReasonRow, error) {
+	query := `SELECT id, factory_id, parent_id, code, name, active, is_failure, created_at FROM nxd.downtime_reasons WHERE factory_id = $1`
+	if !includeInactive {
+		query += ` AND active`
+	}
+	rows, err := db.Query(query+` ORDER BY code`, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []DowntimeReasonRow
+	for rows.Next() {
+		var r DowntimeReasonRow
+		var parentID uuid.NullUUID
+		if err := rows.Scan(&r.ID, &r.FactoryID, &parentID, &r.Code, &r.Name, &r.Active, &r.IsFailure, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		if parentID.Valid {
+			r.ParentID = &parentID.UUID
+		}
+		list = append(list, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return sortReasonsTopologically(list), nil
+}
+
+// sortReasonsTopologically garante pais antes dos filhos (mantendo a ordem por código).
+func sortReasonsTopologically(list []DowntimeReasonRow) []DowntimeReasonRow {
+	out := make([]DowntimeReasonRow, 0, len(list))
+	emitted := make(map[uuid.UUID]bool, len(list))
+	for len(out) < len(list) {
+		progress := false
+		for _, r := range list {
+			if emitted[r.ID] || (r.ParentID != nil && !emitted[*r.ParentID] && containsReason(list, *r.ParentID)) {
+				continue
+			}
+			out = append(out, r)
+			emitted[r.ID] = true
+			progress = true
+		}
+		if !progress {
+			break
+		}
+	}
+	return out
+}
+
+func containsReason(list []DowntimeReasonRow, id uuid.UUID) bool {
+	for _, r := range list {
+		if r.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateDowntimeReason insere um motivo (parentID nil = categoria raiz).
+func CreateDowntimeReason(db *sql.DB, factoryID uuid.UUID, parentID *uuid.UUID, code, name string, isFailure bool) (uuid.UUID, error) {
+	if parentID != nil {
+		var ok bool
+		err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM nxd.downtime_reasons WHERE id = $1 AND factory_id = $2)`, *parentID, factoryID).Scan(&ok)
+		if err != nil {
+			return uuid.Nil, err
+		}
+		if !ok {
+			return uuid.Nil, fmt.Errorf("motivo pai %w", ErrDowntimeNotFound)
+		}
+	}
+	var id uuid.UUID
+	err := db.QueryRow(`
+		INSERT INTO nxd.downtime_reasons (factory_id, parent_id, code, name, is_failure)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (factory_id, code) DO NOTHING
+		RETURNING id
+	`, factoryID, parentID, code, name, isFailure).Scan(&id)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, ErrDowntimeReasonExists
+	}
+	return id, err
+}
+
+// UpdateDowntimeReason altera nome, ativo e/ou is_failure. Retorna false se não existir.
+// Desativar esconde o motivo da classificação, mas mantém o histórico.
+func UpdateDowntimeReason(db *sql.DB, factoryID, id uuid.UUID, name string, active, isFailure *bool) (bool, error) {
+	res, err := db.Exec(`
+		UPDATE nxd.downtime_reasons
+		SET name = COALESCE(NULLIF($1, ''), name), active = COALESCE($2, active), is_failure = COALESCE($3, is_failure)
+		WHERE id = $4 AND factory_id = $5
+	`, name, active, isFailure, id, factoryID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// InstallDefaultDowntimeReasons cria a árvore padrão; códigos já existentes são mantidos.
+// Retorna quantos motivos foram criados.
+func InstallDefaultDowntimeReasons(db *sql.DB, factoryID uuid.UUID) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	created := 0
+	upsert := func(parentID *uuid.UUID, code, name string, isFailure bool) (uuid.UUID, error) {
+		var id uuid.UUID
+		var inserted bool
+		err := tx.QueryRow(`
+			INSERT INTO nxd.downtime_reasons (factory_id, parent_id, code, name, is_failure)
+			VALUES ($1, $2, $3, $4, $5)
+			ON CONFLICT (factory_id, code) DO UPDATE SET code = EXCLUDED.code
+			RETURNING id, (xmax = 0)
+		`, factoryID, parentID, code, name, isFailure).Scan(&id, &inserted)
+		if inserted {
+			created++
+		}
+		return id, err
+	}
+	for _, cat := range defaultDowntimeReasons {
+		parentID, err := upsert(nil, cat.Code, cat.Name, cat.IsFailure)
+		if err != nil {
+			return 0, err
+		}
+		for _, c := range cat.Children {
+			if _, err := upsert(&parentID, c[0], c[1], false); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return created, tx.Commit()
+}
+
+// ─── Eventos ────────────────────────────────────────────────────────────────
+
+// ListDowntimeEvents retorna as paradas que se sobrepõem ao período, mais recentes primeiro.
+func ListDowntimeEvents(db *sql.DB, q DowntimeEventQuery) ([]DowntimeEventRow, error) {
+	if q.Limit <= 0 || q.Limit > 5000 {
+		q.Limit = 500
+	}
+	query := `
+		SELECT e.id, e.factory_id, e.asset_id, a.display_name, a.group_id, e.started_at, e.ended_at,
+		       COALESCE(e.duration_s, EXTRACT(EPOCH FROM (NOW() - e.started_at))),
+		       e.reason_id, COALESCE(r.code, ''), COALESCE(r.name, ''), COALESCE(e.comment, ''),
+		       e.classified_by, e.classified_at
+		FROM nxd.downtime_events e
+		JOIN nxd.assets a ON a.id = e.asset_id
+		LEFT JOIN nxd.downtime_reasons r ON r.id = e.reason_id
+		WHERE e.factory_id = $1 AND e.started_at < $3 AND (e.ended_at IS NULL OR e.ended_at > $2)`
+	args := []interface{}{q.FactoryID, q.Start, q.End}
+	if q.SectorID != nil {
+		args = append(args, *q.SectorID)
+		query += fmt.Sprintf(" AND a.group_id = $%d", len(args))
+	}
+	if q.AssetID != nil {
+		args = append(args, *q.AssetID)
+		query += fmt.Sprintf(" AND e.asset_id = $%d", len(args))
+	}
+	if q.Unclassified {
+		query += " AND e.reason_id IS NULL"
+	}
+	args = append(args, q.Limit)
+	query += fmt.Sprintf(" ORDER BY e.started_at DESC LIMIT $%d", len(args))
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []DowntimeEventRow
+	for rows.Next() {
+		var e DowntimeEventRow
+		var sectorID, reasonID uuid.NullUUID
+		var endedAt, classifiedAt sql.NullTime
+		var classifiedBy sql.NullInt64
+		if err := rows.Scan(&e.ID, &e.FactoryID, &e.AssetID, &e.AssetName, &sectorID, &e.StartedAt, &endedAt,
+			&e.DurationS, &reasonID, &e.ReasonCode, &e.ReasonName, &e.Comment, &classifiedBy, &classifiedAt); err != nil {
+			return nil, err
+		}
+		if sectorID.Valid {
+			e.SectorID = &sectorID.UUID
+		}
+		if endedAt.Valid {
+			e.EndedAt = &endedAt.Time
+		}
+		if reasonID.Valid {
+			e.ReasonID = &reasonID.UUID
+		}
+		if classifiedBy.Valid {
+			e.ClassifiedBy = &classifiedBy.Int64
+		}
+		if classifiedAt.Valid {
+			e.ClassifiedAt = &classifiedAt.Time
+		}
+		list = append(list, e)
+	}
+	return list, rows.Err()
+}
+
+var (
+	// ErrDowntimeNotFound — evento ou motivo fora da fábrica.
+	ErrDowntimeNotFound       = errors.New("não encontrado")
+	ErrDowntimeReasonExists   = errors.New("código de motivo já existe")
+	ErrDowntimeReasonInactive = errors.New("motivo inativo")
+)
+
+// ClassifyDowntimeEvent grava o motivo (nil = limpar) e o comentário do operador.
+func ClassifyDowntimeEvent(db *sql.DB, factoryID, eventID uuid.UUID, reasonID *uuid.UUID, comment string, userID int64) error {
+	if reasonID != nil {
+		var active bool
+		err := db.QueryRow(`SELECT active FROM nxd.downtime_reasons WHERE id = $1 AND factory_id = $2`, *reasonID, factoryID).Scan(&active)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("motivo %w", ErrDowntimeNotFound)
+		}
+		if err != nil {
+			return err
+		}
+		if !active {
+			return ErrDowntimeReasonInactive
+		}
+	}
+	res, err := db.Exec(`
+		UPDATE nxd.downtime_events
+		SET reason_id = $1, comment = NULLIF($2, ''), classified_by = $3, classified_at = NOW()
+		WHERE id = $4 AND factory_id = $5
+	`, reasonID, comment, userID, eventID, factoryID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("evento %w", ErrDowntimeNotFound)
+	}
+	return nil
+}
+
+// ─── Pareto ─────────────────────────────────────────────────────────────────
+
+// DowntimeParetoItem — uma barra do Pareto. ReasonID nil = não classificado.
+type DowntimeParetoItem struct {
+	ReasonID      *uuid.UUID `json:"reason_id"`
+	Code          string     `json:"code,omitempty"`
+	Name          string     `json:"name"`
+	Events        int        `json:"events"`
+	DurationS     float64    `json:"duration_s"`
+	Percent       float64    `json:"percent"`
+	CumulativePct float64    `json:"cumulative_percent"`
+}
+
+// DowntimePareto — paradas do período agrupadas por motivo, da maior para a menor.
+type DowntimePareto struct {
+	PeriodStart    time.Time            `json:"period_start"`
+	PeriodEnd      time.Time            `json:"period_end"`
+	Level          string               `json:"level"` // reason | category
+	TotalDurationS float64              `json:"total_duration_s"`
+	TotalEvents    int                  `json:"total_events"`
+	Items          []DowntimeParetoItem `json:"items"`
+}
+
+// downtimeAgg — paradas de um motivo (nil = não classificado) dentro do período.
+type downtimeAgg struct {
+	ReasonID  *uuid.UUID
+	Events    int
+	DurationS float64
+}
+
+// ComputeDowntimePareto soma a duração das paradas dentro do período por motivo
+// ou categoria raiz. Só conta a parte de cada evento que cai no tempo programado
+// do calendário (eventos que cruzam a borda do período ou do turno são cortados).
+func ComputeDowntimePareto(db *sql.DB, q DowntimeEventQuery, level string) (*DowntimePareto, error) {
+	query := `
+		SELECT e.reason_id, a.group_id, e.started_at, COALESCE(e.ended_at, NOW())
+		FROM nxd.downtime_events e
+		JOIN nxd.assets a ON a.id = e.asset_id
+		WHERE e.factory_id = $1 AND e.started_at < $3 AND COALESCE(e.ended_at, NOW()) > $2`
+	args := []interface{}{q.FactoryID, q.Start, q.End}
+	if q.SectorID != nil {
+		args = append(args, *q.SectorID)
+		query += fmt.Sprintf(" AND a.group_id = $%d", len(args))
+	}
+	if q.AssetID != nil {
+		args = append(args, *q.AssetID)
+		query += fmt.Sprintf(" AND e.asset_id = $%d", len(args))
+	}
+	cal, err := LoadProductionCalendar(db, q.FactoryID, q.Start, q.End)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	scheduled := map[uuid.UUID][]timeRange{} // por setor (uuid.Nil = sem setor)
+	byReason := map[uuid.UUID]*downtimeAgg{}
+	var aggs []*downtimeAgg
+	for rows.Next() {
+		var reasonID, sectorID uuid.NullUUID
+		var startedAt, endedAt time.Time
+		if err := rows.Scan(&reasonID, &sectorID, &startedAt, &endedAt); err != nil {
+			return nil, err
+		}
+		sched, ok := scheduled[sectorID.UUID]
+		if !ok {
+			var sp *uuid.UUID
+			if sectorID.Valid {
+				sp = &sectorID.UUID
+			}
+			sched = cal.Scheduled(sp, q.Start, q.End)
+			scheduled[sectorID.UUID] = sched
+		}
+		d := overlapSeconds(sched, startedAt, endedAt)
+		if d <= 0 {
+			continue
+		}
+		g, ok := byReason[reasonID.UUID]
+		if !ok {
+			g = &downtimeAgg{}
+			if reasonID.Valid {
+				id := reasonID.UUID
+				g.ReasonID = &id
+			}
+			byReason[reasonID.UUID] = g
+			aggs = append(aggs, g)
+		}
+		g.Events++
+		g.DurationS += d
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	reasons, err := ListDowntimeReasons(db, q.FactoryID, true)
+	if err != nil {
+		return nil, err
+	}
+	flat := make([]downtimeAgg, len(aggs))
+	for i, g := range aggs {
+		flat[i] = *g
+	}
+	p := buildDowntimePareto(flat, reasons, level)
+	p.PeriodStart, p.PeriodEnd = q.Start, q.End
+	return p, nil
+}
+
+// buildDowntimePareto agrupa (por motivo ou categoria raiz), ordena e acumula os percentuais.
+func buildDowntimePareto(aggs []downtimeAgg, reasons []DowntimeReasonRow, level string) *DowntimePareto {
+	if level != "category" {
+		level = "reason"
+	}
+	byID := make(map[uuid.UUID]DowntimeReasonRow, len(reasons))
+	for _, r := range reasons {
+		byID[r.ID] = r
+	}
+	p := &DowntimePareto{Level: level, Items: []DowntimeParetoItem{}}
+	idx := map[uuid.UUID]int{}
+	for _, g := range aggs {
+		if g.DurationS <= 0 {
+			continue
+		}
+		key := uuid.Nil
+		item := DowntimeParetoItem{Name: "Não classificado"}
+		if g.ReasonID != nil {
+			r := byID[*g.ReasonID]
+			for depth := 0; level == "category" && r.ParentID != nil && depth < 32; depth++ {
+				parent, ok := byID[*r.ParentID]
+				if !ok {
+					break
+				}
+				r = parent
+			}
+			key = *g.ReasonID
+			if level == "category" {
+				key = r.ID
+			}
+			id := key
+			item = DowntimeParetoItem{ReasonID: &id, Code: r.Code, Name: r.Name}
+		}
+		i, ok := idx[key]
+		if !ok {
+			i = len(p.Items)
+			idx[key] = i
+			p.Items = append(p.Items, item)
+		}
+		p.Items[i].Events += g.Events
+		p.Items[i].DurationS += g.DurationS
+		p.TotalEvents += g.Events
+		p.TotalDurationS += g.DurationS
+	}
+	sort.SliceStable(p.Items, func(i, j int) bool { return p.Items[i].DurationS > p.Items[j].DurationS })
+	var cum float64
+	for i := range p.Items {
+		if p.TotalDurationS > 0 {
+			p.Items[i].Percent = p.Items[i].DurationS / p.TotalDurationS * 100
+		}
+		cum += p.Items[i].Percent
+		p.Items[i].CumulativePct = cum
+	}
+	return p
+}
+
+// ─── Detector ───────────────────────────────────────────────────────────────
+
+// DetectDowntimeEvents processa as leituras novas de tag_status de todos os ativos
+// mapeados (ou só da fábrica, se factoryID != nil). Retorna eventos abertos e fechados.
+func DetectDowntimeEvents(ctx context.Context, db *sql.DB, factoryID *uuid.UUID) (opened, closed int, err error) {
+	query := `
+		SELECT a.id, a.factory_id, t.tag_status
+		FROM nxd.tag_mapping t
+		JOIN nxd.assets a ON a.id = t.asset_id
+		WHERE t.tag_status IS NOT NULL AND t.tag_status <> ''`
+	args := []interface{}{}
+	if factoryID != nil {
+		query += ` AND a.factory_id = $1`
+		args = append(args, *factoryID)
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, 0, err
+	}
+	type target struct {
+		assetID, factoryID uuid.UUID
+		metricKey          string
+	}
+	var targets []target
+	for rows.Next() {
+		var t target
+		if err := rows.Scan(&t.assetID, &t.factoryID, &t.metricKey); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		targets = append(targets, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+	for _, t := range targets {
+		if ctx.Err() != nil {
+			return opened, closed, ctx.Err()
+		}
+		o, c, err := detectAssetDowntime(ctx, db, t.factoryID, t.assetID, t.metricKey)
+		if err != nil {
+			return opened, closed, fmt.Errorf("ativo %s: %w", t.assetID, err)
+		}
+		opened += o
+		closed += c
+	}
+	return opened, closed, nil
+}
+
+// detectAssetDowntime processa um lote de leituras após o cursor do ativo, em uma transação.
+func detectAssetDowntime(ctx context.Context, db *sql.DB, factoryID, assetID uuid.UUID, metricKey string) (opened, closed int, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	var since time.Time
+	err = tx.QueryRowContext(ctx, `SELECT last_ts FROM nxd.downtime_cursor WHERE asset_id = $1`, assetID).Scan(&since)
+	if err == sql.ErrNoRows {
+		// Primeira passada: olha para trás downtimeInitialLookback, sem repetir
+		// eventos que já existam (ex.: fábrica restaurada de backup).
+		since = time.Now().Add(-downtimeInitialLookback)
+		var last sql.NullTime
+		if err := tx.QueryRowContext(ctx,
+			`SELECT MAX(COALESCE(ended_at, started_at)) FROM nxd.downtime_events WHERE asset_id = $1`, assetID,
+		).Scan(&last); err != nil {
+			return 0, 0, err
+		}
+		if last.Valid && last.Time.After(since) {
+			since = last.Time
+		}
+	} else if err != nil {
+		return 0, 0, err
+	}
+
+	var openID uuid.UUID
+	var openStart time.Time
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, started_at FROM nxd.downtime_events
+		WHERE asset_id = $1 AND ended_at IS NULL ORDER BY started_at DESC LIMIT 1
+	`, assetID).Scan(&openID, &openStart)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, 0, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT ts, metric_value FROM nxd.telemetry_log
+		WHERE asset_id = $1 AND metric_key = $2 AND ts > $3 AND metric_value IS NOT NULL
+		ORDER BY ts ASC LIMIT $4
+	`, assetID, metricKey, since, downtimeBatchSize)
+	if err != nil {
+		return 0, 0, err
+	}
+	var series []statusPoint
+	for rows.Next() {
+		var p statusPoint
+		var val float64
+		if err := rows.Scan(&p.Ts, &val); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		p.Running = val >= 0.5
+		series = append(series, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+	if len(series) == 0 {
+		return 0, 0, nil
+	}
+
+	for _, p := range series {
+		switch {
+		case !p.Running && openID == uuid.Nil:
+			err = tx.QueryRowContext(ctx, `
+				INSERT INTO nxd.downtime_events (factory_id, asset_id, started_at)
+				VALUES ($1, $2, $3)
+				ON CONFLICT (asset_id, started_at) DO UPDATE SET ended_at = NULL, duration_s = NULL
+				RETURNING id
+			`, factoryID, assetID, p.Ts).Scan(&openID)
+			if err != nil {
+				return 0, 0, err
+			}
+			openStart = p.Ts
+			opened++
+		case p.Running && openID != uuid.Nil:
+			if _, err = tx.ExecContext(ctx,
+				`UPDATE nxd.downtime_events SET ended_at = $1, duration_s = $2 WHERE id = $3`,
+				p.Ts, p.Ts.Sub(openStart).Seconds(), openID,
+			); err != nil {
+				return 0, 0, err
+			}
+			openID = uuid.Nil
+			closed++
+		}
+	}
+	if _, err = tx.ExecContext(ctx, `
+		INSERT INTO nxd.downtime_cursor (asset_id, last_ts, updated_at) VALUES ($1, $2, NOW())
+		ON CONFLICT (asset_id) DO UPDATE SET last_ts = EXCLUDED.last_ts, updated_at = NOW()
+	`, assetID, series[len(series)-1].Ts); err != nil {
+		return 0, 0, err
+	}
+	return opened, closed, tx.Commit()
+}
+
+// RunDowntimeWorker detecta paradas a cada minuto.
+func RunDowntimeWorker(ctx context.Context, db *sql.DB) {
+	log.Println("✓ [Downtime] Detector de paradas iniciado (intervalo: 1m)")
+	ticker := time.NewTicker(downtimeWorkerInterval)
+	defer ticker.Stop()
+	for {
+		opened, closed, err := DetectDowntimeEvents(ctx, db, nil)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("⚠️  [Downtime] %v", err)
+		} else if opened+closed > 0 {
+			log.Printf("⏱  [Downtime] %d parada(s) aberta(s), %d encerrada(s)", opened, closed)
+		}
+		select {
+		case <-ctx.Done():
+			log.Println("⏹  [Downtime] Shutdown signal received, worker stopping.")
+			return
+		case <-ticker.C:
+		}
+	}
+}
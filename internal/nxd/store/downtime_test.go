@@ -0,0 +1,44 @@
+package store
+
+import (
+	"testing"
+
+	"github.com/google/uuid"
+)
+
+func TestBuildDowntimeParetoCategoryRollup(t *testing.T) {
+	mec, mec1, mec2, setup := uuid.New(), uuid.New(), uuid.New(), uuid.New()
+	reasons := sortReasonsTopologically([]DowntimeReasonRow{
+		{ID: mec1, ParentID: &mec, Code: "MEC-01", Name: "Quebra"},
+		{ID: mec, Code: "MEC", Name: "Mecânica"},
+		{ID: mec2, ParentID: &mec, Code: "MEC-02", Name: "Desgaste"},
+		{ID: setup, Code: "SET", Name: "Setup"},
+	})
+	if reasons[0].ID != mec {
+		t.Fatalf("parent must come before children: %+v", reasons)
+	}
+	aggs := []downtimeAgg{
+		{ReasonID: &mec1, Events: 2, DurationS: 300},
+		{ReasonID: &mec2, Events: 1, DurationS: 200},
+		{ReasonID: &setup, Events: 1, DurationS: 400},
+		{ReasonID: nil, Events: 3, DurationS: 100},
+	}
+
+	p := buildDowntimePareto(aggs, reasons, "reason")
+	if len(p.Items) != 4 || p.Items[0].Code != "SET" || p.TotalEvents != 7 || p.TotalDurationS != 1000 {
+		t.Fatalf("reason pareto = %+v", p)
+	}
+
+	p = buildDowntimePareto(aggs, reasons, "category")
+	if len(p.Items) != 3 {
+		t.Fatalf("category pareto = %+v", p.Items)
+	}
+	top := p.Items[0]
+	if top.Code != "MEC" || top.Events != 3 || top.DurationS != 500 || top.Percent != 50 {
+		t.Errorf("top = %+v", top)
+	}
+	last := p.Items[2]
+	if last.ReasonID != nil || last.CumulativePct != 100 {
+		t.Errorf("unclassified = %+v", last)
+	}
+}
@@ -0,0 +1,575 @@
+package store
+
+// emissions.go — Emissões de carbono Escopo 2 (energia elétrica comprada) e resumo ESG
+//
+// Método location-based do GHG Protocol: kg CO2e = kWh × fator médio da rede da
+// região da fábrica (factories.emission_region, padrão BR-SIN = Sistema Interligado
+// Nacional). Os fatores são cadastrados por região e vigência [valid_from, valid_to)
+// em datas locais da fábrica; valid_to nulo = em vigor até o próximo cadastro. Não
+// pode haver vigências sobrepostas na mesma região.
+//
+// O kWh vem de energy.go (tag_energy dos ativos + medidores, semântica de contador),
+// já distribuído em janelas de 15 min: cada janela recebe o fator vigente no seu
+// início, então um período que cruza a troca de fator (ex.: fator mensal do MCTI)
+// usa os dois. kWh de janelas sem fator entram no consumo mas não no CO2e e
+// reduzem a completude.
+//
+// Produtos: CO2e das ordens de produção iniciadas no período (production_orders.go),
+// cada uma apurada na sua duração inteira.
+
+import (
+	"database/sql"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DefaultEmissionRegion — região padrão das fábricas (SIN brasileiro).
+const DefaultEmissionRegion = "BR-SIN"
+
+var (
+	// ErrInvalidEmissionFactor — fator negativo, região vazia ou vigência inválida.
+	ErrInvalidEmissionFactor = errors.New("fator de emissão inválido")
+	// ErrEmissionFactorConflict — vigência sobreposta a outro fator da mesma região.
+	ErrEmissionFactorConflict = errors.New("já existe um fator de emissão vigente neste período para a região")
+)
+
+// EmissionFactorRow — fator médio da rede (kg CO2e/kWh) de uma região, vigente em
+// [ValidFrom, ValidTo) (datas YYYY-MM-DD no fuso da fábrica; ValidTo nil = aberto).
+type EmissionFactorRow struct {
+	ID           uuid.UUID `json:"id"`
+	FactoryID    uuid.UUID `json:"factory_id"`
+	Region       string    `json:"region"`
+	ValidFrom    string    `json:"valid_from"`
+	ValidTo      *string   `json:"valid_to,omitempty"`
+	KgCO2ePerKWh float64   `json:"kg_co2e_per_kwh"`
+	Source       string    `json:"source,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// ─── Região da fábrica ──────────────────────────────────────────────────────
+
+// GetFactoryEmissionRegion retorna a região de emissão da fábrica (padrão DefaultEmissionRegion).
+func GetFactoryEmissionRegion(db *sql.DB, factoryID uuid.UUID) (string, error) {
+	var region sql.NullString
+	err := db.QueryRow(`SELECT emission_region FROM nxd.factories WHERE id = $1`, factoryID).Scan(&region)
+	if err != nil && err != sql.ErrNoRows {
+		return "", err
+	}
+	if region.Valid && region.String != "" {
+		return region.String, nil
+	}
+	return DefaultEmissionRegion, nil
+}
+
+// SetFactoryEmissionRegion grava a região (ex.: BR-SIN, PT, US-CAMX).
+func SetFactoryEmissionRegion(db *sql.DB, factoryID uuid.UUID, region string) error {
+	region = strings.TrimSpace(region)
+	if region == "" || len(region) > 64 {
+		return fmt.Errorf("%w: região %q", ErrInvalidEmissionFactor, region)
+	}
+	_, err := db.Exec(`UPDATE nxd.factories SET emission_region = $1, updated_at = NOW() WHERE id = $2`, region, factoryID)
+	return err
+}
+
+// ─── Fatores ────────────────────────────────────────────────────────────────
+
+// ListEmissionFactors retorna os fatores da fábrica (region "" = todas as regiões).
+func ListEmissionFactors(db *sql.DB, factoryID uuid.UUID, region string) ([]EmissionFactorRow, error) {
+	rows, err := db.Query(`
+		SELECT id, factory_id, region, valid_from, valid_to, kg_co2e_per_kwh, COALESCE(source, ''), created_at
+		FROM nxd.emission_factors
+		WHERE factory_id = $1 AND ($2 = '' OR region = $2)
+		ORDER BY region, valid_from
+	`, factoryID, region)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []EmissionFactorRow
+	for rows.Next() {
+		var f EmissionFactorRow
+		var from time.Time
+		var to sql.NullTime
+		if err := rows.Scan(&f.ID, &f.FactoryID, &f.Region, &from, &to, &f.KgCO2ePerKWh, &f.Source, &f.CreatedAt); err != nil {
+			return nil, err
+		}
+		f.ValidFrom = from.Format("2006-01-02")
+		if to.Valid {
+			s := to.Time.Format("2006-01-02")
+			f.ValidTo = &s
+		}
+		list = append(list, f)
+	}
+	return list, rows.Err()
+}
+
+// regionEmissionFactors retorna os fatores da região configurada na fábrica.
+func regionEmissionFactors(db *sql.DB, factoryID uuid.UUID) ([]EmissionFactorRow, error) {
+	region, err := GetFactoryEmissionRegion(db, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	return ListEmissionFactors(db, factoryID, region)
+}
+
+func validateEmissionFactor(f *EmissionFactorRow) error {
+	f.Region = strings.TrimSpace(f.Region)
+	f.Source = strings.TrimSpace(f.Source)
+	if f.Region == "" || len(f.Region) > 64 {
+		return fmt.Errorf("%w: região obrigatória (até 64 caracteres)", ErrInvalidEmissionFactor)
+	}
+	from, err := time.Parse("2006-01-02", f.ValidFrom)
+	if err != nil {
+		return fmt.Errorf("%w: valid_from %q (use YYYY-MM-DD)", ErrInvalidEmissionFactor, f.ValidFrom)
+	}
+	if f.ValidTo != nil {
+		to, err := time.Parse("2006-01-02", *f.ValidTo)
+		if err != nil {
+			return fmt.Errorf("%w: valid_to %q (use YYYY-MM-DD)", ErrInvalidEmissionFactor, *f.ValidTo)
+		}
+		if !to.After(from) {
+			return fmt.Errorf("%w: valid_to deve ser posterior a valid_from", ErrInvalidEmissionFactor)
+		}
+	}
+	if f.KgCO2ePerKWh < 0 {
+		return fmt.Errorf("%w: kg_co2e_per_kwh não pode ser negativo", ErrInvalidEmissionFactor)
+	}
+	return nil
+}
+
+// emissionFactorOverlaps verifica sobreposição de vigência com outro fator da região.
+func emissionFactorOverlaps(tx *sql.Tx, f EmissionFactorRow) (bool, error) {
+	var taken bool
+	err := tx.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM nxd.emission_factors
+			WHERE factory_id = $1 AND region = $2 AND id <> $3
+			  AND valid_from < COALESCE($5::date, 'infinity'::date)
+			  AND COALESCE(valid_to, 'infinity'::date) > $4::date
+		)
+	`, f.FactoryID, f.Region, f.ID, f.ValidFrom, f.ValidTo).Scan(&taken)
+	return taken, err
+}
+
+// CreateEmissionFactor insere o fator (vigência sobreposta → ErrEmissionFactorConflict).
+func CreateEmissionFactor(db *sql.DB, f EmissionFactorRow) (uuid.UUID, error) {
+	if err := validateEmissionFactor(&f); err != nil {
+		return uuid.Nil, err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+	if taken, err := emissionFactorOverlaps(tx, f); err != nil {
+		return uuid.Nil, err
+	} else if taken {
+		return uuid.Nil, ErrEmissionFactorConflict
+	}
+	var id uuid.UUID
+	err = tx.QueryRow(`
+		INSERT INTO nxd.emission_factors (factory_id, region, valid_from, valid_to, kg_co2e_per_kwh, source)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
+		ON CONFLICT (factory_id, region, valid_from) DO NOTHING
+		RETURNING id
+	`, f.FactoryID, f.Region, f.ValidFrom, f.ValidTo, f.KgCO2ePerKWh, f.Source).Scan(&id)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, ErrEmissionFactorConflict
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return id, tx.Commit()
+}
+
+// UpdateEmissionFactor substitui o fator. false = não existe na fábrica.
+func UpdateEmissionFactor(db *sql.DB, f EmissionFactorRow) (bool, error) {
+	if err := validateEmissionFactor(&f); err != nil {
+		return false, err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	if taken, err := emissionFactorOverlaps(tx, f); err != nil {
+		return false, err
+	} else if taken {
+		return false, ErrEmissionFactorConflict
+	}
+	res, err := tx.Exec(`
+		UPDATE nxd.emission_factors SET region = $1, valid_from = $2, valid_to = $3, kg_co2e_per_kwh = $4, source = NULLIF($5, '')
+		WHERE id = $6 AND factory_id = $7
+	`, f.Region, f.ValidFrom, f.ValidTo, f.KgCO2ePerKWh, f.Source, f.ID, f.FactoryID)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	return true, tx.Commit()
+}
+
+// DeleteEmissionFactor remove o fator. false = não existe.
+func DeleteEmissionFactor(db *sql.DB, factoryID, id uuid.UUID) (bool, error) {
+	res, err := db.Exec(`DELETE FROM nxd.emission_factors WHERE id = $1 AND factory_id = $2`, id, factoryID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ─── Fator por instante ─────────────────────────────────────────────────────
+
+type compiledFactor struct {
+	from, to time.Time // meia-noite local; to zero = aberto
+	kg       float64
+}
+
+func compileEmissionFactors(rows []EmissionFactorRow, loc *time.Location) []compiledFactor {
+	var out []compiledFactor
+	for _, f := range rows {
+		from, err := time.ParseInLocation("2006-01-02", f.ValidFrom, loc)
+		if err != nil {
+			continue
+		}
+		cf := compiledFactor{from: from, kg: f.KgCO2ePerKWh}
+		if f.ValidTo != nil {
+			if to, err := time.ParseInLocation("2006-01-02", *f.ValidTo, loc); err == nil {
+				cf.to = to
+			}
+		}
+		out = append(out, cf)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].from.Before(out[j].from) })
+	return out
+}
+
+// emissionAt retorna o fator vigente em t; false = nenhum fator cobre t.
+func (p *energyPricing) emissionAt(t time.Time) (float64, bool) {
+	var f *compiledFactor
+	for i := range p.factors {
+		if p.factors[i].from.After(t) {
+			break
+		}
+		f = &p.factors[i]
+	}
+	if f == nil || (!f.to.IsZero() && !t.Before(f.to)) {
+		return 0, false
+	}
+	return f.kg, true
+}
+
+// ─── Resumo ESG ─────────────────────────────────────────────────────────────
+
+// ESGQuery — período e granularidade da tendência ("day" ou "month"; padrão "day").
+type ESGQuery struct {
+	FactoryID uuid.UUID
+	Start     time.Time
+	End       time.Time
+	Bucket    string
+}
+
+// ESGLine — consumo e emissões de um ativo, medidor ou setor. ID nil = fábrica (geral).
+type ESGLine struct {
+	ID             *uuid.UUID `json:"id,omitempty"`
+	Name           string     `json:"name"`
+	KWh            float64    `json:"kwh"`
+	CO2eKg         float64    `json:"co2e_kg"`
+	OKCount        float64    `json:"ok_count"`
+	CO2eKgPerPiece *float64   `json:"co2e_kg_per_piece"`
+	DataCoverage   float64    `json:"data_coverage"` // fração das janelas de 15 min com leituras
+}
+
+// ESGTrendPoint — emissões de um bucket (início no fuso da fábrica).
+type ESGTrendPoint struct {
+	Start  time.Time `json:"start"`
+	KWh    float64   `json:"kwh"`
+	CO2eKg float64   `json:"co2e_kg"`
+}
+
+// ESGCompleteness — indicadores de completude dos dados do relatório.
+type ESGCompleteness struct {
+	FactorCoverage      float64  `json:"factor_coverage"` // fração do kWh com fator de emissão
+	DataCoverage        float64  `json:"data_coverage"`   // média das fontes: janelas com leituras
+	AssetsWithEnergyTag int      `json:"assets_with_energy_tag"`
+	AssetsTotal         int      `json:"assets_total"`
+	Meters              int      `json:"meters"`
+	SourcesWithoutData  []string `json:"sources_without_data"`
+	Warnings            []string `json:"warnings"`
+}
+
+// ESGReport — resumo de emissões Escopo 2 da fábrica no período.
+type ESGReport struct {
+	Start          time.Time              `json:"start"`
+	End            time.Time              `json:"end"`
+	Region         string                 `json:"region"`
+	Scope          string                 `json:"scope"`
+	KWh            float64                `json:"kwh"`
+	CO2eKg         float64                `json:"co2e_kg"`
+	OKCount        float64                `json:"ok_count"`
+	CO2eKgPerPiece *float64               `json:"co2e_kg_per_piece"`
+	Assets         []ESGLine              `json:"assets"`
+	Meters         []ESGLine              `json:"meters"`
+	Sectors        []ESGLine              `json:"sectors"`
+	Products       []ProductProfitability `json:"products"`
+	Trend          []ESGTrendPoint        `json:"trend"`
+	Factors        []EmissionFactorRow    `json:"factors"`
+	Completeness   ESGCompleteness        `json:"completeness"`
+	Methodology    []string               `json:"methodology"`
+}
+
+func esgLine(id *uuid.UUID, name string, kwh, co2, ok float64, coverage float64) ESGLine {
+	l := ESGLine{ID: id, Name: name, KWh: kwh, CO2eKg: co2, OKCount: ok, DataCoverage: coverage}
+	if ok > 0 {
+		v := co2 / ok
+		l.CO2eKgPerPiece = &v
+	}
+	return l
+}
+
+// ComputeESGReport apura kWh e CO2e da fábrica inteira por ativo, medidor, setor,
+// produto e bucket, com os fatores usados, a completude e as notas de metodologia.
+func ComputeESGReport(db *sql.DB, q ESGQuery, now time.Time) (*ESGReport, error) {
+	assetIDs, assetSector, err := financialAssets(db, q.FactoryID, nil)
+	if err != nil {
+		return nil, err
+	}
+	assets, err := loadFinancialAssets(db, assetIDs, assetSector)
+	if err != nil {
+		return nil, err
+	}
+	cal, err := LoadProductionCalendar(db, q.FactoryID, q.Start, q.End)
+	if err != nil {
+		return nil, err
+	}
+	sc, err := loadEnergyScope(db, q.FactoryID, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	region, err := GetFactoryEmissionRegion(db, q.FactoryID)
+	if err != nil {
+		return nil, err
+	}
+	batch := newTelemetryBatch()
+	sources, okReads := assetEnergySources(batch, assets, q.Start, q.End)
+	assetSources := len(sources)
+	sources = append(sources, sc.sources()...)
+	finish := planEnergy(batch, sources, newEnergyPricing(nil, sc.factors, cal, 0), q.Start, q.End)
+	if err := batch.run(db); err != nil {
+		return nil, err
+	}
+	en := finish()
+	okByAsset := map[uuid.UUID]float64{}
+	for id, r := range okReads {
+		okByAsset[id] = r.value
+	}
+
+	rep := &ESGReport{Start: q.Start, End: q.End, Region: region, Scope: "scope2_location_based",
+		KWh: en.KWh, CO2eKg: en.CO2eKg, Assets: []ESGLine{}, Meters: []ESGLine{}, Sectors: []ESGLine{}}
+	for _, v := range okByAsset {
+		rep.OKCount += v
+	}
+	if rep.OKCount > 0 {
+		v := rep.CO2eKg / rep.OKCount
+		rep.CO2eKgPerPiece = &v
+	}
+
+	// Ativos, medidores e setores.
+	windows := energyWindowCount(q.Start, q.End)
+	comp := &rep.Completeness
+	comp.AssetsWithEnergyTag, comp.AssetsTotal, comp.Meters = assetSources, len(assetIDs), len(sc.meters)
+	comp.SourcesWithoutData, comp.Warnings = []string{}, []string{}
+	type sectorAcc struct{ kwh, co2, ok float64 }
+	sectors := map[uuid.UUID]*sectorAcc{}
+	var general sectorAcc
+	var hasGeneral bool
+	for _, src := range en.Sources {
+		coverage := 0.0
+		if windows > 0 {
+			coverage = float64(src.covered) / float64(windows)
+		}
+		comp.DataCoverage += coverage
+		if src.covered == 0 {
+			comp.SourcesWithoutData = append(comp.SourcesWithoutData, src.Name)
+		}
+		id := src.ID
+		var ok float64
+		if src.Kind == "asset" {
+			ok = okByAsset[src.ID]
+			rep.Assets = append(rep.Assets, esgLine(&id, src.Name, src.KWh, src.CO2eKg, ok, coverage))
+		} else {
+			rep.Meters = append(rep.Meters, esgLine(&id, src.Name, src.KWh, src.CO2eKg, 0, coverage))
+		}
+		acc := &general
+		if src.SectorID != nil {
+			if sectors[*src.SectorID] == nil {
+				sectors[*src.SectorID] = &sectorAcc{}
+			}
+			acc = sectors[*src.SectorID]
+		} else {
+			hasGeneral = true
+		}
+		acc.kwh += src.KWh
+		acc.co2 += src.CO2eKg
+		acc.ok += ok
+	}
+	if len(en.Sources) > 0 {
+		comp.DataCoverage /= float64(len(en.Sources))
+	}
+	for id, acc := range sectors {
+		sid := id
+		name := id.String()
+		if s, err := GetSectorByID(db, id, q.FactoryID); err == nil && s != nil {
+			name = s.Name
+		}
+		rep.Sectors = append(rep.Sectors, esgLine(&sid, name, acc.kwh, acc.co2, acc.ok, 0))
+	}
+	sort.Slice(rep.Sectors, func(i, j int) bool { return rep.Sectors[i].Name < rep.Sectors[j].Name })
+	if hasGeneral {
+		rep.Sectors = append(rep.Sectors, esgLine(nil, "Fábrica (geral)", general.kwh, general.co2, general.ok, 0))
+	}
+	for _, list := range [][]ESGLine{rep.Assets, rep.Meters} {
+		sort.Slice(list, func(i, j int) bool { return list[i].CO2eKg > list[j].CO2eKg })
+	}
+
+	// Produtos (ordens iniciadas no período).
+	products, _, err := ComputeProductProfitability(db, ProductionOrderQuery{FactoryID: q.FactoryID, Start: q.Start, End: q.End}, now)
+	if err != nil {
+		comp.Warnings = append(comp.Warnings, "CO2e por produto indisponível: "+err.Error())
+		products = nil
+	}
+	rep.Products = products
+	if rep.Products == nil {
+		rep.Products = []ProductProfitability{}
+	}
+
+	rep.Trend = esgTrend(en, cal.Location, q.Start, q.End, q.Bucket)
+
+	// Fatores vigentes no período e completude do fator.
+	rep.Factors = []EmissionFactorRow{}
+	startDay, endDay := q.Start.In(cal.Location).Format("2006-01-02"), q.End.Add(-time.Second).In(cal.Location).Format("2006-01-02")
+	for _, f := range sc.factors {
+		if f.ValidFrom <= endDay && (f.ValidTo == nil || *f.ValidTo > startDay) {
+			rep.Factors = append(rep.Factors, f)
+		}
+	}
+	comp.FactorCoverage = 1
+	if en.KWh > 0 {
+		comp.FactorCoverage = (en.KWh - en.KWhWithoutFactor) / en.KWh
+	}
+	if en.KWhWithoutFactor > 0 {
+		comp.Warnings = append(comp.Warnings, fmt.Sprintf("%.1f kWh sem fator de emissão cadastrado para a região %s", en.KWhWithoutFactor, region))
+	}
+	if assetSources < len(assetIDs) {
+		comp.Warnings = append(comp.Warnings, fmt.Sprintf("%d de %d ativos sem tag de energia mapeada", len(assetIDs)-assetSources, len(assetIDs)))
+	}
+	if len(comp.SourcesWithoutData) > 0 {
+		comp.Warnings = append(comp.Warnings, fmt.Sprintf("%d fontes de energia sem leituras no período", len(comp.SourcesWithoutData)))
+	}
+
+	rep.Methodology = []string{
+		"Escopo 2, método location-based (GHG Protocol): kg CO2e = kWh consumido × fator médio da rede da região " + region + ".",
+		"kWh das tags de energia dos ativos e dos medidores adicionais, como contadores (resets e rollover tratados); medidores somam ao consumo das máquinas.",
+		"Cada leitura é distribuída uniformemente em janelas de 15 min; cada janela usa o fator vigente no seu início (datas no fuso " + cal.Location.String() + ").",
+		"CO2e por peça = CO2e ÷ peças boas (tag OK) do mesmo escopo; por produto, soma das ordens de produção iniciadas no período, cada uma apurada na duração inteira.",
+		"Cobertura de dados = fração das janelas de 15 min com leituras a até 1 h de distância; cobertura de fator = fração do kWh com fator vigente.",
+	}
+	for _, f := range rep.Factors {
+		if f.Source != "" {
+			rep.Methodology = append(rep.Methodology, fmt.Sprintf("Fator %s a partir de %s: %g kg CO2e/kWh (fonte: %s).", f.Region, f.ValidFrom, f.KgCO2ePerKWh, f.Source))
+		}
+	}
+	return rep, nil
+}
+
+// esgTrend agrupa as janelas de 15 min em dias ou meses locais (buckets vazios incluídos).
+func esgTrend(en *EnergyReport, loc *time.Location, start, end time.Time, bucket string) []ESGTrendPoint {
+	trunc := func(t time.Time) time.Time {
+		lt := t.In(loc)
+		if bucket == "month" {
+			return time.Date(lt.Year(), lt.Month(), 1, 0, 0, 0, 0, loc)
+		}
+		return time.Date(lt.Year(), lt.Month(), lt.Day(), 0, 0, 0, 0, loc)
+	}
+	next := func(t time.Time) time.Time {
+		if bucket == "month" {
+			return t.AddDate(0, 1, 0)
+		}
+		return t.AddDate(0, 0, 1)
+	}
+	out := []ESGTrendPoint{}
+	index := map[int64]int{}
+	for b := trunc(start); b.Before(end); b = next(b) {
+		index[b.Unix()] = len(out)
+		out = append(out, ESGTrendPoint{Start: b})
+	}
+	win := int64(energyWindow / time.Second)
+	for w, kwh := range en.kwhWindows {
+		if i, ok := index[trunc(time.Unix(w*win, 0)).Unix()]; ok {
+			out[i].KWh += kwh
+			out[i].CO2eKg += en.co2Windows[w]
+		}
+	}
+	return out
+}
+
+// WriteESGCSV exporta o resumo ESG em CSV (uma linha por item, coluna secao).
+func WriteESGCSV(w io.Writer, rep *ESGReport) error {
+	cw := csv.NewWriter(w)
+	num := func(v float64) string { return strconv.FormatFloat(v, 'f', 3, 64) }
+	opt := func(v *float64) string {
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*v, 'f', 6, 64)
+	}
+	pct := func(v float64) string { return strconv.FormatFloat(v*100, 'f', 1, 64) }
+	rows := [][]string{
+		{"secao", "nome", "kwh", "co2e_kg", "pecas_ok", "co2e_kg_por_peca", "cobertura_dados_pct"},
+		{"total", fmt.Sprintf("%s %s a %s", rep.Region, rep.Start.Format(time.RFC3339), rep.End.Format(time.RFC3339)),
+			num(rep.KWh), num(rep.CO2eKg), num(rep.OKCount), opt(rep.CO2eKgPerPiece), pct(rep.Completeness.DataCoverage)},
+	}
+	for _, sec := range []struct {
+		name  string
+		lines []ESGLine
+	}{{"setor", rep.Sectors}, {"ativo", rep.Assets}, {"medidor", rep.Meters}} {
+		for _, l := range sec.lines {
+			cov := ""
+			if sec.name != "setor" {
+				cov = pct(l.DataCoverage)
+			}
+			rows = append(rows, []string{sec.name, l.Name, num(l.KWh), num(l.CO2eKg), num(l.OKCount), opt(l.CO2eKgPerPiece), cov})
+		}
+	}
+	for _, p := range rep.Products {
+		perPiece := ""
+		if p.OKCount > 0 {
+			perPiece = opt(&p.CO2eKgPorPeca)
+		}
+		rows = append(rows, []string{"produto", p.Product, num(p.EnergiaKWh), num(p.CO2eKg), num(p.OKCount), perPiece, ""})
+	}
+	for _, t := range rep.Trend {
+		rows = append(rows, []string{"tendencia", t.Start.Format("2006-01-02"), num(t.KWh), num(t.CO2eKg), "", "", ""})
+	}
+	rows = append(rows, []string{"completude", "cobertura_fator_pct", "", "", "", "", pct(rep.Completeness.FactorCoverage)})
+	for _, s := range rep.Completeness.Warnings {
+		rows = append(rows, []string{"aviso", s, "", "", "", "", ""})
+	}
+	for _, s := range rep.Methodology {
+		rows = append(rows, []string{"metodologia", s, "", "", "", "", ""})
+	}
+	if err := cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
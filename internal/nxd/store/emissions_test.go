@@ -0,0 +1,119 @@
+package store
+
+import (
+	"bytes"
+	"encoding/csv"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestEmissionFactorLookup(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Sao_Paulo")
+	to := "2024-02-01"
+	p := newEnergyPricing(nil, []EmissionFactorRow{
+		{Region: "BR-SIN", ValidFrom: "2024-03-01", KgCO2ePerKWh: 0.05},
+		{Region: "BR-SIN", ValidFrom: "2024-01-01", ValidTo: &to, KgCO2ePerKWh: 0.04},
+	}, &ProductionCalendar{Location: loc}, 0)
+
+	cases := []struct {
+		t  time.Time
+		kg float64
+		ok bool
+	}{
+		{time.Date(2023, 12, 31, 23, 59, 0, 0, loc), 0, false},
+		{time.Date(2024, 1, 1, 0, 0, 0, 0, loc), 0.04, true},
+		{time.Date(2024, 1, 31, 23, 45, 0, 0, loc), 0.04, true},
+		{time.Date(2024, 2, 1, 0, 0, 0, 0, loc), 0, false}, // valid_to exclusivo, lacuna até março
+		{time.Date(2024, 3, 1, 0, 0, 0, 0, loc), 0.05, true},
+		{time.Date(2030, 1, 1, 0, 0, 0, 0, loc), 0.05, true}, // sem valid_to: aberto
+	}
+	for _, c := range cases {
+		kg, ok := p.emissionAt(c.t)
+		if kg != c.kg || ok != c.ok {
+			t.Errorf("%s: got %v/%v, want %v/%v", c.t, kg, ok, c.kg, c.ok)
+		}
+	}
+}
+
+func TestEnergyEmissionsAndESGTrend(t *testing.T) {
+	loc := time.UTC
+	t0 := time.Date(2024, 1, 31, 23, 30, 0, 0, loc)
+	cal := &ProductionCalendar{Location: loc}
+	pricing := newEnergyPricing(nil, []EmissionFactorRow{
+		{ValidFrom: "2024-01-01", KgCO2ePerKWh: 0.1},
+		{ValidFrom: "2024-02-01", KgCO2ePerKWh: 0.2},
+	}, cal, 0)
+	w := t0.Unix() / 900
+	// 10 kWh por janela: duas em janeiro, duas em fevereiro; medidor sem janela (absolute, fim do período).
+	windows := map[int64]float64{w: 10, w + 1: 10, w + 2: 10, w + 3: 10}
+	rep := &EnergyReport{Start: t0, End: t0.Add(time.Hour)}
+	sources := []EnergySource{{Kind: "asset", ID: uuid.New()}, {Kind: "meter", ID: uuid.New()}}
+	priceEnergy(rep, sources, []map[int64]float64{windows, {}}, []float64{0, 5}, pricing)
+	if math.Abs(sources[0].CO2eKg-6) > 1e-9 || math.Abs(sources[1].CO2eKg-1) > 1e-9 {
+		t.Fatalf("co2e = %v / %v", sources[0].CO2eKg, sources[1].CO2eKg)
+	}
+	if math.Abs(rep.CO2eKg-7) > 1e-9 || rep.KWhWithoutFactor != 0 || rep.KWh != 45 {
+		t.Fatalf("report co2e=%v without=%v kwh=%v", rep.CO2eKg, rep.KWhWithoutFactor, rep.KWh)
+	}
+	rep.setPieces(70)
+	if rep.CO2eKgPerPiece == nil || math.Abs(*rep.CO2eKgPerPiece-0.1) > 1e-9 {
+		t.Errorf("co2e per piece = %v", rep.CO2eKgPerPiece)
+	}
+
+	trend := esgTrend(rep, loc, t0, rep.End, "day")
+	if len(trend) != 2 || trend[0].KWh != 20 || math.Abs(trend[0].CO2eKg-2) > 1e-9 || math.Abs(trend[1].CO2eKg-4) > 1e-9 {
+		t.Errorf("trend = %+v", trend)
+	}
+	if m := esgTrend(rep, loc, t0, rep.End, "month"); len(m) != 2 || !m[1].Start.Equal(time.Date(2024, 2, 1, 0, 0, 0, 0, loc)) {
+		t.Errorf("month trend = %+v", m)
+	}
+
+	// Sem fator vigente: kWh entra no consumo, não no CO2e.
+	rep2 := &EnergyReport{Start: t0, End: t0.Add(time.Hour)}
+	none := newEnergyPricing(nil, nil, cal, 0)
+	priceEnergy(rep2, []EnergySource{{Kind: "asset"}}, []map[int64]float64{windows}, []float64{0}, none)
+	if rep2.CO2eKg != 0 || rep2.KWhWithoutFactor != 40 {
+		t.Errorf("without factor: co2e=%v without=%v", rep2.CO2eKg, rep2.KWhWithoutFactor)
+	}
+}
+
+func TestEnergyCoverage(t *testing.T) {
+	t0 := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	if n := energyWindowCount(t0, t0.Add(time.Hour)); n != 4 {
+		t.Errorf("window count = %d", n)
+	}
+	covered := map[int64]bool{}
+	markCoverage(covered, t0.Add(-5*time.Minute), t0.Add(20*time.Minute), t0) // janelas 0 e 1
+	markCoverage(covered, t0.Add(20*time.Minute), t0.Add(3*time.Hour), t0)    // lacuna > 1 h: ignorada
+	markCoverage(covered, t0.Add(45*time.Minute), t0.Add(46*time.Minute), t0) // janela 3
+	if len(covered) != 3 {
+		t.Errorf("covered = %v", covered)
+	}
+}
+
+func TestWriteESGCSV(t *testing.T) {
+	id := uuid.New()
+	per := 0.5
+	rep := &ESGReport{Region: "BR-SIN", KWh: 100, CO2eKg: 10, OKCount: 20, CO2eKgPerPiece: &per,
+		Assets:      []ESGLine{esgLine(&id, "Prensa 1", 100, 10, 20, 1)},
+		Sectors:     []ESGLine{esgLine(nil, "Fábrica (geral)", 100, 10, 20, 0)},
+		Products:    []ProductProfitability{{Product: "Peça, A", EnergiaKWh: 50, CO2eKg: 5}},
+		Methodology: []string{"Escopo 2"}}
+	var buf bytes.Buffer
+	if err := WriteESGCSV(&buf, rep); err != nil {
+		t.Fatal(err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) != 7 || rows[0][0] != "secao" || rows[1][3] != "10.000" {
+		t.Fatalf("rows = %v", rows)
+	}
+	if rows[3][1] != "Prensa 1" || rows[3][5] != "0.500000" || rows[4][1] != "Peça, A" || rows[4][5] != "" {
+		t.Errorf("rows = %v", rows)
+	}
+}
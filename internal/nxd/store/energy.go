@@ -0,0 +1,809 @@
+package store
+
+// energy.go — Gestão de energia: medidores, tarifa horária e demanda
+//
+// Fontes de kWh (todas contadores, semântica de counters.go):
+//   - tag_energy do mapeamento de cada ativo (consumo da máquina);
+//   - energy_meters: medidores adicionais (quadro geral, compressor, iluminação)
+//     atribuídos a um setor ou à fábrica (sector_id nulo). São cargas que NÃO
+//     estão nos tag_energy dos ativos: somam, não substituem.
+//
+// O acréscimo de cada leitura é distribuído uniformemente entre a leitura anterior
+// e a atual, em janelas de 15 min (a integração de demanda da concessionária).
+// Cada janela é precificada pelo seu início, no fuso da fábrica:
+//   - tarifa vigente = maior valid_from <= dia local da janela;
+//   - posto = primeiro período da tarifa cujo dia da semana e horário [start, end)
+//     contêm o início (end <= start cruza a meia-noite). Feriados da fábrica
+//     (calendar_exceptions holiday sem setor) e horários fora dos períodos são
+//     fora-ponta, a rate_kwh da tarifa;
+//   - sem tarifa vigente: custo_kwh fixo do business_config (posto "fixo").
+// Demanda de pico = maior soma de kWh de uma janela × 4 (kW), somando todas as
+// fontes do escopo. Custo de demanda = pico × demand_rate_kw da tarifa vigente no
+// pico, proporcional ao período (horas / 730 h de um mês médio).
+// Emissões (Escopo 2, emissions.go): cada janela também recebe o fator de emissão
+// da região da fábrica vigente no seu início; kWh sem fator ficam em KWhWithoutFactor.
+// Tags com reading_rule "absolute" não têm série de acréscimos: o valor entra
+// inteiro no posto (e no fator) do fim do período e fica fora da demanda.
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	energyWindow      = 15 * time.Minute
+	energyMonthHours  = 730.0
+	energyBandOffPeak = "fora_ponta"
+	energyBandFlat    = "fixo"
+)
+
+var (
+	// ErrInvalidEnergyConfig — medidor ou tarifa com campos inválidos.
+	ErrInvalidEnergyConfig = errors.New("configuração de energia inválida")
+	// ErrEnergyConflict — tag já usada por outro medidor ou tarifa com a mesma vigência.
+	ErrEnergyConflict = errors.New("já existe um medidor para esta tag ou uma tarifa com esta vigência")
+)
+
+// EnergyMeterRow — medidor de kWh adicional. AssetID/MetricKey identificam a tag
+// (o ativo que a publica); SectorID é o setor a que o consumo é atribuído (nil = fábrica).
+type EnergyMeterRow struct {
+	ID        uuid.UUID  `json:"id"`
+	FactoryID uuid.UUID  `json:"factory_id"`
+	AssetID   uuid.UUID  `json:"asset_id"`
+	MetricKey string     `json:"metric_key"`
+	SectorID  *uuid.UUID `json:"sector_id,omitempty"`
+	Name      string     `json:"name"`
+	Active    bool       `json:"active"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// EnergyTariffPeriod — posto horário (ponta, intermediário...). Weekdays: 0 = domingo … 6 = sábado.
+type EnergyTariffPeriod struct {
+	Name      string  `json:"name"`
+	StartTime string  `json:"start_time"` // HH:MM
+	EndTime   string  `json:"end_time"`   // HH:MM
+	Weekdays  []int   `json:"weekdays"`
+	RateKwh   float64 `json:"rate_kwh"`
+}
+
+// EnergyTariffRow — tarifa horária a partir de ValidFrom (YYYY-MM-DD, fuso da fábrica).
+// RateKwh vale para o fora-ponta; DemandRateKw é o R$/kW·mês sobre o pico de 15 min.
+type EnergyTariffRow struct {
+	ID                 uuid.UUID            `json:"id"`
+	FactoryID          uuid.UUID            `json:"factory_id"`
+	Name               string               `json:"name"`
+	ValidFrom          string               `json:"valid_from"`
+	RateKwh            float64              `json:"rate_kwh"`
+	DemandRateKw       float64              `json:"demand_rate_kw"`
+	ContractedDemandKw *float64             `json:"contracted_demand_kw,omitempty"`
+	Periods            []EnergyTariffPeriod `json:"periods"`
+	CreatedAt          time.Time            `json:"created_at"`
+}
+
+// ─── Medidores ──────────────────────────────────────────────────────────────
+
+// ListEnergyMeters retorna os medidores da fábrica.
+func ListEnergyMeters(db *sql.DB, factoryID uuid.UUID) ([]EnergyMeterRow, error) {
+	rows, err := db.Query(`
+		SELECT id, factory_id, asset_id, metric_key, sector_id, name, active, created_at
+		FROM nxd.energy_meters WHERE factory_id = $1 ORDER BY name, id
+	`, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []EnergyMeterRow
+	for rows.Next() {
+		var m EnergyMeterRow
+		var sectorID uuid.NullUUID
+		if err := rows.Scan(&m.ID, &m.FactoryID, &m.AssetID, &m.MetricKey, &sectorID, &m.Name, &m.Active, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		if sectorID.Valid {
+			m.SectorID = &sectorID.UUID
+		}
+		list = append(list, m)
+	}
+	return list, rows.Err()
+}
+
+func validateEnergyMeter(db *sql.DB, m *EnergyMeterRow) error {
+	m.Name = strings.TrimSpace(m.Name)
+	m.MetricKey = strings.TrimSpace(m.MetricKey)
+	if m.Name == "" || m.MetricKey == "" {
+		return fmt.Errorf("%w: name e metric_key são obrigatórios", ErrInvalidEnergyConfig)
+	}
+	if a, err := GetAssetByID(db, m.AssetID, m.FactoryID); err != nil {
+		return err
+	} else if a == nil {
+		return fmt.Errorf("%w: ativo não encontrado", ErrInvalidEnergyConfig)
+	}
+	if m.SectorID != nil {
+		if s, err := GetSectorByID(db, *m.SectorID, m.FactoryID); err != nil {
+			return err
+		} else if s == nil {
+			return fmt.Errorf("%w: setor não encontrado", ErrInvalidEnergyConfig)
+		}
+	}
+	return nil
+}
+
+// CreateEnergyMeter insere um medidor.
+func CreateEnergyMeter(db *sql.DB, m EnergyMeterRow) (uuid.UUID, error) {
+	if err := validateEnergyMeter(db, &m); err != nil {
+		return uuid.Nil, err
+	}
+	var id uuid.UUID
+	err := db.QueryRow(`
+		INSERT INTO nxd.energy_meters (factory_id, asset_id, metric_key, sector_id, name, active)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (asset_id, metric_key) DO NOTHING
+		RETURNING id
+	`, m.FactoryID, m.AssetID, m.MetricKey, m.SectorID, m.Name, m.Active).Scan(&id)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, ErrEnergyConflict
+	}
+	return id, err
+}
+
+// UpdateEnergyMeter substitui nome, setor e active (a tag não muda). false = não existe.
+func UpdateEnergyMeter(db *sql.DB, m EnergyMeterRow) (bool, error) {
+	if err := validateEnergyMeter(db, &m); err != nil {
+		return false, err
+	}
+	res, err := db.Exec(`
+		UPDATE nxd.energy_meters SET name = $1, sector_id = $2, active = $3
+		WHERE id = $4 AND factory_id = $5
+	`, m.Name, m.SectorID, m.Active, m.ID, m.FactoryID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// DeleteEnergyMeter remove o medidor. false = não existe.
+func DeleteEnergyMeter(db *sql.DB, factoryID, id uuid.UUID) (bool, error) {
+	res, err := db.Exec(`DELETE FROM nxd.energy_meters WHERE id = $1 AND factory_id = $2`, id, factoryID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ─── Tarifas ────────────────────────────────────────────────────────────────
+
+// ListEnergyTariffs retorna as tarifas da fábrica por vigência, com os postos.
+func ListEnergyTariffs(db *sql.DB, factoryID uuid.UUID) ([]EnergyTariffRow, error) {
+	rows, err := db.Query(`
+		SELECT id, factory_id, name, valid_from, rate_kwh, demand_rate_kw, contracted_demand_kw, created_at
+		FROM nxd.energy_tariffs WHERE factory_id = $1 ORDER BY valid_from
+	`, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	var list []EnergyTariffRow
+	index := map[uuid.UUID]int{}
+	for rows.Next() {
+		var t EnergyTariffRow
+		var validFrom time.Time
+		var contracted sql.NullFloat64
+		if err := rows.Scan(&t.ID, &t.FactoryID, &t.Name, &validFrom, &t.RateKwh, &t.DemandRateKw, &contracted, &t.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		t.ValidFrom = validFrom.Format("2006-01-02")
+		if contracted.Valid {
+			t.ContractedDemandKw = &contracted.Float64
+		}
+		t.Periods = []EnergyTariffPeriod{}
+		index[t.ID] = len(list)
+		list = append(list, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(list) == 0 {
+		return list, err
+	}
+	rows, err = db.Query(`
+		SELECT p.tariff_id, p.name, p.start_time, p.end_time, p.days_mask, p.rate_kwh
+		FROM nxd.energy_tariff_periods p
+		JOIN nxd.energy_tariffs t ON t.id = p.tariff_id
+		WHERE t.factory_id = $1 ORDER BY p.tariff_id, p.start_time
+	`, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var tariffID uuid.UUID
+		var p EnergyTariffPeriod
+		var mask int
+		if err := rows.Scan(&tariffID, &p.Name, &p.StartTime, &p.EndTime, &mask, &p.RateKwh); err != nil {
+			return nil, err
+		}
+		p.Weekdays = maskToWeekdays(mask)
+		if i, ok := index[tariffID]; ok {
+			list[i].Periods = append(list[i].Periods, p)
+		}
+	}
+	return list, rows.Err()
+}
+
+// validateEnergyTariff normaliza datas, horários e dias (sem dias = segunda a sexta)
+// e retorna a máscara de dias de cada posto.
+func validateEnergyTariff(t *EnergyTariffRow) ([]int, error) {
+	t.Name = strings.TrimSpace(t.Name)
+	if t.Name == "" {
+		return nil, fmt.Errorf("%w: nome da tarifa obrigatório", ErrInvalidEnergyConfig)
+	}
+	if _, err := time.Parse("2006-01-02", t.ValidFrom); err != nil {
+		return nil, fmt.Errorf("%w: valid_from %q (use YYYY-MM-DD)", ErrInvalidEnergyConfig, t.ValidFrom)
+	}
+	if t.RateKwh < 0 || t.DemandRateKw < 0 {
+		return nil, fmt.Errorf("%w: tarifas não podem ser negativas", ErrInvalidEnergyConfig)
+	}
+	if t.ContractedDemandKw != nil && *t.ContractedDemandKw <= 0 {
+		return nil, fmt.Errorf("%w: contracted_demand_kw deve ser positivo", ErrInvalidEnergyConfig)
+	}
+	masks := make([]int, len(t.Periods))
+	for i := range t.Periods {
+		p := &t.Periods[i]
+		p.Name = strings.TrimSpace(p.Name)
+		if p.Name == "" || p.Name == energyBandOffPeak || p.Name == energyBandFlat {
+			return nil, fmt.Errorf("%w: posto %d sem nome (fora_ponta e fixo são reservados)", ErrInvalidEnergyConfig, i+1)
+		}
+		if p.RateKwh < 0 {
+			return nil, fmt.Errorf("%w: posto %s com tarifa negativa", ErrInvalidEnergyConfig, p.Name)
+		}
+		var mins [2]int
+		for j, s := range []*string{&p.StartTime, &p.EndTime} {
+			m, err := ParseClock(*s)
+			if err != nil {
+				return nil, fmt.Errorf("%w: posto %s: horário %q (use HH:MM)", ErrInvalidEnergyConfig, p.Name, *s)
+			}
+			mins[j] = m
+			*s = fmt.Sprintf("%02d:%02d", m/60, m%60)
+		}
+		if mins[0] == mins[1] {
+			return nil, fmt.Errorf("%w: posto %s com início igual ao fim", ErrInvalidEnergyConfig, p.Name)
+		}
+		if len(p.Weekdays) == 0 {
+			p.Weekdays = []int{1, 2, 3, 4, 5}
+		}
+		mask, err := weekdaysToMask(p.Weekdays)
+		if err != nil {
+			return nil, fmt.Errorf("%w: posto %s: dia da semana inválido", ErrInvalidEnergyConfig, p.Name)
+		}
+		masks[i] = mask
+	}
+	return masks, nil
+}
+
+func insertTariffPeriods(tx *sql.Tx, tariffID uuid.UUID, periods []EnergyTariffPeriod, masks []int) error {
+	for i, p := range periods {
+		if _, err := tx.Exec(`
+			INSERT INTO nxd.energy_tariff_periods (tariff_id, name, start_time, end_time, days_mask, rate_kwh)
+			VALUES ($1, $2, $3, $4, $5, $6)
+		`, tariffID, p.Name, p.StartTime, p.EndTime, masks[i], p.RateKwh); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CreateEnergyTariff insere a tarifa e seus postos.
+func CreateEnergyTariff(db *sql.DB, t EnergyTariffRow) (uuid.UUID, error) {
+	masks, err := validateEnergyTariff(&t)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+	var id uuid.UUID
+	err = tx.QueryRow(`
+		INSERT INTO nxd.energy_tariffs (factory_id, name, valid_from, rate_kwh, demand_rate_kw, contracted_demand_kw)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (factory_id, valid_from) DO NOTHING
+		RETURNING id
+	`, t.FactoryID, t.Name, t.ValidFrom, t.RateKwh, t.DemandRateKw, t.ContractedDemandKw).Scan(&id)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, ErrEnergyConflict
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if err := insertTariffPeriods(tx, id, t.Periods, masks); err != nil {
+		return uuid.Nil, err
+	}
+	return id, tx.Commit()
+}
+
+// UpdateEnergyTariff substitui os campos e os postos da tarifa. false = não existe.
+func UpdateEnergyTariff(db *sql.DB, t EnergyTariffRow) (bool, error) {
+	masks, err := validateEnergyTariff(&t)
+	if err != nil {
+		return false, err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	var taken bool
+	if err := tx.QueryRow(`SELECT EXISTS (SELECT 1 FROM nxd.energy_tariffs WHERE factory_id = $1 AND valid_from = $2 AND id <> $3)`,
+		t.FactoryID, t.ValidFrom, t.ID).Scan(&taken); err != nil {
+		return false, err
+	}
+	if taken {
+		return false, ErrEnergyConflict
+	}
+	res, err := tx.Exec(`
+		UPDATE nxd.energy_tariffs SET name = $1, valid_from = $2, rate_kwh = $3, demand_rate_kw = $4, contracted_demand_kw = $5
+		WHERE id = $6 AND factory_id = $7
+	`, t.Name, t.ValidFrom, t.RateKwh, t.DemandRateKw, t.ContractedDemandKw, t.ID, t.FactoryID)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	if _, err := tx.Exec(`DELETE FROM nxd.energy_tariff_periods WHERE tariff_id = $1`, t.ID); err != nil {
+		return false, err
+	}
+	if err := insertTariffPeriods(tx, t.ID, t.Periods, masks); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// DeleteEnergyTariff remove a tarifa (os postos saem em cascata). false = não existe.
+func DeleteEnergyTariff(db *sql.DB, factoryID, id uuid.UUID) (bool, error) {
+	res, err := db.Exec(`DELETE FROM nxd.energy_tariffs WHERE id = $1 AND factory_id = $2`, id, factoryID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ─── Precificação ───────────────────────────────────────────────────────────
+
+type tariffBand struct {
+	name             string
+	mask             int
+	startMin, endMin int
+	rate             float64
+}
+
+type compiledTariff struct {
+	row   EnergyTariffRow
+	from  time.Time // meia-noite local de valid_from
+	bands []tariffBand
+}
+
+// energyPricing resolve tarifa, posto e fator de emissão de um instante.
+type energyPricing struct {
+	loc      *time.Location
+	tariffs  []compiledTariff // ordem de vigência
+	holidays []timeRange
+	flatRate float64
+	factors  []compiledFactor // ordem de vigência
+}
+
+func newEnergyPricing(tariffs []EnergyTariffRow, factors []EmissionFactorRow, cal *ProductionCalendar, flatRate float64) *energyPricing {
+	p := &energyPricing{loc: cal.Location, flatRate: flatRate, factors: compileEmissionFactors(factors, cal.Location)}
+	for _, ex := range cal.exceptions {
+		if ex.Kind == "holiday" && ex.SectorID == nil {
+			p.holidays = append(p.holidays, timeRange{ex.StartsAt, ex.EndsAt})
+		}
+	}
+	for _, t := range tariffs {
+		from, err := time.ParseInLocation("2006-01-02", t.ValidFrom, p.loc)
+		if err != nil {
+			continue
+		}
+		ct := compiledTariff{row: t, from: from}
+		for _, b := range t.Periods {
+			s, err1 := ParseClock(b.StartTime)
+			e, err2 := ParseClock(b.EndTime)
+			mask, err3 := weekdaysToMask(b.Weekdays)
+			if err1 != nil || err2 != nil || err3 != nil {
+				continue
+			}
+			ct.bands = append(ct.bands, tariffBand{name: b.Name, mask: mask, startMin: s, endMin: e, rate: b.RateKwh})
+		}
+		p.tariffs = append(p.tariffs, ct)
+	}
+	sort.SliceStable(p.tariffs, func(i, j int) bool { return p.tariffs[i].from.Before(p.tariffs[j].from) })
+	return p
+}
+
+// at retorna a tarifa vigente em t (nil = custo fixo), o posto e o R$/kWh.
+func (p *energyPricing) at(t time.Time) (*compiledTariff, string, float64) {
+	var tariff *compiledTariff
+	for i := range p.tariffs {
+		if p.tariffs[i].from.After(t) {
+			break
+		}
+		tariff = &p.tariffs[i]
+	}
+	if tariff == nil {
+		return nil, energyBandFlat, p.flatRate
+	}
+	for _, h := range p.holidays {
+		if !t.Before(h.Start) && t.Before(h.End) {
+			return tariff, energyBandOffPeak, tariff.row.RateKwh
+		}
+	}
+	lt := t.In(p.loc)
+	min := lt.Hour()*60 + lt.Minute()
+	for _, b := range tariff.bands {
+		if b.mask&(1<<int(lt.Weekday())) == 0 {
+			continue
+		}
+		in := min >= b.startMin && min < b.endMin
+		if b.endMin <= b.startMin {
+			in = min >= b.startMin || min < b.endMin
+		}
+		if in {
+			return tariff, b.name, b.rate
+		}
+	}
+	return tariff, energyBandOffPeak, tariff.row.RateKwh
+}
+
+// ─── Apuração ───────────────────────────────────────────────────────────────
+
+// EnergyBand — consumo e custo de um posto tarifário.
+type EnergyBand struct {
+	Name string  `json:"name"`
+	KWh  float64 `json:"kwh"`
+	Cost float64 `json:"cost"`
+}
+
+// EnergySource — consumo de uma tag: tag_energy de um ativo (kind "asset", ID =
+// ativo) ou medidor (kind "meter", ID = medidor).
+type EnergySource struct {
+	Kind      string     `json:"kind"`
+	ID        uuid.UUID  `json:"id"`
+	Name      string     `json:"name"`
+	SectorID  *uuid.UUID `json:"sector_id,omitempty"`
+	MetricKey string     `json:"metric_key"`
+	KWh       float64    `json:"kwh"`
+	Cost      float64    `json:"cost"`
+	CO2eKg    float64    `json:"co2e_kg"`
+
+	assetID uuid.UUID // ativo que publica a tag
+	rule    string
+	covered int // janelas de 15 min com leituras (completude do ESG)
+}
+
+// EnergyReport — consumo, custo por posto, demanda e kWh por peça boa do escopo.
+// Cost = ConsumptionCost + DemandCost.
+type EnergyReport struct {
+	Start              time.Time      `json:"start"`
+	End                time.Time      `json:"end"`
+	Tariff             string         `json:"tariff,omitempty"` // vigente no fim; vazio = custo_kwh fixo
+	KWh                float64        `json:"kwh"`
+	ConsumptionCost    float64        `json:"consumption_cost"`
+	DemandPeakKW       float64        `json:"demand_peak_kw"`
+	DemandPeakAt       *time.Time     `json:"demand_peak_at,omitempty"`
+	ContractedDemandKW *float64       `json:"contracted_demand_kw,omitempty"`
+	DemandOverrun      bool           `json:"demand_overrun"`
+	DemandCost         float64        `json:"demand_cost"`
+	Cost               float64        `json:"cost"`
+	OKCount            float64        `json:"ok_count"`
+	KWhPerPiece        *float64       `json:"kwh_per_piece"`
+	CostPerPiece       *float64       `json:"cost_per_piece"`
+	Bands              []EnergyBand   `json:"bands"`
+	Sources            []EnergySource `json:"sources"`
+	CO2eKg             float64        `json:"co2e_kg"`
+	CO2eKgPerPiece     *float64       `json:"co2e_kg_per_piece"`
+	KWhWithoutFactor   float64        `json:"kwh_without_factor"`
+
+	kwhWindows map[int64]float64 // soma das fontes por janela (tendência do ESG)
+	co2Windows map[int64]float64
+}
+
+// energyScope — tarifas, fatores de emissão da região e medidores de um escopo (setor ou fábrica).
+type energyScope struct {
+	tariffs []EnergyTariffRow
+	factors []EmissionFactorRow
+	meters  []EnergyMeterRow
+}
+
+// loadEnergyScope carrega as tarifas e os fatores de emissão da fábrica e, com withMeters, os medidores
+// ativos do setor (sectorID nil = todos os medidores da fábrica).
+func loadEnergyScope(db *sql.DB, factoryID uuid.UUID, sectorID *uuid.UUID, withMeters bool) (*energyScope, error) {
+	tariffs, err := ListEnergyTariffs(db, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	sc := &energyScope{tariffs: tariffs}
+	if sc.factors, err = regionEmissionFactors(db, factoryID); err != nil {
+		return nil, err
+	}
+	if !withMeters {
+		return sc, nil
+	}
+	meters, err := ListEnergyMeters(db, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	for _, m := range meters {
+		if !m.Active || (sectorID != nil && (m.SectorID == nil || *m.SectorID != *sectorID)) {
+			continue
+		}
+		sc.meters = append(sc.meters, m)
+	}
+	return sc, nil
+}
+
+// sources retorna as fontes dos medidores do escopo.
+func (sc *energyScope) sources() []EnergySource {
+	var out []EnergySource
+	for _, m := range sc.meters {
+		out = append(out, EnergySource{Kind: "meter", ID: m.ID, Name: m.Name, SectorID: m.SectorID,
+			MetricKey: m.MetricKey, assetID: m.AssetID})
+	}
+	return out
+}
+
+// spreadEnergy distribui inc uniformemente em [from, to) nas janelas de 15 min
+// (chave = unix / 900); from é limitado a floor. from >= to: tudo na janela de to.
+func spreadEnergy(windows map[int64]float64, from, to, floor time.Time, inc float64) {
+	if inc == 0 {
+		return
+	}
+	if from.Before(floor) {
+		from = floor
+	}
+	win := int64(energyWindow / time.Second)
+	if !from.Before(to) {
+		windows[to.Unix()/win] += inc
+		return
+	}
+	total := to.Sub(from).Seconds()
+	for t := from; t.Before(to); {
+		w := t.Unix() / win
+		next := time.Unix((w+1)*win, 0)
+		if next.After(to) {
+			next = to
+		}
+		windows[w] += inc * next.Sub(t).Seconds() / total
+		t = next
+	}
+}
+
+// energyWindowCount retorna quantas janelas de 15 min o período [start, end) toca.
+func energyWindowCount(start, end time.Time) int {
+	if !start.Before(end) {
+		return 0
+	}
+	win := int64(energyWindow / time.Second)
+	return int((end.Unix()-1)/win - start.Unix()/win + 1)
+}
+
+// markCoverage marca como cobertas as janelas entre duas leituras próximas (até
+// counterLookback), mesmo sem consumo: máquina parada com medidor online tem dado.
+func markCoverage(covered map[int64]bool, from, to, floor time.Time) {
+	if to.Sub(from) > counterLookback {
+		return
+	}
+	if from.Before(floor) {
+		from = floor
+	}
+	win := int64(energyWindow / time.Second)
+	for w := from.Unix() / win; w <= to.Add(-time.Nanosecond).Unix()/win; w++ {
+		covered[w] = true
+	}
+}
+
+// priceEnergy precifica as janelas de cada fonte e calcula a demanda do conjunto.
+// windows[i] são as janelas da fonte i; lump[i] é o kWh sem série (reading_rule absolute).
+func priceEnergy(rep *EnergyReport, sources []EnergySource, windows []map[int64]float64, lump []float64, pricing *energyPricing) {
+	win := int64(energyWindow / time.Second)
+	total := map[int64]float64{}
+	co2 := map[int64]float64{}
+	bands := map[string]*EnergyBand{}
+	addBand := func(name string, kwh, cost float64) {
+		b := bands[name]
+		if b == nil {
+			b = &EnergyBand{Name: name}
+			bands[name] = b
+		}
+		b.KWh += kwh
+		b.Cost += cost
+	}
+	for i := range sources {
+		src := &sources[i]
+		keys := make([]int64, 0, len(windows[i]))
+		for w := range windows[i] {
+			keys = append(keys, w)
+		}
+		sort.Slice(keys, func(a, b int) bool { return keys[a] < keys[b] })
+		for _, w := range keys {
+			kwh := windows[i][w]
+			ts := time.Unix(w*win, 0)
+			_, band, rate := pricing.at(ts)
+			src.KWh += kwh
+			src.Cost += kwh * rate
+			addBand(band, kwh, kwh*rate)
+			total[w] += kwh
+			if f, ok := pricing.emissionAt(ts); ok {
+				src.CO2eKg += kwh * f
+				co2[w] += kwh * f
+			} else {
+				rep.KWhWithoutFactor += kwh
+			}
+		}
+		if lump[i] != 0 {
+			_, band, rate := pricing.at(rep.End.Add(-time.Second))
+			src.KWh += lump[i]
+			src.Cost += lump[i] * rate
+			addBand(band, lump[i], lump[i]*rate)
+			if f, ok := pricing.emissionAt(rep.End.Add(-time.Second)); ok {
+				src.CO2eKg += lump[i] * f
+			} else {
+				rep.KWhWithoutFactor += lump[i]
+			}
+		}
+		rep.KWh += src.KWh
+		rep.ConsumptionCost += src.Cost
+		rep.CO2eKg += src.CO2eKg
+	}
+	rep.kwhWindows, rep.co2Windows = total, co2
+	var peakW int64
+	for w, kwh := range total {
+		if kw := kwh * float64(time.Hour/energyWindow); kw > rep.DemandPeakKW || (kw == rep.DemandPeakKW && w < peakW) {
+			rep.DemandPeakKW, peakW = kw, w
+		}
+	}
+	if tariff, _, _ := pricing.at(rep.End.Add(-time.Second)); tariff != nil {
+		rep.Tariff = tariff.row.Name
+	}
+	if rep.DemandPeakKW > 0 {
+		at := time.Unix(peakW*win, 0).UTC()
+		rep.DemandPeakAt = &at
+		if tariff, _, _ := pricing.at(at); tariff != nil {
+			rep.ContractedDemandKW = tariff.row.ContractedDemandKw
+			rep.DemandOverrun = rep.ContractedDemandKW != nil && rep.DemandPeakKW > *rep.ContractedDemandKW
+			rep.DemandCost = rep.DemandPeakKW * tariff.row.DemandRateKw * rep.End.Sub(rep.Start).Hours() / energyMonthHours
+		}
+	}
+	rep.Cost = rep.ConsumptionCost + rep.DemandCost
+	rep.Bands = []EnergyBand{}
+	for _, b := range bands {
+		rep.Bands = append(rep.Bands, *b)
+	}
+	sort.Slice(rep.Bands, func(i, j int) bool { return rep.Bands[i].Name < rep.Bands[j].Name })
+	rep.Sources = sources
+	if rep.Sources == nil {
+		rep.Sources = []EnergySource{}
+	}
+}
+
+// planEnergy agenda no lote a leitura das fontes no período; a função retornada
+// monta o relatório (sem peças) depois de b.run.
+func planEnergy(b *telemetryBatch, sources []EnergySource, pricing *energyPricing, start, end time.Time) func() *EnergyReport {
+	windows := make([]map[int64]float64, len(sources))
+	covered := make([]map[int64]bool, len(sources))
+	reads := make([]*telemetryRead, len(sources))
+	for i, src := range sources {
+		windows[i] = map[int64]float64{}
+		if src.rule == "absolute" {
+			reads[i] = b.delta(src.assetID, src.MetricKey, src.rule, start, end)
+			continue
+		}
+		w, cov := windows[i], map[int64]bool{}
+		covered[i] = cov
+		reads[i] = b.counter(src.assetID, src.MetricKey, start, end, func(prevTs, ts time.Time, inc float64) {
+			spreadEnergy(w, prevTs, ts, start, inc)
+			markCoverage(cov, prevTs, ts, start)
+		})
+	}
+	return func() *EnergyReport {
+		rep := &EnergyReport{Start: start, End: end}
+		lump := make([]float64, len(sources))
+		for i, src := range sources {
+			if src.rule != "absolute" {
+				sources[i].covered = len(covered[i])
+				continue
+			}
+			lump[i] = reads[i].value
+			if lump[i] != 0 {
+				sources[i].covered = energyWindowCount(start, end)
+			}
+		}
+		priceEnergy(rep, sources, windows, lump, pricing)
+		return rep
+	}
+}
+
+// setPieces preenche peças boas e os indicadores por peça.
+func (rep *EnergyReport) setPieces(ok float64) {
+	rep.OKCount = ok
+	rep.KWhPerPiece, rep.CostPerPiece, rep.CO2eKgPerPiece = nil, nil, nil
+	if ok > 0 {
+		kwh, cost, co2 := rep.KWh/ok, rep.Cost/ok, rep.CO2eKg/ok
+		rep.KWhPerPiece, rep.CostPerPiece, rep.CO2eKgPerPiece = &kwh, &cost, &co2
+	}
+}
+
+// EnergyQuery — escopo do relatório de energia. SectorID nil = fábrica inteira
+// (todos os ativos e todos os medidores).
+type EnergyQuery struct {
+	FactoryID uuid.UUID
+	SectorID  *uuid.UUID
+	Start     time.Time
+	End       time.Time
+}
+
+// ComputeEnergyReport calcula consumo, custo por posto, demanda de pico e kWh por
+// peça boa (tag_ok dos ativos do escopo). Sem business_config, o custo fixo é 0.
+func ComputeEnergyReport(db *sql.DB, q EnergyQuery) (*EnergyReport, error) {
+	assetIDs, assetSector, err := financialAssets(db, q.FactoryID, q.SectorID)
+	if err != nil {
+		return nil, err
+	}
+	assets, err := loadFinancialAssets(db, assetIDs, assetSector)
+	if err != nil {
+		return nil, err
+	}
+	cal, err := LoadProductionCalendar(db, q.FactoryID, q.Start, q.End)
+	if err != nil {
+		return nil, err
+	}
+	sc, err := loadEnergyScope(db, q.FactoryID, q.SectorID, true)
+	if err != nil {
+		return nil, err
+	}
+	var flat float64
+	if cfg, err := GetBusinessConfigBySector(db, q.FactoryID, q.SectorID); err != nil {
+		return nil, err
+	} else if cfg != nil {
+		flat = cfg.CustoKwh
+	}
+	batch := newTelemetryBatch()
+	sources, okReads := assetEnergySources(batch, assets, q.Start, q.End)
+	sources = append(sources, sc.sources()...)
+	finish := planEnergy(batch, sources, newEnergyPricing(sc.tariffs, sc.factors, cal, flat), q.Start, q.End)
+	if err := batch.run(db); err != nil {
+		return nil, err
+	}
+	var ok float64
+	for _, r := range okReads {
+		ok += r.value
+	}
+	rep := finish()
+	rep.setPieces(ok)
+	return rep, nil
+}
+
+// assetEnergySources monta as fontes tag_energy dos ativos e planeja no lote a leitura
+// das peças boas (tag_ok) de cada ativo no período.
+func assetEnergySources(b *telemetryBatch, assets []financialAsset, start, end time.Time) ([]EnergySource, map[uuid.UUID]*telemetryRead) {
+	var sources []EnergySource
+	okReads := map[uuid.UUID]*telemetryRead{}
+	for _, a := range assets {
+		m := a.mapping
+		if m.TagOK != "" {
+			okReads[a.id] = b.delta(a.id, m.TagOK, m.ReadingRule, start, end)
+		}
+		if m.TagEnergy != "" {
+			sources = append(sources, EnergySource{Kind: "asset", ID: a.id, Name: a.name, SectorID: a.sectorID,
+				MetricKey: m.TagEnergy, assetID: a.id, rule: m.ReadingRule})
+		}
+	}
+	return sources, okReads
+}
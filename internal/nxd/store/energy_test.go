@@ -0,0 +1,82 @@
+package store
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestEnergyPricingBands(t *testing.T) {
+	loc, _ := time.LoadLocation("America/Sao_Paulo")
+	holiday := time.Date(2024, 3, 29, 0, 0, 0, 0, loc) // sexta-feira santa
+	cal := &ProductionCalendar{Location: loc, exceptions: []CalendarExceptionRow{
+		{Kind: "holiday", StartsAt: holiday, EndsAt: holiday.Add(24 * time.Hour)},
+	}}
+	contracted := 100.0
+	p := newEnergyPricing([]EnergyTariffRow{
+		{Name: "2024", ValidFrom: "2024-03-01", RateKwh: 0.5, DemandRateKw: 30, ContractedDemandKw: &contracted, Periods: []EnergyTariffPeriod{
+			{Name: "ponta", StartTime: "18:00", EndTime: "21:00", Weekdays: []int{1, 2, 3, 4, 5}, RateKwh: 2},
+			{Name: "noturno", StartTime: "22:00", EndTime: "05:00", Weekdays: []int{0, 1, 2, 3, 4, 5, 6}, RateKwh: 0.3},
+		}},
+	}, nil, cal, 0.8)
+
+	at := func(day, hour, min int) time.Time { return time.Date(2024, 3, day, hour, min, 0, 0, loc) }
+	cases := []struct {
+		t    time.Time
+		band string
+		rate float64
+	}{
+		{at(1, 18, 0), "ponta", 2},
+		{at(1, 20, 45), "ponta", 2},
+		{at(1, 21, 0), energyBandOffPeak, 0.5},
+		{at(2, 19, 0), energyBandOffPeak, 0.5},  // sábado
+		{at(29, 19, 0), energyBandOffPeak, 0.5}, // feriado
+		{at(2, 23, 0), "noturno", 0.3},
+		{at(3, 4, 45), "noturno", 0.3},                                  // cruza a meia-noite
+		{time.Date(2024, 2, 28, 19, 0, 0, 0, loc), energyBandFlat, 0.8}, // antes da vigência
+	}
+	for _, c := range cases {
+		if _, band, rate := p.at(c.t); band != c.band || rate != c.rate {
+			t.Errorf("%s: %s %v, want %s %v", c.t, band, rate, c.band, c.rate)
+		}
+	}
+}
+
+func TestEnergySpreadAndDemand(t *testing.T) {
+	t0 := time.Date(2024, 3, 4, 12, 0, 0, 0, time.UTC) // segunda, 09:00 local
+	windows := map[int64]float64{}
+	// 30 kWh em 30 min a partir de 11:50 (antes do início): só os 20 min após t0 contam.
+	spreadEnergy(windows, t0.Add(-10*time.Minute), t0.Add(20*time.Minute), t0, 20)
+	spreadEnergy(windows, t0.Add(20*time.Minute), t0.Add(30*time.Minute), t0, 10)
+	w := t0.Unix() / 900
+	if math.Abs(windows[w]-15) > 1e-9 || math.Abs(windows[w+1]-15) > 1e-9 || len(windows) != 2 {
+		t.Fatalf("windows = %v", windows)
+	}
+
+	cal := &ProductionCalendar{Location: time.UTC}
+	contracted := 50.0
+	pricing := newEnergyPricing([]EnergyTariffRow{{Name: "T", ValidFrom: "2024-01-01", RateKwh: 1, DemandRateKw: 73, ContractedDemandKw: &contracted}}, nil, cal, 0)
+	rep := &EnergyReport{Start: t0, End: t0.Add(73 * time.Hour / 10)} // 7,3 h = 1% do mês
+	meter := map[int64]float64{w + 1: 5}
+	sources := []EnergySource{{Kind: "asset", ID: uuid.New()}, {Kind: "meter", ID: uuid.New()}}
+	priceEnergy(rep, sources, []map[int64]float64{windows, meter}, []float64{0, 2}, pricing)
+	if rep.KWh != 37 || rep.ConsumptionCost != 37 {
+		t.Fatalf("kwh=%v cost=%v", rep.KWh, rep.ConsumptionCost)
+	}
+	// Pico na segunda janela: (15 + 5) × 4 = 80 kW, acima dos 50 contratados.
+	if rep.DemandPeakKW != 80 || !rep.DemandPeakAt.Equal(t0.Add(15*time.Minute)) || !rep.DemandOverrun {
+		t.Errorf("peak = %v at %v overrun=%v", rep.DemandPeakKW, rep.DemandPeakAt, rep.DemandOverrun)
+	}
+	if math.Abs(rep.DemandCost-80*73*0.01) > 1e-9 || math.Abs(rep.Cost-rep.ConsumptionCost-rep.DemandCost) > 1e-9 {
+		t.Errorf("demand cost = %v, cost = %v", rep.DemandCost, rep.Cost)
+	}
+	if sources[1].KWh != 7 || len(rep.Bands) != 1 || rep.Bands[0].Name != energyBandOffPeak {
+		t.Errorf("sources = %+v bands = %+v", sources, rep.Bands)
+	}
+	rep.setPieces(74)
+	if rep.KWhPerPiece == nil || *rep.KWhPerPiece != 0.5 {
+		t.Errorf("kwh per piece = %v", rep.KWhPerPiece)
+	}
+}
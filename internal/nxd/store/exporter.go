@@ -0,0 +1,724 @@
+package store
+
+// exporter.go — Export de dados da fábrica (nxd.export_jobs → bundle .zip)
+//
+// Mesmo padrão do importer.go:
+//   - RunExportWorker() faz polling de nxd.export_jobs a cada exportPollInterval
+//     e reivindica um job 'pending' atomicamente (FOR UPDATE SKIP LOCKED).
+//   - rows_total/rows_done são atualizados durante o build para a UI mostrar
+//     progress_pct; cancelamento é verificado a cada exportProgressEvery linhas.
+//   - Jobs presos em 'running' após restart voltam para 'pending'.
+//
+// Conteúdo do bundle (zip, gravado no ArchiveStorage em exports/<factory>/<job>.zip):
+//   telemetry.csv        leituras do período (telemetry_log + arquivos frios)
+//   factory.json, sectors.json, assets.json, asset_metric_catalog.json
+//   tag_mappings.json, business_config.json, cost_parameters.json, exchange_rates.json,
+//   financial_scenarios.json, production_targets.json
+//   alert_rules.json, alerts.json, report_runs.json, ia_reports.json
+//   manifest.json        período, contagens e sha256 de cada arquivo acima
+//
+// O arquivo expira após exportRetention (status 'expired', objeto removido).
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	exportPollInterval   = 5 * time.Second
+	exportProgressEvery  = 5000 // rows between progress updates / cancel checks
+	exportMaxRuntime     = 6 * time.Hour
+	exportRetention      = 7 * 24 * time.Hour
+	exportManifestFormat = "nxd-export/1"
+)
+
+var errExportCancelled = errors.New("export cancelado")
+
+// ─── Job API ─────────────────────────────────────────────────────────────────
+
+// CreateExportJobParams are the parameters for a new export job.
+type CreateExportJobParams struct {
+	FactoryID        uuid.UUID
+	RequestedBy      int64 // legacy public.users id
+	PeriodStart      time.Time
+	PeriodEnd        time.Time
+	IncludeTelemetry bool
+}
+
+// CreateExportJob inserts a job in status='pending' and returns its ID.
+func CreateExportJob(db *sql.DB, p CreateExportJobParams) (uuid.UUID, error) {
+	id := uuid.New()
+	_, err := db.Exec(`
+		INSERT INTO nxd.export_jobs (id, factory_id, requested_by, period_start, period_end, include_telemetry)
+		VALUES ($1, $2, $3, $4, $5, $6)
+	`, id, p.FactoryID, p.RequestedBy, p.PeriodStart, p.PeriodEnd, p.IncludeTelemetry)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("create export job: %w", err)
+	}
+	log.Printf("➕ [ExportWorker] Created job %s (factory=%s, %s → %s)", id, p.FactoryID,
+		p.PeriodStart.Format(time.RFC3339), p.PeriodEnd.Format(time.RFC3339))
+	return id, nil
+}
+
+// ExportJobStatus is the API response shape (same progress fields as ImportJobStatus).
+type ExportJobStatus struct {
+	ID               string     `json:"id"`
+	FactoryID        string     `json:"factory_id"`
+	Status           string     `json:"status"`
+	PeriodStart      time.Time  `json:"period_start"`
+	PeriodEnd        time.Time  `json:"period_end"`
+	IncludeTelemetry bool       `json:"include_telemetry"`
+	RowsTotal        int64      `json:"rows_total"`
+	RowsDone         int64      `json:"rows_done"`
+	ProgressPct      float64    `json:"progress_pct"`
+	SizeBytes        *int64     `json:"size_bytes,omitempty"`
+	SHA256           *string    `json:"sha256,omitempty"`
+	ErrorMsg         *string    `json:"error_message,omitempty"`
+	StartedAt        *time.Time `json:"started_at,omitempty"`
+	FinishedAt       *time.Time `json:"finished_at,omitempty"`
+	ExpiresAt        *time.Time `json:"expires_at,omitempty"`
+	CreatedAt        time.Time  `json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+	objectKey        string
+}
+
+const exportJobColumns = `id, factory_id, status, period_start, period_end, include_telemetry,
+	rows_total, rows_done, size_bytes, sha256, error_message, started_at, finished_at, expires_at,
+	created_at, updated_at, object_key`
+
+func scanExportJobStatus(scan func(dest ...interface{}) error) (*ExportJobStatus, error) {
+	var j ExportJobStatus
+	var size sql.NullInt64
+	var sha, errMsg, key sql.NullString
+	var startedAt, finishedAt, expiresAt sql.NullTime
+	if err := scan(&j.ID, &j.FactoryID, &j.Status, &j.PeriodStart, &j.PeriodEnd, &j.IncludeTelemetry,
+		&j.RowsTotal, &j.RowsDone, &size, &sha, &errMsg, &startedAt, &finishedAt, &expiresAt,
+		&j.CreatedAt, &j.UpdatedAt, &key); err != nil {
+		return nil, err
+	}
+	if size.Valid {
+		j.SizeBytes = &size.Int64
+	}
+	if sha.Valid {
+		j.SHA256 = &sha.String
+	}
+	if errMsg.Valid {
+		j.ErrorMsg = &errMsg.String
+	}
+	if startedAt.Valid {
+		j.StartedAt = &startedAt.Time
+	}
+	if finishedAt.Valid {
+		j.FinishedAt = &finishedAt.Time
+	}
+	if expiresAt.Valid {
+		j.ExpiresAt = &expiresAt.Time
+	}
+	j.objectKey = key.String
+	if j.RowsTotal > 0 {
+		j.ProgressPct = float64(j.RowsDone) / float64(j.RowsTotal) * 100
+	}
+	return &j, nil
+}
+
+// GetExportJob returns a job by ID scoped to a factory (nil if not found).
+func GetExportJob(db *sql.DB, jobID, factoryID uuid.UUID) (*ExportJobStatus, error) {
+	row := db.QueryRow(`SELECT `+exportJobColumns+` FROM nxd.export_jobs WHERE id = $1 AND factory_id = $2`, jobID, factoryID)
+	j, err := scanExportJobStatus(row.Scan)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	return j, err
+}
+
+// ListExportJobs returns recent export jobs for a factory.
+func ListExportJobs(db *sql.DB, factoryID uuid.UUID, limit int) ([]ExportJobStatus, error) {
+	if limit <= 0 {
+		limit = 20
+	}
+	rows, err := db.Query(`SELECT `+exportJobColumns+` FROM nxd.export_jobs WHERE factory_id = $1 ORDER BY created_at DESC LIMIT $2`, factoryID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []ExportJobStatus
+	for rows.Next() {
+		j, err := scanExportJobStatus(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, *j)
+	}
+	return list, rows.Err()
+}
+
+// CancelExportJob sets a pending/running job to 'cancelled'; the worker stops at the next check.
+func CancelExportJob(db *sql.DB, jobID, factoryID uuid.UUID) error {
+	res, err := db.Exec(`
+		UPDATE nxd.export_jobs
+		SET status = 'cancelled', finished_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND factory_id = $2 AND status IN ('pending', 'running')
+	`, jobID, factoryID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return fmt.Errorf("job not found or already in terminal state")
+	}
+	log.Printf("🚫 [ExportWorker] Job %s cancelled via API", jobID)
+	return nil
+}
+
+// OpenExportBundle opens the zip of a finished job for download.
+func OpenExportBundle(ctx context.Context, db *sql.DB, storage ArchiveStorage, jobID, factoryID uuid.UUID) (io.ReadCloser, *ExportJobStatus, error) {
+	j, err := GetExportJob(db, jobID, factoryID)
+	if err != nil || j == nil {
+		return nil, nil, err
+	}
+	if j.Status != "done" || j.objectKey == "" {
+		return nil, j, fmt.Errorf("export não está pronto (status=%s)", j.Status)
+	}
+	f, err := storage.Open(ctx, j.objectKey)
+	return f, j, err
+}
+
+// ─── Worker ──────────────────────────────────────────────────────────────────
+
+// RecoverStaleExportJobs resets jobs stuck in 'running' after a restart.
+func RecoverStaleExportJobs(db *sql.DB) {
+	res, err := db.Exec(`
+		UPDATE nxd.export_jobs
+		SET status = 'pending', error_message = 'Worker restarted (auto-recovery)',
+		    rows_done = 0, started_at = NULL, updated_at = NOW()
+		WHERE status = 'running' AND updated_at < NOW() - INTERVAL '10 minutes'
+	`)
+	if err != nil {
+		log.Printf("⚠️  [ExportWorker] RecoverStaleExportJobs error: %v", err)
+		return
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		log.Printf("🔁 [ExportWorker] Recovered %d stale running job(s) → pending", n)
+	}
+}
+
+// RunExportWorker starts the export job processor. legacyDB (public.*) is
+// used for ia_reports and may be nil.
+func RunExportWorker(ctx context.Context, db, legacyDB *sql.DB) {
+	RecoverStaleExportJobs(db)
+	log.Println("✓ [ExportWorker] Background export worker started (poll interval: 5s)")
+	ticker := time.NewTicker(exportPollInterval)
+	defer ticker.Stop()
+	expireTicker := time.NewTicker(time.Hour)
+	defer expireTicker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			log.Println("⏹  [ExportWorker] Shutdown signal received, worker stopping.")
+			return
+		case <-expireTicker.C:
+			expireExportJobs(ctx, db, GetArchiveStorage())
+		case <-ticker.C:
+			if err := claimAndProcessExport(ctx, db, legacyDB); err != nil {
+				log.Printf("⚠️  [ExportWorker] Poll error: %v", err)
+			}
+		}
+	}
+}
+
+type exportJob struct {
+	ID               uuid.UUID
+	FactoryID        uuid.UUID
+	PeriodStart      time.Time
+	PeriodEnd        time.Time
+	IncludeTelemetry bool
+}
+
+func claimAndProcessExport(ctx context.Context, db, legacyDB *sql.DB) error {
+	var job exportJob
+	err := db.QueryRowContext(ctx, `
+		UPDATE nxd.export_jobs
+		SET status = 'running', started_at = NOW(), rows_done = 0, updated_at = NOW()
+		WHERE id = (
+			SELECT id FROM nxd.export_jobs
+			WHERE status = 'pending'
+			ORDER BY created_at
+			LIMIT 1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, factory_id, period_start, period_end, include_telemetry
+	`).Scan(&job.ID, &job.FactoryID, &job.PeriodStart, &job.PeriodEnd, &job.IncludeTelemetry)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("claim export job: %w", err)
+	}
+	log.Printf("🔄 [ExportWorker] Claimed job %s (factory=%s)", job.ID, job.FactoryID)
+
+	jobCtx, cancel := context.WithTimeout(ctx, exportMaxRuntime)
+	defer cancel()
+	start := time.Now()
+	if err := processExportJob(jobCtx, db, legacyDB, GetArchiveStorage(), &job); err != nil {
+		if errors.Is(err, errExportCancelled) {
+			log.Printf("🚫 [ExportWorker] Job %s CANCELLED", job.ID)
+			return nil
+		}
+		log.Printf("❌ [ExportWorker] Job %s FAILED: %v", job.ID, err)
+		db.Exec(`UPDATE nxd.export_jobs SET status = 'failed', error_message = $2, finished_at = NOW(), updated_at = NOW() WHERE id = $1`,
+			job.ID, err.Error())
+		return nil
+	}
+	log.Printf("✅ [ExportWorker] Job %s done in %s", job.ID, time.Since(start).Round(time.Second))
+	return nil
+}
+
+// exportProgress tracks rows_done and checks for cancellation periodically.
+type exportProgress struct {
+	db      *sql.DB
+	jobID   uuid.UUID
+	done    int64
+	pending int64
+}
+
+func (p *exportProgress) add(n int64) error {
+	p.done += n
+	p.pending += n
+	if p.pending < exportProgressEvery {
+		return nil
+	}
+	return p.flush()
+}
+
+func (p *exportProgress) flush() error {
+	p.pending = 0
+	var status string
+	if err := p.db.QueryRow(`
+		UPDATE nxd.export_jobs SET rows_done = $2, updated_at = NOW() WHERE id = $1 RETURNING status
+	`, p.jobID, p.done).Scan(&status); err != nil {
+		return err
+	}
+	if status == "cancelled" {
+		return errExportCancelled
+	}
+	return nil
+}
+
+func processExportJob(ctx context.Context, db, legacyDB *sql.DB, storage ArchiveStorage, job *exportJob) error {
+	total, err := estimateExportRows(db, job)
+	if err != nil {
+		return err
+	}
+	db.Exec(`UPDATE nxd.export_jobs SET rows_total = $2, updated_at = NOW() WHERE id = $1`, job.ID, total)
+
+	key := fmt.Sprintf("exports/%s/%s.zip", job.FactoryID, job.ID)
+	progress := &exportProgress{db: db, jobID: job.ID}
+
+	pr, pw := io.Pipe()
+	buildErr := make(chan error, 1)
+	go func() {
+		err := buildExportBundle(ctx, pw, db, legacyDB, storage, job, progress)
+		pw.CloseWithError(err)
+		buildErr <- err
+	}()
+	bundleHash := sha256.New()
+	size, err := storage.Put(ctx, key, io.TeeReader(pr, bundleHash))
+	pr.CloseWithError(err)
+	if berr := <-buildErr; berr != nil {
+		err = berr
+	}
+	if err != nil {
+		_ = storage.Delete(context.Background(), key)
+		return err
+	}
+
+	res, err := db.Exec(`
+		UPDATE nxd.export_jobs
+		SET status = 'done', rows_done = $2, rows_total = $2, object_key = $3, size_bytes = $4, sha256 = $5,
+		    finished_at = NOW(), expires_at = NOW() + $6::interval, updated_at = NOW()
+		WHERE id = $1 AND status = 'running'
+	`, job.ID, progress.done, key, size, hex.EncodeToString(bundleHash.Sum(nil)), exportRetention.String())
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		// Cancelado entre a última verificação e o fim do build.
+		_ = storage.Delete(context.Background(), key)
+		return errExportCancelled
+	}
+	return nil
+}
+
+// estimateExportRows: telemetry rows (live + archived parts) plus one unit per JSON section.
+func estimateExportRows(db *sql.DB, job *exportJob) (int64, error) {
+	total := int64(len(exportSections) + 1) // + ia_reports
+	if !job.IncludeTelemetry {
+		return total, nil
+	}
+	var live, archived int64
+	if err := db.QueryRow(`
+		SELECT COUNT(*) FROM nxd.telemetry_log WHERE factory_id = $1 AND ts >= $2 AND ts < $3
+	`, job.FactoryID, job.PeriodStart, job.PeriodEnd).Scan(&live); err != nil {
+		return 0, err
+	}
+	if err := db.QueryRow(`
+		SELECT COALESCE(SUM(row_count), 0) FROM nxd.telemetry_archives
+		WHERE factory_id = $1 AND status = 'done' AND period_end > $2 AND period_start < $3
+	`, job.FactoryID, job.PeriodStart, job.PeriodEnd).Scan(&archived); err != nil {
+		return 0, err
+	}
+	return total + live + archived, nil
+}
+
+// ─── Bundle ──────────────────────────────────────────────────────────────────
+
+// ExportManifest is written as manifest.json inside the bundle.
+type ExportManifest struct {
+	Format      string               `json:"format"`
+	JobID       uuid.UUID            `json:"job_id"`
+	FactoryID   uuid.UUID            `json:"factory_id"`
+	PeriodStart time.Time            `json:"period_start"`
+	PeriodEnd   time.Time            `json:"period_end"`
+	GeneratedAt time.Time            `json:"generated_at"`
+	Files       []ExportManifestFile `json:"files"`
+	Warnings    []string             `json:"warnings,omitempty"`
+}
+
+// ExportManifestFile describes one file of the bundle; sha256 is of the uncompressed content.
+type ExportManifestFile struct {
+	Name   string `json:"name"`
+	Rows   int64  `json:"rows"`
+	Bytes  int64  `json:"bytes"`
+	SHA256 string `json:"sha256"`
+}
+
+type exportSection struct {
+	name   string
+	query  string
+	ranged bool // query takes period_start/period_end as $2/$3
+}
+
+// exportSections are the JSON files taken from the NXD schema ($1 = factory_id).
+var exportSections = []exportSection{
+	{"factory.json", `SELECT id, name, is_active, created_at, updated_at FROM nxd.factories WHERE id = $1`, false},
+	{"sectors.json", `SELECT id, name, description, created_at, updated_at FROM nxd.sectors WHERE factory_id = $1 ORDER BY name`, false},
+	{"assets.json", `
+		SELECT a.id, a.group_id AS sector_id, s.name AS sector_name, a.source_tag_id, a.display_name,
+		       a.description, a.annotations, a.expected_interval_s, a.created_at, a.updated_at
+		FROM nxd.assets a
+		LEFT JOIN nxd.sectors s ON s.id = a.group_id
+		WHERE a.factory_id = $1
+		ORDER BY a.display_name`, false},
+	{"asset_metric_catalog.json", `
+		SELECT asset_id, metric_key, first_seen, last_seen
+		FROM nxd.asset_metric_catalog WHERE factory_id = $1 ORDER BY asset_id, metric_key`, false},
+	{"tag_mappings.json", `
+		SELECT m.id, m.asset_id, a.display_name AS asset_name, m.tag_ok, m.tag_nok, m.tag_status,
+		       m.reading_rule, m.created_at, m.updated_at
+		FROM nxd.tag_mapping m
+		JOIN nxd.assets a ON a.id = m.asset_id
+		WHERE a.factory_id = $1
+		ORDER BY a.display_name`, false},
+	{"business_config.json", `
+		SELECT id, sector_id, valor_venda_ok, custo_refugo_un, custo_parada_h, custo_material_un, custo_mao_obra_turno, created_at, updated_at
+		FROM nxd.business_config WHERE factory_id = $1 ORDER BY sector_id NULLS FIRST`, false},
+	{"cost_parameters.json", `
+		SELECT id, sector_id, asset_id, product, valid_from, currency, valor_venda_ok, custo_refugo_un, custo_parada_h,
+		       custo_material_un, custo_mao_obra_turno, notes, created_at
+		FROM nxd.cost_parameters WHERE factory_id = $1 ORDER BY valid_from, created_at`, false},
+	{"exchange_rates.json", `
+		SELECT id, currency, valid_from, rate, created_at
+		FROM nxd.exchange_rates WHERE factory_id = $1 ORDER BY currency, valid_from`, false},
+	{"financial_scenarios.json", `
+		SELECT id, sector_id, name, description, baseline_start, baseline_end, params, result, created_by, created_at
+		FROM nxd.financial_scenarios WHERE factory_id = $1 ORDER BY created_at`, false},
+	{"production_targets.json", `
+		SELECT id, sector_id, asset_id, period, shift_id, metric, target, valid_from, valid_to, notes, created_at, updated_at
+		FROM nxd.production_targets WHERE factory_id = $1 ORDER BY valid_from, created_at`, false},
+	{"alert_rules.json", `
+		SELECT id, scope_type, scope_id, condition_type, threshold, channel, created_at
+		FROM nxd.alert_rules WHERE factory_id = $1 ORDER BY created_at`, false},
+	{"alerts.json", `
+		SELECT a.id, a.ts, a.rule_id, a.asset_id, a.group_id, a.severity, a.message, a.acknowledged_by, a.acknowledged_at
+		FROM nxd.alerts a
+		JOIN nxd.alert_rules r ON r.id = a.rule_id
+		WHERE r.factory_id = $1 AND a.ts >= $2 AND a.ts < $3
+		ORDER BY a.ts`, true},
+	{"report_runs.json", `
+		SELECT id, requested_by, filters, status, result_json, export_url, created_at, updated_at
+		FROM nxd.report_runs
+		WHERE factory_id = $1 AND created_at >= $2 AND created_at < $3
+		ORDER BY created_at`, true},
+}
+
+// hashingWriter counts and hashes everything written through it.
+type hashingWriter struct {
+	w io.Writer
+	h hash.Hash
+	n int64
+}
+
+func (hw *hashingWriter) Write(p []byte) (int, error) {
+	n, err := hw.w.Write(p)
+	hw.h.Write(p[:n])
+	hw.n += int64(n)
+	return n, err
+}
+
+type bundleWriter struct {
+	zw       *zip.Writer
+	manifest *ExportManifest
+}
+
+func (b *bundleWriter) entry(name string, write func(w io.Writer) (int64, error)) error {
+	zf, err := b.zw.Create(name)
+	if err != nil {
+		return err
+	}
+	hw := &hashingWriter{w: zf, h: sha256.New()}
+	rows, err := write(hw)
+	if err != nil {
+		return fmt.Errorf("%s: %w", name, err)
+	}
+	b.manifest.Files = append(b.manifest.Files, ExportManifestFile{
+		Name: name, Rows: rows, Bytes: hw.n, SHA256: hex.EncodeToString(hw.h.Sum(nil)),
+	})
+	return nil
+}
+
+func buildExportBundle(ctx context.Context, out io.Writer, db, legacyDB *sql.DB, storage ArchiveStorage, job *exportJob, progress *exportProgress) error {
+	zw := zip.NewWriter(out)
+	b := &bundleWriter{zw: zw, manifest: &ExportManifest{
+		Format:      exportManifestFormat,
+		JobID:       job.ID,
+		FactoryID:   job.FactoryID,
+		PeriodStart: job.PeriodStart,
+		PeriodEnd:   job.PeriodEnd,
+		GeneratedAt: time.Now().UTC(),
+	}}
+
+	if job.IncludeTelemetry {
+		if err := b.entry("telemetry.csv", func(w io.Writer) (int64, error) {
+			return writeExportTelemetry(ctx, w, db, storage, job, progress)
+		}); err != nil {
+			return err
+		}
+	}
+
+	for _, s := range exportSections {
+		args := []interface{}{job.FactoryID}
+		if s.ranged {
+			args = append(args, job.PeriodStart, job.PeriodEnd)
+		}
+		if err := b.entry(s.name, func(w io.Writer) (int64, error) {
+			return writeJSONRows(ctx, w, db, s.query, args...)
+		}); err != nil {
+			return err
+		}
+		if err := progress.add(1); err != nil {
+			return err
+		}
+	}
+
+	// ia_reports vive no schema legado (public.*), possivelmente em outro banco.
+	if legacyDB != nil {
+		err := b.entry("ia_reports.json", func(w io.Writer) (int64, error) {
+			return writeJSONRows(ctx, w, legacyDB, `
+				SELECT id, user_id, title, text_content, sources_json, created_at
+				FROM ia_reports
+				WHERE factory_id = $1 AND created_at >= $2 AND created_at < $3
+				ORDER BY created_at`, job.FactoryID.String(), job.PeriodStart, job.PeriodEnd)
+		})
+		if err != nil {
+			return err
+		}
+	} else {
+		b.manifest.Warnings = append(b.manifest.Warnings, "ia_reports não exportado: banco legado indisponível")
+	}
+	if err := progress.add(1); err != nil {
+		return err
+	}
+	if err := progress.flush(); err != nil {
+		return err
+	}
+
+	mf, err := zw.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(mf)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(b.manifest); err != nil {
+		return err
+	}
+	return zw.Close()
+}
+
+// writeExportTelemetry writes archived parts first, then live rows, as CSV.
+func writeExportTelemetry(ctx context.Context, w io.Writer, db *sql.DB, storage ArchiveStorage, job *exportJob, progress *exportProgress) (int64, error) {
+	cw := csv.NewWriter(w)
+	if err := cw.Write([]string{"ts", "asset_id", "metric_key", "metric_value", "status"}); err != nil {
+		return 0, err
+	}
+	var n int64
+	var stopErr error
+	emit := func(rec []string) bool {
+		if err := cw.Write(rec); err != nil {
+			stopErr = err
+			return false
+		}
+		n++
+		if err := progress.add(1); err != nil {
+			stopErr = err
+			return false
+		}
+		return true
+	}
+
+	archives, err := ListTelemetryArchives(db, job.FactoryID, job.PeriodStart, job.PeriodEnd, true)
+	if err != nil {
+		return n, err
+	}
+	for _, a := range archives {
+		err := forEachArchiveRecord(ctx, storage, a.ObjectKey, func(rec []string) bool {
+			ts, err := time.Parse(time.RFC3339Nano, rec[0])
+			if err != nil || ts.Before(job.PeriodStart) || !ts.Before(job.PeriodEnd) {
+				return true
+			}
+			return emit([]string{rec[0], rec[1], rec[2], rec[3], rec[4]})
+		})
+		if stopErr != nil {
+			return n, stopErr
+		}
+		if err != nil {
+			return n, fmt.Errorf("arquivo %s: %w", a.ObjectKey, err)
+		}
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT ts, asset_id, metric_key, metric_value, status
+		FROM nxd.telemetry_log
+		WHERE factory_id = $1 AND ts >= $2 AND ts < $3
+		ORDER BY ts`, job.FactoryID, job.PeriodStart, job.PeriodEnd)
+	if err != nil {
+		return n, err
+	}
+	defer rows.Close()
+	rec := make([]string, 5)
+	for rows.Next() {
+		var ts time.Time
+		var assetID, metricKey, status sql.NullString
+		var value sql.NullFloat64
+		if err := rows.Scan(&ts, &assetID, &metricKey, &value, &status); err != nil {
+			return n, err
+		}
+		rec[0] = ts.UTC().Format(time.RFC3339Nano)
+		rec[1] = assetID.String
+		rec[2] = metricKey.String
+		rec[3] = ""
+		if value.Valid {
+			rec[3] = strconv.FormatFloat(value.Float64, 'g', -1, 64)
+		}
+		rec[4] = status.String
+		if !emit(rec) {
+			return n, stopErr
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	cw.Flush()
+	return n, cw.Error()
+}
+
+// writeJSONRows writes the query result as a JSON array of objects keyed by
+// column name. JSON/JSONB columns are embedded as-is.
+func writeJSONRows(ctx context.Context, w io.Writer, db *sql.DB, query string, args ...interface{}) (int64, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	cols, err := rows.ColumnTypes()
+	if err != nil {
+		return 0, err
+	}
+	if _, err := io.WriteString(w, "["); err != nil {
+		return 0, err
+	}
+	vals := make([]interface{}, len(cols))
+	ptrs := make([]interface{}, len(cols))
+	for i := range vals {
+		ptrs[i] = &vals[i]
+	}
+	var n int64
+	for rows.Next() {
+		if err := rows.Scan(ptrs...); err != nil {
+			return n, err
+		}
+		obj := make(map[string]interface{}, len(cols))
+		for i, c := range cols {
+			v := vals[i]
+			if b, ok := v.([]byte); ok {
+				t := strings.ToUpper(c.DatabaseTypeName())
+				if (t == "JSON" || t == "JSONB") && json.Valid(b) {
+					v = json.RawMessage(append([]byte(nil), b...))
+				} else {
+					v = string(b)
+				}
+			}
+			obj[c.Name()] = v
+		}
+		sep := "\n  "
+		if n > 0 {
+			sep = ",\n  "
+		}
+		line, err := json.Marshal(obj)
+		if err != nil {
+			return n, err
+		}
+		if _, err := io.WriteString(w, sep+string(line)); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if err := rows.Err(); err != nil {
+		return n, err
+	}
+	_, err = io.WriteString(w, "\n]\n")
+	return n, err
+}
+
+// expireExportJobs removes bundles past expires_at.
+func expireExportJobs(ctx context.Context, db *sql.DB, storage ArchiveStorage) {
+	rows, err := db.QueryContext(ctx, `
+		UPDATE nxd.export_jobs SET status = 'expired', updated_at = NOW()
+		WHERE status = 'done' AND expires_at < NOW()
+		RETURNING object_key`)
+	if err != nil {
+		log.Printf("⚠️  [ExportWorker] expire: %v", err)
+		return
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var key sql.NullString
+		if rows.Scan(&key) == nil && key.Valid {
+			_ = storage.Delete(ctx, key.String)
+		}
+	}
+}
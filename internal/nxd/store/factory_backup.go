@@ -0,0 +1,1936 @@
+package store
+
+// factory_backup.go — Backup, restore e clone de uma fábrica inteira (schema nxd)
+//
+// Uso típico: reproduzir o setup de um cliente em staging ou mover uma fábrica
+// demo para outro projeto. Diferente do export (exporter.go), que é um bundle
+// para leitura humana/BI, o backup é pensado para ser restaurado.
+//
+// Formato "nxd-backup/1": gzip + JSON Lines. Cada linha é {"t":"<tipo>","d":{...}}.
+// A primeira linha é o cabeçalho e a última é "end" com as contagens; um arquivo
+// sem "end" está truncado e o restore é recusado. Os registros saem em ordem de
+// dependência (usuários → fábrica → setores → ativos → ...) para que o restore
+// seja streaming e resolva as FKs pelo mapa de IDs à medida que lê.
+//
+// Conteúdo:
+//   user            dono da fábrica (no NXD a associação usuário↔fábrica é
+//                   factories.user_id) e a conta de login legada dele (public.users e
+//                   public.factories, via LoginAccounts) — sem hash de senha nem perfil
+//   factory         nome, is_active, fuso, região de emissão, moeda e segmento — a API key e o
+//                   opt-in do benchmark NÃO são copiados; o restore gera uma nova key
+//   sector, asset, tag_mapping, counter_config, energy_meter, energy_tariff,
+//   emission_factor, business_config, cost_parameter, exchange_rate, planned_downtime, shift, calendar_exception,
+//   production_target, forecast_series, health_model, health_tag, maintenance_event, alert_rule, downtime_reason,
+//   downtime_event, production_order, defect_type, inspection, inspection_attachment, annotation, virtual_metric,
+//   metric_catalog
+//                   (previsões emitidas e o histórico de saúde não são copiados: os workers recalculam)
+//   telemetry       opcional: arquivos frios + telemetry_log
+//
+// Remapeamento de IDs: no modo clone todos os UUIDs (fábrica, setores, ativos,
+// mapeamentos, configs, regras) são regerados, então a fábrica pode ser clonada
+// no mesmo banco sem colisão. No modo restore os IDs originais são mantidos e a
+// operação falha se a fábrica já existir. Usuários são casados por email.
+//
+// Dono: a API resolve usuário → fábrica pela fábrica mais antiga do dono, então o
+// restore recusa um dono que já tem fábrica (ErrBackupOwnerHasFactory) e exige que
+// ele tenha conta de login — a do backup é criada se o email ainda não existir,
+// como operador e com a senha bloqueada (LockedPasswordHash): um backup adulterado
+// não cria admin, e hashes de produção não vão para staging. Senha e perfil ficam
+// com um admin depois do restore (o resultado traz o aviso).
+// Tudo roda em uma única transação: ou a fábrica inteira entra, ou nada entra.
+
+import (
+	"compress/gzip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+
+	"hubsystem/core"
+
+	"github.com/google/uuid"
+)
+
+// FactoryBackupFormat identifica a versão do formato do arquivo de backup.
+const FactoryBackupFormat = "nxd-backup/1"
+
+const backupTelemetryBatch = 5000
+
+// ErrBackupFactoryExists é retornado pelo restore (sem clone) quando a fábrica
+// do backup já existe no banco de destino.
+var ErrBackupFactoryExists = errors.New("fábrica do backup já existe neste banco (use clone)")
+
+// ErrBackupOwnerHasFactory — o dono escolhido já tem fábrica e não chegaria à restaurada.
+var ErrBackupOwnerHasFactory = errors.New("o dono já possui uma fábrica; informe owner_email de um usuário sem fábrica")
+
+// BackupHeader é a primeira linha do arquivo.
+type BackupHeader struct {
+	Format           string    `json:"format"`
+	SourceFactoryID  uuid.UUID `json:"source_factory_id"`
+	FactoryName      string    `json:"factory_name"`
+	IncludeTelemetry bool      `json:"include_telemetry"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// BackupUser é um usuário NXD associado à fábrica (sem hash de senha).
+type BackupUser struct {
+	ID    uuid.UUID    `json:"id"`
+	Name  string       `json:"name"`
+	Email string       `json:"email"`
+	Login *BackupLogin `json:"login,omitempty"`
+}
+
+// BackupLogin é a conta de login do usuário no schema legado (public.users e a
+// fábrica legada em public.factories), casada com nxd.users pelo email. Não leva
+// hash de senha nem perfil: a conta restaurada é criada como operador, bloqueada.
+type BackupLogin struct {
+	FullName    string `json:"full_name,omitempty"`
+	FactoryName string `json:"factory_name,omitempty"`
+	CNPJ        string `json:"cnpj,omitempty"`
+	Address     string `json:"address,omitempty"`
+}
+
+// LockedPasswordHash é o password_hash das contas criadas pelo restore: não é um
+// hash bcrypt, então nenhuma senha confere até um admin definir uma nova.
+const LockedPasswordHash = "!restored"
+
+// LoginAccounts acessa as contas de login, que ficam no banco legado; a API
+// registra a implementação com SetLoginAccounts.
+type LoginAccounts interface {
+	// GetLogin retorna a conta do email (nil se não existir).
+	GetLogin(ctx context.Context, email string) (*BackupLogin, error)
+	// EnsureLogin cria a conta (e a fábrica legada) se o email ainda não existir,
+	// com perfil operador e senha LockedPasswordHash.
+	EnsureLogin(ctx context.Context, email string, l BackupLogin) error
+}
+
+var (
+	loginAccountsMu sync.RWMutex
+	loginAccounts   LoginAccounts
+)
+
+// SetLoginAccounts registra o acesso às contas de login usado por backup e restore.
+func SetLoginAccounts(a LoginAccounts) {
+	loginAccountsMu.Lock()
+	loginAccounts = a
+	loginAccountsMu.Unlock()
+}
+
+func getLoginAccounts() LoginAccounts {
+	loginAccountsMu.RLock()
+	defer loginAccountsMu.RUnlock()
+	return loginAccounts
+}
+
+// BackupFactory são os dados da fábrica (sem API key).
+type BackupFactory struct {
+	ID       uuid.UUID  `json:"id"`
+	UserID   *uuid.UUID `json:"user_id"`
+	Name     string     `json:"name"`
+	IsActive bool       `json:"is_active"`
+	Timezone string     `json:"timezone,omitempty"`
+	Region   string     `json:"emission_region,omitempty"`
+	Currency string     `json:"currency,omitempty"`
+	Segment  string     `json:"industry_segment,omitempty"`
+}
+
+type BackupSector struct {
+	ID          uuid.UUID `json:"id"`
+	Name        string    `json:"name"`
+	Description *string   `json:"description"`
+}
+
+type BackupAsset struct {
+	ID                uuid.UUID       `json:"id"`
+	GroupID           *uuid.UUID      `json:"group_id"`
+	SourceTagID       string          `json:"source_tag_id"`
+	DisplayName       string          `json:"display_name"`
+	Description       *string         `json:"description"`
+	Annotations       json.RawMessage `json:"annotations,omitempty"`
+	ExpectedIntervalS *int64          `json:"expected_interval_s"`
+}
+
+type BackupTagMapping struct {
+	ID          uuid.UUID `json:"id"`
+	AssetID     uuid.UUID `json:"asset_id"`
+	TagOK       *string   `json:"tag_ok"`
+	TagNOK      *string   `json:"tag_nok"`
+	TagStatus   *string   `json:"tag_status"`
+	ReadingRule string    `json:"reading_rule"`
+	IdealCycleS *float64  `json:"ideal_cycle_s,omitempty"`
+	TagEnergy   *string   `json:"tag_energy,omitempty"`
+	TagOrder    *string   `json:"tag_order,omitempty"`
+	TagAlarm    *string   `json:"tag_alarm,omitempty"`
+	TagCycle    *string   `json:"tag_cycle,omitempty"`
+	CyclePieces int       `json:"cycle_pieces,omitempty"`
+}
+
+type BackupCounterConfig struct {
+	AssetID        uuid.UUID `json:"asset_id"`
+	MetricKey      string    `json:"metric_key"`
+	RolloverAt     *float64  `json:"rollover_at,omitempty"`
+	ResetTolerance float64   `json:"reset_tolerance"`
+}
+
+type BackupEnergyMeter struct {
+	ID        uuid.UUID  `json:"id"`
+	AssetID   uuid.UUID  `json:"asset_id"`
+	MetricKey string     `json:"metric_key"`
+	SectorID  *uuid.UUID `json:"sector_id"`
+	Name      string     `json:"name"`
+	Active    bool       `json:"active"`
+}
+
+// BackupEnergyTariff leva os postos junto (energy_tariff_periods não tem registro próprio).
+type BackupEnergyTariff struct {
+	ID                 uuid.UUID            `json:"id"`
+	Name               string               `json:"name"`
+	ValidFrom          string               `json:"valid_from"`
+	RateKwh            float64              `json:"rate_kwh"`
+	DemandRateKw       float64              `json:"demand_rate_kw"`
+	ContractedDemandKw *float64             `json:"contracted_demand_kw,omitempty"`
+	Periods            []EnergyTariffPeriod `json:"periods"`
+}
+
+type BackupEmissionFactor struct {
+	ID           uuid.UUID `json:"id"`
+	Region       string    `json:"region"`
+	ValidFrom    string    `json:"valid_from"`
+	ValidTo      *string   `json:"valid_to,omitempty"`
+	KgCO2ePerKWh float64   `json:"kg_co2e_per_kwh"`
+	Source       string    `json:"source,omitempty"`
+}
+
+type BackupBusinessConfig struct {
+	ID            uuid.UUID  `json:"id"`
+	SectorID      *uuid.UUID `json:"sector_id"`
+	ValorVendaOK  float64    `json:"valor_venda_ok"`
+	CustoRefugoUn float64    `json:"custo_refugo_un"`
+	CustoParadaH  float64    `json:"custo_parada_h"`
+	CustoKwh      float64    `json:"custo_kwh"`
+	// Ausentes em backups anteriores ao modelo de custos: restauram como 0.
+	CustoMaterialUn   float64 `json:"custo_material_un"`
+	CustoMaoObraTurno float64 `json:"custo_mao_obra_turno"`
+}
+
+type BackupCostParameter struct {
+	ID                uuid.UUID  `json:"id"`
+	SectorID          *uuid.UUID `json:"sector_id,omitempty"`
+	AssetID           *uuid.UUID `json:"asset_id,omitempty"`
+	Product           string     `json:"product,omitempty"`
+	ValidFrom         string     `json:"valid_from"`
+	Currency          string     `json:"currency,omitempty"`
+	ValorVendaOk      *float64   `json:"valor_venda_ok"`
+	CustoRefugoUn     *float64   `json:"custo_refugo_un"`
+	CustoParadaH      *float64   `json:"custo_parada_h"`
+	CustoMaterialUn   *float64   `json:"custo_material_un"`
+	CustoMaoObraTurno *float64   `json:"custo_mao_obra_turno"`
+	Notes             string     `json:"notes,omitempty"`
+}
+
+type BackupExchangeRate struct {
+	ID        uuid.UUID `json:"id"`
+	Currency  string    `json:"currency"`
+	ValidFrom string    `json:"valid_from"`
+	Rate      float64   `json:"rate"`
+}
+
+type BackupAlertRule struct {
+	ID            uuid.UUID  `json:"id"`
+	ScopeType     string     `json:"scope_type"`
+	ScopeID       *uuid.UUID `json:"scope_id"`
+	ConditionType string     `json:"condition_type"`
+	Threshold     *float64   `json:"threshold"`
+	Channel       *string    `json:"channel"`
+}
+
+type BackupPlannedDowntime struct {
+	ID       uuid.UUID  `json:"id"`
+	SectorID *uuid.UUID `json:"sector_id"`
+	AssetID  *uuid.UUID `json:"asset_id"`
+	StartsAt time.Time  `json:"starts_at"`
+	EndsAt   time.Time  `json:"ends_at"`
+	Reason   *string    `json:"reason"`
+}
+
+type BackupShift struct {
+	ID        uuid.UUID  `json:"id"`
+	SectorID  *uuid.UUID `json:"sector_id"`
+	Name      string     `json:"name"`
+	StartTime string     `json:"start_time"`
+	EndTime   string     `json:"end_time"`
+	Weekdays  []int      `json:"weekdays"`
+	Active    bool       `json:"active"`
+}
+
+type BackupCalendarException struct {
+	ID       uuid.UUID  `json:"id"`
+	SectorID *uuid.UUID `json:"sector_id"`
+	Kind     string     `json:"kind"`
+	StartsAt time.Time  `json:"starts_at"`
+	EndsAt   time.Time  `json:"ends_at"`
+	Name     string     `json:"name,omitempty"`
+}
+
+type BackupProductionTarget struct {
+	ID        uuid.UUID  `json:"id"`
+	SectorID  *uuid.UUID `json:"sector_id"`
+	AssetID   *uuid.UUID `json:"asset_id"`
+	Period    string     `json:"period"`
+	ShiftID   *uuid.UUID `json:"shift_id"`
+	Metric    string     `json:"metric"`
+	Target    float64    `json:"target"`
+	ValidFrom string     `json:"valid_from"`
+	ValidTo   string     `json:"valid_to,omitempty"`
+	Notes     string     `json:"notes,omitempty"`
+}
+
+type BackupForecastSeries struct {
+	ID          uuid.UUID `json:"id"`
+	AssetID     uuid.UUID `json:"asset_id"`
+	MetricKey   string    `json:"metric_key"`
+	Granularity string    `json:"granularity"`
+	Horizon     int       `json:"horizon"`
+	Active      bool      `json:"active"`
+}
+
+type BackupHealthModel struct {
+	Version              int     `json:"version"`
+	WAnomalies           float64 `json:"w_anomalies"`
+	WTrend               float64 `json:"w_trend"`
+	WStops               float64 `json:"w_stops"`
+	WRunHours            float64 `json:"w_run_hours"`
+	AnomalyFullPerDay    float64 `json:"anomaly_full_per_day"`
+	TrendFullZ           float64 `json:"trend_full_z"`
+	StopsFullPerDay      float64 `json:"stops_full_per_day"`
+	MaintenanceIntervalH float64 `json:"maintenance_interval_h"`
+	Notes                string  `json:"notes,omitempty"`
+}
+
+type BackupHealthTag struct {
+	ID        uuid.UUID  `json:"id"`
+	AssetID   *uuid.UUID `json:"asset_id"`
+	MetricKey string     `json:"metric_key"`
+	Direction string     `json:"direction"`
+}
+
+type BackupMaintenanceEvent struct {
+	ID            uuid.UUID `json:"id"`
+	AssetID       uuid.UUID `json:"asset_id"`
+	PerformedAt   time.Time `json:"performed_at"`
+	Kind          string    `json:"kind"`
+	Description   string    `json:"description,omitempty"`
+	NextIntervalH *float64  `json:"next_interval_h,omitempty"`
+}
+
+type BackupDowntimeReason struct {
+	ID        uuid.UUID  `json:"id"`
+	ParentID  *uuid.UUID `json:"parent_id"`
+	Code      string     `json:"code"`
+	Name      string     `json:"name"`
+	Active    bool       `json:"active"`
+	IsFailure bool       `json:"is_failure,omitempty"`
+}
+
+type BackupDowntimeEvent struct {
+	ID           uuid.UUID  `json:"id"`
+	AssetID      uuid.UUID  `json:"asset_id"`
+	StartedAt    time.Time  `json:"started_at"`
+	EndedAt      *time.Time `json:"ended_at"`
+	DurationS    *float64   `json:"duration_s"`
+	ReasonID     *uuid.UUID `json:"reason_id"`
+	Comment      *string    `json:"comment"`
+	ClassifiedAt *time.Time `json:"classified_at"`
+}
+
+type BackupProductionOrder struct {
+	ID           uuid.UUID  `json:"id"`
+	SectorID     *uuid.UUID `json:"sector_id"`
+	AssetID      *uuid.UUID `json:"asset_id"`
+	OrderCode    string     `json:"order_code"`
+	Product      string     `json:"product,omitempty"`
+	TargetQty    *float64   `json:"target_qty"`
+	ValorVendaOk *float64   `json:"valor_venda_ok"`
+	StartedAt    *time.Time `json:"started_at"`
+	EndedAt      *time.Time `json:"ended_at"`
+	Source       string     `json:"source"`
+}
+
+type BackupDefectType struct {
+	ID     uuid.UUID `json:"id"`
+	Code   string    `json:"code"`
+	Name   string    `json:"name"`
+	Active bool      `json:"active"`
+}
+
+type BackupInspection struct {
+	ID            uuid.UUID  `json:"id"`
+	AssetID       uuid.UUID  `json:"asset_id"`
+	OrderID       *uuid.UUID `json:"order_id"`
+	DefectTypeID  uuid.UUID  `json:"defect_type_id"`
+	Quantity      float64    `json:"quantity"`
+	InspectedAt   time.Time  `json:"inspected_at"`
+	ProducedStart *time.Time `json:"produced_start,omitempty"`
+	ProducedEnd   *time.Time `json:"produced_end,omitempty"`
+	Inspector     string     `json:"inspector,omitempty"`
+	Notes         string     `json:"notes,omitempty"`
+}
+
+type BackupInspectionAttachment struct {
+	ID           uuid.UUID `json:"id"`
+	InspectionID uuid.UUID `json:"inspection_id"`
+	FileName     string    `json:"file_name"`
+	ContentType  string    `json:"content_type,omitempty"`
+	SizeBytes    *int64    `json:"size_bytes,omitempty"`
+	StorageURL   string    `json:"storage_url"`
+}
+
+type BackupAnnotation struct {
+	ID         uuid.UUID  `json:"id"`
+	SectorID   *uuid.UUID `json:"sector_id"`
+	AssetID    *uuid.UUID `json:"asset_id"`
+	StartsAt   time.Time  `json:"starts_at"`
+	EndsAt     *time.Time `json:"ends_at,omitempty"`
+	Category   string     `json:"category"`
+	Text       string     `json:"text"`
+	AuthorName string     `json:"author_name,omitempty"`
+}
+
+type BackupVirtualMetric struct {
+	ID          uuid.UUID  `json:"id"`
+	SectorID    *uuid.UUID `json:"sector_id"`
+	AssetID     *uuid.UUID `json:"asset_id"`
+	MetricKey   string     `json:"metric_key"`
+	Expression  string     `json:"expression"`
+	Unit        string     `json:"unit,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Mode        string     `json:"mode"`
+	Active      bool       `json:"active"`
+}
+
+type BackupMetricCatalog struct {
+	AssetID         uuid.UUID  `json:"asset_id"`
+	MetricKey       string     `json:"metric_key"`
+	FirstSeen       time.Time  `json:"first_seen"`
+	LastSeen        time.Time  `json:"last_seen"`
+	VirtualMetricID *uuid.UUID `json:"virtual_metric_id,omitempty"`
+}
+
+type BackupTelemetry struct {
+	Ts            time.Time       `json:"ts"`
+	AssetID       uuid.UUID       `json:"asset_id"`
+	MetricKey     string          `json:"metric_key"`
+	MetricValue   float64         `json:"metric_value"`
+	Status        string          `json:"status,omitempty"`
+	Raw           json.RawMessage `json:"raw,omitempty"`
+	CorrelationID string          `json:"correlation_id,omitempty"`
+}
+
+// backupEnd é a última linha; Counts permite ao restore detectar truncamento.
+type backupEnd struct {
+	Counts map[string]int64 `json:"counts"`
+}
+
+type backupRecord struct {
+	T string          `json:"t"`
+	D json.RawMessage `json:"d"`
+}
+
+// FactoryBackupSummary resume o que foi gravado.
+type FactoryBackupSummary struct {
+	FactoryID uuid.UUID        `json:"factory_id"`
+	Counts    map[string]int64 `json:"counts"`
+}
+
+type backupEncoder struct {
+	enc    *json.Encoder
+	counts map[string]int64
+}
+
+func (e *backupEncoder) put(t string, v interface{}) error {
+	d, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	if err := e.enc.Encode(backupRecord{T: t, D: d}); err != nil {
+		return err
+	}
+	e.counts[t]++
+	return nil
+}
+
+// WriteFactoryBackup grava o backup da fábrica em w (gzip + JSON Lines).
+// Com includeTelemetry, inclui os arquivos frios (storage) e o telemetry_log.
+func WriteFactoryBackup(ctx context.Context, db *sql.DB, storage ArchiveStorage, factoryID uuid.UUID, includeTelemetry bool, w io.Writer) (*FactoryBackupSummary, error) {
+	var f BackupFactory
+	var userID uuid.NullUUID
+	var isActive sql.NullBool
+	err := db.QueryRowContext(ctx,
+		`SELECT id, user_id, name, is_active, timezone, emission_region, currency, COALESCE(industry_segment, '')
+		 FROM nxd.factories WHERE id = $1`, factoryID,
+	).Scan(&f.ID, &userID, &f.Name, &isActive, &f.Timezone, &f.Region, &f.Currency, &f.Segment)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("fábrica %s não encontrada", factoryID)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if userID.Valid {
+		f.UserID = &userID.UUID
+	}
+	f.IsActive = !isActive.Valid || isActive.Bool
+
+	gz := gzip.NewWriter(w)
+	e := &backupEncoder{enc: json.NewEncoder(gz), counts: map[string]int64{}}
+	hdr := BackupHeader{
+		Format:           FactoryBackupFormat,
+		SourceFactoryID:  factoryID,
+		FactoryName:      f.Name,
+		IncludeTelemetry: includeTelemetry,
+		CreatedAt:        time.Now().UTC(),
+	}
+	if err := e.put("header", hdr); err != nil {
+		return nil, err
+	}
+	delete(e.counts, "header")
+
+	if f.UserID != nil {
+		var u BackupUser
+		err := db.QueryRowContext(ctx,
+			`SELECT id, name, email FROM nxd.users WHERE id = $1`, *f.UserID,
+		).Scan(&u.ID, &u.Name, &u.Email)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("usuário: %w", err)
+		}
+		if err == nil {
+			if accounts := getLoginAccounts(); accounts != nil {
+				if u.Login, err = accounts.GetLogin(ctx, u.Email); err != nil {
+					return nil, fmt.Errorf("conta de login: %w", err)
+				}
+			}
+			if err := e.put("user", u); err != nil {
+				return nil, err
+			}
+		} else {
+			f.UserID = nil
+		}
+	}
+	if err := e.put("factory", f); err != nil {
+		return nil, err
+	}
+	if err := writeBackupRows(ctx, db, e, factoryID); err != nil {
+		return nil, err
+	}
+	if includeTelemetry {
+		if err := writeBackupTelemetry(ctx, db, storage, e, factoryID); err != nil {
+			return nil, fmt.Errorf("telemetria: %w", err)
+		}
+	}
+
+	counts := make(map[string]int64, len(e.counts))
+	for k, v := range e.counts {
+		counts[k] = v
+	}
+	if err := e.put("end", backupEnd{Counts: counts}); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return &FactoryBackupSummary{FactoryID: factoryID, Counts: counts}, nil
+}
+
+// writeBackupRows grava setores, ativos, mapeamentos, configs, regras, paradas e catálogo.
+func writeBackupRows(ctx context.Context, db *sql.DB, e *backupEncoder, factoryID uuid.UUID) error {
+	rows, err := db.QueryContext(ctx,
+		`SELECT id, name, description FROM nxd.sectors WHERE factory_id = $1 ORDER BY created_at, id`, factoryID)
+	if err != nil {
+		return fmt.Errorf("setores: %w", err)
+	}
+	for rows.Next() {
+		var s BackupSector
+		var desc sql.NullString
+		if err := rows.Scan(&s.ID, &s.Name, &desc); err != nil {
+			rows.Close()
+			return err
+		}
+		s.Description = nullStringPtr(desc)
+		if err := e.put("sector", s); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT id, group_id, source_tag_id, display_name, description, annotations::text, expected_interval_s
+		FROM nxd.assets WHERE factory_id = $1 ORDER BY created_at, id`, factoryID)
+	if err != nil {
+		return fmt.Errorf("ativos: %w", err)
+	}
+	for rows.Next() {
+		var a BackupAsset
+		var groupID uuid.NullUUID
+		var desc, ann sql.NullString
+		var interval sql.NullInt64
+		if err := rows.Scan(&a.ID, &groupID, &a.SourceTagID, &a.DisplayName, &desc, &ann, &interval); err != nil {
+			rows.Close()
+			return err
+		}
+		if groupID.Valid {
+			a.GroupID = &groupID.UUID
+		}
+		a.Description = nullStringPtr(desc)
+		if ann.Valid && json.Valid([]byte(ann.String)) {
+			a.Annotations = json.RawMessage(ann.String)
+		}
+		if interval.Valid {
+			a.ExpectedIntervalS = &interval.Int64
+		}
+		if err := e.put("asset", a); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT m.id, m.asset_id, m.tag_ok, m.tag_nok, m.tag_status, m.reading_rule, m.ideal_cycle_s, m.tag_energy, m.tag_order, m.tag_alarm,
+			m.tag_cycle, m.cycle_pieces
+		FROM nxd.tag_mapping m
+		JOIN nxd.assets a ON a.id = m.asset_id
+		WHERE a.factory_id = $1 ORDER BY m.created_at, m.id`, factoryID)
+	if err != nil {
+		return fmt.Errorf("tag_mapping: %w", err)
+	}
+	for rows.Next() {
+		var m BackupTagMapping
+		var ok, nok, st, energy, order, alarm, cycle sql.NullString
+		var ideal sql.NullFloat64
+		if err := rows.Scan(&m.ID, &m.AssetID, &ok, &nok, &st, &m.ReadingRule, &ideal, &energy, &order, &alarm,
+			&cycle, &m.CyclePieces); err != nil {
+			rows.Close()
+			return err
+		}
+		m.TagOK, m.TagNOK, m.TagStatus = nullStringPtr(ok), nullStringPtr(nok), nullStringPtr(st)
+		m.TagEnergy, m.TagOrder, m.TagAlarm = nullStringPtr(energy), nullStringPtr(order), nullStringPtr(alarm)
+		m.TagCycle = nullStringPtr(cycle)
+		if ideal.Valid {
+			m.IdealCycleS = &ideal.Float64
+		}
+		if err := e.put("tag_mapping", m); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	counters, err := ListCounterConfigs(db, factoryID)
+	if err != nil {
+		return fmt.Errorf("counter_config: %w", err)
+	}
+	for _, c := range counters {
+		if err := e.put("counter_config", BackupCounterConfig{AssetID: c.AssetID, MetricKey: c.MetricKey,
+			RolloverAt: c.RolloverAt, ResetTolerance: c.ResetTolerance}); err != nil {
+			return err
+		}
+	}
+
+	meters, err := ListEnergyMeters(db, factoryID)
+	if err != nil {
+		return fmt.Errorf("energy_meters: %w", err)
+	}
+	for _, m := range meters {
+		if err := e.put("energy_meter", BackupEnergyMeter{ID: m.ID, AssetID: m.AssetID, MetricKey: m.MetricKey,
+			SectorID: m.SectorID, Name: m.Name, Active: m.Active}); err != nil {
+			return err
+		}
+	}
+	tariffs, err := ListEnergyTariffs(db, factoryID)
+	if err != nil {
+		return fmt.Errorf("energy_tariffs: %w", err)
+	}
+	for _, t := range tariffs {
+		if err := e.put("energy_tariff", BackupEnergyTariff{ID: t.ID, Name: t.Name, ValidFrom: t.ValidFrom, RateKwh: t.RateKwh,
+			DemandRateKw: t.DemandRateKw, ContractedDemandKw: t.ContractedDemandKw, Periods: t.Periods}); err != nil {
+			return err
+		}
+	}
+	factors, err := ListEmissionFactors(db, factoryID, "")
+	if err != nil {
+		return fmt.Errorf("emission_factors: %w", err)
+	}
+	for _, ef := range factors {
+		if err := e.put("emission_factor", BackupEmissionFactor{ID: ef.ID, Region: ef.Region, ValidFrom: ef.ValidFrom,
+			ValidTo: ef.ValidTo, KgCO2ePerKWh: ef.KgCO2ePerKWh, Source: ef.Source}); err != nil {
+			return err
+		}
+	}
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT id, sector_id, valor_venda_ok, custo_refugo_un, custo_parada_h, custo_kwh, custo_material_un, custo_mao_obra_turno
+		FROM nxd.business_config WHERE factory_id = $1 ORDER BY created_at, id`, factoryID)
+	if err != nil {
+		return fmt.Errorf("business_config: %w", err)
+	}
+	for rows.Next() {
+		var c BackupBusinessConfig
+		var sectorID uuid.NullUUID
+		if err := rows.Scan(&c.ID, &sectorID, &c.ValorVendaOK, &c.CustoRefugoUn, &c.CustoParadaH, &c.CustoKwh, &c.CustoMaterialUn, &c.CustoMaoObraTurno); err != nil {
+			rows.Close()
+			return err
+		}
+		if sectorID.Valid {
+			c.SectorID = &sectorID.UUID
+		}
+		if err := e.put("business_config", c); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	params, err := ListCostParameters(db, factoryID)
+	if err != nil {
+		return fmt.Errorf("cost_parameters: %w", err)
+	}
+	for _, p := range params {
+		if err := e.put("cost_parameter", BackupCostParameter{ID: p.ID, SectorID: p.SectorID, AssetID: p.AssetID, Product: p.Product,
+			ValidFrom: p.ValidFrom, Currency: p.Currency, ValorVendaOk: p.ValorVendaOk, CustoRefugoUn: p.CustoRefugoUn,
+			CustoParadaH: p.CustoParadaH, CustoMaterialUn: p.CustoMaterialUn, CustoMaoObraTurno: p.CustoMaoObraTurno, Notes: p.Notes}); err != nil {
+			return err
+		}
+	}
+	rates, err := ListExchangeRates(db, factoryID)
+	if err != nil {
+		return fmt.Errorf("exchange_rates: %w", err)
+	}
+	for _, x := range rates {
+		if err := e.put("exchange_rate", BackupExchangeRate{ID: x.ID, Currency: x.Currency, ValidFrom: x.ValidFrom, Rate: x.Rate}); err != nil {
+			return err
+		}
+	}
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT id, sector_id, asset_id, starts_at, ends_at, reason
+		FROM nxd.planned_downtime WHERE factory_id = $1 ORDER BY starts_at, id`, factoryID)
+	if err != nil {
+		return fmt.Errorf("planned_downtime: %w", err)
+	}
+	for rows.Next() {
+		var d BackupPlannedDowntime
+		var sectorID, assetID uuid.NullUUID
+		var reason sql.NullString
+		if err := rows.Scan(&d.ID, &sectorID, &assetID, &d.StartsAt, &d.EndsAt, &reason); err != nil {
+			rows.Close()
+			return err
+		}
+		if sectorID.Valid {
+			d.SectorID = &sectorID.UUID
+		}
+		if assetID.Valid {
+			d.AssetID = &assetID.UUID
+		}
+		d.Reason = nullStringPtr(reason)
+		if err := e.put("planned_downtime", d); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	shifts, err := ListShifts(db, factoryID)
+	if err != nil {
+		return fmt.Errorf("shifts: %w", err)
+	}
+	for _, sh := range shifts {
+		if err := e.put("shift", BackupShift{ID: sh.ID, SectorID: sh.SectorID, Name: sh.Name, StartTime: sh.StartTime,
+			EndTime: sh.EndTime, Weekdays: sh.Weekdays, Active: sh.Active}); err != nil {
+			return err
+		}
+	}
+
+	exceptions, err := ListCalendarExceptions(db, factoryID, time.Unix(0, 0), time.Date(9999, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		return fmt.Errorf("calendar_exceptions: %w", err)
+	}
+	for _, ex := range exceptions {
+		if err := e.put("calendar_exception", BackupCalendarException{ID: ex.ID, SectorID: ex.SectorID, Kind: ex.Kind,
+			StartsAt: ex.StartsAt, EndsAt: ex.EndsAt, Name: ex.Name}); err != nil {
+			return err
+		}
+	}
+
+	targets, err := ListProductionTargets(db, factoryID)
+	if err != nil {
+		return fmt.Errorf("production_targets: %w", err)
+	}
+	for _, t := range targets {
+		if err := e.put("production_target", BackupProductionTarget{ID: t.ID, SectorID: t.SectorID, AssetID: t.AssetID,
+			Period: t.Period, ShiftID: t.ShiftID, Metric: t.Metric, Target: t.Target, ValidFrom: t.ValidFrom,
+			ValidTo: t.ValidTo, Notes: t.Notes}); err != nil {
+			return err
+		}
+	}
+
+	series, err := ListForecastSeries(db, factoryID)
+	if err != nil {
+		return fmt.Errorf("forecast_series: %w", err)
+	}
+	for _, fs := range series {
+		if err := e.put("forecast_series", BackupForecastSeries{ID: fs.ID, AssetID: fs.AssetID, MetricKey: fs.MetricKey,
+			Granularity: fs.Granularity, Horizon: fs.Horizon, Active: fs.Active}); err != nil {
+			return err
+		}
+	}
+
+	models, err := ListHealthModels(db, factoryID)
+	if err != nil {
+		return fmt.Errorf("health_models: %w", err)
+	}
+	for i := len(models) - 1; i >= 0; i-- {
+		m := models[i]
+		if err := e.put("health_model", BackupHealthModel{Version: m.Version, WAnomalies: m.WAnomalies, WTrend: m.WTrend,
+			WStops: m.WStops, WRunHours: m.WRunHours, AnomalyFullPerDay: m.AnomalyFullPerDay, TrendFullZ: m.TrendFullZ,
+			StopsFullPerDay: m.StopsFullPerDay, MaintenanceIntervalH: m.MaintenanceIntervalH, Notes: m.Notes}); err != nil {
+			return err
+		}
+	}
+	healthTags, err := ListHealthTags(db, factoryID)
+	if err != nil {
+		return fmt.Errorf("health_tags: %w", err)
+	}
+	for _, t := range healthTags {
+		if err := e.put("health_tag", BackupHealthTag{ID: t.ID, AssetID: t.AssetID, MetricKey: t.MetricKey, Direction: t.Direction}); err != nil {
+			return err
+		}
+	}
+	// created_by (usuário legado) não é copiado, como classified_by das paradas.
+	rows, err = db.QueryContext(ctx, `
+		SELECT id, asset_id, performed_at, kind, COALESCE(description, ''), next_interval_h
+		FROM nxd.maintenance_events WHERE factory_id = $1 ORDER BY performed_at, id`, factoryID)
+	if err != nil {
+		return fmt.Errorf("maintenance_events: %w", err)
+	}
+	for rows.Next() {
+		var m BackupMaintenanceEvent
+		var interval sql.NullFloat64
+		if err := rows.Scan(&m.ID, &m.AssetID, &m.PerformedAt, &m.Kind, &m.Description, &interval); err != nil {
+			rows.Close()
+			return err
+		}
+		if interval.Valid {
+			m.NextIntervalH = &interval.Float64
+		}
+		if err := e.put("maintenance_event", m); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Regras depois de setores, ativos e metas: scope_id é remapeado no clone.
+	rows, err = db.QueryContext(ctx, `
+		SELECT id, scope_type, scope_id, condition_type, threshold, channel
+		FROM nxd.alert_rules WHERE factory_id = $1 ORDER BY created_at, id`, factoryID)
+	if err != nil {
+		return fmt.Errorf("alert_rules: %w", err)
+	}
+	for rows.Next() {
+		var r BackupAlertRule
+		var scopeID uuid.NullUUID
+		var threshold sql.NullFloat64
+		var channel sql.NullString
+		if err := rows.Scan(&r.ID, &r.ScopeType, &scopeID, &r.ConditionType, &threshold, &channel); err != nil {
+			rows.Close()
+			return err
+		}
+		if scopeID.Valid {
+			r.ScopeID = &scopeID.UUID
+		}
+		if threshold.Valid {
+			r.Threshold = &threshold.Float64
+		}
+		r.Channel = nullStringPtr(channel)
+		if err := e.put("alert_rule", r); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	// Motivos em ordem topológica: o restore resolve parent_id pelo mapa de IDs.
+	reasons, err := ListDowntimeReasons(db, factoryID, true)
+	if err != nil {
+		return fmt.Errorf("downtime_reasons: %w", err)
+	}
+	for _, r := range reasons {
+		if err := e.put("downtime_reason", BackupDowntimeReason{ID: r.ID, ParentID: r.ParentID, Code: r.Code, Name: r.Name, Active: r.Active, IsFailure: r.IsFailure}); err != nil {
+			return err
+		}
+	}
+
+	// classified_by (usuário legado) não é copiado: não existe no ambiente de destino.
+	rows, err = db.QueryContext(ctx, `
+		SELECT id, asset_id, started_at, ended_at, duration_s, reason_id, comment, classified_at
+		FROM nxd.downtime_events WHERE factory_id = $1 ORDER BY started_at, id`, factoryID)
+	if err != nil {
+		return fmt.Errorf("downtime_events: %w", err)
+	}
+	for rows.Next() {
+		var d BackupDowntimeEvent
+		var endedAt, classifiedAt sql.NullTime
+		var duration sql.NullFloat64
+		var reasonID uuid.NullUUID
+		var comment sql.NullString
+		if err := rows.Scan(&d.ID, &d.AssetID, &d.StartedAt, &endedAt, &duration, &reasonID, &comment, &classifiedAt); err != nil {
+			rows.Close()
+			return err
+		}
+		if endedAt.Valid {
+			d.EndedAt = &endedAt.Time
+		}
+		if duration.Valid {
+			d.DurationS = &duration.Float64
+		}
+		if reasonID.Valid {
+			d.ReasonID = &reasonID.UUID
+		}
+		if classifiedAt.Valid {
+			d.ClassifiedAt = &classifiedAt.Time
+		}
+		d.Comment = nullStringPtr(comment)
+		if err := e.put("downtime_event", d); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	orders, err := ListProductionOrders(db, ProductionOrderQuery{FactoryID: factoryID})
+	if err != nil {
+		return fmt.Errorf("production_orders: %w", err)
+	}
+	for _, o := range orders {
+		if err := e.put("production_order", BackupProductionOrder{ID: o.ID, SectorID: o.SectorID, AssetID: o.AssetID,
+			OrderCode: o.OrderCode, Product: o.Product, TargetQty: o.TargetQty, ValorVendaOk: o.ValorVendaOk,
+			StartedAt: o.StartedAt, EndedAt: o.EndedAt, Source: o.Source}); err != nil {
+			return err
+		}
+	}
+
+	defectTypes, err := ListDefectTypes(db, factoryID, true)
+	if err != nil {
+		return fmt.Errorf("defect_types: %w", err)
+	}
+	for _, d := range defectTypes {
+		if err := e.put("defect_type", BackupDefectType{ID: d.ID, Code: d.Code, Name: d.Name, Active: d.Active}); err != nil {
+			return err
+		}
+	}
+	// Inspeções depois de ativos, ordens e tipos de defeito; created_by não é copiado.
+	rows, err = db.QueryContext(ctx, `
+		SELECT id, asset_id, order_id, defect_type_id, quantity, inspected_at, produced_start, produced_end,
+			COALESCE(inspector, ''), COALESCE(notes, '')
+		FROM nxd.inspections WHERE factory_id = $1 ORDER BY inspected_at, id`, factoryID)
+	if err != nil {
+		return fmt.Errorf("inspections: %w", err)
+	}
+	for rows.Next() {
+		var in BackupInspection
+		var orderID uuid.NullUUID
+		var pStart, pEnd sql.NullTime
+		if err := rows.Scan(&in.ID, &in.AssetID, &orderID, &in.DefectTypeID, &in.Quantity, &in.InspectedAt,
+			&pStart, &pEnd, &in.Inspector, &in.Notes); err != nil {
+			rows.Close()
+			return err
+		}
+		if orderID.Valid {
+			in.OrderID = &orderID.UUID
+		}
+		in.ProducedStart, in.ProducedEnd = nullTimePtr(pStart), nullTimePtr(pEnd)
+		if err := e.put("inspection", in); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	rows, err = db.QueryContext(ctx, `
+		SELECT t.id, t.inspection_id, t.file_name, COALESCE(t.content_type, ''), t.size_bytes, t.storage_url
+		FROM nxd.inspection_attachments t
+		JOIN nxd.inspections i ON i.id = t.inspection_id
+		WHERE i.factory_id = $1 ORDER BY t.created_at, t.id`, factoryID)
+	if err != nil {
+		return fmt.Errorf("inspection_attachments: %w", err)
+	}
+	for rows.Next() {
+		var a BackupInspectionAttachment
+		var size sql.NullInt64
+		if err := rows.Scan(&a.ID, &a.InspectionID, &a.FileName, &a.ContentType, &size, &a.StorageURL); err != nil {
+			rows.Close()
+			return err
+		}
+		if size.Valid {
+			a.SizeBytes = &size.Int64
+		}
+		if err := e.put("inspection_attachment", a); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	// author_id (usuário legado) não é copiado; o nome gravado na anotação vai junto.
+	rows, err = db.QueryContext(ctx, `
+		SELECT id, sector_id, asset_id, starts_at, ends_at, category, text, COALESCE(author_name, '')
+		FROM nxd.annotations WHERE factory_id = $1 ORDER BY starts_at, id`, factoryID)
+	if err != nil {
+		return fmt.Errorf("annotations: %w", err)
+	}
+	for rows.Next() {
+		var n BackupAnnotation
+		var sectorID, assetID uuid.NullUUID
+		var endsAt sql.NullTime
+		if err := rows.Scan(&n.ID, &sectorID, &assetID, &n.StartsAt, &endsAt, &n.Category, &n.Text, &n.AuthorName); err != nil {
+			rows.Close()
+			return err
+		}
+		if sectorID.Valid {
+			n.SectorID = &sectorID.UUID
+		}
+		if assetID.Valid {
+			n.AssetID = &assetID.UUID
+		}
+		n.EndsAt = nullTimePtr(endsAt)
+		if err := e.put("annotation", n); err != nil {
+			rows.Close()
+			return err
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	virtuals, err := ListVirtualMetrics(db, factoryID)
+	if err != nil {
+		return fmt.Errorf("virtual_metrics: %w", err)
+	}
+	for _, v := range virtuals {
+		if err := e.put("virtual_metric", BackupVirtualMetric{ID: v.ID, SectorID: v.SectorID, AssetID: v.AssetID,
+			MetricKey: v.MetricKey, Expression: v.Expression, Unit: v.Unit, Description: v.Description,
+			Mode: v.Mode, Active: v.Active}); err != nil {
+			return err
+		}
+	}
+
+	rows, err = db.QueryContext(ctx, `
+		SELECT asset_id, metric_key, first_seen, last_seen, virtual_metric_id
+		FROM nxd.asset_metric_catalog WHERE factory_id = $1 ORDER BY asset_id, metric_key`, factoryID)
+	if err != nil {
+		return fmt.Errorf("asset_metric_catalog: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c BackupMetricCatalog
+		var first, last sql.NullTime
+		if err := rows.Scan(&c.AssetID, &c.MetricKey, &first, &last, &c.VirtualMetricID); err != nil {
+			return err
+		}
+		c.FirstSeen, c.LastSeen = first.Time, last.Time
+		if err := e.put("metric_catalog", c); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// writeBackupTelemetry grava os arquivos frios (manifesto 'done') e depois o
+// telemetry_log. Leituras sem ativo ou sem valor não são restauráveis e ficam de fora.
+func writeBackupTelemetry(ctx context.Context, db *sql.DB, storage ArchiveStorage, e *backupEncoder, factoryID uuid.UUID) error {
+	archives, err := ListTelemetryArchives(db, factoryID, time.Time{}, time.Time{}, true)
+	if err != nil {
+		return err
+	}
+	for _, a := range archives {
+		var putErr error
+		err := forEachArchiveRecord(ctx, storage, a.ObjectKey, func(rec []string) bool {
+			t, ok := backupTelemetryFromArchive(rec)
+			if !ok {
+				return true
+			}
+			putErr = e.put("telemetry", t)
+			return putErr == nil
+		})
+		if putErr != nil {
+			return putErr
+		}
+		if err != nil {
+			return fmt.Errorf("arquivo %s: %w", a.ObjectKey, err)
+		}
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT ts, asset_id, metric_key, metric_value, COALESCE(status, ''), raw::text, COALESCE(correlation_id, '')
+		FROM nxd.telemetry_log
+		WHERE factory_id = $1 AND asset_id IS NOT NULL AND metric_key IS NOT NULL AND metric_value IS NOT NULL
+		ORDER BY ts`, factoryID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t BackupTelemetry
+		var raw sql.NullString
+		if err := rows.Scan(&t.Ts, &t.AssetID, &t.MetricKey, &t.MetricValue, &t.Status, &raw, &t.CorrelationID); err != nil {
+			return err
+		}
+		if raw.Valid && raw.String != "null" && json.Valid([]byte(raw.String)) {
+			t.Raw = json.RawMessage(raw.String)
+		}
+		if err := e.put("telemetry", t); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// backupTelemetryFromArchive converte um registro CSV do arquivo (archiveCSVHeader).
+func backupTelemetryFromArchive(rec []string) (BackupTelemetry, bool) {
+	var t BackupTelemetry
+	ts, err := time.Parse(time.RFC3339Nano, rec[0])
+	if err != nil {
+		return t, false
+	}
+	assetID, err := uuid.Parse(rec[1])
+	if err != nil || rec[2] == "" {
+		return t, false
+	}
+	v, err := strconv.ParseFloat(rec[3], 64)
+	if err != nil {
+		return t, false
+	}
+	t = BackupTelemetry{Ts: ts, AssetID: assetID, MetricKey: rec[2], MetricValue: v, Status: rec[4], CorrelationID: rec[5]}
+	if rec[6] != "" && rec[6] != "null" && json.Valid([]byte(rec[6])) {
+		t.Raw = json.RawMessage(rec[6])
+	}
+	return t, true
+}
+
+func nullStringPtr(s sql.NullString) *string {
+	if !s.Valid {
+		return nil
+	}
+	return &s.String
+}
+
+// ─── Restore ─────────────────────────────────────────────────────────────────
+
+// RestoreOptions controla como o backup é aplicado.
+type RestoreOptions struct {
+	// Clone regera todos os UUIDs; sem ele os IDs originais são mantidos.
+	Clone bool
+	// FactoryName substitui o nome da fábrica (vazio = nome do backup).
+	FactoryName string
+	// OwnerEmail define o dono da fábrica restaurada (usuário NXD já existente).
+	// Vazio = dono do backup, casado por email ou criado.
+	OwnerEmail string
+	// SkipTelemetry ignora as leituras mesmo que o backup as contenha.
+	SkipTelemetry bool
+}
+
+// RestoreResult descreve a fábrica criada.
+type RestoreResult struct {
+	FactoryID       uuid.UUID            `json:"factory_id"`
+	SourceFactoryID uuid.UUID            `json:"source_factory_id"`
+	FactoryName     string               `json:"factory_name"`
+	OwnerUserID     *uuid.UUID           `json:"owner_user_id,omitempty"`
+	APIKey          string               `json:"api_key"`
+	Counts          map[string]int64     `json:"counts"`
+	IDMap           map[string]uuid.UUID `json:"id_map,omitempty"`
+	Warnings        []string             `json:"warnings,omitempty"`
+}
+
+// backupIDMap mapeia IDs do backup para IDs no destino.
+type backupIDMap struct {
+	clone bool
+	ids   map[uuid.UUID]uuid.UUID
+}
+
+// assign registra um ID novo (clone) ou o próprio ID (restore) para old.
+func (m *backupIDMap) assign(old uuid.UUID) uuid.UUID {
+	id := old
+	if m.clone {
+		id = uuid.New()
+	}
+	m.ids[old] = id
+	return id
+}
+
+// ref resolve uma referência a uma entidade já restaurada.
+func (m *backupIDMap) ref(kind string, old uuid.UUID) (uuid.UUID, error) {
+	id, ok := m.ids[old]
+	if !ok {
+		return uuid.Nil, fmt.Errorf("%s %s referenciado antes de ser definido no backup", kind, old)
+	}
+	return id, nil
+}
+
+func (m *backupIDMap) optRef(kind string, old *uuid.UUID) (*uuid.UUID, error) {
+	if old == nil {
+		return nil, nil
+	}
+	id, err := m.ref(kind, *old)
+	if err != nil {
+		return nil, err
+	}
+	return &id, nil
+}
+
+type restoreState struct {
+	opts      RestoreOptions
+	header    *BackupHeader
+	ids       backupIDMap
+	res       *RestoreResult
+	factoryID uuid.UUID
+	telemetry []BulkTelemetryRow
+	ended     bool
+	expected  map[string]int64
+	users     map[uuid.UUID]BackupUser // ID no backup → usuário
+	// login a criar antes do commit (dono do backup sem conta neste servidor).
+	loginEmail string
+	login      *BackupLogin
+}
+
+// RestoreFactoryBackup lê um backup (gzip + JSON Lines) e cria a fábrica em
+// uma única transação. A fábrica restaurada recebe uma API key nova.
+func RestoreFactoryBackup(ctx context.Context, db *sql.DB, r io.Reader, opts RestoreOptions) (*RestoreResult, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("backup inválido: %w", err)
+	}
+	defer gz.Close()
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	st := &restoreState{
+		opts:  opts,
+		ids:   backupIDMap{clone: opts.Clone, ids: map[uuid.UUID]uuid.UUID{}},
+		res:   &RestoreResult{Counts: map[string]int64{}},
+		users: map[uuid.UUID]BackupUser{},
+	}
+	dec := json.NewDecoder(gz)
+	for {
+		var rec backupRecord
+		if err := dec.Decode(&rec); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("backup inválido: %w", err)
+		}
+		if st.ended {
+			return nil, fmt.Errorf("backup inválido: registro %q após o fim", rec.T)
+		}
+		if err := st.apply(ctx, tx, rec); err != nil {
+			return nil, err
+		}
+	}
+	if !st.ended {
+		return nil, fmt.Errorf("backup incompleto (sem registro final) — arquivo truncado?")
+	}
+	if err := st.flushTelemetry(tx); err != nil {
+		return nil, err
+	}
+	for k, want := range st.expected {
+		if k == "telemetry" && opts.SkipTelemetry {
+			continue
+		}
+		if got := st.res.Counts[k]; got != want {
+			return nil, fmt.Errorf("backup inconsistente: %s = %d, esperado %d", k, got, want)
+		}
+	}
+
+	apiKey, hash, err := core.GenerateAndHashAPIKey()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := tx.ExecContext(ctx,
+		`UPDATE nxd.factories SET api_key = $1, api_key_hash = $2, api_key_prefix = $3, updated_at = NOW() WHERE id = $4`,
+		apiKey, hash, apiKey[:16], st.factoryID,
+	); err != nil {
+		return nil, err
+	}
+	// Conta de login antes do commit: se falhar, a fábrica não entra sem acesso.
+	if st.login != nil {
+		if err := getLoginAccounts().EnsureLogin(ctx, st.loginEmail, *st.login); err != nil {
+			return nil, fmt.Errorf("conta de login: %w", err)
+		}
+		st.res.Warnings = append(st.res.Warnings, fmt.Sprintf(
+			"conta de login %s criada como operador e com a senha bloqueada: um admin precisa definir a senha (e o perfil)", st.loginEmail))
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	st.res.APIKey = apiKey
+	if opts.Clone {
+		st.res.IDMap = make(map[string]uuid.UUID, len(st.ids.ids))
+		for k, v := range st.ids.ids {
+			st.res.IDMap[k.String()] = v
+		}
+	}
+	return st.res, nil
+}
+
+func (st *restoreState) apply(ctx context.Context, tx *sql.Tx, rec backupRecord) error {
+	if st.header == nil && rec.T != "header" {
+		return fmt.Errorf("backup inválido: cabeçalho ausente")
+	}
+	if rec.T != "header" && rec.T != "user" && rec.T != "factory" && rec.T != "end" && st.factoryID == uuid.Nil {
+		return fmt.Errorf("backup inválido: %q antes da fábrica", rec.T)
+	}
+	var err error
+	switch rec.T {
+	case "header":
+		var h BackupHeader
+		if err = json.Unmarshal(rec.D, &h); err == nil {
+			if h.Format != FactoryBackupFormat {
+				return fmt.Errorf("formato de backup não suportado: %q", h.Format)
+			}
+			st.header = &h
+			st.res.SourceFactoryID = h.SourceFactoryID
+		}
+		return err
+	case "user":
+		var u BackupUser
+		if err = json.Unmarshal(rec.D, &u); err == nil {
+			err = st.restoreUser(ctx, tx, u)
+		}
+	case "factory":
+		var f BackupFactory
+		if err = json.Unmarshal(rec.D, &f); err == nil {
+			err = st.restoreFactory(ctx, tx, f)
+		}
+	case "sector":
+		var s BackupSector
+		if err = json.Unmarshal(rec.D, &s); err == nil {
+			_, err = tx.ExecContext(ctx,
+				`INSERT INTO nxd.sectors (id, factory_id, name, description) VALUES ($1, $2, $3, $4)`,
+				st.ids.assign(s.ID), st.factoryID, s.Name, s.Description)
+		}
+	case "asset":
+		var a BackupAsset
+		if err = json.Unmarshal(rec.D, &a); err == nil {
+			var groupID *uuid.UUID
+			if groupID, err = st.ids.optRef("setor", a.GroupID); err != nil {
+				return err
+			}
+			var ann interface{}
+			if len(a.Annotations) > 0 && string(a.Annotations) != "null" {
+				ann = string(a.Annotations)
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO nxd.assets (id, factory_id, group_id, source_tag_id, display_name, description, annotations, expected_interval_s)
+				VALUES ($1, $2, $3, $4, $5, $6, $7::jsonb, $8)`,
+				st.ids.assign(a.ID), st.factoryID, groupID, a.SourceTagID, a.DisplayName, a.Description, ann, a.ExpectedIntervalS)
+		}
+	case "tag_mapping":
+		var m BackupTagMapping
+		if err = json.Unmarshal(rec.D, &m); err == nil {
+			var assetID uuid.UUID
+			if assetID, err = st.ids.ref("ativo", m.AssetID); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO nxd.tag_mapping (id, asset_id, tag_ok, tag_nok, tag_status, reading_rule, ideal_cycle_s, tag_energy, tag_order, tag_alarm,
+					tag_cycle, cycle_pieces)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, GREATEST($12, 1))`,
+				st.ids.assign(m.ID), assetID, m.TagOK, m.TagNOK, m.TagStatus, m.ReadingRule, m.IdealCycleS, m.TagEnergy, m.TagOrder, m.TagAlarm,
+				m.TagCycle, m.CyclePieces)
+		}
+	case "counter_config":
+		var c BackupCounterConfig
+		if err = json.Unmarshal(rec.D, &c); err == nil {
+			var assetID uuid.UUID
+			if assetID, err = st.ids.ref("ativo", c.AssetID); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO nxd.counter_config (asset_id, metric_key, factory_id, rollover_at, reset_tolerance)
+				VALUES ($1, $2, $3, $4, $5)`,
+				assetID, c.MetricKey, st.factoryID, c.RolloverAt, c.ResetTolerance)
+		}
+	case "energy_meter":
+		var m BackupEnergyMeter
+		if err = json.Unmarshal(rec.D, &m); err == nil {
+			var assetID uuid.UUID
+			var sectorID *uuid.UUID
+			if assetID, err = st.ids.ref("ativo", m.AssetID); err != nil {
+				return err
+			}
+			if sectorID, err = st.ids.optRef("setor", m.SectorID); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO nxd.energy_meters (id, factory_id, asset_id, metric_key, sector_id, name, active)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+				st.ids.assign(m.ID), st.factoryID, assetID, m.MetricKey, sectorID, m.Name, m.Active)
+		}
+	case "energy_tariff":
+		var t BackupEnergyTariff
+		if err = json.Unmarshal(rec.D, &t); err == nil {
+			tariffID := st.ids.assign(t.ID)
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO nxd.energy_tariffs (id, factory_id, name, valid_from, rate_kwh, demand_rate_kw, contracted_demand_kw)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+				tariffID, st.factoryID, t.Name, t.ValidFrom, t.RateKwh, t.DemandRateKw, t.ContractedDemandKw)
+			for _, p := range t.Periods {
+				if err != nil {
+					break
+				}
+				var mask int
+				if mask, err = weekdaysToMask(p.Weekdays); err != nil {
+					break
+				}
+				_, err = tx.ExecContext(ctx, `
+					INSERT INTO nxd.energy_tariff_periods (tariff_id, name, start_time, end_time, days_mask, rate_kwh)
+					VALUES ($1, $2, $3, $4, $5, $6)`,
+					tariffID, p.Name, p.StartTime, p.EndTime, mask, p.RateKwh)
+			}
+		}
+	case "emission_factor":
+		var ef BackupEmissionFactor
+		if err = json.Unmarshal(rec.D, &ef); err == nil {
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO nxd.emission_factors (id, factory_id, region, valid_from, valid_to, kg_co2e_per_kwh, source)
+				VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))`,
+				st.ids.assign(ef.ID), st.factoryID, ef.Region, ef.ValidFrom, ef.ValidTo, ef.KgCO2ePerKWh, ef.Source)
+		}
+	case "business_config":
+		var c BackupBusinessConfig
+		if err = json.Unmarshal(rec.D, &c); err == nil {
+			var sectorID *uuid.UUID
+			if sectorID, err = st.ids.optRef("setor", c.SectorID); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO nxd.business_config (id, factory_id, sector_id, valor_venda_ok, custo_refugo_un, custo_parada_h, custo_kwh,
+					custo_material_un, custo_mao_obra_turno)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+				st.ids.assign(c.ID), st.factoryID, sectorID, c.ValorVendaOK, c.CustoRefugoUn, c.CustoParadaH, c.CustoKwh,
+				c.CustoMaterialUn, c.CustoMaoObraTurno)
+		}
+	case "cost_parameter":
+		var p BackupCostParameter
+		if err = json.Unmarshal(rec.D, &p); err == nil {
+			var sectorID, assetID *uuid.UUID
+			if sectorID, err = st.ids.optRef("setor", p.SectorID); err != nil {
+				return err
+			}
+			if assetID, err = st.ids.optRef("ativo", p.AssetID); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO nxd.cost_parameters (id, factory_id, sector_id, asset_id, product, valid_from, currency,
+					valor_venda_ok, custo_refugo_un, custo_parada_h, custo_material_un, custo_mao_obra_turno, notes)
+				VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, NULLIF($7, ''), $8, $9, $10, $11, $12, NULLIF($13, ''))`,
+				st.ids.assign(p.ID), st.factoryID, sectorID, assetID, p.Product, p.ValidFrom, p.Currency,
+				p.ValorVendaOk, p.CustoRefugoUn, p.CustoParadaH, p.CustoMaterialUn, p.CustoMaoObraTurno, p.Notes)
+		}
+	case "exchange_rate":
+		var x BackupExchangeRate
+		if err = json.Unmarshal(rec.D, &x); err == nil {
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO nxd.exchange_rates (id, factory_id, currency, valid_from, rate)
+				VALUES ($1, $2, $3, $4, $5)`,
+				st.ids.assign(x.ID), st.factoryID, x.Currency, x.ValidFrom, x.Rate)
+		}
+	case "alert_rule":
+		var r BackupAlertRule
+		if err = json.Unmarshal(rec.D, &r); err == nil {
+			// scope_id pode apontar para a fábrica, um setor ou um ativo; IDs fora
+			// do backup (ex.: uuid.Nil de regras sem escopo) são mantidos.
+			scopeID := r.ScopeID
+			if scopeID != nil {
+				if id, ok := st.ids.ids[*scopeID]; ok {
+					scopeID = &id
+				} else if *scopeID != uuid.Nil {
+					st.res.Warnings = append(st.res.Warnings,
+						fmt.Sprintf("regra %s: escopo %s não está no backup; mantido sem remapear", r.ID, *scopeID))
+				}
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO nxd.alert_rules (id, factory_id, scope_type, scope_id, condition_type, threshold, channel)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+				st.ids.assign(r.ID), st.factoryID, r.ScopeType, scopeID, r.ConditionType, r.Threshold, r.Channel)
+		}
+	case "planned_downtime":
+		var d BackupPlannedDowntime
+		if err = json.Unmarshal(rec.D, &d); err == nil {
+			var sectorID, assetID *uuid.UUID
+			if sectorID, err = st.ids.optRef("setor", d.SectorID); err != nil {
+				return err
+			}
+			if assetID, err = st.ids.optRef("ativo", d.AssetID); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO nxd.planned_downtime (id, factory_id, sector_id, asset_id, starts_at, ends_at, reason)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+				st.ids.assign(d.ID), st.factoryID, sectorID, assetID, d.StartsAt, d.EndsAt, d.Reason)
+		}
+	case "shift":
+		var sh BackupShift
+		if err = json.Unmarshal(rec.D, &sh); err == nil {
+			var sectorID *uuid.UUID
+			if sectorID, err = st.ids.optRef("setor", sh.SectorID); err != nil {
+				return err
+			}
+			var mask int
+			if mask, err = weekdaysToMask(sh.Weekdays); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO nxd.shifts (id, factory_id, sector_id, name, start_time, end_time, days_mask, active)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8)`,
+				st.ids.assign(sh.ID), st.factoryID, sectorID, sh.Name, sh.StartTime, sh.EndTime, mask, sh.Active)
+		}
+	case "calendar_exception":
+		var ex BackupCalendarException
+		if err = json.Unmarshal(rec.D, &ex); err == nil {
+			var sectorID *uuid.UUID
+			if sectorID, err = st.ids.optRef("setor", ex.SectorID); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO nxd.calendar_exceptions (id, factory_id, sector_id, kind, starts_at, ends_at, name)
+				VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))`,
+				st.ids.assign(ex.ID), st.factoryID, sectorID, ex.Kind, ex.StartsAt, ex.EndsAt, ex.Name)
+		}
+	case "production_target":
+		var t BackupProductionTarget
+		if err = json.Unmarshal(rec.D, &t); err == nil {
+			var sectorID, assetID, shiftID *uuid.UUID
+			if sectorID, err = st.ids.optRef("setor", t.SectorID); err != nil {
+				return err
+			}
+			if assetID, err = st.ids.optRef("ativo", t.AssetID); err != nil {
+				return err
+			}
+			if shiftID, err = st.ids.optRef("turno", t.ShiftID); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO nxd.production_targets (id, factory_id, sector_id, asset_id, period, shift_id, metric, target,
+					valid_from, valid_to, notes)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, '')::date, NULLIF($11, ''))`,
+				st.ids.assign(t.ID), st.factoryID, sectorID, assetID, t.Period, shiftID, t.Metric, t.Target,
+				t.ValidFrom, t.ValidTo, t.Notes)
+		}
+	case "forecast_series":
+		var fs BackupForecastSeries
+		if err = json.Unmarshal(rec.D, &fs); err == nil {
+			var assetID uuid.UUID
+			if assetID, err = st.ids.ref("ativo", fs.AssetID); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO nxd.forecast_series (id, factory_id, asset_id, metric_key, granularity, horizon, active)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+				st.ids.assign(fs.ID), st.factoryID, assetID, fs.MetricKey, fs.Granularity, fs.Horizon, fs.Active)
+		}
+	case "health_model":
+		var m BackupHealthModel
+		if err = json.Unmarshal(rec.D, &m); err == nil {
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO nxd.health_models (factory_id, version, w_anomalies, w_trend, w_stops, w_run_hours,
+					anomaly_full_per_day, trend_full_z, stops_full_per_day, maintenance_interval_h, notes)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, ''))`,
+				st.factoryID, m.Version, m.WAnomalies, m.WTrend, m.WStops, m.WRunHours, m.AnomalyFullPerDay,
+				m.TrendFullZ, m.StopsFullPerDay, m.MaintenanceIntervalH, m.Notes)
+		}
+	case "health_tag":
+		var t BackupHealthTag
+		if err = json.Unmarshal(rec.D, &t); err == nil {
+			var assetID *uuid.UUID
+			if assetID, err = st.ids.optRef("ativo", t.AssetID); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO nxd.health_tags (id, factory_id, asset_id, metric_key, direction)
+				VALUES ($1, $2, $3, $4, $5)`,
+				st.ids.assign(t.ID), st.factoryID, assetID, t.MetricKey, t.Direction)
+		}
+	case "maintenance_event":
+		var m BackupMaintenanceEvent
+		if err = json.Unmarshal(rec.D, &m); err == nil {
+			var assetID uuid.UUID
+			if assetID, err = st.ids.ref("ativo", m.AssetID); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO nxd.maintenance_events (id, factory_id, asset_id, performed_at, kind, description, next_interval_h)
+				VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7)`,
+				st.ids.assign(m.ID), st.factoryID, assetID, m.PerformedAt, m.Kind, m.Description, m.NextIntervalH)
+		}
+	case "downtime_reason":
+		var d BackupDowntimeReason
+		if err = json.Unmarshal(rec.D, &d); err == nil {
+			var parentID *uuid.UUID
+			if parentID, err = st.ids.optRef("motivo", d.ParentID); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO nxd.downtime_reasons (id, factory_id, parent_id, code, name, active, is_failure)
+				VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+				st.ids.assign(d.ID), st.factoryID, parentID, d.Code, d.Name, d.Active, d.IsFailure)
+		}
+	case "downtime_event":
+		var d BackupDowntimeEvent
+		if err = json.Unmarshal(rec.D, &d); err == nil {
+			var assetID uuid.UUID
+			var reasonID *uuid.UUID
+			if assetID, err = st.ids.ref("ativo", d.AssetID); err != nil {
+				return err
+			}
+			if reasonID, err = st.ids.optRef("motivo", d.ReasonID); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO nxd.downtime_events (id, factory_id, asset_id, started_at, ended_at, duration_s, reason_id, comment, classified_at)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+				st.ids.assign(d.ID), st.factoryID, assetID, d.StartedAt, d.EndedAt, d.DurationS, reasonID, d.Comment, d.ClassifiedAt)
+		}
+	case "production_order":
+		var o BackupProductionOrder
+		if err = json.Unmarshal(rec.D, &o); err == nil {
+			var sectorID, assetID *uuid.UUID
+			if sectorID, err = st.ids.optRef("setor", o.SectorID); err != nil {
+				return err
+			}
+			if assetID, err = st.ids.optRef("ativo", o.AssetID); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO nxd.production_orders
+					(id, factory_id, sector_id, asset_id, order_code, product, target_qty, valor_venda_ok, started_at, ended_at, source)
+				VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7, $8, $9, $10, $11)`,
+				st.ids.assign(o.ID), st.factoryID, sectorID, assetID, o.OrderCode, o.Product, o.TargetQty, o.ValorVendaOk,
+				o.StartedAt, o.EndedAt, o.Source)
+		}
+	case "defect_type":
+		var d BackupDefectType
+		if err = json.Unmarshal(rec.D, &d); err == nil {
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO nxd.defect_types (id, factory_id, code, name, active) VALUES ($1, $2, $3, $4, $5)`,
+				st.ids.assign(d.ID), st.factoryID, d.Code, d.Name, d.Active)
+		}
+	case "inspection":
+		var in BackupInspection
+		if err = json.Unmarshal(rec.D, &in); err == nil {
+			var assetID, defectTypeID uuid.UUID
+			var orderID *uuid.UUID
+			if assetID, err = st.ids.ref("ativo", in.AssetID); err != nil {
+				return err
+			}
+			if orderID, err = st.ids.optRef("ordem", in.OrderID); err != nil {
+				return err
+			}
+			if defectTypeID, err = st.ids.ref("tipo de defeito", in.DefectTypeID); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO nxd.inspections (id, factory_id, asset_id, order_id, defect_type_id, quantity, inspected_at,
+					produced_start, produced_end, inspector, notes)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, NULLIF($10, ''), NULLIF($11, ''))`,
+				st.ids.assign(in.ID), st.factoryID, assetID, orderID, defectTypeID, in.Quantity, in.InspectedAt,
+				in.ProducedStart, in.ProducedEnd, in.Inspector, in.Notes)
+		}
+	case "inspection_attachment":
+		var a BackupInspectionAttachment
+		if err = json.Unmarshal(rec.D, &a); err == nil {
+			var inspectionID uuid.UUID
+			if inspectionID, err = st.ids.ref("inspeção", a.InspectionID); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO nxd.inspection_attachments (id, inspection_id, file_name, content_type, size_bytes, storage_url)
+				VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6)`,
+				st.ids.assign(a.ID), inspectionID, a.FileName, a.ContentType, a.SizeBytes, a.StorageURL)
+		}
+	case "annotation":
+		var n BackupAnnotation
+		if err = json.Unmarshal(rec.D, &n); err == nil {
+			var sectorID, assetID *uuid.UUID
+			if sectorID, err = st.ids.optRef("setor", n.SectorID); err != nil {
+				return err
+			}
+			if assetID, err = st.ids.optRef("ativo", n.AssetID); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO nxd.annotations (id, factory_id, sector_id, asset_id, starts_at, ends_at, category, text, author_name)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''))`,
+				st.ids.assign(n.ID), st.factoryID, sectorID, assetID, n.StartsAt, n.EndsAt, n.Category, n.Text, n.AuthorName)
+		}
+	case "virtual_metric":
+		var v BackupVirtualMetric
+		if err = json.Unmarshal(rec.D, &v); err == nil {
+			var sectorID, assetID *uuid.UUID
+			if sectorID, err = st.ids.optRef("setor", v.SectorID); err != nil {
+				return err
+			}
+			if assetID, err = st.ids.optRef("ativo", v.AssetID); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO nxd.virtual_metrics
+					(id, factory_id, sector_id, asset_id, metric_key, expression, unit, description, mode, active)
+				VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), $9, $10)`,
+				st.ids.assign(v.ID), st.factoryID, sectorID, assetID, v.MetricKey, v.Expression, v.Unit, v.Description,
+				v.Mode, v.Active)
+		}
+	case "metric_catalog":
+		var c BackupMetricCatalog
+		if err = json.Unmarshal(rec.D, &c); err == nil {
+			var assetID uuid.UUID
+			if assetID, err = st.ids.ref("ativo", c.AssetID); err != nil {
+				return err
+			}
+			var virtualID *uuid.UUID
+			if virtualID, err = st.ids.optRef("métrica virtual", c.VirtualMetricID); err != nil {
+				return err
+			}
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO nxd.asset_metric_catalog (factory_id, asset_id, metric_key, first_seen, last_seen, virtual_metric_id)
+				VALUES ($1, $2, $3, $4, $5, $6)`,
+				st.factoryID, assetID, c.MetricKey, c.FirstSeen, c.LastSeen, virtualID)
+		}
+	case "telemetry":
+		if st.opts.SkipTelemetry {
+			return nil
+		}
+		var t BackupTelemetry
+		if err = json.Unmarshal(rec.D, &t); err == nil {
+			var assetID uuid.UUID
+			if assetID, err = st.ids.ref("ativo", t.AssetID); err != nil {
+				return err
+			}
+			st.telemetry = append(st.telemetry, BulkTelemetryRow{
+				Ts: t.Ts, FactoryID: st.factoryID, AssetID: assetID,
+				MetricKey: t.MetricKey, MetricValue: t.MetricValue, Status: t.Status,
+				Raw: t.Raw, CorrelationID: t.CorrelationID,
+			})
+			if len(st.telemetry) >= backupTelemetryBatch {
+				err = st.flushTelemetry(tx)
+			}
+		}
+		if err != nil {
+			return fmt.Errorf("restore telemetry: %w", err)
+		}
+		return nil
+	case "end":
+		var e backupEnd
+		if err = json.Unmarshal(rec.D, &e); err == nil {
+			st.ended = true
+			st.expected = e.Counts
+		}
+		return err
+	default:
+		return fmt.Errorf("backup inválido: tipo de registro desconhecido %q", rec.T)
+	}
+	if err != nil {
+		return fmt.Errorf("restore %s: %w", rec.T, err)
+	}
+	st.res.Counts[rec.T]++
+	return nil
+}
+
+func (st *restoreState) flushTelemetry(tx *sql.Tx) error {
+	if len(st.telemetry) == 0 {
+		return nil
+	}
+	n, err := BulkCopyTelemetryLog(tx, st.telemetry)
+	if err != nil {
+		return err
+	}
+	st.res.Counts["telemetry"] += n
+	st.telemetry = st.telemetry[:0]
+	return nil
+}
+
+// restoreUser casa o usuário por email; se não existir, cria com a senha
+// bloqueada (LockedPasswordHash; ID novo no clone).
+func (st *restoreState) restoreUser(ctx context.Context, tx *sql.Tx, u BackupUser) error {
+	st.users[u.ID] = u
+	var id uuid.UUID
+	err := tx.QueryRowContext(ctx, `SELECT id FROM nxd.users WHERE email = $1`, u.Email).Scan(&id)
+	if err == nil {
+		st.ids.ids[u.ID] = id
+		return nil
+	}
+	if err != sql.ErrNoRows {
+		return err
+	}
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO nxd.users (id, name, email, password_hash) VALUES ($1, $2, $3, $4)`,
+		st.ids.assign(u.ID), u.Name, u.Email, LockedPasswordHash)
+	return err
+}
+
+func (st *restoreState) restoreFactory(ctx context.Context, tx *sql.Tx, f BackupFactory) error {
+	if st.factoryID != uuid.Nil {
+		return fmt.Errorf("backup com mais de uma fábrica")
+	}
+	if !st.opts.Clone {
+		var exists bool
+		if err := tx.QueryRowContext(ctx,
+			`SELECT EXISTS (SELECT 1 FROM nxd.factories WHERE id = $1)`, f.ID,
+		).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return ErrBackupFactoryExists
+		}
+	}
+
+	var owner *uuid.UUID
+	ownerEmail := st.opts.OwnerEmail
+	var login *BackupLogin
+	if st.opts.OwnerEmail != "" {
+		var id uuid.UUID
+		err := tx.QueryRowContext(ctx, `SELECT id FROM nxd.users WHERE email = $1`, st.opts.OwnerEmail).Scan(&id)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("usuário dono %q não existe no NXD", st.opts.OwnerEmail)
+		}
+		if err != nil {
+			return err
+		}
+		owner = &id
+	} else if f.UserID != nil {
+		id, err := st.ids.ref("usuário", *f.UserID)
+		if err != nil {
+			return err
+		}
+		owner = &id
+		ownerEmail, login = st.users[*f.UserID].Email, st.users[*f.UserID].Login
+	}
+	if owner == nil {
+		st.res.Warnings = append(st.res.Warnings, "fábrica sem dono: nenhum usuário a acessa")
+	} else {
+		// getFactoryIDForUser resolve o usuário para a fábrica mais antiga dele:
+		// um dono que já tem fábrica nunca chegaria à restaurada (caso comum no clone).
+		var n int
+		if err := tx.QueryRowContext(ctx, `SELECT COUNT(*) FROM nxd.factories WHERE user_id = $1`, *owner).Scan(&n); err != nil {
+			return err
+		}
+		if n > 0 {
+			return fmt.Errorf("%w (%s)", ErrBackupOwnerHasFactory, ownerEmail)
+		}
+		if err := st.checkLogin(ctx, ownerEmail, login); err != nil {
+			return err
+		}
+	}
+
+	name := f.Name
+	if st.opts.FactoryName != "" {
+		name = st.opts.FactoryName
+	}
+	segment := f.Segment
+	if !knownSegment(segment) {
+		segment = "" // segmento livre de backups antigos: fora da lista fechada do benchmark
+	}
+	st.factoryID = st.ids.assign(f.ID)
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO nxd.factories (id, user_id, name, is_active, timezone, emission_region, currency, industry_segment)
+		 VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, ''), $6), COALESCE(NULLIF($7, ''), $8), COALESCE(NULLIF($9, ''), $10), NULLIF($11, ''))`,
+		st.factoryID, owner, name, f.IsActive, f.Timezone, DefaultFactoryTimezone, f.Region, DefaultEmissionRegion,
+		f.Currency, DefaultFactoryCurrency, segment,
+	); err != nil {
+		return err
+	}
+	st.res.FactoryID = st.factoryID
+	st.res.FactoryName = name
+	st.res.OwnerUserID = owner
+	return nil
+}
+
+// checkLogin garante que o dono consiga entrar: conta existente, ou a do backup
+// (criada antes do commit). owner_email precisa apontar para uma conta existente.
+func (st *restoreState) checkLogin(ctx context.Context, email string, login *BackupLogin) error {
+	accounts := getLoginAccounts()
+	if accounts == nil {
+		st.res.Warnings = append(st.res.Warnings,
+			fmt.Sprintf("contas de login indisponíveis: confira se %s consegue entrar", email))
+		return nil
+	}
+	existing, err := accounts.GetLogin(ctx, email)
+	if err != nil {
+		return fmt.Errorf("conta de login: %w", err)
+	}
+	if existing != nil {
+		return nil
+	}
+	if login == nil || st.opts.OwnerEmail != "" {
+		return fmt.Errorf("usuário dono %q não tem conta de login neste servidor", email)
+	}
+	st.loginEmail, st.login = email, login
+	return nil
+}
+
+// CloneFactory copia uma fábrica para um novo UUID no mesmo banco, ligando o
+// backup ao restore por um pipe (sem arquivo intermediário).
+func CloneFactory(ctx context.Context, db *sql.DB, storage ArchiveStorage, factoryID uuid.UUID, includeTelemetry bool, opts RestoreOptions) (*RestoreResult, error) {
+	opts.Clone = true
+	pr, pw := io.Pipe()
+	writeErr := make(chan error, 1)
+	go func() {
+		_, err := WriteFactoryBackup(ctx, db, storage, factoryID, includeTelemetry, pw)
+		pw.CloseWithError(err)
+		writeErr <- err
+	}()
+	res, err := RestoreFactoryBackup(ctx, db, pr, opts)
+	pr.CloseWithError(errors.New("restore encerrado"))
+	if werr := <-writeErr; werr != nil && err == nil {
+		err = werr
+	}
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
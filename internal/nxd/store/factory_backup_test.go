@@ -0,0 +1,140 @@
+package store
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func gzipLines(t *testing.T, lines ...string) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	for _, l := range lines {
+		gz.Write([]byte(l + "\n"))
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
+// TestRestoreFactoryBackupRejectsBadStreams garante que arquivos truncados ou
+// fora de ordem são recusados antes de qualquer escrita.
+func TestRestoreFactoryBackupRejectsBadStreams(t *testing.T) {
+	db := openSQLiteMemory(t)
+	hdr, _ := json.Marshal(backupRecord{T: "header", D: json.RawMessage(`{"format":"` + FactoryBackupFormat + `"}`)})
+	cases := map[string]struct {
+		lines []string
+		want  string
+	}{
+		"truncated":      {[]string{string(hdr)}, "incompleto"},
+		"no header":      {[]string{`{"t":"sector","d":{}}`}, "cabeçalho"},
+		"wrong format":   {[]string{`{"t":"header","d":{"format":"nxd-backup/99"}}`}, "não suportado"},
+		"before factory": {[]string{string(hdr), `{"t":"asset","d":{}}`}, "antes da fábrica"},
+		"unknown type":   {[]string{string(hdr), `{"t":"end","d":{}}`, `{"t":"x","d":{}}`}, "após o fim"},
+	}
+	for name, c := range cases {
+		_, err := RestoreFactoryBackup(context.Background(), db, gzipLines(t, c.lines...), RestoreOptions{Clone: true})
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Errorf("%s: err = %v, want %q", name, err, c.want)
+		}
+	}
+}
+
+func TestBackupIDMapClone(t *testing.T) {
+	old := uuid.New()
+	m := backupIDMap{clone: true, ids: map[uuid.UUID]uuid.UUID{}}
+	id := m.assign(old)
+	if id == old {
+		t.Fatal("clone must generate a new id")
+	}
+	if got, err := m.ref("ativo", old); err != nil || got != id {
+		t.Fatalf("ref = %v, %v", got, err)
+	}
+	if _, err := m.ref("ativo", uuid.New()); err == nil {
+		t.Error("unknown reference must fail")
+	}
+
+	keep := backupIDMap{ids: map[uuid.UUID]uuid.UUID{}}
+	if keep.assign(old) != old {
+		t.Error("restore must keep the original id")
+	}
+
+	rec := []string{"2024-03-01T01:00:00Z", old.String(), "temp", "21.5", "OK", "c1", `{"v":1}`}
+	tl, ok := backupTelemetryFromArchive(rec)
+	if !ok || tl.AssetID != old || tl.MetricValue != 21.5 || string(tl.Raw) != `{"v":1}` {
+		t.Fatalf("backupTelemetryFromArchive = %+v, %v", tl, ok)
+	}
+	if _, ok := backupTelemetryFromArchive([]string{"2024-03-01T01:00:00Z", "", "temp", "", "", "", ""}); ok {
+		t.Error("rows without asset/value are not restorable")
+	}
+}
+
+type fakeLoginAccounts map[string]*BackupLogin
+
+func (f fakeLoginAccounts) GetLogin(_ context.Context, email string) (*BackupLogin, error) {
+	return f[email], nil
+}
+
+func (f fakeLoginAccounts) EnsureLogin(_ context.Context, email string, l BackupLogin) error {
+	f[email] = &l
+	return nil
+}
+
+// TestRestoreCheckLogin: o dono restaurado precisa de uma conta de login — a
+// existente, ou a do backup; owner_email nunca cria conta.
+func TestRestoreCheckLogin(t *testing.T) {
+	accounts := fakeLoginAccounts{"ana@cliente.com": {FullName: "Ana"}}
+	SetLoginAccounts(accounts)
+	t.Cleanup(func() { SetLoginAccounts(nil) })
+	ctx := context.Background()
+	newState := func(opts RestoreOptions) *restoreState {
+		return &restoreState{opts: opts, res: &RestoreResult{}}
+	}
+
+	st := newState(RestoreOptions{})
+	if err := st.checkLogin(ctx, "ana@cliente.com", &BackupLogin{FullName: "Outra"}); err != nil || st.login != nil {
+		t.Errorf("existing login: err = %v, pending = %+v", err, st.login)
+	}
+	st = newState(RestoreOptions{})
+	if err := st.checkLogin(ctx, "bia@cliente.com", &BackupLogin{FullName: "Bia"}); err != nil ||
+		st.login == nil || st.loginEmail != "bia@cliente.com" {
+		t.Errorf("backup login must be created: err = %v, pending = %+v", err, st.login)
+	}
+	if err := newState(RestoreOptions{}).checkLogin(ctx, "bia@cliente.com", nil); err == nil {
+		t.Error("owner without login accepted")
+	}
+	if err := newState(RestoreOptions{OwnerEmail: "bia@cliente.com"}).checkLogin(ctx, "bia@cliente.com", nil); err == nil {
+		t.Error("owner_email without login accepted")
+	}
+
+	SetLoginAccounts(nil)
+	st = newState(RestoreOptions{})
+	if err := st.checkLogin(ctx, "bia@cliente.com", nil); err != nil || len(st.res.Warnings) != 1 {
+		t.Errorf("without LoginAccounts: err = %v, warnings = %v", err, st.res.Warnings)
+	}
+}
+
+// TestBackupCarriesNoCredentials: o backup não leva hash de senha nem perfil, e a
+// senha das contas restauradas não confere com nada.
+func TestBackupCarriesNoCredentials(t *testing.T) {
+	b, err := json.Marshal(BackupUser{Email: "ana@cliente.com", Login: &BackupLogin{FullName: "Ana"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(string(b), "password") || strings.Contains(string(b), "role") {
+		t.Errorf("backup user = %s", b)
+	}
+	for _, pw := range []string{"", "!restored", "restored"} {
+		if bcrypt.CompareHashAndPassword([]byte(LockedPasswordHash), []byte(pw)) == nil {
+			t.Errorf("locked hash accepts %q", pw)
+		}
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 // FinancialAggregateResult — resultado por setor/linha para um período.
@@ -15,13 +16,44 @@ type FinancialAggregateResult struct {
 	SectorName      string    `json:"sector_name,omitempty"`
 	OKCount         float64   `json:"ok_count"`
 	NOKCount        float64   `json:"nok_count"`
+	InspectionNOK   float64   `json:"inspection_nok,omitempty"` // NCs de inspeção (inspections.go), já em NOKCount
 	HoursParada     float64   `json:"hours_parada"`
 	FaturamentoBruto float64  `json:"faturamento_bruto"`
 	PerdaRefugo     float64   `json:"perda_refugo"`
 	CustoParada     float64   `json:"custo_parada"`
+	EnergiaKWh      float64   `json:"energia_kwh"`
+	CustoEnergia    float64   `json:"custo_energia"`
 	ValorVendaOk    float64   `json:"valor_venda_ok"`
 	CustoRefugoUn   float64   `json:"custo_refugo_un"`
 	CustoParadaH    float64   `json:"custo_parada_h"`
+	CustoKwh        float64   `json:"custo_kwh"`
+	// Energia (energy.go): CustoEnergia = consumo por posto + CustoDemanda.
+	CustoDemanda        float64        `json:"custo_demanda"`
+	DemandaPicoKW       float64        `json:"demanda_pico_kw"`
+	DemandaPicoEm       *time.Time     `json:"demanda_pico_em,omitempty"`
+	KWhPorPeca          *float64       `json:"kwh_por_peca"`
+	CustoEnergiaPorPeca *float64       `json:"custo_energia_por_peca"`
+	Tarifa              string         `json:"tarifa,omitempty"`
+	EnergiaPostos       []EnergyBand   `json:"energia_postos,omitempty"`
+	EnergiaMedidores    []EnergySource `json:"energia_medidores,omitempty"`
+	// Emissões Escopo 2 (emissions.go): kg CO2e do consumo pelo fator da região.
+	CO2eKg        float64  `json:"co2e_kg"`
+	CO2eKgPorPeca *float64 `json:"co2e_kg_por_peca"`
+	// Modelo de custos (cost_model.go): parâmetros com vigência por ativo/produto.
+	// ValorVendaOk/CustoRefugoUn/CustoParadaH acima são o business_config atual;
+	// os valores abaixo usam os parâmetros vigentes em cada trecho do período.
+	// MargemContribuicao = FaturamentoBruto − CustosVariaveis (material + refugo + energia);
+	// ResultadoOperacional = MargemContribuicao − CustoMaoObra − CustoParada.
+	CustoMaterial             float64  `json:"custo_material"`
+	CustoMaoObra              float64  `json:"custo_mao_obra"`
+	TurnosEquivalentes        float64  `json:"turnos_equivalentes"`
+	CustosVariaveis           float64  `json:"custos_variaveis"`
+	MargemContribuicao        float64  `json:"margem_contribuicao"`
+	MargemContribuicaoPct     *float64 `json:"margem_contribuicao_pct"`
+	MargemContribuicaoPorPeca *float64 `json:"margem_contribuicao_por_peca"`
+	ResultadoOperacional      float64  `json:"resultado_operacional"`
+	Moeda                     string   `json:"moeda"`
+	Avisos                    []string `json:"avisos,omitempty"`
 }
 
 // AssetFinancialRow — breakdown por ativo.
@@ -30,21 +62,117 @@ type AssetFinancialRow struct {
 	AssetName        string    `json:"asset_name"`
 	OKCount          float64   `json:"ok_count"`
 	NOKCount         float64   `json:"nok_count"`
+	InspectionNOK    float64   `json:"inspection_nok,omitempty"`
 	HoursParada      float64   `json:"hours_parada"`
 	FaturamentoBruto float64   `json:"faturamento_bruto"`
 	PerdaRefugo      float64   `json:"perda_refugo"`
 	CustoParada      float64   `json:"custo_parada"`
+	EnergiaKWh       float64   `json:"energia_kwh"`
+	CustoEnergia     float64   `json:"custo_energia"`
+	CO2eKg           float64   `json:"co2e_kg"`
+	CustoMaterial      float64 `json:"custo_material"`
+	CustoMaoObra       float64 `json:"custo_mao_obra"`
+	MargemContribuicao float64 `json:"margem_contribuicao"`
+	HorasProgramadas   float64 `json:"horas_programadas"` // tempo programado do calendário (base dos turnos de mão de obra)
 }
 
-// ComputeFinancialAggregate calcula OK/NOK/horas parada a partir da telemetria e aplica business_config.
+// ComputeFinancialAggregate calcula OK/NOK/horas parada/energia a partir da telemetria e aplica business_config.
 // Se sectorID for nil, usa todos os ativos da fábrica e config padrão (sector_id null).
+// Os preços de cada ativo vêm do histórico de parâmetros de custo (cost_model.go),
+// com a config como base quando não há versão vigente.
+// Horas parada só contam dentro do tempo programado do calendário (calendar.go);
+// peças OK/NOK contam no período inteiro (produção fora de turno também fatura).
+// NCs de inspeção passam peças de OK para NOK no trecho em que foram produzidas
+// (inspections.go).
 func ComputeFinancialAggregate(db *sql.DB, factoryID uuid.UUID, sectorID *uuid.UUID, periodStart, periodEnd time.Time) (*FinancialAggregateResult, []AssetFinancialRow, error) {
+	results, breakdowns, err := ComputeFinancialAggregates(db, factoryID, sectorID, []FinancialPeriod{{Start: periodStart, End: periodEnd}})
+	if err != nil {
+		return nil, nil, err
+	}
+	return results[0], breakdowns[0], nil
+}
+
+// FinancialPeriod — um dos períodos de ComputeFinancialAggregates.
+type FinancialPeriod struct {
+	Start time.Time
+	End   time.Time
+}
+
+// ComputeFinancialAggregates é ComputeFinancialAggregate para vários períodos do mesmo
+// escopo (faixas do resumo, atual × anterior, turnos) com um único lote de leituras
+// (telemetry_batch.go): as consultas não crescem com os ativos, só com o tempo coberto.
+// Os resultados seguem a ordem de periods; sem business_config, todos são nil.
+func ComputeFinancialAggregates(db *sql.DB, factoryID uuid.UUID, sectorID *uuid.UUID, periods []FinancialPeriod) ([]*FinancialAggregateResult, [][]AssetFinancialRow, error) {
+	results := make([]*FinancialAggregateResult, len(periods))
+	breakdowns := make([][]AssetFinancialRow, len(periods))
+	if len(periods) == 0 {
+		return results, breakdowns, nil
+	}
 	config, err := GetBusinessConfigBySector(db, factoryID, sectorID)
 	if err != nil || config == nil {
+		return results, breakdowns, err
+	}
+
+	assetIDs, assetSector, err := financialAssets(db, factoryID, sectorID)
+	if err != nil {
+		return nil, nil, err
+	}
+	assets, err := loadFinancialAssets(db, assetIDs, assetSector)
+	if err != nil {
+		return nil, nil, err
+	}
+	from, to := periods[0].Start, periods[0].End
+	for _, p := range periods[1:] {
+		if p.Start.Before(from) {
+			from = p.Start
+		}
+		if p.End.After(to) {
+			to = p.End
+		}
+	}
+	cal, err := LoadProductionCalendar(db, factoryID, from, to)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := attachQualityDefects(db, assets, from, to); err != nil {
+		return nil, nil, err
+	}
+
+	var sectorName string
+	if sectorID != nil {
+		db.QueryRow(`SELECT name FROM nxd.sectors WHERE id = $1`, sectorID).Scan(&sectorName)
+	}
+
+	energy, err := loadEnergyScope(db, factoryID, sectorID, true)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	costs, err := loadCostModel(db, factoryID, cal.Location)
+	if err != nil {
 		return nil, nil, err
 	}
 
+	batch := newTelemetryBatch()
+	finish := make([]func() (*FinancialAggregateResult, []AssetFinancialRow), len(periods))
+	for i, p := range periods {
+		finish[i] = planFinancials(batch, config, costs, assets, cal, energy, p.Start, p.End)
+	}
+	if err := batch.run(db); err != nil {
+		return nil, nil, err
+	}
+	for i := range periods {
+		results[i], breakdowns[i] = finish[i]()
+		results[i].SectorID = sectorID
+		results[i].SectorName = sectorName
+	}
+	return results, breakdowns, nil
+}
+
+// financialAssets lista os ativos do setor (ou da fábrica, com sectorID nil) e o setor de cada um.
+func financialAssets(db *sql.DB, factoryID uuid.UUID, sectorID *uuid.UUID) ([]uuid.UUID, map[uuid.UUID]*uuid.UUID, error) {
 	var assetIDs []uuid.UUID
+	assetSector := map[uuid.UUID]*uuid.UUID{}
 	if sectorID != nil {
 		assets, err := ListAssetsBySector(db, *sectorID)
 		if err != nil {
@@ -52,146 +180,283 @@ func ComputeFinancialAggregate(db *sql.DB, factoryID uuid.UUID, sectorID *uuid.U
 		}
 		for _, a := range assets {
 			assetIDs = append(assetIDs, a.ID)
+			assetSector[a.ID] = sectorID
 		}
-	} else {
-		rows, err := db.Query(`SELECT id FROM nxd.assets WHERE factory_id = $1`, factoryID)
-		if err != nil {
+		return assetIDs, assetSector, nil
+	}
+	rows, err := db.Query(`SELECT id, group_id FROM nxd.assets WHERE factory_id = $1`, factoryID)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id uuid.UUID
+		var groupID uuid.NullUUID
+		if err := rows.Scan(&id, &groupID); err != nil {
 			return nil, nil, err
 		}
-		defer rows.Close()
-		for rows.Next() {
-			var id uuid.UUID
-			if err := rows.Scan(&id); err != nil {
-				return nil, nil, err
-			}
-			assetIDs = append(assetIDs, id)
-		}
-		if err := rows.Err(); err != nil {
-			return nil, nil, err
+		assetIDs = append(assetIDs, id)
+		if groupID.Valid {
+			assetSector[id] = &groupID.UUID
 		}
 	}
+	return assetIDs, assetSector, rows.Err()
+}
 
-	var sectorName string
-	if sectorID != nil {
-		db.QueryRow(`SELECT name FROM nxd.sectors WHERE id = $1`, sectorID).Scan(&sectorName)
-	}
+// financialAsset — ativo com mapeamento de tags, nome e setor (ativos sem mapeamento ficam de fora).
+type financialAsset struct {
+	id       uuid.UUID
+	name     string
+	sectorID *uuid.UUID
+	mapping  TagMappingRow
+	defects  []qualityDefect // NCs de inspeção (attachQualityDefects)
+}
 
-	var totalOK, totalNOK, totalHoursParada float64
-	var breakdown []AssetFinancialRow
-	for _, assetID := range assetIDs {
-		mapping, err := GetTagMappingByAsset(db, assetID)
-		if err != nil || mapping == nil {
-			continue
+// loadFinancialAssets lê mapeamento e nome de todos os ativos numa consulta, na ordem de assetIDs.
+func loadFinancialAssets(db *sql.DB, assetIDs []uuid.UUID, assetSector map[uuid.UUID]*uuid.UUID) ([]financialAsset, error) {
+	if len(assetIDs) == 0 {
+		return nil, nil
+	}
+	ids := make([]string, len(assetIDs))
+	for i, id := range assetIDs {
+		ids[i] = id.String()
+	}
+	rows, err := db.Query(`
+		SELECT t.id, t.asset_id, COALESCE(t.tag_ok,''), COALESCE(t.tag_nok,''), COALESCE(t.tag_status,''), COALESCE(t.reading_rule,'delta'), t.ideal_cycle_s,
+			COALESCE(t.tag_energy,''), COALESCE(t.tag_order,''), COALESCE(t.tag_alarm,''), COALESCE(t.tag_cycle,''), t.cycle_pieces, t.created_at, t.updated_at,
+			COALESCE(a.display_name, a.source_tag_id, '')
+		FROM nxd.tag_mapping t
+		JOIN nxd.assets a ON a.id = t.asset_id
+		WHERE t.asset_id = ANY($1::uuid[])
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	byID := map[uuid.UUID]financialAsset{}
+	for rows.Next() {
+		var a financialAsset
+		r := &a.mapping
+		if err := rows.Scan(&r.ID, &r.AssetID, &r.TagOK, &r.TagNOK, &r.TagStatus, &r.ReadingRule, &r.IdealCycleS,
+			&r.TagEnergy, &r.TagOrder, &r.TagAlarm, &r.TagCycle, &r.CyclePieces, &r.CreatedAt, &r.UpdatedAt, &a.name); err != nil {
+			return nil, err
 		}
-		okDelta, nokDelta, hoursParada := computeAssetDeltas(db, assetID, mapping, periodStart, periodEnd)
-		totalOK += okDelta
-		totalNOK += nokDelta
-		totalHoursParada += hoursParada
-		var assetName string
-		db.QueryRow(`SELECT COALESCE(display_name, source_tag_id) FROM nxd.assets WHERE id = $1`, assetID).Scan(&assetName)
-		breakdown = append(breakdown, AssetFinancialRow{
-			AssetID:          assetID,
-			AssetName:        assetName,
-			OKCount:          okDelta,
-			NOKCount:         nokDelta,
-			HoursParada:      hoursParada,
-			FaturamentoBruto: okDelta * config.ValorVendaOk,
-			PerdaRefugo:      nokDelta * config.CustoRefugoUn,
-			CustoParada:      hoursParada * config.CustoParadaH,
-		})
-	}
-
-	res := &FinancialAggregateResult{
-		PeriodStart:      periodStart,
-		PeriodEnd:         periodEnd,
-		SectorID:          sectorID,
-		SectorName:        sectorName,
-		OKCount:           totalOK,
-		NOKCount:          totalNOK,
-		HoursParada:       totalHoursParada,
-		ValorVendaOk:      config.ValorVendaOk,
-		CustoRefugoUn:     config.CustoRefugoUn,
-		CustoParadaH:      config.CustoParadaH,
-		FaturamentoBruto:  totalOK * config.ValorVendaOk,
-		PerdaRefugo:       totalNOK * config.CustoRefugoUn,
-		CustoParada:       totalHoursParada * config.CustoParadaH,
+		a.id = r.AssetID
+		byID[a.id] = a
 	}
-	return res, breakdown, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	out := make([]financialAsset, 0, len(byID))
+	for _, id := range assetIDs {
+		if a, ok := byID[id]; ok {
+			a.sectorID = assetSector[id]
+			out = append(out, a)
+		}
+	}
+	return out, nil
 }
 
-// computeAssetDeltas retorna (delta OK, delta NOK, horas parada) para o ativo no período.
-func computeAssetDeltas(db *sql.DB, assetID uuid.UUID, m *TagMappingRow, start, end time.Time) (okDelta, nokDelta, hoursParada float64) {
-	if m.TagOK != "" {
-		okDelta = metricDelta(db, assetID, m.TagOK, m.ReadingRule, start, end)
+// attachQualityDefects carrega as NCs de inspeção dos ativos que podem cair em [from, to).
+func attachQualityDefects(db *sql.DB, assets []financialAsset, from, to time.Time) error {
+	ids := make([]uuid.UUID, len(assets))
+	for i := range assets {
+		ids[i] = assets[i].id
 	}
-	if m.TagNOK != "" {
-		nokDelta = metricDelta(db, assetID, m.TagNOK, m.ReadingRule, start, end)
+	defects, err := loadQualityDefects(db, ids, from, to)
+	if err != nil {
+		return err
 	}
-	if m.TagStatus != "" {
-		hoursParada = metricHoursParada(db, assetID, m.TagStatus, start, end)
+	for i := range assets {
+		assets[i].defects = defects[assets[i].id]
 	}
-	return okDelta, nokDelta, hoursParada
+	return nil
 }
 
-func metricDelta(db *sql.DB, assetID uuid.UUID, metricKey, rule string, start, end time.Time) float64 {
-	if rule == "absolute" {
-		var last float64
-		err := db.QueryRow(`
-			SELECT metric_value FROM nxd.telemetry_log
-			WHERE asset_id = $1 AND metric_key = $2 AND ts >= $3 AND ts <= $4
-			ORDER BY ts DESC LIMIT 1
-		`, assetID, metricKey, start, end).Scan(&last)
-		if err != nil {
-			return 0
+// aggregateFinancials é planFinancials de um período só, com o lote já executado
+// (ordens de produção).
+func aggregateFinancials(db *sql.DB, config *BusinessConfigRow, costs *costModel, assets []financialAsset, cal *ProductionCalendar, energy *energyScope, periodStart, periodEnd time.Time) (*FinancialAggregateResult, []AssetFinancialRow, error) {
+	batch := newTelemetryBatch()
+	finish := planFinancials(batch, config, costs, assets, cal, energy, periodStart, periodEnd)
+	if err := batch.run(db); err != nil {
+		return nil, nil, err
+	}
+	res, breakdown := finish()
+	return res, breakdown, nil
+}
+
+// financialSegment — trecho de um ativo com uma única vigência de preços.
+type financialSegment struct {
+	ok, nok, parada *telemetryRead
+	prices          CostValues
+	sched, shifts   float64
+	inspectionNOK   float64 // NCs de inspeção produzidas no trecho
+}
+
+// planFinancials agenda no lote as leituras de OK/NOK/horas parada/energia dos ativos em
+// [periodStart, periodEnd] e resolve os preços vigentes de costs (config quando não há
+// versão; costs nil = só config). A função retornada monta o resultado depois de b.run.
+// A energia (tag_energy dos ativos + medidores de energy) é precificada pela tarifa
+// horária da fábrica; sem tarifa vigente, por config.CustoKwh.
+func planFinancials(b *telemetryBatch, config *BusinessConfigRow, costs *costModel, assets []financialAsset, cal *ProductionCalendar, energy *energyScope, periodStart, periodEnd time.Time) func() (*FinancialAggregateResult, []AssetFinancialRow) {
+	if costs == nil {
+		costs = newCostModel(DefaultFactoryCurrency, nil, nil, cal.Location)
+	}
+	costs.fallback = CostValues{ValorVendaOk: config.ValorVendaOk, CustoRefugoUn: config.CustoRefugoUn,
+		CustoParadaH: config.CustoParadaH, CustoMaterialUn: config.CustoMaterialUn, CustoMaoObraTurno: config.CustoMaoObraTurno}
+	costs.warnings = map[string]bool{} // avisos por período (o modelo é compartilhado entre períodos)
+	segments := make([][]financialSegment, len(assets))
+	var sources []EnergySource
+	for i, a := range assets {
+		m := a.mapping
+		// Um trecho por vigência; leitura "absolute" (último valor) não se divide.
+		cuts := []time.Time{periodStart}
+		if m.ReadingRule != "absolute" {
+			cuts = append(cuts, costs.boundaries(a.id, a.sectorID, periodStart, periodEnd)...)
+		}
+		cuts = append(cuts, periodEnd)
+		for k := 0; k+1 < len(cuts); k++ {
+			from, to := cuts[k], cuts[k+1]
+			seg := financialSegment{prices: costs.resolve(a.id, a.sectorID, from), sched: cal.scheduledHours(a.sectorID, from, to)}
+			seg.shifts = cal.shiftEquivalents(a.sectorID, seg.sched)
+			seg.inspectionNOK = defectQtyIn(a.defects, from, to)
+			if m.TagOK != "" {
+				seg.ok = b.delta(a.id, m.TagOK, m.ReadingRule, from, to)
+			}
+			if m.TagNOK != "" {
+				seg.nok = b.delta(a.id, m.TagNOK, m.ReadingRule, from, to)
+			}
+			if m.TagStatus != "" {
+				// Fora de turno não conta como parada.
+				seg.parada = b.hoursParada(a.id, m.TagStatus, from, to, cal.Unscheduled(a.sectorID, from, to))
+			}
+			segments[i] = append(segments[i], seg)
+		}
+		if m.TagEnergy != "" {
+			sources = append(sources, EnergySource{Kind: "asset", ID: a.id, Name: a.name, SectorID: a.sectorID,
+				MetricKey: m.TagEnergy, assetID: a.id, rule: m.ReadingRule})
 		}
-		return last
 	}
-	var first, last float64
-	if err := db.QueryRow(`
-		SELECT metric_value FROM nxd.telemetry_log
-		WHERE asset_id = $1 AND metric_key = $2 AND ts >= $3 AND ts <= $4 ORDER BY ts ASC LIMIT 1
-	`, assetID, metricKey, start, end).Scan(&first); err != nil {
-		return 0
+	avisos := costs.warningList()
+
+	if energy == nil {
+		energy = &energyScope{}
 	}
-	if err := db.QueryRow(`
-		SELECT metric_value FROM nxd.telemetry_log
-		WHERE asset_id = $1 AND metric_key = $2 AND ts >= $3 AND ts <= $4 ORDER BY ts DESC LIMIT 1
-	`, assetID, metricKey, start, end).Scan(&last); err != nil {
-		return 0
+	sources = append(sources, energy.sources()...)
+	finishEnergy := planEnergy(b, sources, newEnergyPricing(energy.tariffs, energy.factors, cal, config.CustoKwh), periodStart, periodEnd)
+
+	return func() (*FinancialAggregateResult, []AssetFinancialRow) {
+		var totalOK, totalNOK, totalInspectionNOK, totalHoursParada, totalShifts float64
+		var breakdown []AssetFinancialRow
+		for i, a := range assets {
+			row := AssetFinancialRow{AssetID: a.id, AssetName: a.name}
+			for _, seg := range segments[i] {
+				okDelta, nokDelta, hoursParada := readValue(seg.ok), readValue(seg.nok), readValue(seg.parada)
+				okDelta, nokDelta = reclassifyDefects(okDelta, nokDelta, seg.inspectionNOK)
+				v := seg.prices
+				row.OKCount += okDelta
+				row.NOKCount += nokDelta
+				row.InspectionNOK += seg.inspectionNOK
+				row.HoursParada += hoursParada
+				row.HorasProgramadas += seg.sched
+				row.FaturamentoBruto += okDelta * v.ValorVendaOk
+				row.PerdaRefugo += nokDelta * v.CustoRefugoUn
+				row.CustoParada += hoursParada * v.CustoParadaH
+				row.CustoMaterial += (okDelta + nokDelta) * v.CustoMaterialUn
+				row.CustoMaoObra += seg.shifts * v.CustoMaoObraTurno
+				totalShifts += seg.shifts
+			}
+			totalOK += row.OKCount
+			totalNOK += row.NOKCount
+			totalInspectionNOK += row.InspectionNOK
+			totalHoursParada += row.HoursParada
+			breakdown = append(breakdown, row)
+		}
+
+		en := finishEnergy()
+		en.setPieces(totalOK)
+		var meters []EnergySource
+		for _, src := range en.Sources {
+			if src.Kind != "asset" {
+				meters = append(meters, src)
+				continue
+			}
+			for i := range breakdown {
+				if breakdown[i].AssetID == src.ID {
+					breakdown[i].EnergiaKWh, breakdown[i].CustoEnergia, breakdown[i].CO2eKg = src.KWh, src.Cost, src.CO2eKg
+				}
+			}
+		}
+		var faturamento, refugo, parada, material, maoObra float64
+		for i := range breakdown {
+			b := &breakdown[i]
+			b.MargemContribuicao = b.FaturamentoBruto - b.CustoMaterial - b.PerdaRefugo - b.CustoEnergia
+			faturamento += b.FaturamentoBruto
+			refugo += b.PerdaRefugo
+			parada += b.CustoParada
+			material += b.CustoMaterial
+			maoObra += b.CustoMaoObra
+		}
+
+		res := &FinancialAggregateResult{
+			PeriodStart:      periodStart,
+			PeriodEnd:        periodEnd,
+			OKCount:          totalOK,
+			NOKCount:         totalNOK,
+			InspectionNOK:    totalInspectionNOK,
+			HoursParada:      totalHoursParada,
+			EnergiaKWh:       en.KWh,
+			ValorVendaOk:     config.ValorVendaOk,
+			CustoRefugoUn:    config.CustoRefugoUn,
+			CustoParadaH:     config.CustoParadaH,
+			CustoKwh:         config.CustoKwh,
+			FaturamentoBruto: faturamento,
+			PerdaRefugo:      refugo,
+			CustoParada:      parada,
+			CustoEnergia:     en.Cost,
+
+			CustoDemanda:        en.DemandCost,
+			DemandaPicoKW:       en.DemandPeakKW,
+			DemandaPicoEm:       en.DemandPeakAt,
+			KWhPorPeca:          en.KWhPerPiece,
+			CustoEnergiaPorPeca: en.CostPerPiece,
+			Tarifa:              en.Tariff,
+			EnergiaPostos:       en.Bands,
+			EnergiaMedidores:    meters,
+			CO2eKg:              en.CO2eKg,
+			CO2eKgPorPeca:       en.CO2eKgPerPiece,
+
+			CustoMaterial:      material,
+			CustoMaoObra:       maoObra,
+			TurnosEquivalentes: totalShifts,
+			Moeda:              costs.currency,
+			Avisos:             avisos,
+		}
+		res.fillMargins()
+		return res, breakdown
 	}
-	delta := last - first
-	if delta < 0 {
+}
+
+// readValue retorna o valor de uma leitura executada (nil = tag não mapeada → 0).
+func readValue(r *telemetryRead) float64 {
+	if r == nil {
 		return 0
 	}
-	return delta
+	return r.value
 }
 
-// metricHoursParada estima horas parada: soma intervalos onde tag_status = 0 (ou valor considerado "parado").
-func metricHoursParada(db *sql.DB, assetID uuid.UUID, metricKey string, start, end time.Time) float64 {
-	rows, err := db.Query(`
-		SELECT ts, metric_value FROM nxd.telemetry_log
-		WHERE asset_id = $1 AND metric_key = $2 AND ts >= $3 AND ts <= $4
-		ORDER BY ts ASC
-	`, assetID, metricKey, start, end)
-	if err != nil {
-		return 0
+// fillMargins deriva custos variáveis, margem de contribuição e resultado operacional.
+func (r *FinancialAggregateResult) fillMargins() {
+	r.CustosVariaveis = r.CustoMaterial + r.PerdaRefugo + r.CustoEnergia
+	r.MargemContribuicao = r.FaturamentoBruto - r.CustosVariaveis
+	r.ResultadoOperacional = r.MargemContribuicao - r.CustoMaoObra - r.CustoParada
+	r.MargemContribuicaoPct, r.MargemContribuicaoPorPeca = nil, nil
+	if r.FaturamentoBruto > 0 {
+		pct := r.MargemContribuicao / r.FaturamentoBruto * 100
+		r.MargemContribuicaoPct = &pct
 	}
-	defer rows.Close()
-	var prevTs time.Time
-	var prevParada bool
-	var sumSecs float64
-	for rows.Next() {
-		var ts time.Time
-		var val float64
-		if err := rows.Scan(&ts, &val); err != nil {
-			continue
-		}
-		parada := val < 0.5 // 0 = parado, 1 = rodando
-		if prevParada && parada {
-			sumSecs += ts.Sub(prevTs).Seconds()
-		}
-		prevTs = ts
-		prevParada = parada
+	if r.OKCount > 0 {
+		per := r.MargemContribuicao / r.OKCount
+		r.MargemContribuicaoPorPeca = &per
 	}
-	return sumSecs / 3600
 }
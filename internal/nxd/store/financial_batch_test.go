@@ -0,0 +1,486 @@
+package store
+
+import (
+	"database/sql"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Fixture: horas contadas a partir de 2024-03-01 13:30 UTC, para que h(10.5) caia
+// na virada do dia (vigência de preço do ativo A em 2024-03-02).
+var batchBase = time.Date(2024, 3, 1, 13, 30, 0, 0, time.UTC)
+
+func h(x float64) time.Time { return batchBase.Add(time.Duration(x * float64(time.Hour))) }
+
+type batchFixture struct {
+	a, b, meterAsset uuid.UUID
+	series           map[seriesKey][]telemetrySample
+	configs          map[seriesKey]CounterConfigRow
+}
+
+func newBatchFixture() *batchFixture {
+	f := &batchFixture{a: uuid.New(), b: uuid.New(), meterAsset: uuid.New(),
+		series: map[seriesKey][]telemetrySample{}, configs: map[seriesKey]CounterConfigRow{}}
+	set := func(asset uuid.UUID, metric string, pts ...float64) {
+		var s []telemetrySample
+		for i := 0; i < len(pts); i += 2 {
+			s = append(s, telemetrySample{ts: h(pts[i]), v: pts[i+1]})
+		}
+		f.series[seriesKey{asset, metric}] = s
+	}
+	// A: contador com rollover em 1000 e tolerância 2 (volta, ruído e reset).
+	set(f.a, "ok", 7.5, 990, 9, 995, 10, 5, 11, 3, 12, 20, 13, 4, 15, 30)
+	set(f.a, "nok", 7.5, 0, 9, 1, 11, 3, 14, 5)
+	set(f.a, "st", 8, 1, 9, 0, 9.5, 0, 10, 0, 11, 1, 13, 0, 14, 0, 16, 0)
+	set(f.a, "kwh", 7.9, 100, 10, 110, 12, 130, 15, 160)
+	// B: reading_rule "absolute" (último valor).
+	set(f.b, "ok", 8, 50, 11.5, 70, 13, 10)
+	// Medidor geral.
+	set(f.meterAsset, "kwh_geral", 8, 0, 12, 40, 16, 80)
+	rollover := 1000.0
+	f.configs[seriesKey{f.a, "ok"}] = CounterConfigRow{AssetID: f.a, MetricKey: "ok", RolloverAt: &rollover, ResetTolerance: 2}
+	return f
+}
+
+// serve faz o papel de telemetryBatch.run com a série inteira de cada chave.
+func (f *batchFixture) serve(b *telemetryBatch) {
+	for _, k := range b.order {
+		cfg, ok := f.configs[k]
+		if !ok {
+			cfg = CounterConfigRow{AssetID: k.asset, MetricKey: k.metric}
+		}
+		b.serve(k, f.series[k], cfg)
+	}
+}
+
+// refCounterInc é a regra do cabeçalho de counters.go escrita de novo, sem
+// counterAccum: acréscimo de ref até cur e a referência seguinte.
+func refCounterInc(cfg CounterConfigRow, ref, cur float64) (inc, next float64) {
+	switch drop := ref - cur; {
+	case drop <= 0:
+		return cur - ref, cur
+	case drop <= cfg.ResetTolerance:
+		return 0, ref // ruído: a referência fica no valor mais alto
+	case cfg.RolloverAt != nil && drop > *cfg.RolloverAt/2:
+		return *cfg.RolloverAt - ref + cur, cur
+	default:
+		return cur, cur
+	}
+}
+
+// refCounter soma o acréscimo das leituras (a primeira é só referência).
+func refCounter(cfg CounterConfigRow, rows []telemetrySample, fn func(prevTs, ts time.Time, inc float64)) float64 {
+	var total, ref float64
+	for i, s := range rows {
+		if i > 0 {
+			var inc float64
+			inc, ref = refCounterInc(cfg, ref, s.v)
+			if fn != nil {
+				fn(rows[i-1].ts, s.ts, inc)
+			}
+			total += inc
+		} else {
+			ref = s.v
+		}
+	}
+	return total
+}
+
+// Referências com os filtros das antigas consultas por ativo (contador, último valor e horas parada).
+func legacyCounter(samples []telemetrySample, cfg CounterConfigRow, start, end time.Time, fn func(prevTs, ts time.Time, inc float64)) float64 {
+	var rows []telemetrySample
+	for _, s := range samples {
+		if !s.ts.After(start) && !s.ts.Before(start.Add(-counterLookback)) {
+			rows = []telemetrySample{s}
+		}
+	}
+	for _, s := range samples {
+		if s.ts.After(start) && !s.ts.After(end) {
+			rows = append(rows, s)
+		}
+	}
+	return refCounter(cfg, rows, fn)
+}
+
+// handCounterCases — OK do ativo A (rollover 1000, tolerância 2) calculado à mão:
+// 7.5→990, 9→995, 10→5, 11→3, 12→20, 13→4, 15→30.
+var handCounterCases = []struct {
+	start, end float64
+	want       float64
+	why        string
+}{
+	{8, 12, 30, "990→995 +5, volta 995→5 +10, ruído 5→3 0, 5→20 +15"},
+	{9.5, 11.5, 10, "referência 995 (h9); volta +10; ruído 0"},
+	{10.5, 13, 19, "referência 5 (h10); ruído 0; +15; reset 20→4 +4"},
+	{12, 16, 30, "referência 20 (h12); reset +4; +26"},
+	{13.5, 15.5, 26, "referência 4 (h13); +26"},
+	{14.5, 16, 0, "sem referência no lookback: 30 é só referência"},
+}
+
+func TestCounterReadsHandComputed(t *testing.T) {
+	f := newBatchFixture()
+	b := newTelemetryBatch()
+	reads := make([]*telemetryRead, len(handCounterCases))
+	for i, c := range handCounterCases {
+		reads[i] = b.delta(f.a, "ok", "delta", h(c.start), h(c.end))
+	}
+	f.serve(b)
+	cfg := f.configs[seriesKey{f.a, "ok"}]
+	for i, c := range handCounterCases {
+		if reads[i].value != c.want {
+			t.Errorf("[%v, %v] lote = %v, want %v (%s)", c.start, c.end, reads[i].value, c.want, c.why)
+		}
+		if got := legacyCounter(f.series[seriesKey{f.a, "ok"}], cfg, h(c.start), h(c.end), nil); got != c.want {
+			t.Errorf("[%v, %v] referência = %v, want %v (%s)", c.start, c.end, got, c.want, c.why)
+		}
+	}
+}
+
+func legacyLast(samples []telemetrySample, start, end time.Time) float64 {
+	var last float64
+	for _, s := range samples {
+		if !s.ts.Before(start) && !s.ts.After(end) {
+			last = s.v
+		}
+	}
+	return last
+}
+
+func legacyParada(samples []telemetrySample, start, end time.Time, excluded []timeRange) float64 {
+	var prevTs time.Time
+	var prevParada bool
+	var sumSecs float64
+	for _, s := range samples {
+		if s.ts.Before(start) || s.ts.After(end) {
+			continue
+		}
+		parada := s.v < 0.5
+		if prevParada && parada {
+			sumSecs += s.ts.Sub(prevTs).Seconds() - overlapSeconds(excluded, prevTs, s.ts)
+		}
+		prevTs = s.ts
+		prevParada = parada
+	}
+	return sumSecs / 3600
+}
+
+type counterStep struct {
+	prevTs, ts time.Time
+	inc        float64
+}
+
+func TestTelemetryBatchMatchesPerAssetReads(t *testing.T) {
+	f := newBatchFixture()
+	excluded := []timeRange{{Start: h(9.25), End: h(9.75)}, {Start: h(13.5), End: h(20)}}
+	type check struct {
+		key        seriesKey
+		start, end time.Time
+		counter    *telemetryRead
+		last       *telemetryRead
+		parada     *telemetryRead
+		steps      *[]counterStep
+	}
+	b := newTelemetryBatch()
+	var checks []check
+	// Janelas de 15 em 15 min, várias durações: sobrepostas, adjacentes, sem leitura,
+	// com e sem referência dentro do counterLookback.
+	for x := 5.0; x <= 16; x += 0.25 {
+		for _, d := range []float64{0, 0.5, 1, 2.5, 6} {
+			for k := range f.series {
+				start, end := h(x), h(x+d)
+				steps := &[]counterStep{}
+				checks = append(checks, check{key: k, start: start, end: end, steps: steps,
+					counter: b.counter(k.asset, k.metric, start, end, func(prevTs, ts time.Time, inc float64) {
+						*steps = append(*steps, counterStep{prevTs, ts, inc})
+					}),
+					last:   b.delta(k.asset, k.metric, "absolute", start, end),
+					parada: b.hoursParada(k.asset, k.metric, start, end, excluded),
+				})
+			}
+		}
+	}
+	missing := b.counter(uuid.New(), "ok", h(8), h(12), nil)
+	f.serve(b)
+
+	for _, c := range checks {
+		cfg, ok := f.configs[c.key]
+		if !ok {
+			cfg = CounterConfigRow{}
+		}
+		var steps []counterStep
+		want := legacyCounter(f.series[c.key], cfg, c.start, c.end, func(prevTs, ts time.Time, inc float64) {
+			steps = append(steps, counterStep{prevTs, ts, inc})
+		})
+		if c.counter.value != want || c.counter.counter.Increase != want {
+			t.Errorf("%s [%v, %v] counter = %v, want %v", c.key.metric, c.start, c.end, c.counter.value, want)
+		}
+		if len(steps) != len(*c.steps) || (len(steps) > 0 && !reflect.DeepEqual(steps, *c.steps)) {
+			t.Errorf("%s [%v, %v] steps = %v, want %v", c.key.metric, c.start, c.end, *c.steps, steps)
+		}
+		if want := legacyLast(f.series[c.key], c.start, c.end); c.last.value != want {
+			t.Errorf("%s [%v, %v] last = %v, want %v", c.key.metric, c.start, c.end, c.last.value, want)
+		}
+		if want := legacyParada(f.series[c.key], c.start, c.end, excluded); c.parada.value != want {
+			t.Errorf("%s [%v, %v] parada = %v, want %v", c.key.metric, c.start, c.end, c.parada.value, want)
+		}
+	}
+	if missing.value != 0 || missing.counter == nil {
+		t.Errorf("série sem leituras = %+v", missing)
+	}
+	// Janela do lote: do menor início menos o lookback ao maior fim.
+	if !b.from.Equal(h(5).Add(-counterLookback)) || !b.to.Equal(h(22)) {
+		t.Errorf("batch range = %v .. %v", b.from, b.to)
+	}
+}
+
+// TestTelemetryBatchWindows: períodos distantes não puxam o intervalo entre eles e
+// nenhuma consulta passa de telemetryBatchWindow; leituras adjacentes dividem a janela.
+func TestTelemetryBatchWindows(t *testing.T) {
+	b := newTelemetryBatch()
+	asset := uuid.New()
+	far := func(days float64) time.Time { return h(24 * (60 + days)) }
+	b.delta(asset, "ok", "absolute", h(0), h(2))
+	b.delta(asset, "ok", "absolute", h(2), h(4))
+	b.hoursParada(asset, "st", far(0), far(20), nil)
+	b.counter(asset, "ok", h(10), h(12), nil)
+	want := []timeRange{
+		{h(0), h(4).Add(time.Microsecond)},
+		{h(10).Add(-counterLookback), h(12).Add(time.Microsecond)},
+		{far(0), far(7)},
+		{far(7), far(14)},
+		{far(14), far(20).Add(time.Microsecond)},
+	}
+	if w := b.windows(); !reflect.DeepEqual(w, want) {
+		t.Errorf("windows = %v\nwant %v", w, want)
+	}
+}
+
+func TestFinancialAggregatesGolden(t *testing.T) {
+	f := newBatchFixture()
+	v := func(x float64) *float64 { return &x }
+	config := &BusinessConfigRow{ValorVendaOk: 10, CustoRefugoUn: 2, CustoParadaH: 100, CustoKwh: 0.5,
+		CustoMaterialUn: 1, CustoMaoObraTurno: 80}
+	assets := []financialAsset{
+		{id: f.a, name: "Linha A", mapping: TagMappingRow{AssetID: f.a, TagOK: "ok", TagNOK: "nok", TagStatus: "st", TagEnergy: "kwh", ReadingRule: "delta"}},
+		{id: f.b, name: "Linha B", mapping: TagMappingRow{AssetID: f.b, TagOK: "ok", ReadingRule: "absolute"}},
+	}
+	energy := &energyScope{meters: []EnergyMeterRow{{ID: uuid.New(), Name: "Geral", AssetID: f.meterAsset, MetricKey: "kwh_geral", Active: true}}}
+	cal := &ProductionCalendar{Location: time.UTC}
+	newCosts := func() *costModel {
+		return newCostModel("BRL", []CostParameterRow{{AssetID: &f.a, ValidFrom: "2024-03-02", ValorVendaOk: v(12)}}, nil, time.UTC)
+	}
+	periods := []FinancialPeriod{{h(8), h(12)}, {h(12), h(16)}, {h(6), h(16)}} // adjacentes + sobreposto
+
+	// Um lote para os três períodos.
+	b := newTelemetryBatch()
+	costs := newCosts()
+	var finish []func() (*FinancialAggregateResult, []AssetFinancialRow)
+	for _, p := range periods {
+		finish = append(finish, planFinancials(b, config, costs, assets, cal, energy, p.Start, p.End))
+	}
+	f.serve(b)
+
+	type golden struct {
+		ok, nok, parada, fat, refugo, custoParada, material, kwh, energia, maoObra, mc, resultado float64
+		assetOK                                                                                   [2]float64
+	}
+	want := []golden{
+		// A: 15 a 10 + 15 a 12 (rollover e ruído); NOK 1 (h11 sem referência no lookback do trecho); B: último = 70.
+		{ok: 100, nok: 1, parada: 1, fat: 1030, refugo: 2, custoParada: 100, material: 101, kwh: 70, energia: 35, maoObra: 80, mc: 892, resultado: 712, assetOK: [2]float64{30, 70}},
+		// A: +4 no reset e +26; paradas 13→14→16.
+		{ok: 40, nok: 2, parada: 3, fat: 460, refugo: 4, custoParada: 300, material: 42, kwh: 70, energia: 35, maoObra: 80, mc: 379, resultado: -1, assetOK: [2]float64{30, 10}},
+		{ok: 70, nok: 3, parada: 4, fat: 790, refugo: 6, custoParada: 400, material: 73, kwh: 140, energia: 70, maoObra: 200, mc: 641, resultado: 41, assetOK: [2]float64{60, 10}},
+	}
+	near := func(got, want float64) bool { return math.Abs(got-want) < 1e-9 }
+	for i, fin := range finish {
+		res, rows := fin()
+		g := want[i]
+		if !near(res.OKCount, g.ok) || !near(res.NOKCount, g.nok) || !near(res.HoursParada, g.parada) ||
+			!near(res.FaturamentoBruto, g.fat) || !near(res.PerdaRefugo, g.refugo) || !near(res.CustoParada, g.custoParada) ||
+			!near(res.CustoMaterial, g.material) || !near(res.EnergiaKWh, g.kwh) || !near(res.CustoEnergia, g.energia) ||
+			!near(res.CustoMaoObra, g.maoObra) || !near(res.MargemContribuicao, g.mc) || !near(res.ResultadoOperacional, g.resultado) {
+			t.Errorf("período %d = %+v", i, res)
+		}
+		if len(rows) != 2 || rows[0].AssetName != "Linha A" || !near(rows[0].OKCount, g.assetOK[0]) || !near(rows[1].OKCount, g.assetOK[1]) {
+			t.Errorf("período %d ativos = %+v", i, rows)
+		}
+		if len(res.EnergiaMedidores) != 1 || res.EnergiaMedidores[0].Name != "Geral" {
+			t.Errorf("período %d medidores = %+v", i, res.EnergiaMedidores)
+		}
+
+		// Mesmo período sozinho num lote próprio: resultado idêntico.
+		alone := newTelemetryBatch()
+		finishAlone := planFinancials(alone, config, newCosts(), assets, cal, energy, periods[i].Start, periods[i].End)
+		f.serve(alone)
+		resAlone, rowsAlone := finishAlone()
+		if !reflect.DeepEqual(res, resAlone) || !reflect.DeepEqual(rows, rowsAlone) {
+			t.Errorf("período %d: lote conjunto difere do lote próprio\n%+v\n%+v", i, res, resAlone)
+		}
+	}
+}
+
+// legacyMetricDelta é a leitura por ativo de antes do lote: último valor com
+// reading_rule "absolute", senão as duas consultas do contador (referência no
+// lookback + leituras do período) e a regra de refCounterInc.
+func legacyMetricDelta(t *testing.T, db *sql.DB, assetID uuid.UUID, metricKey, rule string, start, end time.Time) float64 {
+	t.Helper()
+	if rule == "absolute" {
+		var last float64
+		err := db.QueryRow(`
+			SELECT metric_value FROM nxd.telemetry_log
+			WHERE asset_id = $1 AND metric_key = $2 AND ts >= $3 AND ts <= $4
+			ORDER BY ts DESC LIMIT 1
+		`, assetID, metricKey, start, end).Scan(&last)
+		if err == sql.ErrNoRows {
+			return 0
+		}
+		if err != nil {
+			t.Fatalf("último valor: %v", err)
+		}
+		return last
+	}
+	cfg := CounterConfigRow{}
+	var rollover sql.NullFloat64
+	err := db.QueryRow(`SELECT rollover_at, reset_tolerance FROM nxd.counter_config WHERE asset_id = $1 AND metric_key = $2`,
+		assetID, metricKey).Scan(&rollover, &cfg.ResetTolerance)
+	if err != nil && err != sql.ErrNoRows {
+		t.Fatalf("counter_config: %v", err)
+	}
+	if rollover.Valid {
+		cfg.RolloverAt = &rollover.Float64
+	}
+	rows, err := db.Query(`
+		(SELECT ts, metric_value FROM nxd.telemetry_log
+		 WHERE asset_id = $1 AND metric_key = $2 AND ts <= $3 AND ts >= $5
+		 ORDER BY ts DESC LIMIT 1)
+		UNION ALL
+		(SELECT ts, metric_value FROM nxd.telemetry_log
+		 WHERE asset_id = $1 AND metric_key = $2 AND ts > $3 AND ts <= $4)
+		ORDER BY ts
+	`, assetID, metricKey, start, end, start.Add(-counterLookback))
+	if err != nil {
+		t.Fatalf("contador: %v", err)
+	}
+	defer rows.Close()
+	var samples []telemetrySample
+	for rows.Next() {
+		var s telemetrySample
+		if err := rows.Scan(&s.ts, &s.v); err != nil {
+			t.Fatalf("contador: %v", err)
+		}
+		samples = append(samples, s)
+	}
+	return refCounter(cfg, samples, nil)
+}
+
+// legacyMetricHoursParada é metricHoursParada de antes do lote, com a consulta por ativo.
+func legacyMetricHoursParada(db *sql.DB, assetID uuid.UUID, metricKey string, start, end time.Time, excluded []timeRange) float64 {
+	rows, err := db.Query(`
+		SELECT ts, metric_value FROM nxd.telemetry_log
+		WHERE asset_id = $1 AND metric_key = $2 AND ts >= $3 AND ts <= $4
+		ORDER BY ts ASC
+	`, assetID, metricKey, start, end)
+	if err != nil {
+		return 0
+	}
+	defer rows.Close()
+	var prevTs time.Time
+	var prevParada bool
+	var sumSecs float64
+	for rows.Next() {
+		var ts time.Time
+		var val float64
+		if err := rows.Scan(&ts, &val); err != nil {
+			continue
+		}
+		parada := val < 0.5
+		if prevParada && parada {
+			sumSecs += ts.Sub(prevTs).Seconds() - overlapSeconds(excluded, prevTs, ts)
+		}
+		prevTs = ts
+		prevParada = parada
+	}
+	return sumSecs / 3600
+}
+
+// TestFinancialAggregatesMatchPerAssetQueriesDB grava o fixture no Postgres e compara
+// ComputeFinancialAggregates com as consultas por ativo de antes (legacyMetricDelta e
+// legacyMetricHoursParada) nos mesmos períodos, e o OK do ativo A com os valores
+// calculados à mão (handCounterCases). Requer TEST_DATABASE_URL.
+func TestFinancialAggregatesMatchPerAssetQueriesDB(t *testing.T) {
+	db := openTestDB(t)
+	defer db.Close()
+	f := newBatchFixture()
+	factoryID := uuid.New()
+	exec := func(q string, args ...interface{}) {
+		t.Helper()
+		if _, err := db.Exec(q, args...); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+	exec(`INSERT INTO nxd.factories (id, name) VALUES ($1, $2)`, factoryID, "TestFinancialBatch-"+factoryID.String())
+	t.Cleanup(func() { db.Exec(`DELETE FROM nxd.factories WHERE id = $1`, factoryID) })
+	rules := map[uuid.UUID]string{f.a: "delta", f.b: "absolute"}
+	for _, id := range []uuid.UUID{f.a, f.b, f.meterAsset} {
+		exec(`INSERT INTO nxd.assets (id, factory_id, source_tag_id, display_name) VALUES ($1, $2, $3, $3)`,
+			id, factoryID, "TAG-"+id.String()[:8])
+	}
+	exec(`INSERT INTO nxd.tag_mapping (asset_id, tag_ok, tag_nok, tag_status, reading_rule) VALUES ($1, 'ok', 'nok', 'st', 'delta')`, f.a)
+	exec(`INSERT INTO nxd.tag_mapping (asset_id, tag_ok, reading_rule) VALUES ($1, 'ok', 'absolute')`, f.b)
+	exec(`INSERT INTO nxd.business_config (factory_id, valor_venda_ok, custo_refugo_un, custo_parada_h) VALUES ($1, 10, 2, 100)`, factoryID)
+	exec(`INSERT INTO nxd.counter_config (asset_id, metric_key, factory_id, rollover_at, reset_tolerance) VALUES ($1, 'ok', $2, 1000, 2)`,
+		f.a, factoryID)
+	for k, samples := range f.series {
+		for _, s := range samples {
+			exec(`INSERT INTO nxd.telemetry_log (ts, factory_id, asset_id, metric_key, metric_value) VALUES ($1, $2, $3, $4, $5)`,
+				s.ts, factoryID, k.asset, k.metric, s.v)
+		}
+	}
+
+	var periods []FinancialPeriod
+	for x := 5.0; x <= 16; x += 0.5 {
+		for _, d := range []float64{0.5, 2.5, 6} {
+			periods = append(periods, FinancialPeriod{Start: h(x), End: h(x + d)})
+		}
+	}
+	hand := len(periods)
+	for _, c := range handCounterCases {
+		periods = append(periods, FinancialPeriod{Start: h(c.start), End: h(c.end)})
+	}
+	_, breakdowns, err := ComputeFinancialAggregates(db, factoryID, nil, periods)
+	if err != nil {
+		t.Fatalf("ComputeFinancialAggregates: %v", err)
+	}
+	cal, err := LoadProductionCalendar(db, factoryID, h(5), h(22))
+	if err != nil {
+		t.Fatalf("LoadProductionCalendar: %v", err)
+	}
+	near := func(got, want float64) bool { return math.Abs(got-want) < 1e-9 }
+	for i, p := range periods {
+		for _, row := range breakdowns[i] {
+			rule := rules[row.AssetID]
+			ok := legacyMetricDelta(t, db, row.AssetID, "ok", rule, p.Start, p.End)
+			var nok, parada float64
+			if row.AssetID == f.a {
+				if i >= hand {
+					if c := handCounterCases[i-hand]; row.OKCount != c.want {
+						t.Errorf("[%v, %v] OK = %v, want %v (%s)", c.start, c.end, row.OKCount, c.want, c.why)
+					}
+				}
+				nok = legacyMetricDelta(t, db, row.AssetID, "nok", rule, p.Start, p.End)
+				parada = legacyMetricHoursParada(db, row.AssetID, "st", p.Start, p.End, cal.Unscheduled(nil, p.Start, p.End))
+			}
+			if !near(row.OKCount, ok) || !near(row.NOKCount, nok) || !near(row.HoursParada, parada) {
+				t.Errorf("[%v, %v] %s: lote = %v/%v/%v, por ativo = %v/%v/%v", p.Start, p.End, rule,
+					row.OKCount, row.NOKCount, row.HoursParada, ok, nok, parada)
+			}
+		}
+		if len(breakdowns[i]) != 2 {
+			t.Errorf("[%v, %v] ativos = %+v", p.Start, p.End, breakdowns[i])
+		}
+	}
+}
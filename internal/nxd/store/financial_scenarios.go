@@ -0,0 +1,513 @@
+package store
+
+// financial_scenarios.go — Simulador what-if financeiro
+//
+// Parte de um período base (ComputeFinancialAggregate, por ativo) e projeta o
+// resultado com alavancas parametrizadas:
+//   downtime_reduction_pct   % das horas parada recuperadas; o tempo recuperado
+//                            produz no ritmo médio do ativo (peças ÷ horas rodando)
+//   scrap_reduction_pct      % do refugo que vira peça boa (mesma produção total)
+//   cycle_time_reduction_pct % a menos no tempo de ciclo: produção ÷ (1 − r)
+//   price_change_pct         reajuste do preço de venda (negativo = desconto)
+// Os valores unitários (preço, refugo, material e energia por peça) são os médios
+// do ativo na base; mão de obra, demanda e medidores de setor/fábrica ficam fixos.
+// O impacto é a variação do resultado operacional, projetada para 30 e 365 dias
+// proporcionalmente à duração da base. Cada alavanca também é simulada sozinha;
+// como elas interagem, a soma por alavanca difere do total combinado.
+//
+// Cenários salvos guardam parâmetros e resultado (nxd.financial_scenarios) para
+// comparação posterior sem recalcular a base.
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ScenarioMaxBaseline limita o período base a um ano.
+const ScenarioMaxBaseline = 366 * 24 * time.Hour
+
+const (
+	scenarioMonthHours = 30 * 24
+	scenarioYearHours  = 365 * 24
+	// scenarioMaxCycleReduction — acima disso a projeção (produção ÷ (1 − r)) deixa de ser plausível.
+	scenarioMaxCycleReduction = 90
+)
+
+var (
+	// ErrInvalidScenario — alavancas, período base ou ativos inválidos.
+	ErrInvalidScenario = errors.New("cenário inválido")
+	// ErrScenarioConflict — já existe cenário salvo com o mesmo nome na fábrica.
+	ErrScenarioConflict = errors.New("já existe um cenário com este nome")
+)
+
+// ScenarioParams — alavancas do cenário, em % (20 = 20%).
+type ScenarioParams struct {
+	DowntimeReductionPct  float64     `json:"downtime_reduction_pct"`
+	ScrapReductionPct     float64     `json:"scrap_reduction_pct"`
+	CycleTimeReductionPct float64     `json:"cycle_time_reduction_pct"`
+	PriceChangePct        float64     `json:"price_change_pct"`
+	AssetIDs              []uuid.UUID `json:"asset_ids,omitempty"` // ativos afetados; vazio = todos do escopo
+}
+
+// ScenarioFigures — números de um período (base ou projetado).
+type ScenarioFigures struct {
+	OKCount              float64 `json:"ok_count"`
+	NOKCount             float64 `json:"nok_count"`
+	HoursParada          float64 `json:"hours_parada"`
+	FaturamentoBruto     float64 `json:"faturamento_bruto"`
+	PerdaRefugo          float64 `json:"perda_refugo"`
+	CustoParada          float64 `json:"custo_parada"`
+	CustoMaterial        float64 `json:"custo_material"`
+	CustoEnergia         float64 `json:"custo_energia"`
+	CustoMaoObra         float64 `json:"custo_mao_obra"`
+	MargemContribuicao   float64 `json:"margem_contribuicao"`
+	ResultadoOperacional float64 `json:"resultado_operacional"`
+}
+
+// ScenarioAssetImpact — base e projeção de um ativo.
+type ScenarioAssetImpact struct {
+	AssetID      uuid.UUID       `json:"asset_id"`
+	AssetName    string          `json:"asset_name"`
+	Affected     bool            `json:"affected"`
+	Baseline     ScenarioFigures `json:"baseline"`
+	Projected    ScenarioFigures `json:"projected"`
+	DeltaPeriodo float64         `json:"delta_periodo"`
+	DeltaMensal  float64         `json:"delta_mensal"`
+	DeltaAnual   float64         `json:"delta_anual"`
+}
+
+// ScenarioLever — impacto de uma alavanca aplicada sozinha.
+type ScenarioLever struct {
+	Lever        string  `json:"lever"` // downtime | scrap | cycle_time | price
+	Pct          float64 `json:"pct"`
+	DeltaPeriodo float64 `json:"delta_periodo"`
+	DeltaMensal  float64 `json:"delta_mensal"`
+	DeltaAnual   float64 `json:"delta_anual"`
+}
+
+// ScenarioResult — resultado da simulação. Deltas = variação do resultado operacional.
+type ScenarioResult struct {
+	BaselineStart time.Time             `json:"baseline_start"`
+	BaselineEnd   time.Time             `json:"baseline_end"`
+	SectorID      *uuid.UUID            `json:"sector_id,omitempty"`
+	SectorName    string                `json:"sector_name,omitempty"`
+	Moeda         string                `json:"moeda"`
+	Params        ScenarioParams        `json:"params"`
+	Baseline      ScenarioFigures       `json:"baseline"`
+	Projected     ScenarioFigures       `json:"projected"`
+	DeltaPeriodo  float64               `json:"delta_periodo"`
+	DeltaMensal   float64               `json:"delta_mensal"`
+	DeltaAnual    float64               `json:"delta_anual"`
+	Levers        []ScenarioLever       `json:"levers"`
+	Assets        []ScenarioAssetImpact `json:"assets,omitempty"`
+	Premissas     []string              `json:"premissas"`
+	Avisos        []string              `json:"avisos,omitempty"`
+}
+
+func (p *ScenarioParams) validate() error {
+	for _, l := range []struct {
+		name   string
+		v, max float64
+	}{
+		{"downtime_reduction_pct", p.DowntimeReductionPct, 100},
+		{"scrap_reduction_pct", p.ScrapReductionPct, 100},
+		{"cycle_time_reduction_pct", p.CycleTimeReductionPct, scenarioMaxCycleReduction},
+	} {
+		if math.IsNaN(l.v) || l.v < 0 || l.v > l.max {
+			return fmt.Errorf("%w: %s deve estar entre 0 e %g", ErrInvalidScenario, l.name, l.max)
+		}
+	}
+	if math.IsNaN(p.PriceChangePct) || p.PriceChangePct <= -100 || p.PriceChangePct > 1000 {
+		return fmt.Errorf("%w: price_change_pct deve estar entre -100 (exclusivo) e 1000", ErrInvalidScenario)
+	}
+	if p.DowntimeReductionPct == 0 && p.ScrapReductionPct == 0 && p.CycleTimeReductionPct == 0 && p.PriceChangePct == 0 {
+		return fmt.Errorf("%w: informe ao menos uma alavanca", ErrInvalidScenario)
+	}
+	return nil
+}
+
+func (f *ScenarioFigures) fillResult() {
+	f.MargemContribuicao = f.FaturamentoBruto - f.CustoMaterial - f.PerdaRefugo - f.CustoEnergia
+	f.ResultadoOperacional = f.MargemContribuicao - f.CustoMaoObra - f.CustoParada
+}
+
+// addDelta soma em f a diferença proj − base (campo a campo).
+func (f *ScenarioFigures) addDelta(proj, base ScenarioFigures) {
+	f.OKCount += proj.OKCount - base.OKCount
+	f.NOKCount += proj.NOKCount - base.NOKCount
+	f.HoursParada += proj.HoursParada - base.HoursParada
+	f.FaturamentoBruto += proj.FaturamentoBruto - base.FaturamentoBruto
+	f.PerdaRefugo += proj.PerdaRefugo - base.PerdaRefugo
+	f.CustoParada += proj.CustoParada - base.CustoParada
+	f.CustoMaterial += proj.CustoMaterial - base.CustoMaterial
+	f.CustoEnergia += proj.CustoEnergia - base.CustoEnergia
+	f.CustoMaoObra += proj.CustoMaoObra - base.CustoMaoObra
+}
+
+func aggregateFigures(r *FinancialAggregateResult) ScenarioFigures {
+	f := ScenarioFigures{OKCount: r.OKCount, NOKCount: r.NOKCount, HoursParada: r.HoursParada,
+		FaturamentoBruto: r.FaturamentoBruto, PerdaRefugo: r.PerdaRefugo, CustoParada: r.CustoParada,
+		CustoMaterial: r.CustoMaterial, CustoEnergia: r.CustoEnergia, CustoMaoObra: r.CustoMaoObra}
+	f.fillResult()
+	return f
+}
+
+func assetFigures(a AssetFinancialRow) ScenarioFigures {
+	f := ScenarioFigures{OKCount: a.OKCount, NOKCount: a.NOKCount, HoursParada: a.HoursParada,
+		FaturamentoBruto: a.FaturamentoBruto, PerdaRefugo: a.PerdaRefugo, CustoParada: a.CustoParada,
+		CustoMaterial: a.CustoMaterial, CustoEnergia: a.CustoEnergia, CustoMaoObra: a.CustoMaoObra}
+	f.fillResult()
+	return f
+}
+
+// projectAsset aplica as alavancas ao ativo. fallbackPrice vale quando a base não teve peça boa.
+func projectAsset(a AssetFinancialRow, p ScenarioParams, fallbackPrice float64) ScenarioFigures {
+	out := assetFigures(a)
+	total := a.OKCount + a.NOKCount
+	recovered := a.HoursParada * p.DowntimeReductionPct / 100
+	var extra float64
+	if run := a.HorasProgramadas - a.HoursParada; run > 0 && total > 0 {
+		extra = recovered * total / run
+	}
+	newTotal := (total + extra) / (1 - p.CycleTimeReductionPct/100)
+	var nokFrac float64
+	if total > 0 {
+		nokFrac = a.NOKCount / total * (1 - p.ScrapReductionPct/100)
+	}
+	out.OKCount = newTotal * (1 - nokFrac)
+	out.NOKCount = newTotal * nokFrac
+	out.HoursParada = a.HoursParada - recovered
+	out.CustoParada = a.CustoParada * (1 - p.DowntimeReductionPct/100)
+
+	price := fallbackPrice
+	if a.OKCount > 0 {
+		price = a.FaturamentoBruto / a.OKCount
+	}
+	out.FaturamentoBruto = out.OKCount * price * (1 + p.PriceChangePct/100)
+	if a.NOKCount > 0 {
+		out.PerdaRefugo = out.NOKCount * a.PerdaRefugo / a.NOKCount
+	}
+	if total > 0 {
+		out.CustoMaterial = newTotal * a.CustoMaterial / total
+		out.CustoEnergia = newTotal * a.CustoEnergia / total
+	}
+	out.fillResult()
+	return out
+}
+
+// projectScenario projeta todos os ativos; o total parte da base agregada (inclui
+// medidores e demanda) mais a variação de cada ativo.
+func projectScenario(base *FinancialAggregateResult, assets []AssetFinancialRow, p ScenarioParams) (ScenarioFigures, []ScenarioAssetImpact) {
+	affected := map[uuid.UUID]bool{}
+	for _, id := range p.AssetIDs {
+		affected[id] = true
+	}
+	total := aggregateFigures(base)
+	impacts := make([]ScenarioAssetImpact, 0, len(assets))
+	for _, a := range assets {
+		imp := ScenarioAssetImpact{AssetID: a.AssetID, AssetName: a.AssetName, Baseline: assetFigures(a)}
+		imp.Affected = len(affected) == 0 || affected[a.AssetID]
+		imp.Projected = imp.Baseline
+		if imp.Affected {
+			imp.Projected = projectAsset(a, p, base.ValorVendaOk)
+		}
+		imp.DeltaPeriodo = imp.Projected.ResultadoOperacional - imp.Baseline.ResultadoOperacional
+		total.addDelta(imp.Projected, imp.Baseline)
+		impacts = append(impacts, imp)
+	}
+	total.fillResult()
+	return total, impacts
+}
+
+// simulateScenario calcula o cenário sobre a base já agregada.
+func simulateScenario(base *FinancialAggregateResult, assets []AssetFinancialRow, p ScenarioParams) *ScenarioResult {
+	res := &ScenarioResult{BaselineStart: base.PeriodStart, BaselineEnd: base.PeriodEnd, SectorID: base.SectorID,
+		SectorName: base.SectorName, Moeda: base.Moeda, Params: p, Baseline: aggregateFigures(base)}
+	hours := base.PeriodEnd.Sub(base.PeriodStart).Hours()
+	scale := func(delta float64) (float64, float64) {
+		if hours <= 0 {
+			return 0, 0
+		}
+		return delta * scenarioMonthHours / hours, delta * scenarioYearHours / hours
+	}
+
+	res.Projected, res.Assets = projectScenario(base, assets, p)
+	res.DeltaPeriodo = res.Projected.ResultadoOperacional - res.Baseline.ResultadoOperacional
+	res.DeltaMensal, res.DeltaAnual = scale(res.DeltaPeriodo)
+	for i := range res.Assets {
+		res.Assets[i].DeltaMensal, res.Assets[i].DeltaAnual = scale(res.Assets[i].DeltaPeriodo)
+	}
+	sort.SliceStable(res.Assets, func(i, j int) bool { return res.Assets[i].DeltaPeriodo > res.Assets[j].DeltaPeriodo })
+
+	for _, l := range []struct {
+		name string
+		pct  float64
+		only ScenarioParams
+	}{
+		{"downtime", p.DowntimeReductionPct, ScenarioParams{DowntimeReductionPct: p.DowntimeReductionPct}},
+		{"scrap", p.ScrapReductionPct, ScenarioParams{ScrapReductionPct: p.ScrapReductionPct}},
+		{"cycle_time", p.CycleTimeReductionPct, ScenarioParams{CycleTimeReductionPct: p.CycleTimeReductionPct}},
+		{"price", p.PriceChangePct, ScenarioParams{PriceChangePct: p.PriceChangePct}},
+	} {
+		if l.pct == 0 {
+			continue
+		}
+		l.only.AssetIDs = p.AssetIDs
+		proj, _ := projectScenario(base, assets, l.only)
+		lever := ScenarioLever{Lever: l.name, Pct: l.pct, DeltaPeriodo: proj.ResultadoOperacional - res.Baseline.ResultadoOperacional}
+		lever.DeltaMensal, lever.DeltaAnual = scale(lever.DeltaPeriodo)
+		res.Levers = append(res.Levers, lever)
+	}
+
+	res.Premissas = []string{
+		"Valores unitários (preço, refugo, material e energia por peça) são os médios de cada ativo no período base.",
+		"Peças adicionais (paradas recuperadas ou ciclo menor) são vendidas ao preço médio; não há restrição de demanda.",
+		"Tempo recuperado produz no ritmo médio do ativo: peças ÷ (horas programadas − horas parada).",
+		"Mão de obra, demanda contratada e medidores de setor/fábrica não mudam.",
+		"Projeção mensal (30 dias) e anual (365 dias) proporcionais à duração da base.",
+	}
+	if len(res.Levers) > 1 {
+		res.Premissas = append(res.Premissas, "As alavancas interagem: a soma do impacto de cada uma difere do total combinado.")
+	}
+	res.Avisos = append(res.Avisos, base.Avisos...)
+	if hours > 0 && hours < 7*24 {
+		res.Avisos = append(res.Avisos, fmt.Sprintf("período base curto (%.0f h): a projeção extrapola variações de curto prazo", hours))
+	}
+	if p.DowntimeReductionPct > 0 {
+		var parada float64
+		var noRate []string
+		for _, a := range assets {
+			if len(p.AssetIDs) > 0 && !containsUUID(p.AssetIDs, a.AssetID) {
+				continue
+			}
+			parada += a.HoursParada
+			if a.HoursParada > 0 && (a.HorasProgramadas-a.HoursParada <= 0 || a.OKCount+a.NOKCount <= 0) {
+				noRate = append(noRate, a.AssetName)
+			}
+		}
+		if parada == 0 {
+			res.Avisos = append(res.Avisos, "nenhuma hora parada na base (tag de status ausente?): a redução de paradas não tem efeito")
+		}
+		if len(noRate) > 0 {
+			res.Avisos = append(res.Avisos, "sem ritmo de produção na base, a redução de paradas só reduz o custo de parada: "+strings.Join(noRate, ", "))
+		}
+	}
+	return res
+}
+
+func containsUUID(list []uuid.UUID, id uuid.UUID) bool {
+	for _, x := range list {
+		if x == id {
+			return true
+		}
+	}
+	return false
+}
+
+// ComputeFinancialScenario calcula a base do setor (nil = fábrica) em [start, end) e aplica o cenário.
+func ComputeFinancialScenario(db *sql.DB, factoryID uuid.UUID, sectorID *uuid.UUID, start, end time.Time, p ScenarioParams) (*ScenarioResult, error) {
+	if err := p.validate(); err != nil {
+		return nil, err
+	}
+	if !end.After(start) || end.Sub(start) > ScenarioMaxBaseline {
+		return nil, fmt.Errorf("%w: período base deve ter entre 1 segundo e 366 dias", ErrInvalidScenario)
+	}
+	base, assets, err := ComputeFinancialAggregate(db, factoryID, sectorID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	if base == nil {
+		return nil, fmt.Errorf("%w: configure os parâmetros financeiros (business-config) antes de simular", ErrInvalidScenario)
+	}
+	for _, id := range p.AssetIDs {
+		found := false
+		for _, a := range assets {
+			found = found || a.AssetID == id
+		}
+		if !found {
+			return nil, fmt.Errorf("%w: ativo %s fora do escopo ou sem mapeamento de tags", ErrInvalidScenario, id)
+		}
+	}
+	return simulateScenario(base, assets, p), nil
+}
+
+// ─── Cenários salvos ────────────────────────────────────────────────────────
+
+// FinancialScenarioRow — cenário salvo com o resultado calculado ao salvar.
+type FinancialScenarioRow struct {
+	ID            uuid.UUID       `json:"id"`
+	FactoryID     uuid.UUID       `json:"factory_id"`
+	SectorID      *uuid.UUID      `json:"sector_id,omitempty"`
+	Name          string          `json:"name"`
+	Description   string          `json:"description,omitempty"`
+	BaselineStart time.Time       `json:"baseline_start"`
+	BaselineEnd   time.Time       `json:"baseline_end"`
+	Params        ScenarioParams  `json:"params"`
+	Result        *ScenarioResult `json:"result"`
+	CreatedBy     *int64          `json:"created_by,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
+
+// CreateFinancialScenario salva o cenário (Result obrigatório). Nome repetido → ErrScenarioConflict.
+func CreateFinancialScenario(db *sql.DB, s FinancialScenarioRow) (uuid.UUID, error) {
+	s.Name = strings.TrimSpace(s.Name)
+	if s.Name == "" {
+		return uuid.Nil, fmt.Errorf("%w: name obrigatório", ErrInvalidScenario)
+	}
+	if s.Result == nil {
+		return uuid.Nil, fmt.Errorf("%w: resultado ausente", ErrInvalidScenario)
+	}
+	params, err := json.Marshal(s.Params)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	result, err := json.Marshal(s.Result)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	var id uuid.UUID
+	err = db.QueryRow(`
+		INSERT INTO nxd.financial_scenarios (factory_id, sector_id, name, description, baseline_start, baseline_end, params, result, created_by)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, $7, $8, $9)
+		ON CONFLICT (factory_id, name) DO NOTHING
+		RETURNING id
+	`, s.FactoryID, s.SectorID, s.Name, strings.TrimSpace(s.Description), s.BaselineStart, s.BaselineEnd, params, result, s.CreatedBy).Scan(&id)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, ErrScenarioConflict
+	}
+	return id, err
+}
+
+func scanFinancialScenario(sc interface{ Scan(...interface{}) error }) (FinancialScenarioRow, error) {
+	var s FinancialScenarioRow
+	var sectorID uuid.NullUUID
+	var createdBy sql.NullInt64
+	var params, result []byte
+	if err := sc.Scan(&s.ID, &s.FactoryID, &sectorID, &s.Name, &s.Description, &s.BaselineStart, &s.BaselineEnd,
+		&params, &result, &createdBy, &s.CreatedAt); err != nil {
+		return s, err
+	}
+	if sectorID.Valid {
+		s.SectorID = &sectorID.UUID
+	}
+	if createdBy.Valid {
+		s.CreatedBy = &createdBy.Int64
+	}
+	if err := json.Unmarshal(params, &s.Params); err != nil {
+		return s, err
+	}
+	s.Result = &ScenarioResult{}
+	return s, json.Unmarshal(result, s.Result)
+}
+
+// ListFinancialScenarios retorna os cenários da fábrica (mais recentes primeiro), sem o detalhamento por ativo.
+func ListFinancialScenarios(db *sql.DB, factoryID uuid.UUID) ([]FinancialScenarioRow, error) {
+	rows, err := db.Query(`
+		SELECT id, factory_id, sector_id, name, COALESCE(description, ''), baseline_start, baseline_end,
+			params, result - 'assets', created_by, created_at
+		FROM nxd.financial_scenarios WHERE factory_id = $1 ORDER BY created_at DESC
+	`, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []FinancialScenarioRow
+	for rows.Next() {
+		s, err := scanFinancialScenario(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+// GetFinancialScenario retorna o cenário completo (nil se não existir na fábrica).
+func GetFinancialScenario(db *sql.DB, factoryID, id uuid.UUID) (*FinancialScenarioRow, error) {
+	s, err := scanFinancialScenario(db.QueryRow(`
+		SELECT id, factory_id, sector_id, name, COALESCE(description, ''), baseline_start, baseline_end,
+			params, result, created_by, created_at
+		FROM nxd.financial_scenarios WHERE id = $1 AND factory_id = $2
+	`, id, factoryID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// DeleteFinancialScenario remove o cenário. false = não existe.
+func DeleteFinancialScenario(db *sql.DB, factoryID, id uuid.UUID) (bool, error) {
+	res, err := db.Exec(`DELETE FROM nxd.financial_scenarios WHERE id = $1 AND factory_id = $2`, id, factoryID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ScenarioComparison — linha da comparação de cenários salvos (ordem: maior impacto anual).
+type ScenarioComparison struct {
+	Rank                     int             `json:"rank"`
+	ID                       uuid.UUID       `json:"id"`
+	Name                     string          `json:"name"`
+	SectorName               string          `json:"sector_name,omitempty"`
+	BaselineStart            time.Time       `json:"baseline_start"`
+	BaselineEnd              time.Time       `json:"baseline_end"`
+	Moeda                    string          `json:"moeda"`
+	Params                   ScenarioParams  `json:"params"`
+	ResultadoMensalBase      float64         `json:"resultado_mensal_base"`
+	ResultadoMensalProjetado float64         `json:"resultado_mensal_projetado"`
+	DeltaMensal              float64         `json:"delta_mensal"`
+	DeltaAnual               float64         `json:"delta_anual"`
+	Levers                   []ScenarioLever `json:"levers"`
+}
+
+// CompareFinancialScenarios ordena os cenários pelo impacto anual e avisa quando
+// as bases (escopo, período ou moeda) diferem.
+func CompareFinancialScenarios(list []FinancialScenarioRow) ([]ScenarioComparison, []string) {
+	out := make([]ScenarioComparison, 0, len(list))
+	bases, currencies := map[string]bool{}, map[string]bool{}
+	for _, s := range list {
+		r := s.Result
+		if r == nil {
+			continue
+		}
+		c := ScenarioComparison{ID: s.ID, Name: s.Name, SectorName: r.SectorName, BaselineStart: r.BaselineStart,
+			BaselineEnd: r.BaselineEnd, Moeda: r.Moeda, Params: s.Params, DeltaMensal: r.DeltaMensal, DeltaAnual: r.DeltaAnual,
+			Levers: r.Levers}
+		if h := r.BaselineEnd.Sub(r.BaselineStart).Hours(); h > 0 {
+			c.ResultadoMensalBase = r.Baseline.ResultadoOperacional * scenarioMonthHours / h
+			c.ResultadoMensalProjetado = r.Projected.ResultadoOperacional * scenarioMonthHours / h
+		}
+		sector := ""
+		if r.SectorID != nil {
+			sector = r.SectorID.String()
+		}
+		bases[fmt.Sprintf("%s|%d|%d", sector, r.BaselineStart.Unix(), r.BaselineEnd.Unix())] = true
+		currencies[r.Moeda] = true
+		out = append(out, c)
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].DeltaAnual > out[j].DeltaAnual })
+	for i := range out {
+		out[i].Rank = i + 1
+	}
+	var warnings []string
+	if len(bases) > 1 {
+		warnings = append(warnings, "os cenários usam bases diferentes (escopo ou período): compare pelo impacto mensal/anual normalizado")
+	}
+	if len(currencies) > 1 {
+		warnings = append(warnings, "os cenários estão em moedas diferentes")
+	}
+	return out, warnings
+}
@@ -0,0 +1,93 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func scenarioBase() (*FinancialAggregateResult, []AssetFinancialRow) {
+	t0 := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	// A: 100 h programadas, 20 h parada → 800 peças em 80 h (10/h), 10% refugo.
+	a := AssetFinancialRow{AssetID: uuid.New(), AssetName: "Linha 3", OKCount: 720, NOKCount: 80, HoursParada: 20,
+		HorasProgramadas: 100, FaturamentoBruto: 7200, PerdaRefugo: 160, CustoParada: 1000, CustoMaterial: 800,
+		CustoEnergia: 400, CustoMaoObra: 500}
+	b := AssetFinancialRow{AssetID: uuid.New(), AssetName: "Linha 4", OKCount: 100, HoursParada: 5, HorasProgramadas: 100,
+		FaturamentoBruto: 1000, CustoParada: 250, CustoEnergia: 50}
+	base := &FinancialAggregateResult{PeriodStart: t0, PeriodEnd: t0.AddDate(0, 0, 10), Moeda: "BRL", ValorVendaOk: 10,
+		OKCount: 820, NOKCount: 80, HoursParada: 25, FaturamentoBruto: 8200, PerdaRefugo: 160, CustoParada: 1250,
+		CustoMaterial: 800, CustoEnergia: 550, CustoMaoObra: 500} // energia: ativos + 100 de medidores
+	return base, []AssetFinancialRow{a, b}
+}
+
+func TestSimulateScenario(t *testing.T) {
+	base, assets := scenarioBase()
+	near := func(got, want float64) bool { return math.Abs(got-want) < 1e-6 }
+
+	// Só a Linha 3: paradas −50% (10 h → +100 peças) e refugo −50%.
+	p := ScenarioParams{DowntimeReductionPct: 50, ScrapReductionPct: 50, AssetIDs: []uuid.UUID{assets[0].AssetID}}
+	res := simulateScenario(base, assets, p)
+	if !near(res.DeltaPeriodo, 1770) || !near(res.DeltaMensal, 1770*3) || !near(res.DeltaAnual, 1770*36.5) {
+		t.Fatalf("delta = %v / %v / %v", res.DeltaPeriodo, res.DeltaMensal, res.DeltaAnual)
+	}
+	if !near(res.Projected.OKCount, 855+100) || !near(res.Projected.CustoEnergia, 600) || !near(res.Projected.HoursParada, 15) {
+		t.Errorf("projected = %+v", res.Projected)
+	}
+	if res.Assets[0].AssetName != "Linha 3" || !res.Assets[0].Affected || res.Assets[1].Affected || res.Assets[1].DeltaPeriodo != 0 {
+		t.Errorf("assets = %+v", res.Assets)
+	}
+	if len(res.Levers) != 2 || !near(res.Levers[0].DeltaPeriodo, 1230) || !near(res.Levers[1].DeltaPeriodo, 480) {
+		t.Errorf("levers = %+v", res.Levers)
+	}
+
+	// Ciclo −20% e preço +10% em todos os ativos (Linha 4: +25 peças, +12,5 de energia).
+	res = simulateScenario(base, assets, ScenarioParams{CycleTimeReductionPct: 20})
+	if !near(res.DeltaPeriodo, 1460+250-12.5) {
+		t.Errorf("cycle = %v", res.DeltaPeriodo)
+	}
+	res = simulateScenario(base, assets, ScenarioParams{PriceChangePct: 10})
+	if !near(res.DeltaPeriodo, 820) || len(res.Avisos) != 0 {
+		t.Errorf("price = %v (%v)", res.DeltaPeriodo, res.Avisos)
+	}
+}
+
+func TestScenarioParamsValidate(t *testing.T) {
+	for _, p := range []ScenarioParams{
+		{},
+		{DowntimeReductionPct: -1},
+		{ScrapReductionPct: 101},
+		{CycleTimeReductionPct: 95},
+		{PriceChangePct: -100},
+	} {
+		if err := p.validate(); !errors.Is(err, ErrInvalidScenario) {
+			t.Errorf("%+v: err = %v", p, err)
+		}
+	}
+	if err := (&ScenarioParams{PriceChangePct: -5}).validate(); err != nil {
+		t.Errorf("desconto: %v", err)
+	}
+}
+
+func TestCompareFinancialScenarios(t *testing.T) {
+	base, assets := scenarioBase()
+	small := simulateScenario(base, assets, ScenarioParams{PriceChangePct: 1})
+	big := simulateScenario(base, assets, ScenarioParams{DowntimeReductionPct: 20})
+	list, warnings := CompareFinancialScenarios([]FinancialScenarioRow{
+		{Name: "Preço +1%", Params: small.Params, Result: small},
+		{Name: "Paradas −20%", Params: big.Params, Result: big},
+	})
+	if len(list) != 2 || list[0].Name != "Paradas −20%" || list[0].Rank != 1 || len(warnings) != 0 {
+		t.Fatalf("compare = %+v / %v", list, warnings)
+	}
+	if math.Abs(list[1].ResultadoMensalProjetado-list[1].ResultadoMensalBase-list[1].DeltaMensal) > 1e-6 {
+		t.Errorf("monthly = %+v", list[1])
+	}
+	other := *big
+	other.BaselineStart = other.BaselineStart.AddDate(0, 0, -1)
+	if _, warnings = CompareFinancialScenarios([]FinancialScenarioRow{{Result: small}, {Result: &other}}); len(warnings) != 1 {
+		t.Errorf("warnings = %v", warnings)
+	}
+}
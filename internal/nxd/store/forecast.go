@@ -0,0 +1,1039 @@
+package store
+
+// forecast.go — Previsão de séries (produção, energia, variáveis de processo)
+//
+// Modelo: Holt-Winters aditivo com tendência amortecida (phi = forecastPhi), um
+// por série (ativo + tag) e granularidade:
+//
+//   hour → buckets de 1 h, sazonalidade 24 (dia), treino dos últimos 28 dias
+//   day  → buckets de 1 dia no fuso da fábrica, sazonalidade 7 (semana), treino de 182 dias
+//
+// A série de treino sai de telemetry_rollup_1m, não de telemetry_log: antes de
+// treinar, as lacunas da série no intervalo de treino (nxd.rollup_ranges guarda os
+// trechos já consolidados) e a última forecastRollupLate, para leituras atrasadas,
+// são agregadas no rollup; depois do primeiro treino só a cauda nova lê o log.
+// Cada bucket é a média ponderada pelos samples dos minutos; contadores (peças,
+// kWh) viram acréscimo entre o máximo do último minuto de cada bucket
+// (alignSeries, correlation.go). O bucket em andamento não entra. Os reais dos
+// pontos (FillForecastActuals) continuam no log: janelas curtas. Lacunas são
+// preenchidas com o valor da temporada anterior (ou o último valor); acima de
+// forecastMaxImputed a série é recusada.
+//
+// alpha, beta e gamma saem de uma busca em grade que minimiza o erro quadrático
+// de um passo. Intervalos (80% e 95%) pela variância de h passos do modelo aditivo:
+//   σ²_h = σ² · (1 + Σ_{j=1}^{h−1} (α(1 + jβ) + γ·[j mod m = 0])²)
+// Contadores não ficam negativos. Com granularidade day, contadores ganham a
+// projeção do mês: realizado até ontem + previsão até o fim do mês (soma das
+// variâncias — supõe erros independentes, então o intervalo é otimista).
+//
+// Cada previsão é gravada (forecasts + forecast_points). O worker preenche o valor
+// real de cada ponto quando o bucket fecha e refaz a previsão das séries
+// acompanhadas (forecast_series) a cada bucket; ComputeForecastAccuracy mede MAE,
+// MAPE, viés e cobertura dos intervalos por antecedência.
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+const (
+	forecastWorkerInterval = 10 * time.Minute
+	forecastPhi            = 0.98
+	forecastMaxImputed     = 0.3
+	forecastMinSeasons     = 3
+	forecastHistorySeasons = 3
+	// forecastMissingAfter: ponto sem leitura até aqui depois do fim do bucket fica sem real.
+	forecastMissingAfter = 24 * time.Hour
+	forecastRetention    = 180 * 24 * time.Hour
+	forecastMaxFill      = 200
+	// forecastRollupLate: minutos já consolidados que são agregados de novo a cada treino.
+	forecastRollupLate = time.Hour
+)
+
+var (
+	ErrForecastNotFound = errors.New("previsão não encontrada")
+	// ErrInvalidForecast envolve erros de validação (granularidade, horizonte, ativo).
+	ErrInvalidForecast = errors.New("previsão inválida")
+	// ErrForecastInsufficientData — histórico curto ou com lacunas demais para treinar.
+	ErrForecastInsufficientData = errors.New("dados insuficientes para a previsão")
+)
+
+// forecastSpec — parâmetros por granularidade.
+type forecastSpec struct {
+	step       time.Duration
+	season     int
+	trainDays  int
+	defHorizon int
+	maxHorizon int
+	leadGroups [][2]int // faixas de antecedência da acurácia
+}
+
+var forecastSpecs = map[string]forecastSpec{
+	"hour": {step: time.Hour, season: 24, trainDays: 28, defHorizon: 48, maxHorizon: 168,
+		leadGroups: [][2]int{{1, 1}, {2, 6}, {7, 24}, {25, 168}}},
+	"day": {step: 24 * time.Hour, season: 7, trainDays: 182, defHorizon: 31, maxHorizon: 90,
+		leadGroups: [][2]int{{1, 1}, {2, 7}, {8, 31}, {32, 90}}},
+}
+
+// forecastGrid — valores testados na busca de alpha, beta e gamma.
+var (
+	forecastAlphas = []float64{0.05, 0.1, 0.2, 0.3, 0.5, 0.7}
+	forecastBetas  = []float64{0, 0.01, 0.05, 0.1, 0.2}
+	forecastGammas = []float64{0.05, 0.1, 0.2, 0.3, 0.5}
+)
+
+// ForecastPoint — um bucket previsto; Actual é preenchido quando o bucket fecha.
+type ForecastPoint struct {
+	TS     time.Time `json:"ts"`
+	Lead   int       `json:"lead"` // antecedência em buckets (1 = próximo)
+	Yhat   float64   `json:"yhat"`
+	Lo80   float64   `json:"lo80"`
+	Hi80   float64   `json:"hi80"`
+	Lo95   float64   `json:"lo95"`
+	Hi95   float64   `json:"hi95"`
+	Actual *float64  `json:"actual,omitempty"`
+
+	sd float64 // desvio do erro de h passos (projeção do mês)
+}
+
+// ForecastHistoryPoint — valor realizado usado no treino (para o gráfico).
+type ForecastHistoryPoint struct {
+	TS    time.Time `json:"ts"`
+	Value *float64  `json:"value"`
+}
+
+// ForecastPeriod — projeção do fim do mês (contadores, granularidade day).
+type ForecastPeriod struct {
+	End    time.Time `json:"end"`
+	Actual float64   `json:"actual"` // realizado do mês até o início da previsão
+	Total  float64   `json:"total"`
+	Lo95   float64   `json:"lo95"`
+	Hi95   float64   `json:"hi95"`
+}
+
+// ForecastRow — previsão emitida.
+type ForecastRow struct {
+	ID          uuid.UUID              `json:"id"`
+	FactoryID   uuid.UUID              `json:"factory_id"`
+	AssetID     uuid.UUID              `json:"asset_id"`
+	MetricKey   string                 `json:"metric_key"`
+	Granularity string                 `json:"granularity"`
+	SeriesID    *uuid.UUID             `json:"series_id,omitempty"`
+	Counter     bool                   `json:"counter"`
+	Season      int                    `json:"season"`
+	Alpha       float64                `json:"alpha"`
+	Beta        float64                `json:"beta"`
+	Gamma       float64                `json:"gamma"`
+	Phi         float64                `json:"phi"`
+	Sigma       float64                `json:"sigma"` // desvio do erro de um passo
+	TrainStart  time.Time              `json:"train_start"`
+	TrainEnd    time.Time              `json:"train_end"`
+	TrainPoints int                    `json:"train_points"`
+	Imputed     int                    `json:"imputed"`
+	Period      *ForecastPeriod        `json:"period,omitempty"`
+	CreatedAt   time.Time              `json:"created_at"`
+	Points      []ForecastPoint        `json:"points"`
+	History     []ForecastHistoryPoint `json:"history,omitempty"`
+}
+
+// ForecastSeriesRow — série acompanhada pelo worker.
+type ForecastSeriesRow struct {
+	ID          uuid.UUID `json:"id"`
+	AssetID     uuid.UUID `json:"asset_id"`
+	MetricKey   string    `json:"metric_key"`
+	Granularity string    `json:"granularity"`
+	Horizon     int       `json:"horizon"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ─── Modelo ─────────────────────────────────────────────────────────────────
+
+// hwModel — Holt-Winters aditivo ajustado; estado no fim do treino.
+type hwModel struct {
+	alpha, beta, gamma, phi float64
+	m                       int
+	level, trend            float64
+	season                  []float64 // índice = t mod m
+	n                       int
+	sigma                   float64
+}
+
+// hwRun roda o filtro sobre y (primeira temporada = inicialização) e retorna o
+// erro quadrático de um passo.
+func hwRun(y []float64, m int, alpha, beta, gamma, phi float64) (float64, int, hwModel) {
+	var first, second float64
+	for i := 0; i < m; i++ {
+		first += y[i]
+		second += y[m+i]
+	}
+	first, second = first/float64(m), second/float64(m)
+	st := hwModel{alpha: alpha, beta: beta, gamma: gamma, phi: phi, m: m, n: len(y), season: make([]float64, m)}
+	st.trend = (second - first) / float64(m)
+	st.level = first + st.trend*float64(m-1)/2
+	for i := 0; i < m; i++ {
+		st.season[i] = y[i] - (first + st.trend*(float64(i)-float64(m-1)/2))
+	}
+	var sse float64
+	var cnt int
+	for t := m; t < len(y); t++ {
+		s := st.season[t%m]
+		e := y[t] - (st.level + phi*st.trend + s)
+		sse += e * e
+		cnt++
+		level := alpha*(y[t]-s) + (1-alpha)*(st.level+phi*st.trend)
+		st.trend = beta*(level-st.level) + (1-beta)*phi*st.trend
+		st.season[t%m] = gamma*(y[t]-level) + (1-gamma)*s
+		st.level = level
+	}
+	return sse, cnt, st
+}
+
+// fitHoltWinters escolhe alpha/beta/gamma pela grade (menor erro de um passo).
+func fitHoltWinters(y []float64, m int) (*hwModel, error) {
+	if m < 2 || len(y) < forecastMinSeasons*m {
+		return nil, fmt.Errorf("%w: %d pontos (mínimo %d)", ErrForecastInsufficientData, len(y), forecastMinSeasons*m)
+	}
+	var best *hwModel
+	bestSSE := math.Inf(1)
+	for _, a := range forecastAlphas {
+		for _, b := range forecastBetas {
+			for _, g := range forecastGammas {
+				sse, cnt, st := hwRun(y, m, a, b, g, forecastPhi)
+				if sse < bestSSE {
+					bestSSE = sse
+					st.sigma = math.Sqrt(sse / float64(cnt))
+					model := st
+					best = &model
+				}
+			}
+		}
+	}
+	return best, nil
+}
+
+// forecast projeta h buckets com intervalos de 80% e 95%. nonNegative limita a 0.
+func (mdl *hwModel) forecast(h int, nonNegative bool) []ForecastPoint {
+	out := make([]ForecastPoint, h)
+	damp, varSum := 0.0, 0.0
+	clamp := func(v float64) float64 {
+		if nonNegative && v < 0 {
+			return 0
+		}
+		return v
+	}
+	for i := 1; i <= h; i++ {
+		damp += math.Pow(mdl.phi, float64(i))
+		if j := i - 1; j >= 1 {
+			c := mdl.alpha * (1 + float64(j)*mdl.beta)
+			if j%mdl.m == 0 {
+				c += mdl.gamma
+			}
+			varSum += c * c
+		}
+		yhat := mdl.level + damp*mdl.trend + mdl.season[(mdl.n-1+i)%mdl.m]
+		sd := mdl.sigma * math.Sqrt(1+varSum)
+		out[i-1] = ForecastPoint{Lead: i, Yhat: clamp(yhat), sd: sd,
+			Lo80: clamp(yhat - 1.2816*sd), Hi80: clamp(yhat + 1.2816*sd),
+			Lo95: clamp(yhat - 1.96*sd), Hi95: clamp(yhat + 1.96*sd)}
+	}
+	return out
+}
+
+// prepareForecastSeries descarta os buckets vazios iniciais e preenche as lacunas
+// (temporada anterior, senão último valor). Retorna a série, o deslocamento do
+// primeiro bucket usado e quantos foram preenchidos.
+func prepareForecastSeries(values []*float64, m int) ([]float64, int, int, error) {
+	offset := 0
+	for offset < len(values) && values[offset] == nil {
+		offset++
+	}
+	values = values[offset:]
+	if len(values) < forecastMinSeasons*m {
+		return nil, 0, 0, fmt.Errorf("%w: %d buckets com histórico (mínimo %d)", ErrForecastInsufficientData, len(values), forecastMinSeasons*m)
+	}
+	y := make([]float64, len(values))
+	imputed := 0
+	for i, v := range values {
+		switch {
+		case v != nil:
+			y[i] = *v
+		case i >= m:
+			y[i] = y[i-m]
+			imputed++
+		default:
+			y[i] = y[i-1]
+			imputed++
+		}
+	}
+	if float64(imputed) > forecastMaxImputed*float64(len(y)) {
+		return nil, 0, 0, fmt.Errorf("%w: %d de %d buckets sem leitura", ErrForecastInsufficientData, imputed, len(y))
+	}
+	return y, offset, imputed, nil
+}
+
+// forecastBucketStart retorna o início do bucket que contém t (hora cheia ou meia-noite local).
+func forecastBucketStart(t time.Time, granularity string, loc *time.Location) time.Time {
+	l := t.In(loc)
+	if granularity == "day" {
+		return time.Date(l.Year(), l.Month(), l.Day(), 0, 0, 0, 0, loc)
+	}
+	return time.Date(l.Year(), l.Month(), l.Day(), l.Hour(), 0, 0, 0, loc)
+}
+
+// monthProjection soma o realizado do mês com a previsão até periodEnd (pontos
+// com TS preenchido). false quando a previsão não cobre o fim do mês.
+func monthProjection(actual float64, points []ForecastPoint, step time.Duration, periodEnd time.Time) (*ForecastPeriod, bool) {
+	if len(points) == 0 || points[len(points)-1].TS.Add(step).Before(periodEnd) {
+		return nil, false
+	}
+	p := &ForecastPeriod{End: periodEnd, Actual: actual, Total: actual}
+	var variance float64
+	for _, pt := range points {
+		if !pt.TS.Before(periodEnd) {
+			break
+		}
+		p.Total += pt.Yhat
+		variance += pt.sd * pt.sd
+	}
+	sd := math.Sqrt(variance)
+	p.Lo95 = math.Max(p.Actual, p.Total-1.96*sd)
+	p.Hi95 = p.Total + 1.96*sd
+	return p, true
+}
+
+// ─── Treino e gravação ──────────────────────────────────────────────────────
+
+// ForecastRequest — série, granularidade e horizonte (0 = padrão da granularidade).
+type ForecastRequest struct {
+	FactoryID   uuid.UUID
+	AssetID     uuid.UUID
+	MetricKey   string
+	Granularity string
+	Horizon     int
+	SeriesID    *uuid.UUID
+}
+
+func forecastSpecFor(granularity string) (forecastSpec, error) {
+	spec, ok := forecastSpecs[granularity]
+	if !ok {
+		return spec, fmt.Errorf("%w: granularity deve ser hour ou day", ErrInvalidForecast)
+	}
+	return spec, nil
+}
+
+// forecastBucketTS retorna o início do bucket i a partir de start (dias no calendário local).
+func forecastBucketTS(start time.Time, granularity string, i int) time.Time {
+	if granularity == "day" {
+		return start.AddDate(0, 0, i)
+	}
+	return start.Add(time.Duration(i) * time.Hour)
+}
+
+// loadForecastValues agrega a série em n buckets a partir de start: do rollup de 1
+// minuto (treino) ou do log com o rollup nas lacunas (reais, ver correlation.go).
+func loadForecastValues(db *sql.DB, factoryID, assetID uuid.UUID, metricKey string, step time.Duration, start time.Time, n int, fromRollup bool) ([]*float64, *CounterConfigRow, error) {
+	counters, err := seriesCounters(db, []string{assetID.String()})
+	if err != nil {
+		return nil, nil, err
+	}
+	s := &correlationCandidateSeries{key: seriesKey{assetID, metricKey}, buckets: map[int]correlationBucket{}}
+	if c, ok := counters[s.key]; ok {
+		s.counter = &c
+	}
+	end := start.Add(time.Duration(n) * step)
+	if fromRollup {
+		if err := rollupForecastSeries(db, factoryID, s.key, start, end); err != nil {
+			return nil, nil, fmt.Errorf("rollup: %w", err)
+		}
+		err = fillRollupBuckets(db, factoryID, s, start, end, step)
+	} else {
+		err = fillCorrelationBuckets(db, factoryID, []*correlationCandidateSeries{s}, start, end, step)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+	return alignSeries(s.buckets, n, s.counter), s.counter, nil
+}
+
+// rollupForecastSeries consolida em telemetry_rollup_1m as lacunas da série em
+// [start, end): os trechos já consolidados ficam em nxd.rollup_ranges, e só o que
+// falta neles (mais a última forecastRollupLate, para leituras atrasadas) é
+// agregado do log. Reagregar um minuto substitui a linha, então repetir é seguro.
+// Depois [start, end) fica registrado, unido aos trechos que encosta.
+func rollupForecastSeries(db *sql.DB, factoryID uuid.UUID, k seriesKey, start, end time.Time) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	// Trava a série: dois treinos simultâneos não gravam trechos sobrepostos.
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock(hashtext($1))`, factoryID.String()+"/"+k.asset.String()+"/"+k.metric); err != nil {
+		return err
+	}
+	rows, err := tx.Query(`
+		SELECT bucket_start, bucket_end FROM nxd.rollup_ranges
+		WHERE factory_id = $1 AND asset_id = $2 AND metric_key = $3 AND bucket_start <= $5 AND bucket_end >= $4
+	`, factoryID, k.asset, k.metric, start, end)
+	if err != nil {
+		return err
+	}
+	var covered []timeRange
+	for rows.Next() {
+		var r timeRange
+		if err := rows.Scan(&r.Start, &r.End); err != nil {
+			rows.Close()
+			return err
+		}
+		covered = append(covered, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+	for _, gap := range rollupGaps(covered, start, end) {
+		if _, err := tx.Exec(`
+			INSERT INTO nxd.telemetry_rollup_1m (bucket_ts, factory_id, asset_id, metric_key, avg_value, min_value, max_value, samples, status_counts)
+			SELECT date_trunc('minute', ts), factory_id, asset_id, metric_key,
+				AVG(metric_value), MIN(metric_value), MAX(metric_value), COUNT(*), '{}'::jsonb
+			FROM nxd.telemetry_log
+			WHERE factory_id = $1 AND asset_id = $2 AND metric_key = $3 AND ts >= $4 AND ts < $5 AND metric_value IS NOT NULL
+			GROUP BY 1, 2, 3, 4
+			ON CONFLICT (bucket_ts, factory_id, asset_id, metric_key) DO UPDATE SET
+				avg_value = EXCLUDED.avg_value,
+				min_value = EXCLUDED.min_value,
+				max_value = EXCLUDED.max_value,
+				samples = EXCLUDED.samples
+		`, factoryID, k.asset, k.metric, gap.Start, gap.End); err != nil {
+			return err
+		}
+	}
+	merged := mergeRanges(append(covered, timeRange{start, end}))
+	if _, err := tx.Exec(`
+		DELETE FROM nxd.rollup_ranges
+		WHERE factory_id = $1 AND asset_id = $2 AND metric_key = $3 AND bucket_start <= $5 AND bucket_end >= $4
+	`, factoryID, k.asset, k.metric, start, end); err != nil {
+		return err
+	}
+	for _, r := range merged {
+		if _, err := tx.Exec(`
+			INSERT INTO nxd.rollup_ranges (factory_id, asset_id, metric_key, bucket_start, bucket_end) VALUES ($1, $2, $3, $4, $5)
+		`, factoryID, k.asset, k.metric, r.Start, r.End); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// rollupGaps retorna o que falta consolidar em [start, end): o complemento dos
+// trechos registrados, sem confiar na última forecastRollupLate antes de end.
+func rollupGaps(covered []timeRange, start, end time.Time) []timeRange {
+	trusted := clipRanges(mergeRanges(covered), start, end.Add(-forecastRollupLate))
+	return subtractRanges([]timeRange{{start, end}}, trusted)
+}
+
+// fillRollupBuckets agrega os minutos do rollup em buckets de step: média ponderada
+// pelos samples e, como último valor, o máximo do último minuto do bucket.
+func fillRollupBuckets(db *sql.DB, factoryID uuid.UUID, s *correlationCandidateSeries, start, end time.Time, step time.Duration) error {
+	rows, err := db.Query(`
+		SELECT FLOOR(EXTRACT(EPOCH FROM bucket_ts - $4) / $6)::int AS idx,
+			SUM(avg_value * samples) / SUM(samples), (ARRAY_AGG(max_value ORDER BY bucket_ts DESC))[1]
+		FROM nxd.telemetry_rollup_1m
+		WHERE factory_id = $1 AND asset_id = $2 AND metric_key = $3 AND bucket_ts >= $4 AND bucket_ts < $5
+			AND samples > 0 AND avg_value IS NOT NULL AND max_value IS NOT NULL
+		GROUP BY 1
+	`, factoryID, s.key.asset, s.key.metric, start, end, int64(step/time.Second))
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var idx int
+		var b correlationBucket
+		if err := rows.Scan(&idx, &b.avg, &b.last); err != nil {
+			return err
+		}
+		s.buckets[idx] = b
+	}
+	return rows.Err()
+}
+
+// RunForecast treina o modelo com o histórico até o bucket em andamento, projeta o
+// horizonte e grava a previsão.
+func RunForecast(db *sql.DB, req ForecastRequest, now time.Time) (*ForecastRow, error) {
+	spec, err := forecastSpecFor(req.Granularity)
+	if err != nil {
+		return nil, err
+	}
+	req.MetricKey = strings.TrimSpace(req.MetricKey)
+	if req.MetricKey == "" {
+		return nil, fmt.Errorf("%w: metric é obrigatório", ErrInvalidForecast)
+	}
+	if req.Horizon == 0 {
+		req.Horizon = spec.defHorizon
+	}
+	if req.Horizon < 1 || req.Horizon > spec.maxHorizon {
+		return nil, fmt.Errorf("%w: horizon deve estar entre 1 e %d", ErrInvalidForecast, spec.maxHorizon)
+	}
+	if a, err := GetAssetByID(db, req.AssetID, req.FactoryID); err != nil {
+		return nil, err
+	} else if a == nil {
+		return nil, fmt.Errorf("%w: ativo não encontrado", ErrInvalidForecast)
+	}
+	loc, err := GetFactoryTimezone(db, req.FactoryID)
+	if err != nil {
+		return nil, err
+	}
+	trainEnd := forecastBucketStart(now, req.Granularity, loc)
+	trainStart := trainEnd.AddDate(0, 0, -spec.trainDays)
+	n := spec.trainDays * int(24*time.Hour/spec.step)
+	values, counter, err := loadForecastValues(db, req.FactoryID, req.AssetID, req.MetricKey, spec.step, trainStart, n, true)
+	if err != nil {
+		return nil, err
+	}
+	y, offset, imputed, err := prepareForecastSeries(values, spec.season)
+	if err != nil {
+		return nil, err
+	}
+	mdl, err := fitHoltWinters(y, spec.season)
+	if err != nil {
+		return nil, err
+	}
+
+	// Contadores diários: a previsão vai pelo menos até o fim do mês.
+	var periodEnd time.Time
+	if counter != nil && req.Granularity == "day" {
+		periodEnd = time.Date(trainEnd.Year(), trainEnd.Month()+1, 1, 0, 0, 0, 0, loc)
+		if need := int(math.Round(periodEnd.Sub(trainEnd).Hours() / 24)); need > req.Horizon {
+			req.Horizon = need
+		}
+	}
+	f := &ForecastRow{
+		FactoryID: req.FactoryID, AssetID: req.AssetID, MetricKey: req.MetricKey, Granularity: req.Granularity,
+		SeriesID: req.SeriesID, Counter: counter != nil, Season: spec.season,
+		Alpha: mdl.alpha, Beta: mdl.beta, Gamma: mdl.gamma, Phi: mdl.phi, Sigma: mdl.sigma,
+		TrainStart: forecastBucketTS(trainStart, req.Granularity, offset), TrainEnd: trainEnd,
+		TrainPoints: len(y), Imputed: imputed,
+		Points: mdl.forecast(req.Horizon, counter != nil),
+	}
+	for i := range f.Points {
+		f.Points[i].TS = forecastBucketTS(trainEnd, req.Granularity, i)
+	}
+	if !periodEnd.IsZero() {
+		monthStart := time.Date(trainEnd.Year(), trainEnd.Month(), 1, 0, 0, 0, 0, loc)
+		var actual float64
+		for i := n - 1; i >= 0 && !forecastBucketTS(trainStart, req.Granularity, i).Before(monthStart); i-- {
+			if values[i] != nil {
+				actual += *values[i]
+			}
+		}
+		f.Period, _ = monthProjection(actual, f.Points, spec.step, periodEnd)
+	}
+	for i := n - forecastHistorySeasons*spec.season; i < n; i++ {
+		if i >= 0 {
+			f.History = append(f.History, ForecastHistoryPoint{TS: forecastBucketTS(trainStart, req.Granularity, i), Value: values[i]})
+		}
+	}
+	if err := insertForecast(db, f); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// insertForecast grava a previsão e seus pontos em uma transação.
+func insertForecast(db *sql.DB, f *ForecastRow) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	var periodEnd *time.Time
+	var pActual, pTotal, pLo, pHi *float64
+	if f.Period != nil {
+		periodEnd, pActual, pTotal, pLo, pHi = &f.Period.End, &f.Period.Actual, &f.Period.Total, &f.Period.Lo95, &f.Period.Hi95
+	}
+	err = tx.QueryRow(`
+		INSERT INTO nxd.forecasts (factory_id, asset_id, metric_key, granularity, series_id, counter, season,
+			alpha, beta, gamma, phi, sigma, train_start, train_end, train_points, imputed,
+			period_end, period_actual, period_total, period_lo95, period_hi95)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, $20, $21)
+		RETURNING id, created_at
+	`, f.FactoryID, f.AssetID, f.MetricKey, f.Granularity, f.SeriesID, f.Counter, f.Season,
+		f.Alpha, f.Beta, f.Gamma, f.Phi, f.Sigma, f.TrainStart, f.TrainEnd, f.TrainPoints, f.Imputed,
+		periodEnd, pActual, pTotal, pLo, pHi).Scan(&f.ID, &f.CreatedAt)
+	if err != nil {
+		return err
+	}
+	ts := make([]time.Time, len(f.Points))
+	leads := make([]int64, len(f.Points))
+	cols := make([][]float64, 5)
+	for i, p := range f.Points {
+		ts[i], leads[i] = p.TS, int64(p.Lead)
+		for j, v := range []float64{p.Yhat, p.Lo80, p.Hi80, p.Lo95, p.Hi95} {
+			cols[j] = append(cols[j], v)
+		}
+	}
+	tsText := make([]string, len(ts))
+	for i, t := range ts {
+		tsText[i] = t.UTC().Format(time.RFC3339)
+	}
+	if _, err := tx.Exec(`
+		INSERT INTO nxd.forecast_points (forecast_id, ts, lead, yhat, lo80, hi80, lo95, hi95)
+		SELECT $1, p.ts, p.lead, p.yhat, p.lo80, p.hi80, p.lo95, p.hi95
+		FROM unnest($2::timestamptz[], $3::int[], $4::float8[], $5::float8[], $6::float8[], $7::float8[], $8::float8[])
+			AS p(ts, lead, yhat, lo80, hi80, lo95, hi95)
+	`, f.ID, pq.Array(tsText), pq.Array(leads), pq.Array(cols[0]), pq.Array(cols[1]), pq.Array(cols[2]),
+		pq.Array(cols[3]), pq.Array(cols[4])); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+const forecastColumns = `f.id, f.factory_id, f.asset_id, f.metric_key, f.granularity, f.series_id, f.counter, f.season,
+	f.alpha, f.beta, f.gamma, f.phi, f.sigma, f.train_start, f.train_end, f.train_points, f.imputed,
+	f.period_end, f.period_actual, f.period_total, f.period_lo95, f.period_hi95, f.created_at`
+
+func scanForecast(sc interface{ Scan(...interface{}) error }) (ForecastRow, error) {
+	var f ForecastRow
+	var seriesID uuid.NullUUID
+	var periodEnd sql.NullTime
+	var pActual, pTotal, pLo, pHi sql.NullFloat64
+	err := sc.Scan(&f.ID, &f.FactoryID, &f.AssetID, &f.MetricKey, &f.Granularity, &seriesID, &f.Counter, &f.Season,
+		&f.Alpha, &f.Beta, &f.Gamma, &f.Phi, &f.Sigma, &f.TrainStart, &f.TrainEnd, &f.TrainPoints, &f.Imputed,
+		&periodEnd, &pActual, &pTotal, &pLo, &pHi, &f.CreatedAt)
+	if err != nil {
+		return f, err
+	}
+	if seriesID.Valid {
+		f.SeriesID = &seriesID.UUID
+	}
+	if periodEnd.Valid {
+		f.Period = &ForecastPeriod{End: periodEnd.Time, Actual: pActual.Float64, Total: pTotal.Float64,
+			Lo95: pLo.Float64, Hi95: pHi.Float64}
+	}
+	return f, nil
+}
+
+// GetLatestForecast retorna a previsão mais recente da série, com os reais já
+// apurados (nil se não houver).
+func GetLatestForecast(db *sql.DB, factoryID, assetID uuid.UUID, metricKey, granularity string) (*ForecastRow, error) {
+	f, err := scanForecast(db.QueryRow(`SELECT `+forecastColumns+`
+		FROM nxd.forecasts f
+		WHERE f.factory_id = $1 AND f.asset_id = $2 AND f.metric_key = $3 AND f.granularity = $4
+		ORDER BY f.created_at DESC LIMIT 1
+	`, factoryID, assetID, metricKey, granularity))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`
+		SELECT ts, lead, yhat, lo80, hi80, lo95, hi95, actual FROM nxd.forecast_points
+		WHERE forecast_id = $1 ORDER BY ts
+	`, f.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	f.Points = []ForecastPoint{}
+	for rows.Next() {
+		var p ForecastPoint
+		var actual sql.NullFloat64
+		if err := rows.Scan(&p.TS, &p.Lead, &p.Yhat, &p.Lo80, &p.Hi80, &p.Lo95, &p.Hi95, &actual); err != nil {
+			return nil, err
+		}
+		if actual.Valid {
+			p.Actual = &actual.Float64
+		}
+		f.Points = append(f.Points, p)
+	}
+	return &f, rows.Err()
+}
+
+// ─── Séries acompanhadas ────────────────────────────────────────────────────
+
+// ListForecastSeries retorna as séries acompanhadas da fábrica.
+func ListForecastSeries(db *sql.DB, factoryID uuid.UUID) ([]ForecastSeriesRow, error) {
+	rows, err := db.Query(`
+		SELECT id, asset_id, metric_key, granularity, horizon, active, created_at
+		FROM nxd.forecast_series WHERE factory_id = $1 ORDER BY created_at
+	`, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []ForecastSeriesRow{}
+	for rows.Next() {
+		var s ForecastSeriesRow
+		if err := rows.Scan(&s.ID, &s.AssetID, &s.MetricKey, &s.Granularity, &s.Horizon, &s.Active, &s.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, s)
+	}
+	return list, rows.Err()
+}
+
+// UpsertForecastSeries passa a acompanhar a série (ou atualiza horizonte/ativa).
+func UpsertForecastSeries(db *sql.DB, factoryID uuid.UUID, s ForecastSeriesRow) (uuid.UUID, error) {
+	spec, err := forecastSpecFor(s.Granularity)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	s.MetricKey = strings.TrimSpace(s.MetricKey)
+	if s.MetricKey == "" {
+		return uuid.Nil, fmt.Errorf("%w: metric_key é obrigatório", ErrInvalidForecast)
+	}
+	if s.Horizon == 0 {
+		s.Horizon = spec.defHorizon
+	}
+	if s.Horizon < 1 || s.Horizon > spec.maxHorizon {
+		return uuid.Nil, fmt.Errorf("%w: horizon deve estar entre 1 e %d", ErrInvalidForecast, spec.maxHorizon)
+	}
+	if a, err := GetAssetByID(db, s.AssetID, factoryID); err != nil {
+		return uuid.Nil, err
+	} else if a == nil {
+		return uuid.Nil, fmt.Errorf("%w: ativo não encontrado", ErrInvalidForecast)
+	}
+	var id uuid.UUID
+	err = db.QueryRow(`
+		INSERT INTO nxd.forecast_series (factory_id, asset_id, metric_key, granularity, horizon, active)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (asset_id, metric_key, granularity) DO UPDATE SET horizon = EXCLUDED.horizon, active = EXCLUDED.active
+		RETURNING id
+	`, factoryID, s.AssetID, s.MetricKey, s.Granularity, s.Horizon, s.Active).Scan(&id)
+	return id, err
+}
+
+// DeleteForecastSeries para de acompanhar a série (as previsões emitidas ficam). false = não encontrada.
+func DeleteForecastSeries(db *sql.DB, factoryID, id uuid.UUID) (bool, error) {
+	res, err := db.Exec(`DELETE FROM nxd.forecast_series WHERE id = $1 AND factory_id = $2`, id, factoryID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ─── Acurácia ───────────────────────────────────────────────────────────────
+
+// ForecastAccuracyQuery filtra os pontos já apurados (ts em [Start, End)).
+type ForecastAccuracyQuery struct {
+	FactoryID   uuid.UUID
+	AssetID     *uuid.UUID
+	MetricKey   string
+	Granularity string
+	Start, End  time.Time
+}
+
+// ForecastAccuracyStats — erros dos pontos apurados (MAPE ignora reais zero).
+type ForecastAccuracyStats struct {
+	LeadFrom      int      `json:"lead_from,omitempty"`
+	LeadTo        int      `json:"lead_to,omitempty"`
+	Points        int      `json:"points"`
+	MAE           *float64 `json:"mae"`
+	RMSE          *float64 `json:"rmse"`
+	MAPEPct       *float64 `json:"mape_pct"`
+	Bias          *float64 `json:"bias"` // média de real − previsto (> 0 = previsão baixa)
+	Coverage80Pct *float64 `json:"coverage80_pct"`
+	Coverage95Pct *float64 `json:"coverage95_pct"`
+}
+
+// ForecastSeriesAccuracy — acurácia de uma série.
+type ForecastSeriesAccuracy struct {
+	AssetID   uuid.UUID `json:"asset_id"`
+	AssetName string    `json:"asset_name"`
+	MetricKey string    `json:"metric_key"`
+	ForecastAccuracyStats
+}
+
+// ForecastAccuracy — resultado de ComputeForecastAccuracy.
+type ForecastAccuracy struct {
+	Granularity string                   `json:"granularity"`
+	Forecasts   int                      `json:"forecasts"`
+	Total       ForecastAccuracyStats    `json:"total"`
+	ByLead      []ForecastAccuracyStats  `json:"by_lead"`
+	Series      []ForecastSeriesAccuracy `json:"series"`
+}
+
+// forecastAccuracyStats calcula os erros de pontos com Actual.
+func forecastAccuracyStats(points []ForecastPoint) ForecastAccuracyStats {
+	var s ForecastAccuracyStats
+	var absSum, sqSum, pctSum, biasSum float64
+	var pctN, in80, in95 int
+	for _, p := range points {
+		if p.Actual == nil {
+			continue
+		}
+		a := *p.Actual
+		e := a - p.Yhat
+		s.Points++
+		absSum += math.Abs(e)
+		sqSum += e * e
+		biasSum += e
+		if a != 0 {
+			pctSum += math.Abs(e / a)
+			pctN++
+		}
+		if a >= p.Lo80 && a <= p.Hi80 {
+			in80++
+		}
+		if a >= p.Lo95 && a <= p.Hi95 {
+			in95++
+		}
+	}
+	if s.Points == 0 {
+		return s
+	}
+	f := func(x float64) *float64 { return &x }
+	n := float64(s.Points)
+	s.MAE, s.RMSE, s.Bias = f(absSum/n), f(math.Sqrt(sqSum/n)), f(biasSum/n)
+	s.Coverage80Pct, s.Coverage95Pct = f(float64(in80)/n*100), f(float64(in95)/n*100)
+	if pctN > 0 {
+		s.MAPEPct = f(pctSum / float64(pctN) * 100)
+	}
+	return s
+}
+
+// ComputeForecastAccuracy compara as previsões gravadas com os reais apurados.
+func ComputeForecastAccuracy(db *sql.DB, q ForecastAccuracyQuery) (*ForecastAccuracy, error) {
+	spec, err := forecastSpecFor(q.Granularity)
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`
+		SELECT f.id, f.asset_id, a.display_name, f.metric_key, p.ts, p.lead, p.yhat, p.lo80, p.hi80, p.lo95, p.hi95, p.actual
+		FROM nxd.forecast_points p
+		JOIN nxd.forecasts f ON f.id = p.forecast_id
+		JOIN nxd.assets a ON a.id = f.asset_id
+		WHERE f.factory_id = $1 AND f.granularity = $2 AND p.actual IS NOT NULL AND p.ts >= $3 AND p.ts < $4
+			AND ($5::uuid IS NULL OR f.asset_id = $5) AND ($6 = '' OR f.metric_key = $6)
+		ORDER BY a.display_name, f.metric_key
+	`, q.FactoryID, q.Granularity, q.Start, q.End, q.AssetID, q.MetricKey)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	type group struct {
+		key    seriesKey
+		name   string
+		points []ForecastPoint
+	}
+	var all []ForecastPoint
+	var groups []*group
+	byKey := map[seriesKey]*group{}
+	forecasts := map[uuid.UUID]bool{}
+	for rows.Next() {
+		var id uuid.UUID
+		var k seriesKey
+		var name string
+		var p ForecastPoint
+		var actual float64
+		if err := rows.Scan(&id, &k.asset, &name, &k.metric, &p.TS, &p.Lead, &p.Yhat, &p.Lo80, &p.Hi80, &p.Lo95, &p.Hi95, &actual); err != nil {
+			return nil, err
+		}
+		p.Actual = &actual
+		forecasts[id] = true
+		all = append(all, p)
+		g := byKey[k]
+		if g == nil {
+			g = &group{key: k, name: name}
+			byKey[k] = g
+			groups = append(groups, g)
+		}
+		g.points = append(g.points, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	acc := &ForecastAccuracy{Granularity: q.Granularity, Forecasts: len(forecasts), Total: forecastAccuracyStats(all),
+		ByLead: []ForecastAccuracyStats{}, Series: []ForecastSeriesAccuracy{}}
+	for _, lg := range spec.leadGroups {
+		var in []ForecastPoint
+		for _, p := range all {
+			if p.Lead >= lg[0] && p.Lead <= lg[1] {
+				in = append(in, p)
+			}
+		}
+		s := forecastAccuracyStats(in)
+		s.LeadFrom, s.LeadTo = lg[0], lg[1]
+		acc.ByLead = append(acc.ByLead, s)
+	}
+	for _, g := range groups {
+		acc.Series = append(acc.Series, ForecastSeriesAccuracy{AssetID: g.key.asset, AssetName: g.name, MetricKey: g.key.metric,
+			ForecastAccuracyStats: forecastAccuracyStats(g.points)})
+	}
+	return acc, nil
+}
+
+// ─── Worker ─────────────────────────────────────────────────────────────────
+
+// FillForecastActuals apura o valor real dos pontos cujo bucket já fechou. Pontos
+// sem leitura até forecastMissingAfter depois do fim do bucket ficam sem real.
+func FillForecastActuals(ctx context.Context, db *sql.DB, now time.Time) (int, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT f.factory_id, f.asset_id, f.metric_key, f.granularity, MIN(p.ts), MAX(p.ts)
+		FROM nxd.forecast_points p
+		JOIN nxd.forecasts f ON f.id = p.forecast_id
+		WHERE p.actual_at IS NULL
+			AND p.ts + CASE f.granularity WHEN 'day' THEN INTERVAL '1 day' ELSE INTERVAL '1 hour' END <= $1
+		GROUP BY 1, 2, 3, 4
+		LIMIT $2
+	`, now, forecastMaxFill)
+	if err != nil {
+		return 0, err
+	}
+	type pending struct {
+		factoryID, assetID uuid.UUID
+		metricKey, gran    string
+		first, last        time.Time
+	}
+	var list []pending
+	for rows.Next() {
+		var p pending
+		if err := rows.Scan(&p.factoryID, &p.assetID, &p.metricKey, &p.gran, &p.first, &p.last); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		list = append(list, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	filled := 0
+	for _, p := range list {
+		if ctx.Err() != nil {
+			return filled, ctx.Err()
+		}
+		spec := forecastSpecs[p.gran]
+		// Um bucket antes: referência do acréscimo dos contadores.
+		start := p.first.Add(-spec.step)
+		n := int(p.last.Sub(start)/spec.step) + 1
+		values, _, err := loadForecastValues(db, p.factoryID, p.assetID, p.metricKey, spec.step, start, n, false)
+		if err != nil {
+			return filled, fmt.Errorf("ativo %s/%s: %w", p.assetID, p.metricKey, err)
+		}
+		for i := 1; i < n; i++ {
+			ts := start.Add(time.Duration(i) * spec.step)
+			end := ts.Add(spec.step)
+			if end.After(now) {
+				break
+			}
+			if values[i] == nil && end.Add(forecastMissingAfter).After(now) {
+				continue // ainda pode chegar leitura atrasada
+			}
+			res, err := db.ExecContext(ctx, `
+				UPDATE nxd.forecast_points p SET actual = $5, actual_at = NOW()
+				FROM nxd.forecasts f
+				WHERE f.id = p.forecast_id AND f.asset_id = $1 AND f.metric_key = $2 AND f.granularity = $3
+					AND p.ts = $4 AND p.actual_at IS NULL
+			`, p.assetID, p.metricKey, p.gran, ts, values[i])
+			if err != nil {
+				return filled, err
+			}
+			if n, _ := res.RowsAffected(); n > 0 && values[i] != nil {
+				filled += int(n)
+			}
+		}
+	}
+	return filled, nil
+}
+
+// RefreshTrackedForecasts refaz a previsão das séries acompanhadas cujo último
+// treino é anterior ao bucket atual. Séries sem histórico suficiente são puladas.
+func RefreshTrackedForecasts(ctx context.Context, db *sql.DB, now time.Time) (int, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT s.id, s.factory_id, s.asset_id, s.metric_key, s.granularity, s.horizon,
+			(SELECT MAX(f.train_end) FROM nxd.forecasts f WHERE f.series_id = s.id)
+		FROM nxd.forecast_series s WHERE s.active
+	`)
+	if err != nil {
+		return 0, err
+	}
+	type tracked struct {
+		req  ForecastRequest
+		last sql.NullTime
+	}
+	var list []tracked
+	for rows.Next() {
+		var t tracked
+		var id uuid.UUID
+		if err := rows.Scan(&id, &t.req.FactoryID, &t.req.AssetID, &t.req.MetricKey, &t.req.Granularity, &t.req.Horizon, &t.last); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		t.req.SeriesID = &id
+		list = append(list, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	locs := map[uuid.UUID]*time.Location{}
+	done := 0
+	for _, t := range list {
+		if ctx.Err() != nil {
+			return done, ctx.Err()
+		}
+		loc := locs[t.req.FactoryID]
+		if loc == nil {
+			if loc, err = GetFactoryTimezone(db, t.req.FactoryID); err != nil {
+				return done, err
+			}
+			locs[t.req.FactoryID] = loc
+		}
+		if t.last.Valid && !t.last.Time.Before(forecastBucketStart(now, t.req.Granularity, loc)) {
+			continue
+		}
+		if _, err := RunForecast(db, t.req, now); err != nil {
+			if errors.Is(err, ErrForecastInsufficientData) {
+				continue
+			}
+			log.Printf("⚠️  [Forecast] %s/%s (%s): %v", t.req.AssetID, t.req.MetricKey, t.req.Granularity, err)
+			continue
+		}
+		done++
+	}
+	return done, nil
+}
+
+// RunForecastWorker apura reais, refaz previsões das séries acompanhadas e apaga
+// previsões antigas a cada forecastWorkerInterval.
+func RunForecastWorker(ctx context.Context, db *sql.DB) {
+	log.Println("✓ [Forecast] Worker de previsão iniciado (intervalo: 10m)")
+	ticker := time.NewTicker(forecastWorkerInterval)
+	defer ticker.Stop()
+	for {
+		now := time.Now()
+		filled, err := FillForecastActuals(ctx, db, now)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("⚠️  [Forecast] Reais: %v", err)
+		}
+		refreshed, err := RefreshTrackedForecasts(ctx, db, now)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("⚠️  [Forecast] %v", err)
+		}
+		if _, err := db.ExecContext(ctx, `DELETE FROM nxd.forecasts WHERE created_at < $1`, now.Add(-forecastRetention)); err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("⚠️  [Forecast] Limpeza: %v", err)
+		}
+		if filled+refreshed > 0 {
+			log.Printf("📈 [Forecast] %d previsão(ões) atualizada(s), %d real(is) apurado(s)", refreshed, filled)
+		}
+		select {
+		case <-ctx.Done():
+			log.Println("⏹  [Forecast] Shutdown signal received, worker stopping.")
+			return
+		case <-ticker.C:
+		}
+	}
+}
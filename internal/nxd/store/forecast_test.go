@@ -0,0 +1,204 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestHoltWintersSeasonalTrend(t *testing.T) {
+	const m, n = 24, 24 * 21
+	pattern := func(i int) float64 { return 100 + 0.05*float64(i) + 20*math.Sin(2*math.Pi*float64(i%m)/m) }
+	y := make([]float64, n)
+	for i := range y {
+		y[i] = pattern(i) + 0.5*math.Sin(float64(i)*1.3)
+	}
+	mdl, err := fitHoltWinters(y, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mdl.sigma <= 0 || mdl.sigma > 2 {
+		t.Errorf("sigma = %v", mdl.sigma)
+	}
+	pts := mdl.forecast(48, false)
+	for _, p := range pts[:24] {
+		if want := pattern(n - 1 + p.Lead); math.Abs(p.Yhat-want) > 3 {
+			t.Errorf("lead %d: yhat %.2f, want ~%.2f", p.Lead, p.Yhat, want)
+		}
+		if !(p.Lo95 < p.Lo80 && p.Lo80 < p.Yhat && p.Yhat < p.Hi80 && p.Hi80 < p.Hi95) {
+			t.Errorf("lead %d: intervalos fora de ordem %+v", p.Lead, p)
+		}
+	}
+	if pts[47].Hi95-pts[47].Lo95 <= pts[0].Hi95-pts[0].Lo95 {
+		t.Errorf("intervalo não alarga com a antecedência")
+	}
+
+	// Contador: nada negativo.
+	low := make([]float64, 24*4)
+	for i := range low {
+		low[i] = float64(i % 2)
+	}
+	mdl, _ = fitHoltWinters(low, m)
+	for _, p := range mdl.forecast(24, true) {
+		if p.Yhat < 0 || p.Lo95 < 0 {
+			t.Fatalf("contador negativo: %+v", p)
+		}
+	}
+	if _, err := fitHoltWinters(y[:2*m], m); !errors.Is(err, ErrForecastInsufficientData) {
+		t.Errorf("histórico curto: err = %v", err)
+	}
+}
+
+func TestPrepareForecastSeries(t *testing.T) {
+	const m = 2
+	values := []*float64{nil, nil, f64(1), f64(2), nil, f64(4), f64(5), nil, f64(7), f64(8)}
+	y, offset, imputed, err := prepareForecastSeries(values, m)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []float64{1, 2, 1, 4, 5, 4, 7, 8}
+	if offset != 2 || imputed != 2 || len(y) != len(want) {
+		t.Fatalf("offset %d imputed %d y %v", offset, imputed, y)
+	}
+	for i := range want {
+		if y[i] != want[i] {
+			t.Errorf("y[%d] = %v, want %v", i, y[i], want[i])
+		}
+	}
+	// Lacunas demais.
+	values[3], values[5], values[6] = nil, nil, nil
+	if _, _, _, err := prepareForecastSeries(values, m); !errors.Is(err, ErrForecastInsufficientData) {
+		t.Errorf("lacunas demais: err = %v", err)
+	}
+}
+
+func TestForecastAccuracyStats(t *testing.T) {
+	pts := []ForecastPoint{
+		{Lead: 1, Yhat: 10, Lo80: 8, Hi80: 12, Lo95: 6, Hi95: 14, Actual: f64(11)},
+		{Lead: 2, Yhat: 10, Lo80: 8, Hi80: 12, Lo95: 6, Hi95: 14, Actual: f64(13)},
+		{Lead: 3, Yhat: 2, Lo80: 1, Hi80: 3, Lo95: 0, Hi95: 4, Actual: f64(0)}, // fora do MAPE
+		{Lead: 4, Yhat: 10}, // sem real
+	}
+	s := forecastAccuracyStats(pts)
+	if s.Points != 3 || math.Abs(*s.MAE-2) > 1e-9 || math.Abs(*s.Bias-2.0/3) > 1e-9 {
+		t.Fatalf("stats = %+v", s)
+	}
+	if math.Abs(*s.RMSE-math.Sqrt(14.0/3)) > 1e-9 || math.Abs(*s.MAPEPct-(1.0/11+3.0/13)/2*100) > 1e-9 {
+		t.Errorf("rmse %v mape %v", *s.RMSE, *s.MAPEPct)
+	}
+	if math.Abs(*s.Coverage80Pct-100.0/3) > 1e-9 || *s.Coverage95Pct != 100 {
+		t.Errorf("cobertura %v / %v", *s.Coverage80Pct, *s.Coverage95Pct)
+	}
+	if e := forecastAccuracyStats(nil); e.Points != 0 || e.MAE != nil {
+		t.Errorf("vazio = %+v", e)
+	}
+}
+
+func TestMonthProjection(t *testing.T) {
+	loc := time.FixedZone("BRT", -3*3600)
+	start := time.Date(2026, 3, 29, 0, 0, 0, 0, loc)
+	end := time.Date(2026, 4, 1, 0, 0, 0, 0, loc)
+	pts := make([]ForecastPoint, 4)
+	for i := range pts {
+		pts[i] = ForecastPoint{TS: forecastBucketTS(start, "day", i), Lead: i + 1, Yhat: 100, sd: 10}
+	}
+	p, ok := monthProjection(2800, pts, 24*time.Hour, end)
+	if !ok || p.Total != 3100 || math.Abs(p.Hi95-(3100+1.96*math.Sqrt(300))) > 1e-9 || p.Lo95 < p.Actual {
+		t.Fatalf("projeção = %+v", p)
+	}
+	if _, ok := monthProjection(2800, pts[:2], 24*time.Hour, end); ok {
+		t.Errorf("previsão curta projetou o mês")
+	}
+	if got := forecastBucketStart(time.Date(2026, 3, 29, 2, 30, 0, 0, time.UTC), "day", loc); !got.Equal(time.Date(2026, 3, 28, 0, 0, 0, 0, loc)) {
+		t.Errorf("bucket diário = %v", got)
+	}
+}
+
+// TestForecastTrainsFromRollup grava telemetria no Postgres e confere que o treino
+// consolida o rollup e lê dele os mesmos buckets do log bruto — inclusive o trecho
+// antigo depois de um treino mais curto já ter consolidado só o fim — e que uma
+// leitura atrasada dentro de forecastRollupLate entra no treino seguinte.
+// Requer TEST_DATABASE_URL.
+func TestRollupGaps(t *testing.T) {
+	t0 := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	h := func(x int) time.Time { return t0.Add(time.Duration(x) * time.Hour) }
+	// Só o fim consolidado (treino curto): falta o começo, e a última hora é refeita.
+	got := rollupGaps([]timeRange{{h(20), h(24)}}, h(0), h(24))
+	want := []timeRange{{h(0), h(20)}, {h(23), h(24)}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tail covered: gaps = %v, want %v", got, want)
+	}
+	// Buraco no meio e trecho além de end.
+	got = rollupGaps([]timeRange{{h(-5), h(6)}, {h(10), h(30)}}, h(0), h(24))
+	want = []timeRange{{h(6), h(10)}, {h(23), h(24)}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("hole: gaps = %v, want %v", got, want)
+	}
+	if got := rollupGaps(nil, h(0), h(2)); !reflect.DeepEqual(got, []timeRange{{h(0), h(2)}}) {
+		t.Errorf("nothing covered: gaps = %v", got)
+	}
+}
+
+func TestForecastTrainsFromRollup(t *testing.T) {
+	db := openTestDB(t)
+	defer db.Close()
+	factoryID, assetID := uuid.New(), uuid.New()
+	exec := func(q string, args ...interface{}) {
+		t.Helper()
+		if _, err := db.Exec(q, args...); err != nil {
+			t.Fatalf("%s: %v", q, err)
+		}
+	}
+	exec(`INSERT INTO nxd.factories (id, name) VALUES ($1, $2)`, factoryID, "TestForecastRollup-"+factoryID.String())
+	t.Cleanup(func() {
+		db.Exec(`DELETE FROM nxd.telemetry_rollup_1m WHERE factory_id = $1`, factoryID)
+		db.Exec(`DELETE FROM nxd.factories WHERE id = $1`, factoryID)
+	})
+	exec(`INSERT INTO nxd.assets (id, factory_id, source_tag_id, display_name) VALUES ($1, $2, $3, $3)`,
+		assetID, factoryID, "TAG-"+assetID.String()[:8])
+	t0 := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for m := 0; m < 180; m += 7 {
+		exec(`INSERT INTO nxd.telemetry_log (ts, factory_id, asset_id, metric_key, metric_value) VALUES ($1, $2, $3, 'temp', $4)`,
+			t0.Add(time.Duration(m)*time.Minute+10*time.Second), factoryID, assetID, float64(m%13))
+	}
+
+	check := func(label string) {
+		t.Helper()
+		raw, _, err := loadForecastValues(db, factoryID, assetID, "temp", time.Hour, t0, 3, false)
+		if err != nil {
+			t.Fatalf("%s: log: %v", label, err)
+		}
+		rolled, _, err := loadForecastValues(db, factoryID, assetID, "temp", time.Hour, t0, 3, true)
+		if err != nil {
+			t.Fatalf("%s: rollup: %v", label, err)
+		}
+		for i := range raw {
+			if raw[i] == nil || rolled[i] == nil || math.Abs(*raw[i]-*rolled[i]) > 1e-9 {
+				t.Errorf("%s: bucket %d = %v, log = %v", label, i, rolled[i], raw[i])
+			}
+		}
+	}
+	// Treino curto (como o "hour" de uma série com o "day" ainda não treinado).
+	if _, _, err := loadForecastValues(db, factoryID, assetID, "temp", time.Hour, t0.Add(2*time.Hour), 1, true); err != nil {
+		t.Fatalf("short: %v", err)
+	}
+	check("first")
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM nxd.telemetry_rollup_1m WHERE factory_id = $1`, factoryID).Scan(&n)
+	if n != 26 {
+		t.Errorf("rollup rows = %d, want 26", n)
+	}
+	var ranges int
+	var rs, re time.Time
+	db.QueryRow(`SELECT COUNT(*), MIN(bucket_start), MAX(bucket_end) FROM nxd.rollup_ranges WHERE factory_id = $1`, factoryID).Scan(&ranges, &rs, &re)
+	if ranges != 1 || !rs.Equal(t0) || !re.Equal(t0.Add(3*time.Hour)) {
+		t.Errorf("rollup_ranges = %d [%v, %v), want 1 [%v, %v)", ranges, rs, re, t0, t0.Add(3*time.Hour))
+	}
+	exec(`INSERT INTO nxd.telemetry_log (ts, factory_id, asset_id, metric_key, metric_value) VALUES ($1, $2, $3, 'temp', 100)`,
+		t0.Add(170*time.Minute+30*time.Second), factoryID, assetID)
+	check("late")
+}
@@ -0,0 +1,563 @@
+package store
+
+// inspections.go — Inspeções de qualidade e não conformidades
+//
+// O refugo do CLP (tag_nok) só vê o que a máquina rejeita; defeitos achados na
+// inspeção manual, depois, são registrados aqui: tipo de defeito, quantidade,
+// ativo, ordem de produção (opcional) e quando foi inspecionado, com anexos
+// (metadados; o arquivo fica no storage).
+//
+// Reclassificação: as peças de uma NC já foram contadas como OK pelo tag_ok, então
+// a quantidade passa de OK para NOK (OK nunca fica negativo; sem tag_ok a
+// quantidade só soma ao NOK). Vale para a qualidade do OEE e para faturamento,
+// perda de refugo e margem do financeiro (e, por consequência, ordens, benchmark
+// e relatórios). A quantidade é distribuída proporcionalmente no intervalo em que
+// as peças foram produzidas:
+//   produced_start..produced_end            se informado
+//   início da ordem..min(fim da ordem, inspeção)  se há ordem iniciada
+//   instante da inspeção                    caso contrário
+//
+// O Pareto por tipo de defeito conta as NCs pela data da inspeção.
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var (
+	// ErrInvalidInspection envolve erros de validação de inspeções e tipos de defeito.
+	ErrInvalidInspection = errors.New("inspeção inválida")
+	ErrDefectTypeExists  = errors.New("já existe um tipo de defeito com este código")
+)
+
+// DefectTypeRow — tipo de defeito da fábrica.
+type DefectTypeRow struct {
+	ID        uuid.UUID `json:"id"`
+	Code      string    `json:"code"`
+	Name      string    `json:"name"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// InspectionAttachmentRow — metadados de um anexo (foto, laudo).
+type InspectionAttachmentRow struct {
+	ID          uuid.UUID `json:"id"`
+	FileName    string    `json:"file_name"`
+	ContentType string    `json:"content_type,omitempty"`
+	SizeBytes   *int64    `json:"size_bytes,omitempty"`
+	StorageURL  string    `json:"storage_url"`
+	CreatedBy   *int64    `json:"created_by,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// InspectionRow — não conformidade registrada.
+type InspectionRow struct {
+	ID            uuid.UUID                 `json:"id"`
+	AssetID       uuid.UUID                 `json:"asset_id"`
+	AssetName     string                    `json:"asset_name,omitempty"`
+	OrderID       *uuid.UUID                `json:"order_id,omitempty"`
+	OrderCode     string                    `json:"order_code,omitempty"`
+	DefectTypeID  uuid.UUID                 `json:"defect_type_id"`
+	DefectCode    string                    `json:"defect_code,omitempty"`
+	DefectName    string                    `json:"defect_name,omitempty"`
+	Quantity      float64                   `json:"quantity"`
+	InspectedAt   time.Time                 `json:"inspected_at"`
+	ProducedStart *time.Time                `json:"produced_start,omitempty"`
+	ProducedEnd   *time.Time                `json:"produced_end,omitempty"`
+	Inspector     string                    `json:"inspector,omitempty"`
+	Notes         string                    `json:"notes,omitempty"`
+	CreatedBy     *int64                    `json:"created_by,omitempty"`
+	CreatedAt     time.Time                 `json:"created_at"`
+	Attachments   []InspectionAttachmentRow `json:"attachments"`
+}
+
+// InspectionQuery filtra por data da inspeção em [Start, End) e escopo.
+type InspectionQuery struct {
+	FactoryID    uuid.UUID
+	SectorID     *uuid.UUID
+	AssetID      *uuid.UUID
+	OrderID      *uuid.UUID
+	DefectTypeID *uuid.UUID
+	Start, End   time.Time
+	Limit        int
+}
+
+// ─── Tipos de defeito ───────────────────────────────────────────────────────
+
+// ListDefectTypes retorna os tipos de defeito (inativos só com includeInactive).
+func ListDefectTypes(db *sql.DB, factoryID uuid.UUID, includeInactive bool) ([]DefectTypeRow, error) {
+	rows, err := db.Query(`
+		SELECT id, code, name, active, created_at FROM nxd.defect_types
+		WHERE factory_id = $1 AND (active OR $2) ORDER BY code`, factoryID, includeInactive)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []DefectTypeRow{}
+	for rows.Next() {
+		var d DefectTypeRow
+		if err := rows.Scan(&d.ID, &d.Code, &d.Name, &d.Active, &d.CreatedAt); err != nil {
+			return nil, err
+		}
+		list = append(list, d)
+	}
+	return list, rows.Err()
+}
+
+// CreateDefectType insere um tipo de defeito.
+func CreateDefectType(db *sql.DB, factoryID uuid.UUID, code, name string) (uuid.UUID, error) {
+	code, name = strings.TrimSpace(code), strings.TrimSpace(name)
+	if code == "" || name == "" {
+		return uuid.Nil, fmt.Errorf("%w: code e name são obrigatórios", ErrInvalidInspection)
+	}
+	var id uuid.UUID
+	err := db.QueryRow(`
+		INSERT INTO nxd.defect_types (factory_id, code, name) VALUES ($1, $2, $3)
+		ON CONFLICT (factory_id, code) DO NOTHING
+		RETURNING id
+	`, factoryID, code, name).Scan(&id)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, ErrDefectTypeExists
+	}
+	return id, err
+}
+
+// UpdateDefectType altera nome e/ou ativo. Desativar esconde o tipo de novos
+// registros, mas mantém o histórico. Retorna false se não existir.
+func UpdateDefectType(db *sql.DB, factoryID, id uuid.UUID, name string, active *bool) (bool, error) {
+	res, err := db.Exec(`
+		UPDATE nxd.defect_types SET name = COALESCE(NULLIF($1, ''), name), active = COALESCE($2, active)
+		WHERE id = $3 AND factory_id = $4
+	`, strings.TrimSpace(name), active, id, factoryID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ─── Não conformidades ──────────────────────────────────────────────────────
+
+// validateInspection confere quantidade, datas e se ativo, ordem e tipo são da fábrica.
+func validateInspection(db *sql.DB, factoryID uuid.UUID, in *InspectionRow, now time.Time) error {
+	if !(in.Quantity > 0) {
+		return fmt.Errorf("%w: quantity deve ser positiva", ErrInvalidInspection)
+	}
+	if in.InspectedAt.IsZero() || in.InspectedAt.After(now) {
+		return fmt.Errorf("%w: inspected_at é obrigatório e não pode estar no futuro", ErrInvalidInspection)
+	}
+	if (in.ProducedStart == nil) != (in.ProducedEnd == nil) {
+		return fmt.Errorf("%w: informe produced_start e produced_end juntos", ErrInvalidInspection)
+	}
+	if in.ProducedStart != nil && (in.ProducedEnd.Before(*in.ProducedStart) || in.ProducedEnd.After(in.InspectedAt)) {
+		return fmt.Errorf("%w: produção deve terminar depois de começar e antes da inspeção", ErrInvalidInspection)
+	}
+	if a, err := GetAssetByID(db, in.AssetID, factoryID); err != nil {
+		return err
+	} else if a == nil {
+		return fmt.Errorf("%w: ativo não encontrado", ErrInvalidInspection)
+	}
+	if in.OrderID != nil {
+		if o, err := GetProductionOrder(db, factoryID, *in.OrderID); err != nil {
+			return err
+		} else if o == nil {
+			return fmt.Errorf("%w: ordem não encontrada", ErrInvalidInspection)
+		}
+	}
+	var active sql.NullBool
+	err := db.QueryRow(`SELECT active FROM nxd.defect_types WHERE id = $1 AND factory_id = $2`, in.DefectTypeID, factoryID).Scan(&active)
+	if err != nil && err != sql.ErrNoRows {
+		return err
+	}
+	if !active.Valid {
+		return fmt.Errorf("%w: tipo de defeito não encontrado", ErrInvalidInspection)
+	}
+	if !active.Bool {
+		return fmt.Errorf("%w: tipo de defeito inativo", ErrInvalidInspection)
+	}
+	return nil
+}
+
+// CreateInspection registra uma não conformidade.
+func CreateInspection(db *sql.DB, factoryID uuid.UUID, in InspectionRow, userID int64, now time.Time) (uuid.UUID, error) {
+	if err := validateInspection(db, factoryID, &in, now); err != nil {
+		return uuid.Nil, err
+	}
+	var id uuid.UUID
+	err := db.QueryRow(`
+		INSERT INTO nxd.inspections (factory_id, asset_id, order_id, defect_type_id, quantity, inspected_at,
+			produced_start, produced_end, inspector, notes, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), NULLIF($10, ''), $11)
+		RETURNING id
+	`, factoryID, in.AssetID, in.OrderID, in.DefectTypeID, in.Quantity, in.InspectedAt, in.ProducedStart, in.ProducedEnd,
+		strings.TrimSpace(in.Inspector), strings.TrimSpace(in.Notes), userID).Scan(&id)
+	return id, err
+}
+
+// UpdateInspection substitui os campos editáveis da NC. Retorna false se não existir.
+func UpdateInspection(db *sql.DB, factoryID uuid.UUID, in InspectionRow, now time.Time) (bool, error) {
+	if err := validateInspection(db, factoryID, &in, now); err != nil {
+		return false, err
+	}
+	res, err := db.Exec(`
+		UPDATE nxd.inspections SET asset_id = $3, order_id = $4, defect_type_id = $5, quantity = $6, inspected_at = $7,
+			produced_start = $8, produced_end = $9, inspector = NULLIF($10, ''), notes = NULLIF($11, '')
+		WHERE id = $1 AND factory_id = $2
+	`, in.ID, factoryID, in.AssetID, in.OrderID, in.DefectTypeID, in.Quantity, in.InspectedAt, in.ProducedStart,
+		in.ProducedEnd, strings.TrimSpace(in.Inspector), strings.TrimSpace(in.Notes))
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// DeleteInspection remove a NC e seus anexos. Retorna false se não existir.
+func DeleteInspection(db *sql.DB, factoryID, id uuid.UUID) (bool, error) {
+	res, err := db.Exec(`DELETE FROM nxd.inspections WHERE id = $1 AND factory_id = $2`, id, factoryID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ListInspections retorna as NCs do período (mais recentes primeiro) com os anexos.
+func ListInspections(db *sql.DB, q InspectionQuery) ([]InspectionRow, error) {
+	query := `
+		SELECT i.id, i.asset_id, COALESCE(a.display_name, a.source_tag_id), i.order_id, COALESCE(o.order_code, ''),
+			i.defect_type_id, d.code, d.name, i.quantity, i.inspected_at, i.produced_start, i.produced_end,
+			COALESCE(i.inspector, ''), COALESCE(i.notes, ''), i.created_by, i.created_at
+		FROM nxd.inspections i
+		JOIN nxd.assets a ON a.id = i.asset_id
+		JOIN nxd.defect_types d ON d.id = i.defect_type_id
+		LEFT JOIN nxd.production_orders o ON o.id = i.order_id
+		WHERE i.factory_id = $1 AND i.inspected_at >= $2 AND i.inspected_at < $3`
+	args := []interface{}{q.FactoryID, q.Start, q.End}
+	query, args = inspectionScope(query, args, q)
+	query += ` ORDER BY i.inspected_at DESC, i.id`
+	if q.Limit > 0 {
+		args = append(args, q.Limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	list := []InspectionRow{}
+	idx := map[uuid.UUID]int{}
+	var ids []string
+	for rows.Next() {
+		var in InspectionRow
+		var orderID uuid.NullUUID
+		var pStart, pEnd sql.NullTime
+		var createdBy sql.NullInt64
+		if err := rows.Scan(&in.ID, &in.AssetID, &in.AssetName, &orderID, &in.OrderCode, &in.DefectTypeID, &in.DefectCode,
+			&in.DefectName, &in.Quantity, &in.InspectedAt, &pStart, &pEnd, &in.Inspector, &in.Notes, &createdBy,
+			&in.CreatedAt); err != nil {
+			return nil, err
+		}
+		if orderID.Valid {
+			in.OrderID = &orderID.UUID
+		}
+		if pStart.Valid && pEnd.Valid {
+			in.ProducedStart, in.ProducedEnd = &pStart.Time, &pEnd.Time
+		}
+		if createdBy.Valid {
+			in.CreatedBy = &createdBy.Int64
+		}
+		in.Attachments = []InspectionAttachmentRow{}
+		idx[in.ID] = len(list)
+		ids = append(ids, in.ID.String())
+		list = append(list, in)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(ids) == 0 {
+		return list, nil
+	}
+	att, err := db.Query(`
+		SELECT inspection_id, id, file_name, COALESCE(content_type, ''), size_bytes, storage_url, created_by, created_at
+		FROM nxd.inspection_attachments WHERE inspection_id = ANY($1::uuid[]) ORDER BY created_at, id
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer att.Close()
+	for att.Next() {
+		var inspectionID uuid.UUID
+		var a InspectionAttachmentRow
+		var size, createdBy sql.NullInt64
+		if err := att.Scan(&inspectionID, &a.ID, &a.FileName, &a.ContentType, &size, &a.StorageURL, &createdBy, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		if size.Valid {
+			a.SizeBytes = &size.Int64
+		}
+		if createdBy.Valid {
+			a.CreatedBy = &createdBy.Int64
+		}
+		i := idx[inspectionID]
+		list[i].Attachments = append(list[i].Attachments, a)
+	}
+	return list, att.Err()
+}
+
+// inspectionScope acrescenta os filtros de setor, ativo, ordem e tipo de defeito.
+func inspectionScope(query string, args []interface{}, q InspectionQuery) (string, []interface{}) {
+	if q.SectorID != nil {
+		args = append(args, *q.SectorID)
+		query += fmt.Sprintf(" AND a.group_id = $%d", len(args))
+	}
+	if q.AssetID != nil {
+		args = append(args, *q.AssetID)
+		query += fmt.Sprintf(" AND i.asset_id = $%d", len(args))
+	}
+	if q.OrderID != nil {
+		args = append(args, *q.OrderID)
+		query += fmt.Sprintf(" AND i.order_id = $%d", len(args))
+	}
+	if q.DefectTypeID != nil {
+		args = append(args, *q.DefectTypeID)
+		query += fmt.Sprintf(" AND i.defect_type_id = $%d", len(args))
+	}
+	return query, args
+}
+
+// validateAttachmentURL aceita só https (o link volta para a UI): nada de javascript:,
+// data: ou http. Com NXD_ATTACHMENT_URL_PREFIX, o link deve começar pelo prefixo do storage.
+func validateAttachmentURL(raw, prefix string) error {
+	u, err := url.Parse(raw)
+	if err != nil || u.Scheme != "https" || u.Host == "" || u.User != nil {
+		return fmt.Errorf("%w: storage_url deve ser uma URL https", ErrInvalidInspection)
+	}
+	if prefix != "" && !strings.HasPrefix(raw, prefix) {
+		return fmt.Errorf("%w: storage_url fora do storage de anexos", ErrInvalidInspection)
+	}
+	return nil
+}
+
+// AddInspectionAttachment registra os metadados de um anexo da NC. ErrInvalidInspection
+// se a NC não for da fábrica.
+func AddInspectionAttachment(db *sql.DB, factoryID, inspectionID uuid.UUID, a InspectionAttachmentRow, userID int64) (uuid.UUID, error) {
+	a.FileName, a.StorageURL = strings.TrimSpace(a.FileName), strings.TrimSpace(a.StorageURL)
+	if a.FileName == "" || a.StorageURL == "" {
+		return uuid.Nil, fmt.Errorf("%w: file_name e storage_url são obrigatórios", ErrInvalidInspection)
+	}
+	if a.SizeBytes != nil && *a.SizeBytes < 0 {
+		return uuid.Nil, fmt.Errorf("%w: size_bytes inválido", ErrInvalidInspection)
+	}
+	if err := validateAttachmentURL(a.StorageURL, strings.TrimSpace(os.Getenv("NXD_ATTACHMENT_URL_PREFIX"))); err != nil {
+		return uuid.Nil, err
+	}
+	var id uuid.UUID
+	err := db.QueryRow(`
+		INSERT INTO nxd.inspection_attachments (inspection_id, file_name, content_type, size_bytes, storage_url, created_by)
+		SELECT id, $3, NULLIF($4, ''), $5, $6, $7 FROM nxd.inspections WHERE id = $1 AND factory_id = $2
+		RETURNING id
+	`, inspectionID, factoryID, a.FileName, strings.TrimSpace(a.ContentType), a.SizeBytes, a.StorageURL, userID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, fmt.Errorf("%w: inspeção não encontrada", ErrInvalidInspection)
+	}
+	return id, err
+}
+
+// DeleteInspectionAttachment remove os metadados do anexo. Retorna false se não existir.
+func DeleteInspectionAttachment(db *sql.DB, factoryID, inspectionID, id uuid.UUID) (bool, error) {
+	res, err := db.Exec(`
+		DELETE FROM nxd.inspection_attachments
+		WHERE id = $1 AND inspection_id = $2 AND inspection_id IN (SELECT id FROM nxd.inspections WHERE factory_id = $3)
+	`, id, inspectionID, factoryID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// ─── Pareto por tipo de defeito ─────────────────────────────────────────────
+
+// DefectParetoItem — uma barra do Pareto.
+type DefectParetoItem struct {
+	DefectTypeID  uuid.UUID `json:"defect_type_id"`
+	Code          string    `json:"code"`
+	Name          string    `json:"name"`
+	Records       int       `json:"records"`
+	Quantity      float64   `json:"quantity"`
+	Percent       float64   `json:"percent"`
+	CumulativePct float64   `json:"cumulative_percent"`
+}
+
+// DefectPareto — NCs do período por tipo de defeito, da maior quantidade para a menor.
+type DefectPareto struct {
+	PeriodStart   time.Time          `json:"period_start"`
+	PeriodEnd     time.Time          `json:"period_end"`
+	TotalQuantity float64            `json:"total_quantity"`
+	TotalRecords  int                `json:"total_records"`
+	Items         []DefectParetoItem `json:"items"`
+}
+
+// buildDefectPareto ordena os itens e acumula os percentuais.
+func buildDefectPareto(items []DefectParetoItem) *DefectPareto {
+	p := &DefectPareto{Items: []DefectParetoItem{}}
+	for _, it := range items {
+		if it.Quantity <= 0 {
+			continue
+		}
+		p.Items = append(p.Items, it)
+		p.TotalQuantity += it.Quantity
+		p.TotalRecords += it.Records
+	}
+	sort.SliceStable(p.Items, func(i, j int) bool { return p.Items[i].Quantity > p.Items[j].Quantity })
+	var cum float64
+	for i := range p.Items {
+		p.Items[i].Percent = p.Items[i].Quantity / p.TotalQuantity * 100
+		cum += p.Items[i].Percent
+		p.Items[i].CumulativePct = cum
+	}
+	return p
+}
+
+// ComputeDefectPareto soma as NCs inspecionadas no período por tipo de defeito.
+func ComputeDefectPareto(db *sql.DB, q InspectionQuery) (*DefectPareto, error) {
+	query := `
+		SELECT d.id, d.code, d.name, COUNT(*), SUM(i.quantity)
+		FROM nxd.inspections i
+		JOIN nxd.assets a ON a.id = i.asset_id
+		JOIN nxd.defect_types d ON d.id = i.defect_type_id
+		WHERE i.factory_id = $1 AND i.inspected_at >= $2 AND i.inspected_at < $3`
+	args := []interface{}{q.FactoryID, q.Start, q.End}
+	query, args = inspectionScope(query, args, q)
+	rows, err := db.Query(query+` GROUP BY d.id, d.code, d.name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DefectParetoItem
+	for rows.Next() {
+		var it DefectParetoItem
+		if err := rows.Scan(&it.DefectTypeID, &it.Code, &it.Name, &it.Records, &it.Quantity); err != nil {
+			return nil, err
+		}
+		items = append(items, it)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	p := buildDefectPareto(items)
+	p.PeriodStart, p.PeriodEnd = q.Start, q.End
+	return p, nil
+}
+
+// ─── Reclassificação OK → NOK nos KPIs ──────────────────────────────────────
+
+// qualityDefect — quantidade de uma NC e o intervalo de produção (start == end = instante).
+type qualityDefect struct {
+	qty        float64
+	start, end time.Time
+}
+
+// defectRange resolve o intervalo de produção das peças de uma NC.
+func defectRange(inspectedAt time.Time, producedStart, producedEnd, orderStart, orderEnd *time.Time) (time.Time, time.Time) {
+	switch {
+	case producedStart != nil && producedEnd != nil:
+		return *producedStart, *producedEnd
+	case orderStart != nil && orderStart.Before(inspectedAt):
+		end := inspectedAt
+		if orderEnd != nil && orderEnd.Before(end) {
+			end = *orderEnd
+		}
+		return *orderStart, end
+	}
+	return inspectedAt, inspectedAt
+}
+
+// defectQtyIn soma a parte das NCs produzida em [start, end), proporcional à sobreposição.
+func defectQtyIn(defects []qualityDefect, start, end time.Time) float64 {
+	var total float64
+	for _, d := range defects {
+		if !d.end.After(d.start) {
+			if !d.start.Before(start) && d.start.Before(end) {
+				total += d.qty
+			}
+			continue
+		}
+		s, e := d.start, d.end
+		if s.Before(start) {
+			s = start
+		}
+		if e.After(end) {
+			e = end
+		}
+		if e.After(s) {
+			total += d.qty * e.Sub(s).Seconds() / d.end.Sub(d.start).Seconds()
+		}
+	}
+	return total
+}
+
+// reclassifyDefects passa qty peças de OK para NOK (OK não fica negativo).
+func reclassifyDefects(ok, nok, qty float64) (float64, float64) {
+	if qty <= 0 {
+		return ok, nok
+	}
+	ok -= qty
+	if ok < 0 {
+		ok = 0
+	}
+	return ok, nok + qty
+}
+
+// loadQualityDefects lê as NCs dos ativos que podem ter peças produzidas em [start, end).
+func loadQualityDefects(db *sql.DB, assetIDs []uuid.UUID, start, end time.Time) (map[uuid.UUID][]qualityDefect, error) {
+	out := map[uuid.UUID][]qualityDefect{}
+	if len(assetIDs) == 0 {
+		return out, nil
+	}
+	ids := make([]string, len(assetIDs))
+	for i, id := range assetIDs {
+		ids[i] = id.String()
+	}
+	// O intervalo de produção termina até a inspeção: inspected_at >= start é necessário.
+	rows, err := db.Query(`
+		SELECT i.asset_id, i.quantity, i.inspected_at, i.produced_start, i.produced_end, o.started_at, o.ended_at
+		FROM nxd.inspections i
+		LEFT JOIN nxd.production_orders o ON o.id = i.order_id
+		WHERE i.asset_id = ANY($1::uuid[]) AND i.inspected_at >= $2
+			AND COALESCE(i.produced_start, o.started_at, i.inspected_at) < $3
+	`, pq.Array(ids), start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var assetID uuid.UUID
+		var qty float64
+		var inspectedAt time.Time
+		var pStart, pEnd, oStart, oEnd sql.NullTime
+		if err := rows.Scan(&assetID, &qty, &inspectedAt, &pStart, &pEnd, &oStart, &oEnd); err != nil {
+			return nil, err
+		}
+		s, e := defectRange(inspectedAt, nullTimePtr(pStart), nullTimePtr(pEnd), nullTimePtr(oStart), nullTimePtr(oEnd))
+		out[assetID] = append(out[assetID], qualityDefect{qty: qty, start: s, end: e})
+	}
+	return out, rows.Err()
+}
+
+func nullTimePtr(t sql.NullTime) *time.Time {
+	if !t.Valid {
+		return nil
+	}
+	return &t.Time
+}
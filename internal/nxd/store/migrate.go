@@ -0,0 +1,367 @@
+package store
+
+// migrate.go — Versioned schema migrations (schema_migrations table)
+//
+// Each MigrationSet owns one tracking table (e.g. nxd.schema_migrations for the
+// NXD store, public.schema_migrations for the legacy API tables). A migration
+// is applied at most once: its version, name and checksum are recorded in the
+// tracking table inside the same transaction that executes its Up statements.
+//
+// Rules:
+//   - Versions are positive, strictly increasing inside a set and never reused.
+//   - A released migration is never edited: the checksum of its Up statements
+//     is stored, and MigrationStatus flags rows whose definition changed.
+//   - Optional migrations (e.g. TimescaleDB hypertables) may fail; the failure
+//     is rolled back and recorded as skipped, with the error, so it shows up in
+//     the status report instead of being silently ignored on every boot.
+//   - On PostgreSQL, MigrateUp/MigrateDown hold a session advisory lock so two
+//     Cloud Run instances booting at the same time do not race.
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"strings"
+	"time"
+)
+
+// Migration is one numbered, reversible schema change.
+type Migration struct {
+	Version  int
+	Name     string
+	Up       []string
+	Down     []string
+	Optional bool // failure is recorded as skipped instead of aborting the run
+}
+
+// Checksum returns a stable hash of the Up statements.
+func (m Migration) Checksum() string {
+	h := sha256.New()
+	for _, s := range m.Up {
+		h.Write([]byte(strings.TrimSpace(s)))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// MigrationSet is an ordered list of migrations tracked in a single table.
+type MigrationSet struct {
+	Name       string // "nxd" | "legacy"
+	Table      string // tracking table, e.g. "nxd.schema_migrations"
+	Driver     string // "postgres" | "sqlite3" | "sqlite"
+	Migrations []Migration
+}
+
+// MigrationStatusRow is one line of the status report (CLI and HTTP).
+type MigrationStatusRow struct {
+	Version     int        `json:"version"`
+	Name        string     `json:"name"`
+	Optional    bool       `json:"optional,omitempty"`
+	Applied     bool       `json:"applied"`
+	Skipped     bool       `json:"skipped,omitempty"`
+	SkipError   string     `json:"skip_error,omitempty"`
+	AppliedAt   *time.Time `json:"applied_at,omitempty"`
+	ExecutionMs int64      `json:"execution_ms,omitempty"`
+	Modified    bool       `json:"modified,omitempty"` // Up statements changed after being applied
+	Unknown     bool       `json:"unknown,omitempty"`  // recorded in the DB but not defined in this binary
+}
+
+type appliedMigration struct {
+	name      string
+	checksum  string
+	skipError sql.NullString
+	appliedAt time.Time
+	execMs    int64
+}
+
+func (s MigrationSet) isPostgres() bool {
+	return s.Driver == "postgres"
+}
+
+func (s MigrationSet) validate() error {
+	prev := 0
+	for _, m := range s.Migrations {
+		if m.Version <= prev {
+			return fmt.Errorf("migrations %s: versão %d fora de ordem (anterior %d)", s.Name, m.Version, prev)
+		}
+		prev = m.Version
+	}
+	return nil
+}
+
+func (s MigrationSet) ensureTable(ctx context.Context, conn *sql.Conn) error {
+	var ddl string
+	if s.isPostgres() {
+		ddl = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			version INT PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			skip_error TEXT,
+			execution_ms BIGINT NOT NULL DEFAULT 0,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+		)`, s.Table)
+		if i := strings.Index(s.Table, "."); i > 0 {
+			if _, err := conn.ExecContext(ctx, "CREATE SCHEMA IF NOT EXISTS "+s.Table[:i]); err != nil {
+				return err
+			}
+		}
+	} else {
+		ddl = fmt.Sprintf(`CREATE TABLE IF NOT EXISTS %s (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			checksum TEXT NOT NULL,
+			skip_error TEXT,
+			execution_ms INTEGER NOT NULL DEFAULT 0,
+			applied_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`, s.Table)
+	}
+	_, err := conn.ExecContext(ctx, ddl)
+	return err
+}
+
+// tableExists reports whether the tracking table exists, without creating it.
+func (s MigrationSet) tableExists(ctx context.Context, conn *sql.Conn) (bool, error) {
+	var ok bool
+	var err error
+	if s.isPostgres() {
+		err = conn.QueryRowContext(ctx, `SELECT to_regclass($1) IS NOT NULL`, s.Table).Scan(&ok)
+	} else {
+		err = conn.QueryRowContext(ctx, `SELECT COUNT(*) > 0 FROM sqlite_master WHERE type = 'table' AND name = ?`, s.Table).Scan(&ok)
+	}
+	return ok, err
+}
+
+func (s MigrationSet) loadApplied(ctx context.Context, q interface {
+	QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error)
+}) (map[int]appliedMigration, error) {
+	rows, err := q.QueryContext(ctx, fmt.Sprintf(
+		`SELECT version, name, checksum, skip_error, applied_at, execution_ms FROM %s ORDER BY version`, s.Table))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	out := map[int]appliedMigration{}
+	for rows.Next() {
+		var v int
+		var a appliedMigration
+		if err := rows.Scan(&v, &a.name, &a.checksum, &a.skipError, &a.appliedAt, &a.execMs); err != nil {
+			return nil, err
+		}
+		out[v] = a
+	}
+	return out, rows.Err()
+}
+
+// lock takes a dedicated connection and, on PostgreSQL, a session advisory lock
+// keyed by the tracking table name. The returned func releases both.
+func (s MigrationSet) lock(ctx context.Context, db *sql.DB) (*sql.Conn, func(), error) {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !s.isPostgres() {
+		return conn, func() { conn.Close() }, nil
+	}
+	h := fnv.New64a()
+	h.Write([]byte(s.Table))
+	key := int64(h.Sum64() >> 1)
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, key); err != nil {
+		conn.Close()
+		return nil, nil, fmt.Errorf("advisory lock: %w", err)
+	}
+	return conn, func() {
+		_, _ = conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, key)
+		conn.Close()
+	}, nil
+}
+
+// MigrateUp applies every pending migration in version order. Returns how many were applied (skipped optional ones included).
+func MigrateUp(db *sql.DB, set MigrationSet) (int, error) {
+	if err := set.validate(); err != nil {
+		return 0, err
+	}
+	ctx := context.Background()
+	conn, unlock, err := set.lock(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	if err := set.ensureTable(ctx, conn); err != nil {
+		return 0, fmt.Errorf("criar %s: %w", set.Table, err)
+	}
+	applied, err := set.loadApplied(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+
+	known := map[int]bool{}
+	n := 0
+	for _, m := range set.Migrations {
+		known[m.Version] = true
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		start := time.Now()
+		runErr := execInTx(ctx, conn, m.Up, func(tx *sql.Tx) error {
+			return set.record(ctx, tx, m, nil, time.Since(start))
+		})
+		if runErr != nil {
+			if !m.Optional {
+				return n, fmt.Errorf("migration %s %03d_%s: %w", set.Name, m.Version, m.Name, runErr)
+			}
+			log.Printf("⚠️  Migration opcional %s %03d_%s marcada como skipped: %v", set.Name, m.Version, m.Name, runErr)
+			msg := runErr.Error()
+			if err := execInTx(ctx, conn, nil, func(tx *sql.Tx) error {
+				return set.record(ctx, tx, m, &msg, time.Since(start))
+			}); err != nil {
+				return n, fmt.Errorf("registrar skip %03d: %w", m.Version, err)
+			}
+		} else {
+			log.Printf("✓ Migration %s %03d_%s aplicada (%s)", set.Name, m.Version, m.Name, time.Since(start).Round(time.Millisecond))
+		}
+		n++
+	}
+	for v, a := range applied {
+		if !known[v] {
+			log.Printf("⚠️  Migration %s %03d_%s está no banco mas não neste binário (banco mais novo que o código?)", set.Name, v, a.name)
+		}
+	}
+	return n, nil
+}
+
+// MigrateDown reverts the last `steps` applied migrations, newest first.
+// Skipped optional migrations are only unrecorded (their Up never ran).
+func MigrateDown(db *sql.DB, set MigrationSet, steps int) (int, error) {
+	if steps <= 0 {
+		return 0, nil
+	}
+	if err := set.validate(); err != nil {
+		return 0, err
+	}
+	ctx := context.Background()
+	conn, unlock, err := set.lock(ctx, db)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+	if err := set.ensureTable(ctx, conn); err != nil {
+		return 0, err
+	}
+	applied, err := set.loadApplied(ctx, conn)
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for i := len(set.Migrations) - 1; i >= 0 && n < steps; i-- {
+		m := set.Migrations[i]
+		a, ok := applied[m.Version]
+		if !ok {
+			continue
+		}
+		stmts := m.Down
+		if a.skipError.Valid {
+			stmts = nil
+		} else if len(stmts) == 0 {
+			return n, fmt.Errorf("migration %s %03d_%s não tem down", set.Name, m.Version, m.Name)
+		}
+		err := execInTx(ctx, conn, stmts, func(tx *sql.Tx) error {
+			_, err := tx.ExecContext(ctx, fmt.Sprintf(`DELETE FROM %s WHERE version = $1`, set.Table), m.Version)
+			return err
+		})
+		if err != nil {
+			return n, fmt.Errorf("down %s %03d_%s: %w", set.Name, m.Version, m.Name, err)
+		}
+		log.Printf("↩️  Migration %s %03d_%s revertida", set.Name, m.Version, m.Name)
+		n++
+	}
+	return n, nil
+}
+
+// MigrationStatus merges the set definition with the tracking table. It is
+// read-only: without the tracking table every migration is reported as pending.
+func MigrationStatus(db *sql.DB, set MigrationSet) ([]MigrationStatusRow, error) {
+	ctx := context.Background()
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	// Só leitura: sem a tabela de controle, tudo está pendente (a DDL fica para Migrate).
+	exists, err := set.tableExists(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	applied := map[int]appliedMigration{}
+	if exists {
+		if applied, err = set.loadApplied(ctx, conn); err != nil {
+			return nil, err
+		}
+	}
+	out := make([]MigrationStatusRow, 0, len(set.Migrations))
+	for _, m := range set.Migrations {
+		row := MigrationStatusRow{Version: m.Version, Name: m.Name, Optional: m.Optional}
+		if a, ok := applied[m.Version]; ok {
+			t := a.appliedAt
+			row.Applied = true
+			row.AppliedAt = &t
+			row.ExecutionMs = a.execMs
+			row.Modified = a.checksum != m.Checksum()
+			if a.skipError.Valid {
+				row.Skipped = true
+				row.SkipError = a.skipError.String
+			}
+			delete(applied, m.Version)
+		}
+		out = append(out, row)
+	}
+	for v, a := range applied {
+		t := a.appliedAt
+		out = append(out, MigrationStatusRow{Version: v, Name: a.name, Applied: true, AppliedAt: &t, Unknown: true})
+	}
+	return out, nil
+}
+
+// PendingMigrations returns how many migrations of the set are not yet recorded.
+func PendingMigrations(rows []MigrationStatusRow) int {
+	n := 0
+	for _, r := range rows {
+		if !r.Applied {
+			n++
+		}
+	}
+	return n
+}
+
+func (s MigrationSet) record(ctx context.Context, tx *sql.Tx, m Migration, skipErr *string, elapsed time.Duration) error {
+	_, err := tx.ExecContext(ctx,
+		fmt.Sprintf(`INSERT INTO %s (version, name, checksum, skip_error, execution_ms) VALUES ($1, $2, $3, $4, $5)`, s.Table),
+		m.Version, m.Name, m.Checksum(), skipErr, elapsed.Milliseconds(),
+	)
+	return err
+}
+
+// execInTx runs stmts and then after() in one transaction on conn.
+func execInTx(ctx context.Context, conn *sql.Conn, stmts []string, after func(tx *sql.Tx) error) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for i, q := range stmts {
+		if _, err := tx.ExecContext(ctx, q); err != nil {
+			_ = tx.Rollback()
+			return fmt.Errorf("statement %d: %w", i+1, err)
+		}
+	}
+	if after != nil {
+		if err := after(tx); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,120 @@
+package store
+
+// migrate_test.go — Tests for the versioned migration engine, on an in-memory
+// SQLite database (no TEST_DATABASE_URL needed).
+
+import (
+	"database/sql"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+func openSQLiteMemory(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", "file::memory:?cache=shared")
+	if err != nil {
+		t.Fatalf("sql.Open: %v", err)
+	}
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { db.Close() })
+	return db
+}
+
+func testMigrationSet() MigrationSet {
+	return MigrationSet{
+		Name:   "test",
+		Table:  "schema_migrations",
+		Driver: "sqlite3",
+		Migrations: []Migration{
+			{Version: 1, Name: "a", Up: []string{`CREATE TABLE a (id INTEGER)`}, Down: []string{`DROP TABLE a`}},
+			{Version: 2, Name: "broken_optional", Optional: true, Up: []string{`SELECT create_hypertable('a')`}, Down: []string{`SELECT 1`}},
+			{Version: 3, Name: "b", Up: []string{`CREATE TABLE b (id INTEGER)`}, Down: []string{`DROP TABLE b`}},
+		},
+	}
+}
+
+func TestMigrateUpDownStatus(t *testing.T) {
+	db := openSQLiteMemory(t)
+	set := testMigrationSet()
+
+	n, err := MigrateUp(db, set)
+	if err != nil || n != 3 {
+		t.Fatalf("MigrateUp = %d, %v; want 3, nil", n, err)
+	}
+	// Second run is a no-op.
+	if n, err := MigrateUp(db, set); err != nil || n != 0 {
+		t.Fatalf("second MigrateUp = %d, %v; want 0, nil", n, err)
+	}
+
+	rows, err := MigrationStatus(db, set)
+	if err != nil {
+		t.Fatalf("MigrationStatus: %v", err)
+	}
+	if len(rows) != 3 || PendingMigrations(rows) != 0 {
+		t.Fatalf("status = %+v", rows)
+	}
+	if !rows[1].Skipped || rows[1].SkipError == "" {
+		t.Errorf("optional migration should be recorded as skipped, got %+v", rows[1])
+	}
+
+	if n, err := MigrateDown(db, set, 2); err != nil || n != 2 {
+		t.Fatalf("MigrateDown = %d, %v; want 2, nil", n, err)
+	}
+	if _, err := db.Exec(`SELECT * FROM b`); err == nil {
+		t.Error("table b should be dropped after down")
+	}
+	rows, _ = MigrationStatus(db, set)
+	if PendingMigrations(rows) != 2 {
+		t.Errorf("pending after down = %d, want 2", PendingMigrations(rows))
+	}
+}
+
+func TestMigrationStatusIsReadOnly(t *testing.T) {
+	db := openSQLiteMemory(t)
+	set := testMigrationSet()
+
+	rows, err := MigrationStatus(db, set)
+	if err != nil {
+		t.Fatalf("MigrationStatus: %v", err)
+	}
+	if len(rows) != 3 || PendingMigrations(rows) != 3 {
+		t.Fatalf("status without tracking table = %+v", rows)
+	}
+	var n int
+	db.QueryRow(`SELECT COUNT(*) FROM sqlite_master WHERE name = 'schema_migrations'`).Scan(&n)
+	if n != 0 {
+		t.Error("MigrationStatus must not create the tracking table")
+	}
+}
+
+func TestMigrateUpRollsBackFailedMigration(t *testing.T) {
+	db := openSQLiteMemory(t)
+	set := MigrationSet{Name: "test", Table: "schema_migrations", Driver: "sqlite3", Migrations: []Migration{
+		{Version: 1, Name: "half", Up: []string{`CREATE TABLE c (id INTEGER)`, `INVALID SQL`}},
+	}}
+	if _, err := MigrateUp(db, set); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := db.Exec(`SELECT * FROM c`); err == nil {
+		t.Error("table c should not exist: migration must run in a transaction")
+	}
+	rows, _ := MigrationStatus(db, set)
+	if rows[0].Applied {
+		t.Error("failed migration must not be recorded")
+	}
+}
+
+func TestMigrationSetsAreOrdered(t *testing.T) {
+	for _, driver := range []string{"postgres", "sqlite3"} {
+		set := NXDMigrationSet(driver)
+		if err := set.validate(); err != nil {
+			t.Errorf("%s: %v", driver, err)
+		}
+		for _, m := range set.Migrations {
+			if len(m.Down) == 0 {
+				t.Errorf("%s %03d_%s has no down", driver, m.Version, m.Name)
+			}
+		}
+	}
+}
@@ -2,377 +2,1351 @@ package store
 
 import (
 	"database/sql"
-	"fmt"
-	"log"
 )
 
-// optionalMigrations are executed but failures are only logged, not fatal.
-// Used for extensions that may not be available (e.g. TimescaleDB).
-var optionalMigrations = map[string]bool{
-	`SELECT create_hypertable('nxd.asset_telemetry', 'ts', if_not_exists => TRUE)`:  true,
-	`SELECT create_hypertable('nxd.telemetry_log', 'ts', if_not_exists => TRUE)`:    true,
+// RunMigrations aplica as migrations pendentes do schema NXD (ver migrate.go).
+// Mantido com a assinatura antiga: é chamado por InitNXDDB a cada boot.
+func RunMigrations(db *sql.DB, driver string) error {
+	_, err := MigrateUp(db, NXDMigrationSet(driver))
+	return err
 }
 
-func RunMigrations(db *sql.DB, driver string) error {
-	var migrations []string
+// NXDMigrationSet retorna as migrations do schema nxd para o driver.
+// Regras: nunca editar uma migration já publicada — criar uma nova versão.
+func NXDMigrationSet(driver string) MigrationSet {
 	if driver == "postgres" {
-		migrations = postgresMigrations
-	} else {
-		migrations = sqliteMigrations
-	}
-
-	for i, m := range migrations {
-		if _, err := db.Exec(m); err != nil {
-			if optionalMigrations[m] {
-				log.Printf("⚠️  Migration opcional %d ignorada (%s): %v", i+1, driver, err)
-				continue
-			}
-			return fmt.Errorf("migration %d (%s): %w", i+1, driver, err)
-		}
+		return MigrationSet{Name: "nxd", Table: "nxd.schema_migrations", Driver: driver, Migrations: postgresMigrations}
 	}
-	return nil
+	return MigrationSet{Name: "nxd", Table: "schema_migrations", Driver: driver, Migrations: sqliteMigrations}
 }
 
-var postgresMigrations = []string{
-	// Schema
-	`CREATE SCHEMA IF NOT EXISTS nxd`,
-
-	// Users
-	`CREATE TABLE IF NOT EXISTS nxd.users (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		name TEXT NOT NULL,
-		email TEXT NOT NULL UNIQUE,
-		password_hash TEXT NOT NULL,
-		created_at TIMESTAMPTZ DEFAULT NOW(),
-		updated_at TIMESTAMPTZ DEFAULT NOW()
-	)`,
-
-	// Factories
-	`CREATE TABLE IF NOT EXISTS nxd.factories (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		user_id UUID REFERENCES nxd.users(id) ON DELETE CASCADE,
-		name TEXT NOT NULL DEFAULT 'Minha Fábrica',
-		api_key TEXT,
-		api_key_hash BYTEA,
-		is_active BOOLEAN DEFAULT TRUE,
-		created_at TIMESTAMPTZ DEFAULT NOW(),
-		updated_at TIMESTAMPTZ DEFAULT NOW()
-	)`,
-
-	// Sectors (groups of assets inside a factory)
-	`CREATE TABLE IF NOT EXISTS nxd.sectors (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		factory_id UUID REFERENCES nxd.factories(id) ON DELETE CASCADE,
-		name TEXT NOT NULL,
-		description TEXT,
-		created_at TIMESTAMPTZ DEFAULT NOW(),
-		updated_at TIMESTAMPTZ DEFAULT NOW()
-	)`,
-
-	// Drop old assets table if it has wrong schema (missing factory_id)
-	// We use a DO block so it's idempotent
-	`DO $$
-	BEGIN
-		IF EXISTS (
-			SELECT 1 FROM information_schema.tables
-			WHERE table_schema = 'nxd' AND table_name = 'assets'
-		) AND NOT EXISTS (
-			SELECT 1 FROM information_schema.columns
-			WHERE table_schema = 'nxd' AND table_name = 'assets' AND column_name = 'factory_id'
-		) THEN
-			DROP TABLE IF EXISTS nxd.asset_telemetry CASCADE;
-			DROP TABLE IF EXISTS nxd.assets CASCADE;
-		END IF;
-	END $$`,
-
-	// Assets (devices/CLPs reporting telemetry)
-	`CREATE TABLE IF NOT EXISTS nxd.assets (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
-		group_id UUID REFERENCES nxd.sectors(id) ON DELETE SET NULL,
-		source_tag_id TEXT NOT NULL,
-		display_name TEXT NOT NULL,
-		description TEXT,
-		annotations JSONB,
-		created_at TIMESTAMPTZ DEFAULT NOW(),
-		updated_at TIMESTAMPTZ DEFAULT NOW(),
-		UNIQUE(factory_id, source_tag_id)
-	)`,
-
-	// Raw telemetry (time-series)
-	`CREATE TABLE IF NOT EXISTS nxd.asset_telemetry (
-		ts TIMESTAMPTZ NOT NULL,
-		asset_id UUID NOT NULL REFERENCES nxd.assets(id) ON DELETE CASCADE,
-		metric_key TEXT NOT NULL,
-		metric_value DOUBLE PRECISION NOT NULL
-	)`,
-	`SELECT create_hypertable('nxd.asset_telemetry', 'ts', if_not_exists => TRUE)`,
-
-	// Audit log
-	`CREATE TABLE IF NOT EXISTS nxd.audit_log (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		ts TIMESTAMPTZ DEFAULT NOW(),
-		factory_id UUID REFERENCES nxd.factories(id) ON DELETE CASCADE,
-		actor_user_id UUID,
-		action TEXT NOT NULL,
-		entity_type TEXT,
-		entity_id TEXT,
-		api_key TEXT,
-		device_id TEXT,
-		status TEXT,
-		message TEXT,
-		ip_address TEXT
-	)`,
-
-	// Asset metric catalog (tracks which metrics each asset reports)
-	`CREATE TABLE IF NOT EXISTS nxd.asset_metric_catalog (
-		factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
-		asset_id UUID NOT NULL REFERENCES nxd.assets(id) ON DELETE CASCADE,
-		metric_key TEXT NOT NULL,
-		first_seen TIMESTAMPTZ DEFAULT NOW(),
-		last_seen TIMESTAMPTZ DEFAULT NOW(),
-		PRIMARY KEY (factory_id, asset_id, metric_key)
-	)`,
-
-	// Telemetry log (enriched ingest log with correlation IDs)
-	`CREATE TABLE IF NOT EXISTS nxd.telemetry_log (
-		ts TIMESTAMPTZ NOT NULL DEFAULT NOW(),
-		factory_id UUID REFERENCES nxd.factories(id) ON DELETE CASCADE,
-		asset_id UUID REFERENCES nxd.assets(id) ON DELETE CASCADE,
-		metric_key TEXT,
-		metric_value DOUBLE PRECISION,
-		status TEXT,
-		raw JSONB,
-		correlation_id TEXT
-	)`,
-	`SELECT create_hypertable('nxd.telemetry_log', 'ts', if_not_exists => TRUE)`,
-
-	// ─── Performance indexes on telemetry_log ───────────────────────────────
-	// These are critical for dashboard queries on large datasets.
-	// CREATE INDEX CONCURRENTLY is not allowed inside transactions, so we use
-	// a regular CREATE INDEX with IF NOT EXISTS (idempotent).
-	`CREATE INDEX IF NOT EXISTS idx_telemetry_log_asset_ts
-		ON nxd.telemetry_log (asset_id, ts DESC)
-		WHERE asset_id IS NOT NULL`,
-	`CREATE INDEX IF NOT EXISTS idx_telemetry_log_factory_ts
-		ON nxd.telemetry_log (factory_id, ts DESC)
-		WHERE factory_id IS NOT NULL`,
-	`CREATE INDEX IF NOT EXISTS idx_telemetry_log_asset_metric_ts
-		ON nxd.telemetry_log (asset_id, metric_key, ts DESC)
-		WHERE asset_id IS NOT NULL AND metric_key IS NOT NULL`,
-
-	// ─── api_key_prefix for O(1) ingest authentication ───────────────────────
-	// Add api_key_prefix column to nxd.factories for fast API key lookup.
-	// Uses ALTER TABLE ... ADD COLUMN IF NOT EXISTS (PostgreSQL 9.6+) — idempotent.
-	// The prefix is the first 16 chars of the plaintext key (NXD_xxxxxxxxxxxx).
-	// It is NOT secret: it cannot be used to reconstruct the key, and bcrypt
-	// comparison still happens as the second verification step.
-	`ALTER TABLE nxd.factories ADD COLUMN IF NOT EXISTS api_key_prefix TEXT`,
-	`CREATE INDEX IF NOT EXISTS idx_factories_api_key_prefix ON nxd.factories (api_key_prefix) WHERE api_key_prefix IS NOT NULL`,
-	// Backfill prefix from existing plaintext api_key column (safe: non-destructive).
-	`UPDATE nxd.factories SET api_key_prefix = LEFT(api_key, 16) WHERE api_key IS NOT NULL AND api_key_prefix IS NULL`,
-
-	// ─── Fix nxd.sectors schema ──────────────────────────────────────────────
-	// The original CREATE TABLE IF NOT EXISTS for nxd.sectors may have been executed
-	// without the factory_id column if the table existed from a prior schema version.
-	// These ALTER TABLE ... ADD COLUMN IF NOT EXISTS statements bring it up to spec.
-	// Idempotent: IF NOT EXISTS means they are safe to run multiple times.
-	`ALTER TABLE nxd.sectors ADD COLUMN IF NOT EXISTS factory_id UUID REFERENCES nxd.factories(id) ON DELETE CASCADE`,
-	`CREATE INDEX IF NOT EXISTS idx_sectors_factory_id ON nxd.sectors (factory_id) WHERE factory_id IS NOT NULL`,
+// As migrations 1–14 reproduzem, na mesma ordem, a lista plana usada antes do
+// controle de versão. Todas são idempotentes (IF NOT EXISTS), então bancos
+// existentes as registram sem alteração no primeiro boot.
+//
+// O antigo bloco DO $$ que apagava nxd.assets/nxd.asset_telemetry quando
+// assets não tinha factory_id foi removido: todo banco existente já passou por
+// ele, e um DROP silencioso no boot não é aceitável com dados de produção.
+var postgresMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "core_users_factories_sectors",
+		Up: []string{
+			`CREATE SCHEMA IF NOT EXISTS nxd`,
 
-	// Alert rules
-	`CREATE TABLE IF NOT EXISTS nxd.alert_rules (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
-		scope_type TEXT NOT NULL,
-		scope_id UUID,
-		condition_type TEXT NOT NULL,
-		threshold DOUBLE PRECISION,
-		channel TEXT,
-		created_at TIMESTAMPTZ DEFAULT NOW()
-	)`,
+			// Users
+			`CREATE TABLE IF NOT EXISTS nxd.users (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				name TEXT NOT NULL,
+				email TEXT NOT NULL UNIQUE,
+				password_hash TEXT NOT NULL,
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				updated_at TIMESTAMPTZ DEFAULT NOW()
+			)`,
 
-	// Alerts fired
-	`CREATE TABLE IF NOT EXISTS nxd.alerts (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		ts TIMESTAMPTZ DEFAULT NOW(),
-		rule_id UUID REFERENCES nxd.alert_rules(id) ON DELETE CASCADE,
-		asset_id UUID REFERENCES nxd.assets(id) ON DELETE CASCADE,
-		group_id UUID,
-		severity TEXT,
-		message TEXT,
-		acknowledged_by UUID,
-		acknowledged_at TIMESTAMPTZ
-	)`,
+			// Factories
+			`CREATE TABLE IF NOT EXISTS nxd.factories (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				user_id UUID REFERENCES nxd.users(id) ON DELETE CASCADE,
+				name TEXT NOT NULL DEFAULT 'Minha Fábrica',
+				api_key TEXT,
+				api_key_hash BYTEA,
+				is_active BOOLEAN DEFAULT TRUE,
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				updated_at TIMESTAMPTZ DEFAULT NOW()
+			)`,
 
-	// Telemetry rollup 1-minute buckets
-	`CREATE TABLE IF NOT EXISTS nxd.telemetry_rollup_1m (
-		bucket_ts TIMESTAMPTZ NOT NULL,
-		factory_id UUID NOT NULL,
-		asset_id UUID NOT NULL,
-		metric_key TEXT NOT NULL,
-		avg_value DOUBLE PRECISION,
-		min_value DOUBLE PRECISION,
-		max_value DOUBLE PRECISION,
-		samples INT,
-		status_counts JSONB,
-		PRIMARY KEY (bucket_ts, factory_id, asset_id, metric_key)
-	)`,
+			// Sectors (groups of assets inside a factory)
+			`CREATE TABLE IF NOT EXISTS nxd.sectors (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				name TEXT NOT NULL,
+				description TEXT,
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				updated_at TIMESTAMPTZ DEFAULT NOW()
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS nxd.sectors CASCADE`,
+			`DROP TABLE IF EXISTS nxd.factories CASCADE`,
+			`DROP TABLE IF EXISTS nxd.users CASCADE`,
+		},
+	},
+	{
+		Version: 2,
+		Name:    "assets_and_raw_telemetry",
+		Up: []string{
+			// Assets (devices/CLPs reporting telemetry)
+			`CREATE TABLE IF NOT EXISTS nxd.assets (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				group_id UUID REFERENCES nxd.sectors(id) ON DELETE SET NULL,
+				source_tag_id TEXT NOT NULL,
+				display_name TEXT NOT NULL,
+				description TEXT,
+				annotations JSONB,
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				updated_at TIMESTAMPTZ DEFAULT NOW(),
+				UNIQUE(factory_id, source_tag_id)
+			)`,
 
-	// Report templates
-	`CREATE TABLE IF NOT EXISTS nxd.report_templates (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		category TEXT,
-		name TEXT NOT NULL,
-		description TEXT,
-		default_filters JSONB,
-		prompt_instructions TEXT,
-		output_schema_version TEXT,
-		created_at TIMESTAMPTZ DEFAULT NOW()
-	)`,
+			// Raw telemetry (time-series)
+			`CREATE TABLE IF NOT EXISTS nxd.asset_telemetry (
+				ts TIMESTAMPTZ NOT NULL,
+				asset_id UUID NOT NULL REFERENCES nxd.assets(id) ON DELETE CASCADE,
+				metric_key TEXT NOT NULL,
+				metric_value DOUBLE PRECISION NOT NULL
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS nxd.asset_telemetry CASCADE`,
+			`DROP TABLE IF EXISTS nxd.assets CASCADE`,
+		},
+	},
+	{
+		// TimescaleDB pode não estar disponível (ex.: Cloud SQL sem extensão).
+		Version:  3,
+		Name:     "asset_telemetry_hypertable",
+		Optional: true,
+		Up: []string{
+			`SELECT create_hypertable('nxd.asset_telemetry', 'ts', if_not_exists => TRUE)`,
+		},
+		// Uma hypertable não volta a ser tabela comum; o down da 2 a remove.
+		Down: []string{`SELECT 1`},
+	},
+	{
+		Version: 4,
+		Name:    "audit_log_metric_catalog_telemetry_log",
+		Up: []string{
+			// Audit log
+			`CREATE TABLE IF NOT EXISTS nxd.audit_log (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				ts TIMESTAMPTZ DEFAULT NOW(),
+				factory_id UUID REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				actor_user_id UUID,
+				action TEXT NOT NULL,
+				entity_type TEXT,
+				entity_id TEXT,
+				api_key TEXT,
+				device_id TEXT,
+				status TEXT,
+				message TEXT,
+				ip_address TEXT
+			)`,
 
-	// Report runs
-	`CREATE TABLE IF NOT EXISTS nxd.report_runs (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		factory_id UUID REFERENCES nxd.factories(id) ON DELETE CASCADE,
-		requested_by UUID,
-		filters JSONB,
-		prompt_contract TEXT,
-		status TEXT DEFAULT 'pending',
-		result_json JSONB,
-		export_url TEXT,
-		created_at TIMESTAMPTZ DEFAULT NOW(),
-		updated_at TIMESTAMPTZ DEFAULT NOW()
-	)`,
+			// Asset metric catalog (tracks which metrics each asset reports)
+			`CREATE TABLE IF NOT EXISTS nxd.asset_metric_catalog (
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				asset_id UUID NOT NULL REFERENCES nxd.assets(id) ON DELETE CASCADE,
+				metric_key TEXT NOT NULL,
+				first_seen TIMESTAMPTZ DEFAULT NOW(),
+				last_seen TIMESTAMPTZ DEFAULT NOW(),
+				PRIMARY KEY (factory_id, asset_id, metric_key)
+			)`,
 
-	// ─── Historical import jobs (base for "download longo" feature) ──────────
-	// Tracks background imports of historical DX data.
-	// status lifecycle: pending → running → done | failed | cancelled
-	// rows_total/rows_done enable real progress percentage in the UI.
-	// batch_size controls how many rows are inserted per DB transaction
-	// (default 1000 — balances memory vs. commit overhead).
-	// source_config stores DX connection details (endpoint, auth) as JSONB
-	// so the import worker can reconnect to the DX autonomously.
-	`CREATE TABLE IF NOT EXISTS nxd.import_jobs (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
-		asset_id UUID REFERENCES nxd.assets(id) ON DELETE SET NULL,
-		requested_by UUID,
-		status TEXT NOT NULL DEFAULT 'pending',
-		period_start TIMESTAMPTZ,
-		period_end TIMESTAMPTZ,
-		rows_total BIGINT DEFAULT 0,
-		rows_done BIGINT DEFAULT 0,
-		batch_size INT DEFAULT 1000,
-		source_type TEXT DEFAULT 'dx_http',
-		source_config JSONB,
-		error_message TEXT,
-		started_at TIMESTAMPTZ,
-		finished_at TIMESTAMPTZ,
-		created_at TIMESTAMPTZ DEFAULT NOW(),
-		updated_at TIMESTAMPTZ DEFAULT NOW()
-	)`,
-	`CREATE INDEX IF NOT EXISTS idx_import_jobs_factory_status
-		ON nxd.import_jobs (factory_id, status)
-		WHERE status IN ('pending', 'running')`,
+			// Telemetry log (enriched ingest log with correlation IDs)
+			`CREATE TABLE IF NOT EXISTS nxd.telemetry_log (
+				ts TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				factory_id UUID REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				asset_id UUID REFERENCES nxd.assets(id) ON DELETE CASCADE,
+				metric_key TEXT,
+				metric_value DOUBLE PRECISION,
+				status TEXT,
+				raw JSONB,
+				correlation_id TEXT
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS nxd.telemetry_log CASCADE`,
+			`DROP TABLE IF EXISTS nxd.asset_metric_catalog CASCADE`,
+			`DROP TABLE IF EXISTS nxd.audit_log CASCADE`,
+		},
+	},
+	{
+		Version:  5,
+		Name:     "telemetry_log_hypertable",
+		Optional: true,
+		Up: []string{
+			`SELECT create_hypertable('nxd.telemetry_log', 'ts', if_not_exists => TRUE)`,
+		},
+		Down: []string{`SELECT 1`},
+	},
+	{
+		// ─── Performance indexes on telemetry_log ───────────────────────────
+		// These are critical for dashboard queries on large datasets.
+		// CREATE INDEX CONCURRENTLY is not allowed inside transactions, so we use
+		// a regular CREATE INDEX with IF NOT EXISTS (idempotent).
+		Version: 6,
+		Name:    "telemetry_log_indexes",
+		Up: []string{
+			`CREATE INDEX IF NOT EXISTS idx_telemetry_log_asset_ts
+				ON nxd.telemetry_log (asset_id, ts DESC)
+				WHERE asset_id IS NOT NULL`,
+			`CREATE INDEX IF NOT EXISTS idx_telemetry_log_factory_ts
+				ON nxd.telemetry_log (factory_id, ts DESC)
+				WHERE factory_id IS NOT NULL`,
+			`CREATE INDEX IF NOT EXISTS idx_telemetry_log_asset_metric_ts
+				ON nxd.telemetry_log (asset_id, metric_key, ts DESC)
+				WHERE asset_id IS NOT NULL AND metric_key IS NOT NULL`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS nxd.idx_telemetry_log_asset_metric_ts`,
+			`DROP INDEX IF EXISTS nxd.idx_telemetry_log_factory_ts`,
+			`DROP INDEX IF EXISTS nxd.idx_telemetry_log_asset_ts`,
+		},
+	},
+	{
+		// ─── api_key_prefix for O(1) ingest authentication ───────────────────
+		// The prefix is the first 16 chars of the plaintext key (NXD_xxxxxxxxxxxx).
+		// It is NOT secret: it cannot be used to reconstruct the key, and bcrypt
+		// comparison still happens as the second verification step.
+		Version: 7,
+		Name:    "factories_api_key_prefix",
+		Up: []string{
+			`ALTER TABLE nxd.factories ADD COLUMN IF NOT EXISTS api_key_prefix TEXT`,
+			`CREATE INDEX IF NOT EXISTS idx_factories_api_key_prefix ON nxd.factories (api_key_prefix) WHERE api_key_prefix IS NOT NULL`,
+			// Backfill prefix from existing plaintext api_key column (safe: non-destructive).
+			`UPDATE nxd.factories SET api_key_prefix = LEFT(api_key, 16) WHERE api_key IS NOT NULL AND api_key_prefix IS NULL`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS nxd.idx_factories_api_key_prefix`,
+			`ALTER TABLE nxd.factories DROP COLUMN IF EXISTS api_key_prefix`,
+		},
+	},
+	{
+		// ─── Fix nxd.sectors schema ──────────────────────────────────────────
+		// nxd.sectors may exist from a prior schema version without factory_id.
+		// Down keeps the column: it is part of the v1 table definition.
+		Version: 8,
+		Name:    "sectors_factory_id",
+		Up: []string{
+			`ALTER TABLE nxd.sectors ADD COLUMN IF NOT EXISTS factory_id UUID REFERENCES nxd.factories(id) ON DELETE CASCADE`,
+			`CREATE INDEX IF NOT EXISTS idx_sectors_factory_id ON nxd.sectors (factory_id) WHERE factory_id IS NOT NULL`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS nxd.idx_sectors_factory_id`,
+		},
+	},
+	{
+		Version: 9,
+		Name:    "alerts_rollup_reports",
+		Up: []string{
+			// Alert rules
+			`CREATE TABLE IF NOT EXISTS nxd.alert_rules (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				scope_type TEXT NOT NULL,
+				scope_id UUID,
+				condition_type TEXT NOT NULL,
+				threshold DOUBLE PRECISION,
+				channel TEXT,
+				created_at TIMESTAMPTZ DEFAULT NOW()
+			)`,
 
-	// ─── P6: expected_interval_s — base for offline DX detection ────────────
-	// Nullable integer (seconds). NULL = no expectation set.
-	// When set, a future monitoring job can flag assets that have not reported
-	// within expected_interval_s * some_multiplier (e.g. 3x).
-	// NOT implementing the detection UI now — just preparing the schema column.
-	`ALTER TABLE nxd.assets ADD COLUMN IF NOT EXISTS expected_interval_s INT`,
+			// Alerts fired
+			`CREATE TABLE IF NOT EXISTS nxd.alerts (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				ts TIMESTAMPTZ DEFAULT NOW(),
+				rule_id UUID REFERENCES nxd.alert_rules(id) ON DELETE CASCADE,
+				asset_id UUID REFERENCES nxd.assets(id) ON DELETE CASCADE,
+				group_id UUID,
+				severity TEXT,
+				message TEXT,
+				acknowledged_by UUID,
+				acknowledged_at TIMESTAMPTZ
+			)`,
 
-	// ─── P4: Idempotency index for historical import ─────────────────────────
-	// Partial index on telemetry_log to speed up the range-check deduplication
-	// query used by the import worker before inserting each batch.
-	// Strategy: RANGE CHECK (see importer.go checkRangeExists).
-	// We do NOT use a UNIQUE constraint because:
-	//   1. TimescaleDB hypertables require the partition key (ts) in any unique
-	//      index, making (asset_id, metric_key, ts) the minimum — this is a
-	//      225-byte index on a write-heavy table, prohibitively expensive.
-	//   2. Duplicate protection at ingest time would double write latency.
-	//   3. The operational contract for historical import is: same job ID is
-	//      never resubmitted for the same asset + time range. Enforced in the
-	//      worker via job-level range tracking.
-	// This index makes the range-check query (COUNT(*) WHERE asset_id=X AND
-	// ts BETWEEN start AND end) O(log n) instead of O(n).
-	`CREATE INDEX IF NOT EXISTS idx_telemetry_log_import_range
-		ON nxd.telemetry_log (asset_id, ts)
-		WHERE asset_id IS NOT NULL`,
+			// Telemetry rollup 1-minute buckets
+			`CREATE TABLE IF NOT EXISTS nxd.telemetry_rollup_1m (
+				bucket_ts TIMESTAMPTZ NOT NULL,
+				factory_id UUID NOT NULL,
+				asset_id UUID NOT NULL,
+				metric_key TEXT NOT NULL,
+				avg_value DOUBLE PRECISION,
+				min_value DOUBLE PRECISION,
+				max_value DOUBLE PRECISION,
+				samples INT,
+				status_counts JSONB,
+				PRIMARY KEY (bucket_ts, factory_id, asset_id, metric_key)
+			)`,
 
-	// ─── MVP Indicadores Financeiros: Configuração de negócio por setor ─────
-	// Unidade de cálculo: Setor (ou linha = conjunto de ativos no setor).
-	// Parâmetros: valor_venda_ok (R$/un), custo_refugo_un (R$/un), custo_parada_h (R$/h).
-	`CREATE TABLE IF NOT EXISTS nxd.business_config (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
-		sector_id UUID REFERENCES nxd.sectors(id) ON DELETE CASCADE,
-		valor_venda_ok NUMERIC(18,4) NOT NULL DEFAULT 0,
-		custo_refugo_un NUMERIC(18,4) NOT NULL DEFAULT 0,
-		custo_parada_h NUMERIC(18,4) NOT NULL DEFAULT 0,
-		created_at TIMESTAMPTZ DEFAULT NOW(),
-		updated_at TIMESTAMPTZ DEFAULT NOW(),
-		UNIQUE(factory_id, sector_id)
-	)`,
-	`CREATE INDEX IF NOT EXISTS idx_business_config_factory ON nxd.business_config (factory_id)`,
-	// Apenas uma config "padrão" (sector_id NULL) por fábrica.
-	`CREATE UNIQUE INDEX IF NOT EXISTS idx_business_config_factory_default ON nxd.business_config (factory_id) WHERE sector_id IS NULL`,
+			// Report templates
+			`CREATE TABLE IF NOT EXISTS nxd.report_templates (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				category TEXT,
+				name TEXT NOT NULL,
+				description TEXT,
+				default_filters JSONB,
+				prompt_instructions TEXT,
+				output_schema_version TEXT,
+				created_at TIMESTAMPTZ DEFAULT NOW()
+			)`,
 
-	// Mapeamento de tags do CLP por ativo (linha/máquina): OK, NOK, Status.
-	// reading_rule: 'delta' = usar variação por período; 'absolute' = usar valor absoluto.
-	`CREATE TABLE IF NOT EXISTS nxd.tag_mapping (
-		id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
-		asset_id UUID NOT NULL REFERENCES nxd.assets(id) ON DELETE CASCADE UNIQUE,
-		tag_ok TEXT,
-		tag_nok TEXT,
-		tag_status TEXT,
-		reading_rule TEXT NOT NULL DEFAULT 'delta',
-		created_at TIMESTAMPTZ DEFAULT NOW(),
-		updated_at TIMESTAMPTZ DEFAULT NOW()
-	)`,
-	`CREATE INDEX IF NOT EXISTS idx_tag_mapping_asset ON nxd.tag_mapping (asset_id)`,
+			// Report runs
+			`CREATE TABLE IF NOT EXISTS nxd.report_runs (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				requested_by UUID,
+				filters JSONB,
+				prompt_contract TEXT,
+				status TEXT DEFAULT 'pending',
+				result_json JSONB,
+				export_url TEXT,
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				updated_at TIMESTAMPTZ DEFAULT NOW()
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS nxd.report_runs CASCADE`,
+			`DROP TABLE IF EXISTS nxd.report_templates CASCADE`,
+			`DROP TABLE IF EXISTS nxd.telemetry_rollup_1m CASCADE`,
+			`DROP TABLE IF EXISTS nxd.alerts CASCADE`,
+			`DROP TABLE IF EXISTS nxd.alert_rules CASCADE`,
+		},
+	},
+	{
+		// ─── Historical import jobs (base for "download longo" feature) ──────
+		// status lifecycle: pending → running → done | failed | cancelled
+		// rows_total/rows_done enable real progress percentage in the UI.
+		// batch_size controls how many rows are inserted per DB transaction.
+		// source_config stores DX connection details (endpoint, auth) as JSONB
+		// so the import worker can reconnect to the DX autonomously.
+		Version: 10,
+		Name:    "import_jobs",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS nxd.import_jobs (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				asset_id UUID REFERENCES nxd.assets(id) ON DELETE SET NULL,
+				requested_by UUID,
+				status TEXT NOT NULL DEFAULT 'pending',
+				period_start TIMESTAMPTZ,
+				period_end TIMESTAMPTZ,
+				rows_total BIGINT DEFAULT 0,
+				rows_done BIGINT DEFAULT 0,
+				batch_size INT DEFAULT 1000,
+				source_type TEXT DEFAULT 'dx_http',
+				source_config JSONB,
+				error_message TEXT,
+				started_at TIMESTAMPTZ,
+				finished_at TIMESTAMPTZ,
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				updated_at TIMESTAMPTZ DEFAULT NOW()
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_import_jobs_factory_status
+				ON nxd.import_jobs (factory_id, status)
+				WHERE status IN ('pending', 'running')`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS nxd.import_jobs CASCADE`,
+		},
+	},
+	{
+		// ─── P6: expected_interval_s — base for offline DX detection ────────
+		// Nullable integer (seconds). NULL = no expectation set.
+		Version: 11,
+		Name:    "assets_expected_interval",
+		Up: []string{
+			`ALTER TABLE nxd.assets ADD COLUMN IF NOT EXISTS expected_interval_s INT`,
+		},
+		Down: []string{
+			`ALTER TABLE nxd.assets DROP COLUMN IF EXISTS expected_interval_s`,
+		},
+	},
+	{
+		// ─── P4: Idempotency index for historical import ─────────────────────
+		// Partial index used by the import worker's range check (see
+		// importer.go checkRangeExists). Not UNIQUE: on a hypertable that would
+		// need (asset_id, metric_key, ts) and double ingest write latency.
+		Version: 12,
+		Name:    "telemetry_log_import_range_index",
+		Up: []string{
+			`CREATE INDEX IF NOT EXISTS idx_telemetry_log_import_range
+				ON nxd.telemetry_log (asset_id, ts)
+				WHERE asset_id IS NOT NULL`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS nxd.idx_telemetry_log_import_range`,
+		},
+	},
+	{
+		// ─── MVP Indicadores Financeiros: Configuração de negócio por setor ─
+		// Parâmetros: valor_venda_ok (R$/un), custo_refugo_un (R$/un), custo_parada_h (R$/h).
+		Version: 13,
+		Name:    "business_config",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS nxd.business_config (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				sector_id UUID REFERENCES nxd.sectors(id) ON DELETE CASCADE,
+				valor_venda_ok NUMERIC(18,4) NOT NULL DEFAULT 0,
+				custo_refugo_un NUMERIC(18,4) NOT NULL DEFAULT 0,
+				custo_parada_h NUMERIC(18,4) NOT NULL DEFAULT 0,
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				updated_at TIMESTAMPTZ DEFAULT NOW(),
+				UNIQUE(factory_id, sector_id)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_business_config_factory ON nxd.business_config (factory_id)`,
+			// Apenas uma config "padrão" (sector_id NULL) por fábrica.
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_business_config_factory_default ON nxd.business_config (factory_id) WHERE sector_id IS NULL`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS nxd.business_config CASCADE`,
+		},
+	},
+	{
+		// Mapeamento de tags do CLP por ativo (linha/máquina): OK, NOK, Status.
+		// reading_rule: 'delta' = usar variação por período; 'absolute' = usar valor absoluto.
+		Version: 14,
+		Name:    "tag_mapping",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS nxd.tag_mapping (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				asset_id UUID NOT NULL REFERENCES nxd.assets(id) ON DELETE CASCADE UNIQUE,
+				tag_ok TEXT,
+				tag_nok TEXT,
+				tag_status TEXT,
+				reading_rule TEXT NOT NULL DEFAULT 'delta',
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				updated_at TIMESTAMPTZ DEFAULT NOW()
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_tag_mapping_asset ON nxd.tag_mapping (asset_id)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS nxd.tag_mapping CASCADE`,
+		},
+	},
+	{
+		// Manifesto do arquivamento de telemetria fria (ver archive.go).
+		// Uma linha por fábrica + dia UTC + parte (dados importados depois que o
+		// dia já foi arquivado geram a parte 2, 3, ...); object_key aponta para o
+		// arquivo .csv.gz no ArchiveStorage. status: running → done | failed.
+		Version: 15,
+		Name:    "telemetry_archives",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS nxd.telemetry_archives (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				period_start TIMESTAMPTZ NOT NULL,
+				period_end TIMESTAMPTZ NOT NULL,
+				part INT NOT NULL DEFAULT 1,
+				format TEXT NOT NULL DEFAULT 'csv.gz',
+				object_key TEXT NOT NULL,
+				row_count BIGINT NOT NULL DEFAULT 0,
+				size_bytes BIGINT NOT NULL DEFAULT 0,
+				sha256 TEXT,
+				status TEXT NOT NULL DEFAULT 'running',
+				error_message TEXT,
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				finished_at TIMESTAMPTZ,
+				UNIQUE(factory_id, period_start, part)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_telemetry_archives_factory_range
+				ON nxd.telemetry_archives (factory_id, period_start, period_end)
+				WHERE status = 'done'`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS nxd.telemetry_archives CASCADE`,
+		},
+	},
+	{
+		// ─── Export de dados da fábrica (bundle .zip para download) ─────────
+		// Mesmo ciclo de vida de import_jobs: pending → running → done | failed | cancelled
+		// (+ expired quando o arquivo é removido após expires_at).
+		// requested_by guarda o id do usuário da API legada (public.users).
+		Version: 16,
+		Name:    "export_jobs",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS nxd.export_jobs (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				requested_by BIGINT,
+				status TEXT NOT NULL DEFAULT 'pending',
+				period_start TIMESTAMPTZ NOT NULL,
+				period_end TIMESTAMPTZ NOT NULL,
+				include_telemetry BOOLEAN NOT NULL DEFAULT TRUE,
+				rows_total BIGINT DEFAULT 0,
+				rows_done BIGINT DEFAULT 0,
+				object_key TEXT,
+				size_bytes BIGINT,
+				sha256 TEXT,
+				error_message TEXT,
+				started_at TIMESTAMPTZ,
+				finished_at TIMESTAMPTZ,
+				expires_at TIMESTAMPTZ,
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				updated_at TIMESTAMPTZ DEFAULT NOW()
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_export_jobs_factory_status
+				ON nxd.export_jobs (factory_id, status)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS nxd.export_jobs CASCADE`,
+		},
+	},
+	{
+		// ─── OEE (ver oee.go) ────────────────────────────────────────────────
+		// ideal_cycle_s: tempo de ciclo ideal do ativo em segundos (desempenho).
+		// planned_downtime: janelas de parada planejada, excluídas do tempo
+		// planejado; asset_id e sector_id nulos = vale para a fábrica inteira.
+		Version: 17,
+		Name:    "oee_ideal_cycle_planned_downtime",
+		Up: []string{
+			`ALTER TABLE nxd.tag_mapping ADD COLUMN IF NOT EXISTS ideal_cycle_s DOUBLE PRECISION`,
+			`CREATE TABLE IF NOT EXISTS nxd.planned_downtime (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				sector_id UUID REFERENCES nxd.sectors(id) ON DELETE CASCADE,
+				asset_id UUID REFERENCES nxd.assets(id) ON DELETE CASCADE,
+				starts_at TIMESTAMPTZ NOT NULL,
+				ends_at TIMESTAMPTZ NOT NULL,
+				reason TEXT,
+				created_by BIGINT,
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				CHECK (ends_at > starts_at)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_planned_downtime_factory_range
+				ON nxd.planned_downtime (factory_id, starts_at, ends_at)`,
+			// O template passa a usar o OEE calculado em vez de pedir ao modelo para estimar.
+			`UPDATE nxd.report_templates
+				SET prompt_instructions = 'Use os valores de OEE calculados (disponibilidade, desempenho, qualidade) fornecidos no contexto; não estime. Marque em missing_data os ativos sem ciclo ideal ou sem tag de status.'
+				WHERE name = 'OEE por Setor' AND prompt_instructions = 'Calcule e apresente OEE com disponibilidade, desempenho e qualidade.'`,
+		},
+		Down: []string{
+			`UPDATE nxd.report_templates
+				SET prompt_instructions = 'Calcule e apresente OEE com disponibilidade, desempenho e qualidade.'
+				WHERE name = 'OEE por Setor' AND prompt_instructions LIKE 'Use os valores de OEE calculados%'`,
+			`DROP TABLE IF EXISTS nxd.planned_downtime CASCADE`,
+			`ALTER TABLE nxd.tag_mapping DROP COLUMN IF EXISTS ideal_cycle_s`,
+		},
+	},
+	{
+		// ─── Eventos de parada + árvore de motivos (ver downtime.go) ─────────
+		// downtime_events é preenchida pelo detector a partir das transições do
+		// tag_status; ended_at NULL = parada em andamento. downtime_cursor guarda
+		// até onde cada ativo já foi processado.
+		Version: 18,
+		Name:    "downtime_events_reasons",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS nxd.downtime_reasons (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				parent_id UUID REFERENCES nxd.downtime_reasons(id) ON DELETE CASCADE,
+				code TEXT NOT NULL,
+				name TEXT NOT NULL,
+				active BOOLEAN NOT NULL DEFAULT TRUE,
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				UNIQUE (factory_id, code)
+			)`,
+			`CREATE TABLE IF NOT EXISTS nxd.downtime_events (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				asset_id UUID NOT NULL REFERENCES nxd.assets(id) ON DELETE CASCADE,
+				started_at TIMESTAMPTZ NOT NULL,
+				ended_at TIMESTAMPTZ,
+				duration_s DOUBLE PRECISION,
+				reason_id UUID REFERENCES nxd.downtime_reasons(id) ON DELETE SET NULL,
+				comment TEXT,
+				classified_by BIGINT,
+				classified_at TIMESTAMPTZ,
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				UNIQUE (asset_id, started_at)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_downtime_events_factory_started
+				ON nxd.downtime_events (factory_id, started_at DESC)`,
+			`CREATE TABLE IF NOT EXISTS nxd.downtime_cursor (
+				asset_id UUID PRIMARY KEY REFERENCES nxd.assets(id) ON DELETE CASCADE,
+				last_ts TIMESTAMPTZ NOT NULL,
+				updated_at TIMESTAMPTZ DEFAULT NOW()
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS nxd.downtime_cursor CASCADE`,
+			`DROP TABLE IF EXISTS nxd.downtime_events CASCADE`,
+			`DROP TABLE IF EXISTS nxd.downtime_reasons CASCADE`,
+		},
+	},
+	{
+		// ─── Calendário de produção (ver calendar.go) ───────────────────────
+		// Turnos por fábrica ou setor (horário local + dias da semana em bitmask,
+		// bit 0 = domingo) e exceções: feriados (holiday) e horas extras (extra).
+		// Sem turnos cadastrados a fábrica é considerada 24/7.
+		Version: 19,
+		Name:    "production_calendar",
+		Up: []string{
+			`ALTER TABLE nxd.factories ADD COLUMN IF NOT EXISTS timezone TEXT NOT NULL DEFAULT 'America/Sao_Paulo'`,
+			`CREATE TABLE IF NOT EXISTS nxd.shifts (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				sector_id UUID REFERENCES nxd.sectors(id) ON DELETE CASCADE,
+				name TEXT NOT NULL,
+				start_time TEXT NOT NULL,
+				end_time TEXT NOT NULL,
+				days_mask SMALLINT NOT NULL DEFAULT 62,
+				active BOOLEAN NOT NULL DEFAULT TRUE,
+				created_at TIMESTAMPTZ DEFAULT NOW()
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_shifts_factory ON nxd.shifts (factory_id)`,
+			`CREATE TABLE IF NOT EXISTS nxd.calendar_exceptions (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				sector_id UUID REFERENCES nxd.sectors(id) ON DELETE CASCADE,
+				kind TEXT NOT NULL CHECK (kind IN ('holiday', 'extra')),
+				starts_at TIMESTAMPTZ NOT NULL,
+				ends_at TIMESTAMPTZ NOT NULL,
+				name TEXT,
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				CHECK (ends_at > starts_at)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_calendar_exceptions_factory_range
+				ON nxd.calendar_exceptions (factory_id, starts_at, ends_at)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS nxd.calendar_exceptions CASCADE`,
+			`DROP TABLE IF EXISTS nxd.shifts CASCADE`,
+			`ALTER TABLE nxd.factories DROP COLUMN IF EXISTS timezone`,
+		},
+	},
+	{
+		Version: 20,
+		Name:    "production_orders",
+		Up: []string{
+			// tag_energy: contador de kWh; tag_order: número da ordem/receita em execução (0 = nenhuma).
+			`ALTER TABLE nxd.tag_mapping ADD COLUMN IF NOT EXISTS tag_energy TEXT`,
+			`ALTER TABLE nxd.tag_mapping ADD COLUMN IF NOT EXISTS tag_order TEXT`,
+			`ALTER TABLE nxd.business_config ADD COLUMN IF NOT EXISTS custo_kwh NUMERIC(18,4) NOT NULL DEFAULT 0`,
+			`CREATE TABLE IF NOT EXISTS nxd.production_orders (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				sector_id UUID REFERENCES nxd.sectors(id) ON DELETE SET NULL,
+				asset_id UUID REFERENCES nxd.assets(id) ON DELETE SET NULL,
+				order_code TEXT NOT NULL,
+				product TEXT,
+				target_qty DOUBLE PRECISION,
+				valor_venda_ok NUMERIC(18,4),
+				started_at TIMESTAMPTZ,
+				ended_at TIMESTAMPTZ,
+				source TEXT NOT NULL DEFAULT 'api' CHECK (source IN ('api', 'tag')),
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				CHECK (ended_at IS NULL OR (started_at IS NOT NULL AND ended_at > started_at))
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_production_orders_factory_started
+				ON nxd.production_orders (factory_id, started_at DESC)`,
+			`CREATE INDEX IF NOT EXISTS idx_production_orders_asset_open
+				ON nxd.production_orders (asset_id) WHERE ended_at IS NULL`,
+			`CREATE TABLE IF NOT EXISTS nxd.production_order_cursor (
+				asset_id UUID PRIMARY KEY REFERENCES nxd.assets(id) ON DELETE CASCADE,
+				last_ts TIMESTAMPTZ NOT NULL,
+				updated_at TIMESTAMPTZ DEFAULT NOW()
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS nxd.production_order_cursor CASCADE`,
+			`DROP TABLE IF EXISTS nxd.production_orders CASCADE`,
+			`ALTER TABLE nxd.business_config DROP COLUMN IF EXISTS custo_kwh`,
+			`ALTER TABLE nxd.tag_mapping DROP COLUMN IF EXISTS tag_order`,
+			`ALTER TABLE nxd.tag_mapping DROP COLUMN IF EXISTS tag_energy`,
+		},
+	},
+	{
+		// ─── Confiabilidade: MTBF/MTTR (ver reliability.go) ─────────────────
+		// is_failure: motivos de parada que são falha do equipamento (a marca da
+		// categoria vale para os filhos). tag_alarm: alarme de falha do CLP.
+		Version: 21,
+		Name:    "reliability",
+		Up: []string{
+			`ALTER TABLE nxd.downtime_reasons ADD COLUMN IF NOT EXISTS is_failure BOOLEAN NOT NULL DEFAULT FALSE`,
+			`UPDATE nxd.downtime_reasons SET is_failure = TRUE WHERE code IN ('MEC', 'ELE') AND parent_id IS NULL`,
+			`ALTER TABLE nxd.tag_mapping ADD COLUMN IF NOT EXISTS tag_alarm TEXT`,
+			// Os templates de Manutenção passam a receber MTBF/MTTR calculados.
+			`UPDATE nxd.report_templates
+				SET prompt_instructions = 'Use MTBF, MTTR, falhas e disponibilidade calculados em inputs.reliability; não estime. Health score e alertas; recomendações apenas com evidência.'
+				WHERE name = 'Saúde dos Ativos' AND prompt_instructions = 'Health score e alertas; recomendações apenas com evidência.'`,
+			`UPDATE nxd.report_templates
+				SET prompt_instructions = 'Use a série de falhas, MTBF e MTTR de inputs.reliability; não estime valores ausentes. Sem inventar causas.'
+				WHERE name = 'Tendência de Falhas' AND prompt_instructions = 'Séries de falhas/avisos; sem inventar causas.'`,
+		},
+		Down: []string{
+			`UPDATE nxd.report_templates
+				SET prompt_instructions = 'Séries de falhas/avisos; sem inventar causas.'
+				WHERE name = 'Tendência de Falhas' AND prompt_instructions LIKE 'Use a série de falhas, MTBF e MTTR%'`,
+			`UPDATE nxd.report_templates
+				SET prompt_instructions = 'Health score e alertas; recomendações apenas com evidência.'
+				WHERE name = 'Saúde dos Ativos' AND prompt_instructions LIKE 'Use MTBF, MTTR, falhas e disponibilidade%'`,
+			`ALTER TABLE nxd.tag_mapping DROP COLUMN IF EXISTS tag_alarm`,
+			`ALTER TABLE nxd.downtime_reasons DROP COLUMN IF EXISTS is_failure`,
+		},
+	},
+	{
+		// ─── Métricas virtuais (ver virtual_metrics.go) ─────────────────────
+		// Fórmulas sobre metric_keys existentes, por ativo, setor ou fábrica
+		// (asset_id e sector_id nulos). mode: ingest = calculada no ingest e gravada
+		// em telemetry_log; query = calculada na consulta. O estado de
+		// integrate/derivative fica em virtual_metric_state, por ativo.
+		Version: 22,
+		Name:    "virtual_metrics",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS nxd.virtual_metrics (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				sector_id UUID REFERENCES nxd.sectors(id) ON DELETE CASCADE,
+				asset_id UUID REFERENCES nxd.assets(id) ON DELETE CASCADE,
+				metric_key TEXT NOT NULL,
+				expression TEXT NOT NULL,
+				unit TEXT,
+				description TEXT,
+				mode TEXT NOT NULL DEFAULT 'ingest' CHECK (mode IN ('ingest', 'query')),
+				active BOOLEAN NOT NULL DEFAULT TRUE,
+				created_by BIGINT,
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				updated_at TIMESTAMPTZ DEFAULT NOW()
+			)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_virtual_metrics_scope_key
+				ON nxd.virtual_metrics (factory_id, metric_key, COALESCE(asset_id, sector_id, factory_id))`,
+			`CREATE TABLE IF NOT EXISTS nxd.virtual_metric_state (
+				virtual_metric_id UUID NOT NULL REFERENCES nxd.virtual_metrics(id) ON DELETE CASCADE,
+				asset_id UUID NOT NULL REFERENCES nxd.assets(id) ON DELETE CASCADE,
+				state JSONB NOT NULL DEFAULT '{}',
+				updated_at TIMESTAMPTZ DEFAULT NOW(),
+				PRIMARY KEY (virtual_metric_id, asset_id)
+			)`,
+			// Entradas do catálogo geradas por uma métrica virtual (NULL = tag real).
+			`ALTER TABLE nxd.asset_metric_catalog ADD COLUMN IF NOT EXISTS virtual_metric_id UUID
+				REFERENCES nxd.virtual_metrics(id) ON DELETE CASCADE`,
+		},
+		Down: []string{
+			`DELETE FROM nxd.asset_metric_catalog WHERE virtual_metric_id IS NOT NULL`,
+			`ALTER TABLE nxd.asset_metric_catalog DROP COLUMN IF EXISTS virtual_metric_id`,
+			`DROP TABLE IF EXISTS nxd.virtual_metric_state CASCADE`,
+			`DROP TABLE IF EXISTS nxd.virtual_metrics CASCADE`,
+		},
+	},
+	{
+		Version: 23,
+		Name:    "counter_config",
+		Up: []string{
+			// Semântica de contador por tag (counters.go): rollover_at = módulo do registrador
+			// (ex.: 65536); quedas até reset_tolerance são ruído, acima disso reset.
+			`CREATE TABLE IF NOT EXISTS nxd.counter_config (
+				asset_id UUID NOT NULL REFERENCES nxd.assets(id) ON DELETE CASCADE,
+				metric_key TEXT NOT NULL,
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				rollover_at DOUBLE PRECISION CHECK (rollover_at > 0),
+				reset_tolerance DOUBLE PRECISION NOT NULL DEFAULT 0 CHECK (reset_tolerance >= 0),
+				updated_at TIMESTAMPTZ DEFAULT NOW(),
+				PRIMARY KEY (asset_id, metric_key)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_counter_config_factory ON nxd.counter_config (factory_id)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS nxd.counter_config`,
+		},
+	},
+	{
+		// ─── Gestão de energia (ver energy.go) ──────────────────────────────
+		// energy_meters: contadores de kWh além do tag_energy dos ativos (quadro
+		// geral, compressores, iluminação), atribuídos a um setor ou à fábrica.
+		// energy_tariffs: tarifa horária por vigência; os postos (ponta,
+		// intermediário) ficam em energy_tariff_periods e o resto do dia é
+		// fora-ponta (rate_kwh). Demanda: R$/kW sobre o pico de 15 min.
+		Version: 24,
+		Name:    "energy",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS nxd.energy_meters (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				asset_id UUID NOT NULL REFERENCES nxd.assets(id) ON DELETE CASCADE,
+				metric_key TEXT NOT NULL,
+				sector_id UUID REFERENCES nxd.sectors(id) ON DELETE SET NULL,
+				name TEXT NOT NULL,
+				active BOOLEAN NOT NULL DEFAULT TRUE,
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				UNIQUE (asset_id, metric_key)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_energy_meters_factory ON nxd.energy_meters (factory_id)`,
+			`CREATE TABLE IF NOT EXISTS nxd.energy_tariffs (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				name TEXT NOT NULL,
+				valid_from DATE NOT NULL,
+				rate_kwh NUMERIC(18,6) NOT NULL DEFAULT 0,
+				demand_rate_kw NUMERIC(18,4) NOT NULL DEFAULT 0,
+				contracted_demand_kw NUMERIC(18,3),
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				UNIQUE (factory_id, valid_from)
+			)`,
+			`CREATE TABLE IF NOT EXISTS nxd.energy_tariff_periods (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				tariff_id UUID NOT NULL REFERENCES nxd.energy_tariffs(id) ON DELETE CASCADE,
+				name TEXT NOT NULL,
+				start_time TEXT NOT NULL,
+				end_time TEXT NOT NULL,
+				days_mask SMALLINT NOT NULL DEFAULT 62,
+				rate_kwh NUMERIC(18,6) NOT NULL
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_energy_tariff_periods_tariff ON nxd.energy_tariff_periods (tariff_id)`,
+			`UPDATE nxd.report_templates
+				SET prompt_instructions = 'Use kWh, custo por posto tarifário, demanda de pico e kWh por peça boa de inputs.energy; não estime. Marque medidores ou tarifa ausentes em missing_data.'
+				WHERE name = 'Custo Energia vs Produção' AND prompt_instructions = 'Relação energia/produção; marque dados faltantes em missing_data.'`,
+		},
+		Down: []string{
+			`UPDATE nxd.report_templates
+				SET prompt_instructions = 'Relação energia/produção; marque dados faltantes em missing_data.'
+				WHERE name = 'Custo Energia vs Produção' AND prompt_instructions LIKE 'Use kWh, custo por posto tarifário%'`,
+			`DROP TABLE IF EXISTS nxd.energy_tariff_periods`,
+			`DROP TABLE IF EXISTS nxd.energy_tariffs`,
+			`DROP TABLE IF EXISTS nxd.energy_meters`,
+		},
+	},
+	{
+		Version: 25,
+		Name:    "emissions",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS nxd.emission_factors (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				region TEXT NOT NULL,
+				valid_from DATE NOT NULL,
+				valid_to DATE,
+				kg_co2e_per_kwh NUMERIC(12,6) NOT NULL CHECK (kg_co2e_per_kwh >= 0),
+				source TEXT,
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				UNIQUE (factory_id, region, valid_from)
+			)`,
+			`ALTER TABLE nxd.factories ADD COLUMN IF NOT EXISTS emission_region TEXT NOT NULL DEFAULT 'BR-SIN'`,
+			// Bancos já semeados ganham o template ESG (instalação nova: seed.go).
+			`INSERT INTO nxd.report_templates (category, name, description, default_filters, prompt_instructions, output_schema_version)
+				SELECT 'ESG', 'Emissões Escopo 2', 'Emissões de CO2e da energia elétrica por setor, ativo e produto, com metodologia e completude.',
+					'{"period": "7d", "detail": "medio"}'::jsonb,
+					'Use kWh, CO2e, fatores e completude de inputs.esg; não estime nem converta com outros fatores. Cite a metodologia e marque fontes sem dados ou kWh sem fator em missing_data.', '1'
+				WHERE EXISTS (SELECT 1 FROM nxd.report_templates)
+				  AND NOT EXISTS (SELECT 1 FROM nxd.report_templates WHERE name = 'Emissões Escopo 2')`,
+		},
+		Down: []string{
+			`DELETE FROM nxd.report_templates WHERE name = 'Emissões Escopo 2' AND category = 'ESG'`,
+			`ALTER TABLE nxd.factories DROP COLUMN IF EXISTS emission_region`,
+			`DROP TABLE IF EXISTS nxd.emission_factors`,
+		},
+	},
+	{
+		// ─── Modelo de custos (ver cost_model.go) ───────────────────────────
+		// cost_parameters: histórico com vigência por escopo (fábrica, setor,
+		// ativo ou produto); parâmetros nulos herdam do escopo mais geral.
+		// exchange_rates: cotação para a moeda da fábrica (factories.currency).
+		// O histórico começa com os valores atuais de business_config.
+		Version: 26,
+		Name:    "cost_model",
+		Up: []string{
+			`ALTER TABLE nxd.business_config ADD COLUMN IF NOT EXISTS custo_material_un NUMERIC(18,4) NOT NULL DEFAULT 0`,
+			`ALTER TABLE nxd.business_config ADD COLUMN IF NOT EXISTS custo_mao_obra_turno NUMERIC(18,4) NOT NULL DEFAULT 0`,
+			`ALTER TABLE nxd.factories ADD COLUMN IF NOT EXISTS currency TEXT NOT NULL DEFAULT 'BRL'`,
+			`CREATE TABLE IF NOT EXISTS nxd.cost_parameters (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				sector_id UUID REFERENCES nxd.sectors(id) ON DELETE CASCADE,
+				asset_id UUID REFERENCES nxd.assets(id) ON DELETE CASCADE,
+				product TEXT,
+				valid_from DATE NOT NULL,
+				currency TEXT,
+				valor_venda_ok NUMERIC(18,4),
+				custo_refugo_un NUMERIC(18,4),
+				custo_parada_h NUMERIC(18,4),
+				custo_material_un NUMERIC(18,4),
+				custo_mao_obra_turno NUMERIC(18,4),
+				notes TEXT,
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				CHECK (num_nonnulls(sector_id, asset_id, product) <= 1)
+			)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_cost_parameters_scope ON nxd.cost_parameters (factory_id,
+				COALESCE(sector_id, '00000000-0000-0000-0000-000000000000'::uuid),
+				COALESCE(asset_id, '00000000-0000-0000-0000-000000000000'::uuid),
+				COALESCE(product, ''), valid_from)`,
+			`CREATE TABLE IF NOT EXISTS nxd.exchange_rates (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				currency TEXT NOT NULL,
+				valid_from DATE NOT NULL,
+				rate NUMERIC(18,8) NOT NULL CHECK (rate > 0),
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				UNIQUE (factory_id, currency, valid_from)
+			)`,
+			`INSERT INTO nxd.cost_parameters (factory_id, sector_id, valid_from, valor_venda_ok, custo_refugo_un, custo_parada_h,
+					custo_material_un, custo_mao_obra_turno, notes)
+				SELECT factory_id, sector_id, DATE '2000-01-01', valor_venda_ok, custo_refugo_un, custo_parada_h, 0, 0, 'migrado de business_config'
+				FROM nxd.business_config
+				ON CONFLICT DO NOTHING`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS nxd.exchange_rates`,
+			`DROP TABLE IF EXISTS nxd.cost_parameters`,
+			`ALTER TABLE nxd.factories DROP COLUMN IF EXISTS currency`,
+			`ALTER TABLE nxd.business_config DROP COLUMN IF EXISTS custo_mao_obra_turno`,
+			`ALTER TABLE nxd.business_config DROP COLUMN IF EXISTS custo_material_un`,
+		},
+	},
+	{
+		// Cenários what-if salvos (ver financial_scenarios.go): parâmetros e o
+		// resultado calculado no momento, para comparar depois sem recalcular.
+		Version: 27,
+		Name:    "financial_scenarios",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS nxd.financial_scenarios (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				sector_id UUID REFERENCES nxd.sectors(id) ON DELETE SET NULL,
+				name TEXT NOT NULL,
+				description TEXT,
+				baseline_start TIMESTAMPTZ NOT NULL,
+				baseline_end TIMESTAMPTZ NOT NULL,
+				params JSONB NOT NULL,
+				result JSONB NOT NULL,
+				created_by BIGINT,
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				UNIQUE (factory_id, name)
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS nxd.financial_scenarios`,
+		},
+	},
+	{
+		// ─── Metas de produção (ver production_targets.go) ──────────────────
+		// Meta por ativo ou setor, por dia ou turno (shift_id nulo = todos),
+		// com vigência. O alerta de ritmo é uma regra em nxd.alert_rules
+		// (scope_type 'production_target', scope_id = id da meta).
+		Version: 28,
+		Name:    "production_targets",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS nxd.production_targets (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				sector_id UUID REFERENCES nxd.sectors(id) ON DELETE CASCADE,
+				asset_id UUID REFERENCES nxd.assets(id) ON DELETE CASCADE,
+				period TEXT NOT NULL CHECK (period IN ('day', 'shift')),
+				shift_id UUID REFERENCES nxd.shifts(id) ON DELETE CASCADE,
+				metric TEXT NOT NULL CHECK (metric IN ('pieces', 'oee', 'scrap_rate')),
+				target NUMERIC(18,4) NOT NULL CHECK (target >= 0),
+				valid_from DATE NOT NULL,
+				valid_to DATE,
+				notes TEXT,
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				updated_at TIMESTAMPTZ DEFAULT NOW(),
+				CHECK (num_nonnulls(sector_id, asset_id) = 1),
+				CHECK (period = 'shift' OR shift_id IS NULL),
+				CHECK (valid_to IS NULL OR valid_to >= valid_from)
+			)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_production_targets_scope ON nxd.production_targets (factory_id,
+				COALESCE(sector_id, '00000000-0000-0000-0000-000000000000'::uuid),
+				COALESCE(asset_id, '00000000-0000-0000-0000-000000000000'::uuid),
+				period, COALESCE(shift_id, '00000000-0000-0000-0000-000000000000'::uuid), metric, valid_from)`,
+			`CREATE INDEX IF NOT EXISTS idx_alert_rules_scope ON nxd.alert_rules (scope_type, scope_id)`,
+		},
+		Down: []string{
+			`DROP INDEX IF EXISTS nxd.idx_alert_rules_scope`,
+			`DELETE FROM nxd.alert_rules WHERE scope_type = 'production_target'`,
+			`DROP TABLE IF EXISTS nxd.production_targets`,
+		},
+	},
+	{
+		// ─── Benchmarking (ver benchmark.go) ────────────────────────────────
+		// benchmark_opt_in: a fábrica participa da mediana anônima do setor
+		// industrial; benchmark_snapshots guarda o resumo diário (somas, sem
+		// detalhe de setor/ativo) de onde a mediana é calculada.
+		Version: 29,
+		Name:    "benchmarking",
+		Up: []string{
+			`ALTER TABLE nxd.factories ADD COLUMN IF NOT EXISTS benchmark_opt_in BOOLEAN NOT NULL DEFAULT FALSE`,
+			`ALTER TABLE nxd.factories ADD COLUMN IF NOT EXISTS industry_segment TEXT`,
+			`CREATE TABLE IF NOT EXISTS nxd.benchmark_snapshots (
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				day DATE NOT NULL,
+				planned_s DOUBLE PRECISION NOT NULL DEFAULT 0,
+				down_s DOUBLE PRECISION NOT NULL DEFAULT 0,
+				oee DOUBLE PRECISION,
+				ok_count DOUBLE PRECISION NOT NULL DEFAULT 0,
+				nok_count DOUBLE PRECISION NOT NULL DEFAULT 0,
+				energy_kwh DOUBLE PRECISION NOT NULL DEFAULT 0,
+				loss DOUBLE PRECISION,
+				asset_hours DOUBLE PRECISION NOT NULL DEFAULT 0,
+				currency TEXT NOT NULL,
+				computed_at TIMESTAMPTZ DEFAULT NOW(),
+				PRIMARY KEY (factory_id, day)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_benchmark_snapshots_day ON nxd.benchmark_snapshots (day)`,
+			// O template "Comparativo Setores" passa a receber o ranking calculado.
+			`UPDATE nxd.report_templates
+				SET prompt_instructions = 'Use posições, percentis, quartis e variações de inputs.benchmark; não estime. Compare apenas métricas disponíveis; evidências em evidence_refs.'
+				WHERE name = 'Comparativo Setores' AND prompt_instructions = 'Compare apenas métricas disponíveis; evidências em evidence_refs.'`,
+		},
+		Down: []string{
+			`UPDATE nxd.report_templates
+				SET prompt_instructions = 'Compare apenas métricas disponíveis; evidências em evidence_refs.'
+				WHERE name = 'Comparativo Setores' AND prompt_instructions LIKE 'Use posições, percentis, quartis e variações%'`,
+			`DROP TABLE IF EXISTS nxd.benchmark_snapshots`,
+			`ALTER TABLE nxd.factories DROP COLUMN IF EXISTS industry_segment`,
+			`ALTER TABLE nxd.factories DROP COLUMN IF EXISTS benchmark_opt_in`,
+		},
+	},
+	{
+		// ─── Tempo de ciclo (ver cycle_times.go) ────────────────────────────
+		// tag_cycle: sinal de ciclo concluído do CLP (borda de subida = 1 ciclo);
+		// cycle_pieces: peças por ciclo (cavidades do molde). cycle_time_stats
+		// guarda a distribuição por ativo, hora e ordem; cycle_cursor o estado
+		// do extrator (contadores, último ciclo) entre lotes.
+		Version: 30,
+		Name:    "cycle_times",
+		Up: []string{
+			`ALTER TABLE nxd.tag_mapping ADD COLUMN IF NOT EXISTS tag_cycle TEXT`,
+			`ALTER TABLE nxd.tag_mapping ADD COLUMN IF NOT EXISTS cycle_pieces INT NOT NULL DEFAULT 1 CHECK (cycle_pieces > 0)`,
+			`CREATE TABLE IF NOT EXISTS nxd.cycle_time_stats (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				asset_id UUID NOT NULL REFERENCES nxd.assets(id) ON DELETE CASCADE,
+				bucket_start TIMESTAMPTZ NOT NULL,
+				order_id UUID REFERENCES nxd.production_orders(id) ON DELETE SET NULL,
+				cycles INT NOT NULL DEFAULT 0,
+				sum_s DOUBLE PRECISION NOT NULL DEFAULT 0,
+				sum_sq_s DOUBLE PRECISION NOT NULL DEFAULT 0,
+				min_s DOUBLE PRECISION,
+				max_s DOUBLE PRECISION,
+				hist INT[] NOT NULL,
+				ideal_s DOUBLE PRECISION,
+				micro_stops INT NOT NULL DEFAULT 0,
+				micro_stop_s DOUBLE PRECISION NOT NULL DEFAULT 0,
+				stops INT NOT NULL DEFAULT 0,
+				stop_s DOUBLE PRECISION NOT NULL DEFAULT 0,
+				updated_at TIMESTAMPTZ DEFAULT NOW()
+			)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_cycle_time_stats_key ON nxd.cycle_time_stats (asset_id, bucket_start,
+				COALESCE(order_id, '00000000-0000-0000-0000-000000000000'::uuid))`,
+			`CREATE INDEX IF NOT EXISTS idx_cycle_time_stats_factory ON nxd.cycle_time_stats (factory_id, bucket_start)`,
+			`CREATE INDEX IF NOT EXISTS idx_cycle_time_stats_order ON nxd.cycle_time_stats (order_id) WHERE order_id IS NOT NULL`,
+			`CREATE TABLE IF NOT EXISTS nxd.cycle_cursor (
+				asset_id UUID PRIMARY KEY REFERENCES nxd.assets(id) ON DELETE CASCADE,
+				last_ts TIMESTAMPTZ NOT NULL,
+				last_cycle_at TIMESTAMPTZ,
+				prev_ok DOUBLE PRECISION,
+				prev_nok DOUBLE PRECISION,
+				prev_signal DOUBLE PRECISION,
+				pending_pieces DOUBLE PRECISION NOT NULL DEFAULT 0,
+				updated_at TIMESTAMPTZ DEFAULT NOW()
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS nxd.cycle_cursor`,
+			`DROP TABLE IF EXISTS nxd.cycle_time_stats`,
+			`ALTER TABLE nxd.tag_mapping DROP COLUMN IF EXISTS cycle_pieces`,
+			`ALTER TABLE nxd.tag_mapping DROP COLUMN IF EXISTS tag_cycle`,
+		},
+	},
+	{
+		// ─── Previsão de séries (ver forecast.go) ───────────────────────────
+		// forecast_series: séries acompanhadas (o worker refaz a previsão a cada
+		// passo); forecasts + forecast_points guardam cada previsão emitida e,
+		// quando o bucket fecha, o valor real — base da acurácia.
+		Version: 31,
+		Name:    "forecasting",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS nxd.forecast_series (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				asset_id UUID NOT NULL REFERENCES nxd.assets(id) ON DELETE CASCADE,
+				metric_key TEXT NOT NULL,
+				granularity TEXT NOT NULL CHECK (granularity IN ('hour', 'day')),
+				horizon INT NOT NULL CHECK (horizon > 0),
+				active BOOLEAN NOT NULL DEFAULT TRUE,
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				UNIQUE (asset_id, metric_key, granularity)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_forecast_series_factory ON nxd.forecast_series (factory_id)`,
+			`CREATE TABLE IF NOT EXISTS nxd.forecasts (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				asset_id UUID NOT NULL REFERENCES nxd.assets(id) ON DELETE CASCADE,
+				metric_key TEXT NOT NULL,
+				granularity TEXT NOT NULL CHECK (granularity IN ('hour', 'day')),
+				series_id UUID REFERENCES nxd.forecast_series(id) ON DELETE SET NULL,
+				counter BOOLEAN NOT NULL DEFAULT FALSE,
+				season INT NOT NULL,
+				alpha DOUBLE PRECISION NOT NULL,
+				beta DOUBLE PRECISION NOT NULL,
+				gamma DOUBLE PRECISION NOT NULL,
+				phi DOUBLE PRECISION NOT NULL,
+				sigma DOUBLE PRECISION NOT NULL,
+				train_start TIMESTAMPTZ NOT NULL,
+				train_end TIMESTAMPTZ NOT NULL,
+				train_points INT NOT NULL,
+				imputed INT NOT NULL DEFAULT 0,
+				period_end TIMESTAMPTZ,
+				period_actual DOUBLE PRECISION,
+				period_total DOUBLE PRECISION,
+				period_lo95 DOUBLE PRECISION,
+				period_hi95 DOUBLE PRECISION,
+				created_at TIMESTAMPTZ DEFAULT NOW()
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_forecasts_series ON nxd.forecasts (asset_id, metric_key, granularity, created_at DESC)`,
+			`CREATE INDEX IF NOT EXISTS idx_forecasts_factory ON nxd.forecasts (factory_id, created_at DESC)`,
+			`CREATE TABLE IF NOT EXISTS nxd.forecast_points (
+				forecast_id UUID NOT NULL REFERENCES nxd.forecasts(id) ON DELETE CASCADE,
+				ts TIMESTAMPTZ NOT NULL,
+				lead INT NOT NULL,
+				yhat DOUBLE PRECISION NOT NULL,
+				lo80 DOUBLE PRECISION NOT NULL,
+				hi80 DOUBLE PRECISION NOT NULL,
+				lo95 DOUBLE PRECISION NOT NULL,
+				hi95 DOUBLE PRECISION NOT NULL,
+				actual DOUBLE PRECISION,
+				actual_at TIMESTAMPTZ,
+				PRIMARY KEY (forecast_id, ts)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_forecast_points_pending ON nxd.forecast_points (ts) WHERE actual_at IS NULL`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS nxd.forecast_points`,
+			`DROP TABLE IF EXISTS nxd.forecasts`,
+			`DROP TABLE IF EXISTS nxd.forecast_series`,
+		},
+	},
+	{
+		// ─── Saúde dos ativos (ver asset_health.go) ─────────────────────────
+		// health_models: pesos e limites do score por fábrica; cada alteração é
+		// uma nova versão (o histórico registra a versão usada). health_tags:
+		// tags monitoradas (ativo ou fábrica inteira) e o sentido da degradação.
+		// maintenance_events: manutenções realizadas (zeram as horas rodando).
+		// asset_health: histórico do score com a contribuição de cada fator.
+		Version: 32,
+		Name:    "asset_health",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS nxd.health_models (
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				version INT NOT NULL,
+				w_anomalies DOUBLE PRECISION NOT NULL CHECK (w_anomalies >= 0),
+				w_trend DOUBLE PRECISION NOT NULL CHECK (w_trend >= 0),
+				w_stops DOUBLE PRECISION NOT NULL CHECK (w_stops >= 0),
+				w_run_hours DOUBLE PRECISION NOT NULL CHECK (w_run_hours >= 0),
+				anomaly_full_per_day DOUBLE PRECISION NOT NULL CHECK (anomaly_full_per_day > 0),
+				trend_full_z DOUBLE PRECISION NOT NULL CHECK (trend_full_z > 0),
+				stops_full_per_day DOUBLE PRECISION NOT NULL CHECK (stops_full_per_day > 0),
+				maintenance_interval_h DOUBLE PRECISION NOT NULL CHECK (maintenance_interval_h > 0),
+				notes TEXT,
+				created_by BIGINT,
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				PRIMARY KEY (factory_id, version)
+			)`,
+			`CREATE TABLE IF NOT EXISTS nxd.health_tags (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				asset_id UUID REFERENCES nxd.assets(id) ON DELETE CASCADE,
+				metric_key TEXT NOT NULL,
+				direction TEXT NOT NULL DEFAULT 'up' CHECK (direction IN ('up', 'down', 'both')),
+				created_at TIMESTAMPTZ DEFAULT NOW()
+			)`,
+			`CREATE UNIQUE INDEX IF NOT EXISTS idx_health_tags_scope
+				ON nxd.health_tags (factory_id, COALESCE(asset_id, '00000000-0000-0000-0000-000000000000'::uuid), metric_key)`,
+			`CREATE TABLE IF NOT EXISTS nxd.maintenance_events (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				asset_id UUID NOT NULL REFERENCES nxd.assets(id) ON DELETE CASCADE,
+				performed_at TIMESTAMPTZ NOT NULL,
+				kind TEXT NOT NULL CHECK (kind IN ('preventive', 'corrective')),
+				description TEXT,
+				next_interval_h DOUBLE PRECISION CHECK (next_interval_h > 0),
+				created_by BIGINT,
+				created_at TIMESTAMPTZ DEFAULT NOW()
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_maintenance_events_asset ON nxd.maintenance_events (asset_id, performed_at DESC)`,
+			`CREATE TABLE IF NOT EXISTS nxd.asset_health (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				asset_id UUID NOT NULL REFERENCES nxd.assets(id) ON DELETE CASCADE,
+				computed_at TIMESTAMPTZ NOT NULL,
+				score DOUBLE PRECISION,
+				status TEXT NOT NULL,
+				algorithm TEXT NOT NULL,
+				model_version INT NOT NULL,
+				factors JSONB NOT NULL,
+				run_s DOUBLE PRECISION,
+				maintenance_at TIMESTAMPTZ
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_asset_health_asset ON nxd.asset_health (asset_id, computed_at DESC)`,
+			`CREATE INDEX IF NOT EXISTS idx_asset_health_factory ON nxd.asset_health (factory_id, computed_at DESC)`,
+			// O template "Saúde dos Ativos" passa a receber o score calculado.
+			`UPDATE nxd.report_templates
+				SET prompt_instructions = 'Use o health score e a contribuição de cada fator de inputs.health e MTBF, MTTR, falhas e disponibilidade de inputs.reliability; não estime. Recomendações apenas com evidência.'
+				WHERE name = 'Saúde dos Ativos' AND prompt_instructions LIKE 'Use MTBF, MTTR, falhas e disponibilidade%'`,
+		},
+		Down: []string{
+			`UPDATE nxd.report_templates
+				SET prompt_instructions = 'Use MTBF, MTTR, falhas e disponibilidade calculados em inputs.reliability; não estime. Health score e alertas; recomendações apenas com evidência.'
+				WHERE name = 'Saúde dos Ativos' AND prompt_instructions LIKE 'Use o health score%'`,
+			`DROP TABLE IF EXISTS nxd.asset_health`,
+			`DROP TABLE IF EXISTS nxd.maintenance_events`,
+			`DROP TABLE IF EXISTS nxd.health_tags`,
+			`DROP TABLE IF EXISTS nxd.health_models`,
+		},
+	},
+	{
+		// ─── Inspeções de qualidade / não conformidades (ver inspections.go) ─
+		// Cada registro é uma quantidade de um tipo de defeito encontrada na
+		// inspeção, ligada ao ativo, à ordem e ao intervalo em que as peças foram
+		// produzidas; a quantidade passa de OK para NOK nos KPIs e no financeiro.
+		// inspection_attachments guarda só metadados (o arquivo fica no storage).
+		Version: 33,
+		Name:    "quality_inspections",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS nxd.defect_types (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				code TEXT NOT NULL,
+				name TEXT NOT NULL,
+				active BOOLEAN NOT NULL DEFAULT TRUE,
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				UNIQUE (factory_id, code)
+			)`,
+			`CREATE TABLE IF NOT EXISTS nxd.inspections (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				asset_id UUID NOT NULL REFERENCES nxd.assets(id) ON DELETE CASCADE,
+				order_id UUID REFERENCES nxd.production_orders(id) ON DELETE SET NULL,
+				defect_type_id UUID NOT NULL REFERENCES nxd.defect_types(id),
+				quantity DOUBLE PRECISION NOT NULL CHECK (quantity > 0),
+				inspected_at TIMESTAMPTZ NOT NULL,
+				produced_start TIMESTAMPTZ,
+				produced_end TIMESTAMPTZ,
+				inspector TEXT,
+				notes TEXT,
+				created_by BIGINT,
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				CHECK ((produced_start IS NULL) = (produced_end IS NULL)),
+				CHECK (produced_end IS NULL OR (produced_end >= produced_start AND produced_end <= inspected_at))
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_inspections_factory_inspected ON nxd.inspections (factory_id, inspected_at DESC)`,
+			`CREATE INDEX IF NOT EXISTS idx_inspections_asset_inspected ON nxd.inspections (asset_id, inspected_at)`,
+			`CREATE INDEX IF NOT EXISTS idx_inspections_order ON nxd.inspections (order_id) WHERE order_id IS NOT NULL`,
+			`CREATE TABLE IF NOT EXISTS nxd.inspection_attachments (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				inspection_id UUID NOT NULL REFERENCES nxd.inspections(id) ON DELETE CASCADE,
+				file_name TEXT NOT NULL,
+				content_type TEXT,
+				size_bytes BIGINT CHECK (size_bytes >= 0),
+				storage_url TEXT NOT NULL,
+				created_by BIGINT,
+				created_at TIMESTAMPTZ DEFAULT NOW()
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_inspection_attachments_inspection ON nxd.inspection_attachments (inspection_id)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS nxd.inspection_attachments`,
+			`DROP TABLE IF EXISTS nxd.inspections`,
+			`DROP TABLE IF EXISTS nxd.defect_types`,
+		},
+	},
+	{
+		// ─── Anotações / diário do operador (ver annotations.go) ────────────
+		// Intervenções conhecidas na linha do tempo ("troca de molde 10:32",
+		// "novo lote de matéria-prima"): instante (ends_at NULL) ou intervalo, com
+		// escopo ativo, setor ou fábrica (ambos NULL). author_name é gravado na
+		// criação porque os usuários ficam no banco principal.
+		Version: 34,
+		Name:    "annotations",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS nxd.annotations (
+				id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				sector_id UUID REFERENCES nxd.sectors(id) ON DELETE CASCADE,
+				asset_id UUID REFERENCES nxd.assets(id) ON DELETE CASCADE,
+				starts_at TIMESTAMPTZ NOT NULL,
+				ends_at TIMESTAMPTZ,
+				category TEXT NOT NULL,
+				text TEXT NOT NULL,
+				author_id BIGINT,
+				author_name TEXT,
+				created_at TIMESTAMPTZ DEFAULT NOW(),
+				updated_at TIMESTAMPTZ DEFAULT NOW(),
+				CHECK (ends_at IS NULL OR ends_at >= starts_at)
+			)`,
+			`CREATE INDEX IF NOT EXISTS idx_annotations_factory_starts ON nxd.annotations (factory_id, starts_at DESC)`,
+			`CREATE INDEX IF NOT EXISTS idx_annotations_asset_starts ON nxd.annotations (asset_id, starts_at) WHERE asset_id IS NOT NULL`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS nxd.annotations`,
+		},
+	},
+	{
+		// ─── Intervalos consolidados em telemetry_rollup_1m (ver forecast.go) ──
+		// Um registro por trecho contínuo já agregado de uma série; quem consolida
+		// preenche só as lacunas de [start, end) e grava o trecho unido.
+		Version: 35,
+		Name:    "rollup_ranges",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS nxd.rollup_ranges (
+				factory_id UUID NOT NULL REFERENCES nxd.factories(id) ON DELETE CASCADE,
+				asset_id UUID NOT NULL REFERENCES nxd.assets(id) ON DELETE CASCADE,
+				metric_key TEXT NOT NULL,
+				bucket_start TIMESTAMPTZ NOT NULL,
+				bucket_end TIMESTAMPTZ NOT NULL,
+				PRIMARY KEY (factory_id, asset_id, metric_key, bucket_start),
+				CHECK (bucket_end > bucket_start)
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS nxd.rollup_ranges`,
+		},
+	},
 }
 
-var sqliteMigrations = []string{
-	`CREATE TABLE IF NOT EXISTS users (
-		id TEXT PRIMARY KEY,
-		name TEXT NOT NULL,
-		email TEXT NOT NULL UNIQUE,
-		password_hash TEXT NOT NULL,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	)`,
-	`CREATE TABLE IF NOT EXISTS sectors (
-		id TEXT PRIMARY KEY,
-		name TEXT NOT NULL,
-		description TEXT,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	)`,
-	`CREATE TABLE IF NOT EXISTS assets (
-		id TEXT PRIMARY KEY,
-		factory_id TEXT NOT NULL,
-		source_tag_id TEXT NOT NULL,
-		display_name TEXT NOT NULL,
-		description TEXT,
-		created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
-		updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
-	)`,
-	`CREATE TABLE IF NOT EXISTS asset_telemetry (
-		ts DATETIME NOT NULL,
-		asset_id TEXT NOT NULL REFERENCES assets(id) ON DELETE CASCADE,
-		metric_key TEXT NOT NULL,
-		metric_value REAL NOT NULL
-	)`,
-	`CREATE TABLE IF NOT EXISTS audit_log (
-		id TEXT PRIMARY KEY,
-		ts DATETIME DEFAULT CURRENT_TIMESTAMP,
-		action TEXT NOT NULL,
-		api_key TEXT,
-		device_id TEXT,
-		status TEXT,
-		message TEXT,
-		ip_address TEXT
-	)`,
+var sqliteMigrations = []Migration{
+	{
+		Version: 1,
+		Name:    "core_tables",
+		Up: []string{
+			`CREATE TABLE IF NOT EXISTS users (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				email TEXT NOT NULL UNIQUE,
+				password_hash TEXT NOT NULL,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE TABLE IF NOT EXISTS sectors (
+				id TEXT PRIMARY KEY,
+				name TEXT NOT NULL,
+				description TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE TABLE IF NOT EXISTS assets (
+				id TEXT PRIMARY KEY,
+				factory_id TEXT NOT NULL,
+				source_tag_id TEXT NOT NULL,
+				display_name TEXT NOT NULL,
+				description TEXT,
+				created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+				updated_at DATETIME DEFAULT CURRENT_TIMESTAMP
+			)`,
+			`CREATE TABLE IF NOT EXISTS asset_telemetry (
+				ts DATETIME NOT NULL,
+				asset_id TEXT NOT NULL REFERENCES assets(id) ON DELETE CASCADE,
+				metric_key TEXT NOT NULL,
+				metric_value REAL NOT NULL
+			)`,
+			`CREATE TABLE IF NOT EXISTS audit_log (
+				id TEXT PRIMARY KEY,
+				ts DATETIME DEFAULT CURRENT_TIMESTAMP,
+				action TEXT NOT NULL,
+				api_key TEXT,
+				device_id TEXT,
+				status TEXT,
+				message TEXT,
+				ip_address TEXT
+			)`,
+		},
+		Down: []string{
+			`DROP TABLE IF EXISTS audit_log`,
+			`DROP TABLE IF EXISTS asset_telemetry`,
+			`DROP TABLE IF EXISTS assets`,
+			`DROP TABLE IF EXISTS sectors`,
+			`DROP TABLE IF EXISTS users`,
+		},
+	},
 }
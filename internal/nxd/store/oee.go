@@ -0,0 +1,516 @@
+package store
+
+// oee.go — Motor determinístico de OEE (disponibilidade × desempenho × qualidade)
+//
+// Fontes por ativo (nxd.tag_mapping):
+//   tag_status     → disponibilidade: leitura >= 0.5 = rodando, < 0.5 = parado
+//                    (mesma convenção de statusHoursParada). Cada leitura vale até a
+//                    próxima, limitada a statusHold — depois disso o estado é
+//                    desconhecido (CLP offline não conta como rodando nem parado).
+//   tag_ok/tag_nok → qualidade = OK / (OK + NOK), deltas pela reading_rule (último
+//                    valor ou contador, counters.go), lidos em lote (telemetry_batch.go)
+//                    para o período e todos os buckets.
+//   ideal_cycle_s  → desempenho = ciclo ideal × (OK + NOK) / tempo rodando (máx. 1).
+//
+// Só conta o tempo programado do calendário (calendar.go: turnos, feriados,
+// horas extras); dentro dele, paradas planejadas (nxd.planned_downtime) são
+// descontadas do tempo planejado e dos tempos rodando/parado. Setor e fábrica somam tempos e contagens dos ativos
+// (não é média de percentuais): disponibilidade = Σrodando / Σ(rodando + parado),
+// desempenho só com ativos que têm ciclo ideal.
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	oeeDefaultStatusHold = 15 * time.Minute
+	oeeMaxBuckets        = 500
+)
+
+// OEEQuery define escopo, período e granularidade da tendência (Bucket 0 = sem tendência).
+type OEEQuery struct {
+	FactoryID uuid.UUID
+	SectorID  *uuid.UUID
+	AssetID   *uuid.UUID
+	Start     time.Time
+	End       time.Time
+	Bucket    time.Duration
+}
+
+// OEEResult — OEE de um ativo, setor ou do total do escopo. Componentes nil =
+// dados insuficientes (ver Missing).
+type OEEResult struct {
+	Scope            string     `json:"scope"` // asset | sector | total
+	ID               *uuid.UUID `json:"id,omitempty"`
+	Name             string     `json:"name,omitempty"`
+	SectorID         *uuid.UUID `json:"sector_id,omitempty"`
+	ScheduledTimeS   float64    `json:"scheduled_time_s"` // tempo em turno no período
+	PlannedTimeS     float64    `json:"planned_time_s"`   // programado − paradas planejadas
+	PlannedDowntimeS float64    `json:"planned_downtime_s"`
+	RunTimeS         float64    `json:"run_time_s"`
+	DownTimeS        float64    `json:"down_time_s"`
+	DataCoverage     *float64   `json:"data_coverage,omitempty"` // (rodando + parado) / tempo planejado
+	OKCount          float64    `json:"ok_count"`
+	NOKCount         float64    `json:"nok_count"`
+	InspectionNOK    float64    `json:"inspection_nok,omitempty"` // NC de inspeção já incluídas em NOKCount
+	IdealCycleS      *float64   `json:"ideal_cycle_s,omitempty"`
+	Availability     *float64   `json:"availability"`
+	Performance      *float64   `json:"performance"`
+	Quality          *float64   `json:"quality"`
+	OEE              *float64   `json:"oee"`
+	Missing          []string   `json:"missing,omitempty"`
+}
+
+// OEETrendPoint — OEE do escopo em um bucket.
+type OEETrendPoint struct {
+	BucketStart   time.Time `json:"bucket_start"`
+	BucketEnd     time.Time `json:"bucket_end"`
+	RunTimeS      float64   `json:"run_time_s"`
+	DownTimeS     float64   `json:"down_time_s"`
+	OKCount       float64   `json:"ok_count"`
+	NOKCount      float64   `json:"nok_count"`
+	InspectionNOK float64   `json:"inspection_nok,omitempty"`
+	Availability  *float64  `json:"availability"`
+	Performance   *float64  `json:"performance"`
+	Quality       *float64  `json:"quality"`
+	OEE           *float64  `json:"oee"`
+}
+
+// OEEReport — resultado completo de ComputeOEE.
+type OEEReport struct {
+	PeriodStart time.Time       `json:"period_start"`
+	PeriodEnd   time.Time       `json:"period_end"`
+	BucketS     int64           `json:"bucket_s,omitempty"`
+	Total       OEEResult       `json:"total"`
+	Sectors     []OEEResult     `json:"sectors"`
+	Assets      []OEEResult     `json:"assets"`
+	Trend       []OEETrendPoint `json:"trend,omitempty"`
+}
+
+// oeeAccum soma tempos (s) e contagens; os percentuais saem de result().
+type oeeAccum struct {
+	scheduled                float64
+	planned, plannedDowntime float64
+	run, down                float64
+	ok, nok                  float64
+	inspectionNOK            float64
+	idealWork, runWithIdeal  float64
+}
+
+func (a *oeeAccum) add(b oeeAccum) {
+	a.scheduled += b.scheduled
+	a.planned += b.planned
+	a.plannedDowntime += b.plannedDowntime
+	a.run += b.run
+	a.down += b.down
+	a.ok += b.ok
+	a.nok += b.nok
+	a.inspectionNOK += b.inspectionNOK
+	a.idealWork += b.idealWork
+	a.runWithIdeal += b.runWithIdeal
+}
+
+func (a oeeAccum) ratios() (avail, perf, qual, oee *float64) {
+	if a.run+a.down > 0 {
+		v := a.run / (a.run + a.down)
+		avail = &v
+	}
+	if a.runWithIdeal > 0 {
+		v := a.idealWork / a.runWithIdeal
+		if v > 1 {
+			v = 1
+		}
+		perf = &v
+	}
+	if a.ok+a.nok > 0 {
+		v := a.ok / (a.ok + a.nok)
+		qual = &v
+	}
+	if avail != nil && perf != nil && qual != nil {
+		v := *avail * *perf * *qual
+		oee = &v
+	}
+	return
+}
+
+func (a oeeAccum) fill(r *OEEResult) {
+	r.ScheduledTimeS = a.scheduled
+	r.PlannedTimeS = a.planned
+	r.PlannedDowntimeS = a.plannedDowntime
+	r.RunTimeS = a.run
+	r.DownTimeS = a.down
+	r.OKCount = a.ok
+	r.NOKCount = a.nok
+	r.InspectionNOK = a.inspectionNOK
+	if a.planned > 0 {
+		c := (a.run + a.down) / a.planned
+		r.DataCoverage = &c
+	}
+	r.Availability, r.Performance, r.Quality, r.OEE = a.ratios()
+}
+
+// statusPoint é uma leitura de tag_status.
+type statusPoint struct {
+	Ts      time.Time
+	Running bool
+}
+
+// integrateStatus soma os segundos rodando/parado em [start, end), sem os
+// intervalos excluídos (fora de turno + paradas planejadas, já unidos por
+// mergeRanges). Cada leitura vale até a próxima ou até hold, o que vier primeiro.
+func integrateStatus(series []statusPoint, start, end time.Time, excluded []timeRange, hold time.Duration) (run, down float64) {
+	for i, p := range series {
+		if !p.Ts.Before(end) {
+			break
+		}
+		segEnd := end
+		if i+1 < len(series) && series[i+1].Ts.Before(segEnd) {
+			segEnd = series[i+1].Ts
+		}
+		if limit := p.Ts.Add(hold); limit.Before(segEnd) {
+			segEnd = limit
+		}
+		segStart := p.Ts
+		if segStart.Before(start) {
+			segStart = start
+		}
+		if !segEnd.After(segStart) {
+			continue
+		}
+		d := segEnd.Sub(segStart).Seconds() - overlapSeconds(excluded, segStart, segEnd)
+		if p.Running {
+			run += d
+		} else {
+			down += d
+		}
+	}
+	return run, down
+}
+
+// loadStatusSeries lê tag_status em [start, end), mais a última leitura anterior
+// a start (dentro de hold) para o estado inicial.
+func loadStatusSeries(db *sql.DB, assetID uuid.UUID, metricKey string, start, end time.Time, hold time.Duration) ([]statusPoint, error) {
+	var series []statusPoint
+	var ts time.Time
+	var val float64
+	err := db.QueryRow(`
+		SELECT ts, metric_value FROM nxd.telemetry_log
+		WHERE asset_id = $1 AND metric_key = $2 AND ts < $3 AND ts >= $4 AND metric_value IS NOT NULL
+		ORDER BY ts DESC LIMIT 1
+	`, assetID, metricKey, start, start.Add(-hold)).Scan(&ts, &val)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	if err == nil {
+		series = append(series, statusPoint{Ts: ts, Running: val >= 0.5})
+	}
+	rows, err := db.Query(`
+		SELECT ts, metric_value FROM nxd.telemetry_log
+		WHERE asset_id = $1 AND metric_key = $2 AND ts >= $3 AND ts < $4 AND metric_value IS NOT NULL
+		ORDER BY ts ASC
+	`, assetID, metricKey, start, end)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		if err := rows.Scan(&ts, &val); err != nil {
+			return nil, err
+		}
+		series = append(series, statusPoint{Ts: ts, Running: val >= 0.5})
+	}
+	return series, rows.Err()
+}
+
+type oeeAsset struct {
+	id         uuid.UUID
+	name       string
+	sectorID   *uuid.UUID
+	sectorName string
+	hold       time.Duration
+	mapping    *TagMappingRow
+	// unscheduled: fora do calendário; excluded: unscheduled ∪ paradas planejadas.
+	unscheduled []timeRange
+	excluded    []timeRange
+	// defects: NCs de inspeção, reclassificadas de OK para NOK (ver inspections.go).
+	defects []qualityDefect
+}
+
+// window calcula o acumulado de um ativo em [start, end); counts são as leituras
+// OK/NOK da janela, já executadas pelo lote.
+func (a *oeeAsset) window(series []statusPoint, counts oeeCounts, start, end time.Time) oeeAccum {
+	var acc oeeAccum
+	total := end.Sub(start).Seconds()
+	acc.scheduled = total - overlapSeconds(a.unscheduled, start, end)
+	acc.planned = total - overlapSeconds(a.excluded, start, end)
+	acc.plannedDowntime = acc.scheduled - acc.planned
+	if a.mapping == nil {
+		return acc
+	}
+	if a.mapping.TagStatus != "" {
+		acc.run, acc.down = integrateStatus(series, start, end, a.excluded, a.hold)
+	}
+	acc.ok, acc.nok = counts.values()
+	if a.mapping.IdealCycleS != nil && *a.mapping.IdealCycleS > 0 && a.mapping.TagStatus != "" {
+		acc.idealWork = *a.mapping.IdealCycleS * (acc.ok + acc.nok)
+		acc.runWithIdeal = acc.run
+	}
+	acc.inspectionNOK = defectQtyIn(a.defects, start, end)
+	acc.ok, acc.nok = reclassifyDefects(acc.ok, acc.nok, acc.inspectionNOK)
+	return acc
+}
+
+// oeeCounts — deltas OK/NOK planejados de uma janela (nil = tag não mapeada).
+type oeeCounts struct {
+	ok, nok *telemetryRead
+}
+
+// planCounts planeja os deltas OK/NOK da janela no lote (mesma regra do financeiro).
+func (a *oeeAsset) planCounts(b *telemetryBatch, start, end time.Time) oeeCounts {
+	var c oeeCounts
+	if a.mapping == nil {
+		return c
+	}
+	if a.mapping.TagOK != "" {
+		c.ok = b.delta(a.id, a.mapping.TagOK, a.mapping.ReadingRule, start, end)
+	}
+	if a.mapping.TagNOK != "" {
+		c.nok = b.delta(a.id, a.mapping.TagNOK, a.mapping.ReadingRule, start, end)
+	}
+	return c
+}
+
+func (c oeeCounts) values() (ok, nok float64) {
+	if c.ok != nil {
+		ok = c.ok.value
+	}
+	if c.nok != nil {
+		nok = c.nok.value
+	}
+	return ok, nok
+}
+
+// ComputeOEE calcula OEE por ativo, por setor e o total do escopo no período,
+// com tendência por bucket quando q.Bucket > 0.
+func ComputeOEE(db *sql.DB, q OEEQuery) (*OEEReport, error) {
+	if !q.Start.Before(q.End) {
+		return nil, fmt.Errorf("período inválido")
+	}
+	var nBuckets int
+	if q.Bucket > 0 {
+		nBuckets = int((q.End.Sub(q.Start) + q.Bucket - 1) / q.Bucket)
+		if nBuckets > oeeMaxBuckets {
+			return nil, fmt.Errorf("tendência com %d buckets (máximo %d): aumente o bucket", nBuckets, oeeMaxBuckets)
+		}
+	}
+
+	assets, err := loadOEEAssets(db, q)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &OEEReport{
+		PeriodStart: q.Start,
+		PeriodEnd:   q.End,
+		Sectors:     []OEEResult{},
+		Assets:      []OEEResult{},
+	}
+	if q.Bucket > 0 {
+		report.BucketS = int64(q.Bucket / time.Second)
+	}
+	var total oeeAccum
+	trend := make([]oeeAccum, nBuckets)
+	type sectorAgg struct {
+		res OEEResult
+		acc oeeAccum
+	}
+	var sectorOrder []string
+	sectors := map[string]*sectorAgg{}
+
+	// Contagens do período e de cada bucket num só lote: uma consulta por janela
+	// para todas as séries OK/NOK, em vez de duas consultas por ativo e bucket.
+	batch := newTelemetryBatch()
+	counts := make([][]oeeCounts, len(assets))
+	for j, a := range assets {
+		counts[j] = make([]oeeCounts, nBuckets+1)
+		counts[j][0] = a.planCounts(batch, q.Start, q.End)
+		for i := 0; i < nBuckets; i++ {
+			bs, be := oeeBucket(q, i)
+			counts[j][i+1] = a.planCounts(batch, bs, be)
+		}
+	}
+	if err := batch.run(db); err != nil {
+		return nil, fmt.Errorf("contagens: %w", err)
+	}
+
+	for j, a := range assets {
+		var series []statusPoint
+		if a.mapping != nil && a.mapping.TagStatus != "" {
+			series, err = loadStatusSeries(db, a.id, a.mapping.TagStatus, q.Start, q.End, a.hold)
+			if err != nil {
+				return nil, fmt.Errorf("status %s: %w", a.id, err)
+			}
+		}
+		acc := a.window(series, counts[j][0], q.Start, q.End)
+		id := a.id
+		res := OEEResult{Scope: "asset", ID: &id, Name: a.name, SectorID: a.sectorID}
+		acc.fill(&res)
+		switch {
+		case a.mapping == nil:
+			res.Missing = append(res.Missing, "tag_mapping")
+		default:
+			res.IdealCycleS = a.mapping.IdealCycleS
+			if a.mapping.TagStatus == "" {
+				res.Missing = append(res.Missing, "tag_status")
+			}
+			if a.mapping.TagOK == "" {
+				res.Missing = append(res.Missing, "tag_ok")
+			}
+			if a.mapping.IdealCycleS == nil {
+				res.Missing = append(res.Missing, "ideal_cycle_s")
+			}
+		}
+		report.Assets = append(report.Assets, res)
+		total.add(acc)
+
+		key := ""
+		if a.sectorID != nil {
+			key = a.sectorID.String()
+		}
+		s, ok := sectors[key]
+		if !ok {
+			s = &sectorAgg{res: OEEResult{Scope: "sector", ID: a.sectorID, Name: a.sectorName}}
+			if a.sectorID == nil {
+				s.res.Name = "Sem setor"
+			}
+			sectors[key] = s
+			sectorOrder = append(sectorOrder, key)
+		}
+		s.acc.add(acc)
+
+		for i := 0; i < nBuckets; i++ {
+			bs, be := oeeBucket(q, i)
+			trend[i].add(a.window(series, counts[j][i+1], bs, be))
+		}
+	}
+
+	for _, k := range sectorOrder {
+		s := sectors[k]
+		s.acc.fill(&s.res)
+		report.Sectors = append(report.Sectors, s.res)
+	}
+	report.Total = OEEResult{Scope: "total"}
+	total.fill(&report.Total)
+	if len(assets) == 0 {
+		// Sem ativos no escopo: o tempo planejado é o do período (sem janelas).
+		report.Total.PlannedTimeS = q.End.Sub(q.Start).Seconds()
+		report.Total.ScheduledTimeS = report.Total.PlannedTimeS
+	}
+	for i, acc := range trend {
+		bs, be := oeeBucket(q, i)
+		p := OEETrendPoint{BucketStart: bs, BucketEnd: be, RunTimeS: acc.run, DownTimeS: acc.down, OKCount: acc.ok, NOKCount: acc.nok,
+			InspectionNOK: acc.inspectionNOK}
+		p.Availability, p.Performance, p.Quality, p.OEE = acc.ratios()
+		report.Trend = append(report.Trend, p)
+	}
+	return report, nil
+}
+
+// oeeBucket retorna os limites do i-ésimo bucket da tendência (o último termina em q.End).
+func oeeBucket(q OEEQuery, i int) (start, end time.Time) {
+	start = q.Start.Add(time.Duration(i) * q.Bucket)
+	end = start.Add(q.Bucket)
+	if end.After(q.End) {
+		end = q.End
+	}
+	return start, end
+}
+
+// loadOEEAssets carrega os ativos do escopo com mapeamento, calendário, paradas planejadas
+// e NCs de inspeção.
+func loadOEEAssets(db *sql.DB, q OEEQuery) ([]*oeeAsset, error) {
+	query := `
+		SELECT a.id, COALESCE(a.display_name, a.source_tag_id), a.group_id, COALESCE(s.name, ''), a.expected_interval_s
+		FROM nxd.assets a
+		LEFT JOIN nxd.sectors s ON s.id = a.group_id
+		WHERE a.factory_id = $1`
+	args := []interface{}{q.FactoryID}
+	if q.SectorID != nil {
+		args = append(args, *q.SectorID)
+		query += fmt.Sprintf(" AND a.group_id = $%d", len(args))
+	}
+	if q.AssetID != nil {
+		args = append(args, *q.AssetID)
+		query += fmt.Sprintf(" AND a.id = $%d", len(args))
+	}
+	rows, err := db.Query(query+` ORDER BY s.name NULLS LAST, a.display_name`, args...)
+	if err != nil {
+		return nil, err
+	}
+	var assets []*oeeAsset
+	for rows.Next() {
+		a := &oeeAsset{hold: oeeDefaultStatusHold}
+		var sectorID uuid.NullUUID
+		var interval sql.NullInt64
+		if err := rows.Scan(&a.id, &a.name, &sectorID, &a.sectorName, &interval); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		if sectorID.Valid {
+			a.sectorID = &sectorID.UUID
+		}
+		if interval.Valid && interval.Int64 > 0 {
+			a.hold = 3 * time.Duration(interval.Int64) * time.Second
+			if a.hold < time.Minute {
+				a.hold = time.Minute
+			}
+		}
+		assets = append(assets, a)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	mappings, err := ListTagMappingsByFactory(db, q.FactoryID)
+	if err != nil {
+		return nil, err
+	}
+	byAsset := make(map[uuid.UUID]*TagMappingRow, len(mappings))
+	for i := range mappings {
+		byAsset[mappings[i].AssetID] = &mappings[i]
+	}
+	windows, err := ListPlannedDowntime(db, q.FactoryID, q.Start, q.End)
+	if err != nil {
+		return nil, err
+	}
+	cal, err := LoadProductionCalendar(db, q.FactoryID, q.Start, q.End)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]uuid.UUID, len(assets))
+	for i, a := range assets {
+		ids[i] = a.id
+	}
+	defects, err := loadQualityDefects(db, ids, q.Start, q.End)
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range assets {
+		a.mapping = byAsset[a.id]
+		a.defects = defects[a.id]
+		a.unscheduled = cal.Unscheduled(a.sectorID, q.Start, q.End)
+		rs := append([]timeRange(nil), a.unscheduled...)
+		for _, w := range windows {
+			if w.appliesTo(a.id, a.sectorID) {
+				rs = append(rs, timeRange{w.StartsAt, w.EndsAt})
+			}
+		}
+		a.excluded = mergeRanges(rs)
+	}
+	return assets, nil
+}
@@ -0,0 +1,97 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestIntegrateStatusPlannedAndHold cobre a integração do tag_status: estado
+// inicial vindo de antes do período, paradas planejadas descontadas e leituras
+// que expiram após hold (estado desconhecido não conta).
+func TestIntegrateStatusPlannedAndHold(t *testing.T) {
+	t0 := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	at := func(min int) time.Time { return t0.Add(time.Duration(min) * time.Minute) }
+
+	series := []statusPoint{
+		{at(-5), true},  // rodando desde antes do período
+		{at(30), false}, // parado 08:30
+		{at(40), true},  // volta 08:40; última leitura
+	}
+	planned := mergeRanges([]timeRange{
+		{at(10), at(20)},
+		{at(15), at(25)}, // sobreposta: une em 08:10–08:25
+	})
+	if len(planned) != 1 || !planned[0].End.Equal(at(25)) {
+		t.Fatalf("mergeRanges = %v", planned)
+	}
+
+	run, down := integrateStatus(series, at(0), at(60), planned, 45*time.Minute)
+	// Rodando: 08:00–08:30 menos 15 min planejados = 15 min; 08:40–09:00 = 20 min.
+	if run != 35*60 || down != 10*60 {
+		t.Errorf("run, down = %v, %v; want %v, %v", run, down, 35*60, 10*60)
+	}
+	// Hold de 15 min: a leitura de 07:55 só vale até 08:10 e a de 08:40 até 08:55.
+	run, down = integrateStatus(series, at(0), at(60), planned, 15*time.Minute)
+	if run != 25*60 || down != 10*60 {
+		t.Errorf("hold: run, down = %v, %v; want %v, %v", run, down, 25*60, 10*60)
+	}
+
+	if got := overlapSeconds(planned, at(20), at(60)); got != 5*60 {
+		t.Errorf("overlapSeconds = %v, want %v", got, 5*60)
+	}
+
+	var acc oeeAccum
+	acc.add(oeeAccum{run: run, down: down, ok: 90, nok: 10, idealWork: 20 * 100, runWithIdeal: run})
+	a, p, q, oee := acc.ratios()
+	if a == nil || p == nil || q == nil || oee == nil {
+		t.Fatal("all components expected")
+	}
+	if *a != 25.0/35 || *q != 0.9 || *p != 1 { // 2000 s ideal / 1500 s rodando → limitado a 1
+		t.Errorf("A=%v P=%v Q=%v", *a, *p, *q)
+	}
+	if _, p, _, oee := (oeeAccum{run: 100, ok: 1}).ratios(); p != nil || oee != nil {
+		t.Error("without ideal cycle performance and OEE must be nil")
+	}
+}
+
+// TestOEETrendCountsFromOneSeries cobre as contagens da tendência: a série OK é
+// servida uma vez ao lote e cada bucket lê o seu trecho — a soma dos buckets é o
+// delta do período e o último bucket termina em q.End.
+func TestOEETrendCountsFromOneSeries(t *testing.T) {
+	t0 := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	q := OEEQuery{Start: t0, End: t0.Add(150 * time.Minute), Bucket: time.Hour}
+	if s, e := oeeBucket(q, 2); !s.Equal(t0.Add(2*time.Hour)) || !e.Equal(q.End) {
+		t.Fatalf("last bucket = %v..%v", s, e)
+	}
+	a := &oeeAsset{id: uuid.New(), mapping: &TagMappingRow{TagOK: "ok", ReadingRule: "delta"}}
+	var samples []telemetrySample
+	for m := 0; m <= 150; m += 10 {
+		samples = append(samples, telemetrySample{ts: t0.Add(time.Duration(m) * time.Minute), v: float64(m * 2)})
+	}
+	b := newTelemetryBatch()
+	total := a.planCounts(b, q.Start, q.End)
+	var buckets []oeeCounts
+	for i := 0; i < 3; i++ {
+		bs, be := oeeBucket(q, i)
+		buckets = append(buckets, a.planCounts(b, bs, be))
+	}
+	if total.nok != nil {
+		t.Fatal("NOK without tag_nok must not be planned")
+	}
+	b.serve(seriesKey{a.id, "ok"}, samples, CounterConfigRow{})
+
+	want := []float64{120, 120, 60}
+	var sum float64
+	for i, c := range buckets {
+		ok, nok := c.values()
+		if ok != want[i] || nok != 0 {
+			t.Errorf("bucket %d = %v/%v, want %v/0", i, ok, nok, want[i])
+		}
+		sum += ok
+	}
+	if ok, _ := total.values(); ok != 300 || sum != ok {
+		t.Errorf("period = %v, buckets = %v; want 300", ok, sum)
+	}
+}
@@ -0,0 +1,134 @@
+package store
+
+import (
+	"database/sql"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PlannedDowntimeRow — janela de parada planejada (manutenção preventiva, setup,
+// refeição...). Não conta como tempo planejado de produção no OEE.
+// AssetID e SectorID nulos = vale para a fábrica inteira.
+type PlannedDowntimeRow struct {
+	ID        uuid.UUID  `json:"id"`
+	FactoryID uuid.UUID  `json:"factory_id"`
+	SectorID  *uuid.UUID `json:"sector_id,omitempty"`
+	AssetID   *uuid.UUID `json:"asset_id,omitempty"`
+	StartsAt  time.Time  `json:"starts_at"`
+	EndsAt    time.Time  `json:"ends_at"`
+	Reason    string     `json:"reason,omitempty"`
+	CreatedBy *int64     `json:"created_by,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// ListPlannedDowntime retorna as janelas da fábrica que se sobrepõem a [from, to).
+func ListPlannedDowntime(db *sql.DB, factoryID uuid.UUID, from, to time.Time) ([]PlannedDowntimeRow, error) {
+	rows, err := db.Query(`
+		SELECT id, factory_id, sector_id, asset_id, starts_at, ends_at, COALESCE(reason, ''), created_by, created_at
+		FROM nxd.planned_downtime
+		WHERE factory_id = $1 AND starts_at < $3 AND ends_at > $2
+		ORDER BY starts_at
+	`, factoryID, from, to)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []PlannedDowntimeRow
+	for rows.Next() {
+		var r PlannedDowntimeRow
+		var sectorID, assetID uuid.NullUUID
+		var createdBy sql.NullInt64
+		if err := rows.Scan(&r.ID, &r.FactoryID, &sectorID, &assetID, &r.StartsAt, &r.EndsAt, &r.Reason, &createdBy, &r.CreatedAt); err != nil {
+			return nil, err
+		}
+		if sectorID.Valid {
+			r.SectorID = &sectorID.UUID
+		}
+		if assetID.Valid {
+			r.AssetID = &assetID.UUID
+		}
+		if createdBy.Valid {
+			r.CreatedBy = &createdBy.Int64
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// CreatePlannedDowntime insere uma janela de parada planejada.
+func CreatePlannedDowntime(db *sql.DB, r PlannedDowntimeRow) (uuid.UUID, error) {
+	var id uuid.UUID
+	err := db.QueryRow(`
+		INSERT INTO nxd.planned_downtime (factory_id, sector_id, asset_id, starts_at, ends_at, reason, created_by)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), $7)
+		RETURNING id
+	`, r.FactoryID, r.SectorID, r.AssetID, r.StartsAt, r.EndsAt, r.Reason, r.CreatedBy).Scan(&id)
+	return id, err
+}
+
+// DeletePlannedDowntime remove uma janela da fábrica. Retorna false se não existir.
+func DeletePlannedDowntime(db *sql.DB, factoryID, id uuid.UUID) (bool, error) {
+	res, err := db.Exec(`DELETE FROM nxd.planned_downtime WHERE id = $1 AND factory_id = $2`, id, factoryID)
+	if err != nil {
+		return false, err
+	}
+	n, _ := res.RowsAffected()
+	return n > 0, nil
+}
+
+// appliesTo indica se a janela vale para o ativo (do setor informado).
+func (r PlannedDowntimeRow) appliesTo(assetID uuid.UUID, sectorID *uuid.UUID) bool {
+	if r.AssetID != nil {
+		return *r.AssetID == assetID
+	}
+	if r.SectorID != nil {
+		return sectorID != nil && *r.SectorID == *sectorID
+	}
+	return true
+}
+
+// timeRange é um intervalo [Start, End).
+type timeRange struct {
+	Start, End time.Time
+}
+
+// mergeRanges ordena e une intervalos sobrepostos ou contíguos.
+func mergeRanges(rs []timeRange) []timeRange {
+	if len(rs) == 0 {
+		return nil
+	}
+	sorted := append([]timeRange(nil), rs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Start.Before(sorted[j].Start) })
+	out := []timeRange{sorted[0]}
+	for _, r := range sorted[1:] {
+		last := &out[len(out)-1]
+		if !r.Start.After(last.End) {
+			if r.End.After(last.End) {
+				last.End = r.End
+			}
+			continue
+		}
+		out = append(out, r)
+	}
+	return out
+}
+
+// overlapSeconds soma a interseção de intervalos já unidos (mergeRanges) com [start, end).
+func overlapSeconds(merged []timeRange, start, end time.Time) float64 {
+	var s float64
+	for _, r := range merged {
+		a, b := r.Start, r.End
+		if a.Before(start) {
+			a = start
+		}
+		if b.After(end) {
+			b = end
+		}
+		if b.After(a) {
+			s += b.Sub(a).Seconds()
+		}
+	}
+	return s
+}
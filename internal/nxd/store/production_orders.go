@@ -0,0 +1,746 @@
+package store
+
+// production_orders.go — Ordens de produção (lotes) e rentabilidade por produto
+//
+// Uma ordem cobre um ativo, um setor ou a fábrica inteira (asset_id e sector_id
+// nulos) entre started_at e ended_at. started_at nulo = ordem planejada (ainda
+// não começou); ended_at nulo = em execução.
+//
+// Ordens nascem pela API ou pelo detector, que lê o tag_order do mapeamento: o
+// valor é o número da ordem em execução no CLP (0 = nenhuma). Quando o valor
+// muda, o detector encerra a ordem aberta do ativo e inicia a próxima —
+// reaproveitando uma ordem planejada com o mesmo código (produto e meta vindos
+// da API/ERP) ou criando uma nova (source = tag).
+//
+// Os indicadores de cada ordem usam a mesma lógica do resumo financeiro
+// (aggregateFinancials): OK/NOK, horas parada, energia e custos. A ordem pode
+// sobrescrever o preço de venda (valor_venda_ok do produto).
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	productionOrderWorkerInterval  = time.Minute
+	productionOrderInitialLookback = 7 * 24 * time.Hour
+	productionOrderBatchSize       = 10000
+	// productionOrderMaxCompute limita as ordens calculadas por relatório de rentabilidade.
+	productionOrderMaxCompute = 200
+)
+
+var (
+	ErrProductionOrderNotFound = errors.New("ordem de produção não encontrada")
+	// ErrInvalidProductionOrder envolve erros de validação (campos, ativo/setor de outra fábrica).
+	ErrInvalidProductionOrder = errors.New("ordem de produção inválida")
+)
+
+// ProductionOrderRow — ordem de produção / lote.
+type ProductionOrderRow struct {
+	ID           uuid.UUID  `json:"id"`
+	FactoryID    uuid.UUID  `json:"factory_id"`
+	SectorID     *uuid.UUID `json:"sector_id,omitempty"`
+	AssetID      *uuid.UUID `json:"asset_id,omitempty"`
+	AssetName    string     `json:"asset_name,omitempty"`
+	OrderCode    string     `json:"order_code"`
+	Product      string     `json:"product,omitempty"`
+	TargetQty    *float64   `json:"target_qty,omitempty"`
+	ValorVendaOk *float64   `json:"valor_venda_ok,omitempty"` // preço do produto; nil = business_config
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	EndedAt      *time.Time `json:"ended_at,omitempty"`
+	Status       string     `json:"status"` // planned | running | done
+	Source       string     `json:"source"` // api | tag
+	CreatedAt    time.Time  `json:"created_at"`
+}
+
+// ProductionOrderQuery filtra ListProductionOrders. Com Start/End, retorna as
+// ordens que se sobrepõem a [Start, End) e as planejadas.
+type ProductionOrderQuery struct {
+	FactoryID  uuid.UUID
+	SectorID   *uuid.UUID
+	AssetID    *uuid.UUID
+	Product    string
+	Status     string // planned | running | done ("" = todas)
+	Started    bool   // só ordens iniciadas (running + done)
+	Start, End time.Time
+	Limit      int
+}
+
+// ProductionOrderResult — indicadores de uma ordem (até agora, se em execução).
+type ProductionOrderResult struct {
+	ProductionOrderRow
+	PeriodStart       *time.Time                `json:"period_start,omitempty"`
+	PeriodEnd         *time.Time                `json:"period_end,omitempty"`
+	DurationS         float64                   `json:"duration_s"`
+	Financial         *FinancialAggregateResult `json:"financial,omitempty"`
+	Assets            []AssetFinancialRow       `json:"assets,omitempty"`
+	DowntimeEvents    int                       `json:"downtime_events"`
+	DowntimeDurationS float64                   `json:"downtime_duration_s"`
+	TopDowntimeReason string                    `json:"top_downtime_reason,omitempty"`
+	Yield             float64                   `json:"yield"`              // OK / (OK + NOK)
+	Progress          *float64                  `json:"progress,omitempty"` // OK / meta
+	Margem            float64                   `json:"margem"`             // faturamento − material − refugo − energia − mão de obra − parada
+	MargemPorPeca     float64                   `json:"margem_por_peca"`
+}
+
+// ProductProfitability — soma das ordens de um produto.
+type ProductProfitability struct {
+	Product            string  `json:"product"`
+	Orders             int     `json:"orders"`
+	OKCount            float64 `json:"ok_count"`
+	NOKCount           float64 `json:"nok_count"`
+	HoursParada        float64 `json:"hours_parada"`
+	EnergiaKWh         float64 `json:"energia_kwh"`
+	DurationS          float64 `json:"duration_s"`
+	FaturamentoBruto   float64 `json:"faturamento_bruto"`
+	PerdaRefugo        float64 `json:"perda_refugo"`
+	CustoParada        float64 `json:"custo_parada"`
+	CustoEnergia       float64 `json:"custo_energia"`
+	CustoMaterial      float64 `json:"custo_material"`
+	CustoMaoObra       float64 `json:"custo_mao_obra"`
+	MargemContribuicao float64 `json:"margem_contribuicao"`
+	Margem             float64 `json:"margem"`
+	MargemPorPeca      float64 `json:"margem_por_peca"`
+	Yield              float64 `json:"yield"`
+	PecasPorHora       float64 `json:"pecas_por_hora"`
+	KWhPorPeca         float64 `json:"kwh_por_peca"`
+	CO2eKg             float64 `json:"co2e_kg"`
+	CO2eKgPorPeca      float64 `json:"co2e_kg_por_peca"`
+}
+
+// ─── CRUD ───────────────────────────────────────────────────────────────────
+
+const productionOrderColumns = `
+	o.id, o.factory_id, o.sector_id, o.asset_id, COALESCE(a.display_name, ''), o.order_code,
+	COALESCE(o.product, ''), o.target_qty, o.valor_venda_ok, o.started_at, o.ended_at, o.source, o.created_at`
+
+func scanProductionOrder(sc interface{ Scan(...interface{}) error }) (ProductionOrderRow, error) {
+	var o ProductionOrderRow
+	var sectorID, assetID uuid.NullUUID
+	var target, valor sql.NullFloat64
+	var started, ended sql.NullTime
+	err := sc.Scan(&o.ID, &o.FactoryID, &sectorID, &assetID, &o.AssetName, &o.OrderCode,
+		&o.Product, &target, &valor, &started, &ended, &o.Source, &o.CreatedAt)
+	if err != nil {
+		return o, err
+	}
+	if sectorID.Valid {
+		o.SectorID = &sectorID.UUID
+	}
+	if assetID.Valid {
+		o.AssetID = &assetID.UUID
+	}
+	if target.Valid {
+		o.TargetQty = &target.Float64
+	}
+	if valor.Valid {
+		o.ValorVendaOk = &valor.Float64
+	}
+	if started.Valid {
+		o.StartedAt = &started.Time
+	}
+	if ended.Valid {
+		o.EndedAt = &ended.Time
+	}
+	o.Status = productionOrderStatus(o.StartedAt, o.EndedAt)
+	return o, nil
+}
+
+func productionOrderStatus(started, ended *time.Time) string {
+	switch {
+	case started == nil:
+		return "planned"
+	case ended == nil:
+		return "running"
+	default:
+		return "done"
+	}
+}
+
+// ListProductionOrders lista ordens da fábrica (mais recentes primeiro; planejadas no topo).
+func ListProductionOrders(db *sql.DB, q ProductionOrderQuery) ([]ProductionOrderRow, error) {
+	query := `SELECT ` + productionOrderColumns + `
+		FROM nxd.production_orders o
+		LEFT JOIN nxd.assets a ON a.id = o.asset_id
+		WHERE o.factory_id = $1`
+	args := []interface{}{q.FactoryID}
+	arg := func(v interface{}) string {
+		args = append(args, v)
+		return fmt.Sprintf("$%d", len(args))
+	}
+	if q.SectorID != nil {
+		p := arg(*q.SectorID)
+		query += ` AND (o.sector_id = ` + p + ` OR a.group_id = ` + p + `)`
+	}
+	if q.AssetID != nil {
+		query += ` AND o.asset_id = ` + arg(*q.AssetID)
+	}
+	if q.Product != "" {
+		query += ` AND o.product = ` + arg(q.Product)
+	}
+	switch q.Status {
+	case "planned":
+		query += ` AND o.started_at IS NULL`
+	case "running":
+		query += ` AND o.started_at IS NOT NULL AND o.ended_at IS NULL`
+	case "done":
+		query += ` AND o.ended_at IS NOT NULL`
+	}
+	if q.Started {
+		query += ` AND o.started_at IS NOT NULL`
+	}
+	if !q.Start.IsZero() && !q.End.IsZero() {
+		query += ` AND (o.started_at IS NULL OR (o.started_at < ` + arg(q.End) +
+			` AND COALESCE(o.ended_at, 'infinity'::timestamptz) > ` + arg(q.Start) + `))`
+	}
+	query += ` ORDER BY o.started_at DESC NULLS FIRST, o.created_at DESC`
+	if q.Limit > 0 {
+		query += ` LIMIT ` + arg(q.Limit)
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []ProductionOrderRow
+	for rows.Next() {
+		o, err := scanProductionOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, o)
+	}
+	return list, rows.Err()
+}
+
+// GetProductionOrder retorna a ordem da fábrica (nil se não existir).
+func GetProductionOrder(db *sql.DB, factoryID, id uuid.UUID) (*ProductionOrderRow, error) {
+	o, err := scanProductionOrder(db.QueryRow(`SELECT `+productionOrderColumns+`
+		FROM nxd.production_orders o
+		LEFT JOIN nxd.assets a ON a.id = o.asset_id
+		WHERE o.id = $1 AND o.factory_id = $2`, id, factoryID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &o, nil
+}
+
+// validateProductionOrder confere campos e escopo. Com asset_id sem sector_id,
+// o setor da ordem passa a ser o do ativo.
+func validateProductionOrder(db *sql.DB, o *ProductionOrderRow) error {
+	o.OrderCode = strings.TrimSpace(o.OrderCode)
+	o.Product = strings.TrimSpace(o.Product)
+	if o.OrderCode == "" {
+		return fmt.Errorf("%w: order_code obrigatório", ErrInvalidProductionOrder)
+	}
+	if o.TargetQty != nil && *o.TargetQty < 0 {
+		return fmt.Errorf("%w: target_qty não pode ser negativo", ErrInvalidProductionOrder)
+	}
+	if o.ValorVendaOk != nil && *o.ValorVendaOk < 0 {
+		return fmt.Errorf("%w: valor_venda_ok não pode ser negativo", ErrInvalidProductionOrder)
+	}
+	if o.EndedAt != nil && (o.StartedAt == nil || !o.EndedAt.After(*o.StartedAt)) {
+		return fmt.Errorf("%w: ended_at deve ser posterior a started_at", ErrInvalidProductionOrder)
+	}
+	if o.AssetID != nil {
+		var groupID uuid.NullUUID
+		err := db.QueryRow(`SELECT group_id FROM nxd.assets WHERE id = $1 AND factory_id = $2`, *o.AssetID, o.FactoryID).Scan(&groupID)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("%w: ativo não encontrado", ErrInvalidProductionOrder)
+		}
+		if err != nil {
+			return err
+		}
+		if o.SectorID == nil && groupID.Valid {
+			o.SectorID = &groupID.UUID
+		}
+	}
+	if o.SectorID != nil {
+		s, err := GetSectorByID(db, *o.SectorID, o.FactoryID)
+		if err != nil {
+			return err
+		}
+		if s == nil {
+			return fmt.Errorf("%w: setor não encontrado", ErrInvalidProductionOrder)
+		}
+	}
+	return nil
+}
+
+// CreateProductionOrder insere a ordem. Uma ordem iniciada em um ativo encerra a
+// ordem que estava aberta nele (um ativo roda uma ordem por vez).
+func CreateProductionOrder(db *sql.DB, o ProductionOrderRow) (uuid.UUID, error) {
+	if err := validateProductionOrder(db, &o); err != nil {
+		return uuid.Nil, err
+	}
+	if o.Source == "" {
+		o.Source = "api"
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+	if o.AssetID != nil && o.StartedAt != nil && o.EndedAt == nil {
+		if _, err := tx.Exec(`
+			UPDATE nxd.production_orders SET ended_at = $1
+			WHERE asset_id = $2 AND ended_at IS NULL AND started_at IS NOT NULL AND started_at < $1
+		`, *o.StartedAt, *o.AssetID); err != nil {
+			return uuid.Nil, err
+		}
+	}
+	var id uuid.UUID
+	err = tx.QueryRow(`
+		INSERT INTO nxd.production_orders
+			(factory_id, sector_id, asset_id, order_code, product, target_qty, valor_venda_ok, started_at, ended_at, source)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, $8, $9, $10)
+		RETURNING id
+	`, o.FactoryID, o.SectorID, o.AssetID, o.OrderCode, o.Product, o.TargetQty, o.ValorVendaOk, o.StartedAt, o.EndedAt, o.Source).Scan(&id)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return id, tx.Commit()
+}
+
+// UpdateProductionOrder substitui os campos editáveis (escopo, código, produto,
+// meta, preço e janela). Retorna ErrProductionOrderNotFound se não existir.
+// Como em CreateProductionOrder, iniciar a ordem encerra a que estava aberta no ativo.
+func UpdateProductionOrder(db *sql.DB, o ProductionOrderRow) error {
+	if err := validateProductionOrder(db, &o); err != nil {
+		return err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if o.AssetID != nil && o.StartedAt != nil && o.EndedAt == nil {
+		if _, err := tx.Exec(`
+			UPDATE nxd.production_orders SET ended_at = $1
+			WHERE asset_id = $2 AND id <> $3 AND ended_at IS NULL AND started_at IS NOT NULL AND started_at < $1
+		`, *o.StartedAt, *o.AssetID, o.ID); err != nil {
+			return err
+		}
+	}
+	res, err := tx.Exec(`
+		UPDATE nxd.production_orders SET sector_id = $1, asset_id = $2, order_code = $3, product = NULLIF($4, ''),
+			target_qty = $5, valor_venda_ok = $6, started_at = $7, ended_at = $8
+		WHERE id = $9 AND factory_id = $10
+	`, o.SectorID, o.AssetID, o.OrderCode, o.Product, o.TargetQty, o.ValorVendaOk, o.StartedAt, o.EndedAt, o.ID, o.FactoryID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrProductionOrderNotFound
+	}
+	return tx.Commit()
+}
+
+// DeleteProductionOrder remove a ordem.
+func DeleteProductionOrder(db *sql.DB, factoryID, id uuid.UUID) error {
+	res, err := db.Exec(`DELETE FROM nxd.production_orders WHERE id = $1 AND factory_id = $2`, id, factoryID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return ErrProductionOrderNotFound
+	}
+	return nil
+}
+
+// ─── Indicadores ────────────────────────────────────────────────────────────
+
+// ComputeProductionOrder calcula OK/NOK, paradas, energia e custos da ordem com
+// a lógica de ComputeFinancialAggregate. Ordens em execução vão até now;
+// planejadas retornam sem indicadores.
+func ComputeProductionOrder(db *sql.DB, o ProductionOrderRow, now time.Time) (*ProductionOrderResult, error) {
+	res := &ProductionOrderResult{ProductionOrderRow: o}
+	if o.StartedAt == nil {
+		return res, nil
+	}
+	start, end := *o.StartedAt, now
+	if o.EndedAt != nil {
+		end = *o.EndedAt
+	}
+	if !end.After(start) {
+		return res, nil
+	}
+	res.PeriodStart, res.PeriodEnd = &start, &end
+	res.DurationS = end.Sub(start).Seconds()
+
+	var assetIDs []uuid.UUID
+	assetSector := map[uuid.UUID]*uuid.UUID{}
+	if o.AssetID != nil {
+		assetIDs = []uuid.UUID{*o.AssetID}
+		assetSector[*o.AssetID] = o.SectorID
+	} else {
+		var err error
+		if assetIDs, assetSector, err = financialAssets(db, o.FactoryID, o.SectorID); err != nil {
+			return nil, err
+		}
+	}
+	config, err := GetBusinessConfigBySector(db, o.FactoryID, o.SectorID)
+	if err != nil {
+		return nil, err
+	}
+	cfg := BusinessConfigRow{}
+	if config != nil {
+		cfg = *config
+	}
+	cal, err := LoadProductionCalendar(db, o.FactoryID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	// Parâmetros do produto vencem os do ativo; o preço da ordem vence todos.
+	costs, err := loadCostModel(db, o.FactoryID, cal.Location)
+	if err != nil {
+		return nil, err
+	}
+	costs.product, costs.priceOverride = o.Product, o.ValorVendaOk
+	if o.ValorVendaOk != nil {
+		cfg.ValorVendaOk = *o.ValorVendaOk
+	}
+	// Medidores de setor/fábrica só entram em ordens sem ativo definido.
+	energy, err := loadEnergyScope(db, o.FactoryID, o.SectorID, o.AssetID == nil)
+	if err != nil {
+		return nil, err
+	}
+	assets, err := loadFinancialAssets(db, assetIDs, assetSector)
+	if err != nil {
+		return nil, err
+	}
+	if err := attachQualityDefects(db, assets, start, end); err != nil {
+		return nil, err
+	}
+	if res.Financial, res.Assets, err = aggregateFinancials(db, &cfg, costs, assets, cal, energy, start, end); err != nil {
+		return nil, err
+	}
+	res.Financial.SectorID = o.SectorID
+
+	dq := DowntimeEventQuery{FactoryID: o.FactoryID, AssetID: o.AssetID, Start: start, End: end}
+	if o.AssetID == nil {
+		dq.SectorID = o.SectorID
+	}
+	pareto, err := ComputeDowntimePareto(db, dq, "reason")
+	if err != nil {
+		return nil, err
+	}
+	res.DowntimeEvents = pareto.TotalEvents
+	res.DowntimeDurationS = pareto.TotalDurationS
+	if len(pareto.Items) > 0 {
+		res.TopDowntimeReason = pareto.Items[0].Name
+	}
+	res.fillIndicators()
+	return res, nil
+}
+
+// fillIndicators deriva rendimento, progresso e margem de Financial.
+func (r *ProductionOrderResult) fillIndicators() {
+	f := r.Financial
+	if f == nil {
+		return
+	}
+	if total := f.OKCount + f.NOKCount; total > 0 {
+		r.Yield = f.OKCount / total
+	}
+	r.Margem = f.FaturamentoBruto - f.CustoMaterial - f.PerdaRefugo - f.CustoParada - f.CustoEnergia - f.CustoMaoObra
+	if f.OKCount > 0 {
+		r.MargemPorPeca = r.Margem / f.OKCount
+	}
+	if r.TargetQty != nil && *r.TargetQty > 0 {
+		p := f.OKCount / *r.TargetQty
+		r.Progress = &p
+	}
+}
+
+// ComputeProductProfitability calcula as ordens iniciadas que se sobrepõem ao
+// período (cada ordem inteira, não cortada) e soma por produto.
+func ComputeProductProfitability(db *sql.DB, q ProductionOrderQuery, now time.Time) ([]ProductProfitability, []ProductionOrderResult, error) {
+	q.Started = true
+	q.Limit = productionOrderMaxCompute + 1
+	orders, err := ListProductionOrders(db, q)
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(orders) > productionOrderMaxCompute {
+		return nil, nil, fmt.Errorf("mais de %d ordens no período: reduza o período ou filtre por setor/produto", productionOrderMaxCompute)
+	}
+	var results []ProductionOrderResult
+	for _, o := range orders {
+		r, err := ComputeProductionOrder(db, o, now)
+		if err != nil {
+			return nil, nil, fmt.Errorf("ordem %s: %w", o.OrderCode, err)
+		}
+		results = append(results, *r)
+	}
+	return summarizeProducts(results), results, nil
+}
+
+// summarizeProducts agrupa os resultados por produto, do mais para o menos rentável.
+func summarizeProducts(results []ProductionOrderResult) []ProductProfitability {
+	byProduct := map[string]*ProductProfitability{}
+	for _, r := range results {
+		if r.Financial == nil {
+			continue
+		}
+		name := r.Product
+		if name == "" {
+			name = "(sem produto)"
+		}
+		p := byProduct[name]
+		if p == nil {
+			p = &ProductProfitability{Product: name}
+			byProduct[name] = p
+		}
+		f := r.Financial
+		p.Orders++
+		p.OKCount += f.OKCount
+		p.NOKCount += f.NOKCount
+		p.HoursParada += f.HoursParada
+		p.EnergiaKWh += f.EnergiaKWh
+		p.DurationS += r.DurationS
+		p.FaturamentoBruto += f.FaturamentoBruto
+		p.PerdaRefugo += f.PerdaRefugo
+		p.CustoParada += f.CustoParada
+		p.CustoEnergia += f.CustoEnergia
+		p.CustoMaterial += f.CustoMaterial
+		p.CustoMaoObra += f.CustoMaoObra
+		p.MargemContribuicao += f.MargemContribuicao
+		p.CO2eKg += f.CO2eKg
+		p.Margem += r.Margem
+	}
+	out := make([]ProductProfitability, 0, len(byProduct))
+	for _, p := range byProduct {
+		if p.OKCount > 0 {
+			p.MargemPorPeca = p.Margem / p.OKCount
+			p.KWhPorPeca = p.EnergiaKWh / p.OKCount
+			p.CO2eKgPorPeca = p.CO2eKg / p.OKCount
+		}
+		if total := p.OKCount + p.NOKCount; total > 0 {
+			p.Yield = p.OKCount / total
+		}
+		if p.DurationS > 0 {
+			p.PecasPorHora = p.OKCount / (p.DurationS / 3600)
+		}
+		out = append(out, *p)
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Margem != out[j].Margem {
+			return out[i].Margem > out[j].Margem
+		}
+		return out[i].Product < out[j].Product
+	})
+	return out
+}
+
+// ─── Detector (tag_order) ───────────────────────────────────────────────────
+
+// orderCodeFromValue converte a leitura do tag_order no código da ordem ("" = nenhuma).
+func orderCodeFromValue(v float64) string {
+	if v <= 0 || math.IsNaN(v) || math.IsInf(v, 0) {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
+
+// DetectProductionOrders processa as leituras novas do tag_order de cada ativo
+// (factoryID nil = todas as fábricas).
+func DetectProductionOrders(ctx context.Context, db *sql.DB, factoryID *uuid.UUID) (started, ended int, err error) {
+	query := `
+		SELECT a.id, a.factory_id, a.group_id, t.tag_order
+		FROM nxd.tag_mapping t
+		JOIN nxd.assets a ON a.id = t.asset_id
+		WHERE t.tag_order IS NOT NULL AND t.tag_order <> ''`
+	args := []interface{}{}
+	if factoryID != nil {
+		query += ` AND a.factory_id = $1`
+		args = append(args, *factoryID)
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return 0, 0, err
+	}
+	type target struct {
+		assetID, factoryID uuid.UUID
+		sectorID           uuid.NullUUID
+		metricKey          string
+	}
+	var targets []target
+	for rows.Next() {
+		var t target
+		if err := rows.Scan(&t.assetID, &t.factoryID, &t.sectorID, &t.metricKey); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		targets = append(targets, t)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+	for _, t := range targets {
+		if ctx.Err() != nil {
+			return started, ended, ctx.Err()
+		}
+		var sectorID *uuid.UUID
+		if t.sectorID.Valid {
+			sectorID = &t.sectorID.UUID
+		}
+		s, e, err := detectAssetOrders(ctx, db, t.factoryID, t.assetID, sectorID, t.metricKey)
+		if err != nil {
+			return started, ended, fmt.Errorf("ativo %s: %w", t.assetID, err)
+		}
+		started += s
+		ended += e
+	}
+	return started, ended, nil
+}
+
+// detectAssetOrders processa um lote de leituras após o cursor do ativo, em uma transação.
+func detectAssetOrders(ctx context.Context, db *sql.DB, factoryID, assetID uuid.UUID, sectorID *uuid.UUID, metricKey string) (started, ended int, err error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer tx.Rollback()
+
+	var since time.Time
+	err = tx.QueryRowContext(ctx, `SELECT last_ts FROM nxd.production_order_cursor WHERE asset_id = $1`, assetID).Scan(&since)
+	if err == sql.ErrNoRows {
+		since = time.Now().Add(-productionOrderInitialLookback)
+		var last sql.NullTime
+		if err := tx.QueryRowContext(ctx, `
+			SELECT MAX(COALESCE(ended_at, started_at)) FROM nxd.production_orders
+			WHERE asset_id = $1 AND source = 'tag'`, assetID,
+		).Scan(&last); err != nil {
+			return 0, 0, err
+		}
+		if last.Valid && last.Time.After(since) {
+			since = last.Time
+		}
+	} else if err != nil {
+		return 0, 0, err
+	}
+
+	var openID uuid.UUID
+	var openCode string
+	var openStart time.Time
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, order_code, started_at FROM nxd.production_orders
+		WHERE asset_id = $1 AND started_at IS NOT NULL AND ended_at IS NULL
+		ORDER BY started_at DESC LIMIT 1
+	`, assetID).Scan(&openID, &openCode, &openStart)
+	if err != nil && err != sql.ErrNoRows {
+		return 0, 0, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `
+		SELECT ts, metric_value FROM nxd.telemetry_log
+		WHERE asset_id = $1 AND metric_key = $2 AND ts > $3 AND metric_value IS NOT NULL
+		ORDER BY ts ASC LIMIT $4
+	`, assetID, metricKey, since, productionOrderBatchSize)
+	if err != nil {
+		return 0, 0, err
+	}
+	type reading struct {
+		ts   time.Time
+		code string
+	}
+	var series []reading
+	for rows.Next() {
+		var p reading
+		var val float64
+		if err := rows.Scan(&p.ts, &val); err != nil {
+			rows.Close()
+			return 0, 0, err
+		}
+		p.code = orderCodeFromValue(val)
+		series = append(series, p)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, 0, err
+	}
+	if len(series) == 0 {
+		return 0, 0, nil
+	}
+
+	for _, p := range series {
+		if p.code == openCode || (openID != uuid.Nil && !p.ts.After(openStart)) {
+			continue
+		}
+		if openID != uuid.Nil {
+			if _, err = tx.ExecContext(ctx, `UPDATE nxd.production_orders SET ended_at = $1 WHERE id = $2`, p.ts, openID); err != nil {
+				return 0, 0, err
+			}
+			openID, openCode = uuid.Nil, ""
+			ended++
+		}
+		if p.code == "" {
+			continue
+		}
+		// Ordem planejada com o mesmo código (mais antiga) ganha o início; senão cria.
+		err = tx.QueryRowContext(ctx, `
+			UPDATE nxd.production_orders SET started_at = $1, asset_id = $2, sector_id = COALESCE(sector_id, $5)
+			WHERE id = (
+				SELECT id FROM nxd.production_orders
+				WHERE factory_id = $3 AND order_code = $4 AND started_at IS NULL AND (asset_id IS NULL OR asset_id = $2)
+				ORDER BY created_at LIMIT 1
+			)
+			RETURNING id
+		`, p.ts, assetID, factoryID, p.code, sectorID).Scan(&openID)
+		if err == sql.ErrNoRows {
+			err = tx.QueryRowContext(ctx, `
+				INSERT INTO nxd.production_orders (factory_id, sector_id, asset_id, order_code, started_at, source)
+				VALUES ($1, $2, $3, $4, $5, 'tag')
+				RETURNING id
+			`, factoryID, sectorID, assetID, p.code, p.ts).Scan(&openID)
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+		openCode, openStart = p.code, p.ts
+		started++
+	}
+	if _, err = tx.ExecContext(ctx, `
+		INSERT INTO nxd.production_order_cursor (asset_id, last_ts, updated_at) VALUES ($1, $2, NOW())
+		ON CONFLICT (asset_id) DO UPDATE SET last_ts = EXCLUDED.last_ts, updated_at = NOW()
+	`, assetID, series[len(series)-1].ts); err != nil {
+		return 0, 0, err
+	}
+	return started, ended, tx.Commit()
+}
+
+// RunProductionOrderWorker detecta trocas de ordem pelo tag_order a cada minuto.
+func RunProductionOrderWorker(ctx context.Context, db *sql.DB) {
+	log.Println("✓ [Orders] Detector de ordens de produção iniciado (intervalo: 1m)")
+	ticker := time.NewTicker(productionOrderWorkerInterval)
+	defer ticker.Stop()
+	for {
+		started, ended, err := DetectProductionOrders(ctx, db, nil)
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("⚠️  [Orders] %v", err)
+		} else if started+ended > 0 {
+			log.Printf("📦 [Orders] %d ordem(ns) iniciada(s), %d encerrada(s)", started, ended)
+		}
+		select {
+		case <-ctx.Done():
+			log.Println("⏹  [Orders] Shutdown signal received, worker stopping.")
+			return
+		case <-ticker.C:
+		}
+	}
+}
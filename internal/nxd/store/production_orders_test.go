@@ -0,0 +1,52 @@
+package store
+
+import "testing"
+
+func TestOrderCodeFromValue(t *testing.T) {
+	cases := map[float64]string{0: "", -3: "", 4512: "4512", 17.5: "17.5", 1e7: "10000000"}
+	for v, want := range cases {
+		if got := orderCodeFromValue(v); got != want {
+			t.Errorf("orderCodeFromValue(%v) = %q, want %q", v, got, want)
+		}
+	}
+}
+
+func TestSummarizeProducts(t *testing.T) {
+	target := 100.0
+	order := func(product string, ok, nok, kwh, durationS float64) ProductionOrderResult {
+		r := ProductionOrderResult{
+			ProductionOrderRow: ProductionOrderRow{Product: product, TargetQty: &target},
+			DurationS:          durationS,
+			Financial: &FinancialAggregateResult{
+				OKCount: ok, NOKCount: nok, EnergiaKWh: kwh,
+				FaturamentoBruto: ok * 10, PerdaRefugo: nok * 2, CustoEnergia: kwh * 0.5,
+			},
+		}
+		r.fillIndicators()
+		return r
+	}
+	a := order("Tampa", 90, 10, 20, 3600)
+	if a.Yield != 0.9 || a.Margem != 900-20-10 || a.Progress == nil || *a.Progress != 0.9 {
+		t.Fatalf("indicators = %+v", a)
+	}
+	got := summarizeProducts([]ProductionOrderResult{
+		a,
+		order("Tampa", 110, 0, 20, 3600),
+		order("Pote", 10, 40, 50, 7200),
+		order("", 0, 0, 0, 60),
+		{ProductionOrderRow: ProductionOrderRow{Product: "Planejada"}}, // sem Financial: ignorada
+	})
+	if len(got) != 3 {
+		t.Fatalf("products = %+v", got)
+	}
+	top := got[0]
+	if top.Product != "Tampa" || top.Orders != 2 || top.OKCount != 200 || top.PecasPorHora != 100 {
+		t.Errorf("top = %+v", top)
+	}
+	if top.Margem != 2000-20-20 || top.MargemPorPeca != top.Margem/200 || top.KWhPorPeca != 0.2 {
+		t.Errorf("top margem = %+v", top)
+	}
+	if got[1].Product != "(sem produto)" || got[2].Product != "Pote" || got[2].Margem >= 0 {
+		t.Errorf("order = %s, %s (%v)", got[1].Product, got[2].Product, got[2].Margem)
+	}
+}
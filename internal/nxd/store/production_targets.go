@@ -0,0 +1,839 @@
+package store
+
+// production_targets.go — Metas de produção e acompanhamento planejado × realizado
+//
+// Supervisores definem metas por ativo ou setor, por dia (meia-noite a meia-noite no
+// fuso da fábrica) ou por turno (cada ocorrência do turno; shift_id nil = todos os
+// turnos do escopo, e a meta de um turno específico vence a genérica). Métricas:
+//
+//   pieces      peças boas (tag_ok)            — maior é melhor
+//   oee         OEE em % (oee.go)              — maior é melhor
+//   scrap_rate  refugo em % de OK + NOK        — menor é melhor
+//
+// As metas têm vigência (valid_from/valid_to, dias locais): a versão mais recente
+// vigente no dia vale, então mudar a meta a partir de segunda não altera o histórico.
+// O realizado de cada janela (dia ou turno) vem de ComputeOEE do escopo até now.
+//
+// Ritmo: em peças, a projeção é realizado ÷ fração decorrida do tempo programado da
+// janela (calendar.go; sem tempo programado, o relógio) — "no ritmo atual, 870/1000".
+// Em OEE e refugo (taxas) a projeção é o valor atual. PacePct = projeção ÷ meta
+// (refugo: meta ÷ projeção); 100 = no ritmo da meta.
+//
+// Alertas: uma regra em nxd.alert_rules com condition_type "target_behind_pace",
+// scope_type "production_target" e scope_id = id da meta dispara quando PacePct fica
+// abaixo de threshold (padrão 100) depois de targetAlertMinElapsed da janela — no
+// máximo um alerta por regra e janela (RunTargetAlertWorker). alert_below_pct na
+// meta cria/atualiza/remove essa regra.
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	TargetPeriodDay   = "day"
+	TargetPeriodShift = "shift"
+
+	TargetMetricPieces    = "pieces"
+	TargetMetricOEE       = "oee"
+	TargetMetricScrapRate = "scrap_rate"
+
+	// TargetPaceCondition — condition_type das regras de alerta de ritmo (scope_type targetAlertScope).
+	TargetPaceCondition = "target_behind_pace"
+	targetAlertScope    = "production_target"
+)
+
+// targetAlertMinElapsed — fração mínima da janela antes de alertar (início de turno é ruidoso).
+const targetAlertMinElapsed = 0.1
+
+// targetWorkerInterval — intervalo da avaliação das regras de ritmo.
+const targetWorkerInterval = 5 * time.Minute
+
+// TargetProgressMaxDays limita o intervalo do planejado × realizado.
+const TargetProgressMaxDays = 31
+
+var (
+	// ErrInvalidTarget — escopo, período, métrica, valor ou vigência inválidos.
+	ErrInvalidTarget = errors.New("meta de produção inválida")
+	// ErrTargetConflict — já existe meta do mesmo escopo, período, turno e métrica com esta vigência.
+	ErrTargetConflict = errors.New("já existe uma meta deste escopo com esta vigência")
+)
+
+// ProductionTargetRow — meta de um ativo ou setor (exatamente um) a partir de ValidFrom
+// (YYYY-MM-DD) até ValidTo (inclusive; "" = sem fim). ShiftID só com Period "shift".
+type ProductionTargetRow struct {
+	ID            uuid.UUID  `json:"id"`
+	FactoryID     uuid.UUID  `json:"factory_id"`
+	SectorID      *uuid.UUID `json:"sector_id,omitempty"`
+	AssetID       *uuid.UUID `json:"asset_id,omitempty"`
+	Period        string     `json:"period"` // day | shift
+	ShiftID       *uuid.UUID `json:"shift_id,omitempty"`
+	Metric        string     `json:"metric"` // pieces | oee | scrap_rate
+	Target        float64    `json:"target"`
+	ValidFrom     string     `json:"valid_from"`
+	ValidTo       string     `json:"valid_to,omitempty"`
+	Notes         string     `json:"notes,omitempty"`
+	AlertBelowPct *float64   `json:"alert_below_pct"` // regra de ritmo (nil = sem alerta)
+	CreatedAt     time.Time  `json:"created_at"`
+	UpdatedAt     time.Time  `json:"updated_at"`
+}
+
+// ─── Cadastro ───────────────────────────────────────────────────────────────
+
+const productionTargetColumns = `t.id, t.factory_id, t.sector_id, t.asset_id, t.period, t.shift_id, t.metric, t.target,
+	t.valid_from, t.valid_to, COALESCE(t.notes, ''), t.created_at, t.updated_at,
+	(SELECT r.threshold FROM nxd.alert_rules r
+	 WHERE r.scope_id = t.id AND r.scope_type = 'production_target' AND r.condition_type = 'target_behind_pace'
+	 ORDER BY r.created_at LIMIT 1)`
+
+func scanProductionTarget(sc interface{ Scan(...interface{}) error }) (ProductionTargetRow, error) {
+	var t ProductionTargetRow
+	var sectorID, assetID, shiftID uuid.NullUUID
+	var from time.Time
+	var to sql.NullTime
+	var alert sql.NullFloat64
+	err := sc.Scan(&t.ID, &t.FactoryID, &sectorID, &assetID, &t.Period, &shiftID, &t.Metric, &t.Target,
+		&from, &to, &t.Notes, &t.CreatedAt, &t.UpdatedAt, &alert)
+	if err != nil {
+		return t, err
+	}
+	if sectorID.Valid {
+		t.SectorID = &sectorID.UUID
+	}
+	if assetID.Valid {
+		t.AssetID = &assetID.UUID
+	}
+	if shiftID.Valid {
+		t.ShiftID = &shiftID.UUID
+	}
+	t.ValidFrom = from.Format("2006-01-02")
+	if to.Valid {
+		t.ValidTo = to.Time.Format("2006-01-02")
+	}
+	if alert.Valid {
+		t.AlertBelowPct = &alert.Float64
+	}
+	return t, nil
+}
+
+// ListProductionTargets retorna as metas da fábrica (escopo, métrica, vigência).
+func ListProductionTargets(db *sql.DB, factoryID uuid.UUID) ([]ProductionTargetRow, error) {
+	rows, err := db.Query(`SELECT `+productionTargetColumns+` FROM nxd.production_targets t WHERE t.factory_id = $1
+		ORDER BY t.sector_id NULLS FIRST, t.asset_id NULLS FIRST, t.metric, t.period, t.shift_id NULLS FIRST, t.valid_from`, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []ProductionTargetRow
+	for rows.Next() {
+		t, err := scanProductionTarget(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, t)
+	}
+	return list, rows.Err()
+}
+
+// validateTargetValues valida métrica, valor, vigência e alerta (campos editáveis).
+func validateTargetValues(t *ProductionTargetRow) error {
+	switch t.Metric {
+	case TargetMetricPieces:
+		if t.Target <= 0 {
+			return fmt.Errorf("%w: meta de peças deve ser positiva", ErrInvalidTarget)
+		}
+	case TargetMetricOEE, TargetMetricScrapRate:
+		if t.Target < 0 || t.Target > 100 {
+			return fmt.Errorf("%w: meta de %s em %% (0 a 100)", ErrInvalidTarget, t.Metric)
+		}
+	default:
+		return fmt.Errorf("%w: metric %q (use pieces, oee ou scrap_rate)", ErrInvalidTarget, t.Metric)
+	}
+	from, err := time.Parse("2006-01-02", t.ValidFrom)
+	if err != nil {
+		return fmt.Errorf("%w: valid_from %q (use YYYY-MM-DD)", ErrInvalidTarget, t.ValidFrom)
+	}
+	if t.ValidTo != "" {
+		to, err := time.Parse("2006-01-02", t.ValidTo)
+		if err != nil {
+			return fmt.Errorf("%w: valid_to %q (use YYYY-MM-DD)", ErrInvalidTarget, t.ValidTo)
+		}
+		if to.Before(from) {
+			return fmt.Errorf("%w: valid_to anterior a valid_from", ErrInvalidTarget)
+		}
+	}
+	if t.AlertBelowPct != nil && (*t.AlertBelowPct <= 0 || *t.AlertBelowPct > 100) {
+		return fmt.Errorf("%w: alert_below_pct deve estar entre 0 e 100", ErrInvalidTarget)
+	}
+	t.Notes = strings.TrimSpace(t.Notes)
+	return nil
+}
+
+// validateProductionTarget valida a meta inteira; ativo, setor e turno devem pertencer à fábrica.
+func validateProductionTarget(db *sql.DB, t *ProductionTargetRow) error {
+	if (t.SectorID == nil) == (t.AssetID == nil) {
+		return fmt.Errorf("%w: informe sector_id ou asset_id (um dos dois)", ErrInvalidTarget)
+	}
+	switch t.Period {
+	case TargetPeriodDay:
+		if t.ShiftID != nil {
+			return fmt.Errorf("%w: shift_id só vale com period \"shift\"", ErrInvalidTarget)
+		}
+	case TargetPeriodShift:
+	default:
+		return fmt.Errorf("%w: period %q (use day ou shift)", ErrInvalidTarget, t.Period)
+	}
+	if err := validateTargetValues(t); err != nil {
+		return err
+	}
+	if t.AssetID != nil {
+		if a, err := GetAssetByID(db, *t.AssetID, t.FactoryID); err != nil {
+			return err
+		} else if a == nil {
+			return fmt.Errorf("%w: ativo não encontrado", ErrInvalidTarget)
+		}
+	}
+	if t.SectorID != nil {
+		if s, err := GetSectorByID(db, *t.SectorID, t.FactoryID); err != nil {
+			return err
+		} else if s == nil {
+			return fmt.Errorf("%w: setor não encontrado", ErrInvalidTarget)
+		}
+	}
+	if t.ShiftID != nil {
+		var ok bool
+		if err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM nxd.shifts WHERE id = $1 AND factory_id = $2)`,
+			*t.ShiftID, t.FactoryID).Scan(&ok); err != nil {
+			return err
+		}
+		if !ok {
+			return fmt.Errorf("%w: turno não encontrado", ErrInvalidTarget)
+		}
+	}
+	return nil
+}
+
+// CreateProductionTarget insere uma meta (mesmo escopo, período, turno, métrica e
+// valid_from → ErrTargetConflict) e, com AlertBelowPct, a regra de ritmo.
+func CreateProductionTarget(db *sql.DB, t ProductionTargetRow) (uuid.UUID, error) {
+	if err := validateProductionTarget(db, &t); err != nil {
+		return uuid.Nil, err
+	}
+	tx, err := db.Begin()
+	if err != nil {
+		return uuid.Nil, err
+	}
+	defer tx.Rollback()
+	var id uuid.UUID
+	err = tx.QueryRow(`
+		INSERT INTO nxd.production_targets (factory_id, sector_id, asset_id, period, shift_id, metric, target,
+			valid_from, valid_to, notes)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, '')::date, NULLIF($10, ''))
+		ON CONFLICT DO NOTHING
+		RETURNING id
+	`, t.FactoryID, t.SectorID, t.AssetID, t.Period, t.ShiftID, t.Metric, t.Target, t.ValidFrom, t.ValidTo, t.Notes).Scan(&id)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, ErrTargetConflict
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	if err := setTargetAlert(tx, t.FactoryID, id, t.AssetID, t.SectorID, t.AlertBelowPct); err != nil {
+		return uuid.Nil, err
+	}
+	return id, tx.Commit()
+}
+
+// UpdateProductionTarget substitui valor, vigência, notas e alerta (escopo, período,
+// turno e métrica não mudam). false = não existe na fábrica.
+func UpdateProductionTarget(db *sql.DB, t ProductionTargetRow) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	var assetID, sectorID uuid.NullUUID
+	err = tx.QueryRow(`SELECT metric, asset_id, sector_id FROM nxd.production_targets WHERE id = $1 AND factory_id = $2 FOR UPDATE`,
+		t.ID, t.FactoryID).Scan(&t.Metric, &assetID, &sectorID)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if err := validateTargetValues(&t); err != nil {
+		return false, err
+	}
+	var taken bool
+	if err := tx.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM nxd.production_targets o JOIN nxd.production_targets c ON c.id = $1
+			WHERE o.factory_id = c.factory_id AND o.id <> c.id AND o.valid_from = $2
+			  AND o.sector_id IS NOT DISTINCT FROM c.sector_id AND o.asset_id IS NOT DISTINCT FROM c.asset_id
+			  AND o.period = c.period AND o.shift_id IS NOT DISTINCT FROM c.shift_id AND o.metric = c.metric)
+	`, t.ID, t.ValidFrom).Scan(&taken); err != nil {
+		return false, err
+	}
+	if taken {
+		return false, ErrTargetConflict
+	}
+	if _, err := tx.Exec(`
+		UPDATE nxd.production_targets SET target = $1, valid_from = $2, valid_to = NULLIF($3, '')::date,
+			notes = NULLIF($4, ''), updated_at = NOW()
+		WHERE id = $5 AND factory_id = $6
+	`, t.Target, t.ValidFrom, t.ValidTo, t.Notes, t.ID, t.FactoryID); err != nil {
+		return false, err
+	}
+	if err := setTargetAlert(tx, t.FactoryID, t.ID, nullUUIDPtr(assetID), nullUUIDPtr(sectorID), t.AlertBelowPct); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// DeleteProductionTarget remove a meta e suas regras de ritmo (com os alertas disparados).
+// false = não existe.
+func DeleteProductionTarget(db *sql.DB, factoryID, id uuid.UUID) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+	res, err := tx.Exec(`DELETE FROM nxd.production_targets WHERE id = $1 AND factory_id = $2`, id, factoryID)
+	if err != nil {
+		return false, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return false, nil
+	}
+	if err := setTargetAlert(tx, factoryID, id, nil, nil, nil); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// setTargetAlert grava a regra de ritmo da meta: atualiza o limiar se já existe (o
+// histórico de alertas fica), cria se não existe; nil remove.
+func setTargetAlert(tx *sql.Tx, factoryID, targetID uuid.UUID, assetID, sectorID *uuid.UUID, belowPct *float64) error {
+	if belowPct == nil {
+		_, err := tx.Exec(`DELETE FROM nxd.alert_rules WHERE factory_id = $1 AND scope_type = $2 AND scope_id = $3 AND condition_type = $4`,
+			factoryID, targetAlertScope, targetID, TargetPaceCondition)
+		return err
+	}
+	res, err := tx.Exec(`UPDATE nxd.alert_rules SET threshold = $1 WHERE factory_id = $2 AND scope_type = $3 AND scope_id = $4 AND condition_type = $5`,
+		*belowPct, factoryID, targetAlertScope, targetID, TargetPaceCondition)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n > 0 {
+		return nil
+	}
+	_, err = tx.Exec(`INSERT INTO nxd.alert_rules (factory_id, scope_type, scope_id, condition_type, threshold) VALUES ($1, $2, $3, $4, $5)`,
+		factoryID, targetAlertScope, targetID, TargetPaceCondition, *belowPct)
+	return err
+}
+
+func nullUUIDPtr(n uuid.NullUUID) *uuid.UUID {
+	if !n.Valid {
+		return nil
+	}
+	return &n.UUID
+}
+
+// ─── Planejado × realizado ──────────────────────────────────────────────────
+
+// TargetProgressRow — uma janela (dia ou ocorrência de turno) de uma meta.
+// SectorID é o setor da meta ou o setor do ativo.
+type TargetProgressRow struct {
+	TargetID      uuid.UUID  `json:"target_id"`
+	Metric        string     `json:"metric"`
+	Period        string     `json:"period"`
+	ScopeType     string     `json:"scope_type"` // asset | sector
+	AssetID       *uuid.UUID `json:"asset_id,omitempty"`
+	SectorID      *uuid.UUID `json:"sector_id,omitempty"`
+	ScopeName     string     `json:"scope_name"`
+	ShiftID       *uuid.UUID `json:"shift_id,omitempty"`
+	ShiftName     string     `json:"shift_name,omitempty"`
+	Day           string     `json:"day"`
+	Start         time.Time  `json:"start"`
+	End           time.Time  `json:"end"`
+	Target        float64    `json:"target"`
+	Actual        *float64   `json:"actual"`             // nil = sem dados (OEE/refugo)
+	AttainmentPct *float64   `json:"attainment_pct"`     // realizado ÷ meta (refugo: meta ÷ realizado)
+	ElapsedPct    float64    `json:"elapsed_pct"`        // fração decorrida do tempo programado
+	Expected      *float64   `json:"expected,omitempty"` // peças esperadas até agora no ritmo da meta
+	Projected     *float64   `json:"projected"`
+	PacePct       *float64   `json:"pace_pct"`
+	Status        string     `json:"status"` // on_track | behind (em andamento), achieved | missed (encerrada), no_data
+	Message       string     `json:"message"`
+	AlertBelowPct *float64   `json:"alert_below_pct,omitempty"`
+}
+
+// targetWindow — ocorrência de uma meta num dia.
+type targetWindow struct {
+	target     ProductionTargetRow
+	sectorID   *uuid.UUID
+	start, end time.Time
+	shiftID    *uuid.UUID
+	shiftName  string
+}
+
+// effectiveTargets retorna, por escopo/período/turno/métrica, a versão vigente no dia.
+func effectiveTargets(targets []ProductionTargetRow, day string) []ProductionTargetRow {
+	type key struct {
+		sector, asset, shift uuid.UUID
+		period, metric       string
+	}
+	idOf := func(p *uuid.UUID) uuid.UUID {
+		if p == nil {
+			return uuid.Nil
+		}
+		return *p
+	}
+	best := map[key]int{}
+	var keys []key
+	for i, t := range targets {
+		if t.ValidFrom > day || (t.ValidTo != "" && t.ValidTo < day) {
+			continue
+		}
+		k := key{idOf(t.SectorID), idOf(t.AssetID), idOf(t.ShiftID), t.Period, t.Metric}
+		j, ok := best[k]
+		if !ok {
+			keys = append(keys, k)
+		}
+		if !ok || t.ValidFrom > targets[j].ValidFrom {
+			best[k] = i
+		}
+	}
+	out := make([]ProductionTargetRow, 0, len(keys))
+	for _, k := range keys {
+		out = append(out, targets[best[k]])
+	}
+	return out
+}
+
+// targetWindows monta as janelas das metas vigentes no dia local dayStart: uma por meta
+// diária e uma por ocorrência de turno que começa no dia (turno específico vence o genérico).
+func targetWindows(targets []ProductionTargetRow, cal *ProductionCalendar, assetSector map[uuid.UUID]*uuid.UUID, dayStart time.Time) []targetWindow {
+	day := dayStart.Format("2006-01-02")
+	dayEnd := dayStart.AddDate(0, 0, 1)
+	var out []targetWindow
+	type group struct {
+		scope, metric string
+	}
+	shiftTargets := map[group][]ProductionTargetRow{}
+	var groups []group
+	for _, t := range effectiveTargets(targets, day) {
+		sectorID := t.SectorID
+		if t.AssetID != nil {
+			sectorID = assetSector[*t.AssetID]
+		}
+		if t.Period == TargetPeriodDay {
+			out = append(out, targetWindow{target: t, sectorID: sectorID, start: dayStart, end: dayEnd})
+			continue
+		}
+		g := group{targetScopeKey(t), t.Metric}
+		if _, ok := shiftTargets[g]; !ok {
+			groups = append(groups, g)
+		}
+		shiftTargets[g] = append(shiftTargets[g], t)
+	}
+	for _, g := range groups {
+		list := shiftTargets[g]
+		sectorID := list[0].SectorID
+		if list[0].AssetID != nil {
+			sectorID = assetSector[*list[0].AssetID]
+		}
+		for _, in := range cal.ShiftInstances(sectorID, dayStart, dayEnd) {
+			var chosen *ProductionTargetRow
+			for i := range list {
+				t := &list[i]
+				if t.ShiftID != nil && *t.ShiftID == in.ShiftID {
+					chosen = t
+					break
+				}
+				if t.ShiftID == nil && chosen == nil {
+					chosen = t
+				}
+			}
+			if chosen == nil {
+				continue
+			}
+			shiftID := in.ShiftID
+			out = append(out, targetWindow{target: *chosen, sectorID: sectorID, start: in.Start, end: in.End,
+				shiftID: &shiftID, shiftName: in.Name})
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].start.Before(out[j].start) })
+	return out
+}
+
+func targetScopeKey(t ProductionTargetRow) string {
+	if t.AssetID != nil {
+		return "asset:" + t.AssetID.String()
+	}
+	return "sector:" + t.SectorID.String()
+}
+
+// targetRatioPct compara valor e meta em %: maior é melhor, exceto refugo (meta ÷ valor).
+// nil = sem base (meta 0 em peças/OEE).
+func targetRatioPct(metric string, v, target float64) *float64 {
+	var p float64
+	if metric == TargetMetricScrapRate {
+		if v <= target {
+			p = 100
+			if v > 0 {
+				p = target / v * 100
+			}
+		} else {
+			p = target / v * 100
+		}
+	} else {
+		if target <= 0 {
+			return nil
+		}
+		p = v / target * 100
+	}
+	return &p
+}
+
+// evaluate preenche projeção, ritmo, status e mensagem a partir de Actual, da fração
+// decorrida do tempo programado (0..1) e de a janela já ter terminado.
+func (r *TargetProgressRow) evaluate(elapsed float64, finished bool) {
+	r.ElapsedPct = elapsed * 100
+	if r.Actual == nil {
+		r.Status, r.Message = "no_data", "sem dados no período"
+		return
+	}
+	actual := *r.Actual
+	proj := actual
+	if r.Metric == TargetMetricPieces {
+		exp := r.Target * elapsed
+		if finished {
+			exp = r.Target
+		}
+		r.Expected = &exp
+		if !finished && elapsed > 0 {
+			proj = actual / elapsed
+		}
+	}
+	r.Projected = &proj
+	r.AttainmentPct = targetRatioPct(r.Metric, actual, r.Target)
+	r.PacePct = targetRatioPct(r.Metric, proj, r.Target)
+	ok := proj >= r.Target
+	if r.Metric == TargetMetricScrapRate {
+		ok = proj <= r.Target
+	}
+	switch {
+	case finished && ok:
+		r.Status = "achieved"
+	case finished:
+		r.Status = "missed"
+	case ok:
+		r.Status = "on_track"
+	default:
+		r.Status = "behind"
+	}
+	pct := ""
+	if r.PacePct != nil {
+		pct = fmt.Sprintf(" (%.0f%%)", *r.PacePct)
+	}
+	switch r.Metric {
+	case TargetMetricPieces:
+		if finished {
+			r.Message = fmt.Sprintf("realizado: %.0f/%.0f peças%s", actual, r.Target, pct)
+		} else {
+			r.Message = fmt.Sprintf("no ritmo atual: %.0f/%.0f peças%s", math.Floor(proj), r.Target, pct)
+		}
+	case TargetMetricOEE:
+		r.Message = fmt.Sprintf("OEE %.1f%% (meta %.1f%%)", actual, r.Target)
+	case TargetMetricScrapRate:
+		r.Message = fmt.Sprintf("refugo %.1f%% (meta até %.1f%%)", actual, r.Target)
+	}
+}
+
+// targetScope carrega metas, calendário, fuso e nomes/setores de ativos e setores da fábrica.
+type targetScope struct {
+	loc         *time.Location
+	targets     []ProductionTargetRow
+	cal         *ProductionCalendar
+	assetSector map[uuid.UUID]*uuid.UUID
+	names       map[uuid.UUID]string
+}
+
+func loadTargetScope(db *sql.DB, factoryID uuid.UUID, from, to time.Time) (*targetScope, error) {
+	sc := &targetScope{assetSector: map[uuid.UUID]*uuid.UUID{}, names: map[uuid.UUID]string{}}
+	var err error
+	if sc.targets, err = ListProductionTargets(db, factoryID); err != nil {
+		return nil, err
+	}
+	if sc.cal, err = LoadProductionCalendar(db, factoryID, from, to); err != nil {
+		return nil, err
+	}
+	sc.loc = sc.cal.Location
+	rows, err := db.Query(`SELECT id, COALESCE(display_name, source_tag_id, ''), group_id FROM nxd.assets WHERE factory_id = $1`, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id uuid.UUID
+		var name string
+		var group uuid.NullUUID
+		if err := rows.Scan(&id, &name, &group); err != nil {
+			return nil, err
+		}
+		sc.names[id] = name
+		sc.assetSector[id] = nullUUIDPtr(group)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sectors, err := db.Query(`SELECT id, name FROM nxd.sectors WHERE factory_id = $1`, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer sectors.Close()
+	for sectors.Next() {
+		var id uuid.UUID
+		var name string
+		if err := sectors.Scan(&id, &name); err != nil {
+			return nil, err
+		}
+		sc.names[id] = name
+	}
+	return sc, sectors.Err()
+}
+
+// ComputeTargetProgress calcula planejado × realizado das metas nos dias locais
+// [fromDay, toDay] (YYYY-MM-DD; "" = hoje). Janelas futuras ficam de fora; as em
+// andamento vão até now, com projeção no ritmo atual.
+func ComputeTargetProgress(db *sql.DB, factoryID uuid.UUID, fromDay, toDay string, now time.Time) ([]TargetProgressRow, error) {
+	loc, err := GetFactoryTimezone(db, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	today := now.In(loc).Format("2006-01-02")
+	if fromDay == "" {
+		fromDay = today
+	}
+	if toDay == "" {
+		toDay = today
+	}
+	from, err := time.ParseInLocation("2006-01-02", fromDay, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: from %q (use YYYY-MM-DD)", ErrInvalidTarget, fromDay)
+	}
+	to, err := time.ParseInLocation("2006-01-02", toDay, loc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: to %q (use YYYY-MM-DD)", ErrInvalidTarget, toDay)
+	}
+	if to.Before(from) || to.Sub(from) > TargetProgressMaxDays*24*time.Hour {
+		return nil, fmt.Errorf("%w: intervalo de 1 a %d dias", ErrInvalidTarget, TargetProgressMaxDays)
+	}
+	// Turnos que começam no último dia podem terminar no seguinte.
+	sc, err := loadTargetScope(db, factoryID, from, to.AddDate(0, 0, 2))
+	if err != nil {
+		return nil, err
+	}
+	out := []TargetProgressRow{}
+	for d := from; !d.After(to); d = d.AddDate(0, 0, 1) {
+		for _, w := range targetWindows(sc.targets, sc.cal, sc.assetSector, d) {
+			if !now.After(w.start) {
+				continue
+			}
+			row, err := sc.measure(db, factoryID, w, now)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, row)
+		}
+	}
+	return out, nil
+}
+
+// ComputeTargetPace retorna as janelas em andamento (dia ou turno) com a projeção no ritmo atual.
+func ComputeTargetPace(db *sql.DB, factoryID uuid.UUID, now time.Time) ([]TargetProgressRow, error) {
+	loc, err := GetFactoryTimezone(db, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	local := now.In(loc)
+	rows, err := ComputeTargetProgress(db, factoryID, local.AddDate(0, 0, -1).Format("2006-01-02"), local.Format("2006-01-02"), now)
+	if err != nil {
+		return nil, err
+	}
+	out := []TargetProgressRow{}
+	for _, r := range rows {
+		if r.End.After(now) {
+			out = append(out, r)
+		}
+	}
+	return out, nil
+}
+
+// measure lê o realizado da janela (ComputeOEE do escopo até now) e avalia o ritmo.
+func (sc *targetScope) measure(db *sql.DB, factoryID uuid.UUID, w targetWindow, now time.Time) (TargetProgressRow, error) {
+	t := w.target
+	row := TargetProgressRow{TargetID: t.ID, Metric: t.Metric, Period: t.Period, ScopeType: "sector", AssetID: t.AssetID,
+		SectorID: w.sectorID, ShiftID: w.shiftID, ShiftName: w.shiftName, Day: w.start.In(sc.loc).Format("2006-01-02"),
+		Start: w.start, End: w.end, Target: t.Target, AlertBelowPct: t.AlertBelowPct}
+	q := OEEQuery{FactoryID: factoryID, Start: w.start, End: w.end}
+	if t.AssetID != nil {
+		row.ScopeType, row.ScopeName = "asset", sc.names[*t.AssetID]
+		q.AssetID = t.AssetID
+	} else {
+		row.ScopeName = sc.names[*t.SectorID]
+		q.SectorID = t.SectorID
+	}
+	finished := !w.end.After(now)
+	if !finished {
+		q.End = now
+	}
+	rep, err := ComputeOEE(db, q)
+	if err != nil {
+		return row, err
+	}
+	total := rep.Total
+	switch t.Metric {
+	case TargetMetricPieces:
+		v := total.OKCount
+		row.Actual = &v
+	case TargetMetricOEE:
+		if total.OEE != nil {
+			v := *total.OEE * 100
+			row.Actual = &v
+		}
+	case TargetMetricScrapRate:
+		if total.OKCount+total.NOKCount > 0 {
+			v := total.NOKCount / (total.OKCount + total.NOKCount) * 100
+			row.Actual = &v
+		}
+	}
+	elapsed := 1.0
+	if !finished {
+		elapsed = windowElapsed(sc.cal, w.sectorID, w.start, w.end, now)
+	}
+	row.evaluate(elapsed, finished)
+	return row, nil
+}
+
+// windowElapsed retorna a fração decorrida do tempo programado de [start, end) até now;
+// sem tempo programado na janela, a fração do relógio.
+func windowElapsed(cal *ProductionCalendar, sectorID *uuid.UUID, start, end, now time.Time) float64 {
+	if total := cal.scheduledHours(sectorID, start, end); total > 0 {
+		return cal.scheduledHours(sectorID, start, now) / total
+	}
+	return now.Sub(start).Seconds() / end.Sub(start).Seconds()
+}
+
+// ─── Alertas de ritmo ───────────────────────────────────────────────────────
+
+// targetBehindPace indica se a janela em andamento deve disparar a regra (threshold em %; <= 0 = 100).
+func targetBehindPace(r TargetProgressRow, threshold float64) bool {
+	if threshold <= 0 {
+		threshold = 100
+	}
+	if r.Status != "on_track" && r.Status != "behind" {
+		return false
+	}
+	return r.ElapsedPct >= targetAlertMinElapsed*100 && r.PacePct != nil && *r.PacePct < threshold
+}
+
+// EvaluateTargetAlerts avalia as regras "target_behind_pace" de todas as fábricas e
+// grava um alerta por regra e janela em atraso. Retorna quantos alertas foram criados.
+func EvaluateTargetAlerts(ctx context.Context, db *sql.DB, now time.Time) (int, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, factory_id, scope_id, COALESCE(threshold, 0) FROM nxd.alert_rules
+		WHERE condition_type = $1 AND scope_type = $2 AND scope_id IS NOT NULL
+		ORDER BY factory_id, created_at
+	`, TargetPaceCondition, targetAlertScope)
+	if err != nil {
+		return 0, err
+	}
+	type rule struct {
+		id        uuid.UUID
+		threshold float64
+	}
+	byFactory := map[uuid.UUID]map[uuid.UUID][]rule{}
+	var factories []uuid.UUID
+	for rows.Next() {
+		var r rule
+		var factoryID, targetID uuid.UUID
+		if err := rows.Scan(&r.id, &factoryID, &targetID, &r.threshold); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		if byFactory[factoryID] == nil {
+			byFactory[factoryID] = map[uuid.UUID][]rule{}
+			factories = append(factories, factoryID)
+		}
+		byFactory[factoryID][targetID] = append(byFactory[factoryID][targetID], r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+	fired := 0
+	for _, factoryID := range factories {
+		if err := ctx.Err(); err != nil {
+			return fired, err
+		}
+		pace, err := ComputeTargetPace(db, factoryID, now)
+		if err != nil {
+			log.Printf("⚠️  [Targets] fábrica %s: %v", factoryID, err)
+			continue
+		}
+		for _, p := range pace {
+			for _, r := range byFactory[factoryID][p.TargetID] {
+				if !targetBehindPace(p, r.threshold) {
+					continue
+				}
+				name := p.ScopeName
+				if p.ShiftName != "" {
+					name += " (" + p.ShiftName + ")"
+				}
+				res, err := db.ExecContext(ctx, `
+					INSERT INTO nxd.alerts (rule_id, asset_id, group_id, severity, message)
+					SELECT $1, $2, $3, 'warning', $4
+					WHERE NOT EXISTS (SELECT 1 FROM nxd.alerts WHERE rule_id = $1 AND ts >= $5)
+				`, r.id, p.AssetID, p.SectorID, fmt.Sprintf("Meta atrasada — %s: %s", name, p.Message), p.Start)
+				if err != nil {
+					return fired, err
+				}
+				if n, _ := res.RowsAffected(); n > 0 {
+					fired++
+				}
+			}
+		}
+	}
+	return fired, nil
+}
+
+// RunTargetAlertWorker avalia as regras de ritmo das metas a cada 5 minutos.
+func RunTargetAlertWorker(ctx context.Context, db *sql.DB) {
+	log.Println("✓ [Targets] Alertas de ritmo das metas iniciados (intervalo: 5m)")
+	ticker := time.NewTicker(targetWorkerInterval)
+	defer ticker.Stop()
+	for {
+		fired, err := EvaluateTargetAlerts(ctx, db, time.Now())
+		if err != nil && !errors.Is(err, context.Canceled) {
+			log.Printf("⚠️  [Targets] %v", err)
+		} else if fired > 0 {
+			log.Printf("🎯 [Targets] %d alerta(s) de meta atrasada", fired)
+		}
+		select {
+		case <-ctx.Done():
+			log.Println("⏹  [Targets] Shutdown signal received, worker stopping.")
+			return
+		case <-ticker.C:
+		}
+	}
+}
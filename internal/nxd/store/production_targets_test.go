@@ -0,0 +1,121 @@
+package store
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestTargetWindows cobre vigência (versão mais recente vence, valid_to respeitado),
+// meta diária e precedência do turno específico sobre a meta de todos os turnos.
+func TestTargetWindows(t *testing.T) {
+	loc := time.FixedZone("BRT", -3*3600)
+	day := func(d, h int) time.Time { return time.Date(2024, 3, d, h, 0, 0, 0, loc) } // 2024-03-01 = sexta
+	shiftA, shiftC := uuid.New(), uuid.New()
+	cal := &ProductionCalendar{Location: loc, shifts: []ShiftRow{
+		{ID: shiftA, Name: "A", StartTime: "06:00", EndTime: "14:00", Weekdays: []int{1, 2, 3, 4, 5}},
+		{ID: shiftC, Name: "C", StartTime: "22:00", EndTime: "06:00", Weekdays: []int{1, 2, 3, 4, 5}},
+	}}
+	sector, asset := uuid.New(), uuid.New()
+	assetSector := map[uuid.UUID]*uuid.UUID{asset: &sector}
+	ids := make([]uuid.UUID, 5)
+	for i := range ids {
+		ids[i] = uuid.New()
+	}
+	targets := []ProductionTargetRow{
+		{ID: ids[0], SectorID: &sector, Period: TargetPeriodDay, Metric: TargetMetricPieces, Target: 1000, ValidFrom: "2024-01-01"},
+		{ID: ids[1], SectorID: &sector, Period: TargetPeriodDay, Metric: TargetMetricPieces, Target: 1200, ValidFrom: "2024-03-01"},
+		{ID: ids[2], AssetID: &asset, Period: TargetPeriodShift, Metric: TargetMetricPieces, Target: 400, ValidFrom: "2024-01-01"},
+		{ID: ids[3], AssetID: &asset, Period: TargetPeriodShift, ShiftID: &shiftC, Metric: TargetMetricPieces, Target: 300, ValidFrom: "2024-01-01"},
+		{ID: ids[4], SectorID: &sector, Period: TargetPeriodDay, Metric: TargetMetricOEE, Target: 75, ValidFrom: "2024-01-01", ValidTo: "2024-02-29"},
+	}
+
+	got := targetWindows(targets, cal, assetSector, day(1, 0))
+	if len(got) != 3 {
+		t.Fatalf("windows = %+v", got)
+	}
+	// Ordenadas pelo início: dia (00:00), turno A (06:00), turno C (22:00).
+	if got[0].target.ID != ids[1] || !got[0].start.Equal(day(1, 0)) || !got[0].end.Equal(day(2, 0)) {
+		t.Errorf("dia = %+v", got[0])
+	}
+	if got[1].target.ID != ids[2] || got[1].shiftName != "A" || !got[1].end.Equal(day(1, 14)) || *got[1].sectorID != sector {
+		t.Errorf("turno A = %+v", got[1])
+	}
+	if got[2].target.ID != ids[3] || *got[2].shiftID != shiftC || !got[2].end.Equal(day(2, 6)) {
+		t.Errorf("turno C = %+v", got[2])
+	}
+
+	// Fevereiro: versão antiga da meta diária e OEE ainda vigente.
+	got = targetWindows(targets, cal, assetSector, day(1, 0).AddDate(0, 0, -2))
+	var pieces, oee int
+	for _, w := range got {
+		switch w.target.ID {
+		case ids[0]:
+			pieces++
+		case ids[4]:
+			oee++
+		case ids[1]:
+			t.Errorf("versão de março vigente em fevereiro")
+		}
+	}
+	if pieces != 1 || oee != 1 {
+		t.Errorf("fevereiro = %+v", got)
+	}
+
+	// Sábado: sem turnos, só a meta diária.
+	if got = targetWindows(targets, cal, assetSector, day(2, 0)); len(got) != 1 || got[0].target.ID != ids[1] {
+		t.Errorf("sábado = %+v", got)
+	}
+}
+
+func TestTargetProgressEvaluate(t *testing.T) {
+	v := func(x float64) *float64 { return &x }
+	near := func(p *float64, want float64) bool { return p != nil && math.Abs(*p-want) < 1e-9 }
+
+	// 435 peças com metade do turno: no ritmo atual, 870/1000.
+	r := TargetProgressRow{Metric: TargetMetricPieces, Target: 1000, Actual: v(435)}
+	r.evaluate(0.5, false)
+	if r.Status != "behind" || !near(r.Projected, 870) || !near(r.PacePct, 87) || !near(r.Expected, 500) || !near(r.AttainmentPct, 43.5) {
+		t.Errorf("pieces = %+v", r)
+	}
+	if r.Message != "no ritmo atual: 870/1000 peças (87%)" {
+		t.Errorf("message = %q", r.Message)
+	}
+	if !targetBehindPace(r, 90) || targetBehindPace(r, 85) || !targetBehindPace(r, 0) {
+		t.Errorf("targetBehindPace(87%%)")
+	}
+	// Início da janela: sem alerta antes de targetAlertMinElapsed.
+	early := TargetProgressRow{Metric: TargetMetricPieces, Target: 1000, Actual: v(0)}
+	early.evaluate(0.05, false)
+	if early.Status != "behind" || targetBehindPace(early, 100) {
+		t.Errorf("early = %+v", early)
+	}
+
+	// Encerrada: realizado sem projeção.
+	r = TargetProgressRow{Metric: TargetMetricPieces, Target: 1000, Actual: v(1010)}
+	r.evaluate(1, true)
+	if r.Status != "achieved" || !near(r.Projected, 1010) || targetBehindPace(r, 100) {
+		t.Errorf("finished = %+v", r)
+	}
+
+	// Refugo: menor é melhor.
+	r = TargetProgressRow{Metric: TargetMetricScrapRate, Target: 2, Actual: v(4)}
+	r.evaluate(0.5, false)
+	if r.Status != "behind" || !near(r.PacePct, 50) || !near(r.Projected, 4) {
+		t.Errorf("scrap = %+v", r)
+	}
+	r = TargetProgressRow{Metric: TargetMetricScrapRate, Target: 2, Actual: v(0)}
+	r.evaluate(1, true)
+	if r.Status != "achieved" || !near(r.AttainmentPct, 100) {
+		t.Errorf("scrap zero = %+v", r)
+	}
+
+	// OEE sem dados.
+	r = TargetProgressRow{Metric: TargetMetricOEE, Target: 75}
+	r.evaluate(0.5, false)
+	if r.Status != "no_data" || r.PacePct != nil || targetBehindPace(r, 100) {
+		t.Errorf("no data = %+v", r)
+	}
+}
@@ -0,0 +1,366 @@
+package store
+
+// reliability.go — Confiabilidade por ativo: MTBF, MTTR, falhas e disponibilidade
+//
+// Falhas de um ativo vêm de duas fontes, unidas (intervalos sobrepostos viram
+// uma falha só):
+//   downtime_events → paradas detectadas pelo tag_status (downtime.go). Com
+//                     basis=failures só contam as classificadas com motivo de
+//                     falha (is_failure no motivo ou em um ancestral); com
+//                     basis=all toda parada é falha.
+//   tag_alarm       → alarme de falha do CLP: leitura >= 0.5 = em falha, cada
+//                     leitura vale até a próxima ou até o hold do ativo (oee.go).
+//
+// Tempo disponível = tempo programado do calendário − paradas planejadas (o mesmo
+// tempo planejado do OEE). Só a parte de cada falha dentro dele conta como reparo;
+// a falha conta no bucket onde começa a parte disponível.
+//   operação      = disponível − reparo
+//   MTBF          = operação / falhas
+//   MTTR          = reparo / falhas
+//   disponibilidade = operação / disponível
+// Setor e total somam tempos e falhas dos ativos (não é média de MTBFs).
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReliabilityQuery define escopo, período, base de falhas e tendência (Bucket 0 = sem tendência).
+type ReliabilityQuery struct {
+	FactoryID uuid.UUID
+	SectorID  *uuid.UUID
+	AssetID   *uuid.UUID
+	Start     time.Time
+	End       time.Time
+	Bucket    time.Duration
+	Basis     string // failures (padrão) | all
+}
+
+// ReliabilityResult — indicadores de um ativo, setor ou do total. MTBF/MTTR nil = sem falhas no período.
+type ReliabilityResult struct {
+	Scope          string     `json:"scope"` // asset | sector | total
+	ID             *uuid.UUID `json:"id,omitempty"`
+	Name           string     `json:"name,omitempty"`
+	SectorID       *uuid.UUID `json:"sector_id,omitempty"`
+	AvailableTimeS float64    `json:"available_time_s"` // programado − paradas planejadas
+	OperatingTimeS float64    `json:"operating_time_s"`
+	RepairTimeS    float64    `json:"repair_time_s"`
+	Failures       int        `json:"failures"`
+	MTBFS          *float64   `json:"mtbf_s"`
+	MTTRS          *float64   `json:"mttr_s"`
+	Availability   *float64   `json:"availability"`
+	Unclassified   int        `json:"unclassified_stops,omitempty"` // paradas sem motivo (basis=failures)
+	Missing        []string   `json:"missing,omitempty"`
+}
+
+// ReliabilityTrendPoint — indicadores do escopo em um bucket.
+type ReliabilityTrendPoint struct {
+	BucketStart    time.Time `json:"bucket_start"`
+	BucketEnd      time.Time `json:"bucket_end"`
+	Failures       int       `json:"failures"`
+	RepairTimeS    float64   `json:"repair_time_s"`
+	OperatingTimeS float64   `json:"operating_time_s"`
+	MTBFS          *float64  `json:"mtbf_s"`
+	MTTRS          *float64  `json:"mttr_s"`
+	Availability   *float64  `json:"availability"`
+}
+
+// ReliabilityReport — resultado completo de ComputeReliability.
+type ReliabilityReport struct {
+	PeriodStart time.Time               `json:"period_start"`
+	PeriodEnd   time.Time               `json:"period_end"`
+	Basis       string                  `json:"basis"`
+	BucketS     int64                   `json:"bucket_s,omitempty"`
+	Total       ReliabilityResult       `json:"total"`
+	Sectors     []ReliabilityResult     `json:"sectors"`
+	Assets      []ReliabilityResult     `json:"assets"`
+	Trend       []ReliabilityTrendPoint `json:"trend,omitempty"`
+}
+
+// failureSpan — uma falha já cortada para o tempo disponível (Parts unidas e ordenadas).
+type failureSpan struct {
+	Start time.Time
+	Parts []timeRange
+}
+
+// buildFailureSpans une os intervalos de falha (eventos + alarme) e corta cada um
+// para [start, end) fora dos intervalos excluídos. Falhas inteiramente fora do
+// tempo disponível são descartadas.
+func buildFailureSpans(intervals []timeRange, excluded []timeRange, start, end time.Time) []failureSpan {
+	var spans []failureSpan
+	for _, iv := range mergeRanges(intervals) {
+		parts := subtractRanges(clipRanges([]timeRange{iv}, start, end), excluded)
+		if len(parts) == 0 {
+			continue
+		}
+		spans = append(spans, failureSpan{Start: parts[0].Start, Parts: parts})
+	}
+	return spans
+}
+
+// relAccum soma tempos (s) e falhas; os indicadores saem de ratios().
+type relAccum struct {
+	available, repair float64
+	failures          int
+}
+
+func (a *relAccum) add(b relAccum) {
+	a.available += b.available
+	a.repair += b.repair
+	a.failures += b.failures
+}
+
+// accumulateReliability calcula o acumulado de um ativo em [start, end).
+func accumulateReliability(spans []failureSpan, excluded []timeRange, start, end time.Time) relAccum {
+	acc := relAccum{available: end.Sub(start).Seconds() - overlapSeconds(excluded, start, end)}
+	for _, f := range spans {
+		if !f.Start.Before(start) && f.Start.Before(end) {
+			acc.failures++
+		}
+		acc.repair += overlapSeconds(f.Parts, start, end)
+	}
+	return acc
+}
+
+func (a relAccum) ratios() (operating float64, mtbf, mttr, availability *float64) {
+	operating = a.available - a.repair
+	if operating < 0 {
+		operating = 0
+	}
+	if a.failures > 0 {
+		n := float64(a.failures)
+		b, r := operating/n, a.repair/n
+		mtbf, mttr = &b, &r
+	}
+	if a.available > 0 {
+		v := operating / a.available
+		availability = &v
+	}
+	return operating, mtbf, mttr, availability
+}
+
+func (a relAccum) fill(r *ReliabilityResult) {
+	r.AvailableTimeS = a.available
+	r.RepairTimeS = a.repair
+	r.Failures = a.failures
+	r.OperatingTimeS, r.MTBFS, r.MTTRS, r.Availability = a.ratios()
+}
+
+// failureReasons retorna os motivos que são falha: is_failure no próprio motivo ou em um ancestral.
+func failureReasons(reasons []DowntimeReasonRow) map[uuid.UUID]bool {
+	byID := make(map[uuid.UUID]DowntimeReasonRow, len(reasons))
+	for _, r := range reasons {
+		byID[r.ID] = r
+	}
+	out := map[uuid.UUID]bool{}
+	for _, r := range reasons {
+		cur := r
+		for depth := 0; depth < 32; depth++ {
+			if cur.IsFailure {
+				out[r.ID] = true
+				break
+			}
+			if cur.ParentID == nil {
+				break
+			}
+			parent, ok := byID[*cur.ParentID]
+			if !ok {
+				break
+			}
+			cur = parent
+		}
+	}
+	return out
+}
+
+// alarmRanges converte a série do tag_alarm (Running = alarme ativo) em intervalos de falha.
+func alarmRanges(series []statusPoint, end time.Time, hold time.Duration) []timeRange {
+	var out []timeRange
+	for i, p := range series {
+		if !p.Running || !p.Ts.Before(end) {
+			continue
+		}
+		segEnd := end
+		if i+1 < len(series) && series[i+1].Ts.Before(segEnd) {
+			segEnd = series[i+1].Ts
+		}
+		if limit := p.Ts.Add(hold); limit.Before(segEnd) {
+			segEnd = limit
+		}
+		if segEnd.After(p.Ts) {
+			out = append(out, timeRange{p.Ts, segEnd})
+		}
+	}
+	return mergeRanges(out)
+}
+
+// loadFailureEvents lê as paradas do escopo que se sobrepõem ao período, por ativo.
+// Com basis=failures só entram motivos de falha; unclassified conta as paradas sem
+// motivo que começam no período (candidatas a falha ainda não classificadas).
+func loadFailureEvents(db *sql.DB, q ReliabilityQuery) (events map[uuid.UUID][]timeRange, unclassified map[uuid.UUID]int, err error) {
+	var isFailure map[uuid.UUID]bool
+	if q.Basis != "all" {
+		reasons, err := ListDowntimeReasons(db, q.FactoryID, true)
+		if err != nil {
+			return nil, nil, err
+		}
+		isFailure = failureReasons(reasons)
+	}
+	query := `
+		SELECT e.asset_id, e.reason_id, e.started_at, COALESCE(e.ended_at, NOW())
+		FROM nxd.downtime_events e
+		JOIN nxd.assets a ON a.id = e.asset_id
+		WHERE e.factory_id = $1 AND e.started_at < $3 AND COALESCE(e.ended_at, NOW()) > $2`
+	args := []interface{}{q.FactoryID, q.Start, q.End}
+	if q.SectorID != nil {
+		args = append(args, *q.SectorID)
+		query += fmt.Sprintf(" AND a.group_id = $%d", len(args))
+	}
+	if q.AssetID != nil {
+		args = append(args, *q.AssetID)
+		query += fmt.Sprintf(" AND e.asset_id = $%d", len(args))
+	}
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rows.Close()
+	events = map[uuid.UUID][]timeRange{}
+	unclassified = map[uuid.UUID]int{}
+	for rows.Next() {
+		var assetID uuid.UUID
+		var reasonID uuid.NullUUID
+		var startedAt, endedAt time.Time
+		if err := rows.Scan(&assetID, &reasonID, &startedAt, &endedAt); err != nil {
+			return nil, nil, err
+		}
+		if isFailure != nil {
+			if !reasonID.Valid {
+				if !startedAt.Before(q.Start) {
+					unclassified[assetID]++
+				}
+				continue
+			}
+			if !isFailure[reasonID.UUID] {
+				continue
+			}
+		}
+		events[assetID] = append(events[assetID], timeRange{startedAt, endedAt})
+	}
+	return events, unclassified, rows.Err()
+}
+
+// ComputeReliability calcula MTBF/MTTR por ativo, setor e total, com tendência opcional.
+func ComputeReliability(db *sql.DB, q ReliabilityQuery) (*ReliabilityReport, error) {
+	if !q.Start.Before(q.End) {
+		return nil, fmt.Errorf("período inválido")
+	}
+	if q.Basis != "all" {
+		q.Basis = "failures"
+	}
+	var nBuckets int
+	if q.Bucket > 0 {
+		nBuckets = int((q.End.Sub(q.Start) + q.Bucket - 1) / q.Bucket)
+		if nBuckets > oeeMaxBuckets {
+			return nil, fmt.Errorf("tendência com %d buckets (máximo %d): aumente o bucket", nBuckets, oeeMaxBuckets)
+		}
+	}
+	assets, err := loadOEEAssets(db, OEEQuery{FactoryID: q.FactoryID, SectorID: q.SectorID, AssetID: q.AssetID, Start: q.Start, End: q.End})
+	if err != nil {
+		return nil, err
+	}
+	events, unclassified, err := loadFailureEvents(db, q)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReliabilityReport{
+		PeriodStart: q.Start,
+		PeriodEnd:   q.End,
+		Basis:       q.Basis,
+		Sectors:     []ReliabilityResult{},
+		Assets:      []ReliabilityResult{},
+	}
+	if q.Bucket > 0 {
+		report.BucketS = int64(q.Bucket / time.Second)
+	}
+	var total relAccum
+	var totalUnclassified int
+	trend := make([]relAccum, nBuckets)
+	type sectorAgg struct {
+		res ReliabilityResult
+		acc relAccum
+	}
+	var sectorOrder []string
+	sectors := map[string]*sectorAgg{}
+
+	for _, a := range assets {
+		intervals := events[a.id]
+		if a.mapping != nil && a.mapping.TagAlarm != "" {
+			series, err := loadStatusSeries(db, a.id, a.mapping.TagAlarm, q.Start, q.End, a.hold)
+			if err != nil {
+				return nil, fmt.Errorf("alarme %s: %w", a.id, err)
+			}
+			intervals = append(intervals, alarmRanges(series, q.End, a.hold)...)
+		}
+		spans := buildFailureSpans(intervals, a.excluded, q.Start, q.End)
+		acc := accumulateReliability(spans, a.excluded, q.Start, q.End)
+
+		id := a.id
+		res := ReliabilityResult{Scope: "asset", ID: &id, Name: a.name, SectorID: a.sectorID, Unclassified: unclassified[a.id]}
+		acc.fill(&res)
+		if a.mapping == nil || (a.mapping.TagStatus == "" && a.mapping.TagAlarm == "") {
+			res.Missing = append(res.Missing, "tag_status/tag_alarm")
+		}
+		report.Assets = append(report.Assets, res)
+		total.add(acc)
+		totalUnclassified += res.Unclassified
+
+		key := ""
+		if a.sectorID != nil {
+			key = a.sectorID.String()
+		}
+		s, ok := sectors[key]
+		if !ok {
+			s = &sectorAgg{res: ReliabilityResult{Scope: "sector", ID: a.sectorID, Name: a.sectorName}}
+			if a.sectorID == nil {
+				s.res.Name = "Sem setor"
+			}
+			sectors[key] = s
+			sectorOrder = append(sectorOrder, key)
+		}
+		s.acc.add(acc)
+		s.res.Unclassified += res.Unclassified
+
+		for i := 0; i < nBuckets; i++ {
+			bs := q.Start.Add(time.Duration(i) * q.Bucket)
+			be := bs.Add(q.Bucket)
+			if be.After(q.End) {
+				be = q.End
+			}
+			trend[i].add(accumulateReliability(spans, a.excluded, bs, be))
+		}
+	}
+
+	for _, k := range sectorOrder {
+		s := sectors[k]
+		s.acc.fill(&s.res)
+		report.Sectors = append(report.Sectors, s.res)
+	}
+	report.Total = ReliabilityResult{Scope: "total", Unclassified: totalUnclassified}
+	total.fill(&report.Total)
+	for i, acc := range trend {
+		bs := q.Start.Add(time.Duration(i) * q.Bucket)
+		be := bs.Add(q.Bucket)
+		if be.After(q.End) {
+			be = q.End
+		}
+		p := ReliabilityTrendPoint{BucketStart: bs, BucketEnd: be, Failures: acc.failures, RepairTimeS: acc.repair}
+		p.OperatingTimeS, p.MTBFS, p.MTTRS, p.Availability = acc.ratios()
+		report.Trend = append(report.Trend, p)
+	}
+	return report, nil
+}
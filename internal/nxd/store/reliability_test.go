@@ -0,0 +1,62 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// TestReliabilitySpans cobre a união evento + alarme, o corte pelo tempo
+// disponível (fora de turno) e a contagem da falha no bucket onde começa.
+func TestReliabilitySpans(t *testing.T) {
+	t0 := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	at := func(min int) time.Time { return t0.Add(time.Duration(min) * time.Minute) }
+
+	excluded := []timeRange{{at(60), at(120)}} // 09:00–10:00 fora de turno
+	alarm := alarmRanges([]statusPoint{
+		{at(25), true},  // alarme 08:25
+		{at(35), false}, // normaliza 08:35
+		{at(110), true}, // alarme fora de turno, segue até 10:10 (hold)
+	}, at(180), 20*time.Minute)
+	if len(alarm) != 2 || !alarm[1].End.Equal(at(130)) {
+		t.Fatalf("alarmRanges = %v", alarm)
+	}
+	events := []timeRange{{at(20), at(30)}, {at(150), at(160)}} // sobrepõe o alarme de 08:25
+	spans := buildFailureSpans(append(events, alarm...), excluded, at(0), at(180))
+	if len(spans) != 3 {
+		t.Fatalf("spans = %v", spans)
+	}
+	// A falha iniciada fora de turno conta a partir de 10:00.
+	if !spans[0].Start.Equal(at(20)) || !spans[1].Start.Equal(at(120)) {
+		t.Errorf("starts = %v, %v", spans[0].Start, spans[1].Start)
+	}
+
+	acc := accumulateReliability(spans, excluded, at(0), at(180))
+	// Disponível 120 min; reparo 15 + 10 + 10 = 35 min; 3 falhas.
+	if acc.available != 120*60 || acc.repair != 35*60 || acc.failures != 3 {
+		t.Fatalf("acc = %+v", acc)
+	}
+	op, mtbf, mttr, av := acc.ratios()
+	if op != 85*60 || *mtbf != 85*60/3.0 || *mttr != 35*60/3.0 || *av != 85.0/120 {
+		t.Errorf("op=%v mtbf=%v mttr=%v av=%v", op, *mtbf, *mttr, *av)
+	}
+	if b := accumulateReliability(spans, excluded, at(0), at(60)); b.failures != 1 || b.repair != 15*60 {
+		t.Errorf("bucket = %+v", b)
+	}
+	if _, mtbf, mttr, _ := (relAccum{available: 3600}).ratios(); mtbf != nil || mttr != nil {
+		t.Error("without failures MTBF/MTTR must be nil")
+	}
+}
+
+func TestFailureReasonsInherit(t *testing.T) {
+	mec, leak, setup := uuid.New(), uuid.New(), uuid.New()
+	got := failureReasons([]DowntimeReasonRow{
+		{ID: mec, Code: "MEC", IsFailure: true},
+		{ID: leak, ParentID: &mec, Code: "MEC-04"},
+		{ID: setup, Code: "SET"},
+	})
+	if !got[mec] || !got[leak] || got[setup] {
+		t.Errorf("failureReasons = %v", got)
+	}
+}
@@ -45,3 +45,85 @@ func ListReportTemplates(db *sql.DB) ([]ReportTemplateRow, error) {
 	}
 	return list, rows.Err()
 }
+
+// GetReportTemplate retorna um template pelo id (nil se não existir).
+func GetReportTemplate(db *sql.DB, id uuid.UUID) (*ReportTemplateRow, error) {
+	var r ReportTemplateRow
+	var desc, prompt sql.NullString
+	err := db.QueryRow(
+		`SELECT id, category, name, description, default_filters, prompt_instructions, output_schema_version, created_at FROM nxd.report_templates WHERE id = $1`, id,
+	).Scan(&r.ID, &r.Category, &r.Name, &desc, &r.DefaultFilters, &prompt, &r.OutputSchemaVersion, &r.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.Description, r.PromptInstructions = desc.String, prompt.String
+	return &r, nil
+}
+
+// reportPeriodWindow converte o período do relatório (24h, 7d, 30d; padrão 7d) em [start, end).
+func reportPeriodWindow(period string, now time.Time) (time.Time, time.Time) {
+	switch period {
+	case "24h":
+		return now.Add(-24 * time.Hour), now
+	case "30d":
+		return now.Add(-30 * 24 * time.Hour), now
+	}
+	return now.Add(-7 * 24 * time.Hour), now
+}
+
+// BuildReportInputs calcula os dados estruturados que acompanham o template no
+// contrato do relatório, para o modelo usar valores calculados em vez de estimar.
+// Manutenção: confiabilidade (MTBF/MTTR, falhas, disponibilidade) com tendência diária;
+// "Saúde dos Ativos" recebe também o último score de saúde de cada ativo com os fatores.
+// Financeiro: energia (kWh e custo por posto, demanda de pico, kWh por peça boa).
+// ESG: emissões Escopo 2 da fábrica (CO2e por setor, ativo e produto, completude).
+// Estratégia: benchmark dos setores (posição, percentil e variação por KPI).
+// Retorna nil para categorias sem entradas calculadas.
+func BuildReportInputs(db *sql.DB, tpl *ReportTemplateRow, factoryID uuid.UUID, sectorID *uuid.UUID, period string, now time.Time) (map[string]interface{}, error) {
+	if tpl == nil {
+		return nil, nil
+	}
+	start, end := reportPeriodWindow(period, now)
+	switch tpl.Category {
+	case "Manutencao":
+		q := ReliabilityQuery{FactoryID: factoryID, SectorID: sectorID, Start: start, End: end}
+		if end.Sub(start) > 24*time.Hour {
+			q.Bucket = 24 * time.Hour
+		}
+		rel, err := ComputeReliability(db, q)
+		if err != nil {
+			return nil, err
+		}
+		inputs := map[string]interface{}{"reliability": rel}
+		if tpl.Name == "Saúde dos Ativos" {
+			health, err := ListLatestAssetHealth(db, factoryID, sectorID)
+			if err != nil {
+				return nil, err
+			}
+			inputs["health"] = health
+		}
+		return inputs, nil
+	case "Financeiro":
+		en, err := ComputeEnergyReport(db, EnergyQuery{FactoryID: factoryID, SectorID: sectorID, Start: start, End: end})
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"energy": en}, nil
+	case "Estrategia":
+		bm, err := ComputeBenchmark(db, BenchmarkQuery{FactoryID: factoryID, Level: BenchmarkLevelSector, Start: start, End: end})
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"benchmark": bm}, nil
+	case "ESG":
+		esg, err := ComputeESGReport(db, ESGQuery{FactoryID: factoryID, Start: start, End: end, Bucket: "day"}, now)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{"esg": esg}, nil
+	}
+	return nil, nil
+}
@@ -55,6 +55,22 @@ func ListSectors(db *sql.DB, factoryID uuid.UUID) ([]SectorRow, error) {
 	return list, rows.Err()
 }
 
+// GetSectorByID returns a sector by id if it belongs to the factory (nil if not found).
+func GetSectorByID(db *sql.DB, sectorID, factoryID uuid.UUID) (*SectorRow, error) {
+	var r SectorRow
+	err := db.QueryRow(
+		fmt.Sprintf("SELECT id, factory_id, name, COALESCE(description, ''), created_at FROM %s WHERE id = $1 AND factory_id = $2", tableSectors()),
+		sectorID, factoryID,
+	).Scan(&r.ID, &r.FactoryID, &r.Name, &r.Description, &r.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
 // CreateSector inserts a new sector into the database.
 func CreateSector(db *sql.DB, factoryID uuid.UUID, name string, description string) (uuid.UUID, error) {
 	id := uuid.New()
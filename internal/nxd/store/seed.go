@@ -22,15 +22,16 @@ func SeedReportTemplates(db *sql.DB) error {
 		OutputSchemaVersion  string
 	}{
 		{"Producao", "Resumo de Produção Diária", "Produção total, peças, paradas e eficiência do dia.", "Gere um resumo executivo com KPIs de produção e paradas.", "1"},
-		{"Producao", "OEE por Setor", "OEE (Overall Equipment Effectiveness) por setor no período.", "Calcule e apresente OEE com disponibilidade, desempenho e qualidade.", "1"},
+		{"Producao", "OEE por Setor", "OEE (Overall Equipment Effectiveness) por setor no período.", "Use os valores de OEE calculados (disponibilidade, desempenho, qualidade) fornecidos no contexto; não estime. Marque em missing_data os ativos sem ciclo ideal ou sem tag de status.", "1"},
 		{"Producao", "Paradas e Causas", "Análise de paradas com duração e causas raiz.", "Liste paradas, duração e indique causas quando houver dados.", "1"},
 		{"Financeiro", "Lucro Cessante", "Estimativa de lucro cessante por paradas no período.", "Use apenas custo/hora e tempo parado configurados; marque INSUFICIENTE se faltar.", "1"},
-		{"Financeiro", "Custo Energia vs Produção", "Consumo de energia e custo versus peças produzidas.", "Relação energia/produção; marque dados faltantes em missing_data.", "1"},
+		{"Financeiro", "Custo Energia vs Produção", "Consumo de energia e custo versus peças produzidas.", "Use kWh, custo por posto tarifário, demanda de pico e kWh por peça boa de inputs.energy; não estime. Marque medidores ou tarifa ausentes em missing_data.", "1"},
 		{"Qualidade", "Refugo e Não Conformidades", "Volume de refugo e eventos de qualidade no período.", "Refugo e NC quando houver métricas; senão missing_data.", "1"},
-		{"Manutencao", "Saúde dos Ativos", "Status e alertas de manutenção por máquina/setor.", "Health score e alertas; recomendações apenas com evidência.", "1"},
-		{"Manutencao", "Tendência de Falhas", "Tendência de falhas e avisos ao longo do tempo.", "Séries de falhas/avisos; sem inventar causas.", "1"},
+		{"Manutencao", "Saúde dos Ativos", "Status e alertas de manutenção por máquina/setor.", "Use o health score e a contribuição de cada fator de inputs.health e MTBF, MTTR, falhas e disponibilidade de inputs.reliability; não estime. Recomendações apenas com evidência.", "1"},
+		{"Manutencao", "Tendência de Falhas", "Tendência de falhas e avisos ao longo do tempo.", "Use a série de falhas, MTBF e MTTR de inputs.reliability; não estime valores ausentes. Sem inventar causas.", "1"},
 		{"Estrategia", "Visão Executiva 30 dias", "Resumo para diretoria: produção, paradas, principais achados.", "Máximo 7 bullets; riscos e premissas; missing_data explícito.", "1"},
-		{"Estrategia", "Comparativo Setores", "Comparativo de desempenho entre setores.", "Compare apenas métricas disponíveis; evidências em evidence_refs.", "1"},
+		{"Estrategia", "Comparativo Setores", "Comparativo de desempenho entre setores.", "Use posições, percentis, quartis e variações de inputs.benchmark; não estime. Compare apenas métricas disponíveis; evidências em evidence_refs.", "1"},
+		{"ESG", "Emissões Escopo 2", "Emissões de CO2e da energia elétrica por setor, ativo e produto, com metodologia e completude.", "Use kWh, CO2e, fatores e completude de inputs.esg; não estime nem converta com outros fatores. Cite a metodologia e marque fontes sem dados ou kWh sem fator em missing_data.", "1"},
 	}
 	for _, t := range defaults {
 		df, _ := json.Marshal(map[string]interface{}{"period": "7d", "detail": "medio"})
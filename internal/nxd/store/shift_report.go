@@ -0,0 +1,115 @@
+package store
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const shiftReportMaxInstances = 120
+
+// ShiftReportRow — indicadores de uma ocorrência de turno.
+type ShiftReportRow struct {
+	ShiftInstance
+	OEE               OEEResult                 `json:"oee"`
+	Financial         *FinancialAggregateResult `json:"financial,omitempty"`
+	DowntimeEvents    int                       `json:"downtime_events"`
+	DowntimeDurationS float64                   `json:"downtime_duration_s"`
+	TopDowntimeReason string                    `json:"top_downtime_reason,omitempty"`
+	// Anotações do turno (annotations.go) para a passagem de turno.
+	Annotations []AnnotationRow `json:"annotations"`
+}
+
+// ResolveShiftPeriod retorna a janela de "current_shift" (turno em andamento) ou
+// "last_shift" (último turno encerrado) do setor (nil = turnos da fábrica).
+func ResolveShiftPeriod(db *sql.DB, factoryID uuid.UUID, sectorID *uuid.UUID, which string, now time.Time) (*ShiftInstance, error) {
+	from := now.Add(-8 * 24 * time.Hour)
+	cal, err := LoadProductionCalendar(db, factoryID, from, now.Add(24*time.Hour))
+	if err != nil {
+		return nil, err
+	}
+	instances := cal.ShiftInstances(sectorID, from, now.Add(time.Second))
+	for i := len(instances) - 1; i >= 0; i-- {
+		in := instances[i]
+		switch which {
+		case "current_shift":
+			if !in.Start.After(now) && in.End.After(now) {
+				return &in, nil
+			}
+		case "last_shift":
+			if !in.End.After(now) {
+				return &in, nil
+			}
+		default:
+			return nil, fmt.Errorf("período de turno desconhecido %q", which)
+		}
+	}
+	return nil, nil
+}
+
+// ComputeShiftReport calcula OEE, financeiro, paradas e anotações para cada
+// ocorrência de turno que começa em [start, end). Turnos em andamento são cortados em now.
+func ComputeShiftReport(db *sql.DB, factoryID uuid.UUID, sectorID *uuid.UUID, start, end time.Time) ([]ShiftReportRow, error) {
+	cal, err := LoadProductionCalendar(db, factoryID, start, end)
+	if err != nil {
+		return nil, err
+	}
+	instances := cal.ShiftInstances(sectorID, start, end)
+	if len(instances) > shiftReportMaxInstances {
+		return nil, fmt.Errorf("%d turnos no período (máximo %d): reduza o período", len(instances), shiftReportMaxInstances)
+	}
+	now := time.Now()
+	// Financeiro de todos os turnos num único lote de leituras; anotações numa consulta.
+	var periods []FinancialPeriod
+	notesEnd := start
+	for _, in := range instances {
+		if in.Start.After(now) {
+			continue
+		}
+		periodEnd := in.End
+		if periodEnd.After(now) {
+			periodEnd = now
+		}
+		periods = append(periods, FinancialPeriod{Start: in.Start, End: periodEnd})
+		if periodEnd.After(notesEnd) {
+			notesEnd = periodEnd
+		}
+	}
+	fins, _, err := ComputeFinancialAggregates(db, factoryID, sectorID, periods)
+	if err != nil {
+		return nil, fmt.Errorf("financeiro: %w", err)
+	}
+	notes, err := ListAnnotations(db, AnnotationQuery{FactoryID: factoryID, SectorID: sectorID, Start: start, End: notesEnd})
+	if err != nil {
+		return nil, fmt.Errorf("anotações: %w", err)
+	}
+	out := []ShiftReportRow{}
+	for _, in := range instances {
+		if in.Start.After(now) {
+			continue
+		}
+		periodEnd := in.End
+		if periodEnd.After(now) {
+			periodEnd = now
+		}
+		row := ShiftReportRow{ShiftInstance: in, Financial: fins[len(out)], Annotations: annotationsIn(notes, in.Start, periodEnd)}
+		rep, err := ComputeOEE(db, OEEQuery{FactoryID: factoryID, SectorID: sectorID, Start: in.Start, End: periodEnd})
+		if err != nil {
+			return nil, fmt.Errorf("OEE %s %s: %w", in.Name, in.Start.Format(time.RFC3339), err)
+		}
+		row.OEE = rep.Total
+		pareto, err := ComputeDowntimePareto(db, DowntimeEventQuery{FactoryID: factoryID, SectorID: sectorID, Start: in.Start, End: periodEnd}, "reason")
+		if err != nil {
+			return nil, fmt.Errorf("paradas %s: %w", in.Name, err)
+		}
+		row.DowntimeEvents = pareto.TotalEvents
+		row.DowntimeDurationS = pareto.TotalDurationS
+		if len(pareto.Items) > 0 {
+			row.TopDowntimeReason = pareto.Items[0].Name
+		}
+		out = append(out, row)
+	}
+	return out, nil
+}
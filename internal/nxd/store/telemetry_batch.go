@@ -0,0 +1,327 @@
+package store
+
+// telemetry_batch.go — Leitura de telemetria em lote (financeiro, energia, ESG)
+//
+// O resumo financeiro lia cada ativo em separado: mapeamento, duas consultas de
+// contador, a varredura de horas parada e o nome — e o resumo por faixas repetia tudo para
+// cada período. Com 100+ ativos eram milhares de consultas por requisição.
+//
+// Aqui as leituras são planejadas antes (telemetryBatch.counter/delta/hoursParada
+// devolvem um *telemetryRead ainda vazio) e executadas juntas por run:
+//
+//   1 consulta        → counter_config de todos os ativos do lote
+//   1 por janela      → telemetry_log de todas as séries (ativo, tag). As janelas são os
+//                       intervalos lidos (início − counterLookback nos contadores, até
+//                       o fim), unidos quando se sobrepõem e cortados em pedaços de no
+//                       máximo telemetryBatchWindow: períodos distantes não puxam o
+//                       intervalo entre eles e nenhuma consulta cobre um ano inteiro.
+//
+// As leituras são acumuladas amostra a amostra (feed), na ordem de ts de cada série,
+// então nada da série fica em memória — só o estado de cada leitura. Os limites são
+// os das antigas consultas por ativo — contador: referência em [start −
+// counterLookback, start] e leituras em (start, end]; último valor e horas parada:
+// [start, end]. financial_batch_test.go guarda essas consultas como referência e
+// confere o lote contra elas e contra valores calculados à mão (reset, volta e ruído).
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// seriesKey identifica uma série de telemetria.
+type seriesKey struct {
+	asset  uuid.UUID
+	metric string
+}
+
+// telemetrySample — uma leitura da série.
+type telemetrySample struct {
+	ts time.Time
+	v  float64
+}
+
+const (
+	readCounter = iota // acréscimo pela semântica de contador
+	readLast           // último valor em [start, end] (reading_rule "absolute")
+	readParada         // horas com tag_status parado
+)
+
+// telemetryBatchWindow limita o intervalo de cada consulta do lote.
+const telemetryBatchWindow = 7 * 24 * time.Hour
+
+// telemetryRead — leitura planejada; value (e counter, nas de contador) só valem depois de run.
+type telemetryRead struct {
+	kind       int
+	start, end time.Time
+	excluded   []timeRange
+	fn         func(prevTs, ts time.Time, inc float64)
+
+	value   float64
+	counter *counterAccum
+
+	// Estado do acúmulo (feed): referência do contador ainda não usada, leitura
+	// anterior e, nas horas parada, se ela indicava parado e os segundos somados.
+	ref        *telemetrySample
+	prevTs     time.Time
+	prevParada bool
+	secs       float64
+}
+
+// begin zera o acúmulo (cfg = configuração de contador da série).
+func (r *telemetryRead) begin(cfg CounterConfigRow) {
+	r.value, r.ref, r.prevTs, r.prevParada, r.secs = 0, nil, time.Time{}, false, 0
+	if r.kind == readCounter {
+		r.counter = &counterAccum{cfg: cfg}
+	}
+}
+
+// feed acumula uma leitura da série; as leituras chegam em ordem de ts.
+func (r *telemetryRead) feed(s telemetrySample) {
+	switch r.kind {
+	case readCounter:
+		if !s.ts.After(r.start) {
+			// A última leitura até start dentro do lookback é a referência.
+			if !s.ts.Before(r.start.Add(-counterLookback)) {
+				ref := s
+				r.ref = &ref
+			}
+			return
+		}
+		if s.ts.After(r.end) {
+			return
+		}
+		r.useRef()
+		r.addCounter(s)
+	case readLast:
+		if !s.ts.Before(r.start) && !s.ts.After(r.end) {
+			r.value = s.v
+		}
+	case readParada:
+		if s.ts.Before(r.start) || s.ts.After(r.end) {
+			return
+		}
+		parada := s.v < 0.5 // 0 = parado, 1 = rodando
+		if r.prevParada && parada {
+			r.secs += s.ts.Sub(r.prevTs).Seconds() - overlapSeconds(r.excluded, r.prevTs, s.ts)
+		}
+		r.prevTs, r.prevParada = s.ts, parada
+	}
+}
+
+// finish fecha o acúmulo e preenche value.
+func (r *telemetryRead) finish() {
+	switch r.kind {
+	case readCounter:
+		r.useRef()
+		r.value = r.counter.Increase
+	case readParada:
+		r.value = r.secs / 3600
+	}
+}
+
+func (r *telemetryRead) useRef() {
+	if r.ref != nil {
+		s := *r.ref
+		r.ref = nil
+		r.addCounter(s)
+	}
+}
+
+// addCounter soma a leitura ao contador; fn recebe cada trecho após a referência.
+func (r *telemetryRead) addCounter(s telemetrySample) {
+	first := !r.counter.has
+	inc := r.counter.add(s.v)
+	if r.fn != nil && !first {
+		r.fn(r.prevTs, s.ts, inc)
+	}
+	r.prevTs = s.ts
+}
+
+// telemetryBatch agrupa as leituras planejadas por série.
+type telemetryBatch struct {
+	reads    map[seriesKey][]*telemetryRead
+	order    []seriesKey
+	from, to time.Time
+}
+
+func newTelemetryBatch() *telemetryBatch {
+	return &telemetryBatch{reads: map[seriesKey][]*telemetryRead{}}
+}
+
+func (b *telemetryBatch) add(assetID uuid.UUID, metricKey string, r *telemetryRead) *telemetryRead {
+	k := seriesKey{assetID, metricKey}
+	if _, ok := b.reads[k]; !ok {
+		b.order = append(b.order, k)
+	}
+	b.reads[k] = append(b.reads[k], r)
+	from := r.start
+	if r.kind == readCounter {
+		from = from.Add(-counterLookback)
+	}
+	if b.from.IsZero() || from.Before(b.from) {
+		b.from = from
+	}
+	if r.end.After(b.to) {
+		b.to = r.end
+	}
+	return r
+}
+
+// counter planeja o acréscimo do contador em (start, end]; fn recebe cada trecho após a referência.
+func (b *telemetryBatch) counter(assetID uuid.UUID, metricKey string, start, end time.Time, fn func(prevTs, ts time.Time, inc float64)) *telemetryRead {
+	return b.add(assetID, metricKey, &telemetryRead{kind: readCounter, start: start, end: end, fn: fn})
+}
+
+// delta planeja a produção/consumo da tag: último valor com reading_rule "absolute", senão contador.
+func (b *telemetryBatch) delta(assetID uuid.UUID, metricKey, rule string, start, end time.Time) *telemetryRead {
+	if rule == "absolute" {
+		return b.add(assetID, metricKey, &telemetryRead{kind: readLast, start: start, end: end})
+	}
+	return b.counter(assetID, metricKey, start, end, nil)
+}
+
+// hoursParada planeja as horas parada da tag de status em [start, end], descontando excluded.
+func (b *telemetryBatch) hoursParada(assetID uuid.UUID, metricKey string, start, end time.Time, excluded []timeRange) *telemetryRead {
+	return b.add(assetID, metricKey, &telemetryRead{kind: readParada, start: start, end: end, excluded: excluded})
+}
+
+// run executa todas as leituras planejadas (lote vazio = nenhuma consulta).
+func (b *telemetryBatch) run(db *sql.DB) error {
+	if len(b.order) == 0 {
+		return nil
+	}
+	assets := make([]string, len(b.order))
+	metrics := make([]string, len(b.order))
+	for i, k := range b.order {
+		assets[i], metrics[i] = k.asset.String(), k.metric
+	}
+	configs, err := b.counterConfigs(db, assets)
+	if err != nil {
+		return err
+	}
+	for _, k := range b.order {
+		b.begin(k, configs[k])
+	}
+	for _, w := range b.windows() {
+		if err := b.runWindow(db, assets, metrics, w); err != nil {
+			return err
+		}
+	}
+	for _, k := range b.order {
+		b.finish(k)
+	}
+	return nil
+}
+
+// runWindow lê as séries do lote em [w.Start, w.End) e acumula cada leitura.
+func (b *telemetryBatch) runWindow(db *sql.DB, assets, metrics []string, w timeRange) error {
+	rows, err := db.Query(`
+		SELECT t.asset_id, t.metric_key, t.ts, t.metric_value
+		FROM nxd.telemetry_log t
+		JOIN unnest($1::uuid[], $2::text[]) AS k(asset_id, metric_key)
+			ON t.asset_id = k.asset_id AND t.metric_key = k.metric_key
+		WHERE t.ts >= $3 AND t.ts < $4
+		ORDER BY t.asset_id, t.metric_key, t.ts
+	`, pq.Array(assets), pq.Array(metrics), w.Start, w.End)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var k seriesKey
+		var s telemetrySample
+		if err := rows.Scan(&k.asset, &k.metric, &s.ts, &s.v); err != nil {
+			return err
+		}
+		for _, r := range b.reads[k] {
+			r.feed(s)
+		}
+	}
+	return rows.Err()
+}
+
+// windows une os intervalos lidos ([início, fim] de cada leitura, com o lookback
+// nos contadores) e os corta em janelas [Start, End) de até telemetryBatchWindow,
+// em ordem de tempo — cada série recebe as leituras em ordem de ts.
+func (b *telemetryBatch) windows() []timeRange {
+	var spans []timeRange
+	for _, k := range b.order {
+		for _, r := range b.reads[k] {
+			from := r.start
+			if r.kind == readCounter {
+				from = from.Add(-counterLookback)
+			}
+			// Fim inclusivo: a janela vai até o próximo microssegundo (resolução do Postgres).
+			spans = append(spans, timeRange{Start: from, End: r.end.Add(time.Microsecond)})
+		}
+	}
+	var out []timeRange
+	for _, m := range mergeRanges(spans) {
+		for from := m.Start; from.Before(m.End); from = from.Add(telemetryBatchWindow) {
+			to := from.Add(telemetryBatchWindow)
+			if to.After(m.End) {
+				to = m.End
+			}
+			out = append(out, timeRange{Start: from, End: to})
+		}
+	}
+	return out
+}
+
+// counterConfigs lê a configuração de contador das séries do lote (ausente = padrão).
+func (b *telemetryBatch) counterConfigs(db *sql.DB, assets []string) (map[seriesKey]CounterConfigRow, error) {
+	out := map[seriesKey]CounterConfigRow{}
+	for _, k := range b.order {
+		out[k] = CounterConfigRow{AssetID: k.asset, MetricKey: k.metric}
+	}
+	rows, err := db.Query(`
+		SELECT asset_id, metric_key, rollover_at, reset_tolerance FROM nxd.counter_config
+		WHERE asset_id = ANY($1::uuid[])
+	`, pq.Array(assets))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var c CounterConfigRow
+		var rollover sql.NullFloat64
+		if err := rows.Scan(&c.AssetID, &c.MetricKey, &rollover, &c.ResetTolerance); err != nil {
+			return nil, err
+		}
+		k := seriesKey{c.AssetID, c.MetricKey}
+		if _, ok := out[k]; !ok {
+			continue
+		}
+		if rollover.Valid {
+			c.RolloverAt = &rollover.Float64
+		}
+		out[k] = c
+	}
+	return out, rows.Err()
+}
+
+func (b *telemetryBatch) begin(k seriesKey, cfg CounterConfigRow) {
+	for _, r := range b.reads[k] {
+		r.begin(cfg)
+	}
+}
+
+func (b *telemetryBatch) finish(k seriesKey) {
+	for _, r := range b.reads[k] {
+		r.finish()
+	}
+}
+
+// serve resolve as leituras de uma série inteira (samples em ordem de ts).
+func (b *telemetryBatch) serve(k seriesKey, samples []telemetrySample, cfg CounterConfigRow) {
+	b.begin(k, cfg)
+	for _, s := range samples {
+		for _, r := range b.reads[k] {
+			r.feed(s)
+		}
+	}
+	b.finish(k)
+}
@@ -0,0 +1,209 @@
+package store
+
+// tenant_erasure.go — Exclusão dos dados de um tenant no schema nxd (LGPD)
+//
+// Chamado pelo workflow de exclusão do api/lgpd.go depois do prazo de carência.
+// O tenant é identificado pelo email do usuário NXD (mesma ligação usada por
+// getFactoryIDForUser). Cada tabela é apagada explicitamente — e não só via
+// ON DELETE CASCADE — para que o certificado traga a contagem por escopo e para
+// cobrir tabelas sem FK (telemetry_rollup_1m).
+//
+// Os arquivos no ArchiveStorage (telemetria fria e bundles de export) são
+// removidos ANTES da transação: se ela falhar, o retry encontra as linhas do
+// manifesto e repete a remoção (Delete é idempotente). A operação inteira pode
+// ser repetida com segurança.
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// ErasureItem é uma linha do relatório de exclusão (entra no certificado).
+type ErasureItem struct {
+	Scope  string `json:"scope"`
+	Action string `json:"action"` // deleted | anonymized
+	Rows   int64  `json:"rows"`
+}
+
+// TenantErasureResult resume o que foi removido do NXD.
+type TenantErasureResult struct {
+	UserFound      bool          `json:"user_found"`
+	FactoryIDs     []uuid.UUID   `json:"factory_ids"`
+	Items          []ErasureItem `json:"items"`
+	StorageObjects int           `json:"storage_objects_deleted"`
+}
+
+// EraseTenantData remove do schema nxd o usuário identificado por email, suas
+// fábricas e tudo que pertence a elas. Registros de auditoria de outras fábricas
+// em que o usuário aparece como ator são mantidos, mas anonimizados.
+func EraseTenantData(ctx context.Context, db *sql.DB, storage ArchiveStorage, email string) (*TenantErasureResult, error) {
+	if Driver() != "postgres" {
+		return nil, fmt.Errorf("exclusão de tenant no NXD exige Postgres")
+	}
+	res := &TenantErasureResult{}
+
+	var userID uuid.UUID
+	err := db.QueryRowContext(ctx, `SELECT id FROM nxd.users WHERE email = $1`, email).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return res, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	res.UserFound = true
+
+	rows, err := db.QueryContext(ctx, `SELECT id FROM nxd.factories WHERE user_id = $1`, userID)
+	if err != nil {
+		return nil, err
+	}
+	var ids []string
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		res.FactoryIDs = append(res.FactoryIDs, id)
+		ids = append(ids, id.String())
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	factories := pq.Array(ids)
+
+	// 1) Objetos no storage.
+	keys, err := tenantStorageKeys(ctx, db, factories)
+	if err != nil {
+		return nil, err
+	}
+	for _, k := range keys {
+		if err := storage.Delete(ctx, k); err != nil {
+			return nil, fmt.Errorf("storage %s: %w", k, err)
+		}
+	}
+	res.StorageObjects = len(keys)
+
+	// 2) Linhas, filhos antes dos pais.
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	const assetsOf = `SELECT id FROM nxd.assets WHERE factory_id::text = ANY($1)`
+	steps := []struct {
+		scope  string
+		action string
+		query  string
+	}{
+		{"nxd.telemetry_log", "deleted", `DELETE FROM nxd.telemetry_log WHERE factory_id::text = ANY($1)`},
+		{"nxd.telemetry_rollup_1m", "deleted", `DELETE FROM nxd.telemetry_rollup_1m WHERE factory_id::text = ANY($1)`},
+		{"nxd.rollup_ranges", "deleted", `DELETE FROM nxd.rollup_ranges WHERE factory_id::text = ANY($1)`},
+		{"nxd.asset_telemetry", "deleted", `DELETE FROM nxd.asset_telemetry WHERE asset_id IN (` + assetsOf + `)`},
+		{"nxd.alerts", "deleted", `DELETE FROM nxd.alerts WHERE asset_id IN (` + assetsOf + `)
+			OR rule_id IN (SELECT id FROM nxd.alert_rules WHERE factory_id::text = ANY($1))`},
+		{"nxd.alert_rules", "deleted", `DELETE FROM nxd.alert_rules WHERE factory_id::text = ANY($1)`},
+		{"nxd.asset_metric_catalog", "deleted", `DELETE FROM nxd.asset_metric_catalog WHERE factory_id::text = ANY($1)`},
+		{"nxd.virtual_metric_state", "deleted", `DELETE FROM nxd.virtual_metric_state WHERE asset_id IN (` + assetsOf + `)`},
+		{"nxd.virtual_metrics", "deleted", `DELETE FROM nxd.virtual_metrics WHERE factory_id::text = ANY($1)`},
+		{"nxd.energy_tariff_periods", "deleted", `DELETE FROM nxd.energy_tariff_periods
+			WHERE tariff_id IN (SELECT id FROM nxd.energy_tariffs WHERE factory_id::text = ANY($1))`},
+		{"nxd.energy_tariffs", "deleted", `DELETE FROM nxd.energy_tariffs WHERE factory_id::text = ANY($1)`},
+		{"nxd.energy_meters", "deleted", `DELETE FROM nxd.energy_meters WHERE factory_id::text = ANY($1)`},
+		{"nxd.emission_factors", "deleted", `DELETE FROM nxd.emission_factors WHERE factory_id::text = ANY($1)`},
+		{"nxd.cost_parameters", "deleted", `DELETE FROM nxd.cost_parameters WHERE factory_id::text = ANY($1)`},
+		{"nxd.exchange_rates", "deleted", `DELETE FROM nxd.exchange_rates WHERE factory_id::text = ANY($1)`},
+		{"nxd.benchmark_snapshots", "deleted", `DELETE FROM nxd.benchmark_snapshots WHERE factory_id::text = ANY($1)`},
+		{"nxd.financial_scenarios", "deleted", `DELETE FROM nxd.financial_scenarios WHERE factory_id::text = ANY($1)`},
+		{"nxd.counter_config", "deleted", `DELETE FROM nxd.counter_config WHERE factory_id::text = ANY($1)`},
+		{"nxd.tag_mapping", "deleted", `DELETE FROM nxd.tag_mapping WHERE asset_id IN (` + assetsOf + `)`},
+		{"nxd.business_config", "deleted", `DELETE FROM nxd.business_config WHERE factory_id::text = ANY($1)`},
+		{"nxd.import_jobs", "deleted", `DELETE FROM nxd.import_jobs WHERE factory_id::text = ANY($1)`},
+		{"nxd.export_jobs", "deleted", `DELETE FROM nxd.export_jobs WHERE factory_id::text = ANY($1)`},
+		{"nxd.telemetry_archives", "deleted", `DELETE FROM nxd.telemetry_archives WHERE factory_id::text = ANY($1)`},
+		{"nxd.production_targets", "deleted", `DELETE FROM nxd.production_targets WHERE factory_id::text = ANY($1)`},
+		{"nxd.asset_health", "deleted", `DELETE FROM nxd.asset_health WHERE factory_id::text = ANY($1)`},
+		{"nxd.maintenance_events", "deleted", `DELETE FROM nxd.maintenance_events WHERE factory_id::text = ANY($1)`},
+		{"nxd.health_tags", "deleted", `DELETE FROM nxd.health_tags WHERE factory_id::text = ANY($1)`},
+		{"nxd.health_models", "deleted", `DELETE FROM nxd.health_models WHERE factory_id::text = ANY($1)`},
+		{"nxd.annotations", "deleted", `DELETE FROM nxd.annotations WHERE factory_id::text = ANY($1)`},
+		{"nxd.inspection_attachments", "deleted", `DELETE FROM nxd.inspection_attachments
+			WHERE inspection_id IN (SELECT id FROM nxd.inspections WHERE factory_id::text = ANY($1))`},
+		{"nxd.inspections", "deleted", `DELETE FROM nxd.inspections WHERE factory_id::text = ANY($1)`},
+		{"nxd.defect_types", "deleted", `DELETE FROM nxd.defect_types WHERE factory_id::text = ANY($1)`},
+		{"nxd.forecast_points", "deleted", `DELETE FROM nxd.forecast_points
+			WHERE forecast_id IN (SELECT id FROM nxd.forecasts WHERE factory_id::text = ANY($1))`},
+		{"nxd.forecasts", "deleted", `DELETE FROM nxd.forecasts WHERE factory_id::text = ANY($1)`},
+		{"nxd.forecast_series", "deleted", `DELETE FROM nxd.forecast_series WHERE factory_id::text = ANY($1)`},
+		{"nxd.cycle_time_stats", "deleted", `DELETE FROM nxd.cycle_time_stats WHERE factory_id::text = ANY($1)`},
+		{"nxd.cycle_cursor", "deleted", `DELETE FROM nxd.cycle_cursor WHERE asset_id IN (` + assetsOf + `)`},
+		{"nxd.production_orders", "deleted", `DELETE FROM nxd.production_orders WHERE factory_id::text = ANY($1)`},
+		{"nxd.production_order_cursor", "deleted", `DELETE FROM nxd.production_order_cursor WHERE asset_id IN (` + assetsOf + `)`},
+		{"nxd.downtime_events", "deleted", `DELETE FROM nxd.downtime_events WHERE factory_id::text = ANY($1)`},
+		{"nxd.downtime_cursor", "deleted", `DELETE FROM nxd.downtime_cursor WHERE asset_id IN (` + assetsOf + `)`},
+		{"nxd.downtime_reasons", "deleted", `DELETE FROM nxd.downtime_reasons WHERE factory_id::text = ANY($1)`},
+		{"nxd.planned_downtime", "deleted", `DELETE FROM nxd.planned_downtime WHERE factory_id::text = ANY($1)`},
+		{"nxd.shifts", "deleted", `DELETE FROM nxd.shifts WHERE factory_id::text = ANY($1)`},
+		{"nxd.calendar_exceptions", "deleted", `DELETE FROM nxd.calendar_exceptions WHERE factory_id::text = ANY($1)`},
+		{"nxd.report_runs", "deleted", `DELETE FROM nxd.report_runs WHERE factory_id::text = ANY($1)`},
+		// Log de ingest da fábrica: contém API key, device_id e IP.
+		{"nxd.audit_log", "deleted", `DELETE FROM nxd.audit_log WHERE factory_id::text = ANY($1)`},
+		{"nxd.assets", "deleted", `DELETE FROM nxd.assets WHERE factory_id::text = ANY($1)`},
+		{"nxd.sectors", "deleted", `DELETE FROM nxd.sectors WHERE factory_id::text = ANY($1)`},
+		{"nxd.factories", "deleted", `DELETE FROM nxd.factories WHERE id::text = ANY($1)`},
+	}
+	for _, s := range steps {
+		r, err := tx.ExecContext(ctx, s.query, factories)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", s.scope, err)
+		}
+		n, _ := r.RowsAffected()
+		res.Items = append(res.Items, ErasureItem{Scope: s.scope, Action: s.action, Rows: n})
+	}
+
+	r, err := tx.ExecContext(ctx,
+		`UPDATE nxd.audit_log SET actor_user_id = NULL, ip_address = NULL WHERE actor_user_id = $1`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("nxd.audit_log: %w", err)
+	}
+	n, _ := r.RowsAffected()
+	res.Items = append(res.Items, ErasureItem{Scope: "nxd.audit_log", Action: "anonymized", Rows: n})
+
+	r, err = tx.ExecContext(ctx, `DELETE FROM nxd.users WHERE id = $1`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("nxd.users: %w", err)
+	}
+	n, _ = r.RowsAffected()
+	res.Items = append(res.Items, ErasureItem{Scope: "nxd.users", Action: "deleted", Rows: n})
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// tenantStorageKeys lista os objetos do storage que pertencem às fábricas.
+func tenantStorageKeys(ctx context.Context, db *sql.DB, factories interface{}) ([]string, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT object_key FROM nxd.telemetry_archives WHERE factory_id::text = ANY($1) AND object_key IS NOT NULL
+		UNION
+		SELECT object_key FROM nxd.export_jobs WHERE factory_id::text = ANY($1) AND object_key IS NOT NULL`, factories)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var keys []string
+	for rows.Next() {
+		var k string
+		if err := rows.Scan(&k); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+	return keys, rows.Err()
+}
@@ -0,0 +1,525 @@
+package store
+
+// virtual_expr.go — Linguagem de expressões das métricas virtuais
+//
+// Gramática (precedência crescente):
+//   expr    = or
+//   or      = and { "||" and }
+//   and     = cmp { "&&" cmp }
+//   cmp     = sum [ ("<" | "<=" | ">" | ">=" | "==" | "!=") sum ]
+//   sum     = prod { ("+" | "-") prod }
+//   prod    = unary { ("*" | "/" | "%") unary }
+//   unary   = ("-" | "!") unary | primary
+//   primary = número | metric_key | "metric key entre aspas" | func "(" args ")" | "(" expr ")"
+//
+// Funções: min(a, b, ...), max(a, b, ...), abs(x), if(cond, a, b),
+// integrate(x [, unidade_s]) e derivative(x [, unidade_s]). Comparações e
+// lógicos retornam 1/0; condição verdadeira = diferente de 0.
+//
+// integrate/derivative são com estado (exprState): integrate soma a área pela
+// regra do trapézio entre leituras (ex.: integrate(Running, 3600) = horas
+// rodando; integrate(Potencia_kW, 3600) = kWh); derivative é a variação por
+// unidade de tempo. Intervalos maiores que virtualMaxGap (CLP offline) não
+// entram na integral e reiniciam a derivada.
+//
+// Não há acesso a nada além das métricas do ativo: sem variáveis, laços ou
+// chamadas externas. Tamanho e profundidade são limitados na compilação.
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	virtualMaxExprLen  = 1000
+	virtualMaxDepth    = 32
+	virtualMaxNodes    = 200
+	virtualMaxStateful = 8
+	virtualMaxGap      = 15 * time.Minute
+)
+
+// ErrInvalidExpression — erro de sintaxe ou de validação da expressão.
+var ErrInvalidExpression = errors.New("expressão inválida")
+
+type exprKind int
+
+const (
+	exprNum exprKind = iota
+	exprVar
+	exprUnary
+	exprBinary
+	exprCall
+)
+
+type exprNode struct {
+	kind  exprKind
+	num   float64
+	name  string // variável, operador ou função
+	args  []*exprNode
+	state int // índice do estado (integrate/derivative)
+}
+
+// Expr é uma expressão compilada; seguro para uso concorrente (o estado fica em exprState).
+type Expr struct {
+	root     *exprNode
+	vars     []string
+	stateful int
+}
+
+// Vars retorna as métricas referenciadas, sem repetição, na ordem em que aparecem.
+func (e *Expr) Vars() []string { return e.vars }
+
+// exprStepState — estado de um integrate/derivative entre avaliações.
+type exprStepState struct {
+	Ts  time.Time `json:"ts"`
+	X   float64   `json:"x"`
+	Acc float64   `json:"acc,omitempty"`
+}
+
+// exprState guarda o estado dos nós com memória, por índice.
+type exprState struct {
+	Steps map[int]*exprStepState `json:"steps,omitempty"`
+}
+
+var exprFuncs = map[string][2]int{ // aridade mínima e máxima (-1 = sem limite)
+	"min":        {1, -1},
+	"max":        {1, -1},
+	"abs":        {1, 1},
+	"if":         {3, 3},
+	"integrate":  {1, 2},
+	"derivative": {1, 2},
+}
+
+// CompileExpr valida e compila uma expressão.
+func CompileExpr(src string) (*Expr, error) {
+	if strings.TrimSpace(src) == "" {
+		return nil, fmt.Errorf("%w: vazia", ErrInvalidExpression)
+	}
+	if len(src) > virtualMaxExprLen {
+		return nil, fmt.Errorf("%w: máximo %d caracteres", ErrInvalidExpression, virtualMaxExprLen)
+	}
+	toks, err := lexExpr(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &exprParser{toks: toks, seen: map[string]bool{}}
+	root, err := p.parseOr(0)
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.toks) {
+		return nil, fmt.Errorf("%w: %q inesperado", ErrInvalidExpression, p.toks[p.pos].text)
+	}
+	if p.stateful > virtualMaxStateful {
+		return nil, fmt.Errorf("%w: máximo %d integrate/derivative", ErrInvalidExpression, virtualMaxStateful)
+	}
+	return &Expr{root: root, vars: p.vars, stateful: p.stateful}, nil
+}
+
+// ─── Léxico ────────────────────────────────────────────────────────────────
+
+type exprTokKind int
+
+const (
+	tokNum exprTokKind = iota
+	tokIdent
+	tokOp
+)
+
+type exprTok struct {
+	kind exprTokKind
+	text string
+	num  float64
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isIdentPart(c byte) bool {
+	return isIdentStart(c) || (c >= '0' && c <= '9') || c == '.'
+}
+
+func lexExpr(src string) ([]exprTok, error) {
+	var toks []exprTok
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case (c >= '0' && c <= '9') || (c == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9'):
+			j := i
+			for j < len(src) && ((src[j] >= '0' && src[j] <= '9') || src[j] == '.') {
+				j++
+			}
+			if j < len(src) && (src[j] == 'e' || src[j] == 'E') {
+				j++
+				if j < len(src) && (src[j] == '+' || src[j] == '-') {
+					j++
+				}
+				for j < len(src) && src[j] >= '0' && src[j] <= '9' {
+					j++
+				}
+			}
+			v, err := strconv.ParseFloat(src[i:j], 64)
+			if err != nil {
+				return nil, fmt.Errorf("%w: número %q", ErrInvalidExpression, src[i:j])
+			}
+			toks = append(toks, exprTok{kind: tokNum, text: src[i:j], num: v})
+			i = j
+		case isIdentStart(c):
+			j := i
+			for j < len(src) && isIdentPart(src[j]) {
+				j++
+			}
+			toks = append(toks, exprTok{kind: tokIdent, text: src[i:j]})
+			i = j
+		case c == '"':
+			// metric_key com espaços ou acentos: "Temperatura Óleo"
+			j := strings.IndexByte(src[i+1:], '"')
+			if j < 0 {
+				return nil, fmt.Errorf("%w: aspas não fechadas", ErrInvalidExpression)
+			}
+			name := src[i+1 : i+1+j]
+			if strings.TrimSpace(name) == "" {
+				return nil, fmt.Errorf("%w: nome de métrica vazio", ErrInvalidExpression)
+			}
+			toks = append(toks, exprTok{kind: tokIdent, text: name, num: 1}) // num=1: entre aspas, nunca é função
+			i += j + 2
+		default:
+			op := string(c)
+			if i+1 < len(src) {
+				switch two := src[i : i+2]; two {
+				case "<=", ">=", "==", "!=", "&&", "||":
+					op = two
+				}
+			}
+			if !strings.Contains("+-*/%()<>!,", op) && len(op) == 1 {
+				return nil, fmt.Errorf("%w: caractere %q", ErrInvalidExpression, c)
+			}
+			toks = append(toks, exprTok{kind: tokOp, text: op})
+			i += len(op)
+		}
+	}
+	return toks, nil
+}
+
+// ─── Sintaxe ───────────────────────────────────────────────────────────────
+
+type exprParser struct {
+	toks     []exprTok
+	pos      int
+	nodes    int
+	stateful int
+	vars     []string
+	seen     map[string]bool
+}
+
+func (p *exprParser) peekOp(ops ...string) string {
+	if p.pos >= len(p.toks) || p.toks[p.pos].kind != tokOp {
+		return ""
+	}
+	for _, op := range ops {
+		if p.toks[p.pos].text == op {
+			return op
+		}
+	}
+	return ""
+}
+
+func (p *exprParser) node(n *exprNode, depth int) (*exprNode, error) {
+	p.nodes++
+	if p.nodes > virtualMaxNodes {
+		return nil, fmt.Errorf("%w: expressão grande demais", ErrInvalidExpression)
+	}
+	if depth > virtualMaxDepth {
+		return nil, fmt.Errorf("%w: aninhamento profundo demais", ErrInvalidExpression)
+	}
+	return n, nil
+}
+
+// binaryLevel analisa um nível de operadores binários associativos à esquerda.
+func (p *exprParser) binaryLevel(depth int, next func(int) (*exprNode, error), ops ...string) (*exprNode, error) {
+	left, err := next(depth)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		op := p.peekOp(ops...)
+		if op == "" {
+			return left, nil
+		}
+		p.pos++
+		right, err := next(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if left, err = p.node(&exprNode{kind: exprBinary, name: op, args: []*exprNode{left, right}}, depth); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func (p *exprParser) parseOr(depth int) (*exprNode, error) {
+	return p.binaryLevel(depth, p.parseAnd, "||")
+}
+
+func (p *exprParser) parseAnd(depth int) (*exprNode, error) {
+	return p.binaryLevel(depth, p.parseCmp, "&&")
+}
+
+func (p *exprParser) parseCmp(depth int) (*exprNode, error) {
+	left, err := p.parseSum(depth)
+	if err != nil {
+		return nil, err
+	}
+	if op := p.peekOp("<", "<=", ">", ">=", "==", "!="); op != "" {
+		p.pos++
+		right, err := p.parseSum(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return p.node(&exprNode{kind: exprBinary, name: op, args: []*exprNode{left, right}}, depth)
+	}
+	return left, nil
+}
+
+func (p *exprParser) parseSum(depth int) (*exprNode, error) {
+	return p.binaryLevel(depth, p.parseProd, "+", "-")
+}
+
+func (p *exprParser) parseProd(depth int) (*exprNode, error) {
+	return p.binaryLevel(depth, p.parseUnary, "*", "/", "%")
+}
+
+func (p *exprParser) parseUnary(depth int) (*exprNode, error) {
+	if op := p.peekOp("-", "!"); op != "" {
+		p.pos++
+		x, err := p.parseUnary(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		return p.node(&exprNode{kind: exprUnary, name: op, args: []*exprNode{x}}, depth)
+	}
+	return p.parsePrimary(depth)
+}
+
+func (p *exprParser) parsePrimary(depth int) (*exprNode, error) {
+	if p.pos >= len(p.toks) {
+		return nil, fmt.Errorf("%w: fim inesperado", ErrInvalidExpression)
+	}
+	t := p.toks[p.pos]
+	p.pos++
+	switch t.kind {
+	case tokNum:
+		return p.node(&exprNode{kind: exprNum, num: t.num}, depth)
+	case tokIdent:
+		if arity, isFunc := exprFuncs[strings.ToLower(t.text)]; isFunc && t.num == 0 && p.peekOp("(") != "" {
+			return p.parseCall(strings.ToLower(t.text), arity, depth)
+		}
+		if !p.seen[t.text] {
+			p.seen[t.text] = true
+			p.vars = append(p.vars, t.text)
+		}
+		return p.node(&exprNode{kind: exprVar, name: t.text}, depth)
+	}
+	if t.text == "(" {
+		x, err := p.parseOr(depth + 1)
+		if err != nil {
+			return nil, err
+		}
+		if p.peekOp(")") == "" {
+			return nil, fmt.Errorf("%w: falta ')'", ErrInvalidExpression)
+		}
+		p.pos++
+		return x, nil
+	}
+	return nil, fmt.Errorf("%w: %q inesperado", ErrInvalidExpression, t.text)
+}
+
+func (p *exprParser) parseCall(name string, arity [2]int, depth int) (*exprNode, error) {
+	p.pos++ // "("
+	n := &exprNode{kind: exprCall, name: name}
+	if p.peekOp(")") == "" {
+		for {
+			arg, err := p.parseOr(depth + 1)
+			if err != nil {
+				return nil, err
+			}
+			n.args = append(n.args, arg)
+			if p.peekOp(",") == "" {
+				break
+			}
+			p.pos++
+		}
+	}
+	if p.peekOp(")") == "" {
+		return nil, fmt.Errorf("%w: falta ')' em %s", ErrInvalidExpression, name)
+	}
+	p.pos++
+	if len(n.args) < arity[0] || (arity[1] >= 0 && len(n.args) > arity[1]) {
+		return nil, fmt.Errorf("%w: número de argumentos de %s", ErrInvalidExpression, name)
+	}
+	if name == "integrate" || name == "derivative" {
+		if len(n.args) == 2 && (n.args[1].kind != exprNum || n.args[1].num <= 0) {
+			return nil, fmt.Errorf("%w: unidade de %s deve ser um número positivo (segundos)", ErrInvalidExpression, name)
+		}
+		n.state = p.stateful
+		p.stateful++
+	}
+	return p.node(n, depth)
+}
+
+// ─── Avaliação ─────────────────────────────────────────────────────────────
+
+// Eval avalia a expressão no instante ts. ok=false quando falta uma métrica,
+// há divisão por zero, o resultado não é finito ou a derivada ainda não tem
+// leitura anterior. O estado é atualizado mesmo quando o resultado final não sai.
+func (e *Expr) Eval(vars map[string]float64, ts time.Time, st *exprState) (float64, bool) {
+	if st.Steps == nil {
+		st.Steps = map[int]*exprStepState{}
+	}
+	v, ok := e.eval(e.root, vars, ts, st)
+	if !ok || math.IsNaN(v) || math.IsInf(v, 0) {
+		return 0, false
+	}
+	return v, true
+}
+
+func truth(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func (e *Expr) eval(n *exprNode, vars map[string]float64, ts time.Time, st *exprState) (float64, bool) {
+	switch n.kind {
+	case exprNum:
+		return n.num, true
+	case exprVar:
+		v, ok := vars[n.name]
+		return v, ok
+	case exprUnary:
+		x, ok := e.eval(n.args[0], vars, ts, st)
+		if !ok {
+			return 0, false
+		}
+		if n.name == "!" {
+			return truth(x == 0), true
+		}
+		return -x, true
+	case exprBinary:
+		a, okA := e.eval(n.args[0], vars, ts, st)
+		b, okB := e.eval(n.args[1], vars, ts, st)
+		if !okA || !okB {
+			return 0, false
+		}
+		switch n.name {
+		case "+":
+			return a + b, true
+		case "-":
+			return a - b, true
+		case "*":
+			return a * b, true
+		case "/":
+			if b == 0 {
+				return 0, false
+			}
+			return a / b, true
+		case "%":
+			if b == 0 {
+				return 0, false
+			}
+			return math.Mod(a, b), true
+		case "<":
+			return truth(a < b), true
+		case "<=":
+			return truth(a <= b), true
+		case ">":
+			return truth(a > b), true
+		case ">=":
+			return truth(a >= b), true
+		case "==":
+			return truth(a == b), true
+		case "!=":
+			return truth(a != b), true
+		case "&&":
+			return truth(a != 0 && b != 0), true
+		case "||":
+			return truth(a != 0 || b != 0), true
+		}
+	case exprCall:
+		return e.call(n, vars, ts, st)
+	}
+	return 0, false
+}
+
+func (e *Expr) call(n *exprNode, vars map[string]float64, ts time.Time, st *exprState) (float64, bool) {
+	switch n.name {
+	case "if":
+		// Os dois ramos são avaliados para manter o estado de integrate/derivative em dia.
+		c, okC := e.eval(n.args[0], vars, ts, st)
+		a, okA := e.eval(n.args[1], vars, ts, st)
+		b, okB := e.eval(n.args[2], vars, ts, st)
+		if !okC {
+			return 0, false
+		}
+		if c != 0 {
+			return a, okA
+		}
+		return b, okB
+	case "min", "max":
+		var out float64
+		for i, arg := range n.args {
+			v, ok := e.eval(arg, vars, ts, st)
+			if !ok {
+				return 0, false
+			}
+			if i == 0 || (n.name == "min" && v < out) || (n.name == "max" && v > out) {
+				out = v
+			}
+		}
+		return out, true
+	case "abs":
+		x, ok := e.eval(n.args[0], vars, ts, st)
+		return math.Abs(x), ok
+	case "integrate", "derivative":
+		x, ok := e.eval(n.args[0], vars, ts, st)
+		if !ok {
+			return 0, false
+		}
+		unit := 1.0
+		if len(n.args) == 2 {
+			unit = n.args[1].num
+		}
+		prev := st.Steps[n.state]
+		if prev == nil {
+			st.Steps[n.state] = &exprStepState{Ts: ts, X: x}
+			return 0, n.name == "integrate"
+		}
+		dt := ts.Sub(prev.Ts)
+		if dt <= 0 {
+			// Leitura repetida ou fora de ordem: não altera o estado.
+			if n.name == "integrate" {
+				return prev.Acc, true
+			}
+			return 0, false
+		}
+		cur := &exprStepState{Ts: ts, X: x, Acc: prev.Acc}
+		st.Steps[n.state] = cur
+		if dt > virtualMaxGap {
+			return cur.Acc, n.name == "integrate"
+		}
+		if n.name == "integrate" {
+			cur.Acc += (prev.X + x) / 2 * dt.Seconds() / unit
+			return cur.Acc, true
+		}
+		return (x - prev.X) / dt.Seconds() * unit, true
+	}
+	return 0, false
+}
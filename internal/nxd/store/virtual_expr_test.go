@@ -0,0 +1,122 @@
+package store
+
+import (
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestCompileExprEval(t *testing.T) {
+	vars := map[string]float64{"a": 2, "b": 5, "Pressao.Entrada": 7.5, "Temperatura Óleo": 60}
+	cases := map[string]float64{
+		"1 + 2 * 3":                       7,
+		"(1 + 2) * 3":                     9,
+		"-a + b % 3":                      0,
+		"b / a":                           2.5,
+		"Pressao.Entrada - a":             5.5,
+		`"Temperatura Óleo" / 2`:          30,
+		"min(a, b, 1)":                    1,
+		"max(a, b) - abs(-3)":             2,
+		"if(a > 1 && b <= 5, 10, 20)":     10,
+		"if(!(a == 2) || b != 5, 10, 20)": 20,
+		"1.5e2 + .5":                      150.5,
+	}
+	for src, want := range cases {
+		e, err := CompileExpr(src)
+		if err != nil {
+			t.Errorf("%s: %v", src, err)
+			continue
+		}
+		if got, ok := e.Eval(vars, time.Now(), &exprState{}); !ok || got != want {
+			t.Errorf("%s = %v (%v), want %v", src, got, ok, want)
+		}
+	}
+	e, _ := CompileExpr("a / (b - 5)")
+	if _, ok := e.Eval(vars, time.Now(), &exprState{}); ok {
+		t.Error("division by zero must not produce a value")
+	}
+	e, _ = CompileExpr("a + faltando")
+	if _, ok := e.Eval(vars, time.Now(), &exprState{}); ok {
+		t.Error("missing metric must not produce a value")
+	}
+	if got := e.Vars(); len(got) != 2 || got[0] != "a" || got[1] != "faltando" {
+		t.Errorf("Vars = %v", got)
+	}
+	for _, bad := range []string{"", "1 +", "foo(1)", "min()", "if(1, 2)", "a = 1", "integrate(a, b)", `"x`, "(1 + 2"} {
+		if _, err := CompileExpr(bad); !errors.Is(err, ErrInvalidExpression) {
+			t.Errorf("%q: err = %v, want ErrInvalidExpression", bad, err)
+		}
+	}
+}
+
+func TestExprIntegrateDerivative(t *testing.T) {
+	t0 := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	run, _ := CompileExpr("integrate(Running, 3600)")
+	der, _ := CompileExpr("derivative(Contador, 60)")
+	var sr, sd exprState
+	steps := []struct {
+		min        int
+		running    float64
+		contador   float64
+		hours      float64
+		perMin     float64
+		derivative bool
+	}{
+		{0, 1, 100, 0, 0, false},
+		{6, 1, 130, 0.1, 5, true},    // 6 min rodando; 30 peças em 6 min
+		{12, 0, 130, 0.15, 0, true},  // trapézio 1→0: meio intervalo
+		{60, 1, 200, 0.15, 0, false}, // intervalo > virtualMaxGap: não integra, derivada reinicia
+		{66, 1, 206, 0.25, 1, true},
+	}
+	for _, s := range steps {
+		ts := t0.Add(time.Duration(s.min) * time.Minute)
+		h, ok := run.Eval(map[string]float64{"Running": s.running}, ts, &sr)
+		if !ok || math.Abs(h-s.hours) > 1e-9 {
+			t.Errorf("min %d: integrate = %v (%v), want %v", s.min, h, ok, s.hours)
+		}
+		d, ok := der.Eval(map[string]float64{"Contador": s.contador}, ts, &sd)
+		if ok != s.derivative || (ok && math.Abs(d-s.perMin) > 1e-9) {
+			t.Errorf("min %d: derivative = %v (%v), want %v (%v)", s.min, d, ok, s.perMin, s.derivative)
+		}
+	}
+}
+
+func TestVirtualMetricsResolveAndStep(t *testing.T) {
+	asset, sector := uuid.New(), uuid.New()
+	def := func(key, expr string, assetID, sectorID *uuid.UUID) VirtualMetricRow {
+		return VirtualMetricRow{ID: uuid.New(), MetricKey: key, Expression: expr, AssetID: assetID, SectorID: sectorID, Mode: "ingest", Active: true}
+	}
+	other := uuid.New()
+	defs := resolveVirtualMetrics([]VirtualMetricRow{
+		def("kwh_por_peca", "energia_delta / pecas", nil, nil),
+		def("energia_delta", "energia * 2", nil, &sector), // fábrica perde para o setor
+		def("energia_delta", "energia", nil, nil),
+		def("outro_ativo", "energia", &other, nil),
+		def("ciclo_a", "ciclo_b + 1", nil, nil),
+		def("ciclo_b", "ciclo_a + 1", nil, nil),
+	}, asset, &sector)
+	if len(defs) != 2 || defs[0].MetricKey != "energia_delta" || defs[0].Expression != "energia * 2" || defs[1].MetricKey != "kwh_por_peca" {
+		t.Fatalf("resolve = %+v", defs)
+	}
+
+	t0 := time.Date(2024, 3, 1, 8, 0, 0, 0, time.UTC)
+	states := map[uuid.UUID]*virtualState{}
+	out := evalVirtualStep(defs, states, map[string]float64{"energia": 3, "pecas": 2}, t0)
+	if len(out) != 2 || out[1].MetricValue != 3 || out[1].Status != "VIRTUAL" {
+		t.Fatalf("step 1 = %+v", out)
+	}
+	// pecas chega em outro payload: energia é retida até virtualMaxGap.
+	out = evalVirtualStep(defs, states, map[string]float64{"pecas": 4}, t0.Add(time.Minute))
+	if len(out) != 1 || out[0].MetricKey != "kwh_por_peca" || out[0].MetricValue != 1.5 {
+		t.Fatalf("step 2 = %+v", out)
+	}
+	if out = evalVirtualStep(defs, states, map[string]float64{"pecas": 4}, t0.Add(time.Hour)); len(out) != 0 {
+		t.Errorf("stale input must not be held: %+v", out)
+	}
+	if !virtualKeyInCycle([]VirtualMetricRow{def("x", "y + 1", nil, nil), def("y", "x", nil, nil)}, "x") {
+		t.Error("cycle not detected")
+	}
+}
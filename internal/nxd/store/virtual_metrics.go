@@ -0,0 +1,638 @@
+package store
+
+// virtual_metrics.go — Métricas virtuais (fórmulas sobre metric_keys existentes)
+//
+// Uma métrica virtual vale para um ativo, para os ativos de um setor ou para a
+// fábrica inteira (asset_id e sector_id nulos); se a mesma metric_key existir em
+// mais de um nível, vale a mais específica (ativo > setor > fábrica). A expressão
+// (virtual_expr.go) pode usar tags reais e outras métricas virtuais do ativo;
+// ciclos são recusados na criação.
+//
+// mode=ingest: avaliada a cada ingest com as leituras do payload (mais a última
+// leitura de cada entrada até virtualMaxGap, para tags que chegam em payloads
+// separados) e gravada em telemetry_log com status VIRTUAL — alertas, gráficos,
+// mapeamento financeiro e OEE a enxergam como uma tag real. O estado de
+// integrate/derivative fica em nxd.virtual_metric_state.
+// mode=query: calculada na consulta do histórico a partir das entradas do
+// período (integrate começa do zero no início do período).
+//
+// As duas aparecem em asset_metric_catalog (virtual_metric_id preenchido).
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const virtualMaxInputPoints = 50000
+
+// VirtualMetricRow — definição de uma métrica virtual.
+type VirtualMetricRow struct {
+	ID          uuid.UUID  `json:"id"`
+	FactoryID   uuid.UUID  `json:"factory_id"`
+	SectorID    *uuid.UUID `json:"sector_id,omitempty"`
+	AssetID     *uuid.UUID `json:"asset_id,omitempty"`
+	MetricKey   string     `json:"metric_key"`
+	Expression  string     `json:"expression"`
+	Unit        string     `json:"unit,omitempty"`
+	Description string     `json:"description,omitempty"`
+	Mode        string     `json:"mode"` // ingest | query
+	Active      bool       `json:"active"`
+	CreatedBy   *int64     `json:"created_by,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+var (
+	ErrVirtualMetricConflict = errors.New("metric_key já usada por uma tag ou por outra métrica virtual no mesmo escopo")
+	ErrVirtualMetricCycle    = errors.New("a expressão referencia a própria métrica (direta ou indiretamente)")
+)
+
+const virtualMetricColumns = `id, factory_id, sector_id, asset_id, metric_key, expression, COALESCE(unit, ''),
+	COALESCE(description, ''), mode, active, created_by, created_at, updated_at`
+
+func scanVirtualMetric(sc interface{ Scan(...interface{}) error }) (VirtualMetricRow, error) {
+	var r VirtualMetricRow
+	var sectorID, assetID uuid.NullUUID
+	var createdBy sql.NullInt64
+	err := sc.Scan(&r.ID, &r.FactoryID, &sectorID, &assetID, &r.MetricKey, &r.Expression, &r.Unit,
+		&r.Description, &r.Mode, &r.Active, &createdBy, &r.CreatedAt, &r.UpdatedAt)
+	if sectorID.Valid {
+		r.SectorID = &sectorID.UUID
+	}
+	if assetID.Valid {
+		r.AssetID = &assetID.UUID
+	}
+	if createdBy.Valid {
+		r.CreatedBy = &createdBy.Int64
+	}
+	return r, err
+}
+
+// ListVirtualMetrics retorna as métricas virtuais da fábrica.
+func ListVirtualMetrics(db *sql.DB, factoryID uuid.UUID) ([]VirtualMetricRow, error) {
+	rows, err := db.Query(`SELECT `+virtualMetricColumns+` FROM nxd.virtual_metrics WHERE factory_id = $1 ORDER BY metric_key, created_at`, factoryID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var list []VirtualMetricRow
+	for rows.Next() {
+		r, err := scanVirtualMetric(rows)
+		if err != nil {
+			return nil, err
+		}
+		list = append(list, r)
+	}
+	return list, rows.Err()
+}
+
+// GetVirtualMetric retorna uma métrica virtual da fábrica (nil se não existir).
+func GetVirtualMetric(db *sql.DB, factoryID, id uuid.UUID) (*VirtualMetricRow, error) {
+	r, err := scanVirtualMetric(db.QueryRow(`SELECT `+virtualMetricColumns+` FROM nxd.virtual_metrics WHERE id = $1 AND factory_id = $2`, id, factoryID))
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &r, nil
+}
+
+// validateVirtualMetric normaliza e valida a definição: expressão, modo, ciclos
+// entre métricas virtuais e colisão com tags reais do escopo.
+func validateVirtualMetric(db *sql.DB, r *VirtualMetricRow) error {
+	r.MetricKey = strings.TrimSpace(r.MetricKey)
+	if r.MetricKey == "" || len(r.MetricKey) > 128 {
+		return fmt.Errorf("%w: metric_key obrigatória (máx. 128 caracteres)", ErrInvalidExpression)
+	}
+	if r.Mode == "" {
+		r.Mode = "ingest"
+	}
+	if r.Mode != "ingest" && r.Mode != "query" {
+		return fmt.Errorf("%w: mode deve ser ingest ou query", ErrInvalidExpression)
+	}
+	if _, err := CompileExpr(r.Expression); err != nil {
+		return err
+	}
+	defs, err := ListVirtualMetrics(db, r.FactoryID)
+	if err != nil {
+		return err
+	}
+	// O grafo é por metric_key, sem olhar o escopo: conservador, mas simples de explicar.
+	replaced := false
+	for i := range defs {
+		if defs[i].ID == r.ID {
+			defs[i] = *r
+			replaced = true
+		}
+	}
+	if !replaced {
+		defs = append(defs, *r)
+	}
+	if virtualKeyInCycle(defs, r.MetricKey) {
+		return ErrVirtualMetricCycle
+	}
+	var taken bool
+	err = db.QueryRow(`
+		SELECT EXISTS (
+			SELECT 1 FROM nxd.asset_metric_catalog c
+			JOIN nxd.assets a ON a.id = c.asset_id
+			WHERE c.factory_id = $1 AND c.metric_key = $2 AND c.virtual_metric_id IS NULL
+			  AND ($3::uuid IS NULL OR a.id = $3) AND ($4::uuid IS NULL OR a.group_id = $4)
+		)`, r.FactoryID, r.MetricKey, r.AssetID, r.SectorID).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken {
+		return ErrVirtualMetricConflict
+	}
+	return nil
+}
+
+// virtualKeyInCycle indica se key alcança a si mesma pelas referências das expressões.
+func virtualKeyInCycle(defs []VirtualMetricRow, key string) bool {
+	deps := map[string][]string{}
+	for _, d := range defs {
+		if e, err := CompileExpr(d.Expression); err == nil {
+			deps[d.MetricKey] = append(deps[d.MetricKey], e.Vars()...)
+		}
+	}
+	seen := map[string]bool{}
+	stack := append([]string(nil), deps[key]...)
+	for len(stack) > 0 {
+		k := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if k == key {
+			return true
+		}
+		if seen[k] {
+			continue
+		}
+		seen[k] = true
+		stack = append(stack, deps[k]...)
+	}
+	return false
+}
+
+// CreateVirtualMetric valida e insere a definição e lista a métrica no catálogo dos ativos do escopo.
+func CreateVirtualMetric(db *sql.DB, r VirtualMetricRow) (uuid.UUID, error) {
+	if err := validateVirtualMetric(db, &r); err != nil {
+		return uuid.Nil, err
+	}
+	var id uuid.UUID
+	err := db.QueryRow(`
+		INSERT INTO nxd.virtual_metrics (factory_id, sector_id, asset_id, metric_key, expression, unit, description, mode, created_by)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), $8, $9)
+		ON CONFLICT DO NOTHING
+		RETURNING id
+	`, r.FactoryID, r.SectorID, r.AssetID, r.MetricKey, r.Expression, r.Unit, r.Description, r.Mode, r.CreatedBy).Scan(&id)
+	if err == sql.ErrNoRows {
+		return uuid.Nil, ErrVirtualMetricConflict
+	}
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return id, syncVirtualCatalog(db, id)
+}
+
+// UpdateVirtualMetric altera expressão, unidade, descrição, modo e ativo (escopo e
+// metric_key são fixos). Trocar a expressão zera o estado de integrate/derivative.
+// Retorna false se não existir.
+func UpdateVirtualMetric(db *sql.DB, r VirtualMetricRow) (bool, error) {
+	cur, err := GetVirtualMetric(db, r.FactoryID, r.ID)
+	if err != nil || cur == nil {
+		return false, err
+	}
+	r.SectorID, r.AssetID, r.MetricKey = cur.SectorID, cur.AssetID, cur.MetricKey
+	if err := validateVirtualMetric(db, &r); err != nil {
+		return false, err
+	}
+	if _, err := db.Exec(`
+		UPDATE nxd.virtual_metrics
+		SET expression = $1, unit = NULLIF($2, ''), description = NULLIF($3, ''), mode = $4, active = $5, updated_at = NOW()
+		WHERE id = $6 AND factory_id = $7
+	`, r.Expression, r.Unit, r.Description, r.Mode, r.Active, r.ID, r.FactoryID); err != nil {
+		return false, err
+	}
+	if r.Expression != cur.Expression {
+		if _, err := db.Exec(`DELETE FROM nxd.virtual_metric_state WHERE virtual_metric_id = $1`, r.ID); err != nil {
+			return true, err
+		}
+	}
+	return true, syncVirtualCatalog(db, r.ID)
+}
+
+// DeleteVirtualMetric remove a definição (estado e catálogo saem em cascata; as
+// leituras já gravadas ficam). Retorna false se não existir.
+func DeleteVirtualMetric(db *sql.DB, factoryID, id uuid.UUID) (bool, error) {
+	var key string
+	err := db.QueryRow(`DELETE FROM nxd.virtual_metrics WHERE id = $1 AND factory_id = $2 RETURNING metric_key`, id, factoryID).Scan(&key)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	// Outra definição com a mesma chave (outro nível) volta a aparecer no catálogo.
+	rows, err := db.Query(`SELECT id FROM nxd.virtual_metrics WHERE factory_id = $1 AND metric_key = $2`, factoryID, key)
+	if err != nil {
+		return true, err
+	}
+	var others []uuid.UUID
+	for rows.Next() {
+		var o uuid.UUID
+		if err := rows.Scan(&o); err != nil {
+			rows.Close()
+			return true, err
+		}
+		others = append(others, o)
+	}
+	rows.Close()
+	for _, o := range others {
+		if err := syncVirtualCatalog(db, o); err != nil {
+			return true, err
+		}
+	}
+	return true, rows.Err()
+}
+
+// syncVirtualCatalog lista a métrica no catálogo de cada ativo do escopo.
+func syncVirtualCatalog(db *sql.DB, id uuid.UUID) error {
+	_, err := db.Exec(`
+		INSERT INTO nxd.asset_metric_catalog (factory_id, asset_id, metric_key, first_seen, last_seen, virtual_metric_id)
+		SELECT v.factory_id, a.id, v.metric_key, NOW(), NOW(), v.id
+		FROM nxd.virtual_metrics v
+		JOIN nxd.assets a ON a.factory_id = v.factory_id
+		WHERE v.id = $1 AND (v.asset_id = a.id OR (v.asset_id IS NULL AND (v.sector_id IS NULL OR v.sector_id = a.group_id)))
+		ON CONFLICT (factory_id, asset_id, metric_key) DO NOTHING
+	`, id)
+	return err
+}
+
+// ─── Avaliação ─────────────────────────────────────────────────────────────
+
+type compiledVirtual struct {
+	VirtualMetricRow
+	expr *Expr
+}
+
+// virtualLast — última leitura de uma entrada (amostra-e-retém entre payloads).
+type virtualLast struct {
+	Ts time.Time `json:"ts"`
+	V  float64   `json:"v"`
+}
+
+// virtualState — estado persistido por métrica virtual e ativo.
+type virtualState struct {
+	Expr   exprState              `json:"expr"`
+	Inputs map[string]virtualLast `json:"inputs,omitempty"`
+}
+
+// specificity: ativo > setor > fábrica.
+func (r VirtualMetricRow) specificity() int {
+	switch {
+	case r.AssetID != nil:
+		return 2
+	case r.SectorID != nil:
+		return 1
+	}
+	return 0
+}
+
+// resolveVirtualMetrics escolhe, para o ativo, a definição mais específica de cada
+// metric_key e ordena por dependência (quem é usado vem antes). Definições com
+// expressão inválida ou em ciclo ficam de fora.
+func resolveVirtualMetrics(defs []VirtualMetricRow, assetID uuid.UUID, sectorID *uuid.UUID) []compiledVirtual {
+	best := map[string]VirtualMetricRow{}
+	var keys []string
+	for _, d := range defs {
+		if !d.Active {
+			continue
+		}
+		if d.AssetID != nil && *d.AssetID != assetID {
+			continue
+		}
+		if d.AssetID == nil && d.SectorID != nil && (sectorID == nil || *d.SectorID != *sectorID) {
+			continue
+		}
+		cur, ok := best[d.MetricKey]
+		if !ok {
+			keys = append(keys, d.MetricKey)
+		}
+		if !ok || d.specificity() > cur.specificity() {
+			best[d.MetricKey] = d
+		}
+	}
+	sort.Strings(keys)
+	compiled := map[string]compiledVirtual{}
+	for _, k := range keys {
+		if e, err := CompileExpr(best[k].Expression); err == nil {
+			compiled[k] = compiledVirtual{VirtualMetricRow: best[k], expr: e}
+		}
+	}
+	// Ordenação topológica (DFS); 1 = visitando, 2 = pronto.
+	var out []compiledVirtual
+	mark := map[string]int{}
+	var visit func(k string) bool
+	visit = func(k string) bool {
+		switch mark[k] {
+		case 1:
+			return false
+		case 2:
+			return true
+		}
+		mark[k] = 1
+		c := compiled[k]
+		for _, dep := range c.expr.Vars() {
+			if _, isVirtual := compiled[dep]; isVirtual && !visit(dep) {
+				return false
+			}
+		}
+		mark[k] = 2
+		out = append(out, c)
+		return true
+	}
+	for _, k := range keys {
+		if _, ok := compiled[k]; ok && mark[k] == 0 && !visit(k) {
+			mark[k] = 2 // em ciclo: descartada
+		}
+	}
+	return out
+}
+
+// evalVirtualStep avalia as métricas (já ordenadas) em ts. vars recebe também os
+// resultados, para as métricas seguintes. Uma métrica só é avaliada quando ao
+// menos uma de suas entradas chegou neste instante.
+func evalVirtualStep(defs []compiledVirtual, states map[uuid.UUID]*virtualState, vars map[string]float64, ts time.Time) []TelemetryRow {
+	var out []TelemetryRow
+	for _, d := range defs {
+		st := states[d.ID]
+		if st == nil {
+			st = &virtualState{}
+			states[d.ID] = st
+		}
+		if st.Inputs == nil {
+			st.Inputs = map[string]virtualLast{}
+		}
+		in := make(map[string]float64, len(d.expr.Vars()))
+		fresh := len(d.expr.Vars()) == 0
+		for _, k := range d.expr.Vars() {
+			if v, ok := vars[k]; ok {
+				in[k] = v
+				st.Inputs[k] = virtualLast{Ts: ts, V: v}
+				fresh = true
+			} else if last, ok := st.Inputs[k]; ok && !ts.Before(last.Ts) && ts.Sub(last.Ts) <= virtualMaxGap {
+				in[k] = last.V
+			}
+		}
+		if !fresh {
+			continue
+		}
+		v, ok := d.expr.Eval(in, ts, &st.Expr)
+		if !ok {
+			continue
+		}
+		vars[d.MetricKey] = v
+		out = append(out, TelemetryRow{Ts: ts, MetricKey: d.MetricKey, MetricValue: v, Status: "VIRTUAL"})
+	}
+	return out
+}
+
+// loadAssetVirtualMetrics retorna as métricas virtuais que valem para o ativo, já resolvidas.
+func loadAssetVirtualMetrics(db *sql.DB, factoryID, assetID uuid.UUID) ([]compiledVirtual, error) {
+	var sectorID uuid.NullUUID
+	err := db.QueryRow(`SELECT group_id FROM nxd.assets WHERE id = $1 AND factory_id = $2`, assetID, factoryID).Scan(&sectorID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.Query(`SELECT `+virtualMetricColumns+` FROM nxd.virtual_metrics
+		WHERE factory_id = $1 AND active AND (asset_id = $2 OR (asset_id IS NULL AND (sector_id IS NULL OR sector_id = $3)))`,
+		factoryID, assetID, sectorID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var defs []VirtualMetricRow
+	for rows.Next() {
+		r, err := scanVirtualMetric(rows)
+		if err != nil {
+			return nil, err
+		}
+		defs = append(defs, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	var sp *uuid.UUID
+	if sectorID.Valid {
+		sp = &sectorID.UUID
+	}
+	return resolveVirtualMetrics(defs, assetID, sp), nil
+}
+
+// ApplyVirtualMetrics avalia as métricas virtuais mode=ingest do ativo com as
+// leituras recém-gravadas e grava os resultados em telemetry_log e no catálogo.
+// Retorna quantas leituras virtuais foram gravadas.
+func ApplyVirtualMetrics(db *sql.DB, factoryID, assetID uuid.UUID, correlationID string, rows []TelemetryRow) (int, error) {
+	if len(rows) == 0 {
+		return 0, nil
+	}
+	all, err := loadAssetVirtualMetrics(db, factoryID, assetID)
+	if err != nil || len(all) == 0 {
+		return 0, err
+	}
+	// Métricas mode=query não são gravadas, mas podem ser entrada de uma mode=ingest:
+	// nesse caso a dependente fica sem a entrada e não é avaliada.
+	var defs []compiledVirtual
+	for _, d := range all {
+		if d.Mode == "ingest" {
+			defs = append(defs, d)
+		}
+	}
+	if len(defs) == 0 {
+		return 0, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+	states := make(map[uuid.UUID]*virtualState, len(defs))
+	for _, d := range defs {
+		// FOR UPDATE serializa ingests simultâneos do mesmo ativo.
+		if _, err := tx.Exec(`INSERT INTO nxd.virtual_metric_state (virtual_metric_id, asset_id) VALUES ($1, $2) ON CONFLICT DO NOTHING`, d.ID, assetID); err != nil {
+			return 0, err
+		}
+		var raw []byte
+		if err := tx.QueryRow(`SELECT state FROM nxd.virtual_metric_state WHERE virtual_metric_id = $1 AND asset_id = $2 FOR UPDATE`, d.ID, assetID).Scan(&raw); err != nil {
+			return 0, err
+		}
+		st := &virtualState{}
+		if err := json.Unmarshal(raw, st); err != nil {
+			st = &virtualState{} // estado corrompido: recomeça
+		}
+		states[d.ID] = st
+	}
+
+	byTs := map[time.Time]map[string]float64{}
+	var stamps []time.Time
+	for _, r := range rows {
+		ts := r.Ts.UTC()
+		if byTs[ts] == nil {
+			byTs[ts] = map[string]float64{}
+			stamps = append(stamps, ts)
+		}
+		byTs[ts][r.MetricKey] = r.MetricValue
+	}
+	sort.Slice(stamps, func(i, j int) bool { return stamps[i].Before(stamps[j]) })
+	var out []TelemetryRow
+	for _, ts := range stamps {
+		out = append(out, evalVirtualStep(defs, states, byTs[ts], ts)...)
+	}
+
+	ids := map[string]uuid.UUID{}
+	for _, d := range defs {
+		ids[d.MetricKey] = d.ID
+		raw, _ := json.Marshal(states[d.ID])
+		if _, err := tx.Exec(`UPDATE nxd.virtual_metric_state SET state = $1, updated_at = NOW() WHERE virtual_metric_id = $2 AND asset_id = $3`, raw, d.ID, assetID); err != nil {
+			return 0, err
+		}
+	}
+	for _, r := range out {
+		if _, err := tx.Exec(`
+			INSERT INTO nxd.telemetry_log (ts, factory_id, asset_id, metric_key, metric_value, status, raw, correlation_id)
+			VALUES ($1, $2, $3, $4, $5, $6, 'null'::jsonb, $7)
+		`, r.Ts, factoryID, assetID, r.MetricKey, r.MetricValue, r.Status, correlationID); err != nil {
+			return 0, err
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO nxd.asset_metric_catalog (factory_id, asset_id, metric_key, first_seen, last_seen, virtual_metric_id)
+			VALUES ($1, $2, $3, $4, $4, $5)
+			ON CONFLICT (factory_id, asset_id, metric_key) DO UPDATE SET last_seen = GREATEST(nxd.asset_metric_catalog.last_seen, $4)
+		`, factoryID, assetID, r.MetricKey, r.Ts, ids[r.MetricKey]); err != nil {
+			return 0, err
+		}
+	}
+	return len(out), tx.Commit()
+}
+
+// QueryVirtualMetricRange calcula uma métrica mode=query do ativo em [from, to).
+// found=false quando a metric_key não é uma métrica virtual mode=query do ativo.
+func QueryVirtualMetricRange(ctx context.Context, db *sql.DB, storage ArchiveStorage, factoryID, assetID uuid.UUID, key string, from, to time.Time, limit int) (points []TelemetryPoint, truncated, found bool, err error) {
+	defs, err := loadAssetVirtualMetrics(db, factoryID, assetID)
+	if err != nil {
+		return nil, false, false, err
+	}
+	for _, d := range defs {
+		if d.MetricKey == key && d.Mode == "query" {
+			points, truncated, err = evaluateVirtualRange(ctx, db, storage, factoryID, assetID, defs, d, from, to, limit)
+			return points, truncated, true, err
+		}
+	}
+	return nil, false, false, nil
+}
+
+// PreviewVirtualExpression avalia uma expressão ainda não salva sobre o histórico do ativo.
+func PreviewVirtualExpression(ctx context.Context, db *sql.DB, storage ArchiveStorage, factoryID, assetID uuid.UUID, expression string, from, to time.Time, limit int) ([]TelemetryPoint, bool, error) {
+	e, err := CompileExpr(expression)
+	if err != nil {
+		return nil, false, err
+	}
+	defs, err := loadAssetVirtualMetrics(db, factoryID, assetID)
+	if err != nil {
+		return nil, false, err
+	}
+	target := compiledVirtual{VirtualMetricRow: VirtualMetricRow{ID: uuid.New(), MetricKey: "preview", Mode: "query", Active: true}, expr: e}
+	return evaluateVirtualRange(ctx, db, storage, factoryID, assetID, defs, target, from, to, limit)
+}
+
+// evaluateVirtualRange lê as entradas do período (quente + arquivo) e avalia a
+// métrica alvo com estado novo. Métricas mode=query das quais o alvo depende são
+// calculadas junto; as mode=ingest já estão gravadas e são lidas como tags.
+func evaluateVirtualRange(ctx context.Context, db *sql.DB, storage ArchiveStorage, factoryID, assetID uuid.UUID, defs []compiledVirtual, target compiledVirtual, from, to time.Time, limit int) ([]TelemetryPoint, bool, error) {
+	if limit <= 0 {
+		limit = 10000
+	}
+	byKey := map[string]compiledVirtual{}
+	for _, d := range defs {
+		if d.Mode == "query" && d.MetricKey != target.MetricKey {
+			byKey[d.MetricKey] = d
+		}
+	}
+	// Cadeia: dependências mode=query do alvo, na ordem de defs, e o alvo por último.
+	need := map[string]bool{}
+	var mark func(e *Expr)
+	mark = func(e *Expr) {
+		for _, k := range e.Vars() {
+			if d, ok := byKey[k]; ok && !need[k] {
+				need[k] = true
+				mark(d.expr)
+			}
+		}
+	}
+	mark(target.expr)
+	var chain []compiledVirtual
+	for _, d := range defs {
+		if need[d.MetricKey] {
+			chain = append(chain, d)
+		}
+	}
+	chain = append(chain, target)
+
+	produced := map[string]bool{}
+	for _, d := range chain {
+		produced[d.MetricKey] = true
+	}
+	byTs := map[time.Time]map[string]float64{}
+	var stamps []time.Time
+	for _, d := range chain {
+		for _, k := range d.expr.Vars() {
+			if produced[k] {
+				continue
+			}
+			produced[k] = true // lê cada entrada uma vez
+			pts, _, err := QueryTelemetryRange(ctx, db, storage, TelemetryRangeQuery{
+				FactoryID: factoryID, AssetID: &assetID, MetricKey: k, From: from, To: to, Limit: virtualMaxInputPoints,
+			})
+			if err != nil {
+				return nil, false, fmt.Errorf("entrada %s: %w", k, err)
+			}
+			for _, p := range pts {
+				ts := p.Ts.UTC()
+				if byTs[ts] == nil {
+					byTs[ts] = map[string]float64{}
+					stamps = append(stamps, ts)
+				}
+				byTs[ts][k] = p.MetricValue
+			}
+		}
+	}
+	sort.Slice(stamps, func(i, j int) bool { return stamps[i].Before(stamps[j]) })
+
+	states := map[uuid.UUID]*virtualState{}
+	var points []TelemetryPoint
+	for _, ts := range stamps {
+		for _, r := range evalVirtualStep(chain, states, byTs[ts], ts) {
+			if r.MetricKey != target.MetricKey {
+				continue
+			}
+			if len(points) >= limit {
+				return points, true, nil
+			}
+			points = append(points, TelemetryPoint{Ts: ts, AssetID: assetID, MetricKey: target.MetricKey, MetricValue: r.MetricValue, Status: r.Status, Source: "virtual"})
+		}
+	}
+	return points, false, nil
+}
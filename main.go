@@ -55,6 +55,15 @@ func main() {
 		os.Setenv("BUILD_VERSION", BuildVersion)
 	}
 
+	// Subcomando de manutenção: "server migrate status|up|down [n]" (não sobe o HTTP).
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrateCommand(os.Args[2:]))
+	}
+	// "server factory backup|restore" — copia fábricas entre ambientes.
+	if len(os.Args) > 1 && os.Args[1] == "factory" {
+		os.Exit(runFactoryCommand(os.Args[2:]))
+	}
+
 	port := os.Getenv("PORT")
 	if port == "" {
 		port = "8080"
@@ -88,6 +97,9 @@ func main() {
 	router.HandleFunc("/api/login", api.LoginHandler).Methods("POST")
 	router.HandleFunc("/api/login/2fa", api.Login2FAConfirmHandler).Methods("POST")
 	router.HandleFunc("/api/billing/webhook", api.BillingWebhookHandler).Methods("POST")
+	router.HandleFunc("/api/lgpd/deletions/{id}/certificate", api.DeletionCertificateHandler).Methods("GET")
+	router.HandleFunc("/api/lgpd/public-key", api.LGPDPublicKeyHandler).Methods("GET")
+	router.HandleFunc("/api/lgpd/certificates/verify", api.VerifyDeletionCertificateHandler).Methods("POST")
 
 	// Rotas Autenticadas via JWT
 	authRouter := router.PathPrefix("/api").Subrouter()
@@ -116,11 +128,134 @@ func main() {
 	// Config negócio + indicadores financeiros (MVP)
 	authRouter.HandleFunc("/business-config", api.ListBusinessConfigHandler).Methods("GET")
 	authRouter.HandleFunc("/business-config", api.UpsertBusinessConfigHandler).Methods("POST")
+	authRouter.HandleFunc("/business-config/currency", api.SetFactoryCurrencyHandler).Methods("PUT")
+	authRouter.HandleFunc("/cost-parameters", api.ListCostParametersHandler).Methods("GET")
+	authRouter.HandleFunc("/cost-parameters", api.CreateCostParameterHandler).Methods("POST")
+	authRouter.HandleFunc("/cost-parameters/{id}", api.UpdateCostParameterHandler).Methods("PUT")
+	authRouter.HandleFunc("/cost-parameters/{id}", api.DeleteCostParameterHandler).Methods("DELETE")
+	authRouter.HandleFunc("/exchange-rates", api.ListExchangeRatesHandler).Methods("GET")
+	authRouter.HandleFunc("/exchange-rates", api.CreateExchangeRateHandler).Methods("POST")
+	authRouter.HandleFunc("/exchange-rates/{id}", api.DeleteExchangeRateHandler).Methods("DELETE")
 	authRouter.HandleFunc("/tag-mappings", api.ListTagMappingsHandler).Methods("GET")
 	authRouter.HandleFunc("/tag-mappings", api.UpsertTagMappingHandler).Methods("POST")
+	authRouter.HandleFunc("/counters", api.ListCounterConfigsHandler).Methods("GET")
+	authRouter.HandleFunc("/counters", api.UpsertCounterConfigHandler).Methods("PUT")
+	authRouter.HandleFunc("/counters", api.DeleteCounterConfigHandler).Methods("DELETE")
 	authRouter.HandleFunc("/financial-summary", api.GetFinancialSummaryHandler).Methods("GET")
 	authRouter.HandleFunc("/financial-summary/ranges", api.GetFinancialSummaryRangesHandler).Methods("GET")
 	authRouter.HandleFunc("/financial-summary/export", api.GetFinancialExecutiveExportHandler).Methods("GET")
+	authRouter.HandleFunc("/financial-scenarios", api.ListFinancialScenariosHandler).Methods("GET")
+	authRouter.HandleFunc("/financial-scenarios", api.CreateFinancialScenarioHandler).Methods("POST")
+	authRouter.HandleFunc("/financial-scenarios/simulate", api.SimulateFinancialScenarioHandler).Methods("POST")
+	authRouter.HandleFunc("/financial-scenarios/compare", api.CompareFinancialScenariosHandler).Methods("GET")
+	authRouter.HandleFunc("/financial-scenarios/{id}", api.GetFinancialScenarioHandler).Methods("GET")
+	authRouter.HandleFunc("/financial-scenarios/{id}", api.DeleteFinancialScenarioHandler).Methods("DELETE")
+	// OEE + paradas planejadas
+	authRouter.HandleFunc("/oee", api.GetOEEHandler).Methods("GET")
+	authRouter.HandleFunc("/planned-downtime", api.ListPlannedDowntimeHandler).Methods("GET")
+	authRouter.HandleFunc("/planned-downtime", api.CreatePlannedDowntimeHandler).Methods("POST")
+	authRouter.HandleFunc("/planned-downtime/{id}", api.DeletePlannedDowntimeHandler).Methods("DELETE")
+	// Eventos de parada + motivos + Pareto
+	authRouter.HandleFunc("/downtime/events", api.ListDowntimeEventsHandler).Methods("GET")
+	authRouter.HandleFunc("/downtime/events/{id}/classify", api.ClassifyDowntimeEventHandler).Methods("POST")
+	authRouter.HandleFunc("/downtime/pareto", api.GetDowntimeParetoHandler).Methods("GET")
+	authRouter.HandleFunc("/downtime/reasons", api.ListDowntimeReasonsHandler).Methods("GET")
+	authRouter.HandleFunc("/downtime/reasons", api.CreateDowntimeReasonHandler).Methods("POST")
+	authRouter.HandleFunc("/downtime/reasons/defaults", api.InstallDefaultDowntimeReasonsHandler).Methods("POST")
+	authRouter.HandleFunc("/downtime/reasons/{id}", api.UpdateDowntimeReasonHandler).Methods("PUT")
+	// Confiabilidade (MTBF/MTTR)
+	authRouter.HandleFunc("/reliability", api.GetReliabilityHandler).Methods("GET")
+	// Energia: medidores, tarifa horária (ponta/fora-ponta) e demanda
+	authRouter.HandleFunc("/energy/summary", api.GetEnergySummaryHandler).Methods("GET")
+	authRouter.HandleFunc("/energy/meters", api.ListEnergyMetersHandler).Methods("GET")
+	authRouter.HandleFunc("/energy/meters", api.CreateEnergyMeterHandler).Methods("POST")
+	authRouter.HandleFunc("/energy/meters/{id}", api.UpdateEnergyMeterHandler).Methods("PUT")
+	authRouter.HandleFunc("/energy/meters/{id}", api.DeleteEnergyMeterHandler).Methods("DELETE")
+	authRouter.HandleFunc("/energy/tariffs", api.ListEnergyTariffsHandler).Methods("GET")
+	authRouter.HandleFunc("/energy/tariffs", api.CreateEnergyTariffHandler).Methods("POST")
+	authRouter.HandleFunc("/energy/tariffs/{id}", api.UpdateEnergyTariffHandler).Methods("PUT")
+	authRouter.HandleFunc("/energy/tariffs/{id}", api.DeleteEnergyTariffHandler).Methods("DELETE")
+	authRouter.HandleFunc("/esg/summary", api.GetESGSummaryHandler).Methods("GET")
+	authRouter.HandleFunc("/esg/region", api.SetESGRegionHandler).Methods("PUT")
+	authRouter.HandleFunc("/esg/factors", api.ListEmissionFactorsHandler).Methods("GET")
+	authRouter.HandleFunc("/esg/factors", api.CreateEmissionFactorHandler).Methods("POST")
+	authRouter.HandleFunc("/esg/factors/{id}", api.UpdateEmissionFactorHandler).Methods("PUT")
+	authRouter.HandleFunc("/esg/factors/{id}", api.DeleteEmissionFactorHandler).Methods("DELETE")
+	// Calendário de produção (turnos, feriados, horas extras) + relatório por turno
+	authRouter.HandleFunc("/calendar", api.GetCalendarHandler).Methods("GET")
+	authRouter.HandleFunc("/calendar/timezone", api.SetCalendarTimezoneHandler).Methods("PUT")
+	authRouter.HandleFunc("/calendar/exceptions", api.CreateCalendarExceptionHandler).Methods("POST")
+	authRouter.HandleFunc("/calendar/exceptions/{id}", api.DeleteCalendarExceptionHandler).Methods("DELETE")
+	authRouter.HandleFunc("/shifts", api.CreateShiftHandler).Methods("POST")
+	authRouter.HandleFunc("/shifts/instances", api.ListShiftInstancesHandler).Methods("GET")
+	authRouter.HandleFunc("/shifts/report", api.GetShiftReportHandler).Methods("GET")
+	authRouter.HandleFunc("/shifts/{id}", api.UpdateShiftHandler).Methods("PUT")
+	authRouter.HandleFunc("/shifts/{id}", api.DeleteShiftHandler).Methods("DELETE")
+	// Ordens de produção (lotes) + rentabilidade por produto
+	authRouter.HandleFunc("/production-orders", api.ListProductionOrdersHandler).Methods("GET")
+	authRouter.HandleFunc("/production-orders", api.CreateProductionOrderHandler).Methods("POST")
+	authRouter.HandleFunc("/production-orders/profitability", api.GetProductProfitabilityHandler).Methods("GET")
+	authRouter.HandleFunc("/production-orders/{id}", api.GetProductionOrderHandler).Methods("GET")
+	authRouter.HandleFunc("/production-orders/{id}", api.UpdateProductionOrderHandler).Methods("PUT")
+	authRouter.HandleFunc("/production-orders/{id}", api.DeleteProductionOrderHandler).Methods("DELETE")
+	// Correlação defasada entre tags (exploração de causa raiz)
+	authRouter.HandleFunc("/correlations", api.GetCorrelationsHandler).Methods("GET")
+	// Tempo de ciclo (distribuição, percentis, micro-paradas por ativo/ordem)
+	authRouter.HandleFunc("/cycle-times", api.GetCycleTimesHandler).Methods("GET")
+	// Benchmarking (setores, ativos, fábricas da organização; mediana do setor industrial)
+	authRouter.HandleFunc("/benchmark", api.GetBenchmarkHandler).Methods("GET")
+	authRouter.HandleFunc("/benchmark/settings", api.GetBenchmarkSettingsHandler).Methods("GET")
+	authRouter.HandleFunc("/benchmark/settings", api.SetBenchmarkSettingsHandler).Methods("PUT")
+	// Metas de produção (planejado × realizado, ritmo) + alertas disparados
+	authRouter.HandleFunc("/production-targets", api.ListProductionTargetsHandler).Methods("GET")
+	authRouter.HandleFunc("/production-targets", api.CreateProductionTargetHandler).Methods("POST")
+	authRouter.HandleFunc("/production-targets/progress", api.GetTargetProgressHandler).Methods("GET")
+	authRouter.HandleFunc("/production-targets/pace", api.GetTargetPaceHandler).Methods("GET")
+	authRouter.HandleFunc("/production-targets/{id}", api.UpdateProductionTargetHandler).Methods("PUT")
+	authRouter.HandleFunc("/production-targets/{id}", api.DeleteProductionTargetHandler).Methods("DELETE")
+	authRouter.HandleFunc("/alerts", api.ListAlertsHandler).Methods("GET")
+	// Saúde dos ativos (score preditivo versionado e explicável) + manutenções realizadas
+	authRouter.HandleFunc("/asset-health", api.GetAssetHealthHandler).Methods("GET")
+	authRouter.HandleFunc("/asset-health/history", api.GetAssetHealthHistoryHandler).Methods("GET")
+	authRouter.HandleFunc("/asset-health/model", api.GetHealthModelHandler).Methods("GET")
+	authRouter.HandleFunc("/asset-health/model", api.SaveHealthModelHandler).Methods("PUT")
+	authRouter.HandleFunc("/asset-health/tags", api.ListHealthTagsHandler).Methods("GET")
+	authRouter.HandleFunc("/asset-health/tags", api.CreateHealthTagHandler).Methods("POST")
+	authRouter.HandleFunc("/asset-health/tags/{id}", api.DeleteHealthTagHandler).Methods("DELETE")
+	authRouter.HandleFunc("/maintenance-events", api.ListMaintenanceEventsHandler).Methods("GET")
+	authRouter.HandleFunc("/maintenance-events", api.CreateMaintenanceEventHandler).Methods("POST")
+	authRouter.HandleFunc("/maintenance-events/{id}", api.DeleteMaintenanceEventHandler).Methods("DELETE")
+	// Inspeções de qualidade / não conformidades (reclassificam OK → NOK no OEE e no financeiro)
+	authRouter.HandleFunc("/defect-types", api.ListDefectTypesHandler).Methods("GET")
+	authRouter.HandleFunc("/defect-types", api.CreateDefectTypeHandler).Methods("POST")
+	authRouter.HandleFunc("/defect-types/{id}", api.UpdateDefectTypeHandler).Methods("PUT")
+	authRouter.HandleFunc("/inspections", api.ListInspectionsHandler).Methods("GET")
+	authRouter.HandleFunc("/inspections", api.CreateInspectionHandler).Methods("POST")
+	authRouter.HandleFunc("/inspections/pareto", api.GetDefectParetoHandler).Methods("GET")
+	authRouter.HandleFunc("/inspections/{id}", api.UpdateInspectionHandler).Methods("PUT")
+	authRouter.HandleFunc("/inspections/{id}", api.DeleteInspectionHandler).Methods("DELETE")
+	authRouter.HandleFunc("/inspections/{id}/attachments", api.AddInspectionAttachmentHandler).Methods("POST")
+	authRouter.HandleFunc("/inspections/{id}/attachments/{attachment_id}", api.DeleteInspectionAttachmentHandler).Methods("DELETE")
+	// Anotações na linha do tempo (gráficos, passagem de turno e contexto da IA)
+	authRouter.HandleFunc("/annotations", api.ListAnnotationsHandler).Methods("GET")
+	authRouter.HandleFunc("/annotations", api.CreateAnnotationHandler).Methods("POST")
+	authRouter.HandleFunc("/annotations/{id}", api.UpdateAnnotationHandler).Methods("PUT")
+	authRouter.HandleFunc("/annotations/{id}", api.DeleteAnnotationHandler).Methods("DELETE")
+	// Previsão de séries (Holt-Winters com intervalos; acurácia contra os reais)
+	authRouter.HandleFunc("/forecasts", api.GetForecastHandler).Methods("GET")
+	authRouter.HandleFunc("/forecasts", api.CreateForecastHandler).Methods("POST")
+	authRouter.HandleFunc("/forecasts/accuracy", api.GetForecastAccuracyHandler).Methods("GET")
+	authRouter.HandleFunc("/forecasts/series", api.ListForecastSeriesHandler).Methods("GET")
+	authRouter.HandleFunc("/forecasts/series", api.UpsertForecastSeriesHandler).Methods("PUT")
+	authRouter.HandleFunc("/forecasts/series/{id}", api.DeleteForecastSeriesHandler).Methods("DELETE")
+	// Métricas virtuais (fórmulas sobre tags existentes)
+	authRouter.HandleFunc("/virtual-metrics", api.ListVirtualMetricsHandler).Methods("GET")
+	authRouter.HandleFunc("/virtual-metrics", api.CreateVirtualMetricHandler).Methods("POST")
+	authRouter.HandleFunc("/virtual-metrics/preview", api.PreviewVirtualMetricHandler).Methods("POST")
+	authRouter.HandleFunc("/virtual-metrics/{id}", api.UpdateVirtualMetricHandler).Methods("PUT")
+	authRouter.HandleFunc("/virtual-metrics/{id}", api.DeleteVirtualMetricHandler).Methods("DELETE")
+	// Histórico de telemetria (lê arquivos frios de forma transparente)
+	authRouter.HandleFunc("/telemetry/history", api.TelemetryHistoryHandler).Methods("GET")
 	// 2FA TOTP
 	authRouter.HandleFunc("/auth/2fa/setup", api.SetupTOTPHandler).Methods("GET")
 	authRouter.HandleFunc("/auth/2fa/confirm", api.ConfirmTOTPHandler).Methods("POST")
@@ -136,12 +271,29 @@ func main() {
 	// All routes require JWT. Factory is inferred from the authenticated user.
 	authRouter.HandleFunc("/me", api.MeHandler).Methods("GET")
 	authRouter.HandleFunc("/admin/audit-log", api.ListAuditLogHandler).Methods("GET")
+	authRouter.HandleFunc("/admin/migrations", api.MigrationsStatusHandler).Methods("GET")
 	authRouter.HandleFunc("/admin/import-jobs", api.ListImportJobsHandler).Methods("GET")
 	authRouter.HandleFunc("/admin/import-jobs", api.CreateImportJobHandler).Methods("POST")
 	authRouter.HandleFunc("/admin/import-jobs/{id}", api.GetImportJobHandler).Methods("GET")
 	authRouter.HandleFunc("/admin/import-jobs/{id}/cancel", api.CancelImportJobHandler).Methods("POST")
 	authRouter.HandleFunc("/admin/import-jobs/{id}/retry", api.RetryImportJobHandler).Methods("POST")
 	authRouter.HandleFunc("/admin/import-jobs/{id}/data", api.SubmitImportJobDataHandler).Methods("POST")
+	authRouter.HandleFunc("/admin/export-jobs", api.ListExportJobsHandler).Methods("GET")
+	authRouter.HandleFunc("/admin/export-jobs", api.CreateExportJobHandler).Methods("POST")
+	authRouter.HandleFunc("/admin/export-jobs/{id}", api.GetExportJobHandler).Methods("GET")
+	authRouter.HandleFunc("/admin/export-jobs/{id}/cancel", api.CancelExportJobHandler).Methods("POST")
+	authRouter.HandleFunc("/admin/export-jobs/{id}/download", api.DownloadExportJobHandler).Methods("GET")
+	authRouter.HandleFunc("/admin/archives", api.ListTelemetryArchivesHandler).Methods("GET")
+	authRouter.HandleFunc("/admin/archives/run", api.RunTelemetryArchiveHandler).Methods("POST")
+	authRouter.HandleFunc("/admin/factory/backup", api.FactoryBackupHandler).Methods("GET")
+	authRouter.HandleFunc("/admin/factory/restore", api.FactoryRestoreHandler).Methods("POST")
+	authRouter.HandleFunc("/admin/factory/clone", api.FactoryCloneHandler).Methods("POST")
+	authRouter.HandleFunc("/account/deletion", api.GetAccountDeletionHandler).Methods("GET")
+	authRouter.HandleFunc("/account/deletion", api.RequestAccountDeletionHandler).Methods("POST")
+	authRouter.HandleFunc("/account/deletion/cancel", api.CancelAccountDeletionHandler).Methods("POST")
+	authRouter.HandleFunc("/admin/tenant-deletions", api.ListTenantDeletionsHandler).Methods("GET")
+	authRouter.HandleFunc("/admin/tenant-deletions", api.CreateTenantDeletionHandler).Methods("POST")
+	authRouter.HandleFunc("/admin/tenant-deletions/{id}/cancel", api.CancelTenantDeletionHandler).Methods("POST")
 
 	// Rotas com autenticação via API Key (não usam JWT middleware)
 	router.HandleFunc("/api/dashboard", api.GetDashboardHandler).Methods("GET")
@@ -216,8 +368,23 @@ func main() {
 		workerCtx, workerCancel := context.WithCancel(context.Background())
 		go store.RunImportWorker(workerCtx, store.NXDDB())
 		log.Println("✓ Worker de importação histórica iniciado.")
+		if store.Driver() == "postgres" {
+			go store.RunArchiveWorker(workerCtx, store.NXDDB())
+			go store.RunExportWorker(workerCtx, store.NXDDB(), api.GetDB())
+			log.Println("✓ Worker de exportação de dados iniciado.")
+			go store.RunDowntimeWorker(workerCtx, store.NXDDB())
+			go store.RunProductionOrderWorker(workerCtx, store.NXDDB())
+			go store.RunTargetAlertWorker(workerCtx, store.NXDDB())
+			go store.RunBenchmarkWorker(workerCtx, store.NXDDB())
+			go store.RunCycleTimeWorker(workerCtx, store.NXDDB())
+			go store.RunForecastWorker(workerCtx, store.NXDDB())
+			go store.RunAssetHealthWorker(workerCtx, store.NXDDB())
+		}
 		_ = workerCancel
 	}
+	if apiDBOk {
+		go api.RunTenantDeletionWorker(context.Background())
+	}
 
 	// Bloqueia até sinal de encerramento
 	sigChan := make(chan os.Signal, 1)
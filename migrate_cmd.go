@@ -0,0 +1,127 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"hubsystem/api"
+	"hubsystem/internal/nxd/store"
+)
+
+const migrateUsage = `uso: server migrate <status|up|down> [n] [--set=legacy|nxd|all]
+
+  status          lista as migrations de cada schema (aplicada, pendente, skipped)
+  up              aplica as migrations pendentes
+  down [n]        reverte as n últimas migrations (padrão 1; exige --set)
+`
+
+// runMigrateCommand executa o subcomando "migrate" e retorna o exit code.
+func runMigrateCommand(args []string) int {
+	setName := "all"
+	var pos []string
+	for _, a := range args {
+		if len(a) > 6 && a[:6] == "--set=" {
+			setName = a[6:]
+			continue
+		}
+		pos = append(pos, a)
+	}
+	if len(pos) == 0 || (setName != "all" && setName != "legacy" && setName != "nxd") {
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	type target struct {
+		db  *sql.DB
+		set store.MigrationSet
+	}
+	var targets []target
+	if setName == "all" || setName == "legacy" {
+		db, err := api.OpenLegacyDB()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ banco legado: %v\n", err)
+			return 1
+		}
+		defer db.Close()
+		targets = append(targets, target{db, api.LegacyMigrationSet(api.LegacyDriver())})
+	}
+	if setName == "all" || setName == "nxd" {
+		db, err := store.OpenNXDDB()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ banco NXD: %v\n", err)
+			return 1
+		}
+		defer db.Close()
+		targets = append(targets, target{db, store.NXDMigrationSet(store.Driver())})
+	}
+
+	switch pos[0] {
+	case "status":
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		for _, t := range targets {
+			rows, err := store.MigrationStatus(t.db, t.set)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "❌ %s: %v\n", t.set.Name, err)
+				return 1
+			}
+			fmt.Fprintf(tw, "\n[%s] %s — %d pendente(s)\n", t.set.Name, t.set.Table, store.PendingMigrations(rows))
+			fmt.Fprintln(tw, "VERSÃO\tNOME\tESTADO\tAPLICADA EM")
+			for _, r := range rows {
+				state, at := "pendente", ""
+				switch {
+				case r.Unknown:
+					state = "desconhecida"
+				case r.Skipped:
+					state = "skipped: " + r.SkipError
+				case r.Applied:
+					state = "aplicada"
+				}
+				if r.Modified {
+					state += " (alterada)"
+				}
+				if r.AppliedAt != nil {
+					at = r.AppliedAt.Format("2006-01-02 15:04:05")
+				}
+				fmt.Fprintf(tw, "%03d\t%s\t%s\t%s\n", r.Version, r.Name, state, at)
+			}
+		}
+		tw.Flush()
+	case "up":
+		for _, t := range targets {
+			n, err := store.MigrateUp(t.db, t.set)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "❌ %s: %v\n", t.set.Name, err)
+				return 1
+			}
+			fmt.Printf("✓ %s: %d migration(s) aplicada(s)\n", t.set.Name, n)
+		}
+	case "down":
+		if setName == "all" {
+			fmt.Fprintln(os.Stderr, "down exige --set=legacy ou --set=nxd")
+			return 2
+		}
+		steps := 1
+		if len(pos) > 1 {
+			v, err := strconv.Atoi(pos[1])
+			if err != nil || v < 1 {
+				fmt.Fprintf(os.Stderr, "n inválido: %q\n", pos[1])
+				return 2
+			}
+			steps = v
+		}
+		t := targets[0]
+		n, err := store.MigrateDown(t.db, t.set, steps)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "❌ %s: %v\n", t.set.Name, err)
+			return 1
+		}
+		fmt.Printf("✓ %s: %d migration(s) revertida(s)\n", t.set.Name, n)
+	default:
+		fmt.Fprint(os.Stderr, migrateUsage)
+		return 2
+	}
+	return 0
+}